@@ -0,0 +1,337 @@
+//-----------------------------------------------------------------------------
+/*
+
+Test Coupons: Printer calibration artifacts.
+
+Each coupon is a ladder of small features, one per test value, printed
+in one go to find the settings a printer needs for a design:
+
+Clearance: a plate of holes (nominal diameter + clearance) and a nominal peg.
+The first hole is at the chamfered corner of the plate.
+
+Thread: a block of internal threads (nominal radius + tolerance) and a
+nominal bolt. The first thread is at the chamfered corner of the block.
+
+Overhang: a fan of fins tilted at increasing angles from the vertical.
+
+Bridge: pairs of pillars joined by bridges of increasing span.
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// couponPlate returns a plate on the xy plane (the top at z = 0), chamfered at the -x,-y corner.
+func couponPlate(size sdf.V3, chamfer float64) (sdf.SDF3, error) {
+	s, err := sdf.Box3D(size, 0)
+	if err != nil {
+		return nil, err
+	}
+	s = sdf.Transform3D(s, sdf.Translate3d(sdf.V3{0, 0, -0.5 * size.Z}))
+	if chamfer == 0 {
+		return s, nil
+	}
+	corner := sdf.V3{-0.5*size.X + chamfer, -0.5 * size.Y, 0}
+	return sdf.Cut3D(s, corner, sdf.V3{1, 1, 0}), nil
+}
+
+// couponLadder returns the x positions of n features at a pitch, centered on the origin.
+func couponLadder(n int, pitch float64) []float64 {
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = (float64(i) - 0.5*float64(n-1)) * pitch
+	}
+	return x
+}
+
+//-----------------------------------------------------------------------------
+// Clearance Coupon
+
+// ClearanceCouponParms defines the parameters for a hole/peg clearance coupon.
+type ClearanceCouponParms struct {
+	Diameter   float64   // nominal diameter
+	Clearances []float64 // diametral clearances of the holes
+	Thickness  float64   // plate thickness
+	Wall       float64   // wall between the holes (and the plate edge)
+}
+
+// ClearanceCoupon3D returns a plate of holes (nominal diameter + clearance, in order along x) and a
+// nominal peg (2x the plate thickness long, on a handle) to find the clearance of a fit.
+func ClearanceCoupon3D(k *ClearanceCouponParms) (plate, peg sdf.SDF3, err error) {
+	// validate parameters
+	if k.Diameter <= 0 {
+		return nil, nil, sdf.ErrMsg("Diameter <= 0")
+	}
+	if len(k.Clearances) == 0 {
+		return nil, nil, sdf.ErrMsg("no clearances")
+	}
+	if k.Thickness <= 0 {
+		return nil, nil, sdf.ErrMsg("Thickness <= 0")
+	}
+	if k.Wall <= 0 {
+		return nil, nil, sdf.ErrMsg("Wall <= 0")
+	}
+	dMax := k.Diameter
+	for _, c := range k.Clearances {
+		if k.Diameter+c <= 0 {
+			return nil, nil, sdf.ErrMsg("Diameter + clearance <= 0")
+		}
+		dMax = math.Max(dMax, k.Diameter+c)
+	}
+
+	// plate of holes
+	pitch := dMax + k.Wall
+	n := len(k.Clearances)
+	plate, err = couponPlate(sdf.V3{float64(n)*pitch + k.Wall, dMax + 2*k.Wall, k.Thickness}, k.Wall)
+	if err != nil {
+		return nil, nil, err
+	}
+	holes := make([]sdf.SDF3, n)
+	for i, x := range couponLadder(n, pitch) {
+		h, err := sdf.Cylinder3D(2*k.Thickness, 0.5*(k.Diameter+k.Clearances[i]), 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		holes[i] = sdf.Transform3D(h, sdf.Translate3d(sdf.V3{x, 0, -0.5 * k.Thickness}))
+	}
+	plate = sdf.Difference3D(plate, sdf.Union3D(holes...))
+
+	// peg on a handle
+	l := 2 * k.Thickness
+	pin, err := sdf.Cylinder3D(l, 0.5*k.Diameter, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	pin, err = ChamferedCylinder(pin, 0, 0.2)
+	if err != nil {
+		return nil, nil, err
+	}
+	pin = sdf.Transform3D(pin, sdf.Translate3d(sdf.V3{0, 0, 0.5 * l}))
+	handle, err := sdf.Cylinder3D(k.Thickness, k.Diameter+k.Wall, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	handle = sdf.Transform3D(handle, sdf.Translate3d(sdf.V3{0, 0, -0.5 * k.Thickness}))
+	return plate, sdf.Union3D(pin, handle), nil
+}
+
+//-----------------------------------------------------------------------------
+// Thread Coupon
+
+// ThreadCouponParms defines the parameters for a thread fit coupon.
+type ThreadCouponParms struct {
+	Thread     string    // name of thread
+	Tolerances []float64 // add to the internal thread radius
+	Length     float64   // thread length (0: the hex nut height)
+}
+
+// ThreadCoupon3D returns a block of internal threads (nominal radius + tolerance, in order along x)
+// and a nominal hex bolt to find the tolerance of a threaded fit (see Nut and Bolt).
+func ThreadCoupon3D(k *ThreadCouponParms) (block, bolt sdf.SDF3, err error) {
+	// validate parameters
+	t, err := sdf.ThreadLookup(k.Thread)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(k.Tolerances) == 0 {
+		return nil, nil, sdf.ErrMsg("no tolerances")
+	}
+	if k.Length < 0 {
+		return nil, nil, sdf.ErrMsg("Length < 0")
+	}
+	l := k.Length
+	if l == 0 {
+		l = t.HexHeight()
+	}
+
+	// block of internal threads
+	tMax := 0.0
+	for _, tol := range k.Tolerances {
+		if tol < 0 {
+			return nil, nil, sdf.ErrMsg("tolerance < 0")
+		}
+		tMax = math.Max(tMax, tol)
+	}
+	wall := 0.25 * t.HexRadius()
+	d := 2 * (t.Radius + tMax)
+	pitch := d + 2*wall
+	n := len(k.Tolerances)
+	block, err = couponPlate(sdf.V3{float64(n)*pitch + wall, d + 4*wall, l}, 2*wall)
+	if err != nil {
+		return nil, nil, err
+	}
+	threads := make([]sdf.SDF3, n)
+	for i, x := range couponLadder(n, pitch) {
+		isoThread, err := sdf.ISOThread(t.Radius+k.Tolerances[i], t.Pitch, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		s, err := sdf.Screw3D(isoThread, l, t.Taper, t.Pitch, 1)
+		if err != nil {
+			return nil, nil, err
+		}
+		threads[i] = sdf.Transform3D(s, sdf.Translate3d(sdf.V3{x, 0, -0.5 * l}))
+	}
+	block = sdf.Difference3D(block, sdf.Union3D(threads...))
+
+	// nominal bolt, threaded past the block
+	bolt, err = Bolt(&BoltParms{
+		Thread:      k.Thread,
+		Style:       "hex",
+		TotalLength: l + 2*t.Pitch,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, bolt, nil
+}
+
+//-----------------------------------------------------------------------------
+// Overhang Coupon
+
+// OverhangCouponParms defines the parameters for an overhang fan coupon.
+type OverhangCouponParms struct {
+	Angles    []float64 // fin angles from the vertical (radians, nil: 20 to 70 degrees in 10 degree steps)
+	Length    float64   // fin length
+	Width     float64   // fin width (and the gap between fins)
+	Thickness float64   // fin thickness
+	Base      float64   // base plate thickness
+}
+
+// OverhangCoupon3D returns a fan of fins on a base plate (the top at z = 0), each rising from a
+// line on the plate and tilted towards +x by its angle (in order along y), to find the steepest
+// overhang that prints.
+func OverhangCoupon3D(k *OverhangCouponParms) (sdf.SDF3, error) {
+	// validate parameters
+	angles := k.Angles
+	if angles == nil {
+		angles = []float64{sdf.DtoR(20), sdf.DtoR(30), sdf.DtoR(40), sdf.DtoR(50), sdf.DtoR(60), sdf.DtoR(70)}
+	}
+	if len(angles) == 0 {
+		return nil, sdf.ErrMsg("no angles")
+	}
+	if k.Length <= 0 {
+		return nil, sdf.ErrMsg("Length <= 0")
+	}
+	if k.Width <= 0 {
+		return nil, sdf.ErrMsg("Width <= 0")
+	}
+	if k.Thickness <= 0 {
+		return nil, sdf.ErrMsg("Thickness <= 0")
+	}
+	if k.Base < 0 {
+		return nil, sdf.ErrMsg("Base < 0")
+	}
+
+	n := len(angles)
+	fins := make([]sdf.SDF3, n)
+	xMax := 0.0
+	for i, y := range couponLadder(n, 2*k.Width) {
+		a := angles[i]
+		if a < 0 || a >= 0.5*sdf.Pi {
+			return nil, sdf.ErrMsg("angle must be 0 to 90 degrees")
+		}
+		xMax = math.Max(xMax, k.Length*math.Sin(a))
+		// extend the fin below the plate top, so the tilted fin stands on its full thickness
+		e := 0.5 * k.Thickness * math.Tan(a)
+		fin, err := sdf.Box3D(sdf.V3{k.Thickness, k.Width, k.Length + e}, 0)
+		if err != nil {
+			return nil, err
+		}
+		m := sdf.Translate3d(sdf.V3{0, y, 0}).Mul(sdf.RotateY(a)).Mul(sdf.Translate3d(sdf.V3{0, 0, 0.5 * (k.Length - e)}))
+		fins[i] = sdf.Transform3D(fin, m)
+	}
+	s := sdf.Union3D(fins...)
+	// remove the fin ends below the plate top
+	s = sdf.Cut3D(s, sdf.V3{}, sdf.V3{0, 0, 1})
+	if k.Base == 0 {
+		return s, nil
+	}
+	x0, x1 := -k.Thickness-k.Width, xMax+k.Thickness+k.Width
+	base, err := couponPlate(sdf.V3{x1 - x0, float64(2*n) * k.Width, k.Base}, 0)
+	if err != nil {
+		return nil, err
+	}
+	base = sdf.Transform3D(base, sdf.Translate3d(sdf.V3{0.5 * (x0 + x1), 0, 0}))
+	return sdf.Union3D(s, base), nil
+}
+
+//-----------------------------------------------------------------------------
+// Bridge Coupon
+
+// BridgeCouponParms defines the parameters for a bridging coupon.
+type BridgeCouponParms struct {
+	Spans     []float64 // bridge spans (between the pillars)
+	Height    float64   // pillar height (to the bridge top)
+	Width     float64   // bridge (and pillar) width, and the gap between bridges
+	Thickness float64   // bridge thickness
+	Pillar    float64   // pillar length along the span
+	Base      float64   // base plate thickness
+}
+
+// BridgeCoupon3D returns pairs of pillars joined by bridges (in order along y) on a base plate
+// (the top at z = 0), to find the longest bridge that prints.
+func BridgeCoupon3D(k *BridgeCouponParms) (sdf.SDF3, error) {
+	// validate parameters
+	if len(k.Spans) == 0 {
+		return nil, sdf.ErrMsg("no spans")
+	}
+	if k.Width <= 0 {
+		return nil, sdf.ErrMsg("Width <= 0")
+	}
+	if k.Thickness <= 0 {
+		return nil, sdf.ErrMsg("Thickness <= 0")
+	}
+	if k.Height <= k.Thickness {
+		return nil, sdf.ErrMsg("Height <= Thickness")
+	}
+	if k.Pillar <= 0 {
+		return nil, sdf.ErrMsg("Pillar <= 0")
+	}
+	if k.Base < 0 {
+		return nil, sdf.ErrMsg("Base < 0")
+	}
+
+	pillar, err := sdf.Box3D(sdf.V3{k.Pillar, k.Width, k.Height}, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := len(k.Spans)
+	parts := make([]sdf.SDF3, 0, 3*n+1)
+	xMax := 0.0
+	for i, y := range couponLadder(n, 2*k.Width) {
+		span := k.Spans[i]
+		if span <= 0 {
+			return nil, sdf.ErrMsg("span <= 0")
+		}
+		x := 0.5 * (span + k.Pillar)
+		xMax = math.Max(xMax, x+0.5*k.Pillar)
+		parts = append(parts,
+			sdf.Transform3D(pillar, sdf.Translate3d(sdf.V3{-x, y, 0.5 * k.Height})),
+			sdf.Transform3D(pillar, sdf.Translate3d(sdf.V3{x, y, 0.5 * k.Height})),
+		)
+		bridge, err := sdf.Box3D(sdf.V3{span, k.Width, k.Thickness}, 0)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, sdf.Transform3D(bridge, sdf.Translate3d(sdf.V3{0, y, k.Height - 0.5*k.Thickness})))
+	}
+	if k.Base != 0 {
+		base, err := couponPlate(sdf.V3{2*xMax + 2*k.Width, float64(2*n) * k.Width, k.Base}, 0)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, base)
+	}
+	return sdf.Union3D(parts...), nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,284 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bosses for Threaded Inserts and Self-Tapping Screws
+
+The dimensions are looked up by the insert (or screw) size and the
+material/process of the part:
+
+Heat-set inserts: the hole is the recommended hole of the insert (for
+FDM parts, where the insert is melted in), or the insert diameter with a
+clearance where the insert is glued or pressed in (SLA resins do not
+melt). The cavity is deeper than the insert for the displaced plastic and
+has a lead-in chamfer.
+
+Self-tapping screws (e.g. for plastics, PT/Delta PT style): the pilot hole
+and boss diameters are ratios of the screw diameter, and the default
+thread engagement is 2.5 screw diameters.
+
+The values are starting points (printers and resins vary), all are in mm.
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"fmt"
+	"log"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+// Materials
+
+// BossMaterial is the material/process of a boss.
+type BossMaterial struct {
+	Name            string  // name
+	HeatSet         bool    // inserts are melted in (else glued or pressed in)
+	InsertClearance float64 // added to the insert hole diameter
+	InsertDepth     float64 // cavity depth beyond the insert
+	Wall            float64 // smallest wall around an insert
+	PilotRatio      float64 // pilot hole/screw diameter
+	BossRatio       float64 // boss/screw diameter
+}
+
+type bossMaterialDatabase map[string]*BossMaterial
+
+var bossMaterialDB = initBossMaterialLookup()
+
+// add adds a material to the material database.
+func (m bossMaterialDatabase) add(name string, heatSet bool, clearance, depth, wall, pilot, boss float64) {
+	if pilot >= 1 || boss <= 1 {
+		log.Panicf("bad screw ratios for \"%s\"", name)
+	}
+	m[name] = &BossMaterial{name, heatSet, clearance, depth, wall, pilot, boss}
+}
+
+// initBossMaterialLookup adds the materials/processes to the material database.
+func initBossMaterialLookup() bossMaterialDatabase {
+	m := make(bossMaterialDatabase)
+	// printed holes come out small, so FDM pilot holes are larger
+	m.add("fdm_pla", true, 0, 1.0, 1.6, 0.85, 2.5)
+	m.add("fdm_petg", true, 0.1, 1.0, 1.8, 0.85, 2.5)
+	// resins are brittle: glued inserts, thicker bosses
+	m.add("sla", false, 0.1, 0.5, 2.0, 0.8, 2.8)
+	return m
+}
+
+// BossMaterialLookup returns the parameters of a named material/process
+// ("fdm_pla", "fdm_petg" or "sla").
+func BossMaterialLookup(name string) (*BossMaterial, error) {
+	if m, ok := bossMaterialDB[name]; ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("boss material \"%s\" not found", name)
+}
+
+//-----------------------------------------------------------------------------
+// Inserts and Screws
+
+// InsertParameters stores the dimensions of a threaded (heat-set) insert.
+type InsertParameters struct {
+	Name     string  // name (thread x length)
+	Thread   string  // thread size
+	Diameter float64 // outer diameter
+	Length   float64 // insert length
+	Hole     float64 // recommended (heat-set) hole diameter
+}
+
+type insertDatabase map[string]*InsertParameters
+
+var insertDB = initInsertLookup()
+
+// add adds an insert to the insert database.
+func (m insertDatabase) add(thread string, diameter, length, hole float64) {
+	if hole >= diameter {
+		log.Panicf("hole >= diameter for insert \"%s\"", thread)
+	}
+	name := fmt.Sprintf("%sx%g", thread, length)
+	m[name] = &InsertParameters{name, thread, diameter, length, hole}
+}
+
+// initInsertLookup adds common heat-set inserts to the insert database.
+func initInsertLookup() insertDatabase {
+	m := make(insertDatabase)
+	m.add("M2", 3.6, 3.0, 3.2)
+	m.add("M2.5", 4.6, 4.0, 4.0)
+	m.add("M3", 4.6, 4.0, 4.0)
+	m.add("M3", 4.6, 5.7, 4.0)
+	m.add("M4", 6.3, 8.1, 5.6)
+	m.add("M5", 7.1, 9.5, 6.4)
+	m.add("M6", 8.7, 12.7, 8.0)
+	m.add("M8", 10.1, 12.7, 9.7)
+	return m
+}
+
+// InsertLookup returns the dimensions of a named insert (e.g. "M3x5.7").
+func InsertLookup(name string) (*InsertParameters, error) {
+	if k, ok := insertDB[name]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("insert \"%s\" not found", name)
+}
+
+// screwDiameters are the nominal diameters of self-tapping screws.
+var screwDiameters = map[string]float64{
+	"M2":   2.0,
+	"M2.5": 2.5,
+	"M3":   3.0,
+	"M3.5": 3.5,
+	"M4":   4.0,
+	"M5":   5.0,
+	"M6":   6.0,
+	"#2":   0.086 * sdf.MillimetresPerInch,
+	"#4":   0.112 * sdf.MillimetresPerInch,
+	"#6":   0.138 * sdf.MillimetresPerInch,
+	"#8":   0.164 * sdf.MillimetresPerInch,
+	"#10":  0.190 * sdf.MillimetresPerInch,
+}
+
+//-----------------------------------------------------------------------------
+// Bosses
+
+// BossDimensions are the dimensions of a boss and its cavity.
+type BossDimensions struct {
+	Diameter float64 // boss diameter
+	Height   float64 // boss height
+	Hole     float64 // hole diameter
+	Depth    float64 // hole depth
+	Chamfer  float64 // lead-in chamfer of the hole
+}
+
+// InsertBossParms defines the parameters for a threaded insert boss.
+type InsertBossParms struct {
+	Insert   string  // insert name (see InsertLookup)
+	Material string  // material/process (see BossMaterialLookup)
+	Height   float64 // boss height (0: the hole depth and a floor of the wall thickness)
+}
+
+// ScrewBossParms defines the parameters for a self-tapping screw boss.
+type ScrewBossParms struct {
+	Screw    string  // screw size ("M2" to "M6", "#2" to "#10")
+	Material string  // material/process (see BossMaterialLookup)
+	Depth    float64 // thread engagement (0: 2.5 screw diameters)
+	Height   float64 // boss height (0: the hole depth and a floor of a screw diameter)
+}
+
+// InsertBossDimensions returns the dimensions of a threaded insert boss.
+func InsertBossDimensions(k *InsertBossParms) (*BossDimensions, error) {
+	insert, err := InsertLookup(k.Insert)
+	if err != nil {
+		return nil, err
+	}
+	mat, err := BossMaterialLookup(k.Material)
+	if err != nil {
+		return nil, err
+	}
+	if k.Height < 0 {
+		return nil, sdf.ErrMsg("Height < 0")
+	}
+	d := &BossDimensions{Hole: insert.Hole + mat.InsertClearance}
+	if !mat.HeatSet {
+		d.Hole = insert.Diameter + mat.InsertClearance
+	}
+	d.Depth = insert.Length + mat.InsertDepth
+	// guide the insert in to its outer diameter
+	d.Chamfer = math.Max(0.5*(insert.Diameter-d.Hole), 0.3)
+	wall := math.Max(mat.Wall, 0.5*insert.Diameter)
+	d.Diameter = d.Hole + 2*wall
+	d.Height = k.Height
+	if d.Height == 0 {
+		d.Height = d.Depth + mat.Wall
+	}
+	if d.Height < d.Depth {
+		return nil, sdf.ErrMsg("Height < hole depth")
+	}
+	return d, nil
+}
+
+// ScrewBossDimensions returns the dimensions of a self-tapping screw boss.
+func ScrewBossDimensions(k *ScrewBossParms) (*BossDimensions, error) {
+	screw, ok := screwDiameters[k.Screw]
+	if !ok {
+		return nil, fmt.Errorf("screw \"%s\" not found", k.Screw)
+	}
+	mat, err := BossMaterialLookup(k.Material)
+	if err != nil {
+		return nil, err
+	}
+	if k.Depth < 0 || k.Height < 0 {
+		return nil, sdf.ErrMsg("Depth or Height < 0")
+	}
+	d := &BossDimensions{
+		Diameter: mat.BossRatio * screw,
+		Hole:     mat.PilotRatio * screw,
+		Depth:    k.Depth,
+		Height:   k.Height,
+	}
+	if d.Depth == 0 {
+		d.Depth = 2.5 * screw
+	}
+	// room for the screw tip
+	d.Depth += 0.5 * screw
+	// lead-in to the screw diameter
+	d.Chamfer = 0.5 * (screw - d.Hole)
+	if d.Height == 0 {
+		d.Height = d.Depth + screw
+	}
+	if d.Height < d.Depth {
+		return nil, sdf.ErrMsg("Height < hole depth")
+	}
+	return d, nil
+}
+
+// boss3D returns a boss (with its cavity) and its cavity. The boss stands on the xy plane
+// and the cavity is open at the top. The cavity extends above the top by the chamfer.
+func (d *BossDimensions) boss3D() (boss, cavity sdf.SDF3, err error) {
+	r := 0.5 * d.Hole
+	boss, err = sdf.Cylinder3D(d.Height, 0.5*d.Diameter, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	boss = sdf.Transform3D(boss, sdf.Translate3d(sdf.V3{0, 0, 0.5 * d.Height}))
+	hole, err := sdf.Cylinder3D(d.Depth, r, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	hole = sdf.Transform3D(hole, sdf.Translate3d(sdf.V3{0, 0, d.Height - 0.5*d.Depth}))
+	cavity = hole
+	if d.Chamfer > 0 {
+		c := d.Chamfer
+		lead, err := sdf.Cone3D(2*c, r, r+2*c, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		lead = sdf.Transform3D(lead, sdf.Translate3d(sdf.V3{0, 0, d.Height}))
+		cavity = sdf.Union3D(hole, lead)
+	}
+	return sdf.Difference3D(boss, cavity), cavity, nil
+}
+
+// InsertBoss3D returns a boss for a threaded insert, and its cavity (to subtract from other
+// parts, e.g. a wall thick enough for the insert). The boss stands on the xy plane.
+func InsertBoss3D(k *InsertBossParms) (boss, cavity sdf.SDF3, err error) {
+	d, err := InsertBossDimensions(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.boss3D()
+}
+
+// ScrewBoss3D returns a boss for a self-tapping screw, and its cavity (to subtract from other
+// parts). The boss stands on the xy plane.
+func ScrewBoss3D(k *ScrewBossParms) (boss, cavity sdf.SDF3, err error) {
+	d, err := ScrewBossDimensions(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	return d.boss3D()
+}
+
+//-----------------------------------------------------------------------------
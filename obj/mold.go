@@ -0,0 +1,209 @@
+//-----------------------------------------------------------------------------
+/*
+
+Two Part Molds
+
+A block around a part is split at a horizontal parting plane into two
+mold halves. The cavity in each half is the part swept away from the
+parting plane (so the half can be pulled off without undercuts) with a
+draft angle on the sweep. The halves have registration keys at the
+corners of the block (bumps on the bottom half, sockets in the top half),
+a tapered pour sprue and air vents through the top half.
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// moldSweepSDF3 is a part swept along a direction with a draft angle: the union over
+// s >= 0 of the part translated by -s * dir and grown by s * tan(draft).
+type moldSweepSDF3 struct {
+	part  sdf.SDF3
+	dir   float64 // sweep direction in z (+1: the part above a point is swept down to it)
+	end   float64 // z at which the sweep ends (the far side of the part)
+	slope float64 // tan(draft angle)
+	tol   float64 // evaluation tolerance
+	bb    sdf.Box3
+}
+
+// Evaluate returns the minimum distance to the swept part. The sweep is a minimum
+// over a ray, walked with steps bounded by the Lipschitz constant (1 + slope) of the
+// ray function. Outside, the result is a lower bound of the minimum (within tol near
+// the surface), inside it is the smallest sample, so it never overestimates the distance.
+func (s *moldSweepSDF3) Evaluate(p sdf.V3) float64 {
+	length := math.Max(0, (s.end-p.Z)*s.dir)
+	k := 1 + s.slope
+	lower, sampled := math.Inf(1), math.Inf(1)
+	for t := 0.0; ; {
+		g := s.part.Evaluate(sdf.V3{p.X, p.Y, p.Z + t*s.dir}) - t*s.slope
+		h := math.Max(s.tol, 0.5*math.Abs(g)) / k
+		lower = math.Min(lower, g-k*h)
+		sampled = math.Min(sampled, g)
+		if t >= length {
+			break
+		}
+		t = math.Min(t+h, length)
+	}
+	if sampled < 0 {
+		return sampled
+	}
+	return lower
+}
+
+// BoundingBox returns the bounding box of the swept part.
+func (s *moldSweepSDF3) BoundingBox() sdf.Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// moldFootprint samples the cavity of a mold half on the parting plane (at the
+// center of each cell of an n x n grid) and calls fn for the points inside it.
+func moldFootprint(cavity sdf.SDF3, bb sdf.Box3, z float64, n int, fn func(p sdf.V3, d float64)) {
+	size := bb.Size()
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			p := sdf.V3{
+				bb.Min.X + (float64(i)+0.5)*size.X/float64(n),
+				bb.Min.Y + (float64(j)+0.5)*size.Y/float64(n),
+				z,
+			}
+			if d := cavity.Evaluate(p); d < 0 {
+				fn(p, d)
+			}
+		}
+	}
+}
+
+// moldChannel returns a vertical cylinder (or cone) from z0 up to z1 at a point.
+func moldChannel(p sdf.V3, z0, z1, r0, r1 float64) (sdf.SDF3, error) {
+	c, err := sdf.Cone3D(z1-z0, r0, r1, 0)
+	if err != nil {
+		return nil, err
+	}
+	return sdf.Transform3D(c, sdf.Translate3d(sdf.V3{p.X, p.Y, 0.5 * (z0 + z1)})), nil
+}
+
+// MakeMold returns the top and bottom halves of a two part mold for a part.
+// The mold block (of blockSize) is centered on the part and split at the
+// z = partingPlane plane. The draft angle (radians, < 45 degrees) tapers the
+// cavity walls towards the parting plane. Vents of ventDiameter (0: no vents)
+// run from the parts of the cavity furthest from the sprue to the top of the
+// block. The sprue diameter is 1/5 of the smallest horizontal size of the part.
+func MakeMold(part sdf.SDF3, blockSize sdf.V3, partingPlane, draftAngle, ventDiameter float64) (top, bottom sdf.SDF3, err error) {
+	if part == nil {
+		return nil, nil, sdf.ErrMsg("part == nil")
+	}
+	if draftAngle < 0 || draftAngle >= sdf.DtoR(45) {
+		return nil, nil, sdf.ErrMsg("draftAngle must be >= 0 and < 45 degrees")
+	}
+	if ventDiameter < 0 {
+		return nil, nil, sdf.ErrMsg("ventDiameter < 0")
+	}
+	pbb := part.BoundingBox()
+	if partingPlane <= pbb.Min.Z || partingPlane >= pbb.Max.Z {
+		return nil, nil, sdf.ErrMsg("partingPlane is not within the part")
+	}
+	block := sdf.NewBox3(pbb.Center(), blockSize)
+	slope := math.Tan(draftAngle)
+	// the draft grows the cavity towards the parting plane
+	grow := slope * pbb.Size().Z
+	cbb := sdf.Box3{pbb.Min.Sub(sdf.V3{grow, grow, 0}), pbb.Max.Add(sdf.V3{grow, grow, 0})}
+	margin := block.Max.Sub(cbb.Max).Min(cbb.Min.Sub(block.Min))
+	if margin.X <= 0 || margin.Y <= 0 || block.Min.Z >= pbb.Min.Z || block.Max.Z <= pbb.Max.Z {
+		return nil, nil, sdf.ErrMsg("the block is too small for the part")
+	}
+
+	// cavities
+	tol := pbb.Size().MaxComponent() / 500
+	topCavity := &moldSweepSDF3{part, 1, pbb.Max.Z, slope, tol, sdf.Box3{sdf.V3{cbb.Min.X, cbb.Min.Y, block.Min.Z}, cbb.Max}}
+	bottomCavity := &moldSweepSDF3{part, -1, pbb.Min.Z, slope, tol, sdf.Box3{cbb.Min, sdf.V3{cbb.Max.X, cbb.Max.Y, block.Max.Z}}}
+
+	// block halves
+	topBlock, err := sdf.Box3D(sdf.V3{blockSize.X, blockSize.Y, block.Max.Z - partingPlane}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	topBlock = sdf.Transform3D(topBlock, sdf.Translate3d(sdf.V3{block.Center().X, block.Center().Y, 0.5 * (block.Max.Z + partingPlane)}))
+	bottomBlock, err := sdf.Box3D(sdf.V3{blockSize.X, blockSize.Y, partingPlane - block.Min.Z}, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	bottomBlock = sdf.Transform3D(bottomBlock, sdf.Translate3d(sdf.V3{block.Center().X, block.Center().Y, 0.5 * (block.Min.Z + partingPlane)}))
+
+	// registration keys in the corners outside the cavity
+	keyRadius := math.Min(math.Min(margin.X, margin.Y)/4, 0.5*math.Min(block.Max.Z-partingPlane, partingPlane-block.Min.Z))
+	key, err := sdf.Sphere3D(keyRadius)
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys []sdf.SDF3
+	for _, c := range []sdf.V2{{-1, -1}, {1, -1}, {1, 1}, {-1, 1}} {
+		x := block.Center().X + c.X*(0.5*blockSize.X-0.5*margin.X)
+		y := block.Center().Y + c.Y*(0.5*blockSize.Y-0.5*margin.Y)
+		keys = append(keys, sdf.Transform3D(key, sdf.Translate3d(sdf.V3{x, y, partingPlane})))
+	}
+	keySet := sdf.Union3D(keys...)
+
+	// sprue at the deepest point of the top cavity footprint
+	var sprue sdf.V3
+	depth := math.Inf(1)
+	var footprint []sdf.V3
+	moldFootprint(topCavity, cbb, partingPlane, 32, func(p sdf.V3, d float64) {
+		footprint = append(footprint, p)
+		if d < depth {
+			sprue, depth = p, d
+		}
+	})
+	if footprint == nil {
+		return nil, nil, sdf.ErrMsg("the part has no cross section on the parting plane")
+	}
+	sprueRadius := 0.1 * math.Min(pbb.Size().X, pbb.Size().Y)
+	channels := []sdf.SDF3{}
+	c, err := moldChannel(sprue, partingPlane, block.Max.Z, sprueRadius, 2*sprueRadius)
+	if err != nil {
+		return nil, nil, err
+	}
+	channels = append(channels, c)
+
+	// vents at the two footprint points furthest from the sprue (and each other)
+	if ventDiameter > 0 {
+		vents := []sdf.V3{sprue}
+		for n := 0; n < 2; n++ {
+			var best sdf.V3
+			far := 0.0
+			for _, p := range footprint {
+				d := math.Inf(1)
+				for _, v := range vents {
+					d = math.Min(d, p.Sub(v).Length())
+				}
+				if d > far {
+					best, far = p, d
+				}
+			}
+			if far <= sprueRadius+ventDiameter {
+				break
+			}
+			vents = append(vents, best)
+			c, err := moldChannel(best, partingPlane, block.Max.Z, 0.5*ventDiameter, 0.5*ventDiameter)
+			if err != nil {
+				return nil, nil, err
+			}
+			channels = append(channels, c)
+		}
+	}
+
+	top = sdf.Difference3D(topBlock, sdf.Union3D(append([]sdf.SDF3{topCavity, keySet}, channels...)...))
+	bottom = sdf.Difference3D(sdf.Union3D(bottomBlock, sdf.Intersect3D(keySet, topBlock)), bottomCavity)
+	return top, bottom, nil
+}
+
+//-----------------------------------------------------------------------------
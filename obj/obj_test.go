@@ -0,0 +1,240 @@
+//-----------------------------------------------------------------------------
+/*
+
+Object Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+const tolerance = 1e-9
+
+func Test_InsertBoss(t *testing.T) {
+	insert, _ := InsertLookup("M3x5.7")
+	// melted in: the recommended hole
+	d, err := InsertBossDimensions(&InsertBossParms{"M3x5.7", "fdm_pla", 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(d.Hole-insert.Hole) > tolerance || math.Abs(d.Depth-(insert.Length+1)) > tolerance {
+		t.Errorf("fdm_pla: bad hole %g x %g", d.Hole, d.Depth)
+	}
+	// glued in: the insert diameter with a clearance
+	d, err = InsertBossDimensions(&InsertBossParms{"M3x5.7", "sla", 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(d.Hole-(insert.Diameter+0.1)) > tolerance {
+		t.Errorf("sla: bad hole %g", d.Hole)
+	}
+	boss, cavity, err := InsertBoss3D(&InsertBossParms{"M3x5.7", "fdm_petg", 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, _ = InsertBossDimensions(&InsertBossParms{"M3x5.7", "fdm_petg", 0})
+	// in the wall, in the hole, below the hole
+	wall := sdf.V3{0.25 * (d.Hole + d.Diameter), 0, 0.5 * d.Height}
+	hole := sdf.V3{0, 0, d.Height - 0.5*d.Depth}
+	floor := sdf.V3{0, 0, 0.5 * (d.Height - d.Depth)}
+	if boss.Evaluate(wall) >= 0 || boss.Evaluate(hole) <= 0 || boss.Evaluate(floor) >= 0 {
+		t.Error("bad boss")
+	}
+	if cavity.Evaluate(hole) >= 0 || cavity.Evaluate(wall) <= 0 {
+		t.Error("bad cavity")
+	}
+	for _, k := range []InsertBossParms{
+		{"M3x9", "fdm_pla", 0},
+		{"M3x5.7", "abs", 0},
+		{"M3x5.7", "fdm_pla", -1},
+		{"M3x5.7", "fdm_pla", 2},
+	} {
+		if _, err := InsertBossDimensions(&k); err == nil {
+			t.Errorf("expected an error for %v", k)
+		}
+	}
+}
+
+func Test_ScrewBoss(t *testing.T) {
+	d, err := ScrewBossDimensions(&ScrewBossParms{"M3", "fdm_pla", 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2.5 screw diameters of thread and 0.5 for the tip
+	if math.Abs(d.Depth-9) > tolerance || math.Abs(d.Height-12) > tolerance {
+		t.Errorf("bad depth %g or height %g", d.Depth, d.Height)
+	}
+	if math.Abs(d.Hole-0.85*3) > tolerance || math.Abs(d.Diameter-2.5*3) > tolerance {
+		t.Errorf("bad hole %g or diameter %g", d.Hole, d.Diameter)
+	}
+	if _, err := ScrewBossDimensions(&ScrewBossParms{"M7", "fdm_pla", 0, 0}); err == nil {
+		t.Error("expected an error for M7")
+	}
+	if _, err := ScrewBossDimensions(&ScrewBossParms{"M3", "fdm_pla", 6, 5}); err == nil {
+		t.Error("expected an error for Height < Depth")
+	}
+}
+
+func Test_CantileverSnap(t *testing.T) {
+	// the overhang for a strain has the strain
+	for _, taper := range []float64{0, 0.5, 0.75} {
+		k := &CantileverSnapParms{Length: 10, Thickness: 1.5, Width: 4, Taper: taper, Strain: 0.02}
+		strain, err := CantileverSnapStrain(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(strain-0.02) > tolerance {
+			t.Errorf("taper %g: expected strain 0.02, actual %g", taper, strain)
+		}
+	}
+	k := &CantileverSnapParms{Length: 10, Thickness: 1.5, Width: 4, Overhang: 1, Clearance: 0.2}
+	_, mating, separation, err := CantileverSnapForces(k, 2000, 0.3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mating <= 0 || !math.IsInf(separation, 1) {
+		t.Errorf("bad forces %g %g", mating, separation)
+	}
+	hook, recess, err := CantileverSnap3D(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the beam root, the hook tip and the catch window
+	if hook.Evaluate(sdf.V3{0.75, 0, 0.1}) >= 0 || hook.Evaluate(sdf.V3{2, 0, 10.3}) >= 0 || hook.Evaluate(sdf.V3{3, 0, 5}) <= 0 {
+		t.Error("bad hook")
+	}
+	if recess.Evaluate(sdf.V3{2.4, 0, 10.5}) >= 0 || recess.Evaluate(sdf.V3{0.5, 0, 5}) <= 0 {
+		t.Error("bad recess")
+	}
+	if _, err := CantileverSnapStrain(&CantileverSnapParms{Length: 10, Thickness: 1.5, Width: 4}); err == nil {
+		t.Error("expected an error for no Overhang or Strain")
+	}
+}
+
+func Test_AnnularSnap(t *testing.T) {
+	k := &AnnularSnapParms{Diameter: 10, Strain: 0.03, Land: 0.5, Clearance: 0.1}
+	strain, err := AnnularSnapStrain(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(strain-0.03) > tolerance {
+		t.Errorf("expected strain 0.03, actual %g", strain)
+	}
+	bead, groove, err := AnnularSnap3D(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the overhang is 0.3, the entry ramp is 0.3/tan(30)
+	p := sdf.V3{5.2, 0, 0.3/math.Tan(sdf.DtoR(30)) + 0.25}
+	if bead.Evaluate(p) >= 0 || bead.Evaluate(sdf.V3{5.5, 0, 0.5}) <= 0 {
+		t.Error("bad bead")
+	}
+	if groove.Evaluate(p) >= 0 || groove.Evaluate(p) > bead.Evaluate(p) {
+		t.Error("bad groove")
+	}
+	if _, err := AnnularSnapStrain(&AnnularSnapParms{Diameter: 10, Overhang: 5}); err == nil {
+		t.Error("expected an error for Overhang >= Diameter/2")
+	}
+}
+
+func Test_MakeMold(t *testing.T) {
+	part, _ := sdf.Sphere3D(1)
+	block := sdf.V3{4, 4, 4}
+	top, bottom, err := MakeMold(part, block, 0, sdf.DtoR(2), 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the part is outside both halves
+	for _, p := range []sdf.V3{{0, 0, 0.5}, {0.3, 0.2, -0.5}, {0, 0.9, 0}, {-0.5, 0, 0.8}} {
+		if top.Evaluate(p) <= 0 || bottom.Evaluate(p) <= 0 {
+			t.Errorf("%v is inside a mold half (%g, %g)", p, top.Evaluate(p), bottom.Evaluate(p))
+		}
+	}
+	// the block around it is in one half
+	for _, p := range []sdf.V3{{1.5, 0, 1.5}, {0, -1.5, 0.2}} {
+		if top.Evaluate(p) >= 0 || bottom.Evaluate(p) <= 0 {
+			t.Errorf("%v isn't in the top half", p)
+		}
+		p.Z = -p.Z
+		if bottom.Evaluate(p) >= 0 || top.Evaluate(p) <= 0 {
+			t.Errorf("%v isn't in the bottom half", p)
+		}
+	}
+	tests := []struct {
+		name                 string
+		block                sdf.V3
+		parting, draft, vent float64
+	}{
+		{"draft", block, 0, sdf.DtoR(45), 0},
+		{"negative draft", block, 0, -0.1, 0},
+		{"vent", block, 0, 0, -0.2},
+		{"parting plane", block, 1.5, 0, 0},
+		{"block", sdf.V3{2.1, 4, 4}, 0, sdf.DtoR(5), 0},
+	}
+	for _, v := range tests {
+		if _, _, err := MakeMold(part, v.block, v.parting, v.draft, v.vent); err == nil {
+			t.Errorf("%s: expected an error", v.name)
+		}
+	}
+}
+
+func Test_Coupons(t *testing.T) {
+	plate, peg, err := ClearanceCoupon3D(&ClearanceCouponParms{5, []float64{0.1, 0.2, 0.3}, 3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, bolt, err := ThreadCoupon3D(&ThreadCouponParms{"M6x1", []float64{0.1, 0.2}, 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	overhang, err := OverhangCoupon3D(&OverhangCouponParms{Length: 10, Width: 2, Thickness: 1, Base: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bridge, err := BridgeCoupon3D(&BridgeCouponParms{Spans: []float64{5, 10, 15}, Height: 5, Width: 2, Thickness: 1, Pillar: 3, Base: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bolt == nil {
+		t.Error("no bolt")
+	}
+
+	// 2 threads of 6.4 diameter (at most) with walls of a quarter of the hex radius
+	thread, _ := sdf.ThreadLookup("M6x1")
+	wall := 0.25 * thread.HexRadius()
+	tx, ty := 0.5*(2*(6.4+2*wall)+wall), 0.5*(6.4+4*wall)
+	// the fins are 20 to 70 degrees: the 20 degree fin is the tallest, the 70 degree fin the longest
+	a := sdf.DtoR(20)
+	e := 0.5 * math.Tan(a)
+	top := 0.5*(10-e)*math.Cos(a) + 0.5*math.Sin(a) + 0.5*(10+e)*math.Cos(a)
+	tests := []struct {
+		name     string
+		s        sdf.SDF3
+		min, max sdf.V3
+	}{
+		// 3 holes at a pitch of 5.3 + 2
+		{"clearance plate", plate, sdf.V3{-11.95, -4.65, -3}, sdf.V3{11.95, 4.65, 0}},
+		// the peg is 6 long on a handle of radius 7
+		{"clearance peg", peg, sdf.V3{-7, -7, -3}, sdf.V3{7, 7, 6}},
+		{"thread block", block, sdf.V3{-tx, -ty, -8}, sdf.V3{tx, ty, 0}},
+		{"overhang", overhang, sdf.V3{-3, -12, -1}, sdf.V3{10*math.Sin(sdf.DtoR(70)) + 3, 12, top}},
+		// the 15 span bridge has pillars to 15/2 + 3
+		{"bridge", bridge, sdf.V3{-12.5, -6, -1}, sdf.V3{12.5, 6, 5}},
+	}
+	for _, v := range tests {
+		if bb := v.s.BoundingBox(); !bb.Equals(sdf.Box3{v.min, v.max}, 1e-6) {
+			t.Errorf("%s: expected box %v, actual %v", v.name, sdf.Box3{v.min, v.max}, bb)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
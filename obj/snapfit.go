@@ -0,0 +1,267 @@
+//-----------------------------------------------------------------------------
+/*
+
+Snap-Fits: Cantilever hooks and annular snap rings with their recesses.
+
+The undercut (the deflection while snapping) is limited by the strain the
+material allows (e.g. 0.02 to 0.03 for ABS, 0.04 for PP), see the snap-fit
+design guides of the resin makers (e.g. Bayer, "Snap-Fit Joints for
+Plastics"):
+
+Cantilever: y = K * strain * L^2 / t, where L is the beam length, t the
+root thickness and K = 0.67 for a constant section (1.09 for a beam
+tapered to half the thickness at the tip).
+
+Annular: y = strain * d, where d is the joint diameter (for a rigid mate).
+
+The entry and retention angles are the angles of the hook faces from the
+insertion direction. A 90 degree retention face makes a permanent joint.
+
+*/
+//-----------------------------------------------------------------------------
+
+package obj
+
+import (
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// snapRamp returns the length along the insertion direction of a face at an angle rising by y.
+func snapRamp(y, angle float64) float64 {
+	if angle >= 0.5*sdf.Pi {
+		return 0
+	}
+	return y / math.Tan(angle)
+}
+
+// snapAngles returns the entry and retention angles (defaults: 30 and 90 degrees).
+func snapAngles(entry, retention float64) (float64, float64, error) {
+	if entry == 0 {
+		entry = sdf.DtoR(30)
+	}
+	if retention == 0 {
+		retention = 0.5 * sdf.Pi
+	}
+	if entry < 0 || entry >= 0.5*sdf.Pi {
+		return 0, 0, sdf.ErrMsg("EntryAngle must be 0 to 90 degrees")
+	}
+	if retention < 0 || retention > 0.5*sdf.Pi {
+		return 0, 0, sdf.ErrMsg("RetentionAngle must be 0 to 90 degrees")
+	}
+	return entry, retention, nil
+}
+
+// snapForce returns the force to move a hook over a face at an angle, given the deflection force
+// (infinite for a self locking face).
+func snapForce(p, angle, friction float64) float64 {
+	t := math.Tan(angle)
+	if angle >= 0.5*sdf.Pi || friction*t >= 1 {
+		return math.Inf(1)
+	}
+	return p * (friction + t) / (1 - friction*t)
+}
+
+//-----------------------------------------------------------------------------
+// Cantilever Snap-Fit
+
+// CantileverSnapParms defines the parameters for a cantilever snap-fit hook.
+type CantileverSnapParms struct {
+	Length         float64 // beam length (root to the hook)
+	Thickness      float64 // beam thickness at the root
+	Width          float64 // beam width
+	Taper          float64 // tip/root thickness ratio, 0.5 to 1 (0: 1, a constant section)
+	Overhang       float64 // hook undercut (0: the largest for the strain)
+	Strain         float64 // allowable strain of the material (used if Overhang is 0)
+	EntryAngle     float64 // entry face angle from the insertion direction (radians, 0: 30 degrees)
+	RetentionAngle float64 // retention face angle from the insertion direction (radians, 0: 90 degrees)
+	Clearance      float64 // clearance of the recess around the hook
+}
+
+// cantileverK returns the deflection factor of a beam with a tip/root thickness ratio.
+func cantileverK(taper float64) float64 {
+	// 0.67 for a constant section, 1.09 for half the thickness at the tip
+	return 0.67 + 0.84*(1-taper)
+}
+
+// cantilever returns the validated parameters of a hook (with the defaults set).
+func (k *CantileverSnapParms) cantilever() (CantileverSnapParms, error) {
+	c := *k
+	if c.Length <= 0 {
+		return c, sdf.ErrMsg("Length <= 0")
+	}
+	if c.Thickness <= 0 {
+		return c, sdf.ErrMsg("Thickness <= 0")
+	}
+	if c.Width <= 0 {
+		return c, sdf.ErrMsg("Width <= 0")
+	}
+	if c.Taper == 0 {
+		c.Taper = 1
+	}
+	if c.Taper < 0.5 || c.Taper > 1 {
+		return c, sdf.ErrMsg("Taper must be 0.5 to 1")
+	}
+	if c.Overhang < 0 || c.Strain < 0 || c.Clearance < 0 {
+		return c, sdf.ErrMsg("Overhang, Strain or Clearance < 0")
+	}
+	if c.Overhang == 0 {
+		if c.Strain == 0 {
+			return c, sdf.ErrMsg("no Overhang or Strain")
+		}
+		c.Overhang = cantileverK(c.Taper) * c.Strain * c.Length * c.Length / c.Thickness
+	}
+	var err error
+	c.EntryAngle, c.RetentionAngle, err = snapAngles(c.EntryAngle, c.RetentionAngle)
+	return c, err
+}
+
+// CantileverSnapStrain returns the strain at the root of a hook deflected by its overhang.
+func CantileverSnapStrain(k *CantileverSnapParms) (float64, error) {
+	c, err := k.cantilever()
+	if err != nil {
+		return 0, err
+	}
+	return c.Overhang * c.Thickness / (cantileverK(c.Taper) * c.Length * c.Length), nil
+}
+
+// CantileverSnapForces returns the force deflecting a hook by its overhang, and the forces to
+// assemble and to separate the joint (infinite for a permanent joint), for a material modulus
+// and a coefficient of friction.
+func CantileverSnapForces(k *CantileverSnapParms, modulus, friction float64) (deflection, mating, separation float64, err error) {
+	c, err := k.cantilever()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	strain := c.Overhang * c.Thickness / (cantileverK(c.Taper) * c.Length * c.Length)
+	p := c.Width * c.Thickness * c.Thickness * modulus * strain / (6 * c.Length)
+	return p, snapForce(p, c.EntryAngle, friction), snapForce(p, c.RetentionAngle, friction), nil
+}
+
+// CantileverSnap3D returns a cantilever hook and the recess for its catch. The beam rises along
+// +z from its root on the xy plane, with its back face on x = 0 and the hook protruding
+// towards +x (centered on y). The recess is the hook head, with the clearance, in its
+// assembled position: subtract it from the mating part.
+func CantileverSnap3D(k *CantileverSnapParms) (hook, recess sdf.SDF3, err error) {
+	c, err := k.cantilever()
+	if err != nil {
+		return nil, nil, err
+	}
+	t0, t1, y := c.Thickness, c.Thickness*c.Taper, c.Overhang
+	z0 := c.Length
+	z1 := z0 + snapRamp(y, c.RetentionAngle)
+	z2 := z1 + snapRamp(y, c.EntryAngle)
+
+	// profile on the xz plane
+	p := sdf.NewPolygon()
+	p.Add(0, 0)
+	p.Add(t0, 0)
+	p.Add(t1, z0)
+	p.Add(t1+y, z1)
+	p.Add(t1, z2)
+	p.Add(0, z2)
+	s, err := sdf.Polygon2D(p.Vertices())
+	if err != nil {
+		return nil, nil, err
+	}
+	hook = sdf.Transform3D(sdf.Extrude3D(s, c.Width), sdf.RotateX(0.5*sdf.Pi))
+
+	// the catch window
+	size := sdf.V3{y + 2*c.Clearance, c.Width + 2*c.Clearance, z2 - z0 + 2*c.Clearance}
+	recess, err = sdf.Box3D(size, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	recess = sdf.Transform3D(recess, sdf.Translate3d(sdf.V3{t1 + 0.5*y, 0, 0.5 * (z0 + z2)}))
+	return hook, recess, nil
+}
+
+//-----------------------------------------------------------------------------
+// Annular Snap-Fit
+
+// AnnularSnapParms defines the parameters for an annular snap-fit.
+type AnnularSnapParms struct {
+	Diameter       float64 // shaft diameter at the joint
+	Overhang       float64 // radial height of the bead (0: the largest for the strain)
+	Strain         float64 // allowable strain of the material (used if Overhang is 0)
+	Land           float64 // axial length of the bead top
+	EntryAngle     float64 // entry face angle from the insertion direction (radians, 0: 30 degrees)
+	RetentionAngle float64 // retention face angle from the insertion direction (radians, 0: 90 degrees)
+	Clearance      float64 // clearance of the groove around the bead
+}
+
+// annular returns the validated parameters of an annular snap-fit (with the defaults set).
+func (k *AnnularSnapParms) annular() (AnnularSnapParms, error) {
+	a := *k
+	if a.Diameter <= 0 {
+		return a, sdf.ErrMsg("Diameter <= 0")
+	}
+	if a.Overhang < 0 || a.Strain < 0 || a.Land < 0 || a.Clearance < 0 {
+		return a, sdf.ErrMsg("Overhang, Strain, Land or Clearance < 0")
+	}
+	if a.Overhang == 0 {
+		if a.Strain == 0 {
+			return a, sdf.ErrMsg("no Overhang or Strain")
+		}
+		a.Overhang = a.Strain * a.Diameter
+	}
+	if a.Overhang >= 0.5*a.Diameter {
+		return a, sdf.ErrMsg("Overhang >= Diameter/2")
+	}
+	var err error
+	a.EntryAngle, a.RetentionAngle, err = snapAngles(a.EntryAngle, a.RetentionAngle)
+	return a, err
+}
+
+// AnnularSnapStrain returns the strain of an annular snap-fit (with a rigid mate).
+func AnnularSnapStrain(k *AnnularSnapParms) (float64, error) {
+	a, err := k.annular()
+	if err != nil {
+		return 0, err
+	}
+	return a.Overhang / a.Diameter, nil
+}
+
+// AnnularSnap3D returns the bead of an annular snap-fit (to add to a shaft of the diameter) and
+// its groove (to subtract from the bore of the hub). The axis is z, the entry face of the bead
+// faces -z (the insertion direction is +z) and the bead starts at z = 0.
+func AnnularSnap3D(k *AnnularSnapParms) (bead, groove sdf.SDF3, err error) {
+	a, err := k.annular()
+	if err != nil {
+		return nil, nil, err
+	}
+	r, y := 0.5*a.Diameter, a.Overhang
+	z1 := snapRamp(y, a.EntryAngle)
+	z2 := z1 + a.Land
+	z3 := z2 + snapRamp(y, a.RetentionAngle)
+
+	// profile on the rz plane, overlapping the shaft
+	p := sdf.NewPolygon()
+	p.Add(r-y, 0)
+	p.Add(r, 0)
+	p.Add(r+y, z1)
+	p.Add(r+y, z2)
+	p.Add(r, z3)
+	p.Add(r-y, z3)
+	s, err := sdf.Polygon2D(p.Vertices())
+	if err != nil {
+		return nil, nil, err
+	}
+	bead, err = sdf.Revolve3D(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if a.Clearance == 0 {
+		return bead, bead, nil
+	}
+	groove, err = sdf.Revolve3D(sdf.Offset2D(s, a.Clearance))
+	if err != nil {
+		return nil, nil, err
+	}
+	return bead, groove, nil
+}
+
+//-----------------------------------------------------------------------------
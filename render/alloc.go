@@ -0,0 +1,153 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triangle Allocation
+
+Big renders produce millions of triangles. Allocating each one on the heap
+is a lot of work for the garbage collector, so renderers allocate them in
+blocks from an arena. Triangles can also be passed as value batches (reused
+via a sync.Pool) rather than one pointer per channel send. Renderers with a
+batch path (see BatchRender3) fill the batches directly, reusing their arena
+blocks, so there is no allocation or channel send per triangle.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// triangleArenaBlock is the number of triangles in an arena block.
+const triangleArenaBlock = 1024
+
+// TriangleArena allocates triangles in blocks. A block is freed by the garbage collector
+// when none of its triangles are referenced. An arena is not safe for concurrent use.
+type TriangleArena struct {
+	all   []Triangle3 // the current block
+	block []Triangle3 // unused triangles of the current block
+}
+
+// New returns a new triangle from the arena (from the heap for a nil arena).
+func (a *TriangleArena) New(v0, v1, v2 sdf.V3) *Triangle3 {
+	if a == nil {
+		return NewTriangle3(v0, v1, v2)
+	}
+	if len(a.block) == 0 {
+		a.all = make([]Triangle3, triangleArenaBlock)
+		a.block = a.all
+	}
+	t := &a.block[0]
+	a.block = a.block[1:]
+	t.V[0], t.V[1], t.V[2] = v0, v1, v2
+	return t
+}
+
+// reset reuses the current block, overwriting the triangles allocated from it.
+func (a *TriangleArena) reset() {
+	a.block = a.all
+}
+
+//-----------------------------------------------------------------------------
+
+// triangleBatchSize is the capacity of a triangle batch.
+const triangleBatchSize = 1024
+
+var trianglePool = sync.Pool{
+	New: func() interface{} {
+		b := make([]Triangle3, 0, triangleBatchSize)
+		return &b
+	},
+}
+
+// newBatch returns an empty triangle batch from the pool.
+func newBatch() []Triangle3 {
+	return (*trianglePool.Get().(*[]Triangle3))[:0]
+}
+
+// ReleaseBatch returns a triangle batch to the pool for reuse.
+// The batch must not be used after it is released.
+func ReleaseBatch(b []Triangle3) {
+	b = b[:0]
+	trianglePool.Put(&b)
+}
+
+// TriangleBatcher collects triangles into value batches sent to an output.
+type TriangleBatcher struct {
+	output chan<- []Triangle3
+	b      []Triangle3
+}
+
+// NewTriangleBatcher returns a triangle batcher sending full batches to the output.
+func NewTriangleBatcher(output chan<- []Triangle3) *TriangleBatcher {
+	return &TriangleBatcher{output: output, b: newBatch()}
+}
+
+// Add adds a triangle to the current batch, sending the batch when it is full.
+func (w *TriangleBatcher) Add(v0, v1, v2 sdf.V3) {
+	w.b = append(w.b, Triangle3{V: [3]sdf.V3{v0, v1, v2}})
+	if len(w.b) == cap(w.b) {
+		w.output <- w.b
+		w.b = newBatch()
+	}
+}
+
+// Flush sends the current batch (if not empty).
+func (w *TriangleBatcher) Flush() {
+	if len(w.b) == 0 {
+		return
+	}
+	w.output <- w.b
+	w.b = newBatch()
+}
+
+// BatchRender3 is implemented by renderers that fill value batches of triangles directly
+// (see RenderBatches). The batches are sent to the output, and it returns ctx.Err() if the
+// context is done before the render is complete.
+type BatchRender3 interface {
+	RenderBatches(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- []Triangle3) error
+}
+
+// RenderBatches renders an SDF3, sending the triangles to the output as value batches.
+// Renderers without a batch path (see BatchRender3) send their triangles through a
+// channel to be copied into the batches. Release each batch with ReleaseBatch when done with it.
+func RenderBatches(
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+	output chan<- []Triangle3, // triangle batches
+) {
+	if br, ok := r.(BatchRender3); ok {
+		br.RenderBatches(context.Background(), s, meshCells, output)
+		return
+	}
+	input := make(chan *Triangle3, 64)
+	done := make(chan struct{})
+	go func() {
+		b := newBatch()
+		for t := range input {
+			b = append(b, *t)
+			if len(b) == cap(b) {
+				output <- b
+				b = newBatch()
+			}
+		}
+		if len(b) != 0 {
+			output <- b
+		} else {
+			ReleaseBatch(b)
+		}
+		close(done)
+	}()
+	r.Render(s, meshCells, input)
+	close(input)
+	<-done
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,164 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triangle Allocation Benchmarks
+
+go test -run xxx -bench . ./render
+
+*/
+//-----------------------------------------------------------------------------
+
+package render_test
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/render/dc"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// gcMetrics reports the garbage collection time per operation.
+func gcMetrics(b *testing.B, f func()) {
+	var m0, m1 runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f()
+	}
+	b.StopTimer()
+	runtime.ReadMemStats(&m1)
+	b.ReportMetric(float64(m1.PauseTotalNs-m0.PauseTotalNs)/float64(b.N), "gc-ns/op")
+	b.ReportMetric(float64(m1.NumGC-m0.NumGC)/float64(b.N), "gcs/op")
+}
+
+var sink []*render.Triangle3
+
+const benchTriangles = 1 << 16
+
+func BenchmarkTriangleHeap(b *testing.B) {
+	gcMetrics(b, func() {
+		sink = sink[:0]
+		for i := 0; i < benchTriangles; i++ {
+			sink = append(sink, render.NewTriangle3(sdf.V3{}, sdf.V3{X: 1}, sdf.V3{Y: 1}))
+		}
+	})
+}
+
+func BenchmarkTriangleArena(b *testing.B) {
+	gcMetrics(b, func() {
+		var a render.TriangleArena
+		sink = sink[:0]
+		for i := 0; i < benchTriangles; i++ {
+			sink = append(sink, a.New(sdf.V3{}, sdf.V3{X: 1}, sdf.V3{Y: 1}))
+		}
+	})
+}
+
+func benchModel() sdf.SDF3 {
+	s, _ := sdf.Sphere3D(10)
+	c, _ := sdf.Cylinder3D(30, 4, 1)
+	return sdf.Difference3D(s, c)
+}
+
+func benchRender(b *testing.B, r render.Render3, cells int) {
+	s := benchModel()
+	gcMetrics(b, func() {
+		render.ToTriangles(s, cells, r)
+	})
+}
+
+func BenchmarkMarchingCubesUniform(b *testing.B) {
+	benchRender(b, &render.MarchingCubesUniform{}, 100)
+}
+
+func BenchmarkDualContouringV2(b *testing.B) {
+	benchRender(b, dc.NewDualContouringDefault(), 50)
+}
+
+// renderBatches returns the triangles of a batch render.
+func renderBatches(s sdf.SDF3, meshCells int, r render.Render3, keep bool) []render.Triangle3 {
+	var tris []render.Triangle3
+	output := make(chan []render.Triangle3)
+	go func() {
+		render.RenderBatches(s, meshCells, r, output)
+		close(output)
+	}()
+	for batch := range output {
+		if keep {
+			tris = append(tris, batch...)
+		}
+		render.ReleaseBatch(batch)
+	}
+	return tris
+}
+
+// ptrDC is the dual contouring renderer without its batch path.
+type ptrDC struct {
+	r *dc.DualContouringV2
+}
+
+func (p ptrDC) Render(s sdf.SDF3, meshCells int, output chan<- *render.Triangle3) {
+	p.r.Render(s, meshCells, output)
+}
+
+func (p ptrDC) Info(s sdf.SDF3, meshCells int) string {
+	return p.r.Info(s, meshCells)
+}
+
+// BenchmarkRenderBatches compares the batch path of the renderers with sending triangle
+// pointers through a channel.
+func BenchmarkRenderBatches(b *testing.B) {
+	s := benchModel()
+	benchmarks := []struct {
+		name  string
+		r     render.Render3
+		cells int
+	}{
+		{"uniform/batch", &render.MarchingCubesUniform{}, 100},
+		{"uniform/pointer", &plainRender{}, 100},
+		{"dc/batch", dc.NewDualContouringDefault(), 50},
+		{"dc/pointer", ptrDC{dc.NewDualContouringDefault()}, 50},
+	}
+	for _, v := range benchmarks {
+		b.Run(v.name, func(b *testing.B) {
+			gcMetrics(b, func() {
+				renderBatches(s, v.cells, v.r, false)
+			})
+		})
+	}
+}
+
+func Test_RenderBatches(t *testing.T) {
+	s := benchModel()
+	tests := []struct {
+		name   string
+		r, ptr render.Render3
+	}{
+		{"uniform", &render.MarchingCubesUniform{}, &plainRender{}},
+		{"dc", dc.NewDualContouringDefault(), ptrDC{dc.NewDualContouringDefault()}},
+	}
+	for _, v := range tests {
+		// the batch path renders the triangles of the pointer path
+		seen := make(map[render.Triangle3]int)
+		for _, t := range render.ToTriangles(s, 30, v.ptr) {
+			seen[*t]++
+		}
+		tris := renderBatches(s, 30, v.r, true)
+		if len(tris) == 0 || len(tris) != len(renderBatches(s, 30, v.ptr, true)) {
+			t.Errorf("%s: expected %d triangles, actual %d", v.name, len(seen), len(tris))
+		}
+		for _, x := range tris {
+			if seen[x]--; seen[x] < 0 {
+				t.Fatalf("%s: unexpected triangle %v", v.name, x)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,209 @@
+//-----------------------------------------------------------------------------
+/*
+
+AMF Save
+
+Additive Manufacturing File Format (ISO/ASTM 52915): an XML file (or a zip
+archive of it) with materials, objects and metadata. An object is a mesh
+made of volumes, each a closed region of one material, so multi-material
+parts are written as an object with a volume per material (e.g. the meshes
+of the material regions of a model). Vertex colors are written with the
+vertices. See https://www.astm.org/f2915-20.html
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// AMFMaterial is a material of an AMF file.
+type AMFMaterial struct {
+	Name     string
+	Color    color.RGBA        // display color (zero: none)
+	Metadata map[string]string // material metadata (e.g. "manufacturer")
+}
+
+// AMFVolume is a material region of an AMF object.
+type AMFVolume struct {
+	Mesh     *Mesh // closed mesh of the region (with its vertex colors)
+	Material int   // index of the material (< 0: no material)
+}
+
+// AMFObject is an object of an AMF file.
+type AMFObject struct {
+	Name    string // object name (optional)
+	Volumes []AMFVolume
+	Offset  sdf.V3 // position of the object (in a constellation of the objects)
+}
+
+// AMFConfig sets the units, metadata and materials of an AMF file.
+type AMFConfig struct {
+	Unit      string            // "millimeter", "inch", "feet", "meter" or "micron" ("": millimeter)
+	Metadata  map[string]string // file metadata (e.g. "name", "author", "cad")
+	Materials []AMFMaterial
+	Compress  bool // write a zip archive (the extension is usually still .amf)
+}
+
+// amfUnits are the units of an AMF file.
+var amfUnits = map[string]bool{"millimeter": true, "inch": true, "feet": true, "meter": true, "micron": true}
+
+//-----------------------------------------------------------------------------
+
+// SaveAMF writes an indexed mesh (with its vertex colors) to an AMF file.
+// Units are millimeters.
+func SaveAMF(path string, m *Mesh) error {
+	return SaveAMFObjects(path, []AMFObject{{Volumes: []AMFVolume{{m, -1}}}}, nil)
+}
+
+// SaveAMFObjects writes objects (with their material volumes) to an AMF file.
+func SaveAMFObjects(path string, objects []AMFObject, cfg *AMFConfig) error {
+	if cfg == nil {
+		cfg = &AMFConfig{}
+	}
+	unit := cfg.Unit
+	if unit == "" {
+		unit = "millimeter"
+	}
+	if !amfUnits[unit] {
+		return sdf.ErrMsg(fmt.Sprintf("unknown unit \"%s\"", unit))
+	}
+	for _, o := range objects {
+		for _, v := range o.Volumes {
+			if v.Material >= len(cfg.Materials) {
+				return sdf.ErrMsg(fmt.Sprintf("no material %d", v.Material))
+			}
+		}
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var w io.Writer = file
+	var z *zip.Writer
+	if cfg.Compress {
+		z = zip.NewWriter(file)
+		if w, err = z.Create(filepath.Base(path)); err != nil {
+			return err
+		}
+	}
+	buf := bufio.NewWriter(w)
+	writeAMF(buf, objects, unit, cfg)
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if z != nil {
+		return z.Close()
+	}
+	return nil
+}
+
+// amfEscape returns a text escaped for XML.
+func amfEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeAMFMetadata writes metadata elements (in key order).
+func writeAMFMetadata(w *bufio.Writer, metadata map[string]string) {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "<metadata type=\"%s\">%s</metadata>\n", amfEscape(k), amfEscape(metadata[k]))
+	}
+}
+
+// writeAMFColor writes a color element.
+func writeAMFColor(w *bufio.Writer, c color.RGBA) {
+	fmt.Fprintf(w, "<color><r>%.4g</r><g>%.4g</g><b>%.4g</b><a>%.4g</a></color>\n",
+		float64(c.R)/255, float64(c.G)/255, float64(c.B)/255, float64(c.A)/255)
+}
+
+// writeAMF writes the AMF XML of the objects. The materials are numbered from 1 (0 is reserved).
+func writeAMF(w *bufio.Writer, objects []AMFObject, unit string, cfg *AMFConfig) {
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<amf unit=\"%s\" version=\"1.1\">\n", unit)
+	writeAMFMetadata(w, cfg.Metadata)
+	for i, mat := range cfg.Materials {
+		fmt.Fprintf(w, "<material id=\"%d\">\n", i+1)
+		if mat.Name != "" {
+			fmt.Fprintf(w, "<metadata type=\"name\">%s</metadata>\n", amfEscape(mat.Name))
+		}
+		writeAMFMetadata(w, mat.Metadata)
+		if mat.Color != (color.RGBA{}) {
+			writeAMFColor(w, mat.Color)
+		}
+		fmt.Fprintf(w, "</material>\n")
+	}
+	for i, o := range objects {
+		fmt.Fprintf(w, "<object id=\"%d\">\n", i)
+		if o.Name != "" {
+			fmt.Fprintf(w, "<metadata type=\"name\">%s</metadata>\n", amfEscape(o.Name))
+		}
+		// the volumes share the vertex list of the object
+		fmt.Fprintf(w, "<mesh>\n<vertices>\n")
+		for _, v := range o.Volumes {
+			m := v.Mesh
+			for j, p := range m.Vertices {
+				fmt.Fprintf(w, "<vertex><coordinates><x>%g</x><y>%g</y><z>%g</z></coordinates>",
+					float32(p.X), float32(p.Y), float32(p.Z))
+				if m.Colors != nil {
+					w.WriteString("\n")
+					writeAMFColor(w, m.Colors[j])
+				}
+				fmt.Fprintf(w, "</vertex>\n")
+			}
+		}
+		fmt.Fprintf(w, "</vertices>\n")
+		base := 0
+		for _, v := range o.Volumes {
+			if v.Material >= 0 {
+				fmt.Fprintf(w, "<volume materialid=\"%d\">\n", v.Material+1)
+			} else {
+				fmt.Fprintf(w, "<volume>\n")
+			}
+			for _, f := range v.Mesh.Faces {
+				fmt.Fprintf(w, "<triangle><v1>%d</v1><v2>%d</v2><v3>%d</v3></triangle>\n", f[0]+base, f[1]+base, f[2]+base)
+			}
+			fmt.Fprintf(w, "</volume>\n")
+			base += len(v.Mesh.Vertices)
+		}
+		fmt.Fprintf(w, "</mesh>\n</object>\n")
+	}
+	// place the objects with offsets
+	placed := false
+	for _, o := range objects {
+		placed = placed || o.Offset != (sdf.V3{})
+	}
+	if placed {
+		fmt.Fprintf(w, "<constellation id=\"%d\">\n", len(objects))
+		for i, o := range objects {
+			fmt.Fprintf(w, "<instance objectid=\"%d\"><deltax>%g</deltax><deltay>%g</deltay><deltaz>%g</deltaz></instance>\n",
+				i, float32(o.Offset.X), float32(o.Offset.Y), float32(o.Offset.Z))
+		}
+		fmt.Fprintf(w, "</constellation>\n")
+	}
+	fmt.Fprintf(w, "</amf>\n")
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,213 @@
+//-----------------------------------------------------------------------------
+/*
+
+Renderer Auto-Selection
+
+Auto probes a model (feature size, sharp edges) and picks a renderer and
+mesh resolution for a quality level. Renderers are registered as
+candidates; marching cubes is built in, other packages (e.g. render/dc)
+register their renderers when imported.
+
+CompareRenderers is a harness for comparing renderers on a model by
+triangle count, render time and surface error.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// AutoCandidate is a renderer that can be selected by Auto.
+type AutoCandidate struct {
+	Name  string                                  // renderer name
+	Sharp bool                                    // the renderer reproduces sharp features
+	New   func(s sdf.SDF3, meshCells int) Render3 // returns a renderer for the model
+}
+
+var autoCandidates = struct {
+	sync.Mutex
+	c []AutoCandidate
+}{
+	c: []AutoCandidate{
+		{"MarchingCubesOctree", false, func(s sdf.SDF3, meshCells int) Render3 { return &MarchingCubesOctree{} }},
+	},
+}
+
+// RegisterAutoCandidate adds a renderer to the candidates for Auto (and registers it by name, see RegisterRenderer).
+// Candidates registered later are preferred.
+func RegisterAutoCandidate(c AutoCandidate) {
+	RegisterRenderer(c.Name, c.New)
+	autoCandidates.Lock()
+	defer autoCandidates.Unlock()
+	autoCandidates.c = append(autoCandidates.c, c)
+}
+
+// AutoCandidates returns the renderers that can be selected by Auto.
+func AutoCandidates() []AutoCandidate {
+	autoCandidates.Lock()
+	defer autoCandidates.Unlock()
+	return append([]AutoCandidate(nil), autoCandidates.c...)
+}
+
+//-----------------------------------------------------------------------------
+
+// sharpEdgeAngle is the normal change (radians) between neighbouring surface samples taken as a sharp edge.
+const sharpEdgeAngle = 40 * sdf.Pi / 180
+
+// sharpFraction returns the fraction of surface samples next to a sharp edge,
+// sampling the model on an n x n x n grid.
+func sharpFraction(s sdf.SDF3, n int) float64 {
+	bb := s.BoundingBox()
+	step := bb.Size().MaxComponent() / float64(n)
+	steps := bb.Size().DivScalar(step).Ceil().ToV3i().AddScalar(1)
+	h := step * 1e-3
+	// surface normals at the grid points near the surface (0: not near)
+	normals := make([]sdf.V3, steps[0]*steps[1]*steps[2])
+	idx := func(x, y, z int) int { return (x*steps[1]+y)*steps[2] + z }
+	for x := 0; x < steps[0]; x++ {
+		for y := 0; y < steps[1]; y++ {
+			for z := 0; z < steps[2]; z++ {
+				p := bb.Min.Add(sdf.V3{float64(x), float64(y), float64(z)}.MulScalar(step))
+				d := s.Evaluate(p)
+				if math.Abs(d) > step {
+					continue
+				}
+				// project onto the surface
+				g := sdf.Gradient3(s, p, h)
+				q := p.Sub(g.MulScalar(d))
+				normals[idx(x, y, z)] = sdf.Gradient3(s, q, h)
+			}
+		}
+	}
+	cosLimit := math.Cos(sharpEdgeAngle)
+	var surface, sharp int
+	for x := 0; x < steps[0]; x++ {
+		for y := 0; y < steps[1]; y++ {
+			for z := 0; z < steps[2]; z++ {
+				n0 := normals[idx(x, y, z)]
+				if n0 == (sdf.V3{}) {
+					continue
+				}
+				surface++
+				for _, o := range []sdf.V3i{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}} {
+					x1, y1, z1 := x+o[0], y+o[1], z+o[2]
+					if x1 >= steps[0] || y1 >= steps[1] || z1 >= steps[2] {
+						continue
+					}
+					n1 := normals[idx(x1, y1, z1)]
+					if n1 != (sdf.V3{}) && n0.Dot(n1) < cosLimit {
+						sharp++
+						break
+					}
+				}
+			}
+		}
+	}
+	if surface == 0 {
+		return 0
+	}
+	return float64(sharp) / float64(surface)
+}
+
+// AutoChoice is the renderer and resolution selected by Auto.
+type AutoChoice struct {
+	Name      string  // candidate name
+	Renderer  Render3 // selected renderer
+	MeshCells int     // mesh cells on the longest axis of the bounding box
+	Sharp     bool    // the model has sharp features
+}
+
+// Auto selects a renderer and mesh resolution for a model. Quality is from 0 (fast, coarse)
+// to 1 (slow, fine), and sets the limit on mesh cells (64 to 512, with at least a quarter of
+// the limit) and the cells across the thinnest feature (2 to 6). Models with sharp edges use a renderer that reproduces them, if one is registered.
+func Auto(s sdf.SDF3, quality float64) (*AutoChoice, error) {
+	quality = sdf.Clamp(quality, 0, 1)
+	maxCells := int(64 + quality*(512-64))
+	meshCells, err := FeatureMeshCells(s, 2+4*quality, maxCells)
+	if err != nil {
+		return nil, err
+	}
+	if meshCells < maxCells/4 {
+		meshCells = maxCells / 4
+	}
+	sharp := sharpFraction(s, 32) > 0.01
+	candidates := AutoCandidates()
+	for i := len(candidates) - 1; i >= 0; i-- {
+		c := candidates[i]
+		if c.Sharp == sharp || (i == 0 && !c.Sharp) {
+			return &AutoChoice{c.Name, c.New(s, meshCells), meshCells, sharp}, nil
+		}
+	}
+	return nil, sdf.ErrMsg("no renderer candidates")
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderStats are the results of rendering a model with a renderer.
+type RenderStats struct {
+	Name      string        // renderer name
+	Triangles int           // number of triangles
+	Time      time.Duration // render time
+	MaxError  float64       // maximum distance from the surface (one-sided Hausdorff estimate)
+	RMSError  float64       // RMS distance from the surface
+}
+
+// MeshError returns the maximum and RMS distance from the surface of an SDF3 to a mesh,
+// sampled at the vertices and centroids of the triangles.
+func MeshError(s sdf.SDF3, mesh []*Triangle3) (max, rms float64) {
+	if len(mesh) == 0 {
+		return 0, 0
+	}
+	var sum float64
+	add := func(p sdf.V3) {
+		d := math.Abs(s.Evaluate(p))
+		max = math.Max(max, d)
+		sum += d * d
+	}
+	for _, t := range mesh {
+		add(t.V[0])
+		add(t.V[1])
+		add(t.V[2])
+		add(t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3))
+	}
+	return max, math.Sqrt(sum / float64(4*len(mesh)))
+}
+
+// CompareRenderers renders a model with each renderer, returning the statistics in name order.
+func CompareRenderers(s sdf.SDF3, meshCells int, renderers map[string]Render3) []RenderStats {
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats := make([]RenderStats, len(names))
+	for i, name := range names {
+		t0 := time.Now()
+		mesh := ToTriangles(s, meshCells, renderers[name])
+		dt := time.Since(t0)
+		max, rms := MeshError(s, mesh)
+		stats[i] = RenderStats{name, len(mesh), dt, max, rms}
+	}
+	return stats
+}
+
+// CompareCandidates compares the renderers that can be selected by Auto.
+func CompareCandidates(s sdf.SDF3, meshCells int) []RenderStats {
+	renderers := make(map[string]Render3)
+	for _, c := range AutoCandidates() {
+		renderers[c.Name] = c.New(s, meshCells)
+	}
+	return CompareRenderers(s, meshCells, renderers)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,187 @@
+//-----------------------------------------------------------------------------
+/*
+
+Attribute Baking
+
+Sample the SDF at the vertices of a mesh after meshing and store the
+results as per-vertex attributes and colors, for shaded previews without
+an external tool:
+
+Ambient occlusion: sample the field along the normal, the surface is
+occluded where the field is less than the distance from the surface
+(see https://iquilezles.org/articles/nvscene2008/rwwtt.pdf).
+
+Curvature: the mean curvature of the level set is half the laplacian of a
+distance field.
+
+Thickness: the wall thickness and the air gap width across the surface
+(see sdf.ProbeThickness), for finding thin walls and narrow gaps.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Attribute names set by Bake.
+const (
+	AttributeOcclusion = "ao"        // ambient occlusion, 0 (open) to 1 (occluded)
+	AttributeCurvature = "curvature" // mean curvature (1/radius, > 0 is convex)
+	AttributeWall      = "wall"      // wall thickness
+	AttributeGap       = "gap"       // air gap width
+)
+
+// BakeConfig are the parameters for baking mesh attributes.
+type BakeConfig struct {
+	Occlusion bool    // bake ambient occlusion
+	Curvature bool    // bake the mean curvature
+	Distance  float64 // ambient occlusion distance (0: 5% of the model size)
+	Samples   int     // ambient occlusion samples along the normal (0: 5)
+	Thickness bool    // bake the wall thickness and the gap width
+	ProbeDist float64 // maximum thickness and gap (0: the model size), the value where none is found
+	Color     string  // attribute used for the vertex colors ("": no colors)
+}
+
+// bakeChunkSize is the number of vertices baked by a task.
+const bakeChunkSize = 1 << 12
+
+// Bake samples an SDF3 at the vertices of a mesh and stores the results as attributes.
+// If a color attribute is set, its values are mapped to grayscale vertex colors.
+func Bake(s sdf.SDF3, m *Mesh, cfg *BakeConfig) error {
+	k := *cfg
+	size := s.BoundingBox().Size().MaxComponent()
+	if k.Distance == 0 {
+		k.Distance = 0.05 * size
+	}
+	if k.Samples == 0 {
+		k.Samples = 5
+	}
+	if k.ProbeDist == 0 {
+		k.ProbeDist = size
+	}
+	if k.Distance < 0 || k.Samples < 0 || k.ProbeDist < 0 {
+		return sdf.ErrMsg("bad bake parameters")
+	}
+	tol := sdf.ModelTolerances3(s)
+	n := len(m.Vertices)
+	var ao, curvature, wall, gap []float64
+	if k.Occlusion {
+		ao = make([]float64, n)
+	}
+	if k.Curvature {
+		curvature = make([]float64, n)
+	}
+	if k.Thickness {
+		wall, gap = make([]float64, n), make([]float64, n)
+	}
+	g := DefaultPool().Group()
+	for i := 0; i < n; i += bakeChunkSize {
+		i0, i1 := i, i+bakeChunkSize
+		if i1 > n {
+			i1 = n
+		}
+		g.Go(func() {
+			for j := i0; j < i1; j++ {
+				p := m.Vertices[j]
+				if ao != nil {
+					ao[j] = occlusion(s, p, tol.Normal3(s, p), k.Distance, k.Samples)
+				}
+				if curvature != nil {
+					curvature[j] = meanCurvature(s, p, 10*tol.Normal)
+				}
+				if wall != nil {
+					pr := sdf.ProbeThickness(s, p, k.ProbeDist)
+					wall[j], gap[j] = math.Min(pr.Wall, k.ProbeDist), math.Min(pr.Gap, k.ProbeDist)
+				}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if ao != nil {
+		m.SetAttribute(AttributeOcclusion, ao)
+	}
+	if curvature != nil {
+		m.SetAttribute(AttributeCurvature, curvature)
+	}
+	if wall != nil {
+		m.SetAttribute(AttributeWall, wall)
+		m.SetAttribute(AttributeGap, gap)
+	}
+	if k.Color != "" {
+		values, ok := m.Attributes[k.Color]
+		if !ok {
+			return sdf.ErrMsg("no attribute " + k.Color)
+		}
+		m.Colors = AttributeColors(values, k.Color == AttributeOcclusion)
+	}
+	return nil
+}
+
+// occlusion returns the ambient occlusion at a surface point with normal n.
+func occlusion(s sdf.SDF3, p, n sdf.V3, distance float64, samples int) float64 {
+	var occ, weight float64
+	w := 1.0
+	for i := 1; i <= samples; i++ {
+		h := distance * float64(i) / float64(samples)
+		d := s.Evaluate(p.Add(n.MulScalar(h)))
+		occ += w * (h - sdf.Clamp(d, 0, h)) / h
+		weight += w
+		w /= 2
+	}
+	return occ / weight
+}
+
+// meanCurvature returns the mean curvature of the level set of an SDF3 at a point.
+func meanCurvature(s sdf.SDF3, p sdf.V3, h float64) float64 {
+	d0 := 6 * s.Evaluate(p)
+	var sum float64
+	for _, u := range []sdf.V3{{h, 0, 0}, {0, h, 0}, {0, 0, h}} {
+		sum += s.Evaluate(p.Add(u)) + s.Evaluate(p.Sub(u))
+	}
+	return (sum - d0) / (2 * h * h)
+}
+
+// AttributeColors maps attribute values to grayscale colors, from black (lowest value)
+// to white (highest), or the reverse if invert is set.
+// Values beyond 2.5 standard deviations of the mean are clamped, so outliers
+// (e.g. the curvature at sharp edges) don't wash out the colors.
+func AttributeColors(values []float64, invert bool) []color.RGBA {
+	var sum, sum2 float64
+	for _, v := range values {
+		sum += v
+		sum2 += v * v
+	}
+	n := float64(len(values))
+	mean := sum / n
+	dev := math.Sqrt(math.Max(sum2/n-mean*mean, 0))
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		v = sdf.Clamp(v, mean-2.5*dev, mean+2.5*dev)
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	colors := make([]color.RGBA, len(values))
+	for i, v := range values {
+		x := 0.5
+		if hi > lo {
+			x = (sdf.Clamp(v, lo, hi) - lo) / (hi - lo)
+		}
+		if invert {
+			x = 1 - x
+		}
+		c := uint8(math.Round(255 * x))
+		colors[i] = color.RGBA{c, c, c, 255}
+	}
+	return colors
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,196 @@
+//-----------------------------------------------------------------------------
+/*
+
+Batch Rendering
+
+Render many variants of one base model that differ only within a small
+region, e.g. parts engraved with serial numbers or dates. The base model
+is sampled once on the lattice of a uniform marching cubes render and the
+samples are shared by all the variants, which are only evaluated within
+their regions. Outside a region a variant has the sign of the base model
+and the same value near the surface, so the mesh is the same as a full
+render of the variant.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+	"github.com/golang/freetype/truetype"
+)
+
+//-----------------------------------------------------------------------------
+
+// BatchInstance is a variant of a base model.
+type BatchInstance struct {
+	Name   string   // instance name (e.g. for 3MF objects)
+	SDF    sdf.SDF3 // the variant model
+	Region sdf.Box3 // the volume where the variant differs from the base model
+}
+
+// RenderBatch renders variants of a base model using uniform marching cubes, with
+// meshCells on the longest axis of the base model (and regions) bounding box.
+// It returns ctx.Err() if the context is done before the render is complete.
+func RenderBatch(ctx context.Context, base sdf.SDF3, meshCells int, instances []BatchInstance) ([]*Mesh, error) {
+	bb := base.BoundingBox()
+	for _, in := range instances {
+		bb = bb.Extend(in.Region)
+	}
+	min, inc, steps := boxLattice(bb, meshCells)
+	xs := mcLattice(min.X, inc.X, 0, steps[0])
+	ys := mcLattice(min.Y, inc.Y, 0, steps[1])
+	zs := mcLattice(min.Z, inc.Z, 0, steps[2])
+	eps := modelTolerances(base, nil).Vertex
+	progress := StartProgress(ctx, int64(len(instances))*int64(steps[0])*int64(steps[1])*int64(steps[2]))
+
+	// sample the base model
+	n := len(ys) * len(zs)
+	field := make([]float64, len(xs)*n)
+	for x := range xs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := mcEvaluateLayer(base, xs[x], ys, zs, field[x*n:(x+1)*n]); err != nil {
+			return nil, err
+		}
+	}
+
+	// the lattice index range of a region (with a margin for the surface crossings)
+	margin := inc.Length()
+	span := func(v []float64, min, max float64) (int, int) {
+		i0 := 0
+		for i0 < len(v) && v[i0] < min-margin {
+			i0++
+		}
+		i1 := i0
+		for i1 < len(v) && v[i1] <= max+margin {
+			i1++
+		}
+		return i0, i1
+	}
+
+	meshes := make([]*Mesh, len(instances))
+	errs := make([]error, len(instances))
+	p := NewPool(0)
+	defer p.Close()
+	g := p.Group()
+	for i := range instances {
+		i := i
+		g.Go(func() {
+			in := &instances[i]
+			x0, x1 := span(xs, in.Region.Min.X, in.Region.Max.X)
+			y0, y1 := span(ys, in.Region.Min.Y, in.Region.Max.Y)
+			z0, z1 := span(zs, in.Region.Min.Z, in.Region.Max.Z)
+			sample := func(x int, xs, ys, zs []float64, out []float64) error {
+				copy(out, field[x*n:(x+1)*n])
+				if x < x0 || x >= x1 {
+					return nil
+				}
+				if y0 >= y1 || z0 >= z1 {
+					return nil
+				}
+				// the region of each row
+				p := make([]sdf.V3, z1-z0)
+				for y := y0; y < y1; y++ {
+					for z := z0; z < z1; z++ {
+						p[z-z0] = sdf.V3{xs[x], ys[y], zs[z]}
+					}
+					sdf.EvaluateN(in.SDF, p, out[y*len(zs)+z0:y*len(zs)+z1])
+				}
+				return nil
+			}
+			var triangles []*Triangle3
+			emit := func(t []*Triangle3) {
+				triangles = append(triangles, t...)
+			}
+			errs[i] = marchingCubesSlabs(ctx, in.SDF, &mcSlabs{base: min, inc: inc, steps: steps, eps: eps, emit: emit, sample: sample})
+			meshes[i] = NewMesh(triangles)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	progress.Done()
+	return meshes, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// TextMark is the placement of text on the surface of a model.
+type TextMark struct {
+	Font   *truetype.Font
+	Height float64 // text height
+	Origin sdf.V3  // center of the text, on the surface
+	Normal sdf.V3  // outward surface normal at the origin
+	Up     sdf.V3  // up direction of the text
+	Depth  float64 // engraving depth or embossed height
+	Emboss bool    // raise the text from the surface instead of engraving it
+}
+
+// TextInstances returns variants of a base model with each of the texts (e.g. serial numbers)
+// engraved into or embossed onto its surface.
+func TextInstances(base sdf.SDF3, m *TextMark, texts []string) ([]BatchInstance, error) {
+	if m.Font == nil {
+		return nil, sdf.ErrMsg("no font")
+	}
+	instances := make([]BatchInstance, len(texts))
+	for i, text := range texts {
+		t, err := sdf.TextSDF2(m.Font, sdf.NewText(text), m.Height)
+		if err != nil {
+			return nil, err
+		}
+		var s sdf.SDF3
+		if m.Emboss {
+			s, err = sdf.Emboss3D(base, t, m.Origin, m.Normal, m.Up, m.Depth)
+		} else {
+			s, err = sdf.Engrave3D(base, t, m.Origin, m.Normal, m.Up, m.Depth)
+		}
+		if err != nil {
+			return nil, err
+		}
+		instances[i] = BatchInstance{text, s, s.(*sdf.MarkSDF3).Region()}
+	}
+	return instances, nil
+}
+
+// SaveBatch3MF writes the meshes of a batch as the parts of a 3MF file, laid out on a
+// square grid with a gap between the parts.
+func SaveBatch3MF(path string, instances []BatchInstance, meshes []*Mesh, gap float64) error {
+	if len(instances) != len(meshes) {
+		return sdf.ErrMsg("len(instances) != len(meshes)")
+	}
+	columns := int(math.Ceil(math.Sqrt(float64(len(meshes)))))
+	var size sdf.V3
+	for _, m := range meshes {
+		if len(m.Vertices) != 0 {
+			size = size.Max(meshBox(m).Size())
+		}
+	}
+	parts := make([]Part3MF, len(meshes))
+	for i, m := range meshes {
+		x, y := float64(i%columns), float64(i/columns)
+		parts[i] = Part3MF{instances[i].Name, m, sdf.V3{x * (size.X + gap), y * (size.Y + gap), 0}}
+	}
+	return Save3MFParts(path, parts)
+}
+
+// meshBox returns the bounding box of the vertices of a mesh.
+func meshBox(m *Mesh) sdf.Box3 {
+	bb := sdf.Box3{m.Vertices[0], m.Vertices[0]}
+	for _, v := range m.Vertices[1:] {
+		bb = bb.Include(v)
+	}
+	return bb
+}
+
+//-----------------------------------------------------------------------------
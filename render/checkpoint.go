@@ -0,0 +1,307 @@
+//-----------------------------------------------------------------------------
+/*
+
+Render Checkpoints
+
+A tiled marching cubes render that saves its progress to a directory, so
+a long render can be resumed after a crash or restart. For each tile the
+triangles generated so far are appended to a file, and every few x layers
+the sampled slab of SDF values is saved with the triangle count. On resume
+the saved triangles are sent to the output again and rendering continues
+from the last saved slab.
+
+Resuming with a different SDF gives a bad mesh; the directory should be
+cleared when the model changes.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// MarchingCubesCheckpoint renders using tiled marching cubes, saving progress to a checkpoint directory.
+type MarchingCubesCheckpoint struct {
+	Dir          string          // checkpoint directory
+	Layers       int             // x layers between checkpoints of a tile (0: completed tiles only)
+	MemoryBudget int64           // memory budget per tile in bytes (0 = 256 MiB)
+	Workers      int             // number of tiles rendered concurrently (0 = 1)
+	Tolerances   *sdf.Tolerances // nil: derived from the bounding box
+	Resolution   *Resolution     // nil: cubic cells
+}
+
+// checkpointManifest identifies the render a checkpoint directory belongs to.
+type checkpointManifest struct {
+	MeshCells int
+	Base, Inc [3]float64
+	Steps     [3]int
+	Tiles     int
+}
+
+func (m *MarchingCubesCheckpoint) tiled() *MarchingCubesTiled {
+	return &MarchingCubesTiled{m.MemoryBudget, m.Workers, m.Tolerances, m.Resolution, false}
+}
+
+// Info returns a string describing the rendered volume.
+func (m *MarchingCubesCheckpoint) Info(s sdf.SDF3, meshCells int) string {
+	return m.tiled().Info(s, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It panics if the checkpoint can't be read or written.
+func (m *MarchingCubesCheckpoint) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	if err := m.RenderCheckpoint(s, meshCells, output); err != nil {
+		panic(err)
+	}
+}
+
+// RenderCheckpoint produces a 3d triangle mesh over the bounding volume of an sdf3,
+// resuming from the checkpoint directory if it has a checkpoint for the render.
+func (m *MarchingCubesCheckpoint) RenderCheckpoint(s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	return m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext is RenderCheckpoint, aborted with ctx.Err() when the context is done.
+// The progress up to the last checkpoint is kept, so an aborted render can be resumed.
+func (m *MarchingCubesCheckpoint) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	if m.Dir == "" {
+		return sdf.ErrMsg("no checkpoint directory")
+	}
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	tr := m.tiled()
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	tiles := tr.Tiles(s, meshCells)
+	if err := m.manifest(checkpointManifest{
+		meshCells,
+		[3]float64{base.X, base.Y, base.Z},
+		[3]float64{inc.X, inc.Y, inc.Z},
+		[3]int{steps[0], steps[1], steps[2]},
+		len(tiles),
+	}); err != nil {
+		return err
+	}
+	eps := modelTolerances(s, m.Tolerances).Vertex
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+
+	var mu sync.Mutex
+	var tileErr error
+	workers := m.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	p := NewPool(workers)
+	defer p.Close()
+	g := p.Group()
+	for _, t := range tiles {
+		t := t
+		g.Go(func() {
+			if err := m.renderTile(ctx, s, base, inc, eps, t, output); err != nil {
+				mu.Lock()
+				if tileErr == nil {
+					tileErr = err
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if tileErr != nil {
+		return tileErr
+	}
+	progress.Done()
+	return nil
+}
+
+// manifest writes the checkpoint manifest, or checks it matches an existing one.
+func (m *MarchingCubesCheckpoint) manifest(cm checkpointManifest) error {
+	path := filepath.Join(m.Dir, "checkpoint.json")
+	b, err := ioutil.ReadFile(path)
+	if err == nil {
+		var old checkpointManifest
+		if err := json.Unmarshal(b, &old); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(old, cm) {
+			return sdf.ErrMsg("checkpoint is for a different render")
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	b, err = json.MarshalIndent(&cm, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b)
+}
+
+//-----------------------------------------------------------------------------
+
+// writeFileAtomic writes a file via a temporary file, so a crash leaves the old or the new file.
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// tileState is the saved progress of a tile.
+type tileState struct {
+	x     int       // number of x layers processed
+	count int       // number of triangles saved
+	slab  []float64 // sampled values for layer x (nil: tile done)
+}
+
+// readTileState reads the state of a tile (the zero state if there is none).
+func readTileState(path string) (tileState, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return tileState{}, nil
+	}
+	if err != nil {
+		return tileState{}, err
+	}
+	if len(b) < 16 || (len(b)-16)%8 != 0 {
+		return tileState{}, sdf.ErrMsg(fmt.Sprintf("bad tile state %s", path))
+	}
+	ts := tileState{}
+	ts.x = int(binary.LittleEndian.Uint64(b))
+	ts.count = int(binary.LittleEndian.Uint64(b[8:]))
+	for i := 16; i < len(b); i += 8 {
+		ts.slab = append(ts.slab, math.Float64frombits(binary.LittleEndian.Uint64(b[i:])))
+	}
+	return ts, nil
+}
+
+// writeTileState writes the state of a tile.
+func writeTileState(path string, ts tileState) error {
+	b := make([]byte, 16+8*len(ts.slab))
+	binary.LittleEndian.PutUint64(b, uint64(ts.x))
+	binary.LittleEndian.PutUint64(b[8:], uint64(ts.count))
+	for i, v := range ts.slab {
+		binary.LittleEndian.PutUint64(b[16+8*i:], math.Float64bits(v))
+	}
+	return writeFileAtomic(path, b)
+}
+
+// renderTile renders a tile, resuming from and saving to the checkpoint directory.
+func (m *MarchingCubesCheckpoint) renderTile(ctx context.Context, s sdf.SDF3, base, inc sdf.V3, eps float64, t Tile, output chan<- *Triangle3) error {
+	statePath := filepath.Join(m.Dir, fmt.Sprintf("tile-%d.state", t.Index))
+	ts, err := readTileState(statePath)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(m.Dir, fmt.Sprintf("tile-%d.tri", t.Index)), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// drop any triangles written after the last checkpoint
+	if err := f.Truncate(int64(ts.count) * triangleSize); err != nil {
+		return err
+	}
+	// send the saved triangles
+	r := bufio.NewReader(f)
+	rec := make([]byte, triangleSize)
+	for i := 0; i < ts.count; i++ {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return err
+		}
+		output <- getTriangle(rec)
+	}
+	progressOf(ctx).Add(int64(ts.x)*int64(t.Steps[1]*t.Steps[2]), int64(ts.count))
+	if ts.x != 0 && ts.slab == nil {
+		// the tile is done
+		return nil
+	}
+
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	var werr error
+	emit := func(tris []*Triangle3) {
+		for _, tri := range tris {
+			putTriangle(rec, tri)
+			if _, err := w.Write(rec); err != nil && werr == nil {
+				werr = err
+			}
+			ts.count++
+			output <- tri
+		}
+	}
+	x0 := ts.x
+	layer := func(x int, slab []float64) error {
+		if werr != nil {
+			return werr
+		}
+		done := x == t.Steps[0]
+		if !done && (m.Layers <= 0 || (x-x0)%m.Layers != 0) {
+			return nil
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+		ts.x, ts.slab = x, slab
+		if done {
+			ts.slab = nil
+		}
+		return writeTileState(statePath, ts)
+	}
+	var slab []float64
+	if ts.x != 0 {
+		slab = ts.slab
+	}
+	return marchingCubesSlabs(ctx, s, &mcSlabs{
+		base:  base,
+		inc:   inc,
+		ofs:   t.Ofs,
+		steps: t.Steps,
+		eps:   eps,
+		start: ts.x,
+		slab:  slab,
+		emit:  emit,
+		layer: layer,
+	})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,125 @@
+//-----------------------------------------------------------------------------
+/*
+
+Region of Interest Rendering
+
+Render a region (a box) of the bounding box of a model, e.g. to remesh a
+detail of a large model (a thread, a snap fit) at a high resolution
+without rendering the whole part. The renderer is given the model with its
+bounding box clipped to the region, so meshCells is the cells on the
+longest axis of the region.
+
+The mesh ends where it crosses the boundary of the region (to within a
+cell), or is capped by the faces of the region to give a closed mesh.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// clipSDF3 is a model with its bounding box clipped to a region.
+type clipSDF3 struct {
+	s   sdf.SDF3
+	bb  sdf.Box3
+	cap bool // intersect the model with the region
+}
+
+// Evaluate returns the minimum distance to the clipped model.
+func (s *clipSDF3) Evaluate(p sdf.V3) float64 {
+	d := s.s.Evaluate(p)
+	if !s.cap {
+		return d
+	}
+	return math.Max(d, s.box(p))
+}
+
+// EvaluateN evaluates the clipped model at a slice of points.
+func (s *clipSDF3) EvaluateN(p []sdf.V3, out []float64) {
+	sdf.EvaluateN(s.s, p, out)
+	if s.cap {
+		for i := range p {
+			out[i] = math.Max(out[i], s.box(p[i]))
+		}
+	}
+}
+
+// box returns the distance to the region box.
+func (s *clipSDF3) box(p sdf.V3) float64 {
+	q := p.Sub(s.bb.Center()).Abs().Sub(s.bb.Size().MulScalar(0.5))
+	return q.Max(sdf.V3{}).Length() + math.Min(q.MaxComponent(), 0)
+}
+
+// BoundingBox returns the bounding box of the clipped model.
+func (s *clipSDF3) BoundingBox() sdf.Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// ClippedRender is a renderer limited to a region of the bounding box of a model.
+type ClippedRender struct {
+	r   Render3
+	box sdf.Box3
+	cap bool
+}
+
+// Clipped returns a renderer limited to a region of the bounding box of a model.
+// The mesh is closed by the faces of the region if cap is set.
+func Clipped(r Render3, box sdf.Box3, cap bool) *ClippedRender {
+	return &ClippedRender{r, box, cap}
+}
+
+// clip returns the model clipped to the region.
+func (c *ClippedRender) clip(s sdf.SDF3) (sdf.SDF3, error) {
+	bb := s.BoundingBox()
+	bb = sdf.Box3{bb.Min.Max(c.box.Min), bb.Max.Min(c.box.Max)}
+	size := bb.Size()
+	if size.X <= 0 || size.Y <= 0 || size.Z <= 0 {
+		return nil, sdf.ErrMsg("region doesn't overlap the bounding box")
+	}
+	return &clipSDF3{s, bb, c.cap}, nil
+}
+
+// Info returns a string describing the rendered volume.
+func (c *ClippedRender) Info(s sdf.SDF3, meshCells int) string {
+	cs, err := c.clip(s)
+	if err != nil {
+		return err.Error()
+	}
+	return c.r.Info(cs, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the region of the bounding volume of an sdf3.
+func (c *ClippedRender) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	c.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the region of the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (c *ClippedRender) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	cs, err := c.clip(s)
+	if err != nil {
+		return err
+	}
+	return renderContext(ctx, c.r, cs, meshCells, output)
+}
+
+// RenderIndexed renders the region of the bounding volume of an sdf3 to an indexed mesh.
+func (c *ClippedRender) RenderIndexed(ctx context.Context, s sdf.SDF3, meshCells int) (*Mesh, error) {
+	cs, err := c.clip(s)
+	if err != nil {
+		return nil, err
+	}
+	return RenderIndexed(ctx, cs, meshCells, c.r)
+}
+
+//-----------------------------------------------------------------------------
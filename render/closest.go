@@ -0,0 +1,309 @@
+//-----------------------------------------------------------------------------
+/*
+
+Closest Points on Triangle Meshes
+
+The closest point on a triangle (Ericson, Real-Time Collision Detection 5.1.5)
+and a uniform grid of triangles for nearest triangle, box and ray queries.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// ClosestPoint returns the point on the triangle closest to p.
+func (t *Triangle3) ClosestPoint(p sdf.V3) sdf.V3 {
+	a, b, c := t.V[0], t.V[1], t.V[2]
+	ab, ac, ap := b.Sub(a), c.Sub(a), p.Sub(a)
+	d1, d2 := ab.Dot(ap), ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
+	}
+	bp := p.Sub(b)
+	d3, d4 := ab.Dot(bp), ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
+	}
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		return a.Add(ab.MulScalar(d1 / (d1 - d3)))
+	}
+	cp := p.Sub(c)
+	d5, d6 := ab.Dot(cp), ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		return a.Add(ac.MulScalar(d2 / (d2 - d6)))
+	}
+	va := d3*d6 - d5*d4
+	if va <= 0 && d4-d3 >= 0 && d5-d6 >= 0 {
+		return b.Add(c.Sub(b).MulScalar((d4 - d3) / ((d4 - d3) + (d5 - d6))))
+	}
+	denom := va + vb + vc
+	if denom == 0 {
+		// degenerate triangle
+		return a
+	}
+	v, w := vb/denom, vc/denom
+	return a.Add(ab.MulScalar(v)).Add(ac.MulScalar(w))
+}
+
+//-----------------------------------------------------------------------------
+
+// triangleGrid buckets triangles into a uniform grid for nearest triangle queries.
+type triangleGrid struct {
+	tris  []*Triangle3
+	bb    sdf.Box3
+	cell  float64
+	n     sdf.V3i
+	cells map[int][]int32 // cell index to triangles overlapping the cell bounding box
+}
+
+// newTriangleGrid returns a grid with about 2 triangles per occupied cell.
+func newTriangleGrid(tris []*Triangle3) *triangleGrid {
+	g := &triangleGrid{tris: tris, cells: make(map[int][]int32)}
+	if len(tris) == 0 {
+		return g
+	}
+	bb := sdf.Box3{tris[0].V[0], tris[0].V[0]}
+	var area float64
+	for _, t := range tris {
+		for _, v := range t.V {
+			bb = bb.Include(v)
+		}
+		area += t.V[1].Sub(t.V[0]).Cross(t.V[2].Sub(t.V[0])).Length() / 2
+	}
+	// cells sized so a cell holds a couple of triangles of average area
+	g.cell = math.Max(math.Sqrt(2*area/float64(len(tris))), bb.Size().MaxComponent()/1024)
+	if g.cell == 0 {
+		g.cell = 1
+	}
+	g.bb = bb
+	size := bb.Size().DivScalar(g.cell)
+	g.n = sdf.V3i{int(size.X) + 1, int(size.Y) + 1, int(size.Z) + 1}
+	for i, t := range tris {
+		tb := sdf.Box3{t.V[0], t.V[0]}.Include(t.V[1]).Include(t.V[2])
+		c0, c1 := g.cellOf(tb.Min), g.cellOf(tb.Max)
+		for x := c0[0]; x <= c1[0]; x++ {
+			for y := c0[1]; y <= c1[1]; y++ {
+				for z := c0[2]; z <= c1[2]; z++ {
+					k := g.index(x, y, z)
+					g.cells[k] = append(g.cells[k], int32(i))
+				}
+			}
+		}
+	}
+	return g
+}
+
+// cellOf returns the cell containing a point (clamped to the grid).
+func (g *triangleGrid) cellOf(p sdf.V3) sdf.V3i {
+	q := p.Sub(g.bb.Min).DivScalar(g.cell)
+	c := sdf.V3i{int(math.Floor(q.X)), int(math.Floor(q.Y)), int(math.Floor(q.Z))}
+	for i := range c {
+		if c[i] < 0 {
+			c[i] = 0
+		}
+		if c[i] >= g.n[i] {
+			c[i] = g.n[i] - 1
+		}
+	}
+	return c
+}
+
+func (g *triangleGrid) index(x, y, z int) int {
+	return (x*g.n[1]+y)*g.n[2] + z
+}
+
+// nearest returns the distance from a point to the closest triangle (+Inf: no triangles).
+func (g *triangleGrid) nearest(p sdf.V3) float64 {
+	best := math.Inf(1)
+	if len(g.tris) == 0 {
+		return best
+	}
+	c := g.cellOf(p)
+	// distance from the point to the grid
+	outside := p.Sub(p.Clamp(g.bb.Min, g.bb.Max)).Length()
+	maxR := g.n[0]
+	if g.n[1] > maxR {
+		maxR = g.n[1]
+	}
+	if g.n[2] > maxR {
+		maxR = g.n[2]
+	}
+	for r := 0; r <= maxR; r++ {
+		for x := c[0] - r; x <= c[0]+r; x++ {
+			for y := c[1] - r; y <= c[1]+r; y++ {
+				for z := c[2] - r; z <= c[2]+r; z++ {
+					if x < 0 || y < 0 || z < 0 || x >= g.n[0] || y >= g.n[1] || z >= g.n[2] {
+						continue
+					}
+					// only the shell of the cube
+					if x != c[0]-r && x != c[0]+r && y != c[1]-r && y != c[1]+r && z != c[2]-r && z != c[2]+r {
+						continue
+					}
+					for _, i := range g.cells[g.index(x, y, z)] {
+						if d := p.Sub(g.tris[i].ClosestPoint(p)).Length(); d < best {
+							best = d
+						}
+					}
+				}
+			}
+		}
+		// unvisited cells are at least r cells away
+		if best <= math.Max(outside, float64(r)*g.cell) {
+			break
+		}
+	}
+	return best
+}
+
+//-----------------------------------------------------------------------------
+
+// overlapping returns the triangles in the cells overlapped by a box (sorted).
+func (g *triangleGrid) overlapping(b sdf.Box3) []int32 {
+	if len(g.tris) == 0 || b.Max.X < g.bb.Min.X || b.Max.Y < g.bb.Min.Y || b.Max.Z < g.bb.Min.Z ||
+		b.Min.X > g.bb.Max.X || b.Min.Y > g.bb.Max.Y || b.Min.Z > g.bb.Max.Z {
+		return nil
+	}
+	var idx []int32
+	c0, c1 := g.cellOf(b.Min), g.cellOf(b.Max)
+	for x := c0[0]; x <= c1[0]; x++ {
+		for y := c0[1]; y <= c1[1]; y++ {
+			for z := c0[2]; z <= c1[2]; z++ {
+				idx = append(idx, g.cells[g.index(x, y, z)]...)
+			}
+		}
+	}
+	sort.Slice(idx, func(i, j int) bool { return idx[i] < idx[j] })
+	n := 0
+	for i := range idx {
+		if i == 0 || idx[i] != idx[i-1] {
+			idx[n] = idx[i]
+			n++
+		}
+	}
+	return idx[:n]
+}
+
+// crossings returns the signed crossings of the triangles by a ray from a point along a
+// unit direction (+1 for leaving through a counter-clockwise face). It returns false if
+// the ray hits an edge or the point is on a triangle, to within a tolerance.
+func (g *triangleGrid) crossings(p, d sdf.V3, eps float64) (int, bool) {
+	if len(g.tris) == 0 {
+		return 0, true
+	}
+	// clip the ray to the grid box
+	t0, t1 := 0.0, math.Inf(1)
+	o, dir := [3]float64{p.X, p.Y, p.Z}, [3]float64{d.X, d.Y, d.Z}
+	lo, hi := [3]float64{g.bb.Min.X, g.bb.Min.Y, g.bb.Min.Z}, [3]float64{g.bb.Max.X, g.bb.Max.Y, g.bb.Max.Z}
+	for i := range o {
+		if dir[i] == 0 {
+			if o[i] < lo[i] || o[i] > hi[i] {
+				return 0, true
+			}
+			continue
+		}
+		ta, tb := (lo[i]-o[i])/dir[i], (hi[i]-o[i])/dir[i]
+		if ta > tb {
+			ta, tb = tb, ta
+		}
+		t0, t1 = math.Max(t0, ta), math.Min(t1, tb)
+	}
+	if t0 > t1 {
+		return 0, true
+	}
+	// walk the cells along the ray (Amanatides and Woo)
+	c := g.cellOf(p.Add(d.MulScalar(t0)))
+	var step [3]int
+	var tMax, tDelta [3]float64
+	for i := range o {
+		switch {
+		case dir[i] > 0:
+			step[i] = 1
+			tMax[i] = (lo[i] + float64(c[i]+1)*g.cell - o[i]) / dir[i]
+			tDelta[i] = g.cell / dir[i]
+		case dir[i] < 0:
+			step[i] = -1
+			tMax[i] = (lo[i] + float64(c[i])*g.cell - o[i]) / dir[i]
+			tDelta[i] = -g.cell / dir[i]
+		default:
+			tMax[i], tDelta[i] = math.Inf(1), math.Inf(1)
+		}
+	}
+	const edgeTol = 1e-9
+	seen := make(map[int32]bool)
+	n := 0
+	for {
+		for _, i := range g.cells[g.index(c[0], c[1], c[2])] {
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+			t := g.tris[i]
+			// Moller-Trumbore
+			e1, e2 := t.V[1].Sub(t.V[0]), t.V[2].Sub(t.V[0])
+			pv := d.Cross(e2)
+			det := e1.Dot(pv)
+			if math.Abs(det) <= edgeTol*e1.Length()*e2.Length() {
+				// parallel to the triangle, ambiguous on its plane
+				if nl := e1.Cross(e2).Length(); nl > 0 && math.Abs(p.Sub(t.V[0]).Dot(e1.Cross(e2)))/nl <= eps {
+					return n, false
+				}
+				continue
+			}
+			s := p.Sub(t.V[0])
+			u := s.Dot(pv) / det
+			if u < -edgeTol || u > 1+edgeTol {
+				continue
+			}
+			q := s.Cross(e1)
+			v := d.Dot(q) / det
+			if v < -edgeTol || u+v > 1+edgeTol {
+				continue
+			}
+			h := e2.Dot(q) / det
+			if h < -eps {
+				continue
+			}
+			if h <= eps || u <= edgeTol || v <= edgeTol || u+v >= 1-edgeTol {
+				return n, false
+			}
+			if det < 0 {
+				n++
+			} else {
+				n--
+			}
+		}
+		// next cell
+		k := 0
+		if tMax[1] < tMax[k] {
+			k = 1
+		}
+		if tMax[2] < tMax[k] {
+			k = 2
+		}
+		if tMax[k] > t1 {
+			break
+		}
+		c[k] += step[k]
+		if c[k] < 0 || c[k] >= g.n[k] {
+			break
+		}
+		tMax[k] += tDelta[k]
+	}
+	return n, true
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,596 @@
+//-----------------------------------------------------------------------------
+/*
+
+Approximate Convex Decomposition
+
+Split a model into convex pieces for the colliders of physics engines (game
+engines, robotics simulators), in the style of V-HACD. The model (an SDF3 or
+a closed mesh) is voxelized, then the piece with the largest concavity (the
+volume of its convex hull less its volume) is split by the axis aligned
+plane minimizing the concavity of the halves and their difference in
+volume, until every piece is nearly convex or there are enough pieces. The
+convex pieces are the hulls of the voxels of the pieces, so they cover the
+model to within a voxel.
+
+The hulls are built on the voxel corners with integer arithmetic, so they
+are exact and have no degenerate faces.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// ConvexConfig sets the parameters of a convex decomposition.
+type ConvexConfig struct {
+	Resolution  int     // voxels on the longest axis (0: 64)
+	MaxHulls    int     // maximum number of convex pieces, at least one per connected part (0: 16)
+	Concavity   float64 // concavity of a piece left unsplit, as a fraction of the model volume (0: 0.01)
+	MaxVertices int     // maximum vertices of a convex piece (0: 64)
+}
+
+const (
+	convexSplits  = 16   // split planes tried on each axis of a piece
+	convexBalance = 0.05 // weight of the volume difference of the halves in the cost of a split
+)
+
+//-----------------------------------------------------------------------------
+// Convex hulls of lattice points.
+
+// hullFace is a face of a convex hull, counter-clockwise seen from outside.
+type hullFace struct {
+	v     [3]int   // point indices
+	n     [3]int64 // normal
+	d     int64    // n.p for the points on the face
+	above []int    // points above the face
+	far   int      // farthest point above the face
+	farH  int64    // height of the farthest point
+	dist  float64  // distance of the farthest point
+	dead  bool
+}
+
+// height returns n.p - d (> 0 above the face).
+func (f *hullFace) height(p sdf.V3i) int64 {
+	return f.n[0]*int64(p[0]) + f.n[1]*int64(p[1]) + f.n[2]*int64(p[2]) - f.d
+}
+
+// newHullFace returns the face through 3 points.
+func newHullFace(pts []sdf.V3i, a, b, c int) *hullFace {
+	pa, pb, pc := pts[a], pts[b], pts[c]
+	u := [3]int64{int64(pb[0] - pa[0]), int64(pb[1] - pa[1]), int64(pb[2] - pa[2])}
+	w := [3]int64{int64(pc[0] - pa[0]), int64(pc[1] - pa[1]), int64(pc[2] - pa[2])}
+	f := &hullFace{v: [3]int{a, b, c}, far: -1}
+	f.n = [3]int64{u[1]*w[2] - u[2]*w[1], u[2]*w[0] - u[0]*w[2], u[0]*w[1] - u[1]*w[0]}
+	f.d = f.n[0]*int64(pa[0]) + f.n[1]*int64(pa[1]) + f.n[2]*int64(pa[2])
+	return f
+}
+
+// add adds a point to the points above the face if it is above the face.
+func (f *hullFace) add(pts []sdf.V3i, i int) bool {
+	h := f.height(pts[i])
+	if h <= 0 {
+		return false
+	}
+	f.above = append(f.above, i)
+	// ties go to the lexically greatest point, a vertex of the hull rather than a point on an edge
+	if f.far < 0 || h > f.farH || (h == f.farH && lexGreater(pts[i], pts[f.far])) {
+		n := math.Sqrt(float64(f.n[0]*f.n[0] + f.n[1]*f.n[1] + f.n[2]*f.n[2]))
+		f.far, f.farH, f.dist = i, h, float64(h)/n
+	}
+	return true
+}
+
+// lexGreater returns true if p is lexically greater than q.
+func lexGreater(p, q sdf.V3i) bool {
+	for i := range p {
+		if p[i] != q[i] {
+			return p[i] > q[i]
+		}
+	}
+	return false
+}
+
+// convexHull is the convex hull of a set of lattice points.
+type convexHull struct {
+	pts   []sdf.V3i
+	faces [][3]int
+}
+
+// volume6 returns 6 times the volume of the hull.
+func (h *convexHull) volume6() int64 {
+	var v int64
+	for _, f := range h.faces {
+		a, b, c := h.pts[f[0]], h.pts[f[1]], h.pts[f[2]]
+		v += int64(a[0])*(int64(b[1])*int64(c[2])-int64(b[2])*int64(c[1])) +
+			int64(a[1])*(int64(b[2])*int64(c[0])-int64(b[0])*int64(c[2])) +
+			int64(a[2])*(int64(b[0])*int64(c[1])-int64(b[1])*int64(c[0]))
+	}
+	return v
+}
+
+// newConvexHull returns the convex hull of a set of distinct points (quickhull), with at most
+// maxVertices vertices (0: no limit) added farthest first. It returns nil if the points are coplanar.
+func newConvexHull(pts []sdf.V3i, maxVertices int) *convexHull {
+	if len(pts) < 4 {
+		return nil
+	}
+	sub := func(a, b sdf.V3i) [3]int64 {
+		return [3]int64{int64(a[0] - b[0]), int64(a[1] - b[1]), int64(a[2] - b[2])}
+	}
+	cross := func(u, w [3]int64) [3]int64 {
+		return [3]int64{u[1]*w[2] - u[2]*w[1], u[2]*w[0] - u[0]*w[2], u[0]*w[1] - u[1]*w[0]}
+	}
+	dot := func(u, w [3]int64) int64 {
+		return u[0]*w[0] + u[1]*w[1] + u[2]*w[2]
+	}
+	// initial tetrahedron of extreme points (ties go to the lexically greatest point)
+	s := [4]int{0, 0, 0, 0}
+	for i, p := range pts {
+		if lexGreater(pts[s[0]], p) {
+			s[0] = i
+		}
+	}
+	var best int64 = -1
+	for i, p := range pts {
+		d := sub(p, pts[s[0]])
+		if l := dot(d, d); l > best || (l == best && lexGreater(p, pts[s[1]])) {
+			s[1], best = i, l
+		}
+	}
+	best = 0
+	e := sub(pts[s[1]], pts[s[0]])
+	for i, p := range pts {
+		c := cross(e, sub(p, pts[s[0]]))
+		if l := dot(c, c); l > best || (l > 0 && l == best && lexGreater(p, pts[s[2]])) {
+			s[2], best = i, l
+		}
+	}
+	if best == 0 {
+		return nil
+	}
+	best = 0
+	n := cross(e, sub(pts[s[2]], pts[s[0]]))
+	for i, p := range pts {
+		v := dot(n, sub(p, pts[s[0]]))
+		if v < 0 {
+			v = -v
+		}
+		if v > best || (v > 0 && v == best && lexGreater(p, pts[s[3]])) {
+			s[3], best = i, v
+		}
+	}
+	if best == 0 {
+		return nil
+	}
+	if dot(n, sub(pts[s[3]], pts[s[0]])) > 0 {
+		s[1], s[2] = s[2], s[1]
+	}
+	faces := []*hullFace{
+		newHullFace(pts, s[0], s[1], s[2]),
+		newHullFace(pts, s[0], s[3], s[1]),
+		newHullFace(pts, s[1], s[3], s[2]),
+		newHullFace(pts, s[2], s[3], s[0]),
+	}
+	for i := range pts {
+		if i == s[0] || i == s[1] || i == s[2] || i == s[3] {
+			continue
+		}
+		for _, f := range faces {
+			if f.add(pts, i) {
+				break
+			}
+		}
+	}
+	vertices := 4
+	for maxVertices <= 0 || vertices < maxVertices {
+		// the farthest point above a face
+		var top *hullFace
+		for _, f := range faces {
+			if !f.dead && f.far >= 0 && (top == nil || f.dist > top.dist) {
+				top = f
+			}
+		}
+		if top == nil {
+			break
+		}
+		p := top.far
+		vertices++
+		// the faces seen from the point, and their horizon
+		edges := make(map[[2]int]bool)
+		var visible []*hullFace
+		for _, f := range faces {
+			if !f.dead && f.height(pts[p]) > 0 {
+				f.dead = true
+				visible = append(visible, f)
+				for k := 0; k < 3; k++ {
+					edges[[2]int{f.v[k], f.v[(k+1)%3]}] = true
+				}
+			}
+		}
+		var added []*hullFace
+		for _, f := range visible {
+			for k := 0; k < 3; k++ {
+				a, b := f.v[k], f.v[(k+1)%3]
+				if !edges[[2]int{b, a}] {
+					added = append(added, newHullFace(pts, a, b, p))
+				}
+			}
+		}
+		for _, f := range visible {
+			for _, i := range f.above {
+				if i == p {
+					continue
+				}
+				for _, g := range added {
+					if g.add(pts, i) {
+						break
+					}
+				}
+			}
+			f.above = nil
+		}
+		faces = append(faces, added...)
+	}
+	// compact the hull vertices
+	h := &convexHull{}
+	index := make(map[int]int)
+	for _, f := range faces {
+		if f.dead {
+			continue
+		}
+		var t [3]int
+		for k, i := range f.v {
+			j, ok := index[i]
+			if !ok {
+				j = len(h.pts)
+				index[i] = j
+				h.pts = append(h.pts, pts[i])
+			}
+			t[k] = j
+		}
+		h.faces = append(h.faces, t)
+	}
+	return h
+}
+
+//-----------------------------------------------------------------------------
+// Voxel pieces.
+
+// convexPiece is a set of voxels of a decomposition.
+type convexPiece struct {
+	voxels []sdf.V3i
+	excess int64 // 6 x (hull volume - voxel volume)
+}
+
+// newConvexPiece returns a piece with the excess volume of the convex hull of its voxels.
+func newConvexPiece(voxels []sdf.V3i) *convexPiece {
+	c := &convexPiece{voxels: voxels}
+	if h := newConvexHull(convexCorners(voxels), 0); h != nil {
+		c.excess = h.volume6() - 6*int64(len(voxels))
+	}
+	return c
+}
+
+// convexCorners returns the distinct corners of the voxels at the ends of the x rows of a set
+// of voxels. Their convex hull is the convex hull of the voxels.
+func convexCorners(voxels []sdf.V3i) []sdf.V3i {
+	rows := make(map[[2]int][2]int)
+	for _, v := range voxels {
+		k := [2]int{v[1], v[2]}
+		r, ok := rows[k]
+		if !ok {
+			r = [2]int{v[0], v[0]}
+		}
+		if v[0] < r[0] {
+			r[0] = v[0]
+		}
+		if v[0] > r[1] {
+			r[1] = v[0]
+		}
+		rows[k] = r
+	}
+	seen := make(map[sdf.V3i]bool)
+	var pts []sdf.V3i
+	for k, r := range rows {
+		for _, x := range []int{r[0], r[1] + 1} {
+			for dy := 0; dy < 2; dy++ {
+				for dz := 0; dz < 2; dz++ {
+					p := sdf.V3i{x, k[0] + dy, k[1] + dz}
+					if !seen[p] {
+						seen[p] = true
+						pts = append(pts, p)
+					}
+				}
+			}
+		}
+	}
+	return pts
+}
+
+// convexComponents returns the 6-connected components of a set of voxels.
+func convexComponents(voxels []sdf.V3i) [][]sdf.V3i {
+	todo := make(map[sdf.V3i]bool, len(voxels))
+	for _, v := range voxels {
+		todo[v] = true
+	}
+	var parts [][]sdf.V3i
+	for _, v := range voxels {
+		if !todo[v] {
+			continue
+		}
+		delete(todo, v)
+		part := []sdf.V3i{v}
+		for i := 0; i < len(part); i++ {
+			for _, d := range [6]sdf.V3i{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}} {
+				w := part[i].Add(d)
+				if todo[w] {
+					delete(todo, w)
+					part = append(part, w)
+				}
+			}
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// split returns the halves of a piece split by the axis aligned plane of least cost.
+func (c *convexPiece) split() (*convexPiece, *convexPiece, error) {
+	lo, hi := c.voxels[0], c.voxels[0]
+	for _, v := range c.voxels {
+		for i := range v {
+			if v[i] < lo[i] {
+				lo[i] = v[i]
+			}
+			if v[i] > hi[i] {
+				hi[i] = v[i]
+			}
+		}
+	}
+	type plane struct {
+		axis, at int
+		a, b     *convexPiece
+	}
+	var planes []*plane
+	for axis := 0; axis < 3; axis++ {
+		step := (hi[axis] - lo[axis] + convexSplits - 1) / convexSplits
+		if step < 1 {
+			step = 1
+		}
+		for at := lo[axis] + step; at <= hi[axis]; at += step {
+			planes = append(planes, &plane{axis: axis, at: at})
+		}
+	}
+	g := DefaultPool().Group()
+	for _, p := range planes {
+		p := p
+		g.Go(func() {
+			var a, b []sdf.V3i
+			for _, v := range c.voxels {
+				if v[p.axis] < p.at {
+					a = append(a, v)
+				} else {
+					b = append(b, v)
+				}
+			}
+			p.a, p.b = newConvexPiece(a), newConvexPiece(b)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, nil, err
+	}
+	// the excess volume of the halves, and a penalty for unbalanced halves
+	// (the excess of a ring is the same for a slice off its side as for a cut through its middle)
+	cost := func(p *plane) float64 {
+		d := len(p.a.voxels) - len(p.b.voxels)
+		if d < 0 {
+			d = -d
+		}
+		return float64(p.a.excess+p.b.excess) + convexBalance*6*float64(d)
+	}
+	var best *plane
+	for _, p := range planes {
+		if best == nil || cost(p) < cost(best) {
+			best = p
+		}
+	}
+	if best == nil {
+		return nil, nil, sdf.ErrMsg("piece can't be split")
+	}
+	return best.a, best.b, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// ConvexDecomposition returns convex pieces approximating an SDF3, e.g. for the colliders of a physics engine.
+func ConvexDecomposition(s sdf.SDF3, cfg *ConvexConfig) ([]*Mesh, error) {
+	if cfg == nil {
+		cfg = &ConvexConfig{}
+	}
+	origin, voxel, n := voxelLattice(s.BoundingBox(), convexResolution(cfg))
+	// sample the voxel centers, a z layer per task
+	layers := make([][]float64, n[2])
+	g := DefaultPool().Group()
+	for z := 0; z < n[2]; z++ {
+		z := z
+		g.Go(func() {
+			p := make([]sdf.V3, 0, n[0]*n[1])
+			for y := 0; y < n[1]; y++ {
+				for x := 0; x < n[0]; x++ {
+					p = append(p, origin.Add(sdf.V3{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5}.Mul(voxel)))
+				}
+			}
+			layers[z] = make([]float64, len(p))
+			sdf.EvaluateN(s, p, layers[z])
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var voxels []sdf.V3i
+	for z, layer := range layers {
+		for i, d := range layer {
+			if d <= 0 {
+				voxels = append(voxels, sdf.V3i{i % n[0], i / n[0], z})
+			}
+		}
+	}
+	return convexDecompose(voxels, origin, voxel, cfg)
+}
+
+// MeshConvexDecomposition returns convex pieces approximating a closed, outward facing mesh
+// (see ConvexDecomposition).
+func MeshConvexDecomposition(m *Mesh, cfg *ConvexConfig) ([]*Mesh, error) {
+	if cfg == nil {
+		cfg = &ConvexConfig{}
+	}
+	if len(m.Faces) == 0 {
+		return nil, sdf.ErrMsg("empty mesh")
+	}
+	bb := m.bounds()
+	origin, voxel, n := voxelLattice(bb, convexResolution(cfg))
+	x := &csgOperand{grid: newTriangleGrid(m.Triangles())}
+	eps := 1e-7 * bb.Size().Length()
+	// the voxel centers inside the mesh, a z layer per task
+	layers := make([][]sdf.V3i, n[2])
+	g := DefaultPool().Group()
+	for z := 0; z < n[2]; z++ {
+		z := z
+		g.Go(func() {
+			for y := 0; y < n[1]; y++ {
+				for i := 0; i < n[0]; i++ {
+					p := origin.Add(sdf.V3{float64(i) + 0.5, float64(y) + 0.5, float64(z) + 0.5}.Mul(voxel))
+					if x.winding(p, eps) > 0 {
+						layers[z] = append(layers[z], sdf.V3i{i, y, z})
+					}
+				}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var voxels []sdf.V3i
+	for _, layer := range layers {
+		voxels = append(voxels, layer...)
+	}
+	return convexDecompose(voxels, origin, voxel, cfg)
+}
+
+// convexResolution returns the voxels on the longest axis of a decomposition.
+func convexResolution(cfg *ConvexConfig) int {
+	if cfg.Resolution > 0 {
+		return cfg.Resolution
+	}
+	return 64
+}
+
+// convexDecompose returns the convex pieces of a set of voxels.
+func convexDecompose(voxels []sdf.V3i, origin, voxel sdf.V3, cfg *ConvexConfig) ([]*Mesh, error) {
+	if len(voxels) == 0 {
+		return nil, sdf.ErrMsg("no voxels inside the model, increase the resolution")
+	}
+	maxHulls := cfg.MaxHulls
+	if maxHulls <= 0 {
+		maxHulls = 16
+	}
+	concavity := cfg.Concavity
+	if concavity <= 0 {
+		concavity = 0.01
+	}
+	maxVertices := cfg.MaxVertices
+	if maxVertices <= 0 {
+		maxVertices = 64
+	}
+	limit := int64(concavity * 6 * float64(len(voxels)))
+
+	var pieces []*convexPiece
+	for _, part := range convexComponents(voxels) {
+		pieces = append(pieces, newConvexPiece(part))
+	}
+	for len(pieces) < maxHulls {
+		// split the most concave piece
+		k := -1
+		for i, c := range pieces {
+			if c.excess > limit && len(c.voxels) > 1 && (k < 0 || c.excess > pieces[k].excess) {
+				k = i
+			}
+		}
+		if k < 0 {
+			break
+		}
+		a, b, err := pieces[k].split()
+		if err != nil {
+			return nil, err
+		}
+		pieces = append(pieces[:k], pieces[k+1:]...)
+		for _, half := range []*convexPiece{a, b} {
+			// keep the disconnected parts of a half apart when there is room
+			parts := convexComponents(half.voxels)
+			if len(parts) == 1 || len(pieces)+len(parts)+1 > maxHulls {
+				pieces = append(pieces, half)
+				continue
+			}
+			for _, part := range parts {
+				pieces = append(pieces, newConvexPiece(part))
+			}
+		}
+	}
+
+	// the hull meshes, with at most maxVertices vertices
+	meshes := make([]*Mesh, len(pieces))
+	g := DefaultPool().Group()
+	for i, c := range pieces {
+		i, c := i, c
+		g.Go(func() {
+			h := newConvexHull(convexCorners(c.voxels), maxVertices)
+			m := &Mesh{}
+			for _, p := range h.pts {
+				m.Vertices = append(m.Vertices, origin.Add(p.ToV3().Mul(voxel)))
+			}
+			m.Faces = h.faces
+			meshes[i] = m
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return meshes, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// SaveConvexOBJ writes the convex pieces of a decomposition as the objects (hull_0, hull_1, ...) of an OBJ file.
+func SaveConvexOBJ(path string, hulls []*Mesh) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buf := bufio.NewWriter(file)
+	fmt.Fprintf(buf, "# sdfx convex decomposition\n")
+	base := 1
+	for i, m := range hulls {
+		fmt.Fprintf(buf, "o hull_%d\n", i)
+		for _, v := range m.Vertices {
+			fmt.Fprintf(buf, "v %g %g %g\n", v.X, v.Y, v.Z)
+		}
+		for _, f := range m.Faces {
+			fmt.Fprintf(buf, "f %d %d %d\n", f[0]+base, f[1]+base, f[2]+base)
+		}
+		base += len(m.Vertices)
+	}
+	return buf.Flush()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,644 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Booleans
+
+Union, difference and intersection of closed triangle meshes, computed on
+their faces, e.g. to cut or merge an imported STL (see LoadSTL) exactly,
+without resampling it through an SDF (which loses detail smaller than a cell).
+
+The faces of each mesh are split by the planes of the faces of the other
+mesh they cross, so each piece is inside, outside, or on the surface of the
+other mesh. A piece is classified by the winding number of the other mesh
+(counted along a ray), or by the face of the other mesh it lies on, and the
+faces not crossing the other mesh are classified by connected regions. The
+pieces kept by the boolean are joined into a mesh: vertices closer than a
+tolerance are welded, T-junctions are removed and thin cracks are filled.
+
+The meshes must be closed and outward facing. Per-vertex attributes are not
+kept.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// csgPlane is the plane n.p = w.
+type csgPlane struct {
+	n sdf.V3
+	w float64
+}
+
+// csgPolygon is a convex planar polygon (counter-clockwise about the plane normal).
+type csgPolygon struct {
+	v     []sdf.V3
+	plane csgPlane
+}
+
+// polygon sides of a plane
+const (
+	csgCoplanar = 0
+	csgFront    = 1
+	csgBack     = 2
+	csgSpanning = csgFront | csgBack
+)
+
+// side returns the side of the plane a point is on.
+func (pl csgPlane) side(v sdf.V3, eps float64) int {
+	d := pl.n.Dot(v) - pl.w
+	if d < -eps {
+		return csgBack
+	}
+	if d > eps {
+		return csgFront
+	}
+	return csgCoplanar
+}
+
+// classify returns the side of the plane a polygon is on.
+func (pl csgPlane) classify(p *csgPolygon, eps float64) int {
+	kind := csgCoplanar
+	for _, v := range p.v {
+		kind |= pl.side(v, eps)
+	}
+	return kind
+}
+
+// touches returns true if a vertex of a polygon is on the plane.
+func (pl csgPlane) touches(p *csgPolygon, eps float64) bool {
+	for _, v := range p.v {
+		if pl.side(v, eps) == csgCoplanar {
+			return true
+		}
+	}
+	return false
+}
+
+// intersect returns the point where an edge crosses the plane. The point doesn't depend
+// on the direction of the edge, so the faces sharing the edge are split at the same point.
+func (pl csgPlane) intersect(a, b sdf.V3) sdf.V3 {
+	if b.X < a.X || (b.X == a.X && (b.Y < a.Y || (b.Y == a.Y && b.Z < a.Z))) {
+		a, b = b, a
+	}
+	da := pl.n.Dot(a) - pl.w
+	db := pl.n.Dot(b) - pl.w
+	return a.Add(b.Sub(a).MulScalar(da / (da - db)))
+}
+
+// split returns the polygons split into their pieces on each side of the plane.
+func (pl csgPlane) split(polys []*csgPolygon, eps float64) []*csgPolygon {
+	var out []*csgPolygon
+	for _, p := range polys {
+		if pl.classify(p, eps) != csgSpanning {
+			out = append(out, p)
+			continue
+		}
+		var f, b []sdf.V3
+		n := len(p.v)
+		for i := range p.v {
+			vi, vj := p.v[i], p.v[(i+1)%n]
+			si, sj := pl.side(vi, eps), pl.side(vj, eps)
+			if si != csgBack {
+				f = append(f, vi)
+			}
+			if si != csgFront {
+				b = append(b, vi)
+			}
+			if si|sj == csgSpanning {
+				v := pl.intersect(vi, vj)
+				f = append(f, v)
+				b = append(b, v)
+			}
+		}
+		out = append(out, &csgPolygon{f, p.plane}, &csgPolygon{b, p.plane})
+	}
+	return out
+}
+
+// edgePlane returns the plane through an edge of a polygon, with its normal pointing out of the polygon.
+func (p *csgPolygon) edgePlane(i int) (csgPlane, bool) {
+	a, b := p.v[i], p.v[(i+1)%len(p.v)]
+	n := b.Sub(a).Cross(p.plane.n)
+	l := n.Length()
+	if l == 0 {
+		return csgPlane{}, false
+	}
+	n = n.DivScalar(l)
+	return csgPlane{n, n.Dot(a)}, true
+}
+
+// separatedBy returns true if an edge of the polygon separates it from a coplanar polygon.
+func (p *csgPolygon) separatedBy(q *csgPolygon, eps float64) bool {
+	for i := range p.v {
+		pl, ok := p.edgePlane(i)
+		if ok && pl.classify(q, eps)&csgBack == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// contains returns true if a point on the plane of the polygon is inside it.
+func (p *csgPolygon) contains(v sdf.V3) bool {
+	for i := range p.v {
+		if pl, ok := p.edgePlane(i); ok && pl.n.Dot(v) > pl.w {
+			return false
+		}
+	}
+	return true
+}
+
+// interval returns the interval along a direction of the points of the polygon on a plane.
+func (p *csgPolygon) interval(pl csgPlane, d sdf.V3, eps float64) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	n := len(p.v)
+	for i := range p.v {
+		a, b := p.v[i], p.v[(i+1)%n]
+		sa, sb := pl.side(a, eps), pl.side(b, eps)
+		if sa == csgCoplanar {
+			lo, hi = math.Min(lo, d.Dot(a)), math.Max(hi, d.Dot(a))
+		}
+		if sa|sb == csgSpanning {
+			x := d.Dot(pl.intersect(a, b))
+			lo, hi = math.Min(lo, x), math.Max(hi, x)
+		}
+	}
+	return lo, hi
+}
+
+// crosses returns true if two polygons meeting the planes of each other cross.
+func (p *csgPolygon) crosses(q *csgPolygon, eps float64) bool {
+	d := p.plane.n.Cross(q.plane.n)
+	l := d.Length()
+	if l == 0 {
+		return true
+	}
+	d = d.DivScalar(l)
+	p0, p1 := p.interval(q.plane, d, eps)
+	q0, q1 := q.interval(p.plane, d, eps)
+	return math.Min(p1, q1)-math.Max(p0, q0) > eps
+}
+
+//-----------------------------------------------------------------------------
+
+// piece classes against the other mesh
+const (
+	csgOutside = iota
+	csgInside
+	csgSame     // on a face of the other mesh facing the same way
+	csgOpposite // on a face of the other mesh facing the other way
+)
+
+// csgDirections are the ray directions for winding numbers, tried in order until a ray
+// misses the edges of the mesh.
+var csgDirections = []sdf.V3{
+	sdf.V3{0.5257, 0.6807, 0.5102}.Normalize(),
+	sdf.V3{-0.7071, 0.3162, 0.6325}.Normalize(),
+	sdf.V3{0.2673, -0.8018, 0.5345}.Normalize(),
+	sdf.V3{0.6247, 0.2182, -0.7498}.Normalize(),
+	sdf.V3{-0.3015, -0.4264, -0.8528}.Normalize(),
+}
+
+const (
+	csgChunkSize  = 1024
+	csgWeldFactor = 10 // weld tolerance / plane tolerance
+)
+
+// csgOperand is a mesh of a boolean.
+type csgOperand struct {
+	mesh  *Mesh
+	polys []*csgPolygon // faces (nil: degenerate)
+	grid  *triangleGrid
+}
+
+func newCSGOperand(m *Mesh) *csgOperand {
+	x := &csgOperand{m, make([]*csgPolygon, len(m.Faces)), newTriangleGrid(m.Triangles())}
+	for i, f := range m.Faces {
+		v := []sdf.V3{m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]}
+		n := v[1].Sub(v[0]).Cross(v[2].Sub(v[0]))
+		if l := n.Length(); l != 0 {
+			n = n.DivScalar(l)
+			x.polys[i] = &csgPolygon{v, csgPlane{n, n.Dot(v[0])}}
+		}
+	}
+	return x
+}
+
+// split returns the pieces of a face of another mesh split by the faces it crosses, the
+// faces it lies on, and false if the face doesn't cross or touch a face.
+func (x *csgOperand) split(p *csgPolygon, eps float64) ([]*csgPolygon, []int32, bool) {
+	bb := sdf.Box3{p.v[0], p.v[0]}
+	for _, v := range p.v {
+		bb = bb.Include(v)
+	}
+	bb = bb.Enlarge(sdf.V3{eps, eps, eps}.MulScalar(2))
+	pieces := []*csgPolygon{p}
+	var coplanar []int32
+	touched := false
+	for _, j := range x.grid.overlapping(bb) {
+		q := x.polys[j]
+		if q == nil {
+			continue
+		}
+		kind := p.plane.classify(q, eps)
+		switch {
+		case kind == csgCoplanar:
+			if p.separatedBy(q, eps) || q.separatedBy(p, eps) {
+				continue
+			}
+			touched = true
+			coplanar = append(coplanar, j)
+			for i := range q.v {
+				if pl, ok := q.edgePlane(i); ok {
+					pieces = pl.split(pieces, eps)
+				}
+			}
+		case kind == csgSpanning || p.plane.touches(q, eps):
+			// A face touching the other mesh is classified on its own: the faces on
+			// either side of an edge the other mesh passes through differ.
+			touched = true
+			if q.plane.classify(p, eps) == csgSpanning && p.crosses(q, eps) {
+				pieces = q.plane.split(pieces, eps)
+			}
+		}
+	}
+	return pieces, coplanar, touched
+}
+
+// winding returns the winding number of the mesh about a point.
+func (x *csgOperand) winding(p sdf.V3, eps float64) int {
+	n := 0
+	for _, d := range csgDirections {
+		var ok bool
+		if n, ok = x.grid.crossings(p, d, eps); ok {
+			break
+		}
+	}
+	return n
+}
+
+// classify returns the class of a piece of a face of another mesh.
+func (x *csgOperand) classify(p *csgPolygon, coplanar []int32, eps float64) int {
+	var c sdf.V3
+	for _, v := range p.v {
+		c = c.Add(v)
+	}
+	c = c.DivScalar(float64(len(p.v)))
+	for _, j := range coplanar {
+		if q := x.polys[j]; q.contains(c) {
+			if q.plane.n.Dot(p.plane.n) > 0 {
+				return csgSame
+			}
+			return csgOpposite
+		}
+	}
+	if x.winding(c, eps) > 0 {
+		return csgInside
+	}
+	return csgOutside
+}
+
+// pieces returns the pieces of the faces of the mesh kept by a boolean with another mesh.
+func (x *csgOperand) pieces(y *csgOperand, keep [4]bool, flip bool, eps float64) []*csgPolygon {
+	n := len(x.polys)
+	split := make([][]*csgPolygon, n)
+	crossed := make([]bool, len(x.polys))
+	// split and classify the faces crossing the other mesh
+	g := DefaultPool().Group()
+	for i0 := 0; i0 < n; i0 += csgChunkSize {
+		i0 := i0
+		g.Go(func() {
+			for i := i0; i < i0+csgChunkSize && i < n; i++ {
+				if x.polys[i] == nil {
+					continue
+				}
+				pieces, coplanar, ok := y.split(x.polys[i], eps)
+				if !ok {
+					continue
+				}
+				crossed[i] = true
+				for _, p := range pieces {
+					if keep[y.classify(p, coplanar, eps)] {
+						split[i] = append(split[i], p)
+					}
+				}
+			}
+		})
+	}
+	g.Wait()
+	// the other faces of a connected region have the same class
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+	edges := make(map[[2]int]int)
+	for i, f := range x.mesh.Faces {
+		if x.polys[i] == nil || crossed[i] {
+			continue
+		}
+		for k := range f {
+			e := [2]int{f[k], f[(k+1)%3]}
+			if e[0] > e[1] {
+				e[0], e[1] = e[1], e[0]
+			}
+			if j, ok := edges[e]; ok {
+				parent[find(i)] = find(j)
+			} else {
+				edges[e] = i
+			}
+		}
+	}
+	region := make(map[int]int)
+	var out []*csgPolygon
+	for i, p := range x.polys {
+		if p == nil {
+			continue
+		}
+		if crossed[i] {
+			out = append(out, split[i]...)
+			continue
+		}
+		r := find(i)
+		c, ok := region[r]
+		if !ok {
+			c = y.classify(x.polys[r], nil, eps)
+			region[r] = c
+		}
+		if keep[c] {
+			out = append(out, p)
+		}
+	}
+	if flip {
+		for i, p := range out {
+			v := make([]sdf.V3, len(p.v))
+			for j := range v {
+				v[j] = p.v[len(v)-1-j]
+			}
+			out[i] = &csgPolygon{v, csgPlane{p.plane.n.Neg(), -p.plane.w}}
+		}
+	}
+	return out
+}
+
+//-----------------------------------------------------------------------------
+
+// csgWelder welds the vertices closer than a tolerance.
+type csgWelder struct {
+	tol   float64
+	v     []sdf.V3
+	cells map[[3]int64][]int
+}
+
+func (w *csgWelder) key(v sdf.V3, k float64) [3]int64 {
+	return [3]int64{int64(math.Floor(v.X / k)), int64(math.Floor(v.Y / k)), int64(math.Floor(v.Z / k))}
+}
+
+// add returns the index of the welded vertex.
+func (w *csgWelder) add(v sdf.V3) int {
+	c := w.key(v, w.tol)
+	for x := c[0] - 1; x <= c[0]+1; x++ {
+		for y := c[1] - 1; y <= c[1]+1; y++ {
+			for z := c[2] - 1; z <= c[2]+1; z++ {
+				for _, i := range w.cells[[3]int64{x, y, z}] {
+					if w.v[i].Sub(v).Length() <= w.tol {
+						return i
+					}
+				}
+			}
+		}
+	}
+	i := len(w.v)
+	w.v = append(w.v, v)
+	w.cells[c] = append(w.cells[c], i)
+	return i
+}
+
+// csgJoin returns the mesh of the pieces of a boolean. The split points of the faces on
+// the seam are within a few plane tolerances of each other, so they are welded with a
+// larger tolerance.
+func csgJoin(polys []*csgPolygon, eps float64) *Mesh {
+	eps *= csgWeldFactor
+	// weld the vertices
+	w := &csgWelder{eps, nil, make(map[[3]int64][]int)}
+	idx := make([][]int, 0, len(polys))
+	normals := make([]sdf.V3, 0, len(polys))
+	var length float64
+	edges := 0
+	for _, p := range polys {
+		var f []int
+		for _, v := range p.v {
+			i := w.add(v)
+			if len(f) == 0 || f[len(f)-1] != i {
+				f = append(f, i)
+			}
+		}
+		for len(f) > 1 && f[0] == f[len(f)-1] {
+			f = f[:len(f)-1]
+		}
+		if len(f) < 3 {
+			continue
+		}
+		for k := range f {
+			length += w.v[f[k]].Sub(w.v[f[(k+1)%len(f)]]).Length()
+		}
+		edges += len(f)
+		idx = append(idx, f)
+		normals = append(normals, p.plane.n)
+	}
+	if edges == 0 {
+		return &Mesh{}
+	}
+	// remove the T-junctions: add the vertices on the edges of a polygon to it
+	h := length / float64(edges)
+	cells := make(map[[3]int64][]int)
+	for i, v := range w.v {
+		c := w.key(v, h)
+		cells[c] = append(cells[c], i)
+	}
+	type onEdge struct {
+		t float64
+		i int
+	}
+	for k, f := range idx {
+		var g []int
+		for e := range f {
+			i0, i1 := f[e], f[(e+1)%len(f)]
+			a, b := w.v[i0], w.v[i1]
+			ab := b.Sub(a)
+			l2 := ab.Length2()
+			c0 := w.key(a.Min(b).SubScalar(eps), h)
+			c1 := w.key(a.Max(b).AddScalar(eps), h)
+			var on []onEdge
+			for x := c0[0]; x <= c1[0]; x++ {
+				for y := c0[1]; y <= c1[1]; y++ {
+					for z := c0[2]; z <= c1[2]; z++ {
+						for _, i := range cells[[3]int64{x, y, z}] {
+							if i == i0 || i == i1 {
+								continue
+							}
+							t := w.v[i].Sub(a).Dot(ab) / l2
+							if t <= 0 || t >= 1 || a.Add(ab.MulScalar(t)).Sub(w.v[i]).Length() > eps {
+								continue
+							}
+							on = append(on, onEdge{t, i})
+						}
+					}
+				}
+			}
+			sort.Slice(on, func(i, j int) bool { return on[i].t < on[j].t })
+			g = append(g, i0)
+			for _, o := range on {
+				g = append(g, o.i)
+			}
+		}
+		idx[k] = g
+	}
+	// triangulate the polygons
+	var a TriangleArena
+	var t []*Triangle3
+	for k, f := range idx {
+		n := normals[k]
+		apex := -1
+		for i := range f {
+			ok := true
+			for j := 1; j < len(f)-1 && ok; j++ {
+				v0, v1, v2 := w.v[f[i]], w.v[f[(i+j)%len(f)]], w.v[f[(i+j+1)%len(f)]]
+				e1, e2 := v1.Sub(v0), v2.Sub(v0)
+				ok = e1.Cross(e2).Dot(n) > 1e-9*e1.Length()*e2.Length()
+			}
+			if ok {
+				apex = i
+				break
+			}
+		}
+		if apex >= 0 {
+			for j := 1; j < len(f)-1; j++ {
+				t = append(t, a.New(w.v[f[apex]], w.v[f[(apex+j)%len(f)]], w.v[f[(apex+j+1)%len(f)]]))
+			}
+			continue
+		}
+		// fan from the center (keeping the slivers of welded vertices to close the mesh)
+		var c sdf.V3
+		for _, i := range f {
+			c = c.Add(w.v[i])
+		}
+		c = c.DivScalar(float64(len(f)))
+		for j := range f {
+			t = append(t, a.New(c, w.v[f[j]], w.v[f[(j+1)%len(f)]]))
+		}
+	}
+	m := NewMesh(t)
+	csgCloseCracks(m, eps)
+	return m
+}
+
+// csgCloseCracks fills the thin holes of a mesh, left between seam vertices that are
+// slightly further apart than the weld tolerance.
+func csgCloseCracks(m *Mesh, tol float64) {
+	count := make(map[[2]int]int)
+	for _, f := range m.Faces {
+		for k := range f {
+			count[[2]int{f[k], f[(k+1)%3]}]++
+			count[[2]int{f[(k+1)%3], f[k]}]--
+		}
+	}
+	// the boundary of a hole runs against the open edges
+	var open [][2]int
+	for e, c := range count {
+		if c == 1 {
+			open = append(open, e)
+		}
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i][0] < open[j][0] || (open[i][0] == open[j][0] && open[i][1] < open[j][1])
+	})
+	next := make(map[int]int)
+	for _, e := range open {
+		next[e[1]] = e[0]
+	}
+	done := make(map[int]bool)
+	for _, e := range open {
+		start := e[1]
+		if done[start] {
+			continue
+		}
+		loop := []int{start}
+		done[start] = true
+		closed := false
+		for v := next[start]; len(loop) <= len(next); v = next[v] {
+			if v == start {
+				closed = true
+				break
+			}
+			if done[v] {
+				break
+			}
+			loop = append(loop, v)
+			done[v] = true
+		}
+		if !closed || len(loop) < 3 {
+			continue
+		}
+		var area sdf.V3
+		var perimeter float64
+		for i := range loop {
+			a, b := m.Vertices[loop[i]], m.Vertices[loop[(i+1)%len(loop)]]
+			area = area.Add(a.Cross(b).MulScalar(0.5))
+			perimeter += b.Sub(a).Length()
+		}
+		if area.Length() > tol*perimeter {
+			continue
+		}
+		for i := 1; i < len(loop)-1; i++ {
+			m.Faces = append(m.Faces, [3]int{loop[0], loop[i], loop[i+1]})
+		}
+	}
+}
+
+// csgBoolean returns a boolean of two meshes, keeping the pieces of each by their class.
+func csgBoolean(a, b *Mesh, keepA, keepB [4]bool, flipB bool) (*Mesh, error) {
+	if a == nil || b == nil {
+		return nil, sdf.ErrMsg("nil mesh")
+	}
+	if len(a.Faces) == 0 || len(b.Faces) == 0 {
+		return nil, sdf.ErrMsg("empty mesh")
+	}
+	eps := 1e-7 * meshBox(a).Extend(meshBox(b)).Size().MaxComponent()
+	x, y := newCSGOperand(a), newCSGOperand(b)
+	polys := x.pieces(y, keepA, false, eps)
+	polys = append(polys, y.pieces(x, keepB, flipB, eps)...)
+	return csgJoin(polys, eps), nil
+}
+
+// MeshUnion returns the union of two closed meshes.
+func MeshUnion(a, b *Mesh) (*Mesh, error) {
+	return csgBoolean(a, b, [4]bool{csgOutside: true, csgSame: true}, [4]bool{csgOutside: true}, false)
+}
+
+// MeshDifference returns a closed mesh with the volume of another removed (a - b).
+func MeshDifference(a, b *Mesh) (*Mesh, error) {
+	return csgBoolean(a, b, [4]bool{csgOutside: true, csgOpposite: true}, [4]bool{csgInside: true}, true)
+}
+
+// MeshIntersection returns the intersection of two closed meshes.
+func MeshIntersection(a, b *Mesh) (*Mesh, error) {
+	return csgBoolean(a, b, [4]bool{csgInside: true, csgSame: true}, [4]bool{csgInside: true}, false)
+}
+
+//-----------------------------------------------------------------------------
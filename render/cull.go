@@ -0,0 +1,162 @@
+//-----------------------------------------------------------------------------
+/*
+
+Empty Block Culling
+
+The cubes of a marching cubes lattice are grouped into blocks, and the
+blocks where the interval of the SDF (see sdf.EvaluateInterval) excludes
+zero can't contain the surface. The lattice points that are only in such
+blocks aren't evaluated, they get a value with the sign of the block, so
+their cubes produce no triangles.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// mcCullBlock is the number of cubes on each axis of a culled block.
+const mcCullBlock = 8
+
+// mcCull samples the layers of a lattice, skipping the points of the empty blocks.
+type mcCull struct {
+	s          sdf.SDF3
+	xs, ys, zs []float64
+	ny, nz     int               // blocks on y and z
+	rows       map[int][]float64 // block values of the x block rows (0: not culled)
+}
+
+func newMCCull(s sdf.SDF3, xs, ys, zs []float64) *mcCull {
+	return &mcCull{
+		s:    s,
+		xs:   xs,
+		ys:   ys,
+		zs:   zs,
+		ny:   mcBlocks(len(ys) - 1),
+		nz:   mcBlocks(len(zs) - 1),
+		rows: make(map[int][]float64),
+	}
+}
+
+// mcBlocks returns the number of blocks for n cubes.
+func mcBlocks(n int) int {
+	return (n + mcCullBlock - 1) / mcCullBlock
+}
+
+// mcBlockRange returns the blocks containing lattice point i (of n cubes).
+func mcBlockRange(i, n int) (int, int) {
+	b0, b1 := (i-1)/mcCullBlock, i/mcCullBlock
+	if i == 0 || i%mcCullBlock != 0 {
+		b0 = b1
+	}
+	if last := mcBlocks(n) - 1; b1 > last {
+		b1 = last
+	}
+	return b0, b1
+}
+
+// mcBlockSpan returns the lattice coordinates spanned by block b.
+func mcBlockSpan(lattice []float64, b int) (float64, float64) {
+	i1 := (b + 1) * mcCullBlock
+	if i1 >= len(lattice) {
+		i1 = len(lattice) - 1
+	}
+	return lattice[b*mcCullBlock], lattice[i1]
+}
+
+// row returns the block values of x block row bx: the bound nearest zero
+// for the empty blocks, 0 for the others.
+func (c *mcCull) row(bx int) ([]float64, error) {
+	if r, ok := c.rows[bx]; ok {
+		return r, nil
+	}
+	// the layers are sampled in order, drop the old rows
+	for k := range c.rows {
+		if k < bx-1 {
+			delete(c.rows, k)
+		}
+	}
+	r := make([]float64, c.ny*c.nz)
+	x0, x1 := mcBlockSpan(c.xs, bx)
+	g := DefaultPool().Group()
+	for by := 0; by < c.ny; by++ {
+		by := by
+		g.Go(func() {
+			y0, y1 := mcBlockSpan(c.ys, by)
+			for bz := 0; bz < c.nz; bz++ {
+				z0, z1 := mcBlockSpan(c.zs, bz)
+				a := sdf.EvaluateInterval(c.s, sdf.Box3{sdf.V3{x0, y0, z0}, sdf.V3{x1, y1, z1}})
+				if a.Min > 0 {
+					r[by*c.nz+bz] = a.Min
+				} else if a.Max < 0 {
+					r[by*c.nz+bz] = a.Max
+				}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	c.rows[bx] = r
+	return r, nil
+}
+
+// value returns the value of lattice point (y, z) for the block rows,
+// or 0 if a block containing it isn't empty.
+func (c *mcCull) value(rows [][]float64, y, z int) float64 {
+	y0, y1 := mcBlockRange(y, len(c.ys)-1)
+	z0, z1 := mcBlockRange(z, len(c.zs)-1)
+	var v float64
+	for _, r := range rows {
+		for by := y0; by <= y1; by++ {
+			for bz := z0; bz <= z1; bz++ {
+				if v = r[by*c.nz+bz]; v == 0 {
+					return 0
+				}
+			}
+		}
+	}
+	return v
+}
+
+// sample evaluates x layer x of the lattice (see mcSampleFunc).
+func (c *mcCull) sample(x int, xs, ys, zs []float64, out []float64) error {
+	x0, x1 := mcBlockRange(x, len(xs)-1)
+	var rows [][]float64
+	for bx := x0; bx <= x1; bx++ {
+		r, err := c.row(bx)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, r)
+	}
+	var p []sdf.V3
+	var idx []int
+	for i, y := range ys {
+		for j, z := range zs {
+			k := i*len(zs) + j
+			if out[k] = c.value(rows, i, j); out[k] == 0 {
+				p = append(p, sdf.V3{xs[x], y, z})
+				idx = append(idx, k)
+			}
+		}
+	}
+	if len(idx) == len(out) {
+		return mcEvaluatePoints(c.s, p, out)
+	}
+	d := make([]float64, len(p))
+	if err := mcEvaluatePoints(c.s, p, d); err != nil {
+		return err
+	}
+	for i, k := range idx {
+		out[k] = d[i]
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
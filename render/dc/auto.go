@@ -0,0 +1,28 @@
+//-----------------------------------------------------------------------------
+/*
+
+Register the dual contouring renderers as candidates for render.Auto.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dc
+
+import (
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+func init() {
+	render.RegisterAutoCandidate(render.AutoCandidate{
+		Name:  "DualContouringV2",
+		Sharp: true,
+		New: func(s sdf.SDF3, meshCells int) render.Render3 {
+			return NewDualContouringScaled(s, meshCells)
+		},
+	})
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,138 @@
+//-----------------------------------------------------------------------------
+/*
+
+Corner Value Cache
+
+The field values at the cell corners are used by up to 8 cells for vertex
+placement and again for triangle generation. They are cached by their
+integer lattice index in a sharded cache that is safe for concurrent use.
+Each shard has a size cap and evicts its least recently used values, so
+memory use is bounded on large grids (evicted values are re-evaluated).
+
+*/
+//-----------------------------------------------------------------------------
+
+package dc
+
+import (
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// dcCacheShards is the number of cache shards (a power of 2).
+const dcCacheShards = 64
+
+// dcDefaultCacheSize is the default maximum number of cached corner values.
+const dcDefaultCacheSize = 1 << 22
+
+// dcCacheEntry is a cached value in the LRU list of a shard.
+type dcCacheEntry struct {
+	key        sdf.V3i
+	value      float64
+	prev, next int32 // LRU list (-1: none)
+}
+
+// dcCacheShard is an LRU cache of corner values.
+type dcCacheShard struct {
+	mu         sync.Mutex
+	index      map[sdf.V3i]int32
+	entries    []dcCacheEntry
+	head, tail int32 // most and least recently used entries
+	capacity   int
+}
+
+// dcCache is a sharded cache of corner values.
+type dcCache struct {
+	shards [dcCacheShards]dcCacheShard
+}
+
+// newDcCache returns a cache for up to size values (<= 0: dcDefaultCacheSize).
+func newDcCache(size int) *dcCache {
+	if size <= 0 {
+		size = dcDefaultCacheSize
+	}
+	c := &dcCache{}
+	for i := range c.shards {
+		sh := &c.shards[i]
+		sh.index = make(map[sdf.V3i]int32)
+		sh.head, sh.tail = -1, -1
+		sh.capacity = dcMaxI(1, size/dcCacheShards)
+	}
+	return c
+}
+
+// shard returns the shard for a key.
+func (c *dcCache) shard(k sdf.V3i) *dcCacheShard {
+	h := uint(k[0]*73856093) ^ uint(k[1]*19349663) ^ uint(k[2]*83492791)
+	return &c.shards[h&(dcCacheShards-1)]
+}
+
+// get returns the cached value for a key.
+func (c *dcCache) get(k sdf.V3i) (float64, bool) {
+	sh := c.shard(k)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	i, ok := sh.index[k]
+	if !ok {
+		return 0, false
+	}
+	sh.unlink(i)
+	sh.pushFront(i)
+	return sh.entries[i].value, true
+}
+
+// set caches the value for a key, evicting the least recently used value of a full shard.
+func (c *dcCache) set(k sdf.V3i, v float64) {
+	sh := c.shard(k)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if _, ok := sh.index[k]; ok {
+		// set concurrently by another goroutine
+		return
+	}
+	var i int32
+	if len(sh.entries) < sh.capacity {
+		i = int32(len(sh.entries))
+		sh.entries = append(sh.entries, dcCacheEntry{})
+	} else {
+		i = sh.tail
+		sh.unlink(i)
+		delete(sh.index, sh.entries[i].key)
+	}
+	sh.entries[i].key, sh.entries[i].value = k, v
+	sh.index[k] = i
+	sh.pushFront(i)
+}
+
+// unlink removes an entry from the LRU list.
+func (sh *dcCacheShard) unlink(i int32) {
+	e := &sh.entries[i]
+	if e.prev >= 0 {
+		sh.entries[e.prev].next = e.next
+	} else {
+		sh.head = e.next
+	}
+	if e.next >= 0 {
+		sh.entries[e.next].prev = e.prev
+	} else {
+		sh.tail = e.prev
+	}
+}
+
+// pushFront adds an entry to the front (most recently used) of the LRU list.
+func (sh *dcCacheShard) pushFront(i int32) {
+	e := &sh.entries[i]
+	e.prev, e.next = -1, sh.head
+	if sh.head >= 0 {
+		sh.entries[sh.head].prev = i
+	}
+	sh.head = i
+	if sh.tail < 0 {
+		sh.tail = i
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,77 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bounding Box Caps
+
+A model that extends past its bounding box (e.g. a slice of a larger model,
+or a bounding box set smaller than the model) is clipped by the render box,
+and the surface is left open where it meets the box.
+
+With the Cap option the field is intersected with the bounding box and the
+render box is a cell larger on each side, so the box planes are contoured
+as flat caps (with sharp edges) and the mesh is closed. The cell size is
+unchanged.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dc
+
+import (
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// dcCapSDF3 is a model intersected with its bounding box, with a larger bounding box.
+type dcCapSDF3 struct {
+	s      sdf.SDF3
+	center sdf.V3 // box center
+	half   sdf.V3 // box half size
+	bb     sdf.Box3
+}
+
+// dcCap returns the capped model and mesh cells for a render of a model with meshCells.
+func dcCap(s sdf.SDF3, meshCells int) (sdf.SDF3, int) {
+	bb := s.BoundingBox()
+	cell := bb.Size().MaxComponent() / float64(meshCells)
+	c := &dcCapSDF3{s: s, center: bb.Center(), half: bb.Size().MulScalar(0.5)}
+	c.bb = sdf.Box3{bb.Min.SubScalar(cell), bb.Max.AddScalar(cell)}
+	if _, ok := s.(sdf.SDF3Interval); ok {
+		return &dcCapIntervalSDF3{c}, meshCells + 2
+	}
+	return c, meshCells + 2
+}
+
+// box returns the distance to the box.
+func (c *dcCapSDF3) box(p sdf.V3) float64 {
+	d := p.Sub(c.center).Abs().Sub(c.half)
+	return d.Max(sdf.V3{}).Length() + math.Min(d.MaxComponent(), 0)
+}
+
+// Evaluate returns the minimum distance to a capped model.
+func (c *dcCapSDF3) Evaluate(p sdf.V3) float64 {
+	return math.Max(c.s.Evaluate(p), c.box(p))
+}
+
+// BoundingBox returns the bounding box of a capped model (a cell larger than the model box).
+func (c *dcCapSDF3) BoundingBox() sdf.Box3 {
+	return c.bb
+}
+
+// dcCapIntervalSDF3 is a capped model with interval evaluation (so the empty blocks are culled).
+type dcCapIntervalSDF3 struct {
+	*dcCapSDF3
+}
+
+// EvaluateInterval returns a bound of the values of a capped model over a box.
+func (c *dcCapIntervalSDF3) EvaluateInterval(b sdf.Box3) sdf.Interval {
+	i := sdf.EvaluateInterval(c.s, b)
+	// the box distance changes by at most the distance from the center
+	d, r := c.box(b.Center()), b.Size().Length()/2
+	return sdf.Interval{math.Max(i.Min, d-r), math.Max(i.Max, d+r)}
+}
+
+//-----------------------------------------------------------------------------
@@ -14,6 +14,7 @@ Based on: https://github.com/nickgildea/DualContouringSample
 package dc
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sort"
@@ -37,6 +38,14 @@ type DualContouringV1 struct {
 	// LockVertices makes sure each vertex stays in its voxel, avoiding small or bad triangles that may be generated
 	// otherwise, but it also may remove some sharp edges.
 	LockVertices bool
+	// Tolerances for normals (nil: derived from the bounding box)
+	Tolerances *sdf.Tolerances
+	// Hints are regions rendered with finer cells. meshCells sets the resolution elsewhere.
+	// Octree dual contouring joins cells of different sizes without cracks.
+	Hints []render.ResolutionHint
+	// Cap intersects the model with its bounding box, so a model clipped by the box gets flat
+	// caps on the box planes (a closed mesh). The render box is a cell larger on each side.
+	Cap bool
 }
 
 // NewDualContouringV1 see DualContouringV1
@@ -46,30 +55,84 @@ func NewDualContouringV1(simplify float64, RCond float64, lockVertices bool) *Du
 
 // Info returns a string describing the rendered volume.
 func (m *DualContouringV1) Info(s sdf.SDF3, meshCells int) string {
+	if m.Cap {
+		s, meshCells = dcCap(s, meshCells)
+	}
 	bbSize := s.BoundingBox().Size()
 	resolution := bbSize.MaxComponent() / float64(meshCells)
-	cells := bbSize.DivScalar(resolution).ToV3i()
+	fine := render.MinHintCellSize(m.Hints, resolution)
+	cells := bbSize.DivScalar(fine).ToV3i()
+	if fine < resolution {
+		return fmt.Sprintf("%dx%dx%d, resolution %.2f (%.2f in hint regions)", cells[0], cells[1], cells[2], resolution, fine)
+	}
 	return fmt.Sprintf("%dx%dx%d, resolution %.2f", cells[0], cells[1], cells[2], resolution)
 }
 
 // Render produces a 3d triangle mesh over the bounding volume of an sdf3.
 func (m *DualContouringV1) Render(s sdf.SDF3, meshCells int, output chan<- *render.Triangle3) {
+	m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *DualContouringV1) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *render.Triangle3) error {
+	node, err := m.octree(ctx, s, meshCells)
+	if err != nil {
+		return err
+	}
+	// Generate the final mesh
+	node.progress.Add(0, int64(node.GenerateMesh(output)))
+	node.progress.Done()
+	return nil
+}
+
+// RenderIndexed produces an indexed mesh over the bounding volume of an sdf3.
+// The vertex normals are the mean of the surface normals at the edge crossings of the vertex cells.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *DualContouringV1) RenderIndexed(ctx context.Context, s sdf.SDF3, meshCells int) (*render.Mesh, error) {
+	node, err := m.octree(ctx, s, meshCells)
+	if err != nil {
+		return nil, err
+	}
+	mesh := node.Mesh()
+	node.progress.Add(0, int64(len(mesh.Faces)))
+	node.progress.Done()
+	return mesh, nil
+}
+
+// octree builds (and simplifies) the octree of an sdf3.
+func (m *DualContouringV1) octree(ctx context.Context, s sdf.SDF3, meshCells int) (*dcOctree, error) {
 	if m.RCond == 0 {
 		m.RCond = 1e-3
 	}
+	if m.Cap {
+		s, meshCells = dcCap(s, meshCells)
+	}
 	// work out the sampling resolution to use
 	bbSize := s.BoundingBox().Size()
 	resolution := bbSize.MaxComponent() / float64(meshCells)
-	cells := bbSize.DivScalar(resolution).ToV3i()
+	cells := bbSize.DivScalar(render.MinHintCellSize(m.Hints, resolution)).ToV3i()
 	// Build the octree
-	dcOctreeRootNode := dcNewOctree(cells, m.RCond, m.LockVertices)
-	dcOctreeRootNode.Populate(s)
+	tol := sdf.ModelTolerances3(s)
+	if m.Tolerances != nil {
+		tol = *m.Tolerances
+	}
+	dcOctreeRootNode := dcNewOctree(cells, m.RCond, m.LockVertices, tol.Normal)
+	if len(m.Hints) != 0 {
+		dcOctreeRootNode.res = &dcResolution{m.Hints, resolution}
+	}
+	dcOctreeRootNode.progress = render.StartProgress(ctx, dcOctreeRootNode.cells())
+	if err := dcOctreeRootNode.Populate(ctx, s); err != nil {
+		return nil, err
+	}
 	// Simplify it
 	if m.Simplify >= 0 {
 		dcOctreeRootNode.Simplify(s, m.Simplify)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 	}
-	// Generate the final mesh
-	dcOctreeRootNode.GenerateMesh(output)
+	return dcOctreeRootNode, nil
 }
 
 //-----------------------------------------------------------------------------
@@ -147,6 +210,15 @@ type dcOctree struct {
 	// Extra parameters
 	rCond        float64
 	lockVertices bool
+	normalEps    float64
+	res          *dcResolution           // adaptive resolution (nil: uniform)
+	progress     *render.ProgressTracker // render progress (nil: none)
+}
+
+// dcResolution is the cell size for adaptive resolution.
+type dcResolution struct {
+	hints  []render.ResolutionHint
+	coarse float64 // cell size outside the hint regions
 }
 
 type dcOctreeDrawInfo struct {
@@ -168,7 +240,7 @@ func nextPowerOfTwo(v int) int {
 }
 
 // dcNewOctree builds the whole octree structure (without simplification) for the given size.
-func dcNewOctree(cellCounts sdf.V3i, rCond float64, lockVertices bool) *dcOctree {
+func dcNewOctree(cellCounts sdf.V3i, rCond float64, lockVertices bool, normalEps float64) *dcOctree {
 	cellCounts = sdf.V3i{ // Need powers of 2 for this algorithm (round-up for more precision)
 		nextPowerOfTwo(cellCounts[0]),
 		nextPowerOfTwo(cellCounts[1]),
@@ -186,11 +258,33 @@ func dcNewOctree(cellCounts sdf.V3i, rCond float64, lockVertices bool) *dcOctree
 		drawInfo:     nil,
 		rCond:        rCond,
 		lockVertices: lockVertices,
+		normalEps:    normalEps,
 	}
 	return rootNode
 }
 
-func (node *dcOctree) Populate(d sdf.SDF3) {
+// dcPopulateTaskSize is the largest octree node populated as a single pool task.
+const dcPopulateTaskSize = 32
+
+// Populate builds the octree nodes and leaves, with subtrees populated in parallel.
+// It returns ctx.Err() if the context is done before the octree is complete, or an error if
+// an evaluation panicked.
+func (node *dcOctree) Populate(ctx context.Context, d sdf.SDF3) error {
+	g := render.DefaultPool().Group()
+	node.populate(ctx, d, g)
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// populate builds the subtree of a node. Subtrees no larger than dcPopulateTaskSize are
+// submitted to the task group (nil: populate serially). Subtrees are skipped once the
+// context is done.
+func (node *dcOctree) populate(ctx context.Context, d sdf.SDF3, g *render.Group) {
+	if ctx.Err() != nil {
+		return
+	}
 	minOffset := node.minOffset
 	meshSize := node.meshSize
 	cellCounts := node.cellCounts
@@ -199,6 +293,7 @@ func (node *dcOctree) Populate(d sdf.SDF3) {
 	if minOffset[0] > (meshSize+cellCounts[0])/2 || maxOffset[0] < (meshSize-cellCounts[0])/2 ||
 		minOffset[1] > (meshSize+cellCounts[1])/2 || maxOffset[1] < (meshSize-cellCounts[1])/2 ||
 		minOffset[2] > (meshSize+cellCounts[2])/2 || maxOffset[2] < (meshSize-cellCounts[2])/2 {
+		node.progress.Add(node.cells(), 0)
 		return
 	}
 	childSize := node.size / 2
@@ -214,27 +309,62 @@ func (node *dcOctree) Populate(d sdf.SDF3) {
 			drawInfo:     nil,
 			rCond:        node.rCond,
 			lockVertices: node.lockVertices,
+			normalEps:    node.normalEps,
+			res:          node.res,
+			progress:     node.progress,
 		}
 		// Recursive children or a leaf node
-		if childSize > 1 {
-			node.children[i].Populate(d)
+		child := node.children[i]
+		if !child.isLeaf(d) {
+			if g == nil {
+				child.populate(ctx, d, nil)
+			} else if childSize <= dcPopulateTaskSize {
+				g.Go(func() { child.populate(ctx, d, nil) })
+			} else {
+				child.populate(ctx, d, g)
+			}
 		} else {
 			node.children[i].computeOctreeLeaf(d)
+			node.progress.Add(child.cells(), 0)
 		}
 	}
 }
 
+// cells returns the number of cells (at the finest resolution) covered by a node.
+func (node *dcOctree) cells() int64 {
+	n := int64(node.size)
+	return n * n * n
+}
+
+// isLeaf returns true if the node is a leaf: a single cell, or small enough for its region.
+func (node *dcOctree) isLeaf(d sdf.SDF3) bool {
+	if node.size == 1 {
+		return true
+	}
+	if node.res == nil {
+		return false
+	}
+	box := sdf.Box3{node.relToSDF(d, node.minOffset), node.relToSDF(d, node.minOffset.AddScalar(node.size))}
+	size := box.Size().MaxComponent()
+	return size <= render.HintCellSize(node.res.hints, box, node.res.coarse)*(1+1e-9)
+}
+
 func (node *dcOctree) relToSDF(d sdf.SDF3, i sdf.V3i) sdf.V3 {
 	bb := d.BoundingBox()
 	return bb.Min.Add(bb.Size().Mul(i.ToV3().DivScalar(float64(node.meshSize)).
 		Div(node.cellCounts.ToV3().DivScalar(float64(node.meshSize)))))
 }
 
+// corner returns the offset of the i-th corner of a node.
+func (node *dcOctree) corner(i int) sdf.V3i {
+	return node.minOffset.Add(dcChildMinOffsets[i].ToV3().MulScalar(float64(node.size)).ToV3i())
+}
+
 // computeOctreeLeaf computes the required leaf information that later will be used for meshing
 func (node *dcOctree) computeOctreeLeaf(d sdf.SDF3) {
 	corners := 0
 	for i := 0; i < 8; i++ {
-		cornerPos := node.relToSDF(d, node.minOffset.Add(dcChildMinOffsets[i]))
+		cornerPos := node.relToSDF(d, node.corner(i))
 		isSolid := d.Evaluate(cornerPos) < 0
 		if isSolid {
 			corners = corners | (1 << i)
@@ -258,10 +388,10 @@ func (node *dcOctree) computeOctreeLeaf(d sdf.SDF3) {
 			// no zero crossing on this edge
 			continue
 		}
-		p1 := node.relToSDF(d, node.minOffset.Add(dcChildMinOffsets[c1]))
-		p2 := node.relToSDF(d, node.minOffset.Add(dcChildMinOffsets[c2]))
+		p1 := node.relToSDF(d, node.corner(c1))
+		p2 := node.relToSDF(d, node.corner(c2))
 		p := dcApproximateZeroCrossingPosition(d, p1, p2)
-		n := dcCalculateSurfaceNormal(d, p)
+		n := dcCalculateSurfaceNormal(d, p, node.normalEps)
 		qefSolver.Add(p, n)
 		normalSum = normalSum.Add(n)
 		edgeCount++
@@ -367,17 +497,18 @@ func (node *dcOctree) Simplify(d sdf.SDF3, threshold float64) {
 	return
 }
 
-func (node *dcOctree) generateVertexIndices(vertexBuffer *[]sdf.V3) {
+func (node *dcOctree) generateVertexIndices(vertexBuffer, normalBuffer *[]sdf.V3) {
 	if node == nil { // Does not contain the surface
 		return
 	}
 	if node.kind == dcOctreeNodeTypeInternal { // Add vertices to children
 		for i := 0; i < 8; i++ {
-			node.children[i].generateVertexIndices(vertexBuffer)
+			node.children[i].generateVertexIndices(vertexBuffer, normalBuffer)
 		}
 	} else { // Leaf or pseudo-leaf node: add one vertex
 		node.drawInfo.index = len(*vertexBuffer)
 		*vertexBuffer = append(*vertexBuffer, node.drawInfo.position)
+		*normalBuffer = append(*normalBuffer, node.drawInfo.averageNormal)
 	}
 }
 
@@ -507,24 +638,44 @@ func dcContourProcessEdge(node [4]*dcOctree, dir int, indexBuffer *[]int) {
 	}
 }
 
-func (node *dcOctree) GenerateMesh(output chan<- *render.Triangle3) {
+// GenerateMesh outputs the triangles of the mesh and returns the number of triangles.
+func (node *dcOctree) GenerateMesh(output chan<- *render.Triangle3) int {
+	m := node.Mesh()
+	for _, t := range m.Triangles() {
+		output <- t
+	}
+	return len(m.Faces)
+}
+
+// Mesh returns the indexed mesh of the octree (without the unused vertices).
+// The quads of the edges shared by cells of different sizes (with a leaf in two of the
+// cells) are a single triangle, the degenerate faces with a repeated vertex are dropped.
+func (node *dcOctree) Mesh() *render.Mesh {
 	vertexBuffer := new([]sdf.V3)
+	normalBuffer := new([]sdf.V3)
 	indexBuffer := new([]int)
 	// Populate buffers
-	node.generateVertexIndices(vertexBuffer)
+	node.generateVertexIndices(vertexBuffer, normalBuffer)
 	node.contourCellProc(indexBuffer)
-	// Return triangles
-	for tri := 0; tri < len(*indexBuffer)/3; tri++ {
-		triangle := &render.Triangle3{
-			V: [3]sdf.V3{
-				(*vertexBuffer)[(*indexBuffer)[tri*3]],
-				(*vertexBuffer)[(*indexBuffer)[tri*3+1]],
-				(*vertexBuffer)[(*indexBuffer)[tri*3+2]],
-			},
+	m := &render.Mesh{Faces: make([][3]int, 0, len(*indexBuffer)/3)}
+	index := make([]int, len(*vertexBuffer)) // mesh vertex index + 1 (0: unused)
+	for i := 0; i+3 <= len(*indexBuffer); i += 3 {
+		f := (*indexBuffer)[i : i+3]
+		if f[0] == f[1] || f[1] == f[2] || f[2] == f[0] {
+			continue
+		}
+		var face [3]int
+		for j, v := range f {
+			if index[v] == 0 {
+				m.Vertices = append(m.Vertices, (*vertexBuffer)[v])
+				m.Normals = append(m.Normals, (*normalBuffer)[v])
+				index[v] = len(m.Vertices)
+			}
+			face[j] = index[v] - 1
 		}
-		//log.Println("Outputting triangle:", triangle)
-		output <- triangle
+		m.Faces = append(m.Faces, face)
 	}
+	return m
 }
 
 // dcQefSolver is used for vertex position estimation (sharp edges!)
@@ -654,11 +805,6 @@ func dcApproximateZeroCrossingPosition(d sdf.SDF3, p0, p1 sdf.V3) sdf.V3 {
 	return p0.Add(p1.Sub(p0).MulScalar(t))
 }
 
-func dcCalculateSurfaceNormal(d sdf.SDF3, p sdf.V3) sdf.V3 {
-	const eps = 0.001
-	return sdf.V3{
-		X: d.Evaluate(p.Add(sdf.V3{X: eps})) - d.Evaluate(p.Add(sdf.V3{X: -eps})),
-		Y: d.Evaluate(p.Add(sdf.V3{Y: eps})) - d.Evaluate(p.Add(sdf.V3{Y: -eps})),
-		Z: d.Evaluate(p.Add(sdf.V3{Z: eps})) - d.Evaluate(p.Add(sdf.V3{Z: -eps})),
-	}.Normalize()
+func dcCalculateSurfaceNormal(d sdf.SDF3, p sdf.V3, eps float64) sdf.V3 {
+	return sdf.Normal3(d, p, eps)
 }
@@ -13,8 +13,8 @@ Based on: https://github.com/emilk/Dual-Contouring/
 package dc
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"math"
 
 	"github.com/deadsy/sdfx/render"
@@ -33,19 +33,29 @@ type DualContouringV2 struct {
 	FarAway float64
 	// CenterPush may generate a better mesh if larger at the cost of less sharp edges.
 	CenterPush float64
+	// QEFTruncation drops the singular values of the vertex QEF smaller than this fraction of the
+	// largest, so the unconstrained directions keep the mean surface point (0: 0.1).
+	QEFTruncation float64
 
 	// see sdf.Raycast3
 	RaycastScaleAndSigmoid, RaycastStepScale, RaycastEpsilon float64
 	// see sdf.Raycast3
 	RaycastMaxSteps int
-
-	// Warnings printed to screen
-	maxCornerDistWarned      bool
-	qefFailedImplWarned      bool
-	qefFailedWarned          bool
-	farAwayWarned            bool
-	faceVertexNotFoundWarned bool
-	raycastFailedWarned      bool
+	// Tolerances for normals and the bounding box (nil: derived from the bounding box)
+	Tolerances *sdf.Tolerances
+	// Manifold places a vertex for each surface patch of a cell (instead of one per cell),
+	// so cells with several surface components don't produce non-manifold meshes.
+	Manifold bool
+	// Workers is the number of goroutines placing vertices (0: render.MaxParallelism()).
+	Workers int
+	// CacheSize is the maximum number of cached corner values (0: 4M values, about 400MB).
+	CacheSize int
+	// Cap intersects the model with its bounding box, so a model clipped by the box gets flat
+	// caps on the box planes (a closed mesh). The render box is a cell larger on each side.
+	Cap bool
+
+	// warnings of the last render
+	report RenderReport
 }
 
 // NewDualContouringDefault uses somewhat safe defaults that sacrifice performance, you may reduce max steps and fix other parameters if facing errors
@@ -53,6 +63,14 @@ func NewDualContouringDefault() *DualContouringV2 {
 	return NewDualContouringV2(0.499999, 0.01, 0, 1, 1e-4, 1000)
 }
 
+// NewDualContouringScaled uses defaults derived from the size of the SDF3 and its cells,
+// so models at very small or very large scales work without tuning.
+func NewDualContouringScaled(s sdf.SDF3, meshCells int) *DualContouringV2 {
+	cellSize := s.BoundingBox().Size().MaxComponent() / float64(meshCells)
+	r := sdf.NewRaycastParams3(s, cellSize)
+	return NewDualContouringV2(0.499999, 0.01, r.ScaleAndSigmoid, r.StepScale, r.Epsilon, r.MaxSteps)
+}
+
 // NewDualContouringV2 see DualContouringV2 and its fields
 func NewDualContouringV2(farAway float64, centerPush float64, raycastScaleAndSigmoid, raycastStepSize float64, raycastEpsilon float64, raycastMaxSteps int) *DualContouringV2 {
 	return &DualContouringV2{
@@ -67,18 +85,114 @@ func NewDualContouringV2(farAway float64, centerPush float64, raycastScaleAndSig
 
 // Info returns a string describing the rendered volume.
 func (dc *DualContouringV2) Info(s sdf.SDF3, meshCells int) string {
+	if dc.Cap {
+		s, meshCells = dcCap(s, meshCells)
+	}
 	resolution, cells := dc.getCells(s, meshCells)
 	return fmt.Sprintf("%dx%dx%d, resolution %.2f", cells[0], cells[1], cells[2], resolution)
 }
 
+// Report returns the warnings of the last render.
+func (dc *DualContouringV2) Report() *RenderReport {
+	r := dc.report
+	return &r
+}
+
 // Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+// The warnings found are in Report.
 func (dc *DualContouringV2) Render(s sdf.SDF3, meshCells int, output chan<- *render.Triangle3) {
+	dc.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (dc *DualContouringV2) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *render.Triangle3) error {
+	var arena render.TriangleArena
+	return dc.render(ctx, s, meshCells, func(vertices, normals []sdf.V3, f [3]int) {
+		output <- arena.New(vertices[f[0]], vertices[f[1]], vertices[f[2]])
+	})
+}
+
+// RenderBatches produces a 3d triangle mesh over the bounding volume of an sdf3, sending
+// the triangles to the output as value batches (see render.RenderBatches).
+// It returns ctx.Err() if the context is done before the render is complete.
+func (dc *DualContouringV2) RenderBatches(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- []render.Triangle3) error {
+	w := render.NewTriangleBatcher(output)
+	err := dc.render(ctx, s, meshCells, func(vertices, normals []sdf.V3, f [3]int) {
+		w.Add(vertices[f[0]], vertices[f[1]], vertices[f[2]])
+	})
+	w.Flush()
+	return err
+}
+
+// RenderIndexed produces an indexed mesh over the bounding volume of an sdf3,
+// with the vertices shared by the faces of the neighbouring cells. The vertex normals
+// are the mean of the surface normals at the edge crossings of the vertex cell.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (dc *DualContouringV2) RenderIndexed(ctx context.Context, s sdf.SDF3, meshCells int) (*render.Mesh, error) {
+	m := &render.Mesh{}
+	var index []int32 // mesh vertex index + 1 of the placed vertices (0: unused)
+	err := dc.render(ctx, s, meshCells, func(vertices, normals []sdf.V3, f [3]int) {
+		if index == nil {
+			index = make([]int32, len(vertices))
+		}
+		var face [3]int
+		for i, v := range f {
+			if index[v] == 0 {
+				m.Vertices = append(m.Vertices, vertices[v])
+				m.Normals = append(m.Normals, normals[v])
+				index[v] = int32(len(m.Vertices))
+			}
+			face[i] = int(index[v]) - 1
+		}
+		m.Faces = append(m.Faces, face)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// render places the vertices and generates the faces (vertex indices, counter-clockwise).
+func (dc *DualContouringV2) render(ctx context.Context, s sdf.SDF3, meshCells int, face func(vertices, normals []sdf.V3, f [3]int)) error {
+	dc.report = RenderReport{}
+	if dc.Cap {
+		s, meshCells = dcCap(s, meshCells)
+	}
 	// Place one vertex for each cellIndex
 	_, cells := dc.getCells(s, meshCells)
-	s2 := &dcSdf{s, map[sdf.V3]float64{}}
-	vertexBuffer, vertexVoxelInfo, vertexVoxelInfoIndexed := dc.placeVertices(s2, cells)
-	// Stitch vertices together generating triangles
-	dc.generateTriangles(s2, vertexBuffer, vertexVoxelInfo, vertexVoxelInfoIndexed, output)
+	tol := sdf.ModelTolerances3(s)
+	if dc.Tolerances != nil {
+		tol = *dc.Tolerances
+	}
+	s2 := newDcSdf(s, tol, cells, dc.CacheSize)
+	// the cells are processed twice: vertex placement and triangle generation
+	s2.layerCells = int64(cells[1] * cells[2])
+	s2.progress = render.StartProgress(ctx, 2*int64(cells[0])*s2.layerCells)
+	var err error
+	if dc.Manifold {
+		vertexBuffer, normals, cellInfo, cellInfoIndexed, perr := dc.placeVerticesManifold(ctx, s2, cells)
+		if perr != nil {
+			return perr
+		}
+		err = dc.generateTrianglesManifold(ctx, s2, vertexBuffer, cellInfo, cellInfoIndexed, func(v []sdf.V3, f [3]int) {
+			face(v, normals, f)
+		})
+	} else {
+		vertexBuffer, normals, vertexVoxelInfo, vertexVoxelInfoIndexed, perr := dc.placeVertices(ctx, s2, cells)
+		if perr != nil {
+			return perr
+		}
+		// Stitch vertices together generating triangles
+		err = dc.generateTriangles(ctx, s2, vertexBuffer, vertexVoxelInfo, vertexVoxelInfoIndexed, func(v []sdf.V3, f [3]int) {
+			face(v, normals, f)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	s2.progress.Done()
+	return nil
 }
 
 func (dc *DualContouringV2) getCells(s sdf.SDF3, meshCells int) (float64, sdf.V3i) {
@@ -93,26 +207,118 @@ func (dc *DualContouringV2) getCells(s sdf.SDF3, meshCells int) (float64, sdf.V3
 
 type dcSdf struct {
 	impl  sdf.SDF3
-	cache map[sdf.V3]float64
+	cache *dcCache
+	tol   sdf.Tolerances
+	// cell lattice
+	origin, cellSize sdf.V3
+	// render progress (nil: none)
+	progress   *render.ProgressTracker
+	layerCells int64 // cells per x layer
+}
+
+func newDcSdf(s sdf.SDF3, tol sdf.Tolerances, cells sdf.V3i, cacheSize int) *dcSdf {
+	d := &dcSdf{impl: s, cache: newDcCache(cacheSize), tol: tol}
+	bb := d.BoundingBox()
+	d.origin, d.cellSize = bb.Min, bb.Size().Div(cells.ToV3())
+	return d
 }
 
-func (d *dcSdf) evaluateCached(p sdf.V3) float64 { // Reduces evaluation cost from 62.8% to 46.3% on cylinder_head
-	res, ok := d.cache[p]
+// evaluateCorner returns the (cached) value at a corner of the cell lattice.
+func (d *dcSdf) evaluateCorner(c sdf.V3i) float64 { // Reduces evaluation cost from 62.8% to 46.3% on cylinder_head
+	res, ok := d.cache.get(c)
 	if ok {
 		return res
 	}
-	res = d.Evaluate(p)
-	d.cache[p] = res
+	res = d.Evaluate(d.origin.Add(d.cellSize.Mul(c.ToV3())))
+	d.cache.set(c, res)
 	return res
 }
 
+// dcCullBlock is the number of cells on the y and z axes of a culled block.
+const dcCullBlock = 8
+
+// cullLayer returns the cells of an x layer of cells (y major) in blocks where the interval of
+// the SDF excludes zero, so they can't contain the surface (nil: SDF3s without interval evaluation,
+// see sdf.SDF3Interval).
+func (d *dcSdf) cullLayer(x int, cells sdf.V3i) []bool {
+	if _, ok := d.impl.(sdf.SDF3Interval); !ok {
+		return nil
+	}
+	culled := make([]bool, cells[1]*cells[2])
+	for y0 := 0; y0 < cells[1]; y0 += dcCullBlock {
+		y1 := dcMinI(y0+dcCullBlock, cells[1])
+		for z0 := 0; z0 < cells[2]; z0 += dcCullBlock {
+			z1 := dcMinI(z0+dcCullBlock, cells[2])
+			b := sdf.Box3{
+				d.origin.Add(d.cellSize.Mul(sdf.V3i{x, y0, z0}.ToV3())),
+				d.origin.Add(d.cellSize.Mul(sdf.V3i{x + 1, y1, z1}.ToV3())),
+			}
+			if a := sdf.EvaluateInterval(d.impl, b); a.Contains(0) {
+				continue
+			}
+			for y := y0; y < y1; y++ {
+				for z := z0; z < z1; z++ {
+					culled[y*cells[2]+z] = true
+				}
+			}
+		}
+	}
+	return culled
+}
+
+// prefetchLayer evaluates the uncached corners of an x layer of cells (less the culled cells,
+// see cullLayer) with a single batch evaluation, for SDF3s with batch evaluation (see sdf.SDF3Batch).
+func (d *dcSdf) prefetchLayer(x int, cells sdf.V3i, culled []bool) {
+	if _, ok := d.impl.(sdf.SDF3Batch); !ok {
+		return
+	}
+	var keys []sdf.V3i
+	var p []sdf.V3
+	for c := (sdf.V3i{x, 0, 0}); c[0] <= x+1; c[0]++ {
+		for c[1] = 0; c[1] <= cells[1]; c[1]++ {
+			for c[2] = 0; c[2] <= cells[2]; c[2]++ {
+				if culled != nil && dcCornerCulled(culled, cells, c[1], c[2]) {
+					continue
+				}
+				if _, ok := d.cache.get(c); !ok {
+					keys = append(keys, c)
+					p = append(p, d.origin.Add(d.cellSize.Mul(c.ToV3())))
+				}
+			}
+		}
+	}
+	out := make([]float64, len(p))
+	sdf.EvaluateN(d.impl, p, out)
+	for i, c := range keys {
+		d.cache.set(c, out[i])
+	}
+}
+
+// dcCornerCulled returns true if the cells of a layer around the corner y, z are culled.
+func dcCornerCulled(culled []bool, cells sdf.V3i, y, z int) bool {
+	for cy := dcMaxI(y-1, 0); cy <= dcMinI(y, cells[1]-1); cy++ {
+		for cz := dcMaxI(z-1, 0); cz <= dcMinI(z, cells[2]-1); cz++ {
+			if !culled[cy*cells[2]+cz] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func (d *dcSdf) Evaluate(p sdf.V3) float64 {
 	return d.impl.Evaluate(p)
 }
 
+func (d *dcSdf) Gradient(p sdf.V3) sdf.V3 {
+	return sdf.Gradient3(d.impl, p, d.tol.Normal)
+}
+
 func (d *dcSdf) BoundingBox() sdf.Box3 {
 	bb := d.impl.BoundingBox()
-	bb.Max = bb.Max.AddScalar(1e-12) // Just in case borders are 0
+	// Just in case borders are 0
+	bb.Min = bb.Min.SubScalar(d.tol.Box)
+	bb.Max = bb.Max.AddScalar(d.tol.Box)
 	return bb
 }
 
@@ -135,6 +341,9 @@ var dcEdges = []sdf.V2i{
 	{6, 7},
 }
 
+// dcAllEdges is the edge mask with all the edges of a cell.
+const dcAllEdges = 1<<12 - 1
+
 var dcFarEdges = []sdf.V2i{
 	{3, 7},
 	{5, 7},
@@ -152,13 +361,61 @@ type dcVoxelInfo struct {
 	bufIndex  int
 	// Cached metadata (could be removed if memory is a problem)
 	cellStart, cellSize sdf.V3
+	// Sign configuration of the cell corners (manifold mode)
+	inside uint8
+}
+
+// dcFlatCellLimit is the largest cell grid with a flat vertex index array (4 bytes per cell).
+const dcFlatCellLimit = 1 << 26
+
+// dcCellMap maps cell indices to vertex indices. It is a flat array over the cell grid,
+// or a map for very large (sparse) grids.
+type dcCellMap struct {
+	cells  sdf.V3i
+	flat   []int32 // vertex index + 1 (0: no vertex)
+	sparse map[sdf.V3i]int
+}
+
+func newDcCellMap(cells sdf.V3i) *dcCellMap {
+	m := &dcCellMap{cells: cells}
+	if n := cells[0] * cells[1] * cells[2]; n <= dcFlatCellLimit {
+		m.flat = make([]int32, n)
+	} else {
+		m.sparse = make(map[sdf.V3i]int, dcMaxI(32, n/100))
+	}
+	return m
+}
+
+// set sets the vertex index for a cell.
+func (m *dcCellMap) set(c sdf.V3i, i int) {
+	if m.flat == nil {
+		m.sparse[c] = i
+		return
+	}
+	m.flat[(c[0]*m.cells[1]+c[1])*m.cells[2]+c[2]] = int32(i + 1)
+}
+
+// get returns the vertex index for a cell, and false if the cell has no vertex.
+func (m *dcCellMap) get(c sdf.V3i) (int, bool) {
+	if m.flat == nil {
+		i, ok := m.sparse[c]
+		return i, ok
+	}
+	if c[0] >= m.cells[0] || c[1] >= m.cells[1] || c[2] >= m.cells[2] {
+		return 0, false
+	}
+	i := m.flat[(c[0]*m.cells[1]+c[1])*m.cells[2]+c[2]]
+	return int(i) - 1, i != 0
 }
 
-func (dc *DualContouringV2) placeVertices(s *dcSdf, cells sdf.V3i) (buf []sdf.V3, bufMap []*dcVoxelInfo, bufMapIndexed map[sdf.V3i]*dcVoxelInfo) {
-	// Start with big enough buffers for performance avoiding allocations (but not too big, may expand later)
-	buf = make([]sdf.V3, 0, dcMaxI(32, cells[0]*cells[1]*cells[2]/100))
-	bufMap = make([]*dcVoxelInfo, 0, dcMaxI(32, cells[0]*cells[1]*cells[2]/100))
-	bufMapIndexed = make(map[sdf.V3i]*dcVoxelInfo, dcMaxI(32, cells[0]*cells[1]*cells[2]/100))
+// placeVertices returns the vertices, their normals, the voxel info for each vertex (stored by value
+// to avoid per-voxel allocations) and the vertex index for each cell index.
+func (dc *DualContouringV2) placeVertices(ctx context.Context, s *dcSdf, cells sdf.V3i) (buf, normals []sdf.V3, bufMap []dcVoxelInfo, bufMapIndexed *dcCellMap, err error) {
+	return dc.placeSlabs(ctx, s, cells, (*DualContouringV2).placeVerticesSlab)
+}
+
+// placeVerticesSlab places the vertices of the cells in a slab.
+func (dc *DualContouringV2) placeVerticesSlab(ctx context.Context, s *dcSdf, cells sdf.V3i, x0, x1 int, slab *dcSlab) {
 	// Other pre-allocated vertex placing buffers
 	normals := make([]sdf.V3, 0, 11)
 	planeDs := make([]float64, 0, 11)
@@ -167,42 +424,124 @@ func (dc *DualContouringV2) placeVertices(s *dcSdf, cells sdf.V3i) (buf []sdf.V3
 	cellSize := bb.Size().Div(cells.ToV3())
 	cellSizeHalf := cellSize.DivScalar(2)
 	cellIndex := sdf.V3i{}
-	// Iterate over all cells (could be parallelized, synchronizing on each vertex positioned)
-	for cellIndex[0] = 0; cellIndex[0] < cells[0]; cellIndex[0]++ {
+	for cellIndex[0] = x0; cellIndex[0] < x1; cellIndex[0]++ {
+		if slab.err = ctx.Err(); slab.err != nil {
+			return
+		}
+		culled := s.cullLayer(cellIndex[0], cells)
+		s.prefetchLayer(cellIndex[0], cells, culled)
 		for cellIndex[1] = 0; cellIndex[1] < cells[1]; cellIndex[1]++ {
 			for cellIndex[2] = 0; cellIndex[2] < cells[2]; cellIndex[2]++ {
+				if culled != nil && culled[cellIndex[1]*cells[2]+cellIndex[2]] {
+					continue
+				}
 				// Generate each vertex (if the surface crosses the voxel)
 				cellStart := bb.Min.Add(cellSize.Mul(cellIndex.ToV3()))
 				cellCenter := cellStart.Add(cellSizeHalf)
-				vertexPos := dc.placeVertex(s, cellStart, cellCenter, cellSize, normals[:0], planeDs[:0])
+				inside := dc.computeCornersInside(s, cellIndex)
+				vertexPos, vertexNormal := dc.placeVertex(s, cellStart, cellCenter, cellSize, inside, dcAllEdges, normals[:0], planeDs[:0])
 				if !math.IsInf(vertexPos.X, 0) {
-					bufIndex := len(buf)
-					buf = append(buf, vertexPos)
-					info := &dcVoxelInfo{
+					slab.info = append(slab.info, dcVoxelInfo{
 						cellIndex: cellIndex,
-						bufIndex:  bufIndex,
+						bufIndex:  len(slab.buf),
 						cellStart: cellStart,
 						cellSize:  cellSize,
-					}
-					bufMapIndexed[cellIndex] = info
-					bufMap = append(bufMap, info)
-					bufIndex++
+					})
+					slab.buf = append(slab.buf, vertexPos)
+					slab.normals = append(slab.normals, vertexNormal)
 				}
 			}
 		}
+		s.progress.Add(s.layerCells, 0)
+	}
+}
+
+// dcSlab holds the vertices placed in a slab of cells (x0 <= x < x1), with vertex indices within the slab.
+type dcSlab struct {
+	buf     []sdf.V3
+	normals []sdf.V3 // mean surface normal of each vertex
+	info    []dcVoxelInfo
+	err     error // ctx.Err() if the slab is incomplete
+}
+
+// dcSlabsPerWorker is the number of slabs per worker, to balance slabs with different surface areas.
+const dcSlabsPerWorker = 4
+
+// placeSlabs places the vertices of the cells in slabs along x. The slabs are placed in parallel,
+// each with a copy of the renderer (for the warnings), and they are merged in order so the
+// result is the same as a serial placement. It returns ctx.Err() if the context is done
+// before all the slabs are placed.
+func (dc *DualContouringV2) placeSlabs(ctx context.Context, s *dcSdf, cells sdf.V3i,
+	place func(dc *DualContouringV2, ctx context.Context, s *dcSdf, cells sdf.V3i, x0, x1 int, slab *dcSlab)) (buf, normals []sdf.V3, info []dcVoxelInfo, infoIndexed *dcCellMap, err error) {
+	workers := dc.Workers
+	if workers <= 0 {
+		workers = render.MaxParallelism()
+	}
+	n := dcMinI(workers*dcSlabsPerWorker, cells[0])
+	slabs := make([]dcSlab, n)
+	if workers == 1 || n <= 1 {
+		slabs = slabs[:1]
+		place(dc, ctx, s, cells, 0, cells[0], &slabs[0])
+	} else {
+		copies := make([]DualContouringV2, n)
+		p := render.NewPool(workers)
+		g := p.Group()
+		for i := range slabs {
+			i := i
+			copies[i] = *dc
+			copies[i].report = RenderReport{}
+			g.Go(func() {
+				place(&copies[i], ctx, s, cells, i*cells[0]/n, (i+1)*cells[0]/n, &slabs[i])
+			})
+		}
+		err := g.Wait()
+		p.Close()
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		for i := range copies {
+			dc.report.merge(&copies[i].report)
+		}
+	}
+	// merge the slabs
+	total := 0
+	for i := range slabs {
+		if slabs[i].err != nil {
+			return nil, nil, nil, nil, slabs[i].err
+		}
+		total += len(slabs[i].buf)
+	}
+	buf = make([]sdf.V3, 0, dcMaxI(32, total))
+	normals = make([]sdf.V3, 0, dcMaxI(32, total))
+	info = make([]dcVoxelInfo, 0, dcMaxI(32, total))
+	infoIndexed = newDcCellMap(cells)
+	for i := range slabs {
+		ofs := len(buf)
+		buf = append(buf, slabs[i].buf...)
+		normals = append(normals, slabs[i].normals...)
+		for _, vi := range slabs[i].info {
+			vi.bufIndex += ofs
+			infoIndexed.set(vi.cellIndex, vi.bufIndex)
+			info = append(info, vi)
+		}
 	}
 	return
 }
 
-func (dc *DualContouringV2) placeVertex(s *dcSdf, cellStart, cellCenter, cellSize sdf.V3, normals []sdf.V3, planeDs []float64) sdf.V3 {
-	inside := dc.computeCornersInside(s, cellStart, cellSize)
+// placeVertex places the vertex of a cell from the surface crossings of the edges in edgeMask (bit i: dcEdges[i]).
+func (dc *DualContouringV2) placeVertex(s *dcSdf, cellStart, cellCenter, cellSize sdf.V3, inside uint8, edgeMask uint16, normals []sdf.V3, planeDs []float64) (sdf.V3, sdf.V3) {
 	if inside == 0 || inside == math.MaxUint8 {
 		// voxel is fully inside or outside the volume: no vertex to place
-		return sdf.V3{X: math.Inf(1)}
+		return sdf.V3{X: math.Inf(1)}, sdf.V3{}
 	}
 
 	//// Add candidate planes from all surface-crossing edges (using the surface point on the edge)
-	for _, edge := range dcEdges { // Use edges instead of corners to generate less positions and normals.
+	// mean of the surface points
+	var massPoint sdf.V3
+	for ei, edge := range dcEdges { // Use edges instead of corners to generate less positions and normals.
+		if edgeMask&(1<<uint(ei)) == 0 {
+			continue
+		}
 		if ((inside >> edge[0]) & 1) == ((inside >> edge[1]) & 1) { // Not crossing edge
 			continue
 		}
@@ -212,16 +551,14 @@ func (dc *DualContouringV2) placeVertex(s *dcSdf, cellStart, cellCenter, cellSiz
 		//edgeSurfPos := dcApproximateZeroCrossingPosition(s, cornerPos1, cornerPos2)
 		dir := cornerPos2.Sub(cornerPos1)
 		dirLength := dir.Length()
-		edgeSurfPos, t, steps := sdf.Raycast3(s, cornerPos1, dir, dc.RaycastScaleAndSigmoid, dc.RaycastStepScale,
+		edgeSurfPos, t, _ := sdf.Raycast3(s, cornerPos1, dir, dc.RaycastScaleAndSigmoid, dc.RaycastStepScale,
 			dc.RaycastEpsilon, dirLength*2, dc.RaycastMaxSteps)
 		if t < 0 || t > dirLength {
-			if !dc.raycastFailedWarned {
-				log.Println("[DualContouringV1] WARNING: raycast failed (steps:", steps, "- try modifying options), using fallback low accuracy implementation")
-				dc.raycastFailedWarned = true
-			}
+			dc.report.add(WarningRaycastFailed, cellCenter)
 			edgeSurfPos = dcApproximateZeroCrossingPosition(s, cornerPos1, cornerPos2)
 		}
-		edgeSurfNormal := sdf.Normal3(s, edgeSurfPos, 1e-3)
+		massPoint = massPoint.Add(edgeSurfPos)
+		edgeSurfNormal := s.tol.Normal3(s, edgeSurfPos)
 		normals = append(normals, edgeSurfNormal)
 		planeDs = append(planeDs, edgeSurfNormal.Dot(edgeSurfPos) /* - s.Evaluate(edgeSurfPos): 0.0 */)
 		if len(normals) == 6 {
@@ -235,22 +572,31 @@ func (dc *DualContouringV2) placeVertex(s *dcSdf, cellStart, cellCenter, cellSiz
 	 We could do only as needed (when lastSquared have failed once),
 	 but the push is so weak that it makes little difference to the precision of the model.
 	*/
+	massPoint = massPoint.DivScalar(float64(len(normals)))
+	// the smoothed vertex normal is the mean of the surface normals
+	var vertexNormal sdf.V3
+	for _, n := range normals {
+		vertexNormal = vertexNormal.Add(n)
+	}
+	vertexNormal = vertexNormal.Normalize()
+	pushCenter := cellCenter
+	if dc.Manifold {
+		// the vertices of the patches in a cell are pushed apart, towards their own surface points
+		pushCenter = massPoint
+	}
 	for _, axis := range dcAxes {
 		normal := axis.MulScalar(dc.CenterPush)
 		//positions = append(positions, cellCenter)
-		planeDs = append(planeDs, normal.Dot(cellCenter))
+		planeDs = append(planeDs, normal.Dot(pushCenter))
 		normals = append(normals, normal)
 	}
 
 	// Now actually compute the vertex from all planes (corner normals and planeDs) collected
-	vertexPos := dc.computeVertexPos(normals, planeDs)
+	vertexPos := dc.computeVertexPos(normals, planeDs, massPoint)
 
 	// Check if vertex positioning failed
 	if math.IsInf(vertexPos.X, 0) {
-		if !dc.qefFailedWarned {
-			log.Println("[DualContouringV1] WARNING: vertex positioning failed, centering vertex position!")
-			dc.qefFailedWarned = true
-		}
+		dc.report.add(WarningVertexFailed, cellCenter)
 		vertexPos = cellCenter
 	}
 
@@ -258,22 +604,23 @@ func (dc *DualContouringV2) placeVertex(s *dcSdf, cellStart, cellCenter, cellSiz
 	if math.Abs(vertexPos.X-cellCenter.X) > dc.FarAway*cellSize.X || // Using manhattan distance (0.5 equals in the same voxel)
 		math.Abs(vertexPos.Y-cellCenter.Y) > dc.FarAway*cellSize.Y ||
 		math.Abs(vertexPos.Z-cellCenter.Z) > dc.FarAway*cellSize.Z {
-		if !dc.farAwayWarned {
-			log.Print("[DualContouringV1] WARNING: generated a vertex two far away from voxel (by ",
-				vertexPos.Sub(cellCenter), ", from ", cellCenter, " to ", vertexPos, "), clamping vertex position!\n")
-			dc.farAwayWarned = true
+		dc.report.add(WarningFarAway, cellCenter)
+		if dc.Manifold {
+			// clamping may join the vertices of the patches in a cell
+			vertexPos = massPoint
+		} else {
+			vertexPos = vertexPos.Clamp(cellStart, cellStart.Add(cellSize)) // Just clamp
 		}
-		vertexPos = vertexPos.Clamp(cellStart, cellStart.Add(cellSize)) // Just clamp
 	}
 
-	return vertexPos
+	return vertexPos, vertexNormal
 }
 
-func (dc *DualContouringV2) computeCornersInside(s *dcSdf, cellStart sdf.V3, cellSize sdf.V3) uint8 {
+func (dc *DualContouringV2) computeCornersInside(s *dcSdf, cellIndex sdf.V3i) uint8 {
 	// Check each corner and store if they are inside or outside the surface in the bit set
 	inside := uint8(0)
 	for i, corner := range dcCorners {
-		isSolid := s.evaluateCached(cellStart.Add(corner.Mul(cellSize))) < 0
+		isSolid := s.evaluateCorner(cellIndex.Add(corner.ToV3i())) < 0
 		if isSolid {
 			inside = inside | (1 << i)
 		}
@@ -281,12 +628,19 @@ func (dc *DualContouringV2) computeCornersInside(s *dcSdf, cellStart sdf.V3, cel
 	return inside
 }
 
-func (dc *DualContouringV2) generateTriangles(s *dcSdf, vertices []sdf.V3, info []*dcVoxelInfo, infoI map[sdf.V3i]*dcVoxelInfo, output chan<- *render.Triangle3) {
-	for _, voxelInfo := range info {
+// generateTriangles connects the vertices around each crossed edge. It returns ctx.Err() if
+// the context is done before all the x layers of cells are connected.
+func (dc *DualContouringV2) generateTriangles(ctx context.Context, s *dcSdf, vertices []sdf.V3, info []dcVoxelInfo, infoI *dcCellMap, face func([]sdf.V3, [3]int)) error {
+	var triangles int64
+	for i := range info {
+		if err := dcLayerErr(ctx, s, info, i, &triangles); err != nil {
+			return err
+		}
+		voxelInfo := &info[i]
 		v0 := voxelInfo.bufIndex // v0 is the vertex (index) of this voxel, which will be connected to others
 		cellIndex := voxelInfo.cellIndex
 
-		inside := dc.computeCornersInside(s, voxelInfo.cellStart, voxelInfo.cellSize)
+		inside := dc.computeCornersInside(s, cellIndex)
 
 		// Connect to triangles in the 3 main axes (two triangles each, if crossing the surface)
 		for ai := 0; ai < 3; ai++ {
@@ -296,60 +650,67 @@ func (dc *DualContouringV2) generateTriangles(s *dcSdf, vertices []sdf.V3, info
 			}
 
 			// Get other vertices for triangle generation
-			var v1, v2, v3 *dcVoxelInfo
+			var v1, v2, v3 int
+			var ok1, ok2, ok3 bool
 			if ai == 0 {
-				v1, _ = infoI[cellIndex.Add(sdf.V3i{0, 0, 1})]
-				v2, _ = infoI[cellIndex.Add(sdf.V3i{0, 1, 0})]
-				v3, _ = infoI[cellIndex.Add(sdf.V3i{0, 1, 1})]
+				v1, ok1 = infoI.get(cellIndex.Add(sdf.V3i{0, 0, 1}))
+				v2, ok2 = infoI.get(cellIndex.Add(sdf.V3i{0, 1, 0}))
+				v3, ok3 = infoI.get(cellIndex.Add(sdf.V3i{0, 1, 1}))
 			} else if ai == 1 {
-				v1, _ = infoI[cellIndex.Add(sdf.V3i{0, 0, 1})]
-				v2, _ = infoI[cellIndex.Add(sdf.V3i{1, 0, 0})]
-				v3, _ = infoI[cellIndex.Add(sdf.V3i{1, 0, 1})]
+				v1, ok1 = infoI.get(cellIndex.Add(sdf.V3i{0, 0, 1}))
+				v2, ok2 = infoI.get(cellIndex.Add(sdf.V3i{1, 0, 0}))
+				v3, ok3 = infoI.get(cellIndex.Add(sdf.V3i{1, 0, 1}))
 			} else {
-				v1, _ = infoI[cellIndex.Add(sdf.V3i{0, 1, 0})]
-				v2, _ = infoI[cellIndex.Add(sdf.V3i{1, 0, 0})]
-				v3, _ = infoI[cellIndex.Add(sdf.V3i{1, 1, 0})]
+				v1, ok1 = infoI.get(cellIndex.Add(sdf.V3i{0, 1, 0}))
+				v2, ok2 = infoI.get(cellIndex.Add(sdf.V3i{1, 0, 0}))
+				v3, ok3 = infoI.get(cellIndex.Add(sdf.V3i{1, 1, 0}))
 			}
 
-			if v1 == nil || v2 == nil || v3 == nil { // Shouldn't ever happen
-				if !dc.faceVertexNotFoundWarned {
-					log.Println("[DualContouringV1] WARNING: no vertex found for completing face, there will be holes")
-					dc.faceVertexNotFoundWarned = true
-				}
+			if !ok1 || !ok2 || !ok3 { // Shouldn't ever happen
+				dc.report.add(WarningHole, voxelInfo.cellStart.Add(voxelInfo.cellSize.MulScalar(0.5)))
 				continue
 			}
 
-			// Define triangles
-			t0 := &render.Triangle3{V: [3]sdf.V3{vertices[v0], vertices[v1.bufIndex], vertices[v3.bufIndex]}}
-			t1 := &render.Triangle3{V: [3]sdf.V3{vertices[v0], vertices[v3.bufIndex], vertices[v2.bufIndex]}}
-
-			// Get the normals right:
-			if ((inside >> edge[0]) & 1) != uint8(ai&1) { // xor
-				t0 = dcFlip(t0)
-				t1 = dcFlip(t1)
-			}
-
-			// Output built triangles (if not degenerate)
-			if !t0.Degenerate(0) {
-				output <- t0
-			}
-			if !t1.Degenerate(0) {
-				output <- t1
-			}
+			// Define triangles, get the normals right
+			flip := ((inside >> edge[0]) & 1) != uint8(ai&1) // xor
+			triangles += dcQuad(vertices, [4]int{v0, v1, v2, v3}, flip, face)
 		}
 	}
+	s.progress.Add(0, triangles)
+	return nil
+}
+
+// dcLayerErr returns ctx.Err() at the first cell of each x layer of the (x ordered) cell info.
+// The cells of the previous layers and the triangles generated for them are counted as processed.
+func dcLayerErr(ctx context.Context, s *dcSdf, info []dcVoxelInfo, i int, triangles *int64) error {
+	if i != 0 && info[i].cellIndex[0] == info[i-1].cellIndex[0] {
+		return nil
+	}
+	x0 := 0
+	if i != 0 {
+		x0 = info[i-1].cellIndex[0]
+	}
+	s.progress.Add(int64(info[i].cellIndex[0]-x0)*s.layerCells, *triangles)
+	*triangles = 0
+	return ctx.Err()
 }
 
 //-----------------------------------------------------------------------------
 // VERTEX POSITION SOLVER
 //-----------------------------------------------------------------------------
 
-func (dc *DualContouringV2) computeVertexPos(normals []sdf.V3, planeDs []float64) sdf.V3 {
+func (dc *DualContouringV2) computeVertexPos(normals []sdf.V3, planeDs []float64, massPoint sdf.V3) sdf.V3 {
 	// ### 1. Minecraft-like voxels
 	//return cellCenter
-	// ### 2. Solve using least squares
-	return dc.leastSquares(normals, planeDs)
-	// ### 3. Solve using least squares (gonum)
+	// ### 2. Solve using SVD about the mass point
+	truncation := dc.QEFTruncation
+	if truncation <= 0 {
+		truncation = dcQEFTruncation
+	}
+	return solveQEF(normals, planeDs, massPoint, truncation)
+	// ### 3. Solve using least squares (fails for degenerate plane sets)
+	//return dc.leastSquares(normals, planeDs)
+	// ### 4. Solve using least squares (gonum)
 	//A := mat.NewDense(len(normals), 3, nil)
 	//b := mat.NewVecDense(len(planeDs), nil)
 	//for row, normal := range normals {
@@ -361,10 +722,7 @@ func (dc *DualContouringV2) computeVertexPos(normals []sdf.V3, planeDs []float64
 	//res := &mat.Dense{}
 	//err := res.Solve(A, b)
 	//if err != nil {
-	//	if !dc.qefFailedImplWarned {
-	//		log.Println("[DualContouringV1] WARNING: QEF solver failed: ", err.Error())
-	//		dc.qefFailedImplWarned = true
-	//	}
+	//	dc.report.add(WarningSingular, sdf.V3{})
 	//	return sdf.V3{X: math.Inf(1)}
 	//}
 	//return sdf.V3{X: res.At(0, 0), Y: res.At(1, 0), Z: res.At(2, 0)}
@@ -0,0 +1,159 @@
+//-----------------------------------------------------------------------------
+/*
+
+Dual Contouring Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package dc
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// checkClosed checks that every directed edge of a mesh is matched by its reverse.
+func checkClosed(t *testing.T, name string, m *render.Mesh) {
+	t.Helper()
+	if len(m.Faces) == 0 {
+		t.Fatalf("%s: no faces", name)
+	}
+	edges := make(map[[2]int]int)
+	for _, f := range m.Faces {
+		for i := 0; i < 3; i++ {
+			edges[[2]int{f[i], f[(i+1)%3]}]++
+		}
+	}
+	for e, n := range edges {
+		if n != 1 || edges[[2]int{e[1], e[0]}] != 1 {
+			t.Fatalf("%s: edge %v is in %d faces, the reverse edge in %d", name, e, n, edges[[2]int{e[1], e[0]}])
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_DualContouring(t *testing.T) {
+	box, _ := sdf.Box3D(sdf.V3{2, 1, 1}, 0)
+	sphere, _ := sdf.Sphere3D(1)
+	models := []struct {
+		name   string
+		s      sdf.SDF3
+		volume float64
+	}{
+		{"box", box, 2},
+		{"sphere", sphere, 4.0 / 3 * math.Pi},
+	}
+	for _, v := range models {
+		renderers := []struct {
+			name string
+			r    interface {
+				RenderIndexed(ctx context.Context, s sdf.SDF3, meshCells int) (*render.Mesh, error)
+			}
+		}{
+			{"v1", NewDualContouringV1(0, 0.1, false)},
+			{"v2", NewDualContouringDefault()},
+		}
+		for _, r := range renderers {
+			m, err := r.r.RenderIndexed(context.Background(), v.s, 32)
+			if err != nil {
+				t.Fatalf("%s %s: %v", r.name, v.name, err)
+			}
+			mp, err := render.MeshMassProperties(m.Triangles(), 1)
+			if err != nil {
+				t.Fatalf("%s %s: %v", r.name, v.name, err)
+			}
+			if math.Abs(mp.Volume-v.volume) > 0.03*v.volume {
+				t.Errorf("%s %s: expected volume %g, actual %g", r.name, v.name, v.volume, mp.Volume)
+			}
+		}
+	}
+}
+
+func Test_DualContouringHints(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	region, _ := sdf.Sphere3D(0.5)
+	region = sdf.Transform3D(region, sdf.Translate3d(sdf.V3{1, 0, 0}))
+	// cells of 1/8 are 1/32 in the region
+	r := NewDualContouringV1(-1, 0, false)
+	r.Hints = []render.ResolutionHint{{region, 1.0 / 32}}
+	m, err := r.RenderIndexed(context.Background(), sphere, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closed across the fine/coarse boundary
+	checkClosed(t, "hints", m)
+	edges := make(map[[2]int]bool)
+	for _, f := range m.Faces {
+		for i := 0; i < 3; i++ {
+			edges[[2]int{f[i], f[(i+1)%3]}] = true
+		}
+	}
+	// finer in the region: the mean edge length is about 4 times smaller
+	var length [2]float64
+	var count [2]int
+	for e := range edges {
+		p0, p1 := m.Vertices[e[0]], m.Vertices[e[1]]
+		i := 0
+		if region.Evaluate(p0.Add(p1).MulScalar(0.5)) < -0.1 {
+			i = 1
+		} else if region.Evaluate(p0.Add(p1).MulScalar(0.5)) < 0.1 {
+			continue
+		}
+		length[i] += p1.Sub(p0).Length()
+		count[i]++
+	}
+	coarse, fine := length[0]/float64(count[0]), length[1]/float64(count[1])
+	if count[1] == 0 || fine > 0.4*coarse {
+		t.Errorf("expected finer edges in the region, actual %g (%d) vs %g (%d)", fine, count[1], coarse, count[0])
+	}
+	mp, _ := render.MeshMassProperties(m.Triangles(), 1)
+	if math.Abs(mp.Volume-4.0/3*math.Pi) > 0.03*4.0/3*math.Pi {
+		t.Errorf("expected volume %g, actual %g", 4.0/3*math.Pi, mp.Volume)
+	}
+}
+
+func Test_DualContouringManifold(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	box, _ := sdf.Box3D(sdf.V3{1.9, 1.05, 0.95}, 0)
+	box = sdf.Transform3D(box, sdf.Translate3d(sdf.V3{0.013, 0.021, 0.007}))
+	// two boxes sharing an edge (off the lattice): the cells on the edge have diagonally
+	// opposite inside corners, so plain dual contouring joins the boxes there
+	c0, _ := sdf.Box3D(sdf.V3{1, 1, 1}, 0)
+	c1, _ := sdf.Box3D(sdf.V3{0.97, 0.97, 1}, 0)
+	cubes := sdf.Union3D(sdf.Transform3D(c0, sdf.Translate3d(sdf.V3{0.5, 0.5, 0})), sdf.Transform3D(c1, sdf.Translate3d(sdf.V3{-0.485, -0.485, 0})))
+	models := []struct {
+		name string
+		s    sdf.SDF3
+	}{
+		{"sphere", sphere},
+		{"box", box},
+		{"cubes", cubes},
+	}
+	for _, v := range models {
+		r := NewDualContouringDefault()
+		r.Manifold = true
+		m, err := r.RenderIndexed(context.Background(), v.s, 32)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		checkClosed(t, v.name, m)
+		// the vertices are on the surface (to a fraction of a cell)
+		cell := v.s.BoundingBox().Size().MaxComponent() / 32
+		for _, p := range m.Vertices {
+			if d := v.s.Evaluate(p); math.Abs(d) > 0.05*cell {
+				t.Errorf("%s: vertex %v is %g from the surface", v.name, p, d)
+				break
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
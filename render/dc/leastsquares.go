@@ -1,7 +1,6 @@
 package dc
 
 import (
-	"log"
 	"math"
 
 	"github.com/deadsy/sdfx/sdf"
@@ -18,10 +17,7 @@ func (dc *DualContouringV2) solve3x3(A []sdf.V3, b []float64) sdf.V3 {
 		A[1].X, A[1].Y, A[1].Z,
 		A[2].X, A[2].Y, A[2].Z)
 	if math.Abs(det) <= 1e-12 {
-		if !dc.qefFailedImplWarned {
-			log.Println("[DualContouringV1] WARNING: Oh-oh - small determinant:", det)
-			dc.qefFailedImplWarned = true
-		}
+		dc.report.add(WarningSingular, sdf.V3{})
 		return sdf.V3{X: math.Inf(1)}
 	}
 	return sdf.V3{
@@ -65,3 +61,86 @@ func (dc *DualContouringV2) leastSquares(A []sdf.V3, b []float64) sdf.V3 {
 	}
 	return dc.solve3x3(AtA[:], Atb[:])
 }
+
+//-----------------------------------------------------------------------------
+// QEF solver (SVD with singular value truncation)
+
+// dcQEFTruncation is the default singular value truncation of the QEF solver (relative to the largest).
+const dcQEFTruncation = 0.1
+
+// dcSymEigen returns the eigenvalues and eigenvectors (columns of v) of a symmetric 3x3 matrix (Jacobi rotations).
+func dcSymEigen(a [3][3]float64) ([3]float64, [3][3]float64) {
+	v := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 16; sweep++ {
+		off := a[0][1]*a[0][1] + a[0][2]*a[0][2] + a[1][2]*a[1][2]
+		if off < 1e-30 {
+			break
+		}
+		for _, pq := range [3][2]int{{0, 1}, {0, 2}, {1, 2}} {
+			p, q := pq[0], pq[1]
+			if a[p][q] == 0 {
+				continue
+			}
+			// rotation zeroing a[p][q]
+			theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+			t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+			if theta < 0 {
+				t = -t
+			}
+			c := 1 / math.Sqrt(t*t+1)
+			s := t * c
+			for k := 0; k < 3; k++ {
+				akp, akq := a[k][p], a[k][q]
+				a[k][p], a[k][q] = c*akp-s*akq, s*akp+c*akq
+			}
+			for k := 0; k < 3; k++ {
+				apk, aqk := a[p][k], a[q][k]
+				a[p][k], a[q][k] = c*apk-s*aqk, s*apk+c*aqk
+			}
+			for k := 0; k < 3; k++ {
+				vkp, vkq := v[k][p], v[k][q]
+				v[k][p], v[k][q] = c*vkp-s*vkq, s*vkp+c*vkq
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, v
+}
+
+// solveQEF returns the point minimizing the sum of the squared distances to the planes
+// (A[i] . x = b[i]) nearest to the mass point. The QEF is solved about the mass point with
+// the pseudo-inverse of A^T A: the singular values smaller than a fraction (truncation) of the
+// largest are dropped, so the directions the planes don't constrain (flat or edge-like plane sets)
+// stay at the mass point instead of being ill-conditioned.
+func solveQEF(A []sdf.V3, b []float64, massPoint sdf.V3, truncation float64) sdf.V3 {
+	var ata [3][3]float64
+	var atr [3]float64 // A^T (b - A * massPoint)
+	for k, n := range A {
+		r := b[k] - n.Dot(massPoint)
+		nv := [3]float64{n.X, n.Y, n.Z}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				ata[i][j] += nv[i] * nv[j]
+			}
+			atr[i] += nv[i] * r
+		}
+	}
+	// A^T A = V S^2 V^T, the eigenvalues are the squared singular values of A
+	e, v := dcSymEigen(ata)
+	eMax := math.Max(e[0], math.Max(e[1], e[2]))
+	if !(eMax > 0) {
+		return massPoint
+	}
+	limit := truncation * truncation * eMax
+	var dx [3]float64
+	for j := 0; j < 3; j++ {
+		if e[j] <= limit {
+			continue
+		}
+		// component along eigenvector j
+		c := (v[0][j]*atr[0] + v[1][j]*atr[1] + v[2][j]*atr[2]) / e[j]
+		for i := 0; i < 3; i++ {
+			dx[i] += c * v[i][j]
+		}
+	}
+	return massPoint.Add(sdf.V3{dx[0], dx[1], dx[2]})
+}
@@ -0,0 +1,259 @@
+//-----------------------------------------------------------------------------
+/*
+
+Manifold Dual Contouring
+
+Plain dual contouring places one vertex per cell, so a cell crossed by
+more than one surface component (e.g. two thin walls, or diagonally
+opposite corners inside) joins the components at a single vertex and the
+mesh is non-manifold there.
+
+In manifold mode each cell has one vertex per surface patch. The patches
+of a sign configuration are the loops of crossed edges around the cell
+faces: two crossed edges of a face are on the same loop if the face
+contour joins them. Faces with diagonally opposite inside corners are
+always split around the inside corners, so neighbouring cells agree on
+the contours of their shared face and the quads join up into a closed
+mesh. Each vertex is placed from the crossings of its own patch only.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dc
+
+import (
+	"context"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// dcPatches is the patch table of a sign configuration.
+type dcPatches struct {
+	n     int      // number of patches
+	patch [12]int8 // patch of each edge (-1: not crossed)
+}
+
+// dcPatchTable gives the surface patches for each sign configuration of the cell corners.
+var dcPatchTable = dcBuildPatchTable()
+
+// dcEdgeIndex returns the index (in dcEdges) of the edge between two corners (-1: none).
+func dcEdgeIndex(c0, c1 int) int {
+	if c0 > c1 {
+		c0, c1 = c1, c0
+	}
+	for i, e := range dcEdges {
+		if e[0] == c0 && e[1] == c1 {
+			return i
+		}
+	}
+	return -1
+}
+
+// dcCorner returns the corner index of corner coordinates (x, y, z in 0..1).
+func dcCorner(x, y, z int) int {
+	return x*4 + y*2 + z
+}
+
+func dcBuildPatchTable() [256]dcPatches {
+	var table [256]dcPatches
+	for inside := 0; inside < 256; inside++ {
+		in := func(c int) bool { return (inside>>uint(c))&1 != 0 }
+		crossed := func(e int) bool { return in(dcEdges[e][0]) != in(dcEdges[e][1]) }
+		// union-find over the crossed edges
+		var parent [12]int
+		for i := range parent {
+			parent[i] = i
+		}
+		var find func(i int) int
+		find = func(i int) int {
+			if parent[i] != i {
+				parent[i] = find(parent[i])
+			}
+			return parent[i]
+		}
+		union := func(a, b int) { parent[find(a)] = find(b) }
+		// join the crossed edges of each face along the face contour
+		for axis := 0; axis < 3; axis++ {
+			for v := 0; v < 2; v++ {
+				// face corners in order around the face
+				var fc [4]int
+				for k, uv := range [4][2]int{{0, 0}, {1, 0}, {1, 1}, {0, 1}} {
+					p := [3]int{}
+					p[axis] = v
+					p[(axis+1)%3] = uv[0]
+					p[(axis+2)%3] = uv[1]
+					fc[k] = dcCorner(p[0], p[1], p[2])
+				}
+				var fe [4]int // edge k joins fc[k] and fc[k+1]
+				var crossings []int
+				for k := range fe {
+					fe[k] = dcEdgeIndex(fc[k], fc[(k+1)%4])
+					if crossed(fe[k]) {
+						crossings = append(crossings, fe[k])
+					}
+				}
+				switch len(crossings) {
+				case 2:
+					union(crossings[0], crossings[1])
+				case 4:
+					// ambiguous face: the contours go around the inside corners
+					for k := range fc {
+						if in(fc[k]) {
+							union(fe[(k+3)%4], fe[k])
+						}
+					}
+				}
+			}
+		}
+		// number the patches
+		t := &table[inside]
+		id := map[int]int8{}
+		for e := range dcEdges {
+			t.patch[e] = -1
+			if !crossed(e) {
+				continue
+			}
+			r := find(e)
+			p, ok := id[r]
+			if !ok {
+				p = int8(len(id))
+				id[r] = p
+			}
+			t.patch[e] = p
+		}
+		t.n = len(id)
+	}
+	return table
+}
+
+// dcFarEdgeNeighbours are the neighbour cell offsets for the quads of the far edges (as in generateTriangles).
+var dcFarEdgeNeighbours = [3][3]sdf.V3i{
+	{{0, 0, 1}, {0, 1, 0}, {0, 1, 1}},
+	{{0, 0, 1}, {1, 0, 0}, {1, 0, 1}},
+	{{0, 1, 0}, {1, 0, 0}, {1, 1, 0}},
+}
+
+// dcFarEdgeLocal gives the index of each far edge in the cell (0) and in its neighbour cells (1..3).
+var dcFarEdgeLocal = func() (t [3][4]int) {
+	for ai, e := range dcFarEdges {
+		t[ai][0] = dcEdgeIndex(e[0], e[1])
+		for k, o := range dcFarEdgeNeighbours[ai] {
+			var c [2]int
+			for j, corner := range []int{e[0], e[1]} {
+				x, y, z := corner/4-o[0], (corner/2)%2-o[1], corner%2-o[2]
+				c[j] = dcCorner(x, y, z)
+			}
+			t[ai][k+1] = dcEdgeIndex(c[0], c[1])
+		}
+	}
+	return
+}()
+
+//-----------------------------------------------------------------------------
+
+// placeVerticesManifold places a vertex for each surface patch of each cell. It returns the
+// vertices, their normals, the info for each cell with vertices (the index of its first vertex) and the
+// first vertex index for each cell index.
+func (dc *DualContouringV2) placeVerticesManifold(ctx context.Context, s *dcSdf, cells sdf.V3i) (buf, normals []sdf.V3, cellInfo []dcVoxelInfo, cellInfoIndexed *dcCellMap, err error) {
+	return dc.placeSlabs(ctx, s, cells, (*DualContouringV2).placeVerticesManifoldSlab)
+}
+
+// placeVerticesManifoldSlab places the patch vertices of the cells in a slab.
+func (dc *DualContouringV2) placeVerticesManifoldSlab(ctx context.Context, s *dcSdf, cells sdf.V3i, x0, x1 int, slab *dcSlab) {
+	normals := make([]sdf.V3, 0, 11)
+	planeDs := make([]float64, 0, 11)
+	bb := s.BoundingBox()
+	cellSize := bb.Size().Div(cells.ToV3())
+	cellSizeHalf := cellSize.DivScalar(2)
+	cellIndex := sdf.V3i{}
+	for cellIndex[0] = x0; cellIndex[0] < x1; cellIndex[0]++ {
+		if slab.err = ctx.Err(); slab.err != nil {
+			return
+		}
+		culled := s.cullLayer(cellIndex[0], cells)
+		s.prefetchLayer(cellIndex[0], cells, culled)
+		for cellIndex[1] = 0; cellIndex[1] < cells[1]; cellIndex[1]++ {
+			for cellIndex[2] = 0; cellIndex[2] < cells[2]; cellIndex[2]++ {
+				if culled != nil && culled[cellIndex[1]*cells[2]+cellIndex[2]] {
+					continue
+				}
+				cellStart := bb.Min.Add(cellSize.Mul(cellIndex.ToV3()))
+				inside := dc.computeCornersInside(s, cellIndex)
+				if inside == 0 || inside == math.MaxUint8 {
+					continue
+				}
+				cellCenter := cellStart.Add(cellSizeHalf)
+				t := &dcPatchTable[inside]
+				slab.info = append(slab.info, dcVoxelInfo{
+					cellIndex: cellIndex,
+					bufIndex:  len(slab.buf),
+					cellStart: cellStart,
+					cellSize:  cellSize,
+					inside:    inside,
+				})
+				for p := 0; p < t.n; p++ {
+					var mask uint16
+					for e, q := range t.patch {
+						if int(q) == p {
+							mask |= 1 << uint(e)
+						}
+					}
+					v, n := dc.placeVertex(s, cellStart, cellCenter, cellSize, inside, mask, normals[:0], planeDs[:0])
+					slab.buf = append(slab.buf, v)
+					slab.normals = append(slab.normals, n)
+				}
+			}
+		}
+		s.progress.Add(s.layerCells, 0)
+	}
+}
+
+// generateTrianglesManifold connects the patch vertices around each crossed edge.
+func (dc *DualContouringV2) generateTrianglesManifold(ctx context.Context, s *dcSdf, vertices []sdf.V3, info []dcVoxelInfo, infoI *dcCellMap, face func([]sdf.V3, [3]int)) error {
+	// vertex of the patch of a cell containing a local edge
+	patchVertex := func(c sdf.V3i, edge int) (int, bool) {
+		first, ok := infoI.get(c)
+		if !ok {
+			return 0, false
+		}
+		p := dcPatchTable[dc.computeCornersInside(s, c)].patch[edge]
+		return first + int(p), p >= 0
+	}
+	var triangles int64
+	for i := range info {
+		if err := dcLayerErr(ctx, s, info, i, &triangles); err != nil {
+			return err
+		}
+		voxelInfo := &info[i]
+		inside := voxelInfo.inside
+		for ai := 0; ai < 3; ai++ {
+			edge := dcFarEdges[ai]
+			if ((inside >> edge[0]) & 1) == ((inside >> edge[1]) & 1) {
+				continue // Not a crossing
+			}
+			local := dcFarEdgeLocal[ai]
+			v := [4]int{voxelInfo.bufIndex + int(dcPatchTable[inside].patch[local[0]])}
+			found := true
+			for k, o := range dcFarEdgeNeighbours[ai] {
+				var ok bool
+				if v[k+1], ok = patchVertex(voxelInfo.cellIndex.Add(o), local[k+1]); !ok {
+					found = false
+					break
+				}
+			}
+			if !found {
+				dc.report.add(WarningHole, voxelInfo.cellStart.Add(voxelInfo.cellSize.MulScalar(0.5)))
+				continue
+			}
+			flip := ((inside >> edge[0]) & 1) != uint8(ai&1)
+			triangles += dcQuad(vertices, v, flip, face)
+		}
+	}
+	s.progress.Add(0, triangles)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,137 @@
+//-----------------------------------------------------------------------------
+/*
+
+Render Reports
+
+The problems found while rendering are counted by type, with a few example
+locations, so the caller can check the quality of a mesh (or fail) without
+parsing log messages. Each type of warning is also an error value.
+
+*/
+//-----------------------------------------------------------------------------
+
+package dc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Warning is a type of problem found while rendering.
+type Warning int
+
+// The warnings, from the most to the least severe.
+const (
+	WarningHole          Warning = iota // no vertex to complete a face: the mesh has a hole
+	WarningVertexFailed                 // vertex positioning failed: the vertex is the cell center
+	WarningFarAway                      // vertex too far from its cell: the vertex is clamped
+	WarningRaycastFailed                // edge raycast failed: a low accuracy crossing is used
+	WarningSingular                     // singular least squares system (see leastSquares, no location)
+	numWarnings
+)
+
+var warningNames = [numWarnings]string{
+	"hole",
+	"vertex failed",
+	"vertex far away",
+	"raycast failed",
+	"singular system",
+}
+
+func (w Warning) String() string {
+	if w < 0 || w >= numWarnings {
+		return fmt.Sprintf("warning %d", int(w))
+	}
+	return warningNames[w]
+}
+
+// dcReportExamples is the number of example locations kept for each warning.
+const dcReportExamples = 4
+
+//-----------------------------------------------------------------------------
+
+// WarningError is the error for the occurrences of a warning in a render.
+type WarningError struct {
+	Warning Warning
+	Count   int    // number of occurrences
+	At      sdf.V3 // location of the first occurrence (cell center)
+}
+
+func (e *WarningError) Error() string {
+	return fmt.Sprintf("%s (%d times, first at %v)", e.Warning, e.Count, e.At)
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderReport is the warnings of a render.
+type RenderReport struct {
+	Counts   [numWarnings]int      // occurrences of each warning
+	Examples [numWarnings][]sdf.V3 // first locations of each warning (cell centers)
+}
+
+// add counts an occurrence of a warning at a location.
+func (r *RenderReport) add(w Warning, at sdf.V3) {
+	r.Counts[w]++
+	if len(r.Examples[w]) < dcReportExamples {
+		r.Examples[w] = append(r.Examples[w], at)
+	}
+}
+
+// merge adds the warnings of another (later) report.
+func (r *RenderReport) merge(o *RenderReport) {
+	for w := range o.Counts {
+		r.Counts[w] += o.Counts[w]
+		for _, at := range o.Examples[w] {
+			if len(r.Examples[w]) < dcReportExamples {
+				r.Examples[w] = append(r.Examples[w], at)
+			}
+		}
+	}
+}
+
+// Total returns the number of warnings.
+func (r *RenderReport) Total() int {
+	n := 0
+	for _, c := range r.Counts {
+		n += c
+	}
+	return n
+}
+
+// Errors returns an error (*WarningError) for each warning found, most severe first.
+func (r *RenderReport) Errors() []error {
+	var errs []error
+	for w, c := range r.Counts {
+		if c != 0 {
+			errs = append(errs, &WarningError{Warning(w), c, r.Examples[w][0]})
+		}
+	}
+	return errs
+}
+
+// Err returns the error (*WarningError) for the most severe warning found, or nil.
+func (r *RenderReport) Err() error {
+	if errs := r.Errors(); len(errs) != 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func (r *RenderReport) String() string {
+	if r.Total() == 0 {
+		return "no warnings"
+	}
+	var s []string
+	for w, c := range r.Counts {
+		if c != 0 {
+			s = append(s, fmt.Sprintf("%s: %d", Warning(w), c))
+		}
+	}
+	return strings.Join(s, ", ")
+}
+
+//-----------------------------------------------------------------------------
@@ -9,9 +9,21 @@ import (
 // UTILITIES/MISC
 //-----------------------------------------------------------------------------
 
-func dcFlip(t0 *render.Triangle3) *render.Triangle3 {
-	t0.V[1], t0.V[2] = t0.V[2], t0.V[1]
-	return t0
+// dcQuad outputs the (non degenerate) triangles v0 v1 v3 and v0 v3 v2 of a quad, flipped if needed.
+// It returns the number of triangles.
+func dcQuad(vertices []sdf.V3, v [4]int, flip bool, face func([]sdf.V3, [3]int)) int64 {
+	var n int64
+	for _, f := range [2][3]int{{v[0], v[1], v[3]}, {v[0], v[3], v[2]}} {
+		if flip {
+			f[1], f[2] = f[2], f[1]
+		}
+		t := render.Triangle3{V: [3]sdf.V3{vertices[f[0]], vertices[f[1]], vertices[f[2]]}}
+		if !t.Degenerate(0) {
+			face(vertices, f)
+			n++
+		}
+	}
+	return n
 }
 
 func dcCompGet(v3 sdf.V3, i int) float64 {
@@ -42,3 +54,10 @@ func dcMaxI(i int, i2 int) int {
 	}
 	return i2
 }
+
+func dcMinI(i int, i2 int) int {
+	if i <= i2 {
+		return i
+	}
+	return i2
+}
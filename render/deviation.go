@@ -0,0 +1,223 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Deviation
+
+Measure how far a rendered mesh is from the surface of its SDF3:
+
+Mesh to surface: the triangles are sampled on a barycentric grid and the
+field is evaluated at the samples (exact for distance fields, a bound for
+the rest). Statistics are kept for the whole mesh and for a grid of
+regions over the bounding box, to locate where the mesh is coarse.
+
+Surface to mesh: points near the surface (on a lattice) are projected
+onto the surface and their distance to the closest triangle is found.
+This catches features missing from the mesh.
+
+The Hausdorff distance is the larger of the two maximums.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// DeviationConfig sets the sampling of a deviation measurement.
+type DeviationConfig struct {
+	Spacing        float64 // distance between the samples on a triangle (0: 1/1000 of the bounding box)
+	Regions        sdf.V3i // regions on each axis of the bounding box ({0,0,0}: 4x4x4)
+	SurfaceSamples int     // lattice points on the longest axis for surface to mesh (0: 64, < 0: skip)
+}
+
+// DeviationStats are the deviation statistics of the samples within a volume.
+type DeviationStats struct {
+	Box     sdf.Box3 // volume
+	Samples int      // number of samples
+	Max     float64  // maximum distance from the surface
+	Mean    float64  // mean distance from the surface
+	RMS     float64  // RMS distance from the surface
+}
+
+// DeviationReport is the result of a deviation measurement.
+type DeviationReport struct {
+	Total         DeviationStats   // mesh to surface, whole mesh
+	Regions       []DeviationStats // mesh to surface, regions with samples (x, then y, then z major)
+	SurfaceToMesh DeviationStats   // surface to mesh
+	Hausdorff     float64          // symmetric Hausdorff distance estimate
+}
+
+// deviationAcc accumulates distances.
+type deviationAcc struct {
+	n        int
+	max, sum float64
+	sum2     float64
+}
+
+func (a *deviationAcc) add(d float64) {
+	a.n++
+	a.max = math.Max(a.max, d)
+	a.sum += d
+	a.sum2 += d * d
+}
+
+func (a *deviationAcc) merge(b *deviationAcc) {
+	a.n += b.n
+	a.max = math.Max(a.max, b.max)
+	a.sum += b.sum
+	a.sum2 += b.sum2
+}
+
+func (a *deviationAcc) stats(bb sdf.Box3) DeviationStats {
+	if a.n == 0 {
+		return DeviationStats{bb, 0, 0, 0, 0}
+	}
+	n := float64(a.n)
+	return DeviationStats{bb, a.n, a.max, a.sum / n, math.Sqrt(a.sum2 / n)}
+}
+
+// deviationChunkSize is the number of triangles per parallel task.
+const deviationChunkSize = 1 << 10
+
+//-----------------------------------------------------------------------------
+
+// MeasureDeviation measures the deviation of a rendered mesh from the surface of an SDF3.
+func MeasureDeviation(s sdf.SDF3, mesh []*Triangle3, cfg *DeviationConfig) (*DeviationReport, error) {
+	if cfg == nil {
+		cfg = &DeviationConfig{}
+	}
+	bb := s.BoundingBox()
+	spacing := cfg.Spacing
+	if spacing <= 0 {
+		spacing = bb.Size().MaxComponent() / 1000
+	}
+	regions := cfg.Regions
+	if regions == (sdf.V3i{}) {
+		regions = sdf.V3i{4, 4, 4}
+	}
+	if regions[0] <= 0 || regions[1] <= 0 || regions[2] <= 0 {
+		return nil, sdf.ErrMsg("regions must be > 0")
+	}
+	regionSize := bb.Size().Div(regions.ToV3())
+	regionOf := func(p sdf.V3) int {
+		var k [3]int
+		q := p.Sub(bb.Min).Div(regionSize)
+		for i, x := range []float64{q.X, q.Y, q.Z} {
+			k[i] = int(sdf.Clamp(math.Floor(x), 0, float64(regions[i]-1)))
+		}
+		return (k[0]*regions[1]+k[1])*regions[2] + k[2]
+	}
+	nRegions := regions[0] * regions[1] * regions[2]
+
+	// mesh to surface
+	var chunks [][]deviationAcc
+	g := DefaultPool().Group()
+	for i := 0; i < len(mesh); i += deviationChunkSize {
+		i0, i1 := i, i+deviationChunkSize
+		if i1 > len(mesh) {
+			i1 = len(mesh)
+		}
+		acc := make([]deviationAcc, nRegions)
+		chunks = append(chunks, acc)
+		g.Go(func() {
+			for _, t := range mesh[i0:i1] {
+				e := math.Max(t.V[1].Sub(t.V[0]).Length(), math.Max(t.V[2].Sub(t.V[1]).Length(), t.V[0].Sub(t.V[2]).Length()))
+				n := int(math.Ceil(e / spacing))
+				if n < 1 {
+					n = 1
+				}
+				for a := 0; a <= n; a++ {
+					for b := 0; a+b <= n; b++ {
+						u, v := float64(a)/float64(n), float64(b)/float64(n)
+						p := t.V[0].MulScalar(1 - u - v).Add(t.V[1].MulScalar(u)).Add(t.V[2].MulScalar(v))
+						acc[regionOf(p)].add(math.Abs(s.Evaluate(p)))
+					}
+				}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	r := &DeviationReport{}
+	var total deviationAcc
+	for k := 0; k < nRegions; k++ {
+		var acc deviationAcc
+		for _, c := range chunks {
+			acc.merge(&c[k])
+		}
+		total.merge(&acc)
+		if acc.n == 0 {
+			continue
+		}
+		x, y, z := k/(regions[1]*regions[2]), (k/regions[2])%regions[1], k%regions[2]
+		min := bb.Min.Add(sdf.V3{float64(x), float64(y), float64(z)}.Mul(regionSize))
+		r.Regions = append(r.Regions, acc.stats(sdf.Box3{min, min.Add(regionSize)}))
+	}
+	r.Total = total.stats(bb)
+
+	// surface to mesh
+	if cfg.SurfaceSamples >= 0 {
+		acc, err := surfaceToMesh(s, mesh, cfg.SurfaceSamples)
+		if err != nil {
+			return nil, err
+		}
+		r.SurfaceToMesh = acc.stats(bb)
+	}
+	r.Hausdorff = math.Max(r.Total.Max, r.SurfaceToMesh.Max)
+	return r, nil
+}
+
+// surfaceToMesh returns the distances from the surface of an SDF3 to a mesh,
+// for the surface points closest to the points of an n cell lattice.
+func surfaceToMesh(s sdf.SDF3, mesh []*Triangle3, n int) (*deviationAcc, error) {
+	if n == 0 {
+		n = 64
+	}
+	bb := s.BoundingBox()
+	step := bb.Size().MaxComponent() / float64(n)
+	steps := bb.Size().DivScalar(step).Ceil().ToV3i().AddScalar(1)
+	tol := sdf.ModelTolerances3(s)
+	grid := newTriangleGrid(mesh)
+	acc := make([]deviationAcc, steps[0])
+	g := DefaultPool().Group()
+	for x := 0; x < steps[0]; x++ {
+		x := x
+		g.Go(func() {
+			for y := 0; y < steps[1]; y++ {
+				for z := 0; z < steps[2]; z++ {
+					p := bb.Min.Add(sdf.V3{float64(x), float64(y), float64(z)}.MulScalar(step))
+					d := s.Evaluate(p)
+					if math.Abs(d) > step {
+						continue
+					}
+					// project onto the surface
+					for i := 0; i < 4 && math.Abs(d) > tol.Surface; i++ {
+						p = p.Sub(tol.Normal3(s, p).MulScalar(d))
+						d = s.Evaluate(p)
+					}
+					if math.Abs(d) > tol.Surface*10 {
+						continue
+					}
+					acc[x].add(grid.nearest(p))
+				}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var total deviationAcc
+	for i := range acc {
+		total.merge(&acc[i])
+	}
+	return &total, nil
+}
+
+//-----------------------------------------------------------------------------
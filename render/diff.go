@@ -0,0 +1,226 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Differences
+
+Compare two models (e.g. two revisions of a part) for design reviews:
+
+Volumes: both fields are sampled at the cell centers of a lattice over
+the combined bounding box. The fraction of a cell inside a model is
+estimated from the distance at its center (0.5 - d/cell, clamped), so
+the volumes are accurate for cells cut by the surface. The added volume
+is inside the new model and not the old one, the removed volume the other
+way round.
+
+Deviation: the vertices of each rendered model are evaluated with the
+other model, so the deviation is exact for distance fields (and a bound
+for the rest). The maximum is an estimate of the Hausdorff distance.
+
+Difference mesh: the new model is rendered with a vertex color and a
+"deviation" attribute (see Mesh.SetAttribute) from its signed distance to
+the old model: red where material was added, blue where it was removed
+and gray where the surface is unchanged (within the tolerance). The mesh
+can be written with its colors (3MF, PLY).
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"image/color"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// DiffConfig sets the resolution of a model comparison.
+type DiffConfig struct {
+	MeshCells int     // cells on the longest axis of the volume lattice and the renders (0: 100)
+	Tolerance float64 // largest deviation of an unchanged surface (0: 1/10 of a cell)
+	Renderer  Render3 // nil: MarchingCubesUniform
+}
+
+// DiffReport is the result of a model comparison.
+type DiffReport struct {
+	VolumeA, VolumeB float64  // model volumes
+	Added            float64  // volume inside the new model only
+	Removed          float64  // volume inside the old model only
+	MaxDeviation     float64  // largest distance of a surface from the other model
+	MeanDeviation    float64  // mean distance of the surfaces from the other model
+	Changed          bool     // a surface deviates by more than the tolerance
+	Box              sdf.Box3 // bounding box of the surface changes (zero: unchanged)
+	Mesh             *Mesh    // new model surface, colored by the deviation from the old model
+}
+
+// diffColors are the difference mesh colors.
+var (
+	diffSame    = color.RGBA{180, 180, 180, 255}
+	diffAdded   = color.RGBA{220, 40, 40, 255}
+	diffRemoved = color.RGBA{40, 80, 220, 255}
+)
+
+//-----------------------------------------------------------------------------
+
+// Diff compares an old (a) and a new (b) model. It returns ctx.Err() if the context is done
+// before the comparison is complete.
+func Diff(ctx context.Context, a, b sdf.SDF3, cfg *DiffConfig) (*DiffReport, error) {
+	if cfg == nil {
+		cfg = &DiffConfig{}
+	}
+	k := *cfg
+	if k.MeshCells == 0 {
+		k.MeshCells = 100
+	}
+	if k.MeshCells < 0 || k.Tolerance < 0 {
+		return nil, sdf.ErrMsg("bad diff parameters")
+	}
+	if k.Renderer == nil {
+		k.Renderer = &MarchingCubesUniform{}
+	}
+	bb := a.BoundingBox().Extend(b.BoundingBox())
+	cell := bb.Size().MaxComponent() / float64(k.MeshCells)
+	if k.Tolerance == 0 {
+		k.Tolerance = 0.1 * cell
+	}
+	r := &DiffReport{}
+	if err := diffVolumes(ctx, a, b, bb, cell, r); err != nil {
+		return nil, err
+	}
+
+	ma, err := RenderIndexed(ctx, a, k.MeshCells, k.Renderer)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := RenderIndexed(ctx, b, k.MeshCells, k.Renderer)
+	if err != nil {
+		return nil, err
+	}
+	da, err := diffDistances(a, mb.Vertices)
+	if err != nil {
+		return nil, err
+	}
+	db, err := diffDistances(b, ma.Vertices)
+	if err != nil {
+		return nil, err
+	}
+
+	// deviations, and the box of the changes
+	var sum float64
+	include := func(v sdf.V3) {
+		if !r.Changed {
+			r.Box, r.Changed = sdf.Box3{v, v}, true
+		}
+		r.Box = r.Box.Include(v)
+	}
+	for _, d := range [][]float64{da, db} {
+		for _, x := range d {
+			r.MaxDeviation = math.Max(r.MaxDeviation, math.Abs(x))
+			sum += math.Abs(x)
+		}
+	}
+	if n := len(da) + len(db); n != 0 {
+		r.MeanDeviation = sum / float64(n)
+	}
+	for i, x := range da {
+		if math.Abs(x) > k.Tolerance {
+			include(mb.Vertices[i])
+		}
+	}
+	for i, x := range db {
+		if math.Abs(x) > k.Tolerance {
+			include(ma.Vertices[i])
+		}
+	}
+
+	// color the new surface by the deviation (full color at the largest deviation)
+	mb.Colors = make([]color.RGBA, len(da))
+	for i, x := range da {
+		c := diffSame
+		if x > k.Tolerance {
+			c = diffLerp(diffSame, diffAdded, x/r.MaxDeviation)
+		} else if x < -k.Tolerance {
+			c = diffLerp(diffSame, diffRemoved, -x/r.MaxDeviation)
+		}
+		mb.Colors[i] = c
+	}
+	if err := mb.SetAttribute("deviation", da); err != nil {
+		return nil, err
+	}
+	r.Mesh = mb
+	return r, nil
+}
+
+// diffVolumes sets the volumes of a report from the cell center samples of both models.
+func diffVolumes(ctx context.Context, a, b sdf.SDF3, bb sdf.Box3, cell float64, r *DiffReport) error {
+	size := bb.Size()
+	centers := func(min, size float64) []float64 {
+		n := int(math.Ceil(size / cell))
+		if n < 1 {
+			n = 1
+		}
+		// center the lattice on the box
+		min -= 0.5 * (float64(n)*cell - size)
+		v := make([]float64, n)
+		for i := range v {
+			v[i] = min + (float64(i)+0.5)*cell
+		}
+		return v
+	}
+	xs, ys, zs := centers(bb.Min.X, size.X), centers(bb.Min.Y, size.Y), centers(bb.Min.Z, size.Z)
+	va := make([]float64, len(ys)*len(zs))
+	vb := make([]float64, len(ys)*len(zs))
+	inside := func(d float64) float64 {
+		return sdf.Clamp(0.5-d/cell, 0, 1)
+	}
+	for _, x := range xs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := mcEvaluateLayer(a, x, ys, zs, va); err != nil {
+			return err
+		}
+		if err := mcEvaluateLayer(b, x, ys, zs, vb); err != nil {
+			return err
+		}
+		for i := range va {
+			fa, fb := inside(va[i]), inside(vb[i])
+			r.VolumeA += fa
+			r.VolumeB += fb
+			if fb > fa {
+				r.Added += fb - fa
+			} else {
+				r.Removed += fa - fb
+			}
+		}
+	}
+	v := cell * cell * cell
+	r.VolumeA *= v
+	r.VolumeB *= v
+	r.Added *= v
+	r.Removed *= v
+	return nil
+}
+
+// diffDistances returns the values of a model at points.
+func diffDistances(s sdf.SDF3, p []sdf.V3) ([]float64, error) {
+	d := make([]float64, len(p))
+	if err := mcEvaluatePoints(s, p, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// diffLerp returns the color a fraction of the way from c0 to c1.
+func diffLerp(c0, c1 color.RGBA, t float64) color.RGBA {
+	t = sdf.Clamp(t, 0, 1)
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x) + t*(float64(y)-float64(x))))
+	}
+	return color.RGBA{mix(c0.R, c1.R), mix(c0.G, c1.G), mix(c0.B, c1.B), 255}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,608 @@
+//-----------------------------------------------------------------------------
+/*
+
+Dimensioned Drawings
+
+Orthographic views (front, top and right, in third angle projection) of
+the sharp edges and silhouettes of a mesh (see MeshWireframe), with
+dimensions and notes, written as SVG to accompany the exported parts.
+
+The edges hidden by the mesh (tested at points along each edge against the
+projected triangles of the view) are drawn dashed.
+
+The annotations reference the model geometry by model coordinates (e.g.
+the corners, centers and edge points of the design) and are projected into
+their view. Linear dimensions measure the projected distance on the view
+axes (horizontal, vertical) or along the line between their points
+(aligned), radial dimensions the distance from a center to a point on a
+circle. The values are formatted unless the text is set, and a tolerance
+(e.g. "±0.05") can be appended.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+
+	svg "github.com/ajstarks/svgo/float"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// DrawingView is an orthographic view of a drawing.
+type DrawingView int
+
+// Drawing views (third angle projection: the top view is above the front view, the right view on its right).
+const (
+	ViewFront DrawingView = iota // looking along +y (x right, z up)
+	ViewTop                      // looking along -z (x right, y up)
+	ViewRight                    // looking along -x (y right, z up)
+)
+
+func (v DrawingView) String() string {
+	switch v {
+	case ViewFront:
+		return "front"
+	case ViewTop:
+		return "top"
+	case ViewRight:
+		return "right"
+	}
+	return "unknown"
+}
+
+// axes returns the right, up and view directions of a view.
+func (v DrawingView) axes() (sdf.V3, sdf.V3, sdf.V3) {
+	switch v {
+	case ViewTop:
+		return sdf.V3{1, 0, 0}, sdf.V3{0, 1, 0}, sdf.V3{0, 0, -1}
+	case ViewRight:
+		return sdf.V3{0, 1, 0}, sdf.V3{0, 0, 1}, sdf.V3{-1, 0, 0}
+	}
+	return sdf.V3{1, 0, 0}, sdf.V3{0, 0, 1}, sdf.V3{0, 1, 0}
+}
+
+// project returns the view coordinates of a point.
+func (v DrawingView) project(p sdf.V3) sdf.V2 {
+	r, u, _ := v.axes()
+	return sdf.V2{p.Dot(r), p.Dot(u)}
+}
+
+//-----------------------------------------------------------------------------
+
+// DimensionKind is the kind of a dimension.
+type DimensionKind int
+
+// Dimension kinds.
+const (
+	DimHorizontal DimensionKind = iota // horizontal distance between two points
+	DimVertical                        // vertical distance between two points
+	DimAligned                         // distance between two points
+	DimRadius                          // radius of a circle (center, point on the circle)
+	DimDiameter                        // diameter of a circle (center, point on the circle)
+)
+
+// Dimension is a dimension of a drawing view.
+type Dimension struct {
+	Kind      DimensionKind
+	View      DrawingView
+	P0, P1    sdf.V3  // measured points (radial: the center and a point on the circle)
+	Offset    float64 // distance of a linear dimension line from its points (negative: the other side)
+	Text      string  // label ("": the measured value)
+	Tolerance string  // appended to the label (e.g. "±0.05")
+}
+
+// Note is a note of a drawing view, with a leader line to the model.
+type Note struct {
+	View   DrawingView
+	At     sdf.V3 // leader point
+	Offset sdf.V2 // text position from the leader point (view coordinates)
+	Text   string
+}
+
+// DrawingConfig sets the parameters of a drawing.
+type DrawingConfig struct {
+	Views  []DrawingView // views (nil: front, top and right)
+	Angle  float64       // minimum dihedral angle of a sharp edge (radians, 0: 30 degrees)
+	Gap    float64       // gap between views (0: 25% of the model size)
+	Text   float64       // text height (0: 4% of the model size)
+	Format string        // format of the measured values ("": "%.2f")
+}
+
+// drawingView is the projected edges of a view.
+type drawingView struct {
+	view    DrawingView
+	visible [][]sdf.V2
+	hidden  [][]sdf.V2
+	bb      sdf.Box2 // projected model box
+	offset  sdf.V2   // position of the view in the drawing
+}
+
+// Drawing is a set of dimensioned orthographic views of a mesh.
+type Drawing struct {
+	Dimensions []Dimension
+	Notes      []Note
+	views      []*drawingView
+	vertices   []sdf.V3 // wireframe vertices
+	text       float64
+	format     string
+}
+
+//-----------------------------------------------------------------------------
+
+// NewDrawing returns the orthographic views of an indexed mesh.
+func NewDrawing(m *Mesh, cfg *DrawingConfig) (*Drawing, error) {
+	if cfg == nil {
+		cfg = &DrawingConfig{}
+	}
+	if len(m.Faces) == 0 {
+		return nil, sdf.ErrMsg("empty mesh")
+	}
+	views := cfg.Views
+	if views == nil {
+		views = []DrawingView{ViewFront, ViewTop, ViewRight}
+	}
+	bb := sdf.Box3{m.Vertices[m.Faces[0][0]], m.Vertices[m.Faces[0][0]]}
+	tris := make([]*Triangle3, len(m.Faces))
+	for i, f := range m.Faces {
+		tris[i] = &Triangle3{[3]sdf.V3{m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]}}
+		for _, v := range tris[i].V {
+			bb = bb.Include(v)
+		}
+	}
+	size := bb.Size().MaxComponent()
+	d := &Drawing{text: cfg.Text, format: cfg.Format}
+	if d.text == 0 {
+		d.text = 0.04 * size
+	}
+	if d.format == "" {
+		d.format = "%.2f"
+	}
+	gap := cfg.Gap
+	if gap == 0 {
+		gap = 0.25 * size
+	}
+	seen := make(map[sdf.V3]bool)
+	for _, v := range views {
+		if v < ViewFront || v > ViewRight {
+			return nil, sdf.ErrMsg("bad view")
+		}
+		_, _, dir := v.axes()
+		w, err := MeshWireframe(m, &WireframeConfig{Angle: cfg.Angle, View: dir})
+		if err != nil {
+			return nil, err
+		}
+		dv := &drawingView{view: v}
+		corners := bb.Vertices()
+		dv.bb = sdf.Box2{v.project(corners[0]), v.project(corners[0])}
+		for _, c := range corners {
+			dv.bb = dv.bb.Include(v.project(c))
+		}
+		occ := newDrawingOcclusion(v, tris, size)
+		for _, line := range append(w.Sharp, w.Silhouette...) {
+			for _, p := range line {
+				if !seen[p] {
+					seen[p] = true
+					d.vertices = append(d.vertices, p)
+				}
+			}
+			occ.split(line, &dv.visible, &dv.hidden)
+		}
+		d.views = append(d.views, dv)
+	}
+	// third angle layout about the front view
+	front := sdf.Box2{ViewFront.project(bb.Min), ViewFront.project(bb.Max)}
+	for _, dv := range d.views {
+		switch dv.view {
+		case ViewTop:
+			dv.offset = sdf.V2{0, front.Max.Y + gap - dv.bb.Min.Y}
+		case ViewRight:
+			dv.offset = sdf.V2{front.Max.X + gap - dv.bb.Min.X, 0}
+		}
+	}
+	return d, nil
+}
+
+// RenderDrawing renders an SDF3 (see RenderIndexed) and returns the orthographic views of the mesh.
+func RenderDrawing(s sdf.SDF3, meshCells int, r Render3, cfg *DrawingConfig) (*Drawing, error) {
+	m, err := RenderIndexed(context.Background(), s, meshCells, r)
+	if err != nil {
+		return nil, err
+	}
+	return NewDrawing(m, cfg)
+}
+
+// Vertex returns the vertex of the drawing edges nearest to a point, to reference the rendered geometry.
+func (d *Drawing) Vertex(p sdf.V3) sdf.V3 {
+	best, dist := p, math.Inf(1)
+	for _, v := range d.vertices {
+		if l := v.Sub(p).Length2(); l < dist {
+			best, dist = v, l
+		}
+	}
+	return best
+}
+
+// view returns a view of the drawing (nil: not in the drawing).
+func (d *Drawing) view(v DrawingView) *drawingView {
+	for _, dv := range d.views {
+		if dv.view == v {
+			return dv
+		}
+	}
+	return nil
+}
+
+// AddDimension adds a dimension to a view of the drawing.
+func (d *Drawing) AddDimension(dim Dimension) error {
+	if d.view(dim.View) == nil {
+		return sdf.ErrMsg(fmt.Sprintf("no %s view", dim.View))
+	}
+	if dim.Kind < DimHorizontal || dim.Kind > DimDiameter {
+		return sdf.ErrMsg("bad dimension kind")
+	}
+	if dim.View.project(dim.P0).Equals(dim.View.project(dim.P1), 0) {
+		return sdf.ErrMsg("the dimension points are equal in the view")
+	}
+	d.Dimensions = append(d.Dimensions, dim)
+	return nil
+}
+
+// AddNote adds a note to a view of the drawing.
+func (d *Drawing) AddNote(n Note) error {
+	if d.view(n.View) == nil {
+		return sdf.ErrMsg(fmt.Sprintf("no %s view", n.View))
+	}
+	d.Notes = append(d.Notes, n)
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// Hidden lines
+
+// drawingOcclusion buckets the projected triangles of a view into a 2d grid.
+type drawingOcclusion struct {
+	view  DrawingView
+	tris  []*Triangle3
+	min   sdf.V2
+	cell  float64
+	nx    int
+	cells map[int][]int32
+	step  float64 // sample spacing along the edges
+	eps   float64 // depth tolerance
+}
+
+// drawingInside is the barycentric tolerance of a point within a projected triangle.
+const drawingInside = 1e-9
+
+// drawingGrid is the number of occlusion grid cells on the longest axis.
+const drawingGrid = 128
+
+func newDrawingOcclusion(v DrawingView, tris []*Triangle3, size float64) *drawingOcclusion {
+	o := &drawingOcclusion{view: v, tris: tris, cell: size / drawingGrid, cells: make(map[int][]int32)}
+	o.step = size / 256
+	o.eps = size * 1e-4
+	o.min = v.project(tris[0].V[0])
+	for _, t := range tris {
+		for _, p := range t.V {
+			o.min = o.min.Min(v.project(p))
+		}
+	}
+	o.nx = drawingGrid + 2
+	for i, t := range tris {
+		a, b, c := v.project(t.V[0]), v.project(t.V[1]), v.project(t.V[2])
+		x0, y0 := o.cellOf(a.Min(b).Min(c))
+		x1, y1 := o.cellOf(a.Max(b).Max(c))
+		for x := x0; x <= x1; x++ {
+			for y := y0; y <= y1; y++ {
+				k := y*o.nx + x
+				o.cells[k] = append(o.cells[k], int32(i))
+			}
+		}
+	}
+	return o
+}
+
+func (o *drawingOcclusion) cellOf(p sdf.V2) (int, int) {
+	x := int((p.X - o.min.X) / o.cell)
+	y := int((p.Y - o.min.Y) / o.cell)
+	return int(sdf.Clamp(float64(x), 0, float64(o.nx-1))), y
+}
+
+// hidden returns true if a triangle is between a point and the viewer.
+func (o *drawingOcclusion) hidden(p sdf.V3) bool {
+	q := o.view.project(p)
+	_, _, dir := o.view.axes()
+	depth := p.Dot(dir)
+	x, y := o.cellOf(q)
+	for _, i := range o.cells[y*o.nx+x] {
+		t := o.tris[i]
+		a, b, c := o.view.project(t.V[0]), o.view.project(t.V[1]), o.view.project(t.V[2])
+		// barycentric coordinates of the point in the projected triangle
+		det := b.Sub(a).Cross(c.Sub(a))
+		if det == 0 {
+			continue
+		}
+		u := q.Sub(a).Cross(c.Sub(a)) / det
+		w := b.Sub(a).Cross(q.Sub(a)) / det
+		// points on the triangle edges are covered (so an edge behind a silhouette is hidden)
+		if u < -drawingInside || w < -drawingInside || u+w > 1+drawingInside {
+			continue
+		}
+		z := t.V[0].Dot(dir)*(1-u-w) + t.V[1].Dot(dir)*u + t.V[2].Dot(dir)*w
+		if z < depth-o.eps {
+			return true
+		}
+	}
+	return false
+}
+
+// split projects a polyline, appending its visible and hidden parts to the view lines.
+func (o *drawingOcclusion) split(line []sdf.V3, visible, hidden *[][]sdf.V2) {
+	var cur []sdf.V2
+	curHidden := false
+	flush := func() {
+		if len(cur) >= 2 {
+			if curHidden {
+				*hidden = append(*hidden, cur)
+			} else {
+				*visible = append(*visible, cur)
+			}
+		}
+		cur = nil
+	}
+	for i := 1; i < len(line); i++ {
+		p0, p1 := line[i-1], line[i]
+		n := int(math.Ceil(p1.Sub(p0).Length() / o.step))
+		if n < 1 {
+			n = 1
+		}
+		for k := 0; k < n; k++ {
+			a := p0.Add(p1.Sub(p0).MulScalar(float64(k) / float64(n)))
+			b := p0.Add(p1.Sub(p0).MulScalar(float64(k+1) / float64(n)))
+			h := o.hidden(a.Add(b).MulScalar(0.5))
+			if h != curHidden || cur == nil {
+				last := o.view.project(a)
+				if k != 0 && cur != nil {
+					// end the part at the change within a segment
+					cur = append(cur, last)
+				}
+				flush()
+				curHidden = h
+				cur = []sdf.V2{last}
+			}
+			if k == n-1 {
+				cur = append(cur, o.view.project(b))
+			}
+		}
+	}
+	flush()
+}
+
+//-----------------------------------------------------------------------------
+// SVG output
+
+// drawingText is a text of a drawing.
+type drawingText struct {
+	p      sdf.V2
+	text   string
+	anchor string
+}
+
+// drawingSheet collects the drawing primitives (drawing coordinates) and their extent.
+type drawingSheet struct {
+	visible, hidden, thin [][]sdf.V2
+	arrows                [][3]sdf.V2
+	texts                 []drawingText
+	bb                    sdf.Box2
+	text                  float64
+	started               bool
+}
+
+func (s *drawingSheet) include(p sdf.V2) {
+	if !s.started {
+		s.bb, s.started = sdf.Box2{p, p}, true
+	}
+	s.bb = s.bb.Include(p)
+}
+
+func (s *drawingSheet) line(lines *[][]sdf.V2, l []sdf.V2) {
+	for _, p := range l {
+		s.include(p)
+	}
+	*lines = append(*lines, l)
+}
+
+// arrow adds an arrow head at p pointing along dir (a unit vector).
+func (s *drawingSheet) arrow(p, dir sdf.V2) {
+	l, w := 0.8*s.text, 0.25*s.text
+	n := sdf.V2{-dir.Y, dir.X}
+	b := p.Sub(dir.MulScalar(l))
+	a := [3]sdf.V2{p, b.Add(n.MulScalar(w)), b.Sub(n.MulScalar(w))}
+	for _, q := range a {
+		s.include(q)
+	}
+	s.arrows = append(s.arrows, a)
+}
+
+// label adds a text (approximate extent: 0.6 text heights per character).
+func (s *drawingSheet) label(p sdf.V2, text, anchor string) {
+	w := 0.6 * s.text * float64(len([]rune(text)))
+	x0 := p.X
+	switch anchor {
+	case "middle":
+		x0 -= w / 2
+	case "end":
+		x0 -= w
+	}
+	s.include(sdf.V2{x0, p.Y})
+	s.include(sdf.V2{x0 + w, p.Y + s.text})
+	s.texts = append(s.texts, drawingText{p, text, anchor})
+}
+
+// dimension adds the lines and label of a dimension.
+func (d *Drawing) dimension(s *drawingSheet, dim Dimension) {
+	dv := d.view(dim.View)
+	a := dim.View.project(dim.P0).Add(dv.offset)
+	b := dim.View.project(dim.P1).Add(dv.offset)
+	label := func(prefix string, x float64) string {
+		text := dim.Text
+		if text == "" {
+			text = prefix + fmt.Sprintf(d.format, x)
+		}
+		return text + dim.Tolerance
+	}
+	switch dim.Kind {
+	case DimRadius, DimDiameter:
+		u := b.Sub(a).Normalize()
+		r := b.Sub(a).Length()
+		start, text := a, label("R", r)
+		if dim.Kind == DimDiameter {
+			start, text = a.Sub(b.Sub(a)), label("Ø", 2*r)
+			s.arrow(start, u.Neg())
+		}
+		s.arrow(b, u)
+		// the leader continues past the circle to the label
+		end := b.Add(u.MulScalar(s.text))
+		s.line(&s.thin, []sdf.V2{start, end})
+		anchor := "start"
+		if u.X < 0 {
+			anchor = "end"
+		}
+		s.label(end.Add(sdf.V2{0, 0.2 * s.text}), text, anchor)
+		return
+	}
+	// linear dimensions: measured along u, the dimension line is offset along n
+	var u sdf.V2
+	switch dim.Kind {
+	case DimHorizontal:
+		u = sdf.V2{1, 0}
+	case DimVertical:
+		u = sdf.V2{0, 1}
+	default:
+		u = b.Sub(a).Normalize()
+	}
+	if b.Sub(a).Dot(u) < 0 {
+		a, b = b, a
+	}
+	n := sdf.V2{-u.Y, u.X}
+	level := math.Max(a.Dot(n), b.Dot(n)) + dim.Offset
+	if dim.Offset < 0 {
+		level = math.Min(a.Dot(n), b.Dot(n)) + dim.Offset
+	}
+	fa := a.Add(n.MulScalar(level - a.Dot(n)))
+	fb := b.Add(n.MulScalar(level - b.Dot(n)))
+	// extension lines (past the dimension line), dimension line and arrows
+	ext := n.MulScalar(math.Copysign(0.3*s.text, dim.Offset))
+	s.line(&s.thin, []sdf.V2{a, fa.Add(ext)})
+	s.line(&s.thin, []sdf.V2{b, fb.Add(ext)})
+	s.line(&s.thin, []sdf.V2{fa, fb})
+	s.arrow(fa, u.Neg())
+	s.arrow(fb, u)
+	text := label("", fb.Sub(fa).Length())
+	if dim.Kind == DimVertical {
+		// vertical labels are written horizontally, next to the dimension line
+		anchor := "end"
+		if dim.Offset > 0 {
+			anchor = "start"
+		}
+		side := math.Copysign(0.3*s.text, dim.Offset)
+		s.label(fa.Add(fb).MulScalar(0.5).Add(sdf.V2{side, -0.3 * s.text}), text, anchor)
+		return
+	}
+	s.label(fa.Add(fb).MulScalar(0.5).Add(n.MulScalar(0.3*s.text)), text, "middle")
+}
+
+// sheet returns the primitives of the drawing.
+func (d *Drawing) sheet() *drawingSheet {
+	s := &drawingSheet{text: d.text}
+	for _, dv := range d.views {
+		move := func(l []sdf.V2) []sdf.V2 {
+			m := make([]sdf.V2, len(l))
+			for i, p := range l {
+				m[i] = p.Add(dv.offset)
+			}
+			return m
+		}
+		for _, l := range dv.visible {
+			s.line(&s.visible, move(l))
+		}
+		for _, l := range dv.hidden {
+			s.line(&s.hidden, move(l))
+		}
+		s.include(dv.bb.Min.Add(dv.offset))
+		s.include(dv.bb.Max.Add(dv.offset))
+	}
+	for _, dim := range d.Dimensions {
+		d.dimension(s, dim)
+	}
+	for _, n := range d.Notes {
+		dv := d.view(n.View)
+		a := n.View.project(n.At).Add(dv.offset)
+		b := a.Add(n.Offset)
+		if l := n.Offset.Length(); l > 0 {
+			s.arrow(a, n.Offset.DivScalar(-l))
+			s.line(&s.thin, []sdf.V2{b, a})
+		}
+		anchor := "start"
+		if n.Offset.X < 0 {
+			anchor = "end"
+		}
+		s.label(b.Add(sdf.V2{0, 0.2 * s.text}), n.Text, anchor)
+	}
+	return s
+}
+
+// SaveSVG writes the drawing to an SVG file (y is up, 1 model unit per SVG unit). The hidden
+// edges are dashed, the annotations drawn with thin lines. The line style is the SVG style of
+// the visible edges, e.g. "fill:none;stroke:black;stroke-width:0.2".
+func (d *Drawing) SaveSVG(path, lineStyle string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	s := d.sheet()
+	margin := 2 * d.text
+	min := s.bb.Min.SubScalar(margin)
+	max := s.bb.Max.AddScalar(margin)
+	canvas := svg.New(f)
+	canvas.Start(max.X-min.X, max.Y-min.Y)
+	lines := func(id string, l [][]sdf.V2, style string) {
+		canvas.Group(fmt.Sprintf("id=\"%s\"", id))
+		for _, line := range l {
+			x, y := make([]float64, len(line)), make([]float64, len(line))
+			for i, p := range line {
+				x[i], y[i] = p.X-min.X, max.Y-p.Y
+			}
+			canvas.Polyline(x, y, style)
+		}
+		canvas.Gend()
+	}
+	thin := fmt.Sprintf("fill:none;stroke:black;stroke-width:%g", 0.08*d.text)
+	// the visible edges are drawn over the hidden edges behind them
+	lines("hidden", s.hidden, lineStyle+fmt.Sprintf(";stroke-dasharray:%g,%g", 0.6*d.text, 0.3*d.text))
+	lines("visible", s.visible, lineStyle)
+	lines("annotations", s.thin, thin)
+	canvas.Group("id=\"arrows\"")
+	for _, a := range s.arrows {
+		canvas.Polygon([]float64{a[0].X - min.X, a[1].X - min.X, a[2].X - min.X},
+			[]float64{max.Y - a[0].Y, max.Y - a[1].Y, max.Y - a[2].Y}, "fill:black;stroke:none")
+	}
+	canvas.Gend()
+	canvas.Group("id=\"labels\"")
+	for _, t := range s.texts {
+		style := fmt.Sprintf("font-family:sans-serif;font-size:%gpx;text-anchor:%s", d.text, t.anchor)
+		canvas.Text(t.p.X-min.X, max.Y-t.p.Y, t.text, style)
+	}
+	canvas.Gend()
+	canvas.End()
+	return f.Close()
+}
+
+//-----------------------------------------------------------------------------
@@ -178,8 +178,10 @@ func RenderDXFSlow(
 	fmt.Printf("rendering %s (%dx%d)\n", path, cells[0], cells[1])
 
 	// run marching squares to generate the line segments
-	m := marchingSquares(s, bb, meshInc)
-	err := SaveDXF(path, m)
+	m, err := marchingSquares(s, bb, meshInc)
+	if err == nil {
+		err = SaveDXF(path, m)
+	}
 	if err != nil {
 		fmt.Printf("%s", err)
 	}
@@ -0,0 +1,378 @@
+//-----------------------------------------------------------------------------
+/*
+
+Export Jobs
+
+Render a model once and write it to several files at the same time, e.g.
+an STL for slicing, a 3MF for archiving, a PNG preview and a JSON report.
+The mesh formats are written by the exporters registered for their file
+extensions (see Export), or by an exporter given with the output (e.g.
+with format options). The outputs share the indexed mesh and are written
+concurrently, and the report (rendering statistics, mesh properties and
+the written files) is written when all the other outputs are done.
+
+The preview is a flat shaded orthographic view of the mesh, lit from the
+viewer.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// PreviewConfig sets the image of a mesh preview.
+type PreviewConfig struct {
+	Pixels     sdf.V2i    // image size ({0,0}: 512x512)
+	View       sdf.V3     // view direction (zero: isometric, looking along -1,1,-1)
+	Color      color.RGBA // surface color (zero: light gray)
+	Background color.RGBA // background color (zero: transparent)
+}
+
+// ExportOutput is an output file of an export job.
+type ExportOutput struct {
+	Path     string
+	Format   string         // file extension selecting the exporter ("": the path extension), ".png": preview, ".json": report
+	Exporter Exporter       // mesh exporter (nil: the exporter registered for the format)
+	Preview  *PreviewConfig // preview options (nil: defaults)
+}
+
+// ExportJob is a model to render and the files to write.
+type ExportJob struct {
+	SDF       sdf.SDF3
+	MeshCells int     // cells on the longest axis (<= 0: selected by Auto at medium quality)
+	Renderer  Render3 // nil: selected by Auto at medium quality
+	Outputs   []ExportOutput
+}
+
+// ExportFile is the result of an export output.
+type ExportFile struct {
+	Path    string
+	Format  string
+	Bytes   int64   // file size
+	Seconds float64 // write time
+	Err     string  `json:",omitempty"` // error writing the file
+}
+
+// ExportReport is the result of an export job.
+type ExportReport struct {
+	Model         string   // model hash
+	Renderer      string   // renderer type
+	MeshCells     int      // cells on the longest axis
+	RenderSeconds float64  // render time
+	Vertices      int      // indexed mesh vertices
+	Triangles     int      // indexed mesh triangles
+	Box           sdf.Box3 // mesh bounding box
+	Area          float64  // surface area
+	Volume        float64  // enclosed volume
+	Center        sdf.V3   // center of the enclosed volume
+	Files         []ExportFile
+}
+
+//-----------------------------------------------------------------------------
+
+// exportFormat returns the format of an output.
+func exportFormat(o *ExportOutput) string {
+	if o.Format != "" {
+		return normalizeExt(o.Format)
+	}
+	return normalizeExt(filepath.Ext(o.Path))
+}
+
+// Run renders the model of the job and writes the outputs concurrently. All the
+// outputs are attempted; the error of each output is recorded in the report, and
+// the first error is returned. It returns ctx.Err() if the context is done before
+// the render is complete.
+func (j *ExportJob) Run(ctx context.Context) (*ExportReport, error) {
+	if j.SDF == nil {
+		return nil, sdf.ErrMsg("no model")
+	}
+	// check the outputs before rendering
+	for i := range j.Outputs {
+		o := &j.Outputs[i]
+		if o.Path == "" {
+			return nil, sdf.ErrMsg("output has no path")
+		}
+		switch f := exportFormat(o); f {
+		case ".png", ".json":
+		default:
+			if o.Exporter != nil {
+				break
+			}
+			registry.Lock()
+			_, ok := registry.exporters[f]
+			registry.Unlock()
+			if !ok {
+				return nil, sdf.ErrMsg(fmt.Sprintf("no exporter for \"%s\"", f))
+			}
+		}
+	}
+
+	ctx, span := StartSpan(ctx, "export_job", Attribute{"outputs", len(j.Outputs)})
+	report, err := j.run(ctx)
+	span.End(err)
+	return report, err
+}
+
+// run renders the model of the job and writes the outputs.
+func (j *ExportJob) run(ctx context.Context) (*ExportReport, error) {
+	r, meshCells := j.Renderer, j.MeshCells
+	if r == nil || meshCells <= 0 {
+		choice, err := Auto(j.SDF, 0.5)
+		if err != nil {
+			return nil, err
+		}
+		if meshCells <= 0 {
+			meshCells = choice.MeshCells
+		}
+		if r == nil {
+			if r, err = NewRenderer(choice.Name, j.SDF, meshCells); err != nil {
+				return nil, err
+			}
+		}
+	}
+	start := time.Now()
+	m, err := RenderIndexed(ctx, j.SDF, meshCells, r)
+	if err != nil {
+		return nil, err
+	}
+	report := &ExportReport{
+		Model:         sdf.ModelHash(j.SDF),
+		Renderer:      fmt.Sprintf("%T", r),
+		MeshCells:     meshCells,
+		RenderSeconds: time.Since(start).Seconds(),
+		Vertices:      len(m.Vertices),
+		Triangles:     len(m.Faces),
+	}
+	exportProperties(m, report)
+
+	// write the mesh outputs (and previews), then the reports
+	report.Files = make([]ExportFile, len(j.Outputs))
+	write := func(i int) {
+		var err error
+		o := &j.Outputs[i]
+		f := &report.Files[i]
+		f.Path, f.Format = o.Path, exportFormat(o)
+		_, span := StartSpan(ctx, "export", Attribute{"path", f.Path}, Attribute{"format", f.Format})
+		defer func() {
+			span.Count("bytes", f.Bytes)
+			span.End(err)
+		}()
+		t := time.Now()
+		switch {
+		case f.Format == ".png":
+			err = SavePreviewPNG(o.Path, m, o.Preview)
+		case f.Format == ".json":
+			err = saveExportReport(o.Path, report)
+		case o.Exporter != nil:
+			err = o.Exporter(o.Path, m)
+		default:
+			registry.Lock()
+			fn := registry.exporters[f.Format]
+			registry.Unlock()
+			err = fn(o.Path, m)
+		}
+		f.Seconds = time.Since(t).Seconds()
+		if err != nil {
+			f.Err = err.Error()
+			return
+		}
+		if info, err := os.Stat(o.Path); err == nil {
+			f.Bytes = info.Size()
+		}
+	}
+	g := DefaultPool().Group()
+	for i := range j.Outputs {
+		i := i
+		if exportFormat(&j.Outputs[i]) != ".json" {
+			g.Go(func() { write(i) })
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for i := range j.Outputs {
+		if exportFormat(&j.Outputs[i]) == ".json" {
+			write(i)
+		}
+	}
+	for _, f := range report.Files {
+		if f.Err != "" {
+			return report, sdf.ErrMsg(fmt.Sprintf("%s: %s", f.Path, f.Err))
+		}
+	}
+	return report, nil
+}
+
+// exportProperties sets the mesh properties of a report.
+func exportProperties(m *Mesh, r *ExportReport) {
+	if len(m.Vertices) != 0 {
+		r.Box = sdf.Box3{m.Vertices[0], m.Vertices[0]}
+		for _, v := range m.Vertices {
+			r.Box = r.Box.Include(v)
+		}
+	}
+	var moment sdf.V3
+	for _, f := range m.Faces {
+		a, b, c := m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]
+		n := b.Sub(a).Cross(c.Sub(a))
+		r.Area += 0.5 * n.Length()
+		// signed tetrahedron from the origin
+		v := a.Dot(b.Cross(c)) / 6
+		r.Volume += v
+		moment = moment.Add(a.Add(b).Add(c).MulScalar(v / 4))
+	}
+	if r.Volume != 0 {
+		r.Center = moment.DivScalar(r.Volume)
+	}
+}
+
+// saveExportReport writes a report as JSON (the reports are written last, so their own files have no results).
+func saveExportReport(path string, r *ExportReport) error {
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+//-----------------------------------------------------------------------------
+// Previews
+
+// previewAxes returns the right and up directions of a view (z is up unless looking along z).
+func previewAxes(view sdf.V3) (sdf.V3, sdf.V3) {
+	up := sdf.V3{0, 0, 1}
+	if math.Abs(view.Z) > 0.99 {
+		up = sdf.V3{0, 1, 0}
+	}
+	right := view.Cross(up).Normalize()
+	return right, right.Cross(view)
+}
+
+// MeshPreview returns a flat shaded orthographic view of a mesh, fitted to the image.
+func MeshPreview(m *Mesh, cfg *PreviewConfig) (*image.RGBA, error) {
+	if cfg == nil {
+		cfg = &PreviewConfig{}
+	}
+	k := *cfg
+	if k.Pixels == (sdf.V2i{}) {
+		k.Pixels = sdf.V2i{512, 512}
+	}
+	if k.Pixels[0] <= 0 || k.Pixels[1] <= 0 {
+		return nil, sdf.ErrMsg("bad preview size")
+	}
+	if k.View == (sdf.V3{}) {
+		k.View = sdf.V3{-1, 1, -1}
+	}
+	if k.Color == (color.RGBA{}) {
+		k.Color = color.RGBA{200, 200, 200, 255}
+	}
+	if len(m.Faces) == 0 {
+		return nil, sdf.ErrMsg("empty mesh")
+	}
+	view := k.View.Normalize()
+	right, up := previewAxes(view)
+
+	// project the vertices, fitted to the image with a margin
+	w, h := k.Pixels[0], k.Pixels[1]
+	p := make([]sdf.V3, len(m.Vertices))
+	min, max := sdf.V2{math.Inf(1), math.Inf(1)}, sdf.V2{math.Inf(-1), math.Inf(-1)}
+	for i, v := range m.Vertices {
+		q := sdf.V2{v.Dot(right), v.Dot(up)}
+		min, max = min.Min(q), max.Max(q)
+		p[i] = sdf.V3{q.X, q.Y, v.Dot(view)}
+	}
+	size := max.Sub(min)
+	scale := 0.9 * math.Min(float64(w)/math.Max(size.X, 1e-12), float64(h)/math.Max(size.Y, 1e-12))
+	center := min.Add(max).MulScalar(0.5)
+	for i, q := range p {
+		p[i].X = 0.5*float64(w) + (q.X-center.X)*scale
+		p[i].Y = 0.5*float64(h) - (q.Y-center.Y)*scale
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	depth := make([]float64, w*h)
+	for i := range depth {
+		depth[i] = math.Inf(1)
+		img.SetRGBA(i%w, i/w, k.Background)
+	}
+	for _, f := range m.Faces {
+		a, b, c := m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]
+		n := b.Sub(a).Cross(c.Sub(a))
+		l := n.Length()
+		if l == 0 || n.Dot(view) >= 0 {
+			// degenerate or facing away
+			continue
+		}
+		shade := 0.25 + 0.75*(-n.Dot(view)/l)
+		col := color.RGBA{
+			uint8(float64(k.Color.R) * shade),
+			uint8(float64(k.Color.G) * shade),
+			uint8(float64(k.Color.B) * shade),
+			k.Color.A,
+		}
+		previewTriangle(p[f[0]], p[f[1]], p[f[2]], w, h, func(x, y int, z float64) {
+			if i := y*w + x; z < depth[i] {
+				depth[i] = z
+				img.SetRGBA(x, y, col)
+			}
+		})
+	}
+	return img, nil
+}
+
+// previewTriangle calls fn for the pixels (centers) within a projected triangle, with their depth.
+func previewTriangle(a, b, c sdf.V3, w, h int, fn func(x, y int, z float64)) {
+	det := (b.X-a.X)*(c.Y-a.Y) - (c.X-a.X)*(b.Y-a.Y)
+	if det == 0 {
+		return
+	}
+	x0 := int(math.Max(math.Floor(math.Min(a.X, math.Min(b.X, c.X))), 0))
+	x1 := int(math.Min(math.Ceil(math.Max(a.X, math.Max(b.X, c.X))), float64(w-1)))
+	y0 := int(math.Max(math.Floor(math.Min(a.Y, math.Min(b.Y, c.Y))), 0))
+	y1 := int(math.Min(math.Ceil(math.Max(a.Y, math.Max(b.Y, c.Y))), float64(h-1)))
+	for y := y0; y <= y1; y++ {
+		py := float64(y) + 0.5
+		for x := x0; x <= x1; x++ {
+			px := float64(x) + 0.5
+			u := ((px-a.X)*(c.Y-a.Y) - (c.X-a.X)*(py-a.Y)) / det
+			v := ((b.X-a.X)*(py-a.Y) - (px-a.X)*(b.Y-a.Y)) / det
+			if u < 0 || v < 0 || u+v > 1 {
+				continue
+			}
+			fn(x, y, a.Z+u*(b.Z-a.Z)+v*(c.Z-a.Z))
+		}
+	}
+}
+
+// SavePreviewPNG writes a preview of a mesh (see MeshPreview) to a PNG file.
+func SavePreviewPNG(path string, m *Mesh, cfg *PreviewConfig) error {
+	img, err := MeshPreview(m, cfg)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b.Bytes(), 0644)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,153 @@
+//-----------------------------------------------------------------------------
+/*
+
+Planar Faces
+
+Segment an indexed mesh into near-planar faces for print preparation and
+simplified drawings. Triangles are grown into faces (largest first) while
+their normals are within an angle of the seed normal. Each face has a
+plane fitted through its area centroid (area weighted normal) and the
+flatness is the largest distance of its vertices from that plane.
+
+A face needs supports when it overhangs, i.e. it faces down (against the
+build direction) by more than the overhang angle from vertical, and it is
+not on the build plate (the lowest level of the mesh).
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// FaceConfig sets the segmentation of a mesh into planar faces.
+type FaceConfig struct {
+	MaxAngle      float64 // maximum normal deviation within a face (radians, 0: 5 degrees)
+	MinArea       float64 // faces with a smaller area are not reported (but are counted in the totals)
+	OverhangAngle float64 // maximum surface angle from vertical without supports (radians, 0: 45 degrees)
+	Up            sdf.V3  // build direction (zero: +z)
+}
+
+// PlanarFace is a near-planar face of a mesh.
+type PlanarFace struct {
+	Triangles []int    // indices of the mesh faces
+	Area      float64  // surface area
+	Centroid  sdf.V3   // area centroid (a point on the fitted plane)
+	Normal    sdf.V3   // outward normal of the fitted plane
+	Flatness  float64  // largest distance of a vertex from the fitted plane
+	Overhang  float64  // surface angle from vertical (radians, > 0: faces down)
+	Support   bool     // the face needs supports
+	Box       sdf.Box3 // bounding box of the face
+}
+
+// FaceReport is the result of a planar face segmentation.
+type FaceReport struct {
+	Faces       []PlanarFace // faces with at least the minimum area (largest first)
+	Area        float64      // total surface area
+	SupportArea float64      // area of the faces needing supports
+}
+
+// faceAngle is the default maximum normal deviation within a face.
+const faceAngle = 5 * sdf.Pi / 180
+
+// overhangAngle is the default maximum overhang angle without supports.
+const overhangAngle = 45 * sdf.Pi / 180
+
+// plateTolerance is the height (fraction of the mesh size) of the build plate level.
+const plateTolerance = 1e-3
+
+//-----------------------------------------------------------------------------
+
+// MeshFaces segments an indexed mesh into near-planar faces.
+func MeshFaces(m *Mesh, cfg *FaceConfig) (*FaceReport, error) {
+	if cfg == nil {
+		cfg = &FaceConfig{}
+	}
+	maxAngle := cfg.MaxAngle
+	if maxAngle == 0 {
+		maxAngle = faceAngle
+	}
+	if maxAngle < 0 || maxAngle >= sdf.Pi/2 {
+		return nil, sdf.ErrMsg("face angle must be between 0 and 90 degrees")
+	}
+	overhang := cfg.OverhangAngle
+	if overhang == 0 {
+		overhang = overhangAngle
+	}
+	if overhang < 0 || overhang > sdf.Pi/2 {
+		return nil, sdf.ErrMsg("overhang angle must be between 0 and 90 degrees")
+	}
+	up := cfg.Up
+	if up == (sdf.V3{}) {
+		up = sdf.V3{0, 0, 1}
+	}
+	up = up.Normalize()
+
+	// triangle areas and normals, seeded from the largest triangle
+	areas := make([]float64, len(m.Faces))
+	normals := make([]sdf.V3, len(m.Faces))
+	order := make([]int, len(m.Faces))
+	for i, f := range m.Faces {
+		v0, v1, v2 := m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]
+		n := v1.Sub(v0).Cross(v2.Sub(v0))
+		areas[i] = 0.5 * n.Length()
+		normals[i] = n.Normalize()
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return areas[order[i]] > areas[order[j]] })
+
+	// the build plate level
+	plate := math.Inf(1)
+	for _, v := range m.Vertices {
+		plate = math.Min(plate, v.Dot(up))
+	}
+	plate += plateTolerance * m.bounds().Size().MaxComponent()
+
+	r := &FaceReport{}
+	for _, tris := range m.growRegions(normals, order, math.Cos(maxAngle)) {
+		f := PlanarFace{Triangles: tris}
+		var n, c sdf.V3
+		for _, i := range tris {
+			t := m.Faces[i]
+			a := areas[i]
+			f.Area += a
+			n = n.Add(normals[i].MulScalar(a))
+			c = c.Add(m.Vertices[t[0]].Add(m.Vertices[t[1]]).Add(m.Vertices[t[2]]).MulScalar(a / 3))
+		}
+		r.Area += f.Area
+		if f.Area == 0 {
+			continue
+		}
+		f.Centroid = c.DivScalar(f.Area)
+		f.Normal = n.Normalize()
+		f.Box = sdf.Box3{m.Vertices[m.Faces[tris[0]][0]], m.Vertices[m.Faces[tris[0]][0]]}
+		onPlate := true
+		for _, i := range tris {
+			for _, vi := range m.Faces[i] {
+				v := m.Vertices[vi]
+				f.Flatness = math.Max(f.Flatness, math.Abs(v.Sub(f.Centroid).Dot(f.Normal)))
+				f.Box = f.Box.Include(v)
+				onPlate = onPlate && v.Dot(up) <= plate
+			}
+		}
+		f.Overhang = math.Asin(sdf.Clamp(-f.Normal.Dot(up), -1, 1))
+		f.Support = f.Overhang > overhang && !onPlate
+		if f.Support {
+			r.SupportArea += f.Area
+		}
+		if f.Area >= cfg.MinArea {
+			r.Faces = append(r.Faces, f)
+		}
+	}
+	sort.SliceStable(r.Faces, func(i, j int) bool { return r.Faces[i].Area > r.Faces[j].Area })
+	return r, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,195 @@
+//-----------------------------------------------------------------------------
+/*
+
+Field Cache
+
+Uniform marching cubes with the sampled distance grid stored on disk.
+The cache key is a hash of the SDF tree (sdf.ModelHash) and the sampling
+lattice, so re-rendering an unchanged model at the same resolution reads
+the grid from disk rather than evaluating the SDF. Uncacheable models
+(see sdf.CacheKey) are evaluated without the cache.
+
+Grids are stored as raw float64 slabs: (nx+1) * (ny+1) * (nz+1) * 8 bytes.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// MarchingCubesCached renders using uniform marching cubes, caching the sampled distance grid on disk.
+type MarchingCubesCached struct {
+	Dir        string          // cache directory
+	Tolerances *sdf.Tolerances // nil: derived from the bounding box
+	Resolution *Resolution     // nil: cubic cells
+}
+
+// FieldCacheKey returns the key for the sampled distance grid of a uniform render.
+// Uncacheable models (see sdf.CacheKey) aren't identified by their key.
+func FieldCacheKey(s sdf.SDF3, meshCells int) string {
+	key, _ := fieldCacheKey(s, meshCells, nil)
+	return key
+}
+
+// fieldCacheKey returns the key for the sampled distance grid of a uniform render with a resolution,
+// and false if the model is uncacheable.
+func fieldCacheKey(s sdf.SDF3, meshCells int, res *Resolution) (string, bool) {
+	base, inc, steps := uniformLattice(s, meshCells, res)
+	key, ok := sdf.CacheKey(s)
+	h := sha256.New()
+	fmt.Fprintf(h, "mc-grid %s %d %v %v %v", key, meshCells, base, inc, steps)
+	return hex.EncodeToString(h.Sum(nil)), ok
+}
+
+// path returns the cache file for an SDF, and false if the SDF is uncacheable.
+func (m *MarchingCubesCached) path(s sdf.SDF3, meshCells int) (string, bool) {
+	key, ok := fieldCacheKey(s, meshCells, m.Resolution)
+	return filepath.Join(m.Dir, key+".grid"), ok
+}
+
+// Cached returns true if the sampled distance grid for the render is in the cache.
+func (m *MarchingCubesCached) Cached(s sdf.SDF3, meshCells int) bool {
+	path, ok := m.path(s, meshCells)
+	if !ok {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Info returns a string describing the rendered volume.
+func (m *MarchingCubesCached) Info(s sdf.SDF3, meshCells int) string {
+	_, _, steps := uniformLattice(s, meshCells, m.Resolution)
+	state := "not cached"
+	if m.Cached(s, meshCells) {
+		state = "cached"
+	}
+	return fmt.Sprintf("%dx%dx%d, %s", steps[0], steps[1], steps[2], state)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It panics if the cache can't be read or written.
+func (m *MarchingCubesCached) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	if err := m.RenderCached(s, meshCells, output); err != nil {
+		panic(err)
+	}
+}
+
+// RenderCached produces a 3d triangle mesh over the bounding volume of an sdf3,
+// reading the sampled distance grid from the cache, or evaluating and caching it.
+func (m *MarchingCubesCached) RenderCached(s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	return m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext is RenderCached, aborted with ctx.Err() when the context is done.
+// The cache is only written for a complete render.
+func (m *MarchingCubesCached) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	if m.Dir == "" {
+		return sdf.ErrMsg("no cache directory")
+	}
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	eps := modelTolerances(s, m.Tolerances).Vertex
+	emit := func(tris []*Triangle3) {
+		for _, t := range tris {
+			output <- t
+		}
+	}
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+	slabSize := int64(steps[1]+1) * int64(steps[2]+1) * 8
+	path, ok := m.path(s, meshCells)
+	if !ok {
+		// the grid of an uncacheable model is evaluated
+		if err := marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, steps: steps, eps: eps, emit: emit}); err != nil {
+			return err
+		}
+		progress.Done()
+		return nil
+	}
+	buf := make([]byte, slabSize)
+
+	f, err := os.Open(path)
+	if err == nil {
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if info.Size() != int64(steps[0]+1)*slabSize {
+			return sdf.ErrMsg(fmt.Sprintf("bad cache file %s", path))
+		}
+		// read the grid from the cache
+		r := bufio.NewReader(f)
+		read := func(x int, xs, ys, zs []float64, out []float64) error {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return err
+			}
+			for i := range out {
+				out[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[8*i:]))
+			}
+			return nil
+		}
+		if err := marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, steps: steps, eps: eps, emit: emit, sample: read}); err != nil {
+			return err
+		}
+		progress.Done()
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	// evaluate the grid and write it to the cache
+	tmp := path + ".tmp"
+	f, err = os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	write := func(x int, xs, ys, zs []float64, out []float64) error {
+		if err := mcEvaluateLayer(s, xs[x], ys, zs, out); err != nil {
+			return err
+		}
+		for i, v := range out {
+			binary.LittleEndian.PutUint64(buf[8*i:], math.Float64bits(v))
+		}
+		_, err := w.Write(buf)
+		return err
+	}
+	if err := marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, steps: steps, eps: eps, emit: emit, sample: write}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	progress.Done()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,125 @@
+//-----------------------------------------------------------------------------
+/*
+
+GPU Grid Sampling
+
+Evaluate compiled SDF3s (see sdf.Compile3) on a compute device. A device
+runs a kernel generated for the program (see Source) over a batch of
+points, after the host leaves of the program are evaluated on the host.
+
+The devices are registered by the backends selected with build tags
+(opencl: OpenCL, see opencl.go). Without a device the programs are run on
+the CPU.
+
+An accelerated SDF3 implements sdf.SDF3Batch, so the grid sampling of the
+renderers (marching cubes, dual contouring) evaluates it a batch at a time.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gpu
+
+import (
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Device is a compute device running the kernels of compiled SDF3s.
+type Device interface {
+	// Name returns the device name.
+	Name() string
+	// Evaluate runs a program at a batch of points with the values of its host leaves.
+	// It may be called concurrently.
+	Evaluate(p *sdf.Program, pts []sdf.V3, hosts [][]float64, out []float64) error
+}
+
+var devices = struct {
+	sync.Mutex
+	d []Device
+}{}
+
+// Register adds a compute device. Devices registered earlier are preferred.
+func Register(d Device) {
+	devices.Lock()
+	defer devices.Unlock()
+	devices.d = append(devices.d, d)
+}
+
+// Devices returns the registered compute devices.
+func Devices() []Device {
+	devices.Lock()
+	defer devices.Unlock()
+	return append([]Device(nil), devices.d...)
+}
+
+//-----------------------------------------------------------------------------
+
+// SDF3 is an SDF3 evaluated on a compute device.
+type SDF3 struct {
+	prog *sdf.Program
+	dev  Device // nil: the CPU
+	mu   sync.Mutex
+	err  error
+}
+
+// Accelerate compiles an SDF3 for evaluation on a compute device (nil: the first registered device).
+// Without a device the compiled SDF3 is run on the CPU.
+func Accelerate(s sdf.SDF3, d Device) *SDF3 {
+	if d == nil {
+		if dl := Devices(); len(dl) != 0 {
+			d = dl[0]
+		}
+	}
+	return &SDF3{prog: sdf.Compile3(s), dev: d}
+}
+
+// Device returns the name of the compute device ("cpu": none).
+func (s *SDF3) Device() string {
+	if s.dev == nil {
+		return "cpu"
+	}
+	return s.dev.Name()
+}
+
+// Err returns the first error of the compute device. The batches that failed were run on the CPU.
+func (s *SDF3) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Evaluate returns the minimum distance to the SDF3 (a single point is run on the CPU).
+func (s *SDF3) Evaluate(p sdf.V3) float64 {
+	return s.prog.Evaluate(p)
+}
+
+// EvaluateN evaluates the SDF3 at a batch of points.
+func (s *SDF3) EvaluateN(p []sdf.V3, out []float64) {
+	hosts := make([][]float64, len(s.prog.Hosts))
+	for i := range hosts {
+		hosts[i] = make([]float64, len(p))
+	}
+	s.prog.EvaluateHosts(p, hosts)
+	if s.dev != nil {
+		err := s.dev.Evaluate(s.prog, p, hosts, out)
+		if err == nil {
+			return
+		}
+		s.mu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+	}
+	s.prog.Run(p, hosts, out)
+}
+
+// BoundingBox returns the bounding box of the SDF3.
+func (s *SDF3) BoundingBox() sdf.Box3 {
+	return s.prog.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
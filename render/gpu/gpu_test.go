@@ -0,0 +1,195 @@
+//-----------------------------------------------------------------------------
+/*
+
+GPU Tests
+
+The generated kernels are compiled as C (with the OpenCL qualifiers
+defined away) and run on the CPU, when a C compiler is available.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gpu
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// testModels returns models of the primitives and operations of compiled programs.
+func testModels() []struct {
+	name string
+	s    sdf.SDF3
+} {
+	sphere, _ := sdf.Sphere3D(0.8)
+	box, _ := sdf.Box3D(sdf.V3{1.2, 0.8, 0.6}, 0.1)
+	cylinder, _ := sdf.Cylinder3D(1.5, 0.4, 0.05)
+	capsule, _ := sdf.Capsule3D(1.2, 0.3)
+	blend := sdf.Union3D(sphere, sdf.Transform3D(box, sdf.Translate3d(sdf.V3{0.7, 0, 0})))
+	blend.(*sdf.UnionSDF3).SetMin(sdf.RoundMin(0.2))
+	return []struct {
+		name string
+		s    sdf.SDF3
+	}{
+		{"sphere", sdf.Transform3D(sphere, sdf.Translate3d(sdf.V3{0.2, -0.1, 0.3}))},
+		{"box", sdf.Transform3D(box, sdf.RotateZ(0.3).Mul(sdf.RotateX(0.2)))},
+		{"cylinder", cylinder},
+		{"union", sdf.ScaleUniform3D(sdf.Union3D(sphere, sdf.Transform3D(cylinder, sdf.Translate3d(sdf.V3{0.5, 0, 0}))), 1.5)},
+		{"difference", sdf.Difference3D(box, cylinder)},
+		{"intersection", sdf.Intersect3D(box, sdf.Transform3D(sphere, sdf.Translate3d(sdf.V3{0.4, 0, 0})))},
+		// host leaves
+		{"capsule", sdf.Union3D(capsule, sphere)},
+		{"blend", blend},
+	}
+}
+
+// testPoints returns points in and around the box of a model.
+func testPoints(s sdf.SDF3) []sdf.V3 {
+	bb := s.BoundingBox().ScaleAboutCenter(1.5)
+	var p []sdf.V3
+	for i := 0; i < 64; i++ {
+		f := func(k int) float64 { return math.Mod(float64(i*k)*0.6180339887, 1) }
+		p = append(p, bb.Min.Add(bb.Size().Mul(sdf.V3{f(1), f(7), f(13)})))
+	}
+	return p
+}
+
+//-----------------------------------------------------------------------------
+
+// failDevice is a compute device that always fails.
+type failDevice struct{}
+
+var errDevice = errors.New("device failure")
+
+func (failDevice) Name() string { return "fail" }
+
+func (failDevice) Evaluate(p *sdf.Program, pts []sdf.V3, hosts [][]float64, out []float64) error {
+	return errDevice
+}
+
+func Test_CPU(t *testing.T) {
+	for _, v := range testModels() {
+		pts := testPoints(v.s)
+		// without a device, and with a failing device the batches fall back to the CPU
+		for _, d := range []Device{nil, failDevice{}} {
+			a := Accelerate(v.s, d)
+			if d == nil && len(Devices()) == 0 && a.Device() != "cpu" {
+				t.Errorf("%s: expected the cpu, actual %s", v.name, a.Device())
+			}
+			out := make([]float64, len(pts))
+			a.EvaluateN(pts, out)
+			for i, p := range pts {
+				if d := v.s.Evaluate(p); math.Abs(out[i]-d) > 1e-9 {
+					t.Fatalf("%s: at %v expected %g, actual %g", v.name, p, d, out[i])
+				}
+			}
+			if d != nil && a.Err() != errDevice {
+				t.Errorf("%s: expected %v, actual %v", v.name, errDevice, a.Err())
+			}
+		}
+		if !Accelerate(v.s, nil).BoundingBox().Equals(v.s.BoundingBox(), 1e-9) {
+			t.Errorf("%s: bad bounding box", v.name)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// kernelPrelude defines the OpenCL qualifiers and work item functions for a C compiler.
+const kernelPrelude = `#include <math.h>
+#include <stdio.h>
+#define __kernel
+#define __global
+static int sdfx_id;
+#define get_global_id(x) sdfx_id
+`
+
+// runKernel compiles the kernel source of a program as C and runs it at points.
+func runKernel(t *testing.T, cc, dir string, p *sdf.Program, pts []sdf.V3, double bool) []float64 {
+	t.Helper()
+	hosts := make([][]float64, len(p.Hosts))
+	for i := range hosts {
+		hosts[i] = make([]float64, len(pts))
+	}
+	p.EvaluateHosts(pts, hosts)
+	var b strings.Builder
+	b.WriteString(kernelPrelude)
+	b.WriteString(Source(p, double))
+	b.WriteString("\nstatic const real pts[] = {")
+	for _, v := range pts {
+		fmt.Fprintf(&b, "%.17e, %.17e, %.17e, ", v.X, v.Y, v.Z)
+	}
+	b.WriteString("0};\nstatic const real host[] = {")
+	for _, h := range hosts {
+		for _, x := range h {
+			fmt.Fprintf(&b, "%.17e, ", x)
+		}
+	}
+	fmt.Fprintf(&b, "0};\nstatic real out[%d];\n", len(pts))
+	fmt.Fprintf(&b, "int main(void) {\n\tfor (sdfx_id = 0; sdfx_id < %d; sdfx_id++) {\n", len(pts))
+	fmt.Fprintf(&b, "\t\t%s(pts, host, out, %d);\n\t\tprintf(\"%%.17g\\n\", (double)out[sdfx_id]);\n\t}\n\treturn 0;\n}\n", KernelName, len(pts))
+	src, bin := filepath.Join(dir, "kernel.c"), filepath.Join(dir, "kernel")
+	if err := ioutil.WriteFile(src, []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command(cc, "-o", bin, src, "-lm").CombinedOutput(); err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	out, err := exec.Command(bin).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d []float64
+	for _, l := range strings.Fields(string(out)) {
+		x, err := strconv.ParseFloat(l, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d = append(d, x)
+	}
+	if len(d) != len(pts) {
+		t.Fatalf("expected %d values, actual %d", len(pts), len(d))
+	}
+	return d
+}
+
+func Test_Source(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	dir, err := ioutil.TempDir("", "kernel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, v := range testModels() {
+		p := sdf.Compile3(v.s)
+		pts := testPoints(v.s)
+		for _, k := range []struct {
+			double    bool
+			tolerance float64
+		}{{true, 1e-9}, {false, 1e-4}} {
+			d := runKernel(t, cc, dir, p, pts, k.double)
+			for i, x := range pts {
+				if expected := v.s.Evaluate(x); math.Abs(d[i]-expected) > k.tolerance {
+					t.Fatalf("%s (double %v): at %v expected %g, actual %g", v.name, k.double, x, expected, d[i])
+				}
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
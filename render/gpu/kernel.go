@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------
+/*
+
+Kernel Source
+
+Generate the OpenCL C source of the kernel for a compiled SDF3. The
+operations of the program are unrolled into straight line code with the
+parameters as constants, and the distance stack entries are variables.
+
+	__kernel void sdfx_evaluate(
+		__global const real *p,    // points (x, y, z), n
+		__global const real *host, // values of the host leaves, n per leaf
+		__global real *out,        // distances, n
+		const int n)
+
+*/
+//-----------------------------------------------------------------------------
+
+package gpu
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// KernelName is the name of the generated kernel.
+const KernelName = "sdfx_evaluate"
+
+const kernelFunctions = `
+real sdfx_box3(real x, real y, real z, real sx, real sy, real sz) {
+	real dx = fabs(x) - sx, dy = fabs(y) - sy, dz = fabs(z) - sz;
+	real ox = fmax(dx, (real)0), oy = fmax(dy, (real)0), oz = fmax(dz, (real)0);
+	return sqrt(ox*ox + oy*oy + oz*oz) + fmin(fmax(dx, fmax(dy, dz)), (real)0);
+}
+
+real sdfx_box2(real x, real y, real sx, real sy) {
+	real dx = fabs(x) - sx, dy = fabs(y) - sy;
+	real ox = fmax(dx, (real)0), oy = fmax(dy, (real)0);
+	return sqrt(ox*ox + oy*oy) + fmin(fmax(dx, dy), (real)0);
+}
+`
+
+// Source returns the OpenCL C source of the kernel for a program,
+// with double or single precision arithmetic.
+func Source(p *sdf.Program, double bool) string {
+	lit := func(x float64) string {
+		if double {
+			return fmt.Sprintf("(%.17e)", x)
+		}
+		return fmt.Sprintf("(%.9ef)", x)
+	}
+	var b strings.Builder
+	if double {
+		b.WriteString("#pragma OPENCL EXTENSION cl_khr_fp64 : enable\ntypedef double real;\n")
+	} else {
+		b.WriteString("typedef float real;\n")
+	}
+	b.WriteString(kernelFunctions)
+	fmt.Fprintf(&b, "\n__kernel void %s(__global const real *p, __global const real *host, __global real *out, const int n) {\n", KernelName)
+	b.WriteString("\tint i = get_global_id(0);\n\tif (i >= n) {\n\t\treturn;\n\t}\n")
+	b.WriteString("\treal x = p[3*i], y = p[3*i+1], z = p[3*i+2];\n")
+	b.WriteString("\treal qx, qy, qz;\n")
+	for k := 0; k < p.Depth; k++ {
+		fmt.Fprintf(&b, "\treal d%d;\n", k)
+	}
+	n := 0
+	for _, op := range p.Ops {
+		switch op.Code {
+		case sdf.OpHost:
+			fmt.Fprintf(&b, "\td%d = host[%d*n + i];\n", n, op.Arg)
+			n++
+			continue
+		case sdf.OpScale:
+			fmt.Fprintf(&b, "\td%d *= %s;\n", n-1, lit(p.Params[op.Arg]))
+			continue
+		case sdf.OpMin:
+			fmt.Fprintf(&b, "\td%d = fmin(d%d, d%d);\n", n-2, n-2, n-1)
+			n--
+			continue
+		case sdf.OpMax:
+			fmt.Fprintf(&b, "\td%d = fmax(d%d, d%d);\n", n-2, n-2, n-1)
+			n--
+			continue
+		case sdf.OpMaxNeg:
+			fmt.Fprintf(&b, "\td%d = fmax(d%d, -d%d);\n", n-2, n-2, n-1)
+			n--
+			continue
+		}
+		// leaf: map the point
+		a := p.Params[op.Arg:]
+		for r, q := range []string{"qx", "qy", "qz"} {
+			fmt.Fprintf(&b, "\t%s = %s*x + %s*y + %s*z + %s;\n", q, lit(a[4*r]), lit(a[4*r+1]), lit(a[4*r+2]), lit(a[4*r+3]))
+		}
+		switch op.Code {
+		case sdf.OpSphere:
+			fmt.Fprintf(&b, "\td%d = sqrt(qx*qx + qy*qy + qz*qz) - %s;\n", n, lit(a[12]))
+		case sdf.OpBox:
+			fmt.Fprintf(&b, "\td%d = sdfx_box3(qx, qy, qz, %s, %s, %s) - %s;\n", n, lit(a[12]), lit(a[13]), lit(a[14]), lit(a[15]))
+		case sdf.OpCylinder:
+			fmt.Fprintf(&b, "\td%d = sdfx_box2(sqrt(qx*qx + qy*qy), qz, %s, %s) - %s;\n", n, lit(a[13]), lit(a[12]), lit(a[14]))
+		}
+		n++
+	}
+	b.WriteString("\tout[i] = d0;\n}\n")
+	return b.String()
+}
+
+//-----------------------------------------------------------------------------
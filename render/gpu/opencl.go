@@ -0,0 +1,249 @@
+//go:build opencl
+// +build opencl
+
+//-----------------------------------------------------------------------------
+/*
+
+OpenCL Devices
+
+Build with -tags opencl to register the OpenCL devices (GPUs first).
+Devices with cl_khr_fp64 run double precision kernels, the others run
+single precision kernels. The kernels are built once per program.
+
+*/
+//-----------------------------------------------------------------------------
+
+package gpu
+
+/*
+#cgo linux LDFLAGS: -lOpenCL
+#cgo darwin LDFLAGS: -framework OpenCL
+#define CL_TARGET_OPENCL_VERSION 120
+#ifdef __APPLE__
+#include <OpenCL/opencl.h>
+#else
+#include <CL/cl.h>
+#endif
+#include <stdlib.h>
+
+static cl_program sdfx_program(cl_context ctx, const char *src, cl_int *err) {
+	return clCreateProgramWithSource(ctx, 1, &src, NULL, err);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// clDevice is an OpenCL device.
+type clDevice struct {
+	name    string
+	id      C.cl_device_id
+	ctx     C.cl_context
+	queue   C.cl_command_queue
+	double  bool
+	mu      sync.Mutex
+	kernels map[*sdf.Program]C.cl_kernel
+}
+
+func init() {
+	var n C.cl_uint
+	if C.clGetPlatformIDs(0, nil, &n) != C.CL_SUCCESS || n == 0 {
+		return
+	}
+	platforms := make([]C.cl_platform_id, n)
+	C.clGetPlatformIDs(n, &platforms[0], nil)
+	for _, t := range []C.cl_device_type{C.CL_DEVICE_TYPE_GPU, C.CL_DEVICE_TYPE_ACCELERATOR | C.CL_DEVICE_TYPE_CPU} {
+		for _, p := range platforms {
+			var m C.cl_uint
+			if C.clGetDeviceIDs(p, t, 0, nil, &m) != C.CL_SUCCESS || m == 0 {
+				continue
+			}
+			ids := make([]C.cl_device_id, m)
+			C.clGetDeviceIDs(p, t, m, &ids[0], nil)
+			for _, id := range ids {
+				if d, err := newCLDevice(id); err == nil {
+					Register(d)
+				}
+			}
+		}
+	}
+}
+
+// clInfo returns a string parameter of a device.
+func clInfo(id C.cl_device_id, param C.cl_device_info) string {
+	var size C.size_t
+	if C.clGetDeviceInfo(id, param, 0, nil, &size) != C.CL_SUCCESS || size == 0 {
+		return ""
+	}
+	b := make([]byte, size)
+	C.clGetDeviceInfo(id, param, size, unsafe.Pointer(&b[0]), nil)
+	return strings.TrimRight(string(b), "\x00")
+}
+
+func clError(what string, err C.cl_int) error {
+	return fmt.Errorf("opencl: %s failed (%d)", what, int(err))
+}
+
+func newCLDevice(id C.cl_device_id) (*clDevice, error) {
+	var err C.cl_int
+	ctx := C.clCreateContext(nil, 1, &id, nil, nil, &err)
+	if err != C.CL_SUCCESS {
+		return nil, clError("clCreateContext", err)
+	}
+	queue := C.clCreateCommandQueue(ctx, id, 0, &err)
+	if err != C.CL_SUCCESS {
+		C.clReleaseContext(ctx)
+		return nil, clError("clCreateCommandQueue", err)
+	}
+	return &clDevice{
+		name:    clInfo(id, C.CL_DEVICE_NAME),
+		id:      id,
+		ctx:     ctx,
+		queue:   queue,
+		double:  strings.Contains(clInfo(id, C.CL_DEVICE_EXTENSIONS), "cl_khr_fp64"),
+		kernels: make(map[*sdf.Program]C.cl_kernel),
+	}, nil
+}
+
+// Name returns the device name.
+func (d *clDevice) Name() string {
+	return "opencl: " + d.name
+}
+
+// kernel returns the kernel of a program, building it on first use. Call with the lock held.
+func (d *clDevice) kernel(p *sdf.Program) (C.cl_kernel, error) {
+	if k, ok := d.kernels[p]; ok {
+		return k, nil
+	}
+	src := C.CString(Source(p, d.double))
+	defer C.free(unsafe.Pointer(src))
+	var err C.cl_int
+	prog := C.sdfx_program(d.ctx, src, &err)
+	if err != C.CL_SUCCESS {
+		return nil, clError("clCreateProgramWithSource", err)
+	}
+	defer C.clReleaseProgram(prog)
+	if err = C.clBuildProgram(prog, 1, &d.id, nil, nil, nil); err != C.CL_SUCCESS {
+		return nil, clError("clBuildProgram", err)
+	}
+	name := C.CString(KernelName)
+	defer C.free(unsafe.Pointer(name))
+	k := C.clCreateKernel(prog, name, &err)
+	if err != C.CL_SUCCESS {
+		return nil, clError("clCreateKernel", err)
+	}
+	d.kernels[p] = k
+	return k, nil
+}
+
+// buffer returns a device buffer (with a copy of data if not nil).
+func (d *clDevice) buffer(flags C.cl_mem_flags, size int, data unsafe.Pointer) (C.cl_mem, error) {
+	if data != nil {
+		flags |= C.CL_MEM_COPY_HOST_PTR
+	}
+	var err C.cl_int
+	m := C.clCreateBuffer(d.ctx, flags, C.size_t(size), data, &err)
+	if err != C.CL_SUCCESS {
+		return nil, clError("clCreateBuffer", err)
+	}
+	return m, nil
+}
+
+// Evaluate runs a program at a batch of points with the values of its host leaves.
+func (d *clDevice) Evaluate(p *sdf.Program, pts []sdf.V3, hosts [][]float64, out []float64) error {
+	n := len(pts)
+	if n == 0 {
+		return nil
+	}
+	// the points and host values in the precision of the kernel
+	pv := make([]float64, 0, 3*n+1)
+	for _, x := range pts {
+		pv = append(pv, x.X, x.Y, x.Z)
+	}
+	hv := make([]float64, 0, len(hosts)*n+1)
+	for _, h := range hosts {
+		hv = append(hv, h[:n]...)
+	}
+	hv = append(hv, 0) // non-empty buffer
+	size := 8
+	pData, hData := unsafe.Pointer(&pv[0]), unsafe.Pointer(&hv[0])
+	ov := make([]float64, n)
+	var of []float32
+	oData := unsafe.Pointer(&ov[0])
+	if !d.double {
+		size = 4
+		pf, hf := make([]float32, len(pv)), make([]float32, len(hv))
+		for i, x := range pv {
+			pf[i] = float32(x)
+		}
+		for i, x := range hv {
+			hf[i] = float32(x)
+		}
+		of = make([]float32, n)
+		pData, hData, oData = unsafe.Pointer(&pf[0]), unsafe.Pointer(&hf[0]), unsafe.Pointer(&of[0])
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k, err := d.kernel(p)
+	if err != nil {
+		return err
+	}
+	pm, err := d.buffer(C.CL_MEM_READ_ONLY, size*len(pv), pData)
+	if err != nil {
+		return err
+	}
+	defer C.clReleaseMemObject(pm)
+	hm, err := d.buffer(C.CL_MEM_READ_ONLY, size*len(hv), hData)
+	if err != nil {
+		return err
+	}
+	defer C.clReleaseMemObject(hm)
+	om, err := d.buffer(C.CL_MEM_WRITE_ONLY, size*n, nil)
+	if err != nil {
+		return err
+	}
+	defer C.clReleaseMemObject(om)
+	cn := C.cl_int(n)
+	memSize := C.size_t(unsafe.Sizeof(pm))
+	for i, arg := range []struct {
+		size C.size_t
+		p    unsafe.Pointer
+	}{
+		{memSize, unsafe.Pointer(&pm)},
+		{memSize, unsafe.Pointer(&hm)},
+		{memSize, unsafe.Pointer(&om)},
+		{C.size_t(unsafe.Sizeof(cn)), unsafe.Pointer(&cn)},
+	} {
+		if e := C.clSetKernelArg(k, C.cl_uint(i), arg.size, arg.p); e != C.CL_SUCCESS {
+			return clError("clSetKernelArg", e)
+		}
+	}
+	const group = 64
+	global := C.size_t((n + group - 1) / group * group)
+	if e := C.clEnqueueNDRangeKernel(d.queue, k, 1, nil, &global, nil, 0, nil, nil); e != C.CL_SUCCESS {
+		return clError("clEnqueueNDRangeKernel", e)
+	}
+	if e := C.clEnqueueReadBuffer(d.queue, om, C.CL_TRUE, 0, C.size_t(size*n), oData, 0, nil, nil); e != C.CL_SUCCESS {
+		return clError("clEnqueueReadBuffer", e)
+	}
+	if d.double {
+		copy(out, ov)
+		return nil
+	}
+	for i, x := range of {
+		out[i] = float64(x)
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
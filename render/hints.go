@@ -0,0 +1,51 @@
+//-----------------------------------------------------------------------------
+/*
+
+Resolution Hints
+
+Fine mesh cells are only needed near small features. A resolution hint
+gives the maximum cell size within a region, so an adaptive renderer can
+use fine cells within the region and coarse cells elsewhere.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import "github.com/deadsy/sdfx/sdf"
+
+//-----------------------------------------------------------------------------
+
+// ResolutionHint requests a maximum mesh cell size within a region.
+// Hints are used by the octree dual contouring renderer (dc.DualContouringV1), the other
+// renderers (e.g. MarchingCubesUniform, MarchingCubesOctree, dc.DualContouringV2) use
+// uniform cells and ignore them.
+type ResolutionHint struct {
+	Region   sdf.SDF3 // region of the hint (inside: distance <= 0)
+	CellSize float64  // maximum cell size within the region
+}
+
+// HintCellSize returns the cell size to use for a box: the smallest hint cell size
+// of the regions intersecting the box, or size if that is smaller.
+func HintCellSize(hints []ResolutionHint, box sdf.Box3, size float64) float64 {
+	r := 0.5 * box.Size().Length()
+	c := box.Center()
+	for _, h := range hints {
+		if h.CellSize < size && h.Region.Evaluate(c) <= r {
+			size = h.CellSize
+		}
+	}
+	return size
+}
+
+// MinHintCellSize returns the smallest hint cell size, or size if that is smaller.
+func MinHintCellSize(hints []ResolutionHint, size float64) float64 {
+	for _, h := range hints {
+		if h.CellSize < size {
+			size = h.CellSize
+		}
+	}
+	return size
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,347 @@
+//-----------------------------------------------------------------------------
+/*
+
+Incremental Rendering
+
+Uniform marching cubes that re-renders a changed model by re-sampling only
+the part of the lattice the change can affect, for interactive parameter
+tweaking of large models.
+
+The lattice is divided into bricks of cubes, and the renderer keeps the
+sampled field and the triangles of each brick. On a re-render the changed
+region of the model (see sdf.ChangedRegion3) seeds the bricks to re-sample.
+Changes can spread beyond the region, so when the values on a face of a
+re-sampled brick change near the surface, the brick across the face is
+re-sampled too. Far from the surface the values can change (e.g. the
+distance to a moved part) without changing the triangles.
+
+Changes are found by node hashing, which identifies functions by name, so
+a change of the values captured by a closure (e.g. the blend radius of a
+smooth min function) isn't seen.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// brickSize is the default number of cubes on each side of a brick.
+const brickSize = 16
+
+// MarchingCubesIncremental renders using uniform marching cubes, and re-renders
+// a changed model by re-sampling only the bricks of cubes the change can affect.
+// It keeps the state of the last render, so each renderer is used for the revisions
+// of one model.
+type MarchingCubesIncremental struct {
+	BrickSize  int             // cubes on each side of a brick (0: 16)
+	Tolerances *sdf.Tolerances // nil: derived from the bounding box
+	Resolution *Resolution     // nil: cubic cells
+	mu         sync.Mutex
+	state      *incrementalState
+	stats      IncrementalStats
+}
+
+// IncrementalStats is the work done by the last render of an incremental renderer.
+type IncrementalStats struct {
+	Full      bool // the model was rendered from scratch
+	Bricks    int  // number of bricks
+	Resampled int  // number of bricks re-sampled
+}
+
+// incrementalState is the sampled field and the triangles of the last render.
+type incrementalState struct {
+	model      sdf.SDF3
+	meshCells  int
+	resolution Resolution
+	brick      int
+	base, inc  sdf.V3
+	steps      sdf.V3i        // cubes on each axis
+	box        sdf.Box3       // volume of the lattice
+	bricks     sdf.V3i        // bricks on each axis
+	grid       []float64      // field values at the lattice points
+	triangles  [][]*Triangle3 // triangles of each brick
+}
+
+//-----------------------------------------------------------------------------
+
+// node returns the index of a lattice point.
+func (st *incrementalState) node(x, y, z int) int {
+	return (x*(st.steps[1]+1)+y)*(st.steps[2]+1) + z
+}
+
+// brickIndex returns the index of a brick.
+func (st *incrementalState) brickIndex(b sdf.V3i) int {
+	return (b[0]*st.bricks[1]+b[1])*st.bricks[2] + b[2]
+}
+
+// brickCubes returns the first cube and the number of cubes on each axis of a brick.
+func (st *incrementalState) brickCubes(b sdf.V3i) (sdf.V3i, sdf.V3i) {
+	var ofs, n sdf.V3i
+	for i := 0; i < 3; i++ {
+		ofs[i] = b[i] * st.brick
+		n[i] = st.brick
+		if ofs[i]+n[i] > st.steps[i] {
+			n[i] = st.steps[i] - ofs[i]
+		}
+	}
+	return ofs, n
+}
+
+// brickRange returns the bricks containing the lattice points within a box.
+// It returns false if there are none.
+func (st *incrementalState) brickRange(box sdf.Box3) (sdf.V3i, sdf.V3i, bool) {
+	var b0, b1 sdf.V3i
+	min, max := box.Min.Sub(st.base).Div(st.inc), box.Max.Sub(st.base).Div(st.inc)
+	for i, x := range [3][2]float64{{min.X, max.X}, {min.Y, max.Y}, {min.Z, max.Z}} {
+		lo := int(math.Ceil(math.Max(x[0], 0)))
+		hi := int(math.Floor(math.Min(x[1], float64(st.steps[i]))))
+		if lo > hi {
+			return b0, b1, false
+		}
+		// a lattice point on a brick boundary belongs to the bricks on both sides
+		b0[i] = (lo - 1) / st.brick
+		if lo == 0 {
+			b0[i] = 0
+		}
+		b1[i] = hi / st.brick
+		if b1[i] >= st.bricks[i] {
+			b1[i] = st.bricks[i] - 1
+		}
+	}
+	return b0, b1, true
+}
+
+//-----------------------------------------------------------------------------
+
+// Info returns a string describing the rendered volume.
+func (r *MarchingCubesIncremental) Info(s sdf.SDF3, meshCells int) string {
+	_, _, steps := uniformLattice(s, meshCells, r.Resolution)
+	return fmt.Sprintf("%dx%dx%d", steps[0], steps[1], steps[2])
+}
+
+// Stats returns the work done by the last render.
+func (r *MarchingCubesIncremental) Stats() IncrementalStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+func (r *MarchingCubesIncremental) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	r.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3, re-sampling
+// only the bricks the changes from the last render can affect. The model is rendered from
+// scratch the first time, if the resolution changes, or if the model outgrows the lattice.
+// It returns ctx.Err() if the context is done before the render is complete, and the next
+// render is then from scratch.
+func (r *MarchingCubesIncremental) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	brick := r.BrickSize
+	if brick == 0 {
+		brick = brickSize
+	}
+	if brick < 1 {
+		return sdf.ErrMsg("brick size < 1")
+	}
+	tol := modelTolerances(s, r.Tolerances)
+
+	var res Resolution
+	if r.Resolution != nil {
+		res = *r.Resolution
+	}
+
+	st := r.state
+	r.state = nil
+	full := st == nil || st.meshCells != meshCells || st.resolution != res || st.brick != brick
+	if !full {
+		bb := s.BoundingBox()
+		full = !st.box.Contains(bb.Min) || !st.box.Contains(bb.Max)
+	}
+	var seed []sdf.V3i
+	if full {
+		st = &incrementalState{model: s, meshCells: meshCells, resolution: res, brick: brick}
+		st.base, st.inc, st.steps = uniformLattice(s, meshCells, &res)
+		st.box = sdf.Box3{st.base, st.base.Add(st.steps.ToV3().Mul(st.inc))}
+		for i := 0; i < 3; i++ {
+			st.bricks[i] = (st.steps[i] + brick - 1) / brick
+		}
+		st.grid = make([]float64, (st.steps[0]+1)*(st.steps[1]+1)*(st.steps[2]+1))
+		st.triangles = make([][]*Triangle3, st.bricks[0]*st.bricks[1]*st.bricks[2])
+		for x := 0; x < st.bricks[0]; x++ {
+			for y := 0; y < st.bricks[1]; y++ {
+				for z := 0; z < st.bricks[2]; z++ {
+					seed = append(seed, sdf.V3i{x, y, z})
+				}
+			}
+		}
+	} else if region, changed := sdf.ChangedRegion3(st.model, s); changed {
+		// include the lattice points next to the region
+		if b0, b1, ok := st.brickRange(region.Enlarge(st.inc.MulScalar(2))); ok {
+			for x := b0[0]; x <= b1[0]; x++ {
+				for y := b0[1]; y <= b1[1]; y++ {
+					for z := b0[2]; z <= b1[2]; z++ {
+						seed = append(seed, sdf.V3i{x, y, z})
+					}
+				}
+			}
+		}
+	}
+	st.model = s
+	progress := StartProgress(ctx, int64(st.steps[0])*int64(st.steps[1])*int64(st.steps[2]))
+
+	// a value change matters if it is near the surface (or changes sign)
+	near := 2 * st.inc.MaxComponent()
+	matters := func(v0, v1 float64) bool {
+		return math.Abs(v1-v0) > tol.Vertex && ((v0 < 0) != (v1 < 0) || math.Min(math.Abs(v0), math.Abs(v1)) < near)
+	}
+
+	// re-sample the bricks, spreading across the faces with changes that matter
+	resampled := make([]bool, len(st.triangles))
+	for _, b := range seed {
+		resampled[st.brickIndex(b)] = true
+	}
+	count := 0
+	for len(seed) != 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		count += len(seed)
+		values := make([][]float64, len(seed))
+		g := DefaultPool().Group()
+		for i, b := range seed {
+			i, b := i, b
+			g.Go(func() { values[i] = st.sample(s, b) })
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		var next []sdf.V3i
+		for i, b := range seed {
+			for _, nb := range st.store(b, values[i], !full, matters) {
+				if k := st.brickIndex(nb); !resampled[k] {
+					resampled[k] = true
+					next = append(next, nb)
+				}
+			}
+		}
+		seed = next
+	}
+
+	// re-mesh the re-sampled bricks
+	g := DefaultPool().Group()
+	for x := 0; x < st.bricks[0]; x++ {
+		for y := 0; y < st.bricks[1]; y++ {
+			for z := 0; z < st.bricks[2]; z++ {
+				b := sdf.V3i{x, y, z}
+				k := st.brickIndex(b)
+				if !resampled[k] {
+					continue
+				}
+				g.Go(func() { st.triangles[k] = st.mesh(ctx, s, b, tol.Vertex) })
+			}
+		}
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, tris := range st.triangles {
+		for _, t := range tris {
+			output <- t
+		}
+	}
+	r.state = st
+	r.stats = IncrementalStats{full, len(st.triangles), count}
+	progress.Done()
+	return nil
+}
+
+// sample returns the field values at the lattice points of a brick.
+func (st *incrementalState) sample(s sdf.SDF3, b sdf.V3i) []float64 {
+	ofs, n := st.brickCubes(b)
+	points := make([]sdf.V3, 0, (n[0]+1)*(n[1]+1)*(n[2]+1))
+	for x := 0; x <= n[0]; x++ {
+		for y := 0; y <= n[1]; y++ {
+			for z := 0; z <= n[2]; z++ {
+				points = append(points, sdf.V3i{ofs[0] + x, ofs[1] + y, ofs[2] + z}.ToV3().Mul(st.inc).Add(st.base))
+			}
+		}
+	}
+	values := make([]float64, len(points))
+	sdf.EvaluateN(s, points, values)
+	return values
+}
+
+// store writes the sampled values of a brick to the grid. If check is true, it returns the
+// neighbouring bricks across the faces with value changes that matter.
+func (st *incrementalState) store(b sdf.V3i, values []float64, check bool, matters func(v0, v1 float64) bool) []sdf.V3i {
+	ofs, n := st.brickCubes(b)
+	var spread [3][2]bool
+	i := 0
+	for x := 0; x <= n[0]; x++ {
+		for y := 0; y <= n[1]; y++ {
+			for z := 0; z <= n[2]; z++ {
+				k := st.node(ofs[0]+x, ofs[1]+y, ofs[2]+z)
+				if check && matters(st.grid[k], values[i]) {
+					for axis, c := range [3]int{x, y, z} {
+						if c == 0 {
+							spread[axis][0] = true
+						}
+						if c == n[axis] {
+							spread[axis][1] = true
+						}
+					}
+				}
+				st.grid[k] = values[i]
+				i++
+			}
+		}
+	}
+	var neighbours []sdf.V3i
+	for axis := range spread {
+		for side, ok := range spread[axis] {
+			nb := b
+			nb[axis] += 2*side - 1
+			if ok && nb[axis] >= 0 && nb[axis] < st.bricks[axis] {
+				neighbours = append(neighbours, nb)
+			}
+		}
+	}
+	return neighbours
+}
+
+// mesh returns the marching cubes triangles of a brick.
+func (st *incrementalState) mesh(ctx context.Context, s sdf.SDF3, b sdf.V3i, eps float64) []*Triangle3 {
+	ofs, n := st.brickCubes(b)
+	sample := func(x int, xs, ys, zs []float64, out []float64) error {
+		for y := range ys {
+			for z := range zs {
+				out[y*len(zs)+z] = st.grid[st.node(ofs[0]+x, ofs[1]+y, ofs[2]+z)]
+			}
+		}
+		return nil
+	}
+	var triangles []*Triangle3
+	emit := func(t []*Triangle3) { triangles = append(triangles, t...) }
+	// errors are from the context, and are checked by the caller
+	marchingCubesSlabs(ctx, s, &mcSlabs{base: st.base, inc: st.inc, ofs: ofs, steps: n, eps: eps, emit: emit, sample: sample})
+	return triangles
+}
+
+//-----------------------------------------------------------------------------
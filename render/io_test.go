@@ -0,0 +1,573 @@
+//-----------------------------------------------------------------------------
+/*
+
+I/O Tests: occupancy grids, export jobs, triangle buffers, checkpoints,
+field caches, STL streams and AMF files.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"image/color"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+func Test_Occupancy(t *testing.T) {
+	s0, _ := sdf.Sphere3D(1)
+	s1, _ := sdf.Box3D(sdf.V3{1.5, 0.5, 0.5}, 0)
+	s := sdf.Difference3D(s0, s1)
+	var buf bytes.Buffer
+	if err := render.WriteOccupancy(&buf, s, 20); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	o, err := render.ReadOccupancy(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.Size[0] < 20 || o.Size[1] < 20 || o.Size[2] < 20 {
+		t.Fatalf("expected at least 20 voxels on each axis, actual %v", o.Size)
+	}
+	occupied := 0
+	for z := 0; z < o.Size[2]; z++ {
+		for y := 0; y < o.Size[1]; y++ {
+			for x := 0; x < o.Size[0]; x++ {
+				inside := s.Evaluate(o.Center(x, y, z)) <= 0
+				if o.Occupied(x, y, z) != inside {
+					t.Fatalf("voxel %d,%d,%d: expected %v", x, y, z, inside)
+				}
+				if inside {
+					occupied++
+				}
+			}
+		}
+	}
+	if occupied == 0 {
+		t.Error("no occupied voxels")
+	}
+	if o.Occupied(-1, 0, 0) || o.Occupied(0, 0, o.Size[2]) {
+		t.Error("voxels outside the grid are occupied")
+	}
+
+	// corrupt files
+	const hdr = 8 + 3*4 + 6*8
+	long := append([]byte(nil), data...)
+	long[hdr+1] = 0x7f // the first run is longer than the scanline
+	short := append([]byte(nil), data...)
+	short[hdr+1]-- // the first scanline is too short
+	large := append([]byte(nil), data...)
+	for i := 0; i < 3; i++ {
+		binary.LittleEndian.PutUint32(large[8+4*i:], 1<<20)
+	}
+	empty := append([]byte(nil), data...)
+	binary.LittleEndian.PutUint32(empty[8:], 0)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"long run", long},
+		{"short scanline", short},
+		{"truncated", data[:len(data)-1]},
+		{"large grid", large},
+		{"empty grid", empty},
+		{"magic", append([]byte("SDFXOCC0"), data[8:]...)},
+	}
+	for _, v := range tests {
+		if _, err := render.ReadOccupancy(bytes.NewReader(v.data)); err == nil {
+			t.Errorf("%s: expected an error", v.name)
+		}
+	}
+}
+
+func Test_ExportJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sphere, _ := sdf.Sphere3D(1)
+	job := &render.ExportJob{
+		SDF:       sphere,
+		MeshCells: 20,
+		Renderer:  &render.MarchingCubesUniform{},
+		Outputs: []render.ExportOutput{
+			{Path: filepath.Join(dir, "a.stl")},
+			{Path: filepath.Join(dir, "a.png"), Preview: &render.PreviewConfig{Pixels: sdf.V2i{64, 48}}},
+			{Path: filepath.Join(dir, "a.json")},
+		},
+	}
+	report, err := job.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Triangles == 0 || math.Abs(report.Volume-4.0/3*math.Pi) > 0.05*4.0/3*math.Pi {
+		t.Errorf("expected a sphere, actual %d triangles with volume %g", report.Triangles, report.Volume)
+	}
+	for i, f := range report.Files {
+		info, err := os.Stat(job.Outputs[i].Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the report is written last, so its own size isn't known
+		if f.Err != "" || info.Size() == 0 || (f.Format != ".json" && f.Bytes != info.Size()) {
+			t.Errorf("%s: expected %d bytes, actual %d (%s)", f.Path, info.Size(), f.Bytes, f.Err)
+		}
+	}
+	b, _ := ioutil.ReadFile(job.Outputs[2].Path)
+	var r render.ExportReport
+	if err := json.Unmarshal(b, &r); err != nil || r.Triangles != report.Triangles || len(r.Files) != 3 {
+		t.Errorf("bad report %s (%v)", b, err)
+	}
+	// the outputs are checked before rendering
+	job.Outputs = append(job.Outputs, render.ExportOutput{Path: filepath.Join(dir, "a.xyz")})
+	if _, err := job.Run(context.Background()); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func Test_MeshPreview(t *testing.T) {
+	box, _ := sdf.Box3D(sdf.V3{2, 1, 1}, 0)
+	m := meshOf(t, box, 20, &render.MarchingCubesUniform{})
+	img, err := render.MeshPreview(m, &render.PreviewConfig{Pixels: sdf.V2i{64, 48}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 64 || b.Dy() != 48 {
+		t.Fatalf("expected 64x48 pixels, actual %v", b)
+	}
+	// the model is in the middle, the corners are the (transparent) background
+	if img.RGBAAt(32, 24).A == 0 || img.RGBAAt(0, 0) != (color.RGBA{}) {
+		t.Errorf("expected the model in the middle, actual %v %v", img.RGBAAt(32, 24), img.RGBAAt(0, 0))
+	}
+	if _, err := render.MeshPreview(&render.Mesh{}, nil); err == nil {
+		t.Error("expected an error for an empty mesh")
+	}
+}
+
+func Test_TriangleBuffer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tribuf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	mapped, err := render.NewMappedTriangleBuffer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffers := []struct {
+		name string
+		b    *render.TriangleBuffer
+	}{
+		{"memory", render.NewTriangleBuffer()},
+		{"mapped", mapped},
+	}
+	// enough triangles to grow the buffers a few times
+	s, _ := sdf.Sphere3D(1)
+	tris := render.ToTriangles(s, 40, &render.MarchingCubesUniform{})
+	for _, v := range buffers {
+		for _, tri := range tris {
+			if err := v.b.Add(tri); err != nil {
+				t.Fatalf("%s: %v", v.name, err)
+			}
+		}
+		if v.b.Len() != len(tris) {
+			t.Fatalf("%s: expected %d triangles, actual %d", v.name, len(tris), v.b.Len())
+		}
+		for i, tri := range tris {
+			if *v.b.At(i) != *tri {
+				t.Fatalf("%s: triangle %d is %v, expected %v", v.name, i, v.b.At(i), tri)
+			}
+		}
+		path := filepath.Join(dir, v.name+".stl")
+		if err := v.b.SaveSTL(path); err != nil {
+			t.Fatal(err)
+		}
+		m, err := render.LoadSTL(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Faces) != len(tris) {
+			t.Errorf("%s: expected %d faces in the STL file, actual %d", v.name, len(tris), len(m.Faces))
+		}
+		if err := v.b.Close(); err != nil {
+			t.Errorf("%s: %v", v.name, err)
+		}
+		os.Remove(path)
+	}
+	// the mapped file is removed by Close
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected no files, actual %d", len(files))
+	}
+	// a mapped render has the triangles of the channel render
+	b, err := render.ToTriangleBuffer(s, 40, &render.MarchingCubesUniform{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if b.Len() != len(tris) {
+		t.Errorf("expected %d rendered triangles, actual %d", len(tris), b.Len())
+	}
+}
+
+// triangleSet returns the number of times each triangle is in a slice.
+func triangleSet(tris []*render.Triangle3) map[render.Triangle3]int {
+	set := make(map[render.Triangle3]int)
+	for _, t := range tris {
+		set[*t]++
+	}
+	return set
+}
+
+// sameTriangles checks two slices have the same triangles (in any order).
+func sameTriangles(t *testing.T, name string, a, b []*render.Triangle3) {
+	t.Helper()
+	sa, sb := triangleSet(a), triangleSet(b)
+	if len(a) != len(b) || len(sa) != len(sb) {
+		t.Errorf("%s: expected %d triangles, actual %d", name, len(b), len(a))
+		return
+	}
+	for tri, n := range sb {
+		if sa[tri] != n {
+			t.Errorf("%s: triangle %v is missing", name, tri)
+			return
+		}
+	}
+}
+
+func Test_MarchingCubesCheckpoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sphere, _ := sdf.Sphere3D(1)
+	// several tiles, checkpointed every 4 layers
+	checkpoint := func(name string) *render.MarchingCubesCheckpoint {
+		return &render.MarchingCubesCheckpoint{Dir: filepath.Join(dir, name), Layers: 4, MemoryBudget: 1 << 18}
+	}
+	var full int64
+	expected, err := render.ToTrianglesContext(context.Background(), cancelSDF3{sphere, &full, 0, nil}, 40, checkpoint("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(render.ToTriangles(sphere, 40, &render.MarchingCubesUniform{})); len(expected) != n {
+		t.Errorf("expected %d triangles, actual %d", n, len(expected))
+	}
+
+	// interrupt a render halfway, then resume it
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int64
+	_, err = render.ToTrianglesContext(ctx, cancelSDF3{sphere, &n, full / 2, cancel}, 40, checkpoint("b"))
+	cancel()
+	if err != context.Canceled {
+		t.Fatalf("expected %v, actual %v", context.Canceled, err)
+	}
+	n = 0
+	tris, err := render.ToTrianglesContext(context.Background(), cancelSDF3{sphere, &n, 0, nil}, 40, checkpoint("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameTriangles(t, "resumed", tris, expected)
+	if n == 0 || n >= full {
+		t.Errorf("expected fewer than %d evaluations to resume, actual %d", full, n)
+	}
+
+	// a completed render is read back without evaluations
+	n = 0
+	tris, err = render.ToTrianglesContext(context.Background(), cancelSDF3{sphere, &n, 0, nil}, 40, checkpoint("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sameTriangles(t, "completed", tris, expected)
+	if n != 0 {
+		t.Errorf("expected no evaluations, actual %d", n)
+	}
+	// the checkpoint is for a 40 cell render
+	if _, err := render.ToTrianglesContext(context.Background(), sphere, 30, checkpoint("a")); err == nil {
+		t.Error("expected an error for a different render")
+	}
+}
+
+func Test_MarchingCubesCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fieldcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	r := &render.MarchingCubesCached{Dir: dir}
+	sphere, _ := sdf.Sphere3D(1)
+	expected := render.ToTriangles(sphere, 30, &render.MarchingCubesUniform{})
+	grids := func() int {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.grid"))
+		return len(files)
+	}
+
+	// a miss evaluates the grid and writes it to the cache
+	if r.Cached(sphere, 30) {
+		t.Fatal("expected an empty cache")
+	}
+	sameTriangles(t, "miss", render.ToTriangles(sphere, 30, r), expected)
+	if !r.Cached(sphere, 30) || grids() != 1 {
+		t.Fatalf("expected a cached grid, actual %d", grids())
+	}
+	// a hit reads the grid
+	sameTriangles(t, "hit", render.ToTriangles(sphere, 30, r), expected)
+	path := filepath.Join(dir, render.FieldCacheKey(sphere, 30)+".grid")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := render.ToTrianglesContext(context.Background(), sphere, 30, r); err == nil {
+		t.Error("expected an error for a truncated cache file")
+	}
+	os.Remove(path)
+
+	// other models and resolutions have their own grids
+	render.ToTriangles(sphere, 20, r)
+	render.ToTriangles(sphere, 30, r)
+	bigger, _ := sdf.Sphere3D(1.1)
+	render.ToTriangles(bigger, 30, r)
+	if grids() != 3 {
+		t.Errorf("expected 3 cached grids, actual %d", grids())
+	}
+	// uncacheable models (the cancel function is a closure) and interrupted renders aren't cached
+	_, never := context.WithCancel(context.Background())
+	defer never()
+	var n int64
+	uncacheable := cancelSDF3{sphere, &n, -1, never}
+	sameTriangles(t, "uncacheable", render.ToTriangles(uncacheable, 30, r), expected)
+	if r.Cached(uncacheable, 30) || n == 0 {
+		t.Errorf("expected an evaluated render, actual %d evaluations", n)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := render.ToTrianglesContext(ctx, sdf.Transform3D(sphere, sdf.Translate3d(sdf.V3{1, 0, 0})), 30, r); err != context.Canceled {
+		t.Errorf("expected %v, actual %v", context.Canceled, err)
+	}
+	if grids() != 3 {
+		t.Errorf("expected 3 cached grids, actual %d", grids())
+	}
+}
+
+// limitWriter fails the writes past a number of bytes.
+type limitWriter struct {
+	n int
+}
+
+var errLimit = errors.New("write limit")
+
+func (w *limitWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		return 0, errLimit
+	}
+	w.n -= len(b)
+	return len(b), nil
+}
+
+func Test_STLStream(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	n := len(render.ToTriangles(sphere, 30, &render.MarchingCubesUniform{}))
+	// a file has the triangle count in the header
+	dir, err := ioutil.TempDir("", "stlstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.stl")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := render.ToSTLStream(f, sphere, 30, &render.MarchingCubesUniform{}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	b, _ := ioutil.ReadFile(path)
+	if len(b) != 84+50*n || binary.LittleEndian.Uint32(b[80:]) != uint32(n) {
+		t.Errorf("expected %d triangles, actual %d bytes with a count of %d", n, len(b), binary.LittleEndian.Uint32(b[80:]))
+	}
+	m, err := render.LoadSTL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkWatertight(t, "file", m)
+	// a stream doesn't
+	var buf bytes.Buffer
+	if err := render.ToSTLStream(&buf, sphere, 30, &render.MarchingCubesUniform{}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 84+50*n || binary.LittleEndian.Uint32(buf.Bytes()[80:]) != 0 {
+		t.Errorf("expected %d triangles and no count, actual %d bytes", n, buf.Len())
+	}
+	// the first write error stops the render
+	if err := render.ToSTLStream(&limitWriter{84 + 50*n/2}, sphere, 30, &render.MarchingCubesUniform{}); err != errLimit {
+		t.Errorf("expected %v, actual %v", errLimit, err)
+	}
+}
+
+// amfFile is the part of the AMF schema written by SaveAMFObjects.
+type amfFile struct {
+	Unit      string `xml:"unit,attr"`
+	Materials []struct {
+		ID       int `xml:"id,attr"`
+		Metadata []struct {
+			Type  string `xml:"type,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"metadata"`
+	} `xml:"material"`
+	Objects []struct {
+		Vertices []struct {
+			X float64 `xml:"coordinates>x"`
+			Y float64 `xml:"coordinates>y"`
+			Z float64 `xml:"coordinates>z"`
+		} `xml:"mesh>vertices>vertex"`
+		Volumes []struct {
+			Material  int `xml:"materialid,attr"`
+			Triangles []struct {
+				V1 int `xml:"v1"`
+				V2 int `xml:"v2"`
+				V3 int `xml:"v3"`
+			} `xml:"triangle"`
+		} `xml:"mesh>volume"`
+	} `xml:"object"`
+}
+
+// loadAMF reads an AMF file (or a zip archive of one) and returns the meshes of the object volumes.
+func loadAMF(t *testing.T, path string, compressed bool) (*amfFile, [][]*render.Mesh) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if compressed {
+		info, _ := f.Stat()
+		z, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(z.File) != 1 {
+			t.Fatalf("expected 1 file in the archive, actual %d", len(z.File))
+		}
+		zf, err := z.File[0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zf.Close()
+		r = zf
+	}
+	var amf amfFile
+	if err := xml.NewDecoder(r).Decode(&amf); err != nil {
+		t.Fatal(err)
+	}
+	var objects [][]*render.Mesh
+	for _, o := range amf.Objects {
+		var vertices []sdf.V3
+		for _, v := range o.Vertices {
+			vertices = append(vertices, sdf.V3{v.X, v.Y, v.Z})
+		}
+		var volumes []*render.Mesh
+		for _, v := range o.Volumes {
+			m := &render.Mesh{Vertices: vertices}
+			for _, tri := range v.Triangles {
+				m.Faces = append(m.Faces, [3]int{tri.V1, tri.V2, tri.V3})
+			}
+			volumes = append(volumes, m)
+		}
+		objects = append(objects, volumes)
+	}
+	return &amf, objects
+}
+
+func Test_AMF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "amf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sphere, _ := sdf.Sphere3D(1)
+	box, _ := sdf.Box3D(sdf.V3{1, 1, 1}, 0)
+	box = sdf.Transform3D(box, sdf.Translate3d(sdf.V3{3, 0, 0}))
+	ms, mb := meshOf(t, sphere, 20, &render.MarchingCubesUniform{}), meshOf(t, box, 20, &render.MarchingCubesUniform{})
+	vs, _ := render.MeshMassProperties(ms.Triangles(), 1)
+
+	// a single mesh
+	path := filepath.Join(dir, "a.amf")
+	if err := render.SaveAMF(path, ms); err != nil {
+		t.Fatal(err)
+	}
+	amf, objects := loadAMF(t, path, false)
+	if amf.Unit != "millimeter" || len(objects) != 1 || len(objects[0]) != 1 {
+		t.Fatalf("expected 1 object with 1 volume in millimeters, actual %d objects in %q", len(objects), amf.Unit)
+	}
+	m := objects[0][0]
+	if len(m.Faces) != len(ms.Faces) {
+		t.Errorf("expected %d faces, actual %d", len(ms.Faces), len(m.Faces))
+	}
+	checkWatertight(t, "a.amf", m)
+	// float32 vertices
+	checkVolume(t, "a.amf", m, vs.Volume, 1e-5)
+
+	// two materials in a compressed file
+	cfg := &render.AMFConfig{
+		Unit:      "inch",
+		Materials: []render.AMFMaterial{{Name: "pla"}, {Name: "tpu & co"}},
+		Compress:  true,
+	}
+	obj := render.AMFObject{Name: "part", Volumes: []render.AMFVolume{{ms, 0}, {mb, 1}}}
+	path = filepath.Join(dir, "b.amf")
+	if err := render.SaveAMFObjects(path, []render.AMFObject{obj}, cfg); err != nil {
+		t.Fatal(err)
+	}
+	amf, objects = loadAMF(t, path, true)
+	if amf.Unit != "inch" || len(amf.Materials) != 2 || amf.Materials[1].Metadata[0].Value != "tpu & co" {
+		t.Errorf("bad unit %q or materials %v", amf.Unit, amf.Materials)
+	}
+	if len(objects) != 1 || len(objects[0]) != 2 {
+		t.Fatalf("expected 1 object with 2 volumes, actual %d objects", len(objects))
+	}
+	for i, v := range []struct {
+		name string
+		m    *render.Mesh
+	}{{"sphere", ms}, {"box", mb}} {
+		if id := amf.Objects[0].Volumes[i].Material; id != i+1 {
+			t.Errorf("%s: expected material %d, actual %d", v.name, i+1, id)
+		}
+		mp, _ := render.MeshMassProperties(v.m.Triangles(), 1)
+		checkWatertight(t, v.name, objects[0][i])
+		checkVolume(t, v.name, objects[0][i], mp.Volume, 1e-5)
+	}
+
+	// bad materials and units
+	if err := render.SaveAMFObjects(path, []render.AMFObject{obj}, nil); err == nil {
+		t.Error("expected an error for a missing material")
+	}
+	if err := render.SaveAMFObjects(path, nil, &render.AMFConfig{Unit: "parsec"}); err == nil {
+		t.Error("expected an error for an unknown unit")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,216 @@
+//-----------------------------------------------------------------------------
+/*
+
+Laminated Slice Stacks
+
+Slice a model into sheets of a given thickness (e.g. plywood or acrylic)
+to be laser cut and stacked. Each sheet is the slice through its middle
+(for the top sheet, the middle of the part within the model), with
+optional alignment holes (for dowels) cut through every sheet. The sheets
+are laid out on a grid and labelled with their number (from the bottom)
+and height, and are written as a DXF file with a layer per sheet or as an
+SVG file with a group per sheet.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	svg "github.com/ajstarks/svgo/float"
+	"github.com/deadsy/sdfx/sdf"
+	"github.com/yofu/dxf"
+)
+
+//-----------------------------------------------------------------------------
+
+// LaminateConfig sets the slicing of a model into stacked sheets.
+type LaminateConfig struct {
+	Pitch      float64  // sheet thickness, the distance between the slices on z
+	MeshCells  int      // cells on the longest axis of a slice (0: 200)
+	Holes      []sdf.V2 // alignment hole centers, cut through every sheet
+	HoleRadius float64  // alignment hole radius
+	Gap        float64  // gap between the sheets of the layout (0: 5% of the sheet size)
+	Columns    int      // sheets per row of the layout (0: about square)
+}
+
+// LaminateSheet is a sheet of a laminated model.
+type LaminateSheet struct {
+	Name   string  // sheet label
+	Z0, Z1 float64 // bottom and top of the sheet
+	Lines  []*Line // sheet outline (model coordinates)
+	Offset sdf.V2  // position of the sheet in the layout
+}
+
+// Laminate is a model sliced into stacked sheets.
+type Laminate struct {
+	Sheets []*LaminateSheet
+	bb     sdf.Box2 // slice area
+	text   float64  // label height
+}
+
+//-----------------------------------------------------------------------------
+
+// NewLaminate slices a model into sheets stacked on z.
+// Slices without material are skipped, so the sheet numbers may have gaps.
+func NewLaminate(s sdf.SDF3, cfg *LaminateConfig) (*Laminate, error) {
+	if cfg == nil || cfg.Pitch <= 0 {
+		return nil, sdf.ErrMsg("pitch must be > 0")
+	}
+	meshCells := cfg.MeshCells
+	if meshCells <= 0 {
+		meshCells = 200
+	}
+	bb3 := s.BoundingBox()
+	n := int(math.Ceil(bb3.Size().Z/cfg.Pitch - 1e-9))
+	if n < 1 {
+		n = 1
+	}
+	var holes sdf.SDF2
+	if len(cfg.Holes) != 0 {
+		if cfg.HoleRadius <= 0 {
+			return nil, sdf.ErrMsg("hole radius must be > 0")
+		}
+		var circles []sdf.SDF2
+		for _, p := range cfg.Holes {
+			c, err := sdf.Circle2D(cfg.HoleRadius)
+			if err != nil {
+				return nil, err
+			}
+			circles = append(circles, sdf.Transform2D(c, sdf.Translate2d(p)))
+		}
+		holes = sdf.Union2D(circles...)
+	}
+
+	// the sampled area, a cell larger than the model so the outlines are closed
+	bb0 := sdf.Box2{sdf.V2{bb3.Min.X, bb3.Min.Y}, sdf.V2{bb3.Max.X, bb3.Max.Y}}
+	inc := bb0.Size().MaxComponent() / float64(meshCells)
+	bb := sdf.NewBox2(bb0.Center(), bb0.Size().DivScalar(inc).Ceil().AddScalar(1).MulScalar(inc))
+
+	sheets := make([]*LaminateSheet, n)
+	errs := make([]error, n)
+	g := DefaultPool().Group()
+	for i := 0; i < n; i++ {
+		i := i
+		g.Go(func() {
+			z0 := bb3.Min.Z + float64(i)*cfg.Pitch
+			z1 := z0 + cfg.Pitch
+			// the top sheet may extend past the model
+			slice := sdf.Slice2D(s, sdf.V3{0, 0, (z0 + math.Min(z1, bb3.Max.Z)) / 2}, sdf.V3{0, 0, 1})
+			if holes != nil {
+				slice = sdf.Difference2D(slice, holes)
+			}
+			lines, err := marchingSquares(slice, bb, inc)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if len(lines) != 0 {
+				sheets[i] = &LaminateSheet{fmt.Sprintf("L%02d", i+1), z0, z1, lines, sdf.V2{}}
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	l := &Laminate{bb: bb0}
+	for _, sh := range sheets {
+		if sh != nil {
+			l.Sheets = append(l.Sheets, sh)
+		}
+	}
+	if len(l.Sheets) == 0 {
+		return nil, sdf.ErrMsg("no material in the slices")
+	}
+	l.layout(cfg)
+	return l, nil
+}
+
+// layout places the sheets on a grid, top row first.
+func (l *Laminate) layout(cfg *LaminateConfig) {
+	size := l.bb.Size()
+	l.text = 0.05 * size.MaxComponent()
+	gap := cfg.Gap
+	if gap <= 0 {
+		gap = 0.05 * size.MaxComponent()
+	}
+	cols := cfg.Columns
+	if cols <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(l.Sheets)))))
+	}
+	rows := (len(l.Sheets) + cols - 1) / cols
+	// each cell has a sheet and its label
+	cw, ch := size.X+gap, size.Y+2*l.text+gap
+	for i, sh := range l.Sheets {
+		col, row := i%cols, i/cols
+		cell := sdf.V2{float64(col) * cw, float64(rows-1-row) * ch}
+		sh.Offset = cell.Sub(l.bb.Min)
+	}
+}
+
+// label returns the label of a sheet and its position in the layout.
+func (l *Laminate) label(sh *LaminateSheet) (string, sdf.V2) {
+	p := sdf.V2{l.bb.Min.X, l.bb.Max.Y + 0.5*l.text}.Add(sh.Offset)
+	return fmt.Sprintf("%s z %g..%g", sh.Name, sh.Z0, sh.Z1), p
+}
+
+//-----------------------------------------------------------------------------
+
+// SaveDXF writes the sheet layout to a DXF file, a layer per sheet.
+func (l *Laminate) SaveDXF(path string) error {
+	d := dxf.NewDrawing()
+	for _, sh := range l.Sheets {
+		if _, err := d.AddLayer(sh.Name, dxf.DefaultColor, dxf.DefaultLineType, true); err != nil {
+			return err
+		}
+		for _, ln := range sh.Lines {
+			p0, p1 := ln[0].Add(sh.Offset), ln[1].Add(sh.Offset)
+			d.Line(p0.X, p0.Y, 0, p1.X, p1.Y, 0)
+		}
+		text, p := l.label(sh)
+		d.Text(text, p.X, p.Y, 0, l.text)
+	}
+	return d.SaveAs(path)
+}
+
+// SaveSVG writes the sheet layout to an SVG file, a group per sheet.
+func (l *Laminate) SaveSVG(path, lineStyle string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// the layout area (y is down in SVG)
+	var min, max sdf.V2
+	for i, sh := range l.Sheets {
+		b := sdf.Box2{l.bb.Min.Add(sh.Offset), l.bb.Max.Add(sh.Offset).Add(sdf.V2{0, 2 * l.text})}
+		if i == 0 {
+			min, max = b.Min, b.Max
+		}
+		min, max = min.Min(b.Min), max.Max(b.Max)
+	}
+	canvas := svg.New(f)
+	canvas.Start(max.X-min.X, max.Y-min.Y)
+	for _, sh := range l.Sheets {
+		canvas.Group(fmt.Sprintf("id=\"%s\"", sh.Name))
+		for _, ln := range sh.Lines {
+			p0, p1 := ln[0].Add(sh.Offset), ln[1].Add(sh.Offset)
+			canvas.Line(p0.X-min.X, max.Y-p0.Y, p1.X-min.X, max.Y-p1.Y, lineStyle)
+		}
+		text, p := l.label(sh)
+		canvas.Text(p.X-min.X, max.Y-p.Y, text, fmt.Sprintf("font-size:%gpx", l.text))
+		canvas.Gend()
+	}
+	canvas.End()
+	return f.Close()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,139 @@
+//-----------------------------------------------------------------------------
+/*
+
+Levels of Detail
+
+Render an SDF3 with uniform marching cubes at several levels of detail in
+a single sampling pass. The lattice of each level is 2x coarser than the
+one before, and its points are points of the finest lattice, so only the
+finest lattice is evaluated: each sampled x layer is also handed (every
+2nd, 4th, ... point) to the coarser levels, which are contoured at the
+same time.
+
+The coarsest cubes (8 fine cubes on a side) are within the culled blocks
+of the finest lattice (see mcCull), so the culled values can be shared.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// lodMaxLevels is the maximum number of levels of detail (the coarsest cubes are mcCullBlock fine cubes).
+const lodMaxLevels = 4
+
+// ToTrianglesLOD renders an SDF3 with uniform marching cubes at levels of detail, the lattice of
+// each level being 2x coarser than the one before, evaluating the SDF3 only for the finest lattice.
+// meshCells is the number of cells on the longest axis of the finest level (rounded up to a multiple
+// of 2^(levels-1)). The meshes are returned finest first. It returns ctx.Err() if the context is done
+// before the render is complete.
+func ToTrianglesLOD(ctx context.Context, s sdf.SDF3, meshCells, levels int) ([][]*Triangle3, error) {
+	if levels < 1 || levels > lodMaxLevels {
+		return nil, sdf.ErrMsg("levels must be 1 to 4")
+	}
+	if meshCells < 1 {
+		return nil, sdf.ErrMsg("meshCells < 1")
+	}
+	// the coarsest lattice, subdivided for the finer levels
+	f := 1 << uint(levels-1)
+	base, inc, steps := boxLattice(s.BoundingBox(), (meshCells+f-1)/f)
+	eps := modelTolerances(s, nil).Vertex
+	lattice := func(level int) (sdf.V3, sdf.V3i) {
+		k := f >> uint(level)
+		return inc.DivScalar(float64(k)), sdf.V3i{steps[0] * k, steps[1] * k, steps[2] * k}
+	}
+
+	incFine, stepsFine := lattice(0)
+	xs := mcLattice(base.X, incFine.X, 0, stepsFine[0])
+	ys := mcLattice(base.Y, incFine.Y, 0, stepsFine[1])
+	zs := mcLattice(base.Z, incFine.Z, 0, stepsFine[2])
+	evaluate := func(x int, xs, ys, zs []float64, out []float64) error {
+		return mcEvaluateLayer(s, xs[x], ys, zs, out)
+	}
+	if _, ok := s.(sdf.SDF3Interval); ok {
+		evaluate = newMCCull(s, xs, ys, zs).sample
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	meshes := make([][]*Triangle3, levels)
+	errs := make([]error, levels)
+	layers := make([]chan []float64, levels)
+	var wg sync.WaitGroup
+	for level := 1; level < levels; level++ {
+		level := level
+		layers[level] = make(chan []float64, 2)
+		// the coarse levels read the layers from the finest level
+		read := func(x int, xs, ys, zs []float64, out []float64) error {
+			select {
+			case v := <-layers[level]:
+				copy(out, v)
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			inc, steps := lattice(level)
+			emit := func(t []*Triangle3) {
+				meshes[level] = append(meshes[level], t...)
+			}
+			errs[level] = marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, steps: steps, eps: eps, emit: emit, sample: read})
+			if errs[level] != nil {
+				cancel()
+			}
+		}()
+	}
+
+	// sample the finest lattice, passing every 2^level point to the coarser levels
+	sample := func(x int, xs, ys, zs []float64, out []float64) error {
+		if err := evaluate(x, xs, ys, zs, out); err != nil {
+			return err
+		}
+		for level := 1; level < levels; level++ {
+			k := 1 << uint(level)
+			if x%k != 0 {
+				continue
+			}
+			ny, nz := (len(ys)-1)/k+1, (len(zs)-1)/k+1
+			v := make([]float64, ny*nz)
+			for i := 0; i < ny; i++ {
+				for j := 0; j < nz; j++ {
+					v[i*nz+j] = out[i*k*len(zs)+j*k]
+				}
+			}
+			select {
+			case layers[level] <- v:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+	emit := func(t []*Triangle3) {
+		meshes[0] = append(meshes[0], t...)
+	}
+	errs[0] = marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: incFine, steps: stepsFine, eps: eps, emit: emit, sample: sample})
+	if errs[0] != nil {
+		cancel()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return meshes, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -33,7 +33,8 @@ func newLineCache(base, inc sdf.V2, steps sdf.V2i) *lineCache {
 }
 
 // evaluate the SDF2 over a given x line.
-func (l *lineCache) evaluate(s sdf.SDF2, x int) {
+// It returns an error if an evaluation panicked.
+func (l *lineCache) evaluate(s sdf.SDF2, x int) error {
 
 	// Swap the layers
 	l.val0, l.val1 = l.val1, l.val0
@@ -46,18 +47,23 @@ func (l *lineCache) evaluate(s sdf.SDF2, x int) {
 		l.val1 = make([]float64, ny+1)
 	}
 
-	// setup the loop variables
-	idx := 0
-	var p sdf.V2
-	p.X = l.base.X + float64(x)*dx
-
-	// evaluate the line
-	p.Y = l.base.Y
-	for y := 0; y < ny+1; y++ {
-		l.val1[idx] = s.Evaluate(p)
-		idx++
-		p.Y += dy
+	// evaluate the line in batches
+	x0 := l.base.X + float64(x)*dx
+	const batchSize = 100
+	g := DefaultPool().Group()
+	for y0 := 0; y0 < ny+1; y0 += batchSize {
+		y0 := y0
+		g.Go(func() {
+			y1 := y0 + batchSize
+			if y1 > ny+1 {
+				y1 = ny + 1
+			}
+			for y := y0; y < y1; y++ {
+				l.val1[y] = s.Evaluate(sdf.V2{x0, l.base.Y + float64(y)*dy})
+			}
+		})
 	}
+	return g.Wait()
 }
 
 // get a value from a line cache.
@@ -70,7 +76,7 @@ func (l *lineCache) get(x, y int) float64 {
 
 //-----------------------------------------------------------------------------
 
-func marchingSquares(s sdf.SDF2, box sdf.Box2, step float64) []*Line {
+func marchingSquares(s sdf.SDF2, box sdf.Box2, step float64) ([]*Line, error) {
 
 	var lines []*Line
 	size := box.Size()
@@ -81,7 +87,9 @@ func marchingSquares(s sdf.SDF2, box sdf.Box2, step float64) []*Line {
 	// create the line cache
 	l := newLineCache(base, inc, steps)
 	// evaluate the SDF for x = 0
-	l.evaluate(s, 0)
+	if err := l.evaluate(s, 0); err != nil {
+		return nil, err
+	}
 
 	nx, ny := steps[0], steps[1]
 	dx, dy := inc.X, inc.Y
@@ -90,7 +98,9 @@ func marchingSquares(s sdf.SDF2, box sdf.Box2, step float64) []*Line {
 	p.X = base.X
 	for x := 0; x < nx; x++ {
 		// read the x + 1 layer
-		l.evaluate(s, x+1)
+		if err := l.evaluate(s, x+1); err != nil {
+			return nil, err
+		}
 		// process all squares in the x and x + 1 layers
 		p.Y = base.Y
 		for y := 0; y < ny; y++ {
@@ -114,7 +124,7 @@ func marchingSquares(s sdf.SDF2, box sdf.Box2, step float64) []*Line {
 		p.X += dx
 	}
 
-	return lines
+	return lines, nil
 }
 
 //-----------------------------------------------------------------------------
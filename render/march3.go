@@ -11,10 +11,9 @@ Convert an SDF3 to a triangle mesh.
 package render
 
 import (
+	"context"
 	"fmt"
 	"math"
-	"runtime"
-	"sync"
 
 	"github.com/deadsy/sdfx/sdf"
 )
@@ -22,106 +21,92 @@ import (
 //-----------------------------------------------------------------------------
 
 type layerYZ struct {
-	base  sdf.V3    // base coordinate of layer
-	inc   sdf.V3    // dx, dy, dz for each step
-	steps sdf.V3i   // number of x,y,z steps
-	val0  []float64 // SDF values for x layer
-	val1  []float64 // SDF values for x + dx layer
+	x, y, z []float64 // x,y,z lattice coordinates
+	val0    []float64 // SDF values for x layer
+	val1    []float64 // SDF values for x + dx layer
 }
 
-func newLayerYZ(base, inc sdf.V3, steps sdf.V3i) *layerYZ {
-	return &layerYZ{base, inc, steps, nil, nil}
+func newLayerYZ(x, y, z []float64) *layerYZ {
+	return &layerYZ{x, y, z, nil, nil}
 }
 
 // evalReq is used for processing evaluations in parallel.
 //
-// A slice of V3 is run through `fn`; the result of which
+// A slice of V3 is evaluated by `s` (see sdf.EvaluateN); the result of which
 // is stored in the corresponding index of the `out` slice.
 type evalReq struct {
 	out []float64
 	p   []sdf.V3
-	fn  func(sdf.V3) float64
-	wg  *sync.WaitGroup
+	s   sdf.SDF3
 }
 
-var evalProcessCh = make(chan evalReq, 100)
-
-func init() {
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go func() {
-			var i int
-			var p sdf.V3
-			for r := range evalProcessCh {
-				for i, p = range r.p {
-					r.out[i] = r.fn(p)
-				}
-				r.wg.Done()
-			}
-		}()
-	}
+func (r evalReq) run() {
+	sdf.EvaluateN(r.s, r.p, r.out)
 }
 
-// Evaluate the SDF for a given XY layer
-func (l *layerYZ) Evaluate(s sdf.SDF3, x int) {
+// mcBatchSizeN is the evaluation batch size for SDF3s with batch evaluation.
+const mcBatchSizeN = 4096
 
-	// Swap the layers
+// next swaps the layers and returns the storage for the x + 1 layer.
+func (l *layerYZ) next() []float64 {
 	l.val0, l.val1 = l.val1, l.val0
+	if l.val1 == nil {
+		l.val1 = make([]float64, len(l.y)*len(l.z))
+	}
+	return l.val1
+}
 
-	ny, nz := l.steps[1], l.steps[2]
-	dx, dy, dz := l.inc.X, l.inc.Y, l.inc.Z
+// Evaluate the SDF for a given XY layer
+func (l *layerYZ) Evaluate(s sdf.SDF3, x int) error {
+	return mcEvaluateLayer(s, l.x[x], l.y, l.z, l.next())
+}
 
-	// allocate storage
-	if l.val1 == nil {
-		l.val1 = make([]float64, (ny+1)*(nz+1))
+// mcEvaluateLayer evaluates the SDF over the y, z lattice at x.
+// It returns an error if an evaluation panicked.
+func mcEvaluateLayer(s sdf.SDF3, x float64, ys, zs []float64, out []float64) error {
+	p := make([]sdf.V3, 0, len(ys)*len(zs))
+	for _, y := range ys {
+		for _, z := range zs {
+			p = append(p, sdf.V3{x, y, z})
+		}
 	}
+	return mcEvaluatePoints(s, p, out)
+}
 
-	// setup the loop variables
-	idx := 0
-	var p sdf.V3
-	p.X = l.base.X + float64(x)*dx
+// mcEvaluatePoints evaluates the SDF at a set of points in parallel batches.
+// It returns an error if an evaluation panicked.
+func mcEvaluatePoints(s sdf.SDF3, p []sdf.V3, out []float64) error {
 
 	// define the base struct for requesting evaluation
+	g := DefaultPool().Group()
 	eReq := evalReq{
-		wg:  new(sync.WaitGroup),
-		fn:  s.Evaluate,
-		out: l.val1,
+		s:   s,
+		out: out,
 	}
 
-	// evaluate the layer
-	p.Y = l.base.Y
-
 	// Performance doesn't seem to improve past 100.
-	const batchSize = 100
-
-	eReq.p = make([]sdf.V3, 0, batchSize)
-	for y := 0; y < ny+1; y++ {
-		p.Z = l.base.Z
-		for z := 0; z < nz+1; z++ {
-			eReq.p = append(eReq.p, p)
-			if len(eReq.p) == batchSize {
-				eReq.wg.Add(1)
-				evalProcessCh <- eReq
-				eReq.out = eReq.out[batchSize:]       // shift the output slice for processing
-				eReq.p = make([]sdf.V3, 0, batchSize) // create a new slice for the next batch
-			}
-			idx++
-			p.Z += dz
-		}
-		p.Y += dy
+	batchSize := 100
+	if _, ok := s.(sdf.SDF3Batch); ok {
+		batchSize = mcBatchSizeN
 	}
 
-	// send any remaining points for processing
-	if len(eReq.p) > 0 {
-		eReq.wg.Add(1)
-		evalProcessCh <- eReq
+	for len(p) > 0 {
+		n := batchSize
+		if n > len(p) {
+			n = len(p)
+		}
+		eReq.p = p[:n]
+		g.Go(eReq.run)
+		eReq.out = eReq.out[n:] // shift the output slice for processing
+		p = p[n:]
 	}
 
 	// Wait for all processing to complete before returning
-	eReq.wg.Wait()
+	return g.Wait()
 }
 
 func (l *layerYZ) Get(x, y, z int) float64 {
-	idx := y*(l.steps[2]+1) + z
+	idx := y*len(l.z) + z
 	if x == 0 {
 		return l.val0[idx]
 	}
@@ -130,43 +115,117 @@ func (l *layerYZ) Get(x, y, z int) float64 {
 
 //-----------------------------------------------------------------------------
 
-func marchingCubes(s sdf.SDF3, box sdf.Box3, step float64) []*Triangle3 {
+// mcLattice returns n+1 lattice coordinates, base + (ofs + i) * inc.
+// Coordinates on the same lattice are identical, whatever the offset.
+func mcLattice(base, inc float64, ofs, n int) []float64 {
+	x := make([]float64, n+1)
+	for i := range x {
+		x[i] = base + float64(ofs+i)*inc
+	}
+	return x
+}
 
-	var triangles []*Triangle3
-	size := box.Size()
-	base := box.Min
-	steps := size.DivScalar(step).Ceil().ToV3i()
-	inc := size.Div(steps.ToV3())
+// marchingCubesLattice generates the triangles for a block of cubes of a lattice.
+// The block starts at cube ofs and has steps cubes on each axis.
+func marchingCubesLattice(ctx context.Context, s sdf.SDF3, base, inc sdf.V3, ofs, steps sdf.V3i, eps float64, emit func([]*Triangle3)) error {
+	return marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, ofs: ofs, steps: steps, eps: eps, emit: emit})
+}
+
+// mcSampleFunc samples the values for x layer x of a block (with lattice coordinates xs, ys, zs).
+type mcSampleFunc func(x int, xs, ys, zs []float64, out []float64) error
+
+// mcCubeFunc appends the triangles for a cube (corner positions p, values v) at level x to result.
+type mcCubeFunc func(result []*Triangle3, a *TriangleArena, p [8]sdf.V3, v [8]float64, x, eps float64) []*Triangle3
+
+// mcSlabs defines a block of cubes of a lattice for marchingCubesSlabs.
+type mcSlabs struct {
+	base, inc  sdf.V3                            // lattice origin and spacing
+	ofs, steps sdf.V3i                           // first cube of the block and the cubes on each axis
+	eps        float64                           // vertex tolerance
+	start      int                               // first x layer
+	slab       []float64                         // sampled values of the first x layer (nil: sample the layer)
+	emit       func([]*Triangle3)                // called with the triangles of each cube
+	reuse      bool                              // the triangles are only valid during emit (the arena is reused)
+	layer      func(x int, slab []float64) error // called after each x layer (nil: none)
+	sample     mcSampleFunc                      // samples the layers (nil: evaluate the SDF)
+	cube       mcCubeFunc                        // triangulates the cubes (nil: the marching cubes tables)
+}
+
+// marchingCubesSlabs generates the triangles for a block of cubes of a lattice, starting
+// at x layer b.start with sampled values b.slab. Layers are sampled by the sample function
+// (nil: evaluate the SDF, skipping the empty blocks of an sdf.SDF3Interval, see mcCull).
+// After each x layer is processed the layer callback (if not nil) is called with the next
+// layer and its values. It returns ctx.Err() if the context is done before a layer is
+// processed. The processed cubes are counted by the progress tracker of the context.
+func marchingCubesSlabs(ctx context.Context, s sdf.SDF3, b *mcSlabs) error {
+	steps, sample, cube := b.steps, b.sample, b.cube
+
+	xs := mcLattice(b.base.X, b.inc.X, b.ofs[0], steps[0])
+	ys := mcLattice(b.base.Y, b.inc.Y, b.ofs[1], steps[1])
+	zs := mcLattice(b.base.Z, b.inc.Z, b.ofs[2], steps[2])
+
+	// skip the blocks of cubes without the surface
+	if sample == nil {
+		if _, ok := s.(sdf.SDF3Interval); ok {
+			sample = newMCCull(s, xs, ys, zs).sample
+		}
+	}
 
 	// create the SDF layer cache
-	l := newLayerYZ(base, inc, steps)
-	// evaluate the SDF for x = 0
-	l.Evaluate(s, 0)
+	l := newLayerYZ(xs, ys, zs)
+	if b.slab != nil {
+		if len(b.slab) != len(ys)*len(zs) {
+			return sdf.ErrMsg("bad slab size")
+		}
+		l.val1 = append([]float64(nil), b.slab...)
+	} else if sample != nil {
+		if err := sample(b.start, xs, ys, zs, l.next()); err != nil {
+			return err
+		}
+	} else {
+		// evaluate the SDF for the first layer
+		if err := l.Evaluate(s, b.start); err != nil {
+			return err
+		}
+	}
 
 	nx, ny, nz := steps[0], steps[1], steps[2]
-	dx, dy, dz := inc.X, inc.Y, inc.Z
+	progress := progressOf(ctx)
+	if cube == nil {
+		cube = mcAppendTriangles
+	}
 
-	var p sdf.V3
-	p.X = base.X
-	for x := 0; x < nx; x++ {
+	// triangles are allocated from an arena, the cube triangle slice is reused
+	var arena TriangleArena
+	var tris []*Triangle3
+
+	for x := b.start; x < nx; x++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var n int
 		// read the x + 1 layer
-		l.Evaluate(s, x+1)
+		if sample != nil {
+			if err := sample(x+1, xs, ys, zs, l.next()); err != nil {
+				return err
+			}
+		} else if err := l.Evaluate(s, x+1); err != nil {
+			return err
+		}
 		// process all cubes in the x and x + 1 layers
-		p.Y = base.Y
 		for y := 0; y < ny; y++ {
-			p.Z = base.Z
 			for z := 0; z < nz; z++ {
-				x0, y0, z0 := p.X, p.Y, p.Z
-				x1, y1, z1 := x0+dx, y0+dy, z0+dz
+				px0, py0, pz0 := xs[x], ys[y], zs[z]
+				px1, py1, pz1 := xs[x+1], ys[y+1], zs[z+1]
 				corners := [8]sdf.V3{
-					{x0, y0, z0},
-					{x1, y0, z0},
-					{x1, y1, z0},
-					{x0, y1, z0},
-					{x0, y0, z1},
-					{x1, y0, z1},
-					{x1, y1, z1},
-					{x0, y1, z1}}
+					{px0, py0, pz0},
+					{px1, py0, pz0},
+					{px1, py1, pz0},
+					{px0, py1, pz0},
+					{px0, py0, pz1},
+					{px1, py0, pz1},
+					{px1, py1, pz1},
+					{px0, py1, pz1}}
 				values := [8]float64{
 					l.Get(0, y, z),
 					l.Get(1, y, z),
@@ -176,20 +235,45 @@ func marchingCubes(s sdf.SDF3, box sdf.Box3, step float64) []*Triangle3 {
 					l.Get(1, y, z+1),
 					l.Get(1, y+1, z+1),
 					l.Get(0, y+1, z+1)}
-				triangles = append(triangles, mcToTriangles(corners, values, 0)...)
-				p.Z += dz
+				if tris = cube(tris[:0], &arena, corners, values, 0, b.eps); len(tris) != 0 {
+					b.emit(tris)
+					n += len(tris)
+					if b.reuse {
+						arena.reset()
+					}
+				}
+			}
+		}
+		progress.Add(int64(ny*nz), int64(n))
+		if b.layer != nil {
+			if err := b.layer(x+1, l.val1); err != nil {
+				return err
 			}
-			p.Y += dy
 		}
-		p.X += dx
 	}
+	return nil
+}
+
+func marchingCubes(ctx context.Context, s sdf.SDF3, base, inc sdf.V3, steps sdf.V3i, eps float64, cube mcCubeFunc) ([]*Triangle3, error) {
+
+	var triangles []*Triangle3
+
+	emit := func(t []*Triangle3) {
+		triangles = append(triangles, t...)
+	}
+	err := marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, steps: steps, eps: eps, emit: emit, cube: cube})
 
-	return triangles
+	return triangles, err
 }
 
 //-----------------------------------------------------------------------------
 
-func mcToTriangles(p [8]sdf.V3, v [8]float64, x float64) []*Triangle3 {
+func mcToTriangles(p [8]sdf.V3, v [8]float64, x, eps float64) []*Triangle3 {
+	return mcAppendTriangles(nil, nil, p, v, x, eps)
+}
+
+// mcAppendTriangles appends the triangles for a cube to result, allocating them from an arena.
+func mcAppendTriangles(result []*Triangle3, a *TriangleArena, p [8]sdf.V3, v [8]float64, x, eps float64) []*Triangle3 {
 	// which of the 0..255 patterns do we have?
 	index := 0
 	for i := 0; i < 8; i++ {
@@ -199,7 +283,7 @@ func mcToTriangles(p [8]sdf.V3, v [8]float64, x float64) []*Triangle3 {
 	}
 	// do we have any triangles to create?
 	if mcEdgeTable[index] == 0 {
-		return nil
+		return result
 	}
 	// work out the interpolated points on the edges
 	var points [12]sdf.V3
@@ -208,20 +292,23 @@ func mcToTriangles(p [8]sdf.V3, v [8]float64, x float64) []*Triangle3 {
 		if mcEdgeTable[index]&bit != 0 {
 			a := mcPairTable[i][0]
 			b := mcPairTable[i][1]
-			points[i] = mcInterpolate(p[a], p[b], v[a], v[b], x)
+			// interpolate in a fixed direction so the cubes sharing an edge get the same point
+			if v3Less(p[b], p[a]) {
+				a, b = b, a
+			}
+			points[i] = mcInterpolate(p[a], p[b], v[a], v[b], x, eps)
 		}
 	}
 	// create the triangles
 	table := mcTriangleTable[index]
 	count := len(table) / 3
-	result := make([]*Triangle3, 0, count)
 	for i := 0; i < count; i++ {
 		t := Triangle3{}
 		t.V[2] = points[table[i*3+0]]
 		t.V[1] = points[table[i*3+1]]
 		t.V[0] = points[table[i*3+2]]
 		if !t.Degenerate(0) {
-			result = append(result, &t)
+			result = append(result, a.New(t.V[0], t.V[1], t.V[2]))
 		}
 	}
 	return result
@@ -229,10 +316,10 @@ func mcToTriangles(p [8]sdf.V3, v [8]float64, x float64) []*Triangle3 {
 
 //-----------------------------------------------------------------------------
 
-func mcInterpolate(p1, p2 sdf.V3, v1, v2, x float64) sdf.V3 {
+func mcInterpolate(p1, p2 sdf.V3, v1, v2, x, eps float64) sdf.V3 {
 
-	closeToV1 := math.Abs(x-v1) < epsilon
-	closeToV2 := math.Abs(x-v2) < epsilon
+	closeToV1 := math.Abs(x-v1) < eps
+	closeToV2 := math.Abs(x-v2) < eps
 
 	if closeToV1 && !closeToV2 {
 		return p1
@@ -262,32 +349,59 @@ func mcInterpolate(p1, p2 sdf.V3, v1, v2, x float64) sdf.V3 {
 
 // MarchingCubesUniform renders using marching cubes with uniform space sampling.
 type MarchingCubesUniform struct {
+	Tolerances *sdf.Tolerances // nil: derived from the bounding box
+	Resolution *Resolution     // nil: cubic cells
 }
 
 // Info returns a string describing the rendered volume.
 func (m *MarchingCubesUniform) Info(s sdf.SDF3, meshCells int) string {
-	bb0 := s.BoundingBox()
-	bb0Size := bb0.Size()
-	meshInc := bb0Size.MaxComponent() / float64(meshCells)
-	bb1Size := bb0Size.DivScalar(meshInc)
-	bb1Size = bb1Size.Ceil().AddScalar(1)
-	cells := bb1Size.ToV3i()
+	_, _, cells := uniformLattice(s, meshCells, m.Resolution)
 	return fmt.Sprintf("%dx%dx%d", cells[0], cells[1], cells[2])
 }
 
 // Render produces a 3d triangle mesh over the bounding volume of an sdf3.
 func (m *MarchingCubesUniform) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *MarchingCubesUniform) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
 	// work out the region we will sample
-	bb0 := s.BoundingBox()
-	bb0Size := bb0.Size()
-	meshInc := bb0Size.MaxComponent() / float64(meshCells)
-	bb1Size := bb0Size.DivScalar(meshInc)
-	bb1Size = bb1Size.Ceil().AddScalar(1)
-	bb1Size = bb1Size.MulScalar(meshInc)
-	bb := sdf.NewBox3(bb0.Center(), bb1Size)
-	for _, tri := range marchingCubes(s, bb, meshInc) {
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	tol := modelTolerances(s, m.Tolerances)
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+	triangles, err := marchingCubes(ctx, s, base, inc, steps, tol.Vertex, nil)
+	if err != nil {
+		return err
+	}
+	for _, tri := range triangles {
 		output <- tri
 	}
+	progress.Done()
+	return nil
+}
+
+// RenderBatches produces a 3d triangle mesh over the bounding volume of an sdf3, sending
+// the triangles to the output as value batches (see RenderBatches).
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *MarchingCubesUniform) RenderBatches(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- []Triangle3) error {
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	tol := modelTolerances(s, m.Tolerances)
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+	w := NewTriangleBatcher(output)
+	emit := func(t []*Triangle3) {
+		for _, x := range t {
+			w.Add(x.V[0], x.V[1], x.V[2])
+		}
+	}
+	err := marchingCubesSlabs(ctx, s, &mcSlabs{base: base, inc: inc, steps: steps, eps: tol.Vertex, emit: emit, reuse: true})
+	w.Flush()
+	if err != nil {
+		return err
+	}
+	progress.Done()
+	return nil
 }
 
 //-----------------------------------------------------------------------------
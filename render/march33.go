@@ -0,0 +1,507 @@
+//-----------------------------------------------------------------------------
+/*
+
+Marching Cubes 33
+
+Marching cubes with the topology of the trilinear interpolant of each cube
+(the cases of Chernyaev's MC33), so the mesh is always consistent with the
+sampled field:
+
+Face ambiguities (two diagonally opposite corners inside) are resolved with
+the asymptotic decider. The contour on a face follows the branches of its
+bilinear interpolant, so the cubes sharing a face agree.
+
+Interior ambiguities: the face contours are joined into loops, and the loops
+are grouped into the connected components of the surface by sweeping the cube
+with bilinear slices. The contour of a slice links the loops it crosses, and the
+slice topology only changes at a few heights, so a slice between each pair of
+them is enough. A component with one loop is a disk, one with two loops is a
+tunnel, and one with more loops meets at a central vertex.
+
+Cubes without ambiguities use the marching cubes tables.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// mc33Corners are the cube corners in unit coordinates.
+var mc33Corners = [8]sdf.V3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}, {0, 1, 0}, {0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}
+
+// mc33Face is a cube face with its corners in cyclic order.
+type mc33Face struct {
+	corners [4]int
+	edges   [4]int // edge j joins corners j and j + 1
+	normal  sdf.V3 // outward normal
+}
+
+// mc33Faces are the bottom, top and side faces of a cube.
+// Side face 2 + k joins the bottom corners k and k + 1 (mod 4) to the top corners above them.
+var mc33Faces [6]mc33Face
+
+// mc33Simple is true for the cube indices without ambiguities (one loop and no ambiguous faces).
+var mc33Simple [256]bool
+
+func init() {
+	corners := [6][4]int{{0, 1, 2, 3}, {4, 5, 6, 7}}
+	for k := 0; k < 4; k++ {
+		corners[2+k] = [4]int{k, (k + 1) % 4, (k+1)%4 + 4, k + 4}
+	}
+	for i, c := range corners {
+		f := &mc33Faces[i]
+		f.corners = c
+		var center sdf.V3
+		for j := range c {
+			f.edges[j] = mcEdgeOf(c[j], c[(j+1)%4])
+			center = center.Add(mc33Corners[c[j]])
+		}
+		f.normal = center.DivScalar(4).SubScalar(0.5).MulScalar(2)
+	}
+	for index := range mc33Simple {
+		var c mc33Cube
+		c.init(index, [8]float64{}, 0)
+		mc33Simple[index] = !c.ambiguous && len(c.loops) == 1
+	}
+}
+
+// mcEdgeOf returns the edge joining two corners.
+func mcEdgeOf(a, b int) int {
+	for i, p := range mcPairTable {
+		if (p[0] == a && p[1] == b) || (p[0] == b && p[1] == a) {
+			return i
+		}
+	}
+	panic("not an edge")
+}
+
+//-----------------------------------------------------------------------------
+
+// mc33Cube is the contour topology of a cube.
+type mc33Cube struct {
+	inside    [8]bool
+	next      [12]int      // next edge of a contour loop (-1: the edge isn't crossed)
+	segments  [6][2][2]int // contour segments (edges) on each face
+	nsegs     [6]int       // number of contour segments on each face
+	loops     [][]int      // contour loops (edges)
+	ambiguous bool         // a face has two contour segments
+}
+
+// init sets the contour topology for a cube index with corner values v at level x.
+func (c *mc33Cube) init(index int, v [8]float64, x float64) {
+	for i := range c.next {
+		c.next[i] = -1
+	}
+	for i := range c.inside {
+		c.inside[i] = index&(1<<uint(i)) != 0
+	}
+	for fi := range mc33Faces {
+		f := &mc33Faces[fi]
+		var crossed []int
+		for j := 0; j < 4; j++ {
+			if c.inside[f.corners[j]] != c.inside[f.corners[(j+1)%4]] {
+				crossed = append(crossed, j)
+			}
+		}
+		switch len(crossed) {
+		case 2:
+			c.addSegment(fi, crossed[0], crossed[1])
+		case 4:
+			c.ambiguous = true
+			// corners j and j + 2 are inside
+			j := 0
+			if !c.inside[f.corners[0]] {
+				j = 1
+			}
+			in0, in1 := v[f.corners[j]]-x, v[f.corners[j+2]]-x
+			out0, out1 := v[f.corners[j+1]]-x, v[f.corners[(j+3)%4]]-x
+			// asymptotic decider: the inside corners are joined if the saddle is inside,
+			// and the segments cut off the outside corners
+			if in0*in1-out0*out1 > 0 {
+				j++
+			}
+			for _, k := range []int{j, (j + 2) % 4} {
+				c.addSegment(fi, (k+3)%4, k)
+			}
+		}
+	}
+	var seen [12]bool
+	for e := range c.next {
+		if c.next[e] < 0 || seen[e] {
+			continue
+		}
+		var loop []int
+		for k := e; k >= 0 && !seen[k]; k = c.next[k] {
+			seen[k] = true
+			loop = append(loop, k)
+		}
+		c.loops = append(c.loops, loop)
+	}
+}
+
+// addSegment adds a contour segment between two edges (j0, j1) of a face.
+// The segment is oriented with the outside on its left, viewed from outside the cube.
+func (c *mc33Cube) addSegment(fi, j0, j1 int) {
+	f := &mc33Faces[fi]
+	e0, e1 := f.edges[j0], f.edges[j1]
+	in, out := mcPairTable[e0][0], mcPairTable[e0][1]
+	if c.inside[out] {
+		in, out = out, in
+	}
+	d := mcEdgeMid(e1).Sub(mcEdgeMid(e0))
+	if d.Cross(mc33Corners[out].Sub(mc33Corners[in])).Dot(f.normal) < 0 {
+		e0, e1 = e1, e0
+	}
+	c.next[e0] = e1
+	c.segments[fi][c.nsegs[fi]] = [2]int{e0, e1}
+	c.nsegs[fi]++
+}
+
+// mcEdgeMid returns the midpoint of an edge in unit coordinates.
+func mcEdgeMid(e int) sdf.V3 {
+	return mc33Corners[mcPairTable[e][0]].Add(mc33Corners[mcPairTable[e][1]]).MulScalar(0.5)
+}
+
+//-----------------------------------------------------------------------------
+
+// components returns the loops of each connected component of the surface in a cube.
+func (c *mc33Cube) components(v [8]float64, x float64) [][]int {
+	parent := make([]int, len(c.loops))
+	for i := range parent {
+		parent[i] = i
+	}
+	find := func(i int) int {
+		for parent[i] != i {
+			i = parent[i]
+		}
+		return i
+	}
+	union := func(i, j int) {
+		if i >= 0 && j >= 0 {
+			parent[find(i)] = find(j)
+		}
+	}
+	if len(c.loops) > 1 {
+		c.sweep(v, x, union)
+	}
+	var groups [][]int
+	group := make(map[int]int)
+	for i := range c.loops {
+		r := find(i)
+		g, ok := group[r]
+		if !ok {
+			g = len(groups)
+			group[r] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// sweep calls union for the loops linked by the contours of z slices of a cube.
+func (c *mc33Cube) sweep(v [8]float64, x float64, union func(i, j int)) {
+	var loopOf [12]int
+	for i, l := range c.loops {
+		for _, e := range l {
+			loopOf[e] = i
+		}
+	}
+	// height of an edge crossing
+	height := func(e int) float64 {
+		i, j := mcPairTable[e][0], mcPairTable[e][1]
+		u := (x - v[i]) / (v[j] - v[i])
+		return mc33Corners[i].Z + u*(mc33Corners[j].Z-mc33Corners[i].Z)
+	}
+	// the values at the slice corners are a + b * t
+	var a, b [4]float64
+	for k := 0; k < 4; k++ {
+		a[k] = v[k] - x
+		b[k] = v[k+4] - v[k]
+	}
+	// the slice topology changes at the vertical edge crossings, the side face saddles
+	// and the sign changes of the slice decider
+	events := []float64{0, 1}
+	add := func(t float64) {
+		if t > 0 && t < 1 {
+			events = append(events, t)
+		}
+	}
+	var saddle [4]float64
+	for k := 0; k < 4; k++ {
+		if c.inside[k] != c.inside[k+4] {
+			add(height(8 + k))
+		}
+		k1 := (k + 1) % 4
+		saddle[k] = (a[k] - a[k1]) / (b[k1] - b[k])
+		add(saddle[k])
+	}
+	qa := b[0]*b[2] - b[1]*b[3]
+	qb := a[0]*b[2] + b[0]*a[2] - a[1]*b[3] - b[1]*a[3]
+	qc := a[0]*a[2] - a[1]*a[3]
+	if qa != 0 {
+		if disc := qb*qb - 4*qa*qc; disc >= 0 {
+			add((-qb + math.Sqrt(disc)) / (2 * qa))
+			add((-qb - math.Sqrt(disc)) / (2 * qa))
+		}
+	} else if qb != 0 {
+		add(-qc / qb)
+	}
+	add(-(a[0] + a[2] - a[1] - a[3]) / (b[0] + b[2] - b[1] - b[3]))
+	sort.Float64s(events)
+
+	// the loop crossed by the contour at height t on side k
+	side := func(k int, t float64) int {
+		fi := 2 + k
+		if c.nsegs[fi] == 0 {
+			return -1
+		}
+		seg := c.segments[fi][0]
+		if c.nsegs[fi] == 2 && (height(seg[0])+height(seg[1]) < 2*saddle[k]) != (t < saddle[k]) {
+			seg = c.segments[fi][1]
+		}
+		return loopOf[seg[0]]
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i] == events[i-1] {
+			continue
+		}
+		t := 0.5 * (events[i-1] + events[i])
+		var s [4]float64
+		var in [4]bool
+		for k := range s {
+			s[k] = a[k] + b[k]*t
+			in[k] = s[k] < 0
+		}
+		var crossed []int
+		for k := 0; k < 4; k++ {
+			if in[k] != in[(k+1)%4] {
+				crossed = append(crossed, k)
+			}
+		}
+		switch len(crossed) {
+		case 2:
+			union(side(crossed[0], t), side(crossed[1], t))
+		case 4:
+			// as for the faces, slice corner j is between sides j - 1 and j
+			j := 0
+			if !in[0] {
+				j = 1
+			}
+			if s[j]*s[j+2]-s[j+1]*s[(j+3)%4] > 0 {
+				j++
+			}
+			for _, k := range []int{j, (j + 2) % 4} {
+				union(side((k+3)%4, t), side(k, t))
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// mc33AppendTriangles appends the MC33 triangles for a cube to result, allocating them from an arena.
+func mc33AppendTriangles(result []*Triangle3, a *TriangleArena, p [8]sdf.V3, v [8]float64, x, eps float64) []*Triangle3 {
+	index := 0
+	for i := 0; i < 8; i++ {
+		if v[i] < x {
+			index |= 1 << uint(i)
+		}
+	}
+	if mcEdgeTable[index] == 0 {
+		return result
+	}
+	if mc33Simple[index] {
+		return mcAppendTriangles(result, a, p, v, x, eps)
+	}
+	var c mc33Cube
+	c.init(index, v, x)
+	var points [12]sdf.V3
+	for i := range points {
+		if c.next[i] >= 0 {
+			a, b := mcPairTable[i][0], mcPairTable[i][1]
+			// interpolate in a fixed direction so the cubes sharing an edge get the same point
+			if v3Less(p[b], p[a]) {
+				a, b = b, a
+			}
+			points[i] = mcInterpolate(p[a], p[b], v[a], v[b], x, eps)
+		}
+	}
+	loop := func(i int) []sdf.V3 {
+		l := make([]sdf.V3, len(c.loops[i]))
+		for j, e := range c.loops[i] {
+			l[j] = points[e]
+		}
+		return l
+	}
+	add := func(v0, v1, v2 sdf.V3) {
+		t := Triangle3{[3]sdf.V3{v0, v1, v2}}
+		if !t.Degenerate(0) {
+			result = append(result, a.New(v0, v1, v2))
+		}
+	}
+	for _, g := range c.components(v, x) {
+		switch len(g) {
+		case 1:
+			mc33Disk(add, loop(g[0]))
+		case 2:
+			mc33Tube(add, loop(g[0]), loop(g[1]))
+		default:
+			var loops [][]sdf.V3
+			var all []sdf.V3
+			for _, i := range g {
+				loops = append(loops, loop(i))
+				all = append(all, loops[len(loops)-1]...)
+			}
+			center := mc33Center(all)
+			for _, l := range loops {
+				mc33Fan(add, l, center)
+			}
+		}
+	}
+	return result
+}
+
+// mc33Disk triangulates a loop (counter-clockwise from outside).
+func mc33Disk(add func(v0, v1, v2 sdf.V3), l []sdf.V3) {
+	switch len(l) {
+	case 3:
+		add(l[0], l[1], l[2])
+	case 4:
+		// split on the shorter diagonal
+		if l[0].Sub(l[2]).Length2() <= l[1].Sub(l[3]).Length2() {
+			add(l[0], l[1], l[2])
+			add(l[0], l[2], l[3])
+		} else {
+			add(l[1], l[2], l[3])
+			add(l[1], l[3], l[0])
+		}
+	default:
+		mc33Fan(add, l, mc33Center(l))
+	}
+}
+
+// mc33Fan triangulates a loop with a fan around a center point.
+func mc33Fan(add func(v0, v1, v2 sdf.V3), l []sdf.V3, center sdf.V3) {
+	for i := range l {
+		add(l[i], l[(i+1)%len(l)], center)
+	}
+}
+
+// mc33Center returns the mean of a set of points.
+func mc33Center(l []sdf.V3) sdf.V3 {
+	var c sdf.V3
+	for _, p := range l {
+		c = c.Add(p)
+	}
+	return c.DivScalar(float64(len(l)))
+}
+
+// mc33Tube triangulates a tunnel between two loops (both counter-clockwise from outside,
+// so the second loop is traversed backwards). The loop points are paired in the order of
+// their arc lengths from the closest pair of points, and the tunnel passes through a ring
+// of the pair midpoints pulled towards the center (so it doesn't lie on the cube faces).
+func mc33Tube(add func(v0, v1, v2 sdf.V3), p, q []sdf.V3) {
+	// start at the closest pair of points
+	i0, j0 := 0, 0
+	best := math.Inf(1)
+	for i := range p {
+		for j := range q {
+			if d := p[i].Sub(q[j]).Length2(); d < best {
+				i0, j0, best = i, j, d
+			}
+		}
+	}
+	n, m := len(p), len(q)
+	pi := func(k int) sdf.V3 { return p[(i0+k)%n] }
+	qj := func(k int) sdf.V3 { return q[((j0-k)%m+m)%m] }
+	// normalized arc lengths
+	arc := func(n int, pt func(int) sdf.V3) []float64 {
+		s := make([]float64, n+1)
+		for k := 1; k <= n; k++ {
+			s[k] = s[k-1] + pt(k).Sub(pt(k-1)).Length()
+		}
+		for k := range s {
+			s[k] /= s[n]
+		}
+		return s
+	}
+	sp, sq := arc(n, pi), arc(m, qj)
+	// pair the points
+	type pair struct{ i, j int }
+	pairs := make([]pair, 0, n+m)
+	for i, j := 0, 0; i < n || j < m; {
+		pairs = append(pairs, pair{i, j})
+		if j == m || (i < n && sp[i+1] <= sq[j+1]) {
+			i++
+		} else {
+			j++
+		}
+	}
+	center := mc33Center(append(append([]sdf.V3(nil), p...), q...))
+	ring := make([]sdf.V3, len(pairs))
+	for k, r := range pairs {
+		ring[k] = pi(r.i).Add(qj(r.j)).MulScalar(0.5).Add(center).MulScalar(0.5)
+	}
+	for k, r := range pairs {
+		r0, r1 := ring[k], ring[(k+1)%len(ring)]
+		add(pi(r.i), r1, r0)
+		if k+1 < len(pairs) && pairs[k+1].i == r.i || k+1 == len(pairs) && r.i == n {
+			// q advances
+			add(qj(r.j+1), qj(r.j), r0)
+			add(r0, r1, qj(r.j+1))
+		} else {
+			// p advances
+			add(pi(r.i), pi(r.i+1), r1)
+			add(r0, r1, qj(r.j))
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// MarchingCubes33 renders using marching cubes with uniform space sampling and
+// the MC33 topology of the sampled field.
+type MarchingCubes33 struct {
+	Tolerances *sdf.Tolerances // nil: derived from the bounding box
+	Resolution *Resolution     // nil: cubic cells
+}
+
+// Info returns a string describing the rendered volume.
+func (m *MarchingCubes33) Info(s sdf.SDF3, meshCells int) string {
+	return (&MarchingCubesUniform{Resolution: m.Resolution}).Info(s, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+func (m *MarchingCubes33) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *MarchingCubes33) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	// the same lattice as MarchingCubesUniform
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	tol := modelTolerances(s, m.Tolerances)
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+	triangles, err := marchingCubes(ctx, s, base, inc, steps, tol.Vertex, mc33AppendTriangles)
+	if err != nil {
+		return err
+	}
+	for _, tri := range triangles {
+		output <- tri
+	}
+	progress.Done()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
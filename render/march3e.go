@@ -0,0 +1,399 @@
+//-----------------------------------------------------------------------------
+/*
+
+Extended Marching Cubes
+
+Marching cubes with sharp features (Kobbelt et al, "Feature Sensitive
+Surface Extraction from Volume Data", 2001).
+
+The edge points of each surface patch of a cube are refined onto the
+surface and the SDF normals are sampled at them. If they diverge (by more than the feature angle) the patch has a
+feature (an edge or a corner), and it is replaced by a fan from a feature
+vertex, the point nearest the tangent planes of the edge points. The
+tangent plane system is solved with a truncated SVD, so an edge (rank 2)
+keeps the feature vertex at the mean of the edge points along the edge.
+Feature vertices outside their cube are dropped (edge vertices are first
+moved along the edge into the cube).
+
+The fans of neighbouring cubes meet with a chord across the sharp edge.
+As a final pass the chords between two fans are flipped to join their
+feature vertices, so the sharp edges are reconstructed.
+
+The patches without features are the marching cubes triangles, so the
+mesh has the robustness (and closure) of marching cubes.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// emcFeatureAngle is the default feature angle (radians).
+const emcFeatureAngle = 30 * sdf.Pi / 180
+
+// emcTruncation is the singular value truncation of the feature vertex solver (relative to the largest).
+const emcTruncation = 0.1
+
+// emcCube returns a cube function for the extended marching cubes of an SDF3, adding the
+// feature vertices to a set. h is the normal sampling distance.
+func emcCube(s sdf.SDF3, cosAngle, h float64, features map[sdf.V3]bool) mcCubeFunc {
+	return func(result []*Triangle3, a *TriangleArena, p [8]sdf.V3, v [8]float64, x, eps float64) []*Triangle3 {
+		index := 0
+		for i := 0; i < 8; i++ {
+			if v[i] < x {
+				index |= 1 << uint(i)
+			}
+		}
+		if mcEdgeTable[index] == 0 {
+			return result
+		}
+		var points [12]sdf.V3
+		for i := 0; i < 12; i++ {
+			if mcEdgeTable[index]&(1<<uint(i)) != 0 {
+				a, b := mcPairTable[i][0], mcPairTable[i][1]
+				// interpolate in a fixed direction so the cubes sharing an edge get the same point
+				if v3Less(p[b], p[a]) {
+					a, b = b, a
+				}
+				points[i] = emcIntersect(s, p[a], p[b], v[a], v[b], x, eps)
+			}
+		}
+		// group the triangles (edge indices, output order) into patches sharing edges
+		table := mcTriangleTable[index]
+		var parent [12]int
+		for i := range parent {
+			parent[i] = i
+		}
+		find := func(i int) int {
+			for parent[i] != i {
+				i = parent[i]
+			}
+			return i
+		}
+		tris := make([][3]int, len(table)/3)
+		for i := range tris {
+			tris[i] = [3]int{table[i*3+2], table[i*3+1], table[i*3+0]}
+			parent[find(tris[i][1])] = find(tris[i][0])
+			parent[find(tris[i][2])] = find(tris[i][0])
+		}
+		add := func(v0, v1, v2 sdf.V3) {
+			t := Triangle3{[3]sdf.V3{v0, v1, v2}}
+			if !t.Degenerate(0) {
+				result = append(result, a.New(v0, v1, v2))
+			}
+		}
+		var done [12]bool
+		for _, t := range tris {
+			root := find(t[0])
+			if done[root] {
+				continue
+			}
+			done[root] = true
+			var patch [][3]int
+			for _, u := range tris {
+				if find(u[0]) == root {
+					patch = append(patch, u)
+				}
+			}
+			f, ok := emcFeature(s, patch, &points, p[0], p[6], cosAngle, h)
+			if !ok {
+				for _, u := range patch {
+					add(points[u[0]], points[u[1]], points[u[2]])
+				}
+				continue
+			}
+			features[f] = true
+			// fan from the feature vertex over the patch boundary
+			for _, u := range patch {
+				for k := 0; k < 3; k++ {
+					e0, e1 := u[k], u[(k+1)%3]
+					if !emcHasEdge(patch, e1, e0) {
+						add(points[e0], points[e1], f)
+					}
+				}
+			}
+		}
+		return result
+	}
+}
+
+// emcIterations is the number of refinements of the edge intersections.
+const emcIterations = 8
+
+// emcIntersect returns the surface point on a cube edge, refining the marching cubes
+// interpolation by regula falsi (the normals of points off the surface can be skewed
+// near features).
+func emcIntersect(s sdf.SDF3, p0, p1 sdf.V3, v0, v1, x, eps float64) sdf.V3 {
+	p := mcInterpolate(p0, p1, v0, v1, x, eps)
+	for i := 0; i < emcIterations; i++ {
+		v := s.Evaluate(p) - x
+		if math.Abs(v) < eps*1e-3 {
+			break
+		}
+		if (v < 0) == (v0 < x) {
+			p0, v0 = p, v+x
+		} else {
+			p1, v1 = p, v+x
+		}
+		if v0 == v1 {
+			break
+		}
+		p = p0.Add(p1.Sub(p0).MulScalar((x - v0) / (v1 - v0)))
+	}
+	return p
+}
+
+// emcHasEdge returns true if a triangle of a patch has the directed edge e0 to e1.
+func emcHasEdge(patch [][3]int, e0, e1 int) bool {
+	for _, u := range patch {
+		for k := 0; k < 3; k++ {
+			if u[k] == e0 && u[(k+1)%3] == e1 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// emcFeature returns the feature vertex of a patch (within the cube lo..hi), if it has a feature.
+func emcFeature(s sdf.SDF3, patch [][3]int, points *[12]sdf.V3, lo, hi sdf.V3, cosAngle, h float64) (sdf.V3, bool) {
+	var used [12]bool
+	var normals []sdf.V3
+	var offsets []float64
+	var mass sdf.V3
+	for _, u := range patch {
+		for _, e := range u {
+			if used[e] {
+				continue
+			}
+			used[e] = true
+			n := sdf.Normal3(s, points[e], h)
+			normals = append(normals, n)
+			offsets = append(offsets, n.Dot(points[e]))
+			mass = mass.Add(points[e])
+		}
+	}
+	mass = mass.DivScalar(float64(len(normals)))
+	// feature detection: the largest angle between the normals
+	minCos := 1.0
+	for i := range normals {
+		for j := i + 1; j < len(normals); j++ {
+			minCos = math.Min(minCos, normals[i].Dot(normals[j]))
+		}
+	}
+	if minCos >= cosAngle {
+		return sdf.V3{}, false
+	}
+	f, dir, rank := emcSolve(normals, offsets, mass)
+	// keep the feature vertices within the cube
+	tol := hi.Sub(lo).MulScalar(1e-6)
+	box := sdf.Box3{lo.Sub(tol), hi.Add(tol)}
+	if box.Contains(f) {
+		return f, true
+	}
+	if rank != 2 {
+		return sdf.V3{}, false
+	}
+	// move an edge vertex along the edge into the cube
+	t0, t1 := math.Inf(-1), math.Inf(1)
+	fv, dv := [3]float64{f.X, f.Y, f.Z}, [3]float64{dir.X, dir.Y, dir.Z}
+	lv, hv := [3]float64{box.Min.X, box.Min.Y, box.Min.Z}, [3]float64{box.Max.X, box.Max.Y, box.Max.Z}
+	for i := 0; i < 3; i++ {
+		if dv[i] == 0 {
+			if fv[i] < lv[i] || fv[i] > hv[i] {
+				return sdf.V3{}, false
+			}
+			continue
+		}
+		a, b := (lv[i]-fv[i])/dv[i], (hv[i]-fv[i])/dv[i]
+		t0, t1 = math.Max(t0, math.Min(a, b)), math.Min(t1, math.Max(a, b))
+	}
+	if t0 > t1 {
+		return sdf.V3{}, false
+	}
+	return f.Add(dir.MulScalar(sdf.Clamp(0, t0, t1))), true
+}
+
+// emcSolve returns the point minimizing the sum of the squared distances to the planes
+// (n[i] . x = d[i]) nearest to the mass point, by a truncated SVD of the normals, with the
+// rank of the plane system and a direction it doesn't constrain (for rank 2, the edge direction).
+func emcSolve(n []sdf.V3, d []float64, mass sdf.V3) (sdf.V3, sdf.V3, int) {
+	var ata [3][3]float64
+	var atr [3]float64
+	for k := range n {
+		r := d[k] - n[k].Dot(mass)
+		nv := [3]float64{n[k].X, n[k].Y, n[k].Z}
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				ata[i][j] += nv[i] * nv[j]
+			}
+			atr[i] += nv[i] * r
+		}
+	}
+	e, v := emcSymEigen(ata)
+	eMax := math.Max(e[0], math.Max(e[1], e[2]))
+	if !(eMax > 0) {
+		return mass, sdf.V3{}, 0
+	}
+	limit := emcTruncation * emcTruncation * eMax
+	var dx [3]float64
+	var dir sdf.V3
+	rank := 0
+	for j := 0; j < 3; j++ {
+		if e[j] <= limit {
+			dir = sdf.V3{v[0][j], v[1][j], v[2][j]}
+			continue
+		}
+		rank++
+		c := (v[0][j]*atr[0] + v[1][j]*atr[1] + v[2][j]*atr[2]) / e[j]
+		for i := 0; i < 3; i++ {
+			dx[i] += c * v[i][j]
+		}
+	}
+	return mass.Add(sdf.V3{dx[0], dx[1], dx[2]}), dir, rank
+}
+
+// emcSymEigen returns the eigenvalues and eigenvectors (columns of v) of a symmetric 3x3 matrix (Jacobi rotations).
+func emcSymEigen(a [3][3]float64) ([3]float64, [3][3]float64) {
+	v := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	for sweep := 0; sweep < 16; sweep++ {
+		if a[0][1]*a[0][1]+a[0][2]*a[0][2]+a[1][2]*a[1][2] < 1e-30 {
+			break
+		}
+		for _, pq := range [3][2]int{{0, 1}, {0, 2}, {1, 2}} {
+			p, q := pq[0], pq[1]
+			if a[p][q] == 0 {
+				continue
+			}
+			theta := (a[q][q] - a[p][p]) / (2 * a[p][q])
+			t := 1 / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+			if theta < 0 {
+				t = -t
+			}
+			c := 1 / math.Sqrt(t*t+1)
+			s := t * c
+			for k := 0; k < 3; k++ {
+				a[k][p], a[k][q] = c*a[k][p]-s*a[k][q], s*a[k][p]+c*a[k][q]
+			}
+			for k := 0; k < 3; k++ {
+				a[p][k], a[q][k] = c*a[p][k]-s*a[q][k], s*a[p][k]+c*a[q][k]
+			}
+			for k := 0; k < 3; k++ {
+				v[k][p], v[k][q] = c*v[k][p]-s*v[k][q], s*v[k][p]+c*v[k][q]
+			}
+		}
+	}
+	return [3]float64{a[0][0], a[1][1], a[2][2]}, v
+}
+
+//-----------------------------------------------------------------------------
+
+// emcEdge is an undirected mesh edge.
+type emcEdge [2]sdf.V3
+
+func newEMCEdge(a, b sdf.V3) emcEdge {
+	if v3Less(b, a) {
+		a, b = b, a
+	}
+	return emcEdge{a, b}
+}
+
+// emcFlip flips the edges between two triangles of different feature fans (the edge vertices
+// aren't features, the opposite vertices are), so the edge joins the feature vertices.
+func emcFlip(mesh []*Triangle3, features map[sdf.V3]bool) {
+	// the triangles (and the opposite vertex) of each edge
+	type side struct {
+		t *Triangle3
+		k int // opposite vertex
+	}
+	edges := make(map[emcEdge][]side)
+	for _, t := range mesh {
+		for k := 0; k < 3; k++ {
+			e := newEMCEdge(t.V[(k+1)%3], t.V[(k+2)%3])
+			edges[e] = append(edges[e], side{t, k})
+		}
+	}
+	flipped := make(map[*Triangle3]bool)
+	for _, t := range mesh {
+		for k := 0; k < 3; k++ {
+			if flipped[t] || !features[t.V[k]] {
+				continue
+			}
+			u, w := t.V[(k+1)%3], t.V[(k+2)%3]
+			if features[u] || features[w] {
+				continue
+			}
+			sides := edges[newEMCEdge(u, w)]
+			if len(sides) != 2 {
+				continue
+			}
+			o := sides[0]
+			if o.t == t {
+				o = sides[1]
+			}
+			f1, f2 := t.V[k], o.t.V[o.k]
+			if flipped[o.t] || !features[f2] || f1 == f2 || len(edges[newEMCEdge(f1, f2)]) != 0 {
+				continue
+			}
+			// t is (f1, u, w), o is (f2, w, u): the quad is u, f2, w, f1
+			t.V = [3]sdf.V3{u, f2, f1}
+			o.t.V = [3]sdf.V3{f2, w, f1}
+			flipped[t], flipped[o.t] = true, true
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// MarchingCubesExtended renders using marching cubes with uniform space sampling and
+// sharp features (edges and corners).
+type MarchingCubesExtended struct {
+	Tolerances   *sdf.Tolerances // nil: derived from the bounding box
+	Resolution   *Resolution     // nil: cubic cells
+	FeatureAngle float64         // minimum normal angle of a feature, radians (0: default 30 degrees)
+}
+
+// Info returns a string describing the rendered volume.
+func (m *MarchingCubesExtended) Info(s sdf.SDF3, meshCells int) string {
+	return (&MarchingCubesUniform{Resolution: m.Resolution}).Info(s, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+func (m *MarchingCubesExtended) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *MarchingCubesExtended) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	// the same lattice as MarchingCubesUniform
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	tol := modelTolerances(s, m.Tolerances)
+	angle := m.FeatureAngle
+	if angle == 0 {
+		angle = emcFeatureAngle
+	}
+	h := 1e-3 * math.Min(inc.X, math.Min(inc.Y, inc.Z))
+	features := make(map[sdf.V3]bool)
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+	triangles, err := marchingCubes(ctx, s, base, inc, steps, tol.Vertex, emcCube(s, math.Cos(angle), h, features))
+	if err != nil {
+		return err
+	}
+	emcFlip(triangles, features)
+	for _, tri := range triangles {
+		output <- tri
+	}
+	progress.Done()
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -12,6 +12,7 @@ Uses octree space subdivision.
 package render
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sync"
@@ -36,11 +37,13 @@ type dcache3 struct {
 	resolution float64             // size of smallest octree cube
 	hdiag      []float64           // lookup table of cube half diagonals
 	s          sdf.SDF3            // the SDF3 to be rendered
+	eps        float64             // distance to snap vertices to cube corners
+	progress   *ProgressTracker    // render progress (nil: none)
 	cache      map[sdf.V3i]float64 // cache of distances
 	lock       sync.RWMutex        // lock the the cache during reads/writes
 }
 
-func newDcache3(s sdf.SDF3, origin sdf.V3, resolution float64, n uint) *dcache3 {
+func newDcache3(s sdf.SDF3, origin sdf.V3, resolution, eps float64, n uint) *dcache3 {
 	// TODO heuristic for initial cache size. Maybe k * (1 << n)^3
 	// Avoiding any resizing of the map seems to be worth 2-5% of speedup.
 	dc := dcache3{
@@ -48,6 +51,7 @@ func newDcache3(s sdf.SDF3, origin sdf.V3, resolution float64, n uint) *dcache3
 		resolution: resolution,
 		hdiag:      make([]float64, n),
 		s:          s,
+		eps:        eps,
 		cache:      make(map[sdf.V3i]float64),
 	}
 	// build a lut for cube half diagonal lengths
@@ -98,8 +102,12 @@ func (dc *dcache3) isEmpty(c *cube) bool {
 }
 
 // Process a cube. Generate triangles, or more cubes.
-func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
-	if !dc.isEmpty(c) {
+// Subdivision stops with ctx.Err() when the context is done.
+func (dc *dcache3) processCube(ctx context.Context, c *cube, output chan<- *Triangle3) error {
+	if dc.isEmpty(c) {
+		// count the skipped resolution cubes
+		dc.progress.Add(1<<(3*(c.n-1)), 0)
+	} else {
 		if c.n == 1 {
 			// this cube is at the required resolution
 			c0, d0 := dc.evaluate(c.v.Add(sdf.V3i{0, 0, 0}))
@@ -113,30 +121,33 @@ func (dc *dcache3) processCube(c *cube, output chan<- *Triangle3) {
 			corners := [8]sdf.V3{c0, c1, c2, c3, c4, c5, c6, c7}
 			values := [8]float64{d0, d1, d2, d3, d4, d5, d6, d7}
 			// output the triangle(s) for this cube
-			for _, t := range mcToTriangles(corners, values, 0) {
+			tris := mcToTriangles(corners, values, 0, dc.eps)
+			for _, t := range tris {
 				output <- t
 			}
+			dc.progress.Add(1, int64(len(tris)))
 		} else {
 			// process the sub cubes
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			n := c.n - 1
 			s := 1 << n
 			// TODO - turn these into throttled go-routines
-			dc.processCube(&cube{c.v.Add(sdf.V3i{0, 0, 0}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{s, 0, 0}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{s, s, 0}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{0, s, 0}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{0, 0, s}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{s, 0, s}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{s, s, s}), n}, output)
-			dc.processCube(&cube{c.v.Add(sdf.V3i{0, s, s}), n}, output)
+			for _, o := range [8]sdf.V3i{{0, 0, 0}, {s, 0, 0}, {s, s, 0}, {0, s, 0}, {0, 0, s}, {s, 0, s}, {s, s, s}, {0, s, s}} {
+				if err := dc.processCube(ctx, &cube{c.v.Add(o), n}, output); err != nil {
+					return err
+				}
+			}
 		}
 	}
+	return nil
 }
 
 //-----------------------------------------------------------------------------
 
 // marchingCubesOctree generates a triangle mesh for an SDF3 using octree subdivision.
-func marchingCubesOctree(s sdf.SDF3, resolution float64, output chan<- *Triangle3) {
+func marchingCubesOctree(ctx context.Context, s sdf.SDF3, resolution, eps float64, output chan<- *Triangle3) error {
 	// Scale the bounding box about the center to make sure the boundaries
 	// aren't on the object surface.
 	bb := s.BoundingBox()
@@ -148,15 +159,21 @@ func marchingCubesOctree(s sdf.SDF3, resolution float64, output chan<- *Triangle
 	// how many cube levels for the octree?
 	levels := uint(math.Ceil(math.Log2(longAxis/resolution))) + 1
 	// create the distance cache
-	dc := newDcache3(s, bb.Min, resolution, levels)
+	dc := newDcache3(s, bb.Min, resolution, eps, levels)
+	dc.progress = StartProgress(ctx, 1<<(3*(levels-2)))
 	// process the octree, start at the top level
-	dc.processCube(&cube{sdf.V3i{0, 0, 0}, levels - 1}, output)
+	if err := dc.processCube(ctx, &cube{sdf.V3i{0, 0, 0}, levels - 1}, output); err != nil {
+		return err
+	}
+	dc.progress.Done()
+	return nil
 }
 
 //-----------------------------------------------------------------------------
 
 // MarchingCubesOctree renders using marching cubes with octree space sampling.
 type MarchingCubesOctree struct {
+	Tolerances *sdf.Tolerances // nil: derived from the bounding box
 }
 
 // Info returns a string describing the rendered volume.
@@ -169,10 +186,17 @@ func (m *MarchingCubesOctree) Info(s sdf.SDF3, meshCells int) string {
 
 // Render produces a 3d triangle mesh over the bounding volume of an sdf3.
 func (m *MarchingCubesOctree) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *MarchingCubesOctree) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
 	// work out the sampling resolution to use
 	bbSize := s.BoundingBox().Size()
 	resolution := bbSize.MaxComponent() / float64(meshCells)
-	marchingCubesOctree(s, resolution, output)
+	tol := modelTolerances(s, m.Tolerances)
+	return marchingCubesOctree(ctx, s, resolution, tol.Vertex, output)
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,127 @@
+//-----------------------------------------------------------------------------
+/*
+
+Renderer Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package render_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// testBox is a box with its faces and corners off the render lattice.
+func testBox() sdf.SDF3 {
+	box, _ := sdf.Box3D(sdf.V3{1.9, 1.05, 0.95}, 0)
+	return sdf.Transform3D(box, sdf.Translate3d(sdf.V3{0.013, 0.021, 0.007}))
+}
+
+// checkVertices checks the vertices of a mesh are on the surface of an SDF3 (to a tolerance).
+func checkVertices(t *testing.T, name string, s sdf.SDF3, m *render.Mesh, tolerance float64) {
+	t.Helper()
+	for _, v := range m.Vertices {
+		if d := s.Evaluate(v); math.Abs(d) > tolerance {
+			t.Errorf("%s: vertex %v is %g from the surface", name, v, d)
+			return
+		}
+	}
+}
+
+// checkRenderer renders a sphere and a box, checking the meshes are closed with the
+// expected volumes and their vertices are on the surface (to a tolerance in cells).
+func checkRenderer(t *testing.T, name string, r render.Render3, tolerance float64) {
+	t.Helper()
+	sphere, _ := sdf.Sphere3D(1)
+	m := meshOf(t, sphere, 40, r)
+	checkWatertight(t, name+" sphere", m)
+	checkVolume(t, name+" sphere", m, 4.0/3*math.Pi, 0.02)
+	checkVertices(t, name+" sphere", sphere, m, tolerance*2.0/40)
+	box := testBox()
+	m = meshOf(t, box, 40, r)
+	checkWatertight(t, name+" box", m)
+	checkVolume(t, name+" box", m, 1.9*1.05*0.95, 0.02)
+	checkVertices(t, name+" box", box, m, tolerance*1.9/40)
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MarchingCubes33(t *testing.T) {
+	checkRenderer(t, "mc33", &render.MarchingCubes33{}, 0.05)
+}
+
+func Test_SurfaceNets(t *testing.T) {
+	checkRenderer(t, "nets", &render.SurfaceNets{}, 1)
+}
+
+func Test_MarchingCubesExtended(t *testing.T) {
+	checkRenderer(t, "extended", &render.MarchingCubesExtended{}, 0.05)
+	// the box corners are reproduced
+	m := meshOf(t, testBox(), 40, &render.MarchingCubesExtended{})
+	for _, c := range testBox().BoundingBox().Vertices() {
+		d := math.Inf(1)
+		for _, v := range m.Vertices {
+			d = math.Min(d, v.Sub(c).Length())
+		}
+		if d > 0.05*1.9/40 {
+			t.Errorf("corner %v is %g from the mesh", c, d)
+		}
+	}
+}
+
+func Test_MarchingCubesIncremental(t *testing.T) {
+	// a renderer keeps its lattice for the next model, so each model gets a new one
+	sphere, _ := sdf.Sphere3D(1)
+	m := meshOf(t, sphere, 40, &render.MarchingCubesIncremental{})
+	checkWatertight(t, "sphere", m)
+	checkVertices(t, "sphere", sphere, m, 0.05*2.0/40)
+	box := testBox()
+	m = meshOf(t, box, 40, &render.MarchingCubesIncremental{})
+	checkWatertight(t, "box", m)
+	checkVertices(t, "box", box, m, 0.05*1.9/40)
+	// a plate with a bump, and the bump moved
+	plate, _ := sdf.Box3D(sdf.V3{4, 4, 1}, 0)
+	bump, _ := sdf.Sphere3D(0.4)
+	model := func(x float64) sdf.SDF3 {
+		return sdf.Union3D(plate, sdf.Transform3D(bump, sdf.Translate3d(sdf.V3{x, 0.3, 0.5})))
+	}
+	r := &render.MarchingCubesIncremental{BrickSize: 8}
+	meshOf(t, model(-1), 64, r)
+	m = meshOf(t, model(-0.9), 64, r)
+	if st := r.Stats(); st.Full || st.Resampled >= st.Bricks {
+		t.Errorf("expected a partial re-render, actual %+v", st)
+	}
+	checkWatertight(t, "re-render", m)
+	// the re-render is the full render on the same lattice
+	full := meshOf(t, model(-0.9), 64, &render.MarchingCubesIncremental{BrickSize: 8})
+	key := func(m *render.Mesh) map[[3][3]float64]int {
+		k := make(map[[3][3]float64]int)
+		for _, f := range m.Faces {
+			var v [3][3]float64
+			for i := range f {
+				p := m.Vertices[f[i]]
+				v[i] = [3]float64{math.Round(p.X * 1e6), math.Round(p.Y * 1e6), math.Round(p.Z * 1e6)}
+			}
+			k[v]++
+		}
+		return k
+	}
+	k0, k1 := key(m), key(full)
+	if len(m.Faces) != len(full.Faces) || len(k0) != len(k1) {
+		t.Fatalf("expected %d faces, actual %d", len(full.Faces), len(m.Faces))
+	}
+	for v, n := range k1 {
+		if k0[v] != n {
+			t.Fatalf("face %v is missing from the re-render", v)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,122 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mass Properties
+
+Volume, center of mass and inertia tensor for a closed triangle mesh.
+Based on: David Eberly, "Polyhedral Mass Properties (Revisited)"
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"errors"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// MassProperties are the mass properties of a solid (uniform density).
+type MassProperties struct {
+	Volume  float64 // volume of the solid
+	Mass    float64 // mass of the solid (volume * density)
+	Center  sdf.V3  // center of mass
+	Inertia sdf.V3  // moments of inertia about the center of mass (Ixx, Iyy, Izz)
+	Product sdf.V3  // products of inertia about the center of mass (Ixy, Iyz, Ixz)
+}
+
+//-----------------------------------------------------------------------------
+
+func massSubexpressions(w0, w1, w2 float64) (f1, f2, f3, g0, g1, g2 float64) {
+	temp0 := w0 + w1
+	f1 = temp0 + w2
+	temp1 := w0 * w0
+	temp2 := temp1 + w1*temp0
+	f2 = temp2 + w2*f1
+	f3 = w0*temp1 + w1*temp2 + w2*f2
+	g0 = f2 + w0*(f1+w0)
+	g1 = f2 + w1*(f1+w1)
+	g2 = f2 + w2*(f1+w2)
+	return
+}
+
+// massIntegrals returns the unscaled volume integrals for a set of triangles.
+func massIntegrals(mesh []*Triangle3) [10]float64 {
+	var intg [10]float64
+	for _, t := range mesh {
+		p0, p1, p2 := t.V[0], t.V[1], t.V[2]
+		d := p1.Sub(p0).Cross(p2.Sub(p0))
+		f1x, f2x, f3x, g0x, g1x, g2x := massSubexpressions(p0.X, p1.X, p2.X)
+		_, f2y, f3y, g0y, g1y, g2y := massSubexpressions(p0.Y, p1.Y, p2.Y)
+		_, f2z, f3z, g0z, g1z, g2z := massSubexpressions(p0.Z, p1.Z, p2.Z)
+		intg[0] += d.X * f1x
+		intg[1] += d.X * f2x
+		intg[2] += d.Y * f2y
+		intg[3] += d.Z * f2z
+		intg[4] += d.X * f3x
+		intg[5] += d.Y * f3y
+		intg[6] += d.Z * f3z
+		intg[7] += d.X * (p0.Y*g0x + p1.Y*g1x + p2.Y*g2x)
+		intg[8] += d.Y * (p0.Z*g0y + p1.Z*g1y + p2.Z*g2y)
+		intg[9] += d.Z * (p0.X*g0z + p1.X*g1z + p2.X*g2z)
+	}
+	return intg
+}
+
+// massChunkSize is the number of triangles integrated by each pool task.
+const massChunkSize = 1 << 14
+
+// MeshMassProperties returns the mass properties of a closed triangle mesh.
+// The triangles must be wound counter-clockwise when viewed from outside the solid.
+func MeshMassProperties(mesh []*Triangle3, density float64) (*MassProperties, error) {
+	// integrate chunks of the mesh in parallel, and sum them in order
+	chunks := make([][10]float64, (len(mesh)+massChunkSize-1)/massChunkSize)
+	g := DefaultPool().Group()
+	for i := range chunks {
+		i := i
+		g.Go(func() {
+			j := (i + 1) * massChunkSize
+			if j > len(mesh) {
+				j = len(mesh)
+			}
+			chunks[i] = massIntegrals(mesh[i*massChunkSize : j])
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	var intg [10]float64
+	for _, c := range chunks {
+		for i := range intg {
+			intg[i] += c[i]
+		}
+	}
+	mult := [10]float64{1.0 / 6, 1.0 / 24, 1.0 / 24, 1.0 / 24, 1.0 / 60, 1.0 / 60, 1.0 / 60, 1.0 / 120, 1.0 / 120, 1.0 / 120}
+	for i := range intg {
+		intg[i] *= mult[i]
+	}
+	volume := intg[0]
+	if volume <= 0 {
+		return nil, errors.New("mesh volume <= 0")
+	}
+	c := sdf.V3{intg[1], intg[2], intg[3]}.DivScalar(volume)
+	// inertia tensor relative to the center of mass (unit density)
+	xx := intg[5] + intg[6] - volume*(c.Y*c.Y+c.Z*c.Z)
+	yy := intg[4] + intg[6] - volume*(c.Z*c.Z+c.X*c.X)
+	zz := intg[4] + intg[5] - volume*(c.X*c.X+c.Y*c.Y)
+	xy := -(intg[7] - volume*c.X*c.Y)
+	yz := -(intg[8] - volume*c.Y*c.Z)
+	xz := -(intg[9] - volume*c.Z*c.X)
+	return &MassProperties{
+		Volume:  volume,
+		Mass:    volume * density,
+		Center:  c,
+		Inertia: sdf.V3{xx, yy, zz}.MulScalar(density),
+		Product: sdf.V3{xy, yz, xz}.MulScalar(density),
+	}, nil
+}
+
+//-----------------------------------------------------------------------------
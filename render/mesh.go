@@ -0,0 +1,179 @@
+//-----------------------------------------------------------------------------
+/*
+
+Indexed Meshes
+
+Renderers output triangle soup (or an indexed mesh, see IndexedRender3).
+An indexed mesh shares the vertices between triangles, which is what
+compact formats (e.g. PLY) store and what per-vertex attributes (ambient
+occlusion, curvature, colors, texture coordinates) are attached to.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"image/color"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Mesh is an indexed triangle mesh with optional per-vertex attributes.
+type Mesh struct {
+	Vertices   []sdf.V3             // vertex positions
+	Faces      [][3]int             // triangles (vertex indices, counter-clockwise)
+	Normals    []sdf.V3             // per-vertex unit normals (nil: none)
+	Attributes map[string][]float64 // named per-vertex values
+	Colors     []color.RGBA         // per-vertex colors (nil: none)
+	UVs        []sdf.V2             // per-vertex texture coordinates (nil: none)
+}
+
+// NewMesh returns the indexed mesh of a triangle soup.
+// Renderers produce identical vertices for the triangles sharing them, so
+// vertices are welded when they are equal.
+func NewMesh(triangles []*Triangle3) *Mesh {
+	m := &Mesh{Faces: make([][3]int, len(triangles))}
+	index := make(map[sdf.V3]int)
+	for i, t := range triangles {
+		for j, v := range t.V {
+			k, ok := index[v]
+			if !ok {
+				k = len(m.Vertices)
+				index[v] = k
+				m.Vertices = append(m.Vertices, v)
+			}
+			m.Faces[i][j] = k
+		}
+	}
+	return m
+}
+
+// Triangles returns the triangle soup of the mesh.
+func (m *Mesh) Triangles() []*Triangle3 {
+	var a TriangleArena
+	t := make([]*Triangle3, len(m.Faces))
+	for i, f := range m.Faces {
+		t[i] = a.New(m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]])
+	}
+	return t
+}
+
+// RenderIndexed renders an SDF3 to an indexed mesh. Renderers implementing IndexedRender3
+// produce the mesh directly, the triangles of other renderers are welded (see NewMesh).
+// It returns ctx.Err() if the context is done before the render is complete.
+func RenderIndexed(
+	ctx context.Context, // context to abort the render
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+) (*Mesh, error) {
+	ctx, span := startRenderSpan(ctx, meshCells, r)
+	s, evaluations := traceModel(span, s)
+	var m *Mesh
+	var err error
+	if ir, ok := r.(IndexedRender3); ok {
+		m, err = ir.RenderIndexed(ctx, s, meshCells)
+	} else {
+		var triangles []*Triangle3
+		triangles, err = renderTriangles(ctx, s, meshCells, r)
+		if err == nil {
+			_, weld := StartSpan(ctx, "weld")
+			m = NewMesh(triangles)
+			weld.End(nil)
+		}
+	}
+	if err != nil {
+		span.endRender(0, evaluations, err)
+		return nil, err
+	}
+	span.endRender(len(m.Faces), evaluations, nil)
+	return m, nil
+}
+
+// RenderMesh renders an SDF3 to an indexed mesh.
+// The vertex colors are sampled from the SDF3 if it has a color (see sdf.Color3D).
+func RenderMesh(
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+) (*Mesh, error) {
+	m, err := RenderIndexed(context.Background(), s, meshCells, r)
+	if err != nil {
+		return nil, err
+	}
+	if sdf.HasColor3(s) {
+		if err := m.SampleColors(s, color.RGBA{255, 255, 255, 255}); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// SampleColors sets the vertex colors of a mesh from the colors of an SDF3.
+// Vertices on uncolored parts of the SDF3 get the default color.
+func (m *Mesh) SampleColors(s sdf.SDF3, def color.RGBA) error {
+	colors := make([]color.RGBA, len(m.Vertices))
+	g := DefaultPool().Group()
+	for i := 0; i < len(colors); i += bakeChunkSize {
+		i0, i1 := i, i+bakeChunkSize
+		if i1 > len(colors) {
+			i1 = len(colors)
+		}
+		g.Go(func() {
+			for j := i0; j < i1; j++ {
+				c, ok := sdf.Color3(s, m.Vertices[j])
+				if !ok {
+					c = def
+				}
+				colors[j] = c
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	m.Colors = colors
+	return nil
+}
+
+// SampleNormals sets the vertex normals of a mesh from the gradient of an SDF3
+// (e.g. for the meshes of renderers without normals).
+func (m *Mesh) SampleNormals(s sdf.SDF3) error {
+	tol := modelTolerances(s, nil)
+	normals := make([]sdf.V3, len(m.Vertices))
+	g := DefaultPool().Group()
+	for i := 0; i < len(normals); i += bakeChunkSize {
+		i0, i1 := i, i+bakeChunkSize
+		if i1 > len(normals) {
+			i1 = len(normals)
+		}
+		g.Go(func() {
+			for j := i0; j < i1; j++ {
+				normals[j] = tol.Normal3(s, m.Vertices[j])
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	m.Normals = normals
+	return nil
+}
+
+// SetAttribute sets a named per-vertex attribute of the mesh.
+func (m *Mesh) SetAttribute(name string, values []float64) error {
+	if len(values) != len(m.Vertices) {
+		return sdf.ErrMsg("attribute length != number of vertices")
+	}
+	if m.Attributes == nil {
+		m.Attributes = make(map[string][]float64)
+	}
+	m.Attributes[name] = values
+	return nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,237 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Tests: mesh booleans, convex decomposition, mesh SDFs and mesh file
+round trips.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render_test
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// checkWatertight checks that every edge of a mesh is shared by exactly two triangles,
+// once in each direction (a closed, consistently oriented mesh).
+func checkWatertight(t *testing.T, name string, m *render.Mesh) {
+	t.Helper()
+	if len(m.Faces) == 0 {
+		t.Errorf("%s: no faces", name)
+		return
+	}
+	edges := make(map[[2]int]int)
+	for _, f := range m.Faces {
+		for i := 0; i < 3; i++ {
+			edges[[2]int{f[i], f[(i+1)%3]}]++
+		}
+	}
+	for e, n := range edges {
+		if n != 1 || edges[[2]int{e[1], e[0]}] != 1 {
+			t.Errorf("%s: edge %v is in %d triangles, the reverse edge in %d", name, e, n, edges[[2]int{e[1], e[0]}])
+			return
+		}
+	}
+}
+
+// checkVolume checks the volume of a mesh to within a relative tolerance.
+func checkVolume(t *testing.T, name string, m *render.Mesh, volume, tolerance float64) {
+	t.Helper()
+	mp, err := render.MeshMassProperties(m.Triangles(), 1)
+	if err != nil {
+		t.Errorf("%s: %v", name, err)
+		return
+	}
+	if math.Abs(mp.Volume-volume) > tolerance*volume {
+		t.Errorf("%s: expected volume %g, actual %g", name, volume, mp.Volume)
+	}
+}
+
+// meshOf renders an SDF3 to an indexed mesh.
+func meshOf(t *testing.T, s sdf.SDF3, meshCells int, r render.Render3) *render.Mesh {
+	t.Helper()
+	m, err := render.RenderIndexed(context.Background(), s, meshCells, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// checkRoundTrip saves a mesh of s to a file and loads it back, checking it has the same
+// faces and is closed with the same volume (to a relative tolerance). If imp isn't nil the
+// SDF3 imported from the file is checked to have the sign of s.
+func checkRoundTrip(t *testing.T, name string, s sdf.SDF3, m *render.Mesh,
+	save func(path string) error, load func(path string) (*render.Mesh, error), imp func(path string) (sdf.SDF3, error), tolerance float64) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "mesh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, name)
+	if err := save(path); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	loaded, err := load(path)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	if len(loaded.Faces) != len(m.Faces) {
+		t.Errorf("%s: expected %d faces, actual %d", name, len(m.Faces), len(loaded.Faces))
+	}
+	checkWatertight(t, name, loaded)
+	mp, _ := render.MeshMassProperties(m.Triangles(), 1)
+	checkVolume(t, name, loaded, mp.Volume, tolerance)
+	if imp == nil {
+		return
+	}
+	s1, err := imp(path)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	for _, p := range []sdf.V3{{0, 0, 0}, {0.5, 0.2, 0.1}, {1.5, 0, 0}, {0, -2, 0.3}} {
+		if d := s1.Evaluate(p); (d < 0) != (s.Evaluate(p) < 0) {
+			t.Errorf("%s: at %v expected the sign of %g, actual %g", name, p, s.Evaluate(p), d)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MeshCSG(t *testing.T) {
+	b0, _ := sdf.Box3D(sdf.V3{2, 2, 2}, 0)
+	b1 := sdf.Transform3D(b0, sdf.Translate3d(sdf.V3{1, 0.5, 0.25}))
+	a, b := meshOf(t, b0, 20, &render.MarchingCubesUniform{}), meshOf(t, b1, 20, &render.MarchingCubesUniform{})
+	// the overlap is 1 x 1.5 x 1.75 (less the edges rounded by marching cubes)
+	overlap := 1 * 1.5 * 1.75
+	tests := []struct {
+		name   string
+		op     func(a, b *render.Mesh) (*render.Mesh, error)
+		volume float64
+	}{
+		{"union", render.MeshUnion, 16 - overlap},
+		{"difference", render.MeshDifference, 8 - overlap},
+		{"intersection", render.MeshIntersection, overlap},
+	}
+	volume := make(map[string]float64)
+	for _, v := range tests {
+		m, err := v.op(a, b)
+		if err != nil {
+			t.Fatalf("%s: %v", v.name, err)
+		}
+		checkWatertight(t, v.name, m)
+		checkVolume(t, v.name, m, v.volume, 1e-2)
+		mp, _ := render.MeshMassProperties(m.Triangles(), 1)
+		volume[v.name] = mp.Volume
+	}
+	// the booleans of the meshes are consistent: a + b = union + intersection, a - (a & b) = difference
+	va, _ := render.MeshMassProperties(a.Triangles(), 1)
+	vb, _ := render.MeshMassProperties(b.Triangles(), 1)
+	if d := va.Volume + vb.Volume - volume["union"] - volume["intersection"]; math.Abs(d) > 1e-9 {
+		t.Errorf("union and intersection volumes are off by %g", d)
+	}
+	if d := va.Volume - volume["intersection"] - volume["difference"]; math.Abs(d) > 1e-9 {
+		t.Errorf("difference volume is off by %g", d)
+	}
+}
+
+func Test_MeshSTL(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	m := meshOf(t, sphere, 20, &render.MarchingCubesUniform{})
+	// float32 vertices
+	save := func(path string) error { return render.SaveSTL(path, m.Triangles()) }
+	checkRoundTrip(t, "a.stl", sphere, m, save, render.LoadSTL, nil, 1e-5)
+}
+
+func Test_ConvexDecomposition(t *testing.T) {
+	// an L made of two boxes
+	b0, _ := sdf.Box3D(sdf.V3{4, 1, 1}, 0)
+	b1, _ := sdf.Box3D(sdf.V3{1, 3, 1}, 0)
+	s := sdf.Union3D(b0, sdf.Transform3D(b1, sdf.Translate3d(sdf.V3{-1.5, 2, 0})))
+	hulls, err := render.ConvexDecomposition(s, &render.ConvexConfig{Resolution: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hulls) < 2 {
+		t.Errorf("expected at least 2 hulls, actual %d", len(hulls))
+	}
+	volume := 0.0
+	for _, h := range hulls {
+		checkWatertight(t, "hull", h)
+		mp, err := render.MeshMassProperties(h.Triangles(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		volume += mp.Volume
+		// every vertex is behind the plane of every face
+		for _, f := range h.Faces {
+			p0 := h.Vertices[f[0]]
+			n := h.Vertices[f[1]].Sub(p0).Cross(h.Vertices[f[2]].Sub(p0))
+			for _, p := range h.Vertices {
+				if n.Dot(p.Sub(p0)) > 1e-9*n.Length() {
+					t.Fatalf("hull isn't convex at %v", p)
+				}
+			}
+		}
+	}
+	// the hulls cover the model
+	if volume < 0.95*6 || volume > 1.3*6 {
+		t.Errorf("expected a hull volume near 6, actual %g", volume)
+	}
+}
+
+func Test_MeshSDF3(t *testing.T) {
+	box, _ := sdf.Box3D(sdf.V3{2, 1, 1}, 0)
+	s, err := render.NewMeshSDF3(meshOf(t, box, 20, &render.MarchingCubesUniform{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.BoundingBox().Equals(box.BoundingBox(), 1e-9) {
+		t.Errorf("expected box %v, actual %v", box.BoundingBox(), s.BoundingBox())
+	}
+	// the faces of the box mesh are on the faces of the box (marching cubes only rounds
+	// the edges), so the distance is exact where it's to a face
+	for _, p := range []sdf.V3{{0, 0, 0}, {0.9, 0.2, 0.1}, {2, 0, 0}, {0, 1.5, 0.2}, {-1.3, 0.1, 0.2}, {0.3, 0.1, -4}} {
+		if d, expected := s.Evaluate(p), box.Evaluate(p); math.Abs(d-expected) > 1e-6 {
+			t.Errorf("at %v expected %g, actual %g", p, expected, d)
+		}
+	}
+	if _, err := render.NewMeshSDF3(&render.Mesh{}); err == nil {
+		t.Error("expected an error for an empty mesh")
+	}
+	// an imported STL file
+	sphere, _ := sdf.Sphere3D(1)
+	m := meshOf(t, sphere, 20, &render.MarchingCubesUniform{})
+	save := func(path string) error { return render.SaveSTL(path, m.Triangles()) }
+	checkRoundTrip(t, "a.stl", sphere, m, save, render.LoadSTL, render.ImportSTL, 1e-5)
+}
+
+func Test_MeshOBJ(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	m := meshOf(t, sphere, 20, &render.MarchingCubesUniform{})
+	save := func(path string) error { return render.SaveOBJ(path, m) }
+	checkRoundTrip(t, "a.obj", sphere, m, save, render.LoadOBJ, render.ImportOBJ, 1e-9)
+}
+
+func Test_MeshPLY(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	m := meshOf(t, sphere, 20, &render.MarchingCubesUniform{})
+	// float32 vertices
+	save := func(path string) error { return render.SavePLY(path, m) }
+	checkRoundTrip(t, "a.ply", sphere, m, save, render.LoadPLY, render.ImportPLY, 1e-5)
+	save = func(path string) error { return render.SavePLYASCII(path, m) }
+	checkRoundTrip(t, "b.ply", sphere, m, save, render.LoadPLY, render.ImportMesh, 1e-5)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,309 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh SDFs
+
+A closed triangle mesh (e.g. a scanned STL, or an OBJ or PLY asset) as an
+SDF3, so it can be combined with parametric SDFs and rendered again.
+Polygon faces of OBJ and PLY files are fan triangulated (so they should
+be convex).
+
+The distance is exact: the closest triangle is found with a bounding
+volume hierarchy (BVH) of the triangles. The sign is the net count of the
+faces crossed by a ray from the point (the winding number along the ray),
+with rays in other directions when a ray hits an edge. Faces are counter-
+clockwise from the outside, and the mesh should be closed. Overlapping
+closed shells are a union.
+
+The SDF is slower to evaluate than the primitives, see sdf.NewVoxelSDF3 to
+cache it for repeated renders.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// bvhLeaf is the largest number of triangles in a BVH leaf.
+const bvhLeaf = 4
+
+// bvhNode is a node of a BVH. Leaves have a count of triangles from the start index,
+// other nodes have their children at start and start+1.
+type bvhNode struct {
+	box   sdf.Box3
+	start int32
+	count int32
+}
+
+// triangleBVH is a bounding volume hierarchy of triangles.
+type triangleBVH struct {
+	tris  []*Triangle3 // ordered by leaf
+	nodes []bvhNode
+}
+
+// newTriangleBVH returns the BVH of triangles (split at the median of the longest axis).
+func newTriangleBVH(tris []*Triangle3) *triangleBVH {
+	b := &triangleBVH{tris: make([]*Triangle3, len(tris))}
+	copy(b.tris, tris)
+	if len(tris) == 0 {
+		return b
+	}
+	centers := make(map[*Triangle3]sdf.V3, len(tris))
+	for _, t := range tris {
+		centers[t] = t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+	}
+	b.nodes = make([]bvhNode, 1, 2*len(tris)/bvhLeaf+1)
+	var build func(i, lo, hi int)
+	build = func(i, lo, hi int) {
+		t := b.tris[lo:hi]
+		box := sdf.Box3{t[0].V[0], t[0].V[0]}
+		cbox := sdf.Box3{centers[t[0]], centers[t[0]]}
+		for _, x := range t {
+			box = box.Include(x.V[0]).Include(x.V[1]).Include(x.V[2])
+			cbox = cbox.Include(centers[x])
+		}
+		b.nodes[i].box = box
+		if len(t) <= bvhLeaf {
+			b.nodes[i].start, b.nodes[i].count = int32(lo), int32(len(t))
+			return
+		}
+		size := cbox.Size()
+		axis := 0
+		if size.Y > size.X {
+			axis = 1
+		}
+		if size.Z > math.Max(size.X, size.Y) {
+			axis = 2
+		}
+		key := func(x *Triangle3) float64 {
+			c := centers[x]
+			return [3]float64{c.X, c.Y, c.Z}[axis]
+		}
+		sort.Slice(t, func(j, k int) bool { return key(t[j]) < key(t[k]) })
+		child := int32(len(b.nodes))
+		b.nodes = append(b.nodes, bvhNode{}, bvhNode{})
+		b.nodes[i].start = child
+		mid := (lo + hi) / 2
+		build(int(child), lo, mid)
+		build(int(child)+1, mid, hi)
+	}
+	build(0, 0, len(tris))
+	return b
+}
+
+// bvhBoxDist2 returns the squared distance from a point to a box (0: inside).
+func bvhBoxDist2(b sdf.Box3, p sdf.V3) float64 {
+	return p.Sub(p.Clamp(b.Min, b.Max)).Length2()
+}
+
+// nearest returns the distance from a point to the closest triangle (+Inf: no triangles).
+func (b *triangleBVH) nearest(p sdf.V3) float64 {
+	best := math.Inf(1)
+	if len(b.nodes) == 0 {
+		return best
+	}
+	var stack [64]int32
+	stack[0] = 0
+	n := 1
+	for n > 0 {
+		n--
+		node := &b.nodes[stack[n]]
+		if bvhBoxDist2(node.box, p) >= best {
+			continue
+		}
+		if node.count > 0 {
+			for _, t := range b.tris[node.start : node.start+node.count] {
+				if d := p.Sub(t.ClosestPoint(p)).Length2(); d < best {
+					best = d
+				}
+			}
+			continue
+		}
+		// visit the closer child first
+		c0, c1 := node.start, node.start+1
+		if bvhBoxDist2(b.nodes[c0].box, p) < bvhBoxDist2(b.nodes[c1].box, p) {
+			c0, c1 = c1, c0
+		}
+		stack[n], stack[n+1] = c0, c1
+		n += 2
+	}
+	return math.Sqrt(best)
+}
+
+// bvhRayBox returns true if a ray (with the inverse of its direction) hits a box.
+func bvhRayBox(b sdf.Box3, p, inv sdf.V3) bool {
+	lo, hi := [3]float64{b.Min.X, b.Min.Y, b.Min.Z}, [3]float64{b.Max.X, b.Max.Y, b.Max.Z}
+	o, k := [3]float64{p.X, p.Y, p.Z}, [3]float64{inv.X, inv.Y, inv.Z}
+	t0, t1 := 0.0, math.Inf(1)
+	for i := range o {
+		ta, tb := (lo[i]-o[i])*k[i], (hi[i]-o[i])*k[i]
+		if ta > tb {
+			ta, tb = tb, ta
+		}
+		t0, t1 = math.Max(t0, ta), math.Min(t1, tb)
+		if t0 > t1 {
+			return false
+		}
+	}
+	return true
+}
+
+// crossings returns the signed crossings of the triangles by a ray from a point along a
+// direction (+1 for leaving through a counter-clockwise face). It returns false if the ray
+// hits an edge or the point is on a triangle, to within a tolerance.
+func (b *triangleBVH) crossings(p, d sdf.V3, eps float64) (int, bool) {
+	if len(b.nodes) == 0 {
+		return 0, true
+	}
+	const edgeTol = 1e-9
+	inv := sdf.V3{1 / d.X, 1 / d.Y, 1 / d.Z}
+	var stack [64]int32
+	stack[0] = 0
+	n, count := 1, 0
+	for n > 0 {
+		n--
+		node := &b.nodes[stack[n]]
+		if !bvhRayBox(node.box, p, inv) {
+			continue
+		}
+		if node.count == 0 {
+			stack[n], stack[n+1] = node.start, node.start+1
+			n += 2
+			continue
+		}
+		for _, t := range b.tris[node.start : node.start+node.count] {
+			// Moller-Trumbore
+			e1, e2 := t.V[1].Sub(t.V[0]), t.V[2].Sub(t.V[0])
+			pv := d.Cross(e2)
+			det := e1.Dot(pv)
+			if math.Abs(det) <= edgeTol*e1.Length()*e2.Length() {
+				continue
+			}
+			s := p.Sub(t.V[0])
+			u := s.Dot(pv) / det
+			if u < -edgeTol || u > 1+edgeTol {
+				continue
+			}
+			q := s.Cross(e1)
+			v := d.Dot(q) / det
+			if v < -edgeTol || u+v > 1+edgeTol {
+				continue
+			}
+			h := e2.Dot(q) / det
+			if h < -eps {
+				continue
+			}
+			if h <= eps || u <= edgeTol || v <= edgeTol || u+v >= 1-edgeTol {
+				return count, false
+			}
+			if det < 0 {
+				count++
+			} else {
+				count--
+			}
+		}
+	}
+	return count, true
+}
+
+//-----------------------------------------------------------------------------
+
+// meshRays are the directions of the sign rays (not on the axes, so they rarely hit the
+// edges of axis aligned faces).
+var meshRays = []sdf.V3{
+	sdf.V3{0.5773, 0.5774, 0.5775}.Normalize(),
+	sdf.V3{-0.3187, 0.8756, -0.3631}.Normalize(),
+	sdf.V3{0.7071, -0.1513, -0.6908}.Normalize(),
+	sdf.V3{-0.2260, -0.4193, 0.8792}.Normalize(),
+}
+
+// MeshSDF3 is the SDF3 of a closed triangle mesh.
+type MeshSDF3 struct {
+	bvh *triangleBVH
+	bb  sdf.Box3
+	eps float64
+}
+
+// NewMeshSDF3 returns the SDF3 of a closed indexed mesh (counter-clockwise faces).
+func NewMeshSDF3(m *Mesh) (*MeshSDF3, error) {
+	if len(m.Faces) == 0 {
+		return nil, sdf.ErrMsg("no faces")
+	}
+	s := &MeshSDF3{bvh: newTriangleBVH(m.Triangles())}
+	s.bb = s.bvh.nodes[0].box
+	s.eps = 1e-9 * s.bb.Size().MaxComponent()
+	return s, nil
+}
+
+// ImportSTL returns the SDF3 of a closed mesh in an STL file (binary or ASCII).
+func ImportSTL(path string) (sdf.SDF3, error) {
+	return importMesh(path, LoadSTL)
+}
+
+// ImportOBJ returns the SDF3 of a closed mesh in an OBJ file.
+func ImportOBJ(path string) (sdf.SDF3, error) {
+	return importMesh(path, LoadOBJ)
+}
+
+// ImportPLY returns the SDF3 of a closed mesh in a PLY file (binary or ASCII).
+func ImportPLY(path string) (sdf.SDF3, error) {
+	return importMesh(path, LoadPLY)
+}
+
+// ImportMesh returns the SDF3 of a closed mesh in an STL, OBJ or PLY file (by its extension).
+func ImportMesh(path string) (sdf.SDF3, error) {
+	switch ext := normalizeExt(filepath.Ext(path)); ext {
+	case ".stl":
+		return ImportSTL(path)
+	case ".obj":
+		return ImportOBJ(path)
+	case ".ply":
+		return ImportPLY(path)
+	default:
+		return nil, sdf.ErrMsg(fmt.Sprintf("no mesh importer for \"%s\"", ext))
+	}
+}
+
+// importMesh returns the SDF3 of a mesh file read by a loader.
+func importMesh(path string, load func(path string) (*Mesh, error)) (sdf.SDF3, error) {
+	m, err := load(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewMeshSDF3(m)
+}
+
+// Evaluate returns the signed distance to the mesh.
+func (s *MeshSDF3) Evaluate(p sdf.V3) float64 {
+	d := s.bvh.nearest(p)
+	if !s.bb.Contains(p) {
+		return d
+	}
+	for _, r := range meshRays {
+		if n, ok := s.bvh.crossings(p, r, s.eps); ok {
+			if n > 0 {
+				return -d
+			}
+			return d
+		}
+	}
+	// on the surface
+	return 0
+}
+
+// BoundingBox returns the bounding box of the mesh.
+func (s *MeshSDF3) BoundingBox() sdf.Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,127 @@
+//-----------------------------------------------------------------------------
+/*
+
+Mesh Transforms
+
+Scale, rotate, translate and mirror indexed meshes, convert their units,
+and place them on the origin or the build plate, e.g. to fix an imported
+mesh modelled in inches before export. A triangle soup can be transformed
+as an indexed mesh (see NewMesh).
+
+The vertex normals are transformed with the mesh, and transforms that
+mirror the mesh reverse the triangle winding so it stays outward facing.
+Other per-vertex attributes are unchanged.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Unit is a length unit, as its length in millimetres.
+type Unit float64
+
+// Length units.
+const (
+	Millimetre Unit = 1
+	Centimetre Unit = 10
+	Metre      Unit = 1000
+	Inch       Unit = sdf.MillimetresPerInch
+	Foot       Unit = 12 * sdf.MillimetresPerInch
+)
+
+//-----------------------------------------------------------------------------
+
+// Transform applies a transformation matrix to a mesh.
+func (m *Mesh) Transform(a sdf.M44) error {
+	det := a.Determinant()
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return sdf.ErrMsg("singular transform")
+	}
+	for i, v := range m.Vertices {
+		m.Vertices[i] = a.MulPosition(v)
+	}
+	if m.Normals != nil {
+		// normals transform by the inverse transpose
+		inv := a.Inverse()
+		o := inv.MulPosition(sdf.V3{})
+		cx := inv.MulPosition(sdf.V3{1, 0, 0}).Sub(o)
+		cy := inv.MulPosition(sdf.V3{0, 1, 0}).Sub(o)
+		cz := inv.MulPosition(sdf.V3{0, 0, 1}).Sub(o)
+		for i, n := range m.Normals {
+			m.Normals[i] = sdf.V3{cx.Dot(n), cy.Dot(n), cz.Dot(n)}.Normalize()
+		}
+	}
+	if det < 0 {
+		for i, f := range m.Faces {
+			m.Faces[i] = [3]int{f[0], f[2], f[1]}
+		}
+	}
+	return nil
+}
+
+// Translate moves a mesh.
+func (m *Mesh) Translate(v sdf.V3) {
+	for i := range m.Vertices {
+		m.Vertices[i] = m.Vertices[i].Add(v)
+	}
+}
+
+// Scale scales a mesh about the origin (negative factors mirror the mesh).
+func (m *Mesh) Scale(v sdf.V3) error {
+	return m.Transform(sdf.Scale3d(v))
+}
+
+// Rotate rotates a mesh about an axis through the origin (right hand rule).
+func (m *Mesh) Rotate(axis sdf.V3, angle float64) error {
+	if axis.Length() == 0 {
+		return sdf.ErrMsg("zero rotation axis")
+	}
+	return m.Transform(sdf.Rotate3d(axis, angle))
+}
+
+// Mirror mirrors a mesh across the plane through the origin with a normal.
+func (m *Mesh) Mirror(normal sdf.V3) error {
+	if normal.Length() == 0 {
+		return sdf.ErrMsg("zero mirror plane normal")
+	}
+	// a half turn about the normal, then a point reflection
+	return m.Transform(sdf.Scale3d(sdf.V3{-1, -1, -1}).Mul(sdf.Rotate3d(normal, sdf.Pi)))
+}
+
+// ConvertUnits scales a mesh from one length unit to another,
+// e.g. from inches to millimetres for a mesh exported in inches.
+func (m *Mesh) ConvertUnits(from, to Unit) error {
+	if from <= 0 || to <= 0 {
+		return sdf.ErrMsg("units must be > 0")
+	}
+	k := float64(from / to)
+	return m.Scale(sdf.V3{k, k, k})
+}
+
+// Recenter moves the center of the bounding box of a mesh to the origin.
+// It returns the translation.
+func (m *Mesh) Recenter() sdf.V3 {
+	v := m.bounds().Center().Neg()
+	m.Translate(v)
+	return v
+}
+
+// PlaceOnPlate moves a mesh onto the build plate: centered on the z axis with its
+// lowest point at z = 0. It returns the translation.
+func (m *Mesh) PlaceOnPlate() sdf.V3 {
+	bb := m.bounds()
+	c := bb.Center()
+	v := sdf.V3{-c.X, -c.Y, -bb.Min.Z}
+	m.Translate(v)
+	return v
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+//-----------------------------------------------------------------------------
+/*
+
+Memory-Mapped Storage (unsupported platforms)
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import "github.com/deadsy/sdfx/sdf"
+
+//-----------------------------------------------------------------------------
+
+func newMmapStorage(dir string) (triStorage, error) {
+	return nil, sdf.ErrMsg("memory-mapped triangle buffers are not supported on this platform")
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,70 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+//-----------------------------------------------------------------------------
+/*
+
+Memory-Mapped Storage (unix)
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+)
+
+//-----------------------------------------------------------------------------
+
+// mmapStorage is triangle storage in a memory-mapped temporary file.
+type mmapStorage struct {
+	f    *os.File
+	data []byte
+}
+
+func newMmapStorage(dir string) (triStorage, error) {
+	f, err := ioutil.TempFile(dir, "sdfx-triangles-")
+	if err != nil {
+		return nil, err
+	}
+	return &mmapStorage{f: f}, nil
+}
+
+func (m *mmapStorage) unmap() error {
+	if m.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(m.data)
+	m.data = nil
+	return err
+}
+
+func (m *mmapStorage) resize(size int) ([]byte, error) {
+	// the old mapping is flushed to the file by munmap
+	if err := m.unmap(); err != nil {
+		return nil, err
+	}
+	if err := m.f.Truncate(int64(size)); err != nil {
+		return nil, err
+	}
+	data, err := syscall.Mmap(int(m.f.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, err
+	}
+	m.data = data
+	return data, nil
+}
+
+func (m *mmapStorage) close() error {
+	err := m.unmap()
+	m.f.Close()
+	if rmErr := os.Remove(m.f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+//-----------------------------------------------------------------------------
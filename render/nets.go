@@ -0,0 +1,357 @@
+//-----------------------------------------------------------------------------
+/*
+
+Surface Nets
+
+A dual renderer between marching cubes and dual contouring: each cube of
+the lattice crossed by the surface has a single vertex, and each lattice
+edge crossing the surface gives a quad joining the vertices of the four
+cubes around it.
+
+A naive surface nets vertex is the mean of the edge crossings of its cube.
+Smoothing relaxes each vertex toward the mean of its neighbours, constrained
+to its cube (Gibson's constrained elastic surface nets), and projection moves
+each vertex onto the surface along the gradient. There is no QEF to solve, so
+it is much faster than dual contouring, but sharp edges are rounded: it suits
+organic shapes.
+
+A cube crossed by separate sheets of the surface has one vertex for all of
+them, so at thin features the mesh may be non-manifold.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// netsProjectSteps is the maximum number of steps projecting a vertex onto the surface.
+const netsProjectSteps = 8
+
+// SurfaceNets renders using surface nets with uniform space sampling.
+type SurfaceNets struct {
+	Smoothing  int             // constrained smoothing iterations (0: naive surface nets)
+	Project    bool            // move the vertices onto the surface (within their cubes)
+	Tolerances *sdf.Tolerances // nil: derived from the bounding box
+	Resolution *Resolution     // nil: cubic cells
+}
+
+// Info returns a string describing the rendered volume.
+func (r *SurfaceNets) Info(s sdf.SDF3, meshCells int) string {
+	return (&MarchingCubesUniform{Resolution: r.Resolution}).Info(s, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+func (r *SurfaceNets) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	r.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (r *SurfaceNets) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	m, err := r.RenderIndexed(ctx, s, meshCells)
+	if err != nil {
+		return err
+	}
+	for _, t := range m.Triangles() {
+		output <- t
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// netsGrid is the sampled field of a surface nets render.
+type netsGrid struct {
+	base  sdf.V3    // lattice origin
+	inc   sdf.V3    // lattice step
+	steps sdf.V3i   // cubes on each axis
+	val   []float64 // field values at the lattice points
+}
+
+// node returns the index of a lattice point.
+func (g *netsGrid) node(x, y, z int) int {
+	return (x*(g.steps[1]+1)+y)*(g.steps[2]+1) + z
+}
+
+// cell returns the index of a cube.
+func (g *netsGrid) cell(x, y, z int) int {
+	return (x*g.steps[1]+y)*g.steps[2] + z
+}
+
+// cellBox returns the bounding box of a cube (by index).
+func (g *netsGrid) cellBox(c int) sdf.Box3 {
+	z := c % g.steps[2]
+	y := c / g.steps[2] % g.steps[1]
+	x := c / (g.steps[1] * g.steps[2])
+	p := g.base.Add(sdf.V3{float64(x), float64(y), float64(z)}.Mul(g.inc))
+	return sdf.Box3{p, p.Add(g.inc)}
+}
+
+// netsVertex is the naive surface nets vertex of a cube.
+type netsVertex struct {
+	cell int    // cube index
+	p    sdf.V3 // mean of the edge crossings
+}
+
+// vertices returns the naive vertices of the cubes crossed by the surface in a slab x.
+func (g *netsGrid) vertices(x int) []netsVertex {
+	var vs []netsVertex
+	var v [8]float64
+	var p [8]sdf.V3
+	for y := 0; y < g.steps[1]; y++ {
+		for z := 0; z < g.steps[2]; z++ {
+			inside := 0
+			for i, c := range mc33Corners {
+				cx, cy, cz := x+int(c.X), y+int(c.Y), z+int(c.Z)
+				v[i] = g.val[g.node(cx, cy, cz)]
+				p[i] = g.base.Add(sdf.V3{float64(cx), float64(cy), float64(cz)}.Mul(g.inc))
+				if v[i] < 0 {
+					inside++
+				}
+			}
+			if inside == 0 || inside == 8 {
+				continue
+			}
+			var sum sdf.V3
+			n := 0
+			for _, e := range mcPairTable {
+				v0, v1 := v[e[0]], v[e[1]]
+				if (v0 < 0) == (v1 < 0) {
+					continue
+				}
+				t := v0 / (v0 - v1)
+				sum = sum.Add(p[e[0]].Add(p[e[1]].Sub(p[e[0]]).MulScalar(t)))
+				n++
+			}
+			vs = append(vs, netsVertex{g.cell(x, y, z), sum.DivScalar(float64(n))})
+		}
+	}
+	return vs
+}
+
+// quads returns the quads (cube indices, counter-clockwise) for the lattice edges crossing the
+// surface from the lattice points in a slab x.
+func (g *netsGrid) quads(x int) [][4]int {
+	var qs [][4]int
+	for y := 0; y <= g.steps[1]; y++ {
+		for z := 0; z <= g.steps[2]; z++ {
+			n := [3]int{x, y, z}
+			v0 := g.val[g.node(x, y, z)]
+			for a := 0; a < 3; a++ {
+				b, c := (a+1)%3, (a+2)%3
+				if n[a] >= g.steps[a] || n[b] < 1 || n[b] >= g.steps[b] || n[c] < 1 || n[c] >= g.steps[c] {
+					continue
+				}
+				n1 := n
+				n1[a]++
+				v1 := g.val[g.node(n1[0], n1[1], n1[2])]
+				if (v0 < 0) == (v1 < 0) {
+					continue
+				}
+				// the cubes around the edge, counter-clockwise about the axis
+				var q [4]int
+				for i, d := range [4][2]int{{-1, -1}, {0, -1}, {0, 0}, {-1, 0}} {
+					m := n
+					m[b] += d[0]
+					m[c] += d[1]
+					q[i] = g.cell(m[0], m[1], m[2])
+				}
+				if v0 >= 0 {
+					// the surface faces -axis
+					q[1], q[3] = q[3], q[1]
+				}
+				qs = append(qs, q)
+			}
+		}
+	}
+	return qs
+}
+
+//-----------------------------------------------------------------------------
+
+// RenderIndexed renders an SDF3 to an indexed mesh with vertex normals.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (r *SurfaceNets) RenderIndexed(ctx context.Context, s sdf.SDF3, meshCells int) (*Mesh, error) {
+	if r.Smoothing < 0 {
+		return nil, sdf.ErrMsg("smoothing iterations < 0")
+	}
+	// the same lattice as MarchingCubesUniform
+	base, inc, steps := uniformLattice(s, meshCells, r.Resolution)
+	tol := modelTolerances(s, r.Tolerances)
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+
+	// sample the field
+	_, phase := StartSpan(ctx, "nets.sample")
+	g := &netsGrid{base, inc, steps, make([]float64, (steps[0]+1)*(steps[1]+1)*(steps[2]+1))}
+	xs := mcLattice(base.X, inc.X, 0, steps[0])
+	ys := mcLattice(base.Y, inc.Y, 0, steps[1])
+	zs := mcLattice(base.Z, inc.Z, 0, steps[2])
+	layer := len(ys) * len(zs)
+	for x := range xs {
+		if err := ctx.Err(); err != nil {
+			phase.End(err)
+			return nil, err
+		}
+		if err := mcEvaluateLayer(s, xs[x], ys, zs, g.val[x*layer:(x+1)*layer]); err != nil {
+			phase.End(err)
+			return nil, err
+		}
+		if x != 0 {
+			progress.Add(int64(steps[1])*int64(steps[2]), 0)
+		}
+	}
+
+	phase.End(nil)
+
+	// the naive vertices and the quads, by slab
+	_, phase = StartSpan(ctx, "nets.contour")
+	slabVertices := make([][]netsVertex, steps[0])
+	slabQuads := make([][][4]int, steps[0]+1)
+	group := DefaultPool().Group()
+	for x := 0; x <= steps[0]; x++ {
+		x := x
+		group.Go(func() {
+			if x < steps[0] {
+				slabVertices[x] = g.vertices(x)
+			}
+			slabQuads[x] = g.quads(x)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		phase.End(err)
+		return nil, err
+	}
+	m := &Mesh{}
+	var cells []int
+	index := make(map[int]int)
+	for _, vs := range slabVertices {
+		for _, v := range vs {
+			index[v.cell] = len(m.Vertices)
+			m.Vertices = append(m.Vertices, v.p)
+			cells = append(cells, v.cell)
+		}
+	}
+	var quads [][4]int
+	for _, qs := range slabQuads {
+		for _, q := range qs {
+			quads = append(quads, [4]int{index[q[0]], index[q[1]], index[q[2]], index[q[3]]})
+		}
+	}
+
+	phase.End(nil)
+
+	// constrained smoothing
+	if r.Smoothing > 0 {
+		_, phase = StartSpan(ctx, "nets.smooth", Attribute{"iterations", r.Smoothing})
+		neighbours := netsNeighbours(len(m.Vertices), quads)
+		next := make([]sdf.V3, len(m.Vertices))
+		for k := 0; k < r.Smoothing; k++ {
+			if err := ctx.Err(); err != nil {
+				phase.End(err)
+				return nil, err
+			}
+			err := netsChunks(len(next), func(i int) {
+				var sum sdf.V3
+				for _, j := range neighbours[i] {
+					sum = sum.Add(m.Vertices[j])
+				}
+				next[i] = m.Vertices[i]
+				if len(neighbours[i]) != 0 {
+					box := g.cellBox(cells[i])
+					next[i] = sum.DivScalar(float64(len(neighbours[i]))).Clamp(box.Min, box.Max)
+				}
+			})
+			if err != nil {
+				phase.End(err)
+				return nil, err
+			}
+			m.Vertices, next = next, m.Vertices
+		}
+		phase.End(nil)
+	}
+
+	// projection onto the surface and the normals
+	_, phase = StartSpan(ctx, "nets.project")
+	m.Normals = make([]sdf.V3, len(m.Vertices))
+	err := netsChunks(len(m.Vertices), func(i int) {
+		p := m.Vertices[i]
+		if r.Project {
+			box := g.cellBox(cells[i])
+			for k := 0; k < netsProjectSteps; k++ {
+				d := s.Evaluate(p)
+				if math.Abs(d) < tol.Surface {
+					break
+				}
+				p = p.Sub(tol.Normal3(s, p).MulScalar(d)).Clamp(box.Min, box.Max)
+			}
+			m.Vertices[i] = p
+		}
+		m.Normals[i] = tol.Normal3(s, p)
+	})
+	phase.End(err)
+	if err != nil {
+		return nil, err
+	}
+
+	// split the quads on the shorter diagonal
+	m.Faces = make([][3]int, 0, 2*len(quads))
+	for _, q := range quads {
+		v := m.Vertices
+		if v[q[0]].Sub(v[q[2]]).Length2() <= v[q[1]].Sub(v[q[3]]).Length2() {
+			m.Faces = append(m.Faces, [3]int{q[0], q[1], q[2]}, [3]int{q[0], q[2], q[3]})
+		} else {
+			m.Faces = append(m.Faces, [3]int{q[0], q[1], q[3]}, [3]int{q[1], q[2], q[3]})
+		}
+	}
+	progress.Add(0, int64(len(m.Faces)))
+	progress.Done()
+	return m, nil
+}
+
+// netsNeighbours returns the neighbours of the vertices joined by the quad edges.
+func netsNeighbours(n int, quads [][4]int) [][]int {
+	neighbours := make([][]int, n)
+	seen := make(map[[2]int]bool)
+	for _, q := range quads {
+		for j := range q {
+			a, b := q[j], q[(j+1)%4]
+			if a > b {
+				a, b = b, a
+			}
+			if a == b || seen[[2]int{a, b}] {
+				continue
+			}
+			seen[[2]int{a, b}] = true
+			neighbours[a] = append(neighbours[a], b)
+			neighbours[b] = append(neighbours[b], a)
+		}
+	}
+	return neighbours
+}
+
+// netsChunks calls fn for the vertices 0..n-1, in parallel chunks.
+func netsChunks(n int, fn func(i int)) error {
+	g := DefaultPool().Group()
+	for i := 0; i < n; i += bakeChunkSize {
+		i0, i1 := i, i+bakeChunkSize
+		if i1 > n {
+			i1 = n
+		}
+		g.Go(func() {
+			for j := i0; j < i1; j++ {
+				fn(j)
+			}
+		})
+	}
+	return g.Wait()
+}
+
+//-----------------------------------------------------------------------------
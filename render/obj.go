@@ -0,0 +1,187 @@
+//-----------------------------------------------------------------------------
+/*
+
+OBJ Load/Save
+
+Wavefront OBJ with per-vertex normals (v/vn/f records), for DCC tools that
+need smooth shading. Meshes without normals get area weighted normals of
+their faces. Texture coordinates are written as vt records and vertex
+colors as the common "v x y z r g b" extension.
+
+Multi-part files have an object (and a group of the same name) for each
+part. The indices are global, so the parts follow each other.
+
+Loading reads the vertex positions and the faces (polygons are fan
+triangulated), other records are ignored.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// PartOBJ is an object of a multi-part OBJ file.
+type PartOBJ struct {
+	Name   string // object and group name ("": part_<index>)
+	Mesh   *Mesh
+	Offset sdf.V3 // position of the object
+}
+
+// SaveOBJ writes an indexed mesh (with its normals, texture coordinates and vertex colors) to an OBJ file.
+func SaveOBJ(path string, m *Mesh) error {
+	return SaveOBJParts(path, []PartOBJ{{Name: "sdfx", Mesh: m}})
+}
+
+// SaveOBJParts writes meshes as separate objects of an OBJ file.
+func SaveOBJParts(path string, parts []PartOBJ) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buf := bufio.NewWriter(file)
+	fmt.Fprintf(buf, "# sdfx\n")
+	base := 1
+	for i, p := range parts {
+		m := p.Mesh
+		name := p.Name
+		if name == "" {
+			name = fmt.Sprintf("part_%d", i)
+		}
+		fmt.Fprintf(buf, "o %s\ng %s\n", name, name)
+		for j, v := range m.Vertices {
+			v = v.Add(p.Offset)
+			if m.Colors != nil {
+				c := m.Colors[j]
+				fmt.Fprintf(buf, "v %g %g %g %.4g %.4g %.4g\n", v.X, v.Y, v.Z,
+					float64(c.R)/255, float64(c.G)/255, float64(c.B)/255)
+			} else {
+				fmt.Fprintf(buf, "v %g %g %g\n", v.X, v.Y, v.Z)
+			}
+		}
+		for _, uv := range m.UVs {
+			fmt.Fprintf(buf, "vt %g %g\n", uv.X, uv.Y)
+		}
+		normals := m.Normals
+		if normals == nil {
+			normals = m.vertexNormals()
+		}
+		for _, n := range normals {
+			fmt.Fprintf(buf, "vn %g %g %g\n", n.X, n.Y, n.Z)
+		}
+		// the vertices, texture coordinates and normals have the same indices
+		for _, f := range m.Faces {
+			a, b, c := f[0]+base, f[1]+base, f[2]+base
+			if m.UVs != nil {
+				fmt.Fprintf(buf, "f %d/%d/%d %d/%d/%d %d/%d/%d\n", a, a, a, b, b, b, c, c, c)
+			} else {
+				fmt.Fprintf(buf, "f %d//%d %d//%d %d//%d\n", a, a, b, b, c, c)
+			}
+		}
+		base += len(m.Vertices)
+	}
+	return buf.Flush()
+}
+
+// vertexNormals returns the area weighted normals of the faces around each vertex.
+func (m *Mesh) vertexNormals() []sdf.V3 {
+	normals := make([]sdf.V3, len(m.Vertices))
+	for _, f := range m.Faces {
+		a, b, c := m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]
+		// the cross product length is twice the area
+		n := b.Sub(a).Cross(c.Sub(a))
+		for _, k := range f {
+			normals[k] = normals[k].Add(n)
+		}
+	}
+	for i, n := range normals {
+		if l := n.Length(); l > 0 {
+			normals[i] = n.DivScalar(l)
+		}
+	}
+	return normals
+}
+
+//-----------------------------------------------------------------------------
+
+// ReadOBJ reads an indexed mesh from an OBJ stream.
+func ReadOBJ(r io.Reader) (*Mesh, error) {
+	m := &Mesh{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: bad vertex", line)
+			}
+			var v [3]float64
+			for i := range v {
+				x, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", line, err)
+				}
+				v[i] = x
+			}
+			m.Vertices = append(m.Vertices, sdf.V3{v[0], v[1], v[2]})
+		case "f":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: face with less than 3 vertices", line)
+			}
+			// v, v/vt, v//vn or v/vt/vn, negative indices are relative to the last vertex
+			idx := make([]int, len(fields)-1)
+			for i, x := range fields[1:] {
+				k, err := strconv.Atoi(strings.SplitN(x, "/", 2)[0])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", line, err)
+				}
+				if k < 0 {
+					k += len(m.Vertices)
+				} else {
+					k--
+				}
+				if k < 0 || k >= len(m.Vertices) {
+					return nil, fmt.Errorf("line %d: bad vertex index", line)
+				}
+				idx[i] = k
+			}
+			for i := 1; i < len(idx)-1; i++ {
+				m.Faces = append(m.Faces, [3]int{idx[0], idx[i], idx[i+1]})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadOBJ reads an indexed mesh from an OBJ file.
+func LoadOBJ(path string) (*Mesh, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadOBJ(file)
+}
+
+//-----------------------------------------------------------------------------
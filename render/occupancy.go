@@ -0,0 +1,241 @@
+//-----------------------------------------------------------------------------
+/*
+
+Occupancy Grids
+
+A binary voxelization of an SDF3 (occupied: the voxel center is inside)
+with run-length encoded scanlines, for collision checking and path
+planning rather than meshing.
+
+File format (little-endian):
+
+	magic   [8]byte   "SDFXOCC1"
+	size    [3]uint32 voxels on x, y, z
+	origin  [3]float64 minimum corner of the grid
+	voxel   [3]float64 voxel size on x, y, z
+	scanlines         for z, for y: a scanline along x
+
+A scanline is a uvarint run count followed by the uvarint run lengths.
+Runs alternate between free and occupied, starting with free (the first
+run may have zero length), and add up to size x.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+const occupancyMagic = "SDFXOCC1"
+
+// maxOccupancyVoxels bounds the grid size read from a header (a 256 MiB bitmap).
+const maxOccupancyVoxels = 1 << 31
+
+// Occupancy is a decoded occupancy grid.
+type Occupancy struct {
+	Size   sdf.V3i // voxels on each axis
+	Origin sdf.V3  // minimum corner of the grid
+	Voxel  sdf.V3  // voxel size
+	bits   []uint64
+}
+
+// Occupied returns true if a voxel is occupied. Voxels outside the grid are free.
+func (o *Occupancy) Occupied(x, y, z int) bool {
+	if x < 0 || y < 0 || z < 0 || x >= o.Size[0] || y >= o.Size[1] || z >= o.Size[2] {
+		return false
+	}
+	i := (z*o.Size[1]+y)*o.Size[0] + x
+	return o.bits[i>>6]&(1<<uint(i&63)) != 0
+}
+
+// Center returns the center of a voxel.
+func (o *Occupancy) Center(x, y, z int) sdf.V3 {
+	return o.Origin.Add(sdf.V3{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5}.Mul(o.Voxel))
+}
+
+//-----------------------------------------------------------------------------
+
+// occupancyLattice returns the grid (origin, voxel size, voxels) covering the bounding box of an SDF3
+// with meshCells voxels on the longest axis.
+func occupancyLattice(s sdf.SDF3, meshCells int) (sdf.V3, sdf.V3, sdf.V3i) {
+	return voxelLattice(s.BoundingBox(), meshCells)
+}
+
+// voxelLattice returns the grid (origin, voxel size, voxels) covering a box
+// with meshCells voxels on the longest axis.
+func voxelLattice(bb sdf.Box3, meshCells int) (sdf.V3, sdf.V3, sdf.V3i) {
+	size := bb.Size()
+	k := size.MaxComponent() / float64(meshCells)
+	n := size.DivScalar(k).Ceil().ToV3i()
+	for i := range n {
+		if n[i] < 1 {
+			n[i] = 1
+		}
+	}
+	// center the grid on the bounding box
+	origin := bb.Center().Sub(n.ToV3().MulScalar(k / 2))
+	return origin, sdf.V3{k, k, k}, n
+}
+
+// SaveOccupancy writes the run-length encoded occupancy grid of an SDF3 to a file.
+// The grid covers the bounding box with meshCells voxels on the longest axis.
+func SaveOccupancy(path string, s sdf.SDF3, meshCells int) error {
+	if meshCells <= 0 {
+		return sdf.ErrMsg("meshCells <= 0")
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buf := bufio.NewWriter(file)
+	if err := WriteOccupancy(buf, s, meshCells); err != nil {
+		return err
+	}
+	return buf.Flush()
+}
+
+// WriteOccupancy writes the run-length encoded occupancy grid of an SDF3 (see SaveOccupancy).
+// The z layers are sampled in parallel and written in order.
+func WriteOccupancy(w io.Writer, s sdf.SDF3, meshCells int) error {
+	origin, voxel, n := occupancyLattice(s, meshCells)
+	hdr := make([]byte, 0, 8+3*4+6*8)
+	hdr = append(hdr, occupancyMagic...)
+	var b [8]byte
+	for _, x := range n {
+		binary.LittleEndian.PutUint32(b[:4], uint32(x))
+		hdr = append(hdr, b[:4]...)
+	}
+	for _, x := range []float64{origin.X, origin.Y, origin.Z, voxel.X, voxel.Y, voxel.Z} {
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(x))
+		hdr = append(hdr, b[:]...)
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	// encode batches of layers in parallel
+	batch := MaxParallelism()
+	layers := make([][]byte, batch)
+	for z0 := 0; z0 < n[2]; z0 += batch {
+		g := DefaultPool().Group()
+		for k := 0; k < batch && z0+k < n[2]; k++ {
+			k := k
+			g.Go(func() {
+				layers[k] = occupancyLayer(layers[k][:0], s, origin, voxel, n, z0+k)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		for k := 0; k < batch && z0+k < n[2]; k++ {
+			if _, err := w.Write(layers[k]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// occupancyLayer appends the encoded scanlines of a z layer.
+func occupancyLayer(b []byte, s sdf.SDF3, origin, voxel sdf.V3, n sdf.V3i, z int) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	var runs []int
+	for y := 0; y < n[1]; y++ {
+		runs = runs[:0]
+		occupied, run := false, 0
+		for x := 0; x < n[0]; x++ {
+			p := origin.Add(sdf.V3{float64(x) + 0.5, float64(y) + 0.5, float64(z) + 0.5}.Mul(voxel))
+			if inside := s.Evaluate(p) <= 0; inside != occupied {
+				runs = append(runs, run)
+				occupied, run = inside, 0
+			}
+			run++
+		}
+		runs = append(runs, run)
+		b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(len(runs)))]...)
+		for _, r := range runs {
+			b = append(b, tmp[:binary.PutUvarint(tmp[:], uint64(r))]...)
+		}
+	}
+	return b
+}
+
+//-----------------------------------------------------------------------------
+
+// ReadOccupancy decodes a run-length encoded occupancy grid.
+func ReadOccupancy(r io.Reader) (*Occupancy, error) {
+	br := bufio.NewReader(r)
+	var magic [8]byte
+	if _, err := io.ReadFull(br, magic[:]); err != nil {
+		return nil, err
+	}
+	if string(magic[:]) != occupancyMagic {
+		return nil, sdf.ErrMsg("not an occupancy grid")
+	}
+	var size [3]uint32
+	var f [6]float64
+	if err := binary.Read(br, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(br, binary.LittleEndian, &f); err != nil {
+		return nil, err
+	}
+	// the header isn't trusted: bound the bitmap before allocating it
+	voxels := uint64(1)
+	for _, x := range size {
+		if x == 0 {
+			return nil, sdf.ErrMsg("bad grid size")
+		}
+		voxels *= uint64(x)
+		if voxels > maxOccupancyVoxels {
+			return nil, sdf.ErrMsg("grid too large")
+		}
+	}
+	o := &Occupancy{
+		Size:   sdf.V3i{int(size[0]), int(size[1]), int(size[2])},
+		Origin: sdf.V3{f[0], f[1], f[2]},
+		Voxel:  sdf.V3{f[3], f[4], f[5]},
+	}
+	nx := o.Size[0]
+	o.bits = make([]uint64, (voxels+63)/64)
+	i := 0
+	for line := 0; line < o.Size[1]*o.Size[2]; line++ {
+		runs, err := binary.ReadUvarint(br)
+		if err != nil {
+			return nil, err
+		}
+		x := 0
+		for k := uint64(0); k < runs; k++ {
+			run, err := binary.ReadUvarint(br)
+			if err != nil {
+				return nil, err
+			}
+			if run > uint64(nx-x) {
+				return nil, sdf.ErrMsg("bad scanline")
+			}
+			if k&1 != 0 {
+				for j := i + x; j < i+x+int(run); j++ {
+					o.bits[j>>6] |= 1 << uint(j&63)
+				}
+			}
+			x += int(run)
+		}
+		if x != nx {
+			return nil, sdf.ErrMsg("bad scanline")
+		}
+		i += nx
+	}
+	return o, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,169 @@
+//-----------------------------------------------------------------------------
+/*
+
+Ordered Writer
+
+Parallel renderers emit triangles in whatever order the workers finish,
+so the output files differ from run to run. The ordered writer takes
+numbered blocks of triangles (e.g. tiles) from the workers and passes them
+to an output channel (see WriteSTL, WritePLY) in block order.
+
+Memory is bounded by a window: a worker can't start a block until it is
+within the window of the next block to be written, so at most window
+blocks are buffered.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// OrderedWriter writes numbered blocks of triangles to an output channel in block order.
+type OrderedWriter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	output   chan<- *Triangle3
+	window   int
+	next     int                  // next block to write
+	pending  map[int][]*Triangle3 // finished blocks waiting for their turn
+	writing  bool                 // a goroutine is writing blocks
+	aborted  bool
+	maxBlock int // highest block number seen
+}
+
+// NewOrderedWriter returns an ordered writer for an output channel,
+// buffering at most window blocks (window <= 0: 2*MaxParallelism()).
+func NewOrderedWriter(output chan<- *Triangle3, window int) *OrderedWriter {
+	if window <= 0 {
+		window = 2 * MaxParallelism()
+	}
+	w := &OrderedWriter{output: output, window: window, pending: make(map[int][]*Triangle3), maxBlock: -1}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// Acquire waits until block i is within the window. Call it before producing the block.
+// Workers must acquire blocks in increasing order (e.g. from a shared counter),
+// otherwise the block being waited on may never be produced.
+func (w *OrderedWriter) Acquire(i int) {
+	w.mu.Lock()
+	for i >= w.next+w.window && !w.aborted {
+		w.cond.Wait()
+	}
+	w.mu.Unlock()
+}
+
+// Write hands over the triangles of block i. The blocks that are ready are written
+// to the output by the calling goroutine.
+func (w *OrderedWriter) Write(i int, t []*Triangle3) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if i < w.next || w.pending[i] != nil {
+		panic(fmt.Sprintf("block %d written twice", i))
+	}
+	if t == nil {
+		t = []*Triangle3{}
+	}
+	w.pending[i] = t
+	if i > w.maxBlock {
+		w.maxBlock = i
+	}
+	if w.writing {
+		return
+	}
+	w.writing = true
+	for !w.aborted {
+		t, ok := w.pending[w.next]
+		if !ok {
+			break
+		}
+		delete(w.pending, w.next)
+		w.mu.Unlock()
+		for _, x := range t {
+			w.output <- x
+		}
+		w.mu.Lock()
+		w.next++
+		w.cond.Broadcast()
+	}
+	w.writing = false
+}
+
+// abort releases the workers waiting in Acquire.
+func (w *OrderedWriter) abort() {
+	w.mu.Lock()
+	w.aborted = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// Close checks that all blocks up to the highest block number have been written.
+// It doesn't close the output channel.
+func (w *OrderedWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.next <= w.maxBlock {
+		return sdf.ErrMsg(fmt.Sprintf("block %d is missing", w.next))
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// WriteOrdered runs fn for the blocks 0 to n-1 on a number of worker goroutines
+// (workers <= 0: MaxParallelism()) and writes the triangles to the output in block order.
+// It returns an error if fn panics.
+func WriteOrdered(output chan<- *Triangle3, n, workers int, fn func(i int) []*Triangle3) error {
+	if workers <= 0 || workers > MaxParallelism() {
+		workers = MaxParallelism()
+	}
+	w := NewOrderedWriter(output, 2*workers)
+	var mu sync.Mutex
+	var err error
+	next := 0
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for k := 0; k < workers; k++ {
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					mu.Lock()
+					if err == nil {
+						err = fmt.Errorf("block panic: %v", r)
+					}
+					mu.Unlock()
+					w.abort()
+				}
+			}()
+			for {
+				// claim the blocks in increasing order
+				mu.Lock()
+				i := next
+				next++
+				failed := err != nil
+				mu.Unlock()
+				if i >= n || failed {
+					return
+				}
+				w.Acquire(i)
+				w.Write(i, fn(i))
+			}
+		}()
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,225 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triangle Pipelines
+
+Renderers write triangles to a channel and exporters read them from a
+channel. A pipeline connects the two through a sequence of filters
+(dedup, decimate, validate, transform, split-by-region, ...), each
+running in its own goroutine, so post-processing doesn't need the whole
+mesh in memory (dedup is the exception).
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// TriangleFilter is a pipeline stage. It reads triangles from the input until
+// it is closed and writes triangles to the output. It must not close the output.
+type TriangleFilter func(input <-chan *Triangle3, output chan<- *Triangle3)
+
+// runFilters runs the filters between input and output.
+func runFilters(input <-chan *Triangle3, output chan<- *Triangle3, filters []TriangleFilter) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	in := input
+	for i, f := range filters {
+		var out chan *Triangle3
+		if i < len(filters)-1 {
+			out = make(chan *Triangle3, 64)
+		}
+		wg.Add(1)
+		go func(f TriangleFilter, in <-chan *Triangle3, out chan *Triangle3) {
+			defer wg.Done()
+			if out == nil {
+				f(in, output)
+				return
+			}
+			f(in, out)
+			close(out)
+		}(f, in, out)
+		in = out
+	}
+	if len(filters) == 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range input {
+				output <- t
+			}
+		}()
+	}
+	return &wg
+}
+
+// Pipeline returns a channel for triangles that are passed through the filters and written to output.
+// Output is closed when the returned channel has been closed and the filters are done.
+// As with WriteSTL the wait group is used to wait for completion.
+func Pipeline(wg *sync.WaitGroup, output chan<- *Triangle3, filters ...TriangleFilter) chan<- *Triangle3 {
+	input := make(chan *Triangle3, 64)
+	fwg := runFilters(input, output, filters)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		fwg.Wait()
+		close(output)
+	}()
+	return input
+}
+
+//-----------------------------------------------------------------------------
+
+// FilteredRender is a renderer with its output passed through a sequence of filters.
+type FilteredRender struct {
+	r       Render3
+	filters []TriangleFilter
+}
+
+// Filtered returns a renderer with its output passed through a sequence of filters.
+func Filtered(r Render3, filters ...TriangleFilter) *FilteredRender {
+	return &FilteredRender{r, filters}
+}
+
+// Info returns a string describing the rendered volume.
+func (f *FilteredRender) Info(s sdf.SDF3, meshCells int) string {
+	return f.r.Info(s, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+func (f *FilteredRender) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	f.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (f *FilteredRender) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	input := make(chan *Triangle3, 64)
+	wg := runFilters(input, output, f.filters)
+	err := renderContext(ctx, f.r, s, meshCells, input)
+	close(input)
+	wg.Wait()
+	return err
+}
+
+//-----------------------------------------------------------------------------
+// Filters
+
+// FilterMap returns a filter that replaces each triangle with fn(t). Triangles are dropped if fn returns nil.
+// fn may modify and return t.
+func FilterMap(fn func(t *Triangle3) *Triangle3) TriangleFilter {
+	return func(input <-chan *Triangle3, output chan<- *Triangle3) {
+		for t := range input {
+			if t = fn(t); t != nil {
+				output <- t
+			}
+		}
+	}
+}
+
+// FilterTransform returns a filter that transforms the triangles.
+// The winding is reversed for mirroring transforms, so normals still point outwards.
+func FilterTransform(m sdf.M44) TriangleFilter {
+	flip := m.Determinant() < 0
+	return FilterMap(func(t *Triangle3) *Triangle3 {
+		for i := range t.V {
+			t.V[i] = m.MulPosition(t.V[i])
+		}
+		if flip {
+			t.V[1], t.V[2] = t.V[2], t.V[1]
+		}
+		return t
+	})
+}
+
+// ValidateStats counts the triangles dropped by a validation filter.
+type ValidateStats struct {
+	NonFinite  int // triangles with NaN or infinite vertices
+	Degenerate int // triangles with coincident vertices
+}
+
+// FilterValidate returns a filter that drops triangles with non-finite or coincident (within tolerance) vertices.
+// The dropped triangles are counted in stats (if not nil), which is complete when the filter is done.
+func FilterValidate(tolerance float64, stats *ValidateStats) TriangleFilter {
+	if stats == nil {
+		stats = &ValidateStats{}
+	}
+	finite := func(x float64) bool { return !math.IsNaN(x) && !math.IsInf(x, 0) }
+	return FilterMap(func(t *Triangle3) *Triangle3 {
+		for _, v := range t.V {
+			if !finite(v.X) || !finite(v.Y) || !finite(v.Z) {
+				stats.NonFinite++
+				return nil
+			}
+		}
+		if t.Degenerate(tolerance) {
+			stats.Degenerate++
+			return nil
+		}
+		return t
+	})
+}
+
+// FilterDedup returns a filter that drops repeated triangles (the same vertices in the same winding order).
+// It keeps a set of all the triangles seen.
+func FilterDedup() TriangleFilter {
+	return func(input <-chan *Triangle3, output chan<- *Triangle3) {
+		seen := make(map[[3]sdf.V3]struct{})
+		for t := range input {
+			// rotate the smallest vertex first
+			k := t.V
+			for i := 1; i < 3; i++ {
+				if v3Less(t.V[i], k[0]) {
+					k = [3]sdf.V3{t.V[i], t.V[(i+1)%3], t.V[(i+2)%3]}
+				}
+			}
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			output <- t
+		}
+	}
+}
+
+// FilterDecimate returns a filter that simplifies a mesh by vertex clustering:
+// vertices are snapped to a grid with the given cell size and collapsed triangles are dropped.
+// No cracks are introduced, but features smaller than the cell size are lost.
+func FilterDecimate(cellSize float64) TriangleFilter {
+	snap := func(x float64) float64 { return math.Round(x/cellSize) * cellSize }
+	return FilterMap(func(t *Triangle3) *Triangle3 {
+		for i, v := range t.V {
+			t.V[i] = sdf.V3{snap(v.X), snap(v.Y), snap(v.Z)}
+		}
+		if t.Degenerate(0) {
+			return nil
+		}
+		return t
+	})
+}
+
+// FilterSplit returns a filter that sends triangles with their centroid inside a region to the inside channel,
+// and passes the others through. The inside channel is closed when the filter is done.
+func FilterSplit(region sdf.SDF3, inside chan<- *Triangle3) TriangleFilter {
+	return func(input <-chan *Triangle3, output chan<- *Triangle3) {
+		defer close(inside)
+		for t := range input {
+			c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+			if region.Evaluate(c) <= 0 {
+				inside <- t
+			} else {
+				output <- t
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,246 @@
+//-----------------------------------------------------------------------------
+/*
+
+Worker Pools
+
+A pool runs tasks on a bounded number of goroutines. Each worker has its
+own task queue, and takes work from the other queues when it runs dry.
+Tasks are submitted in groups; waiting on a group runs queued tasks in the
+waiting goroutine, so tasks may submit and wait on groups of their own
+without deadlocking the pool. A panic in a task is recovered and returned
+as an error (with the stack of the task) when the group is waited on.
+
+The library-wide maximum parallelism (SetMaxParallelism) caps the size of
+every pool, so embedding applications can limit CPU usage.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+//-----------------------------------------------------------------------------
+
+var maxParallelism int32
+
+// SetMaxParallelism sets the maximum number of workers in a pool (n <= 0: the number of CPUs).
+// The default pool is resized on its next use, existing pools keep their size.
+func SetMaxParallelism(n int) {
+	if n < 0 {
+		n = 0
+	}
+	atomic.StoreInt32(&maxParallelism, int32(n))
+}
+
+// MaxParallelism returns the maximum number of workers in a pool.
+func MaxParallelism() int {
+	if n := int(atomic.LoadInt32(&maxParallelism)); n > 0 {
+		return n
+	}
+	return runtime.NumCPU()
+}
+
+//-----------------------------------------------------------------------------
+
+type poolTask struct {
+	g  *Group
+	fn func()
+}
+
+// Pool is a bounded set of worker goroutines.
+type Pool struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  [][]*poolTask // per worker task queues
+	next    int           // queue for the next task
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// NewPool returns a pool with n workers (n <= 0: MaxParallelism()).
+// The number of workers is capped at MaxParallelism().
+func NewPool(n int) *Pool {
+	max := MaxParallelism()
+	if n <= 0 || n > max {
+		n = max
+	}
+	p := &Pool{queues: make([][]*poolTask, n)}
+	p.cond = sync.NewCond(&p.mu)
+	p.workers.Add(n)
+	for i := 0; i < n; i++ {
+		go p.worker(i)
+	}
+	return p
+}
+
+// Workers returns the number of workers in the pool.
+func (p *Pool) Workers() int {
+	return len(p.queues)
+}
+
+// Close stops the pool workers once the queued tasks have been run.
+// Tasks submitted after Close are run by the submitting goroutine.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.workers.Wait()
+}
+
+// take returns a task from the queue of worker i, or one stolen from another queue (nil: none).
+// Call with the lock held. Helpers (i < 0) only steal.
+func (p *Pool) take(i int) *poolTask {
+	if i >= 0 {
+		if q := p.queues[i]; len(q) != 0 {
+			t := q[len(q)-1]
+			q[len(q)-1] = nil
+			p.queues[i] = q[:len(q)-1]
+			return t
+		}
+	}
+	n := len(p.queues)
+	for j := 1; j <= n; j++ {
+		k := (i + j + n) % n
+		if q := p.queues[k]; len(q) != 0 {
+			t := q[0]
+			q[0] = nil
+			p.queues[k] = q[1:]
+			return t
+		}
+	}
+	return nil
+}
+
+// run runs a task, recording any panic in the task group.
+func (p *Pool) run(t *poolTask) {
+	defer func() {
+		r := recover()
+		p.mu.Lock()
+		if r != nil && t.g.err == nil {
+			t.g.err = &TaskPanic{r, debug.Stack()}
+		}
+		t.g.pending--
+		if t.g.pending == 0 {
+			p.cond.Broadcast()
+		}
+		p.mu.Unlock()
+	}()
+	t.fn()
+}
+
+func (p *Pool) worker(i int) {
+	defer p.workers.Done()
+	p.mu.Lock()
+	for {
+		t := p.take(i)
+		if t == nil {
+			if p.closed {
+				p.mu.Unlock()
+				return
+			}
+			p.cond.Wait()
+			continue
+		}
+		p.mu.Unlock()
+		p.run(t)
+		p.mu.Lock()
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// TaskPanic is the error of a task that panicked.
+type TaskPanic struct {
+	Value interface{} // the panic value
+	Stack []byte      // the stack of the task when it panicked
+}
+
+func (e *TaskPanic) Error() string {
+	return fmt.Sprintf("task panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e *TaskPanic) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// Group is a set of tasks run on a pool.
+type Group struct {
+	pool    *Pool
+	pending int   // tasks not yet completed
+	err     error // first task panic
+}
+
+// Group returns a new task group for the pool.
+func (p *Pool) Group() *Group {
+	return &Group{pool: p}
+}
+
+// Go submits a task to the pool.
+func (g *Group) Go(fn func()) {
+	p := g.pool
+	t := &poolTask{g, fn}
+	p.mu.Lock()
+	g.pending++
+	if p.closed {
+		p.mu.Unlock()
+		p.run(t)
+		return
+	}
+	p.queues[p.next] = append(p.queues[p.next], t)
+	p.next = (p.next + 1) % len(p.queues)
+	p.cond.Signal()
+	p.mu.Unlock()
+}
+
+// Wait waits for the tasks of the group to complete, running queued tasks meanwhile.
+// It returns an error if a task panicked.
+func (g *Group) Wait() error {
+	p := g.pool
+	p.mu.Lock()
+	for g.pending > 0 {
+		if t := p.take(-1); t != nil {
+			p.mu.Unlock()
+			p.run(t)
+			p.mu.Lock()
+			continue
+		}
+		p.cond.Wait()
+	}
+	err := g.err
+	g.err = nil
+	p.mu.Unlock()
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+var defaultPool struct {
+	sync.Mutex
+	p *Pool
+}
+
+// DefaultPool returns the pool shared by the parallel stages of the library.
+// It has MaxParallelism() workers.
+func DefaultPool() *Pool {
+	defaultPool.Lock()
+	defer defaultPool.Unlock()
+	if p := defaultPool.p; p == nil || p.Workers() != MaxParallelism() {
+		if p != nil {
+			go p.Close()
+		}
+		defaultPool.p = NewPool(0)
+	}
+	return defaultPool.p
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,116 @@
+//-----------------------------------------------------------------------------
+/*
+
+Render Progress
+
+A progress callback is attached to the context of a render. The renderers
+report the number of cells processed (out of the total) and the number of
+triangles emitted, so long renders can show a progress bar. Renderers with
+several passes over the cells (e.g. dual contouring) count each cell once
+per pass.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+//-----------------------------------------------------------------------------
+
+// Progress is the state of a render.
+type Progress struct {
+	Cells      int64 // cells processed
+	TotalCells int64 // cells to process
+	Triangles  int64 // triangles emitted
+}
+
+// Fraction returns the fraction (0..1) of the render that is complete.
+func (p Progress) Fraction() float64 {
+	if p.TotalCells <= 0 {
+		return 0
+	}
+	return float64(p.Cells) / float64(p.TotalCells)
+}
+
+// ProgressFunc is called with the progress of a render.
+// Calls are serialized, so the function needs no locking.
+type ProgressFunc func(p Progress)
+
+// progressSteps is the number of progress reports per render (plus the final report).
+const progressSteps = 1000
+
+// ProgressTracker tracks the progress of a render for a Render3 implementation.
+// The methods of a nil tracker do nothing.
+type ProgressTracker struct {
+	cells, total, triangles int64 // atomic (first for 64-bit alignment)
+	next                    int64 // cell count for the next report (atomic)
+	mu                      sync.Mutex
+	fn                      ProgressFunc
+}
+
+type progressKey struct{}
+
+// WithProgress returns a context that reports the progress of renders to a function.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, &ProgressTracker{fn: fn})
+}
+
+// StartProgress returns the progress tracker of a context (nil: none), reset for a render of total cells.
+func StartProgress(ctx context.Context, total int64) *ProgressTracker {
+	p := progressOf(ctx)
+	if p != nil {
+		p.mu.Lock()
+		atomic.StoreInt64(&p.cells, 0)
+		atomic.StoreInt64(&p.triangles, 0)
+		atomic.StoreInt64(&p.total, total)
+		atomic.StoreInt64(&p.next, 0)
+		p.mu.Unlock()
+	}
+	return p
+}
+
+// progressOf returns the progress tracker of a context (nil: none).
+func progressOf(ctx context.Context) *ProgressTracker {
+	p, _ := ctx.Value(progressKey{}).(*ProgressTracker)
+	return p
+}
+
+// Add counts processed cells and emitted triangles.
+func (p *ProgressTracker) Add(cells, triangles int64) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.triangles, triangles)
+	if atomic.AddInt64(&p.cells, cells) >= atomic.LoadInt64(&p.next) {
+		p.report(false)
+	}
+}
+
+// report calls the progress function, if the next report is due (or final).
+func (p *ProgressTracker) report(final bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cells := atomic.LoadInt64(&p.cells)
+	total := atomic.LoadInt64(&p.total)
+	if !final && cells < atomic.LoadInt64(&p.next) {
+		return
+	}
+	atomic.StoreInt64(&p.next, cells+total/progressSteps+1)
+	p.fn(Progress{cells, total, atomic.LoadInt64(&p.triangles)})
+}
+
+// Done makes the final report of a complete render.
+func (p *ProgressTracker) Done() {
+	if p == nil {
+		return
+	}
+	atomic.StoreInt64(&p.cells, atomic.LoadInt64(&p.total))
+	p.report(true)
+}
+
+//-----------------------------------------------------------------------------
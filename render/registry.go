@@ -0,0 +1,155 @@
+//-----------------------------------------------------------------------------
+/*
+
+Renderer and Exporter Registry
+
+Renderers are registered by name and exporters by file extension, so
+other packages (third-party polygonizers and file formats) can plug into
+name/extension driven front ends (see RenderFile) without changes to this
+package. The renderers registered as Auto candidates are registered by
+name as well.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// RendererFactory returns a renderer for a model.
+type RendererFactory func(s sdf.SDF3, meshCells int) Render3
+
+// Exporter writes an indexed mesh to a file.
+type Exporter func(path string, m *Mesh) error
+
+var registry = struct {
+	sync.Mutex
+	renderers map[string]RendererFactory
+	exporters map[string]Exporter
+}{
+	renderers: map[string]RendererFactory{
+		"MarchingCubesUniform":  func(s sdf.SDF3, meshCells int) Render3 { return &MarchingCubesUniform{} },
+		"MarchingCubesOctree":   func(s sdf.SDF3, meshCells int) Render3 { return &MarchingCubesOctree{} },
+		"MarchingCubesTiled":    func(s sdf.SDF3, meshCells int) Render3 { return &MarchingCubesTiled{Workers: MaxParallelism()} },
+		"MarchingCubes33":       func(s sdf.SDF3, meshCells int) Render3 { return &MarchingCubes33{} },
+		"MarchingCubesExtended": func(s sdf.SDF3, meshCells int) Render3 { return &MarchingCubesExtended{} },
+		"SurfaceNets":           func(s sdf.SDF3, meshCells int) Render3 { return &SurfaceNets{} },
+		"SurfaceNetsSmooth":     func(s sdf.SDF3, meshCells int) Render3 { return &SurfaceNets{Smoothing: 4, Project: true} },
+	},
+	exporters: map[string]Exporter{
+		".stl": func(path string, m *Mesh) error { return SaveSTL(path, m.Triangles()) },
+		".ply": SavePLY,
+		".3mf": Save3MF,
+		".obj": SaveOBJ,
+		".amf": SaveAMF,
+	},
+}
+
+// RegisterRenderer registers a renderer by name, replacing any renderer with the same name.
+func RegisterRenderer(name string, factory RendererFactory) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.renderers[name] = factory
+}
+
+// RegisterExporter registers an exporter for a file extension (e.g. ".obj"),
+// replacing any exporter for the extension. Extensions are case insensitive.
+func RegisterExporter(ext string, fn Exporter) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.exporters[normalizeExt(ext)] = fn
+}
+
+// normalizeExt returns a lower case extension with a leading dot.
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(ext)
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// Renderers returns the names of the registered renderers (sorted).
+func Renderers() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	names := make([]string, 0, len(registry.renderers))
+	for name := range registry.renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Exporters returns the registered file extensions (sorted).
+func Exporters() []string {
+	registry.Lock()
+	defer registry.Unlock()
+	exts := make([]string, 0, len(registry.exporters))
+	for ext := range registry.exporters {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// NewRenderer returns a registered renderer for a model.
+func NewRenderer(name string, s sdf.SDF3, meshCells int) (Render3, error) {
+	registry.Lock()
+	factory, ok := registry.renderers[name]
+	registry.Unlock()
+	if !ok {
+		return nil, sdf.ErrMsg(fmt.Sprintf("unknown renderer \"%s\"", name))
+	}
+	return factory(s, meshCells), nil
+}
+
+// Export writes an indexed mesh to a file with the exporter for its extension.
+func Export(path string, m *Mesh) error {
+	ext := normalizeExt(filepath.Ext(path))
+	registry.Lock()
+	fn, ok := registry.exporters[ext]
+	registry.Unlock()
+	if !ok {
+		return sdf.ErrMsg(fmt.Sprintf("no exporter for \"%s\"", ext))
+	}
+	return fn(path, m)
+}
+
+// RenderFile renders an SDF3 with a registered renderer ("": selected by Auto at medium quality,
+// meshCells <= 0: the resolution selected by Auto) and writes it with the exporter for the file extension.
+func RenderFile(s sdf.SDF3, meshCells int, path, renderer string) error {
+	if renderer == "" || meshCells <= 0 {
+		choice, err := Auto(s, 0.5)
+		if err != nil {
+			return err
+		}
+		if renderer == "" {
+			renderer = choice.Name
+		}
+		if meshCells <= 0 {
+			meshCells = choice.MeshCells
+		}
+	}
+	r, err := NewRenderer(renderer, s, meshCells)
+	if err != nil {
+		return err
+	}
+	m, err := RenderMesh(s, meshCells, r)
+	if err != nil {
+		return err
+	}
+	return Export(path, m)
+}
+
+//-----------------------------------------------------------------------------
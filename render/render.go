@@ -9,7 +9,9 @@ Top-Level Rendering Routines
 package render
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"sync"
 
 	"github.com/deadsy/sdfx/sdf"
@@ -23,6 +25,18 @@ type Render3 interface {
 	Info(sdf3 sdf.SDF3, meshCells int) string
 }
 
+// ContextRender3 is implemented by renderers that can be aborted.
+type ContextRender3 interface {
+	// RenderContext is Render, aborted with ctx.Err() when the context is done.
+	RenderContext(ctx context.Context, sdf3 sdf.SDF3, meshCells int, output chan<- *Triangle3) error
+}
+
+// IndexedRender3 is implemented by renderers that produce an indexed mesh directly,
+// with the shared vertices they have internally.
+type IndexedRender3 interface {
+	RenderIndexed(ctx context.Context, sdf3 sdf.SDF3, meshCells int) (*Mesh, error)
+}
+
 // ToSTL renders an SDF3 to an STL file.
 func ToSTL(
 	s sdf.SDF3, // sdf3 to render
@@ -46,6 +60,94 @@ func ToSTL(
 	wg.Wait()
 }
 
+// ToTriangles renders an SDF3 to a slice of triangles.
+func ToTriangles(
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+) []*Triangle3 {
+	mesh, _ := ToTrianglesContext(context.Background(), s, meshCells, r)
+	return mesh
+}
+
+// ToTrianglesContext renders an SDF3 to a slice of triangles.
+// It returns ctx.Err() if the context is done before the render is complete.
+func ToTrianglesContext(
+	ctx context.Context, // context to abort the render
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+) ([]*Triangle3, error) {
+	ctx, span := startRenderSpan(ctx, meshCells, r)
+	s, evaluations := traceModel(span, s)
+	mesh, err := renderTriangles(ctx, s, meshCells, r)
+	span.endRender(len(mesh), evaluations, err)
+	return mesh, err
+}
+
+// renderContext renders an SDF3 with a renderer, aborted with ctx.Err() when the context is done.
+// A renderer without RenderContext (see ContextRender3) runs to completion, and its triangles
+// are dropped once the context is done.
+func renderContext(ctx context.Context, r Render3, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	if c, ok := r.(ContextRender3); ok {
+		return c.RenderContext(ctx, s, meshCells, output)
+	}
+	input := make(chan *Triangle3)
+	go func() {
+		r.Render(s, meshCells, input)
+		close(input)
+	}()
+	for t := range input {
+		select {
+		case output <- t:
+		case <-ctx.Done():
+			// drain the renderer
+			go func() {
+				for range input {
+				}
+			}()
+			return ctx.Err()
+		}
+	}
+	return ctx.Err()
+}
+
+// renderTriangles renders an SDF3 to a slice of triangles.
+func renderTriangles(ctx context.Context, s sdf.SDF3, meshCells int, r Render3) ([]*Triangle3, error) {
+	output := make(chan *Triangle3)
+	var mesh []*Triangle3
+	done := make(chan struct{})
+	go func() {
+		for t := range output {
+			mesh = append(mesh, t)
+		}
+		close(done)
+	}()
+	err := renderContext(ctx, r, s, meshCells, output)
+	close(output)
+	<-done
+	if err != nil {
+		return nil, err
+	}
+	return mesh, nil
+}
+
+// FeatureMeshCells returns the meshCells value needed to have at least cellsPerFeature
+// cells across the thinnest feature of an SDF3. The result is limited to maxCells,
+// with a warning if thin features will be lost at that resolution.
+func FeatureMeshCells(s sdf.SDF3, cellsPerFeature float64, maxCells int) (int, error) {
+	size, err := sdf.MinFeatureSize3(s, 2000)
+	if err != nil {
+		return 0, err
+	}
+	n := int(math.Ceil(cellsPerFeature * s.BoundingBox().Size().MaxComponent() / size))
+	if n > maxCells {
+		sdf.Warn(&sdf.Warning{Kind: sdf.WarnResolution, Msg: fmt.Sprintf("features of size %g need %d mesh cells (limited to %d)", size, n, maxCells)})
+		n = maxCells
+	}
+	return n, nil
+}
+
 //-----------------------------------------------------------------------------
 // Legacy API (Use ToSTL for new designs) ...
 
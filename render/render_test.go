@@ -0,0 +1,363 @@
+//-----------------------------------------------------------------------------
+/*
+
+Rendering Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package render_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/render/dc"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// plainRender is a renderer without RenderContext.
+type plainRender struct {
+	r render.MarchingCubesUniform
+}
+
+func (p *plainRender) Render(s sdf.SDF3, meshCells int, output chan<- *render.Triangle3) {
+	p.r.Render(s, meshCells, output)
+}
+
+func (p *plainRender) Info(s sdf.SDF3, meshCells int) string {
+	return p.r.Info(s, meshCells)
+}
+
+func Test_ToTrianglesContext(t *testing.T) {
+	s, _ := sdf.Sphere3D(1)
+	expected := render.ToTriangles(s, 20, &render.MarchingCubesUniform{})
+	tris, err := render.ToTrianglesContext(context.Background(), s, 20, &plainRender{})
+	if err != nil || len(tris) != len(expected) {
+		t.Errorf("expected %d triangles, actual %d %v", len(expected), len(tris), err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := render.ToTrianglesContext(ctx, s, 20, &plainRender{}); err != context.Canceled {
+		t.Errorf("expected %v, actual %v", context.Canceled, err)
+	}
+}
+
+// cancelSDF3 counts its evaluations, and cancels a render after a number of them.
+type cancelSDF3 struct {
+	sdf.SDF3
+	n      *int64
+	after  int64
+	cancel context.CancelFunc
+}
+
+func (s cancelSDF3) Evaluate(p sdf.V3) float64 {
+	if atomic.AddInt64(s.n, 1) == s.after && s.cancel != nil {
+		s.cancel()
+	}
+	return s.SDF3.Evaluate(p)
+}
+
+func Test_RenderCancel(t *testing.T) {
+	sphere, _ := sdf.Sphere3D(1)
+	renderers := []struct {
+		name string
+		r    render.Render3
+	}{
+		{"uniform", &render.MarchingCubesUniform{}},
+		{"dc", dc.NewDualContouringDefault()},
+	}
+	for _, v := range renderers {
+		if _, ok := v.r.(render.ContextRender3); !ok {
+			t.Fatalf("%s: no RenderContext", v.name)
+		}
+		// the evaluations of a full render
+		var full int64
+		if _, err := render.ToTrianglesContext(context.Background(), cancelSDF3{sphere, &full, 0, nil}, 50, v.r); err != nil {
+			t.Fatal(err)
+		}
+		// cancel partway through
+		ctx, cancel := context.WithCancel(context.Background())
+		var n int64
+		_, err := render.ToTrianglesContext(ctx, cancelSDF3{sphere, &n, full / 10, cancel}, 50, v.r)
+		cancel()
+		if err != context.Canceled {
+			t.Errorf("%s: expected %v, actual %v", v.name, context.Canceled, err)
+		}
+		// the render stops soon after the cancel
+		if n >= full/2 {
+			t.Errorf("%s: %d of %d evaluations after a cancel at %d", v.name, n, full, full/10)
+		}
+	}
+}
+
+// failSDF3 panics when evaluated near the origin.
+type failSDF3 struct {
+	sdf.SDF3
+}
+
+var errFail = errors.New("bad evaluation")
+
+func (s failSDF3) Evaluate(p sdf.V3) float64 {
+	if p.Length() < 0.2 {
+		panic(errFail)
+	}
+	return s.SDF3.Evaluate(p)
+}
+
+func Test_RenderPanic(t *testing.T) {
+	s, _ := sdf.Sphere3D(1)
+	_, err := render.RenderIndexed(context.Background(), failSDF3{s}, 20, &render.MarchingCubesUniform{})
+	if !errors.Is(err, errFail) {
+		t.Fatalf("expected %v, actual %v", errFail, err)
+	}
+	// the error has the stack of the panic
+	if !strings.Contains(err.Error(), "Evaluate") {
+		t.Errorf("no stack in %v", err)
+	}
+}
+
+func Test_FeatureMeshCells(t *testing.T) {
+	var warnings []*sdf.Warning
+	sdf.SetWarningHandler(func(w *sdf.Warning) { warnings = append(warnings, w) })
+	defer sdf.SetWarningHandler(nil)
+	s, _ := sdf.Box3D(sdf.V3{10, 10, 0.1}, 0)
+	n, err := render.FeatureMeshCells(s, 2, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 50 || len(warnings) != 1 || warnings[0].Kind != sdf.WarnResolution {
+		t.Errorf("expected 50 cells and a warning, actual %d %v", n, warnings)
+	}
+}
+
+func Test_Diff(t *testing.T) {
+	a, _ := sdf.Sphere3D(1)
+	b, _ := sdf.Sphere3D(1.1)
+	r, err := render.Diff(context.Background(), a, b, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := 4.0 / 3.0 * math.Pi * (1.1*1.1*1.1 - 1)
+	if math.Abs(r.Added-added) > 0.02*added {
+		t.Errorf("expected %g added, actual %g", added, r.Added)
+	}
+	if r.Removed > 1e-3 {
+		t.Errorf("expected nothing removed, actual %g", r.Removed)
+	}
+	if math.Abs(r.MaxDeviation-0.1) > 0.01 {
+		t.Errorf("expected a deviation of 0.1, actual %g", r.MaxDeviation)
+	}
+	if !r.Changed || len(r.Mesh.Colors) != len(r.Mesh.Vertices) {
+		t.Errorf("expected a changed, colored mesh")
+	}
+	// a model is the same as itself
+	r, err = render.Diff(context.Background(), a, a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Changed || r.Added != 0 || r.Removed != 0 || r.MaxDeviation > 0.1*2.0/100 {
+		t.Errorf("expected no changes, actual %v %g %g %g", r.Changed, r.Added, r.Removed, r.MaxDeviation)
+	}
+}
+
+// runPipeline passes triangles through a pipeline and returns its output.
+func runPipeline(tris []*render.Triangle3, filters ...render.TriangleFilter) []*render.Triangle3 {
+	var wg sync.WaitGroup
+	output := make(chan *render.Triangle3)
+	input := render.Pipeline(&wg, output, filters...)
+	go func() {
+		for _, t := range tris {
+			input <- t
+		}
+		close(input)
+	}()
+	// the output is closed when the filters are done
+	var out []*render.Triangle3
+	for t := range output {
+		out = append(out, t)
+	}
+	wg.Wait()
+	return out
+}
+
+func Test_Pipeline(t *testing.T) {
+	tri := func(v0, v1, v2 sdf.V3) *render.Triangle3 {
+		return &render.Triangle3{V: [3]sdf.V3{v0, v1, v2}}
+	}
+	a, b, c, d := sdf.V3{0, 0, 0}, sdf.V3{4, 0, 0}, sdf.V3{0, 4, 0}, sdf.V3{0, 0, 4}
+	nan := sdf.V3{math.NaN(), 0, 0}
+	far := sdf.V3{10, 10, 10}
+	bounds, _ := sdf.Sphere3D(5)
+	var stats render.ValidateStats
+	inside := make(chan *render.Triangle3, 16)
+	tests := []struct {
+		name     string
+		filters  []render.TriangleFilter
+		input    []*render.Triangle3
+		expected int
+	}{
+		{"none", nil, []*render.Triangle3{tri(a, b, c), tri(a, b, c)}, 2},
+		// rotations are duplicates, the reverse winding isn't
+		{"dedup", []render.TriangleFilter{render.FilterDedup()},
+			[]*render.Triangle3{tri(a, b, c), tri(b, c, a), tri(c, a, b), tri(a, c, b), tri(a, b, d)}, 3},
+		// the small triangle collapses
+		{"decimate", []render.TriangleFilter{render.FilterDecimate(1)},
+			[]*render.Triangle3{tri(a, b, c), tri(a, sdf.V3{0.2, 0, 0}, sdf.V3{0, 0.2, 0})}, 1},
+		{"validate", []render.TriangleFilter{render.FilterValidate(1e-9, &stats)},
+			[]*render.Triangle3{tri(a, b, c), tri(nan, b, c), tri(a, a, c), tri(a, b, d)}, 2},
+		// the triangles inside the region go to the inside channel
+		{"split", []render.TriangleFilter{render.FilterSplit(bounds, inside)},
+			[]*render.Triangle3{tri(a, b, c), tri(far, far.Add(a), far.Add(b)), tri(a, b, d)}, 1},
+		// filters run in order: dedup after decimate drops the snapped duplicate
+		{"chain", []render.TriangleFilter{render.FilterDecimate(1), render.FilterDedup()},
+			[]*render.Triangle3{tri(a, b, c), tri(a.Add(sdf.V3{0.1, 0, 0}), b, c)}, 1},
+	}
+	for _, v := range tests {
+		if out := runPipeline(v.input, v.filters...); len(out) != v.expected {
+			t.Errorf("%s: expected %d triangles, actual %d", v.name, v.expected, len(out))
+		}
+	}
+	if stats.NonFinite != 1 || stats.Degenerate != 1 {
+		t.Errorf("expected 1 non-finite and 1 degenerate triangle, actual %+v", stats)
+	}
+	n := 0
+	for range inside {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("expected 2 triangles inside, actual %d", n)
+	}
+}
+
+func Test_ToTrianglesLOD(t *testing.T) {
+	s, _ := sdf.Sphere3D(1)
+	meshes, err := render.ToTrianglesLOD(context.Background(), s, 64, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meshes) != 4 {
+		t.Fatalf("expected 4 levels, actual %d", len(meshes))
+	}
+	for i, tris := range meshes {
+		name := fmt.Sprintf("level %d", i)
+		checkWatertight(t, name, render.NewMesh(tris))
+		if i > 0 && len(tris) >= len(meshes[i-1]) {
+			t.Errorf("%s: expected fewer than %d triangles, actual %d", name, len(meshes[i-1]), len(tris))
+		}
+	}
+	if _, err := render.ToTrianglesLOD(context.Background(), s, 64, 5); err == nil {
+		t.Error("expected an error for 5 levels")
+	}
+}
+
+func Test_Sweep(t *testing.T) {
+	model := func(p map[string]float64) (sdf.SDF3, error) {
+		return sdf.Box3D(sdf.V3{p["w"], p["w"], p["h"]}, 0)
+	}
+	params := []render.SweepParam{render.SweepRange("w", 1, 2, 3), {"h", []float64{1, 2}}}
+	height := render.SweepMetric{"height", func(s sdf.SDF3, m *render.Mesh) (float64, error) {
+		return s.BoundingBox().Size().Z, nil
+	}}
+	cfg := &render.SweepConfig{MeshCells: 20, Metrics: []render.SweepMetric{height}}
+	results, err := render.Sweep(context.Background(), model, params, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3*2 {
+		t.Fatalf("expected %d results, actual %d", 3*2, len(results))
+	}
+	for _, r := range results {
+		w, h := r.Params["w"], r.Params["h"]
+		if r.Err != nil {
+			t.Fatalf("%g x %g: %v", w, h, r.Err)
+		}
+		if v := w * w * h; math.Abs(r.Volume-v) > 0.02*v {
+			t.Errorf("%g x %g: expected volume %g, actual %g", w, h, v, r.Volume)
+		}
+		if r.Metrics["height"] != h {
+			t.Errorf("%g x %g: expected height %g, actual %g", w, h, h, r.Metrics["height"])
+		}
+	}
+	// the last parameter varies fastest
+	if results[1].Params["w"] != 1 || results[1].Params["h"] != 2 || results[2].Params["w"] != 1.5 {
+		t.Errorf("unexpected parameter order %v %v", results[1].Params, results[2].Params)
+	}
+	var buf bytes.Buffer
+	if err := render.WriteSweepCSV(&buf, params, cfg, results); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	header := "w,h,model,volume,mass,min_x,min_y,min_z,max_x,max_y,max_z,height,error"
+	if len(lines) != 1+len(results) || lines[0] != header {
+		t.Errorf("expected the header %q and %d rows, actual %q and %d rows", header, len(results), lines[0], len(lines)-1)
+	}
+}
+
+func Test_Drawing(t *testing.T) {
+	box, _ := sdf.Box3D(sdf.V3{4, 2, 1}, 0)
+	m := meshOf(t, box, 40, &render.MarchingCubesUniform{})
+	d, err := render.NewDrawing(m, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the edge vertices include the box corners
+	for _, c := range box.BoundingBox().Vertices() {
+		if v := d.Vertex(c); v.Sub(c).Length() > 2*4.0/40 {
+			t.Errorf("expected a vertex near %v, actual %v", c, v)
+		}
+	}
+	p0, p1, p2 := sdf.V3{-2, -1, -0.5}, sdf.V3{2, -1, -0.5}, sdf.V3{2, 1, -0.5}
+	dims := []render.Dimension{
+		{Kind: render.DimHorizontal, View: render.ViewFront, P0: p0, P1: p1, Offset: -1},
+		{Kind: render.DimVertical, View: render.ViewTop, P0: p1, P1: p2, Offset: 1, Tolerance: "±0.05"},
+		{Kind: render.DimVertical, View: render.ViewRight, P0: p0, P1: sdf.V3{-2, -1, 0.5}, Offset: 1},
+	}
+	for _, dim := range dims {
+		if err := d.AddDimension(dim); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the points of a dimension are distinct in its view
+	if err := d.AddDimension(render.Dimension{Kind: render.DimVertical, View: render.ViewTop, P0: p0, P1: p0.Add(sdf.V3{0, 0, 1})}); err == nil {
+		t.Error("expected an error for equal points")
+	}
+	dir, err := ioutil.TempDir("", "drawing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.svg")
+	if err := d.SaveSVG(path, "fill:none;stroke:black;stroke-width:0.02"); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadFile(path)
+	for _, text := range []string{`id="visible"`, `id="hidden"`, ">4.00<", ">2.00±0.05<", ">1.00<"} {
+		if !strings.Contains(string(b), text) {
+			t.Errorf("%q is missing from the drawing", text)
+		}
+	}
+	// only the front view
+	d, err = render.NewDrawing(m, &render.DrawingConfig{Views: []render.DrawingView{render.ViewFront}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.AddDimension(dims[1]); err == nil {
+		t.Error("expected an error for a dimension of a missing view")
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,56 @@
+//-----------------------------------------------------------------------------
+/*
+
+Per-Axis Resolution
+
+By default a uniform render has cubic cells, meshCells of them on the
+longest axis of the bounding box. Thin flat parts then have few cells
+through their thickness, or a huge number of cells across their face.
+A resolution sets the cells of each axis independently, as a cell count
+or a cell size in model units.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import "github.com/deadsy/sdfx/sdf"
+
+//-----------------------------------------------------------------------------
+
+// Resolution sets the cells on each axis of a uniform render. Each axis uses its cell
+// count if set, else its cell size if set, else the cubic cell size (the longest axis
+// of the bounding box / meshCells).
+type Resolution struct {
+	Cells    sdf.V3i // cells on each axis (<= 0: not set)
+	CellSize sdf.V3  // cell size on each axis in model units (<= 0: not set)
+}
+
+// lattice returns the sampling lattice (base, increment, cubes) of a uniform render of a
+// bounding box. The lattice is padded by a cell (half a cell on each side).
+func (r *Resolution) lattice(bb0 sdf.Box3, meshCells int) (sdf.V3, sdf.V3, sdf.V3i) {
+	bb0Size := bb0.Size()
+	meshInc := bb0Size.MaxComponent() / float64(meshCells)
+	k := [3]float64{meshInc, meshInc, meshInc}
+	if r != nil {
+		size := [3]float64{bb0Size.X, bb0Size.Y, bb0Size.Z}
+		cellSize := [3]float64{r.CellSize.X, r.CellSize.Y, r.CellSize.Z}
+		for i := range k {
+			if r.Cells[i] > 0 && size[i] > 0 {
+				k[i] = size[i] / float64(r.Cells[i])
+			} else if cellSize[i] > 0 {
+				k[i] = cellSize[i]
+			}
+		}
+	}
+	inc := sdf.V3{k[0], k[1], k[2]}
+	bb1Size := bb0Size.Div(inc)
+	bb1Size = bb1Size.Ceil().AddScalar(1)
+	bb1Size = bb1Size.Mul(inc)
+	bb := sdf.NewBox3(bb0.Center(), bb1Size)
+	size := bb.Size()
+	steps := size.Div(inc).Ceil().ToV3i()
+	return bb.Min, size.Div(steps.ToV3()), steps
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,71 @@
+//-----------------------------------------------------------------------------
+/*
+
+Open Sheet Rendering
+
+Render an unsigned distance field (an open surface) as a thin two-sided mesh.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Sheet renders an open surface as a two-sided mesh offset from the surface.
+type Sheet struct {
+	Renderer Render3 // rendering method (nil: MarchingCubesOctree)
+	Offset   float64 // offset of each side from the surface (0: one mesh cell)
+}
+
+func (r *Sheet) renderer() Render3 {
+	if r.Renderer == nil {
+		return &MarchingCubesOctree{}
+	}
+	return r.Renderer
+}
+
+// sheet returns the thickened sheet for an open surface.
+func (r *Sheet) sheet(s sdf.SDF3, meshCells int) (sdf.SDF3, error) {
+	offset := r.Offset
+	if offset <= 0 {
+		// thinner sheets are lost between the sample points
+		offset = s.BoundingBox().Size().MaxComponent() / float64(meshCells)
+	}
+	return sdf.Sheet3D(s, 2*offset)
+}
+
+// Info returns a string describing the rendered volume.
+func (r *Sheet) Info(s sdf.SDF3, meshCells int) string {
+	sheet, err := r.sheet(s, meshCells)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("sheet, %s", r.renderer().Info(sheet, meshCells))
+}
+
+// Render produces a two-sided triangle mesh for an open surface.
+// Nothing is rendered if the sheet can't be made.
+func (r *Sheet) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	r.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a two-sided triangle mesh for an open surface.
+// It returns ctx.Err() if the context is done before the render is complete, or an error
+// if the sheet can't be made.
+func (r *Sheet) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	sheet, err := r.sheet(s, meshCells)
+	if err != nil {
+		return err
+	}
+	return renderContext(ctx, r.renderer(), sheet, meshCells, output)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,124 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sorted Rendering
+
+Parallel renderers emit triangles in whatever order the workers finish,
+so the output files of identical renders can differ. A sorted renderer
+tags each triangle with the index of the lattice cell holding its centroid
+(for the render resolution) and writes the triangles in cell order, with
+ties in vertex order, so identical inputs give byte-identical output.
+
+The whole mesh is held (and sorted) before it is written. For large tiled
+renders use the ordered mode of the renderer (see WriteOrdered) instead.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// SortedRender is a renderer with its triangles output in cell order.
+type SortedRender struct {
+	r Render3
+}
+
+// Sorted returns a renderer with its triangles output in cell order.
+func Sorted(r Render3) *SortedRender {
+	return &SortedRender{r}
+}
+
+// Info returns a string describing the rendered volume.
+func (r *SortedRender) Info(s sdf.SDF3, meshCells int) string {
+	return r.r.Info(s, meshCells)
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3, in cell order.
+func (r *SortedRender) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	r.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3, in cell order.
+// It returns ctx.Err() (with no triangles output) if the context is done before the render is complete.
+func (r *SortedRender) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	mesh, err := ToTrianglesContext(ctx, s, meshCells, r.r)
+	if err != nil {
+		return err
+	}
+	SortTriangles(mesh, s.BoundingBox(), meshCells)
+	for _, t := range mesh {
+		output <- t
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// sortedTriangle is a triangle tagged with its cell index.
+type sortedTriangle struct {
+	cell int64
+	t    *Triangle3
+}
+
+// SortTriangles sorts triangles by the index (x, y, z order) of the cell holding their
+// centroid, in the lattice of a render of a bounding box, and then by their vertices.
+func SortTriangles(mesh []*Triangle3, bb sdf.Box3, meshCells int) {
+	base, inc, steps := boxLattice(bb, meshCells)
+	cell := func(x, b, d float64, n int) int64 {
+		i := int64(math.Floor((x - b) / d))
+		if i < 0 || math.IsNaN(x) {
+			return 0
+		}
+		if i >= int64(n) {
+			return int64(n - 1)
+		}
+		return i
+	}
+	tags := make([]sortedTriangle, len(mesh))
+	for i, t := range mesh {
+		c := t.V[0].Add(t.V[1]).Add(t.V[2]).DivScalar(3)
+		x := cell(c.X, base.X, inc.X, steps[0])
+		y := cell(c.Y, base.Y, inc.Y, steps[1])
+		z := cell(c.Z, base.Z, inc.Z, steps[2])
+		tags[i] = sortedTriangle{(x*int64(steps[1])+y)*int64(steps[2]) + z, t}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		a, b := tags[i], tags[j]
+		if a.cell != b.cell {
+			return a.cell < b.cell
+		}
+		for k := 0; k < 3; k++ {
+			if c := compareV3(a.t.V[k], b.t.V[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	for i := range tags {
+		mesh[i] = tags[i].t
+	}
+}
+
+// compareV3 compares vectors in x, y, z order (-1, 0, 1).
+func compareV3(a, b sdf.V3) int {
+	for _, d := range [3]float64{a.X - b.X, a.Y - b.Y, a.Z - b.Z} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+//-----------------------------------------------------------------------------
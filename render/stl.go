@@ -10,10 +10,15 @@ package render
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+	"github.com/hschendel/stl"
 )
 
 //-----------------------------------------------------------------------------
@@ -142,3 +147,65 @@ func WriteSTL(wg *sync.WaitGroup, path string) (chan<- *Triangle3, error) {
 }
 
 //-----------------------------------------------------------------------------
+
+// ReadSTL reads an indexed mesh from an STL (binary or ASCII) stream, welding equal vertices.
+func ReadSTL(r io.ReadSeeker) (*Mesh, error) {
+	r, err := stlStreamCount(r)
+	if err != nil {
+		return nil, err
+	}
+	solid, err := stl.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	t := make([]*Triangle3, len(solid.Triangles))
+	var a TriangleArena
+	for i, st := range solid.Triangles {
+		var v [3]sdf.V3
+		for j, p := range st.Vertices {
+			v[j] = sdf.V3{float64(p[0]), float64(p[1]), float64(p[2])}
+		}
+		t[i] = a.New(v[0], v[1], v[2])
+	}
+	return NewMesh(t), nil
+}
+
+// stlStreamCount sets the triangle count of a binary STL stream with a 0 count (see STLWriter)
+// from the length of the stream. Other streams are returned (rewound) as they are.
+func stlStreamCount(r io.ReadSeeker) (io.ReadSeeker, error) {
+	var hdr STLHeader
+	err := binary.Read(r, binary.LittleEndian, &hdr)
+	size, serr := r.Seek(0, io.SeekEnd)
+	if serr != nil {
+		return nil, serr
+	}
+	if _, serr := r.Seek(0, io.SeekStart); serr != nil {
+		return nil, serr
+	}
+	n := (size - 84) / stlTriangleSize
+	if err != nil || hdr.Count != 0 || n == 0 || size != 84+n*stlTriangleSize {
+		return r, nil
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if string(buf[:6]) == "solid " {
+		// ASCII
+		return bytes.NewReader(buf), nil
+	}
+	binary.LittleEndian.PutUint32(buf[80:], uint32(n))
+	return bytes.NewReader(buf), nil
+}
+
+// LoadSTL reads an indexed mesh from an STL file.
+func LoadSTL(path string) (*Mesh, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadSTL(file)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,180 @@
+//-----------------------------------------------------------------------------
+/*
+
+Streaming STL Output
+
+Write binary STL triangles to an io.Writer as they are rendered, through a
+fixed-size buffer, so the mesh is never held in memory.
+
+The triangle count of the header isn't known until the end. If the writer
+is an io.WriteSeeker (e.g. an os.File) the header is rewritten with the
+count, otherwise the count is left as 0 (the count is implied by the
+stream length).
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// stlTriangleSize is the size of an encoded STL triangle.
+const stlTriangleSize = 50
+
+// stlStreamTriangles is the number of triangles in the buffer of an STLWriter.
+const stlStreamTriangles = 1024
+
+// STLWriter writes binary STL triangles to an io.Writer.
+type STLWriter struct {
+	w     io.Writer
+	start int64 // header position (io.WriteSeeker)
+	count uint64
+	buf   []byte
+	err   error
+}
+
+// NewSTLWriter writes the STL header and returns a writer for the triangles.
+func NewSTLWriter(w io.Writer) (*STLWriter, error) {
+	sw := &STLWriter{w: w, buf: make([]byte, 0, stlStreamTriangles*stlTriangleSize)}
+	if ws, ok := w.(io.WriteSeeker); ok {
+		start, err := ws.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		sw.start = start
+	}
+	if err := binary.Write(w, binary.LittleEndian, &STLHeader{}); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// stlPutV3 appends a vector as 3 float32 values.
+func stlPutV3(b []byte, v sdf.V3) []byte {
+	var x [12]byte
+	binary.LittleEndian.PutUint32(x[0:], math.Float32bits(float32(v.X)))
+	binary.LittleEndian.PutUint32(x[4:], math.Float32bits(float32(v.Y)))
+	binary.LittleEndian.PutUint32(x[8:], math.Float32bits(float32(v.Z)))
+	return append(b, x[:]...)
+}
+
+// Write writes a triangle. The first error is returned for all later writes.
+func (sw *STLWriter) Write(t *Triangle3) error {
+	if sw.err != nil {
+		return sw.err
+	}
+	if sw.count == math.MaxUint32 {
+		sw.err = sdf.ErrMsg("too many triangles for an STL file")
+		return sw.err
+	}
+	b := stlPutV3(sw.buf, t.Normal())
+	b = stlPutV3(b, t.V[0])
+	b = stlPutV3(b, t.V[1])
+	b = stlPutV3(b, t.V[2])
+	sw.buf = append(b, 0, 0)
+	sw.count++
+	if len(sw.buf) == cap(sw.buf) {
+		sw.flush()
+	}
+	return sw.err
+}
+
+// Count returns the number of triangles written.
+func (sw *STLWriter) Count() int64 {
+	return int64(sw.count)
+}
+
+func (sw *STLWriter) flush() {
+	if sw.err == nil && len(sw.buf) != 0 {
+		_, sw.err = sw.w.Write(sw.buf)
+	}
+	sw.buf = sw.buf[:0]
+}
+
+// Close flushes the triangles and (for an io.WriteSeeker) rewrites the header with the count.
+// The underlying writer isn't closed.
+func (sw *STLWriter) Close() error {
+	sw.flush()
+	if sw.err != nil {
+		return sw.err
+	}
+	ws, ok := sw.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	// the count is at the end of the header
+	if _, err := ws.Seek(sw.start+80, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(ws, binary.LittleEndian, uint32(sw.count)); err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+//-----------------------------------------------------------------------------
+
+// ToSTLStream renders an SDF3 to a binary STL stream (see STLWriter).
+func ToSTLStream(
+	w io.Writer, // STL output
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+) error {
+	return ToSTLStreamContext(context.Background(), w, s, meshCells, r)
+}
+
+// ToSTLStreamContext renders an SDF3 to a binary STL stream (see STLWriter).
+// The render is aborted at the first write error. It returns ctx.Err() if the
+// context is done before the render is complete.
+func ToSTLStreamContext(
+	ctx context.Context, // context to abort the render
+	w io.Writer, // STL output
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+) error {
+	sw, err := NewSTLWriter(w)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	output := make(chan *Triangle3, stlStreamTriangles)
+	done := make(chan struct{})
+	go func() {
+		for t := range output {
+			if sw.Write(t) != nil {
+				// stop the render, but keep reading so it doesn't block
+				cancel()
+			}
+		}
+		close(done)
+	}()
+	err = renderContext(ctx, r, s, meshCells, output)
+	close(output)
+	<-done
+	if sw.err != nil {
+		return sw.err
+	}
+	if err != nil {
+		return err
+	}
+	return sw.Close()
+}
+
+//-----------------------------------------------------------------------------
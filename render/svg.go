@@ -162,7 +162,10 @@ func RenderSVGSlow(
 	fmt.Printf("rendering %s (%dx%d)\n", path, cells[0], cells[1])
 
 	// run marching squares to generate the line segments
-	m := marchingSquares(s, bb, meshInc)
+	m, err := marchingSquares(s, bb, meshInc)
+	if err != nil {
+		return err
+	}
 	return SaveSVG(path, lineStyle, m)
 }
 
@@ -0,0 +1,341 @@
+//-----------------------------------------------------------------------------
+/*
+
+Parameter Sweeps
+
+Design exploration: a model built from named parameters is rendered and
+analyzed for every combination of the parameter values (a full factorial
+grid), in parallel. The results are cached by the hash of the model (see
+sdf.CacheKey), so combinations that build the same model, and re-runs of
+a sweep with a cache directory, are not rendered again (uncacheable models
+are rendered for every combination). The results are
+written as a CSV table with a row per combination.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// SweepParam is a named model parameter and the values to try.
+type SweepParam struct {
+	Name   string
+	Values []float64
+}
+
+// SweepRange returns a parameter with n values evenly spaced from min to max.
+func SweepRange(name string, min, max float64, n int) SweepParam {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = min
+		if n > 1 {
+			values[i] += (max - min) * float64(i) / float64(n-1)
+		}
+	}
+	return SweepParam{name, values}
+}
+
+// SweepModel builds a model from named parameter values.
+type SweepModel func(params map[string]float64) (sdf.SDF3, error)
+
+// SweepMetric is a custom analysis of a rendered model.
+type SweepMetric struct {
+	Name string
+	Fn   func(s sdf.SDF3, m *Mesh) (float64, error)
+}
+
+// SweepConfig sets the renders and analyses of a sweep.
+// Custom metrics are cached by name, so a cache directory should be cleared when they change.
+type SweepConfig struct {
+	MeshCells int           // cells on the longest axis of the uniform marching cubes renders (0: 100)
+	Density   float64       // density for the mass (0: 1)
+	Thickness bool          // find the minimum wall thickness and gap width (see Bake)
+	Metrics   []SweepMetric // custom analyses
+	CacheDir  string        // directory for the cached results ("": in memory only)
+}
+
+// SweepResult is the result for a combination of parameter values.
+type SweepResult struct {
+	Params  map[string]float64 `json:"-"` // parameter values
+	Model   string             // model hash
+	Volume  float64            // volume of the mesh
+	Mass    float64            // volume * density
+	Box     sdf.Box3           // bounding box of the mesh
+	MinWall float64            // minimum wall thickness
+	MinGap  float64            // minimum gap width
+	Metrics map[string]float64 // custom metric values
+	Err     error              `json:"-"` // error building, rendering or analyzing the model
+}
+
+//-----------------------------------------------------------------------------
+
+// Sweep renders and analyzes a model for every combination of the parameter values,
+// with the last parameter varying fastest. The error of a combination is recorded in its
+// result. The combinations are counted as cells by the progress tracker of the context.
+// It returns ctx.Err() if the context is done before the sweep is complete.
+func Sweep(ctx context.Context, model SweepModel, params []SweepParam, cfg *SweepConfig) ([]SweepResult, error) {
+	if cfg == nil {
+		cfg = &SweepConfig{}
+	}
+	k := *cfg
+	if k.MeshCells == 0 {
+		k.MeshCells = 100
+	}
+	if k.Density == 0 {
+		k.Density = 1
+	}
+	if k.MeshCells < 0 || k.Density < 0 {
+		return nil, sdf.ErrMsg("bad sweep parameters")
+	}
+	n := 1
+	for _, p := range params {
+		if p.Name == "" || len(p.Values) == 0 {
+			return nil, sdf.ErrMsg("sweep parameters need a name and values")
+		}
+		n *= len(p.Values)
+	}
+	if k.CacheDir != "" {
+		if err := os.MkdirAll(k.CacheDir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	progress := StartProgress(ctx, int64(n))
+	// the renders don't report to the sweep progress tracker
+	rctx := context.WithValue(ctx, progressKey{}, (*ProgressTracker)(nil))
+
+	// build the models, in parallel
+	results := make([]SweepResult, n)
+	models := make([]sdf.SDF3, n)
+	keys := make([]string, n)
+	cacheable := make([]bool, n)
+	g := DefaultPool().Group()
+	for i := range results {
+		i := i
+		g.Go(func() {
+			values := make(map[string]float64, len(params))
+			for j, l := i, len(params)-1; l >= 0; l-- {
+				p := &params[l]
+				values[p.Name] = p.Values[j%len(p.Values)]
+				j /= len(p.Values)
+			}
+			results[i].Params = values
+			s, err := model(values)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			models[i] = s
+			keys[i], cacheable[i] = sweepKey(s, &k)
+			if !cacheable[i] {
+				// analyze the model of each combination
+				keys[i] = fmt.Sprintf("%s %d", keys[i], i)
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// analyze each distinct model once
+	first := make(map[string]int)
+	count := make(map[string]int64)
+	var unique []int
+	for i, key := range keys {
+		if models[i] == nil {
+			progress.Add(1, 0)
+			continue
+		}
+		if _, ok := first[key]; !ok {
+			first[key] = i
+			unique = append(unique, i)
+		}
+		count[key]++
+	}
+	analyzed := make([]SweepResult, n)
+	g = DefaultPool().Group()
+	for _, i := range unique {
+		i := i
+		g.Go(func() {
+			if ctx.Err() == nil {
+				analyzed[i] = sweepAnalyze(rctx, models[i], keys[i], cacheable[i], &k)
+			}
+			progress.Add(count[keys[i]], 0)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i := range results {
+		if models[i] != nil {
+			params := results[i].Params
+			results[i] = analyzed[first[keys[i]]]
+			results[i].Params = params
+		}
+	}
+	progress.Done()
+	return results, nil
+}
+
+// sweepKey returns the cache key for the analysis of a model, and false if the model is uncacheable.
+func sweepKey(s sdf.SDF3, k *SweepConfig) (string, bool) {
+	key, ok := sdf.CacheKey(s)
+	h := sha256.New()
+	fmt.Fprintf(h, "sweep %s %d %g %v", key, k.MeshCells, k.Density, k.Thickness)
+	for _, m := range k.Metrics {
+		fmt.Fprintf(h, " %q", m.Name)
+	}
+	return hex.EncodeToString(h.Sum(nil)), ok
+}
+
+// sweepAnalyze renders and analyzes a model, or reads the result from the cache directory
+// (for a cacheable model).
+func sweepAnalyze(ctx context.Context, s sdf.SDF3, key string, cacheable bool, k *SweepConfig) SweepResult {
+	r := SweepResult{Model: sdf.ModelHash(s)}
+	var path string
+	if k.CacheDir != "" && cacheable {
+		path = filepath.Join(k.CacheDir, key+".json")
+		if b, err := ioutil.ReadFile(path); err == nil {
+			var cached SweepResult
+			if json.Unmarshal(b, &cached) == nil {
+				return cached
+			}
+		}
+	}
+	m, err := RenderIndexed(ctx, s, k.MeshCells, &MarchingCubesUniform{})
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	if len(m.Vertices) == 0 {
+		r.Err = sdf.ErrMsg("empty mesh")
+		return r
+	}
+	mp, err := MeshMassProperties(m.Triangles(), k.Density)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Volume, r.Mass, r.Box = mp.Volume, mp.Mass, meshBox(m)
+	if k.Thickness {
+		if r.Err = Bake(s, m, &BakeConfig{Thickness: true}); r.Err != nil {
+			return r
+		}
+		r.MinWall, r.MinGap = math.Inf(1), math.Inf(1)
+		for i := range m.Vertices {
+			r.MinWall = math.Min(r.MinWall, m.Attributes[AttributeWall][i])
+			r.MinGap = math.Min(r.MinGap, m.Attributes[AttributeGap][i])
+		}
+	}
+	if len(k.Metrics) != 0 {
+		r.Metrics = make(map[string]float64, len(k.Metrics))
+		for _, metric := range k.Metrics {
+			v, err := metric.Fn(s, m)
+			if err != nil {
+				r.Err = err
+				return r
+			}
+			r.Metrics[metric.Name] = v
+		}
+	}
+	if path != "" {
+		b, err := json.Marshal(&r)
+		if err == nil {
+			err = ioutil.WriteFile(path, b, 0644)
+		}
+		r.Err = err
+	}
+	return r
+}
+
+//-----------------------------------------------------------------------------
+
+// SaveSweepCSV writes the results of a sweep to a CSV file (see WriteSweepCSV).
+func SaveSweepCSV(path string, params []SweepParam, cfg *SweepConfig, results []SweepResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteSweepCSV(f, params, cfg, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteSweepCSV writes the results of a sweep as CSV: a header row and a row per result
+// with the parameter values, the metrics and the error (if any).
+func WriteSweepCSV(w io.Writer, params []SweepParam, cfg *SweepConfig, results []SweepResult) error {
+	if cfg == nil {
+		cfg = &SweepConfig{}
+	}
+	var metrics []string
+	for _, m := range cfg.Metrics {
+		metrics = append(metrics, m.Name)
+	}
+	sort.Strings(metrics)
+	var header []string
+	for _, p := range params {
+		header = append(header, p.Name)
+	}
+	header = append(header, "model", "volume", "mass", "min_x", "min_y", "min_z", "max_x", "max_y", "max_z")
+	if cfg.Thickness {
+		header = append(header, "min_wall", "min_gap")
+	}
+	header = append(header, metrics...)
+	header = append(header, "error")
+
+	c := csv.NewWriter(w)
+	if err := c.Write(header); err != nil {
+		return err
+	}
+	f := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	for i := range results {
+		r := &results[i]
+		var row []string
+		for _, p := range params {
+			row = append(row, f(r.Params[p.Name]))
+		}
+		b := r.Box
+		row = append(row, r.Model, f(r.Volume), f(r.Mass), f(b.Min.X), f(b.Min.Y), f(b.Min.Z), f(b.Max.X), f(b.Max.Y), f(b.Max.Z))
+		if cfg.Thickness {
+			row = append(row, f(r.MinWall), f(r.MinGap))
+		}
+		for _, name := range metrics {
+			row = append(row, f(r.Metrics[name]))
+		}
+		msg := ""
+		if r.Err != nil {
+			msg = r.Err.Error()
+		}
+		row = append(row, msg)
+		if err := c.Write(row); err != nil {
+			return err
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
+
+//-----------------------------------------------------------------------------
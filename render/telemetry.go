@@ -0,0 +1,249 @@
+//-----------------------------------------------------------------------------
+/*
+
+Render Telemetry
+
+A tracer attached to the context of a render receives spans for the render
+and its phases, and metrics (counters and value records) for the rendered
+triangles, the model evaluations and the export durations, so services
+rendering many models can monitor them. The Tracer interface is small so
+it can be adapted to OpenTelemetry (a trace.Tracer for the spans, and a
+metric.Meter with Int64Counter and Float64Histogram instruments for the
+metrics), or to any other monitoring system.
+
+Spans are named "sdfx.<operation>" and their durations (in seconds) are
+also recorded as "sdfx.<operation>.duration" metrics. Renderers (including
+those in other packages) start spans for their phases with StartSpan.
+
+Counting the model evaluations wraps the model with a counter (an atomic
+add per evaluation), so it is optional.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// Attribute is an attribute of a span or metric.
+type Attribute struct {
+	Key   string
+	Value interface{} // string, bool, int, int64 or float64
+}
+
+// Span is an operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Tracer receives the spans and metrics of the renders and exports of a context.
+// The methods may be called concurrently.
+type Tracer interface {
+	// Start starts a span, returning the context of its child spans.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+	// Count adds to a counter.
+	Count(ctx context.Context, name string, n int64, attrs ...Attribute)
+	// Record records a value (e.g. of a histogram).
+	Record(ctx context.Context, name string, value float64, attrs ...Attribute)
+}
+
+// TraceConfig sets the instrumentation of a tracer.
+type TraceConfig struct {
+	Evaluations bool // count the model evaluations of the renders (slower)
+}
+
+// traceState is the tracer of a context.
+type traceState struct {
+	t   Tracer
+	cfg TraceConfig
+}
+
+type traceKey struct{}
+
+// WithTracer returns a context that reports the spans and metrics of renders and exports to a tracer.
+func WithTracer(ctx context.Context, t Tracer, cfg *TraceConfig) context.Context {
+	st := &traceState{t: t}
+	if cfg != nil {
+		st.cfg = *cfg
+	}
+	return context.WithValue(ctx, traceKey{}, st)
+}
+
+// traceOf returns the tracer of a context (nil: none).
+func traceOf(ctx context.Context) *traceState {
+	if ctx == nil {
+		return nil
+	}
+	st, _ := ctx.Value(traceKey{}).(*traceState)
+	return st
+}
+
+//-----------------------------------------------------------------------------
+
+// TraceSpan is a span of the tracer of a context. The methods of a nil span do nothing.
+type TraceSpan struct {
+	st    *traceState
+	ctx   context.Context
+	span  Span
+	name  string
+	attrs []Attribute
+	start time.Time
+}
+
+// StartSpan starts a span with the tracer of a context (nil: no tracer), returning the context of
+// its child spans. The span is named "sdfx.<name>".
+func StartSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, *TraceSpan) {
+	st := traceOf(ctx)
+	if st == nil {
+		return ctx, nil
+	}
+	name = "sdfx." + name
+	ctx, span := st.t.Start(ctx, name, attrs...)
+	return ctx, &TraceSpan{st, ctx, span, name, attrs, time.Now()}
+}
+
+// SetAttributes adds attributes to a span (and its metrics).
+func (s *TraceSpan) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.attrs = append(s.attrs, attrs...)
+	s.span.SetAttributes(attrs...)
+}
+
+// Count adds to the "<span name>.<name>" counter, with the attributes of the span.
+func (s *TraceSpan) Count(name string, n int64) {
+	if s == nil {
+		return
+	}
+	s.st.t.Count(s.ctx, s.name+"."+name, n, s.attrs...)
+}
+
+// End ends a span (with an error, if not nil) and records its duration.
+func (s *TraceSpan) End(err error) {
+	if s == nil {
+		return
+	}
+	if err != nil {
+		s.span.RecordError(err)
+	}
+	s.st.t.Record(s.ctx, s.name+".duration", time.Since(s.start).Seconds(), s.attrs...)
+	s.span.End()
+}
+
+// startRenderSpan starts the span of a render.
+func startRenderSpan(ctx context.Context, meshCells int, r Render3) (context.Context, *TraceSpan) {
+	if traceOf(ctx) == nil {
+		return ctx, nil
+	}
+	return StartSpan(ctx, "render", Attribute{"renderer", fmt.Sprintf("%T", r)}, Attribute{"mesh_cells", meshCells})
+}
+
+// endRender ends the span of a render, counting the triangles and evaluations (nil: not counted).
+func (s *TraceSpan) endRender(triangles int, evaluations func() int64, err error) {
+	if s == nil {
+		return
+	}
+	s.Count("triangles", int64(triangles))
+	if evaluations != nil {
+		s.Count("evaluations", evaluations())
+	}
+	s.End(err)
+}
+
+//-----------------------------------------------------------------------------
+// Evaluation counts
+
+// traceSDF3 counts the evaluations of a model. The counter is a function, so the model
+// hash (see sdf.ModelHash) is the same for every render.
+type traceSDF3 struct {
+	s     sdf.SDF3
+	count func(n int64)
+}
+
+// traceModel returns the model to render with a span, and a function returning its evaluation
+// count (the model itself and nil if the evaluations are not counted).
+func traceModel(span *TraceSpan, s sdf.SDF3) (sdf.SDF3, func() int64) {
+	if span == nil || !span.st.cfg.Evaluations {
+		return s, nil
+	}
+	var n int64
+	t := &traceSDF3{s, func(k int64) { atomic.AddInt64(&n, k) }}
+	evaluations := func() int64 { return atomic.LoadInt64(&n) }
+	_, interval := s.(sdf.SDF3Interval)
+	_, gradient := s.(sdf.SDF3Gradient)
+	switch {
+	case interval && gradient:
+		return &traceIntervalGradientSDF3{traceIntervalSDF3{t}}, evaluations
+	case interval:
+		return &traceIntervalSDF3{t}, evaluations
+	case gradient:
+		return &traceGradientSDF3{t}, evaluations
+	}
+	return t, evaluations
+}
+
+// Evaluate returns the minimum distance to the model.
+func (t *traceSDF3) Evaluate(p sdf.V3) float64 {
+	t.count(1)
+	return t.s.Evaluate(p)
+}
+
+// EvaluateN evaluates the model at a slice of points.
+func (t *traceSDF3) EvaluateN(p []sdf.V3, out []float64) {
+	t.count(int64(len(p)))
+	sdf.EvaluateN(t.s, p, out)
+}
+
+// BoundingBox returns the bounding box of the model.
+func (t *traceSDF3) BoundingBox() sdf.Box3 {
+	return t.s.BoundingBox()
+}
+
+// LipschitzBound returns a Lipschitz bound of the model on the segment a-b.
+func (t *traceSDF3) LipschitzBound(a, b sdf.V3) float64 {
+	return sdf.LipschitzBound3(t.s, a, b)
+}
+
+// traceIntervalSDF3 counts the evaluations of a model with interval evaluation.
+type traceIntervalSDF3 struct {
+	*traceSDF3
+}
+
+// EvaluateInterval returns a bound of the values of the model over a box.
+func (t *traceIntervalSDF3) EvaluateInterval(b sdf.Box3) sdf.Interval {
+	return t.s.(sdf.SDF3Interval).EvaluateInterval(b)
+}
+
+// traceGradientSDF3 counts the evaluations of a model with an analytic gradient.
+type traceGradientSDF3 struct {
+	*traceSDF3
+}
+
+// Gradient returns the gradient of the model.
+func (t *traceGradientSDF3) Gradient(p sdf.V3) sdf.V3 {
+	return t.s.(sdf.SDF3Gradient).Gradient(p)
+}
+
+// traceIntervalGradientSDF3 counts the evaluations of a model with interval evaluation and an analytic gradient.
+type traceIntervalGradientSDF3 struct {
+	traceIntervalSDF3
+}
+
+// Gradient returns the gradient of the model.
+func (t *traceIntervalGradientSDF3) Gradient(p sdf.V3) sdf.V3 {
+	return t.s.(sdf.SDF3Gradient).Gradient(p)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+/*
+
+3MF Save
+
+3D Manufacturing Format: a zip package with an XML model. Vertex colors
+are written as a color group (materials extension) referenced by the
+triangle corners. Multi-part files have an object and a build item for
+each part. See https://3mf.io/specification/
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"image/color"
+	"os"
+	"strings"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+const threeMFContentTypes = `<?xml version="1.0" encoding="UTF-8"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="model" ContentType="application/vnd.ms-package.3dmanufacturing-3dmodel+xml"/>
+</Types>
+`
+
+const threeMFRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Target="/3D/3dmodel.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>
+`
+
+// Part3MF is an object of a multi-part 3MF file.
+type Part3MF struct {
+	Name   string // object name (optional)
+	Mesh   *Mesh  // object mesh (with its vertex colors)
+	Offset sdf.V3 // position of the object on the build plate
+}
+
+// Save3MF writes an indexed mesh (with its vertex colors) to a 3MF file.
+// Units are millimeters.
+func Save3MF(path string, m *Mesh) error {
+	return Save3MFParts(path, []Part3MF{{Mesh: m}})
+}
+
+// Save3MFParts writes meshes as separate objects of a 3MF file.
+// Units are millimeters.
+func Save3MFParts(path string, parts []Part3MF) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	z := zip.NewWriter(file)
+	for _, f := range []struct{ name, data string }{
+		{"[Content_Types].xml", threeMFContentTypes},
+		{"_rels/.rels", threeMFRels},
+	} {
+		w, err := z.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(f.data)); err != nil {
+			return err
+		}
+	}
+	w, err := z.Create("3D/3dmodel.model")
+	if err != nil {
+		return err
+	}
+	buf := bufio.NewWriter(w)
+	write3MFModel(buf, parts)
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// write3MFModel writes the 3MF model XML of the parts. The objects are numbered from 1
+// and share a color group.
+func write3MFModel(w *bufio.Writer, parts []Part3MF) {
+	// unique colors
+	var colors []color.RGBA
+	colorIndex := make(map[color.RGBA]int)
+	vertexColor := make([][]int, len(parts))
+	for i, p := range parts {
+		vertexColor[i] = make([]int, len(p.Mesh.Colors))
+		for j, c := range p.Mesh.Colors {
+			k, ok := colorIndex[c]
+			if !ok {
+				k = len(colors)
+				colorIndex[c] = k
+				colors = append(colors, c)
+			}
+			vertexColor[i][j] = k
+		}
+	}
+	colorID := len(parts) + 1
+
+	fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(w, "<model unit=\"millimeter\" xml:lang=\"en-US\" xmlns=\"http://schemas.microsoft.com/3dmanufacturing/core/2015/02\"")
+	fmt.Fprintf(w, " xmlns:m=\"http://schemas.microsoft.com/3dmanufacturing/material/2015/02\">\n<resources>\n")
+	if colors != nil {
+		fmt.Fprintf(w, "<m:colorgroup id=\"%d\">\n", colorID)
+		for _, c := range colors {
+			fmt.Fprintf(w, "<m:color color=\"#%02X%02X%02X%02X\"/>\n", c.R, c.G, c.B, c.A)
+		}
+		fmt.Fprintf(w, "</m:colorgroup>\n")
+	}
+	for i, p := range parts {
+		m := p.Mesh
+		name := ""
+		if p.Name != "" {
+			var b strings.Builder
+			xml.EscapeText(&b, []byte(p.Name))
+			name = fmt.Sprintf(" name=\"%s\"", b.String())
+		}
+		fmt.Fprintf(w, "<object id=\"%d\"%s type=\"model\">\n<mesh>\n<vertices>\n", i+1, name)
+		for _, v := range m.Vertices {
+			fmt.Fprintf(w, "<vertex x=\"%g\" y=\"%g\" z=\"%g\"/>\n", float32(v.X), float32(v.Y), float32(v.Z))
+		}
+		fmt.Fprintf(w, "</vertices>\n<triangles>\n")
+		for _, f := range m.Faces {
+			if m.Colors != nil {
+				c := vertexColor[i]
+				fmt.Fprintf(w, "<triangle v1=\"%d\" v2=\"%d\" v3=\"%d\" pid=\"%d\" p1=\"%d\" p2=\"%d\" p3=\"%d\"/>\n",
+					f[0], f[1], f[2], colorID, c[f[0]], c[f[1]], c[f[2]])
+			} else {
+				fmt.Fprintf(w, "<triangle v1=\"%d\" v2=\"%d\" v3=\"%d\"/>\n", f[0], f[1], f[2])
+			}
+		}
+		fmt.Fprintf(w, "</triangles>\n</mesh>\n</object>\n")
+	}
+	fmt.Fprintf(w, "</resources>\n<build>\n")
+	for i, p := range parts {
+		if p.Offset == (sdf.V3{}) {
+			fmt.Fprintf(w, "<item objectid=\"%d\"/>\n", i+1)
+		} else {
+			o := p.Offset
+			fmt.Fprintf(w, "<item objectid=\"%d\" transform=\"1 0 0 0 1 0 0 0 1 %g %g %g\"/>\n", i+1, float32(o.X), float32(o.Y), float32(o.Z))
+		}
+	}
+	fmt.Fprintf(w, "</build>\n</model>\n")
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,195 @@
+//-----------------------------------------------------------------------------
+/*
+
+Tiled Marching Cubes
+
+Split the render volume into tiles sized to a memory budget and render
+each tile separately (concurrently, or in separate processes). All tiles
+share the sampling lattice of a uniform marching cubes render and edge
+points are interpolated in a fixed direction, so the vertices on tile
+seams are bitwise identical and the merged mesh is exactly welded.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// tileBytesPerCell is the estimated memory use per cell of a tile cross-section
+// (two layers of samples plus the batched evaluation points).
+const tileBytesPerCell = 64
+
+// defaultTileBudget is the default memory budget for a tile.
+const defaultTileBudget = 256 << 20
+
+// Tile is a block of cubes within the sampling lattice of a render.
+type Tile struct {
+	Index int      // tile number
+	Ofs   sdf.V3i  // first cube of the tile
+	Steps sdf.V3i  // number of cubes on each axis
+	Box   sdf.Box3 // volume covered by the tile
+}
+
+// MarchingCubesTiled renders using marching cubes, one tile at a time.
+type MarchingCubesTiled struct {
+	MemoryBudget int64           // memory budget per tile in bytes (0 = 256 MiB)
+	Workers      int             // number of tiles rendered concurrently (0 = 1, capped by MaxParallelism)
+	Tolerances   *sdf.Tolerances // nil: derived from the bounding box
+	Resolution   *Resolution     // nil: cubic cells
+	Ordered      bool            // output the triangles in tile order (see WriteOrdered)
+}
+
+// uniformLattice returns the sampling lattice (base, increment, cubes) of a uniform marching cubes render.
+func uniformLattice(s sdf.SDF3, meshCells int, res *Resolution) (sdf.V3, sdf.V3, sdf.V3i) {
+	return res.lattice(s.BoundingBox(), meshCells)
+}
+
+// boxLattice returns the sampling lattice of a uniform marching cubes render of a bounding box.
+func boxLattice(bb0 sdf.Box3, meshCells int) (sdf.V3, sdf.V3, sdf.V3i) {
+	return (*Resolution)(nil).lattice(bb0, meshCells)
+}
+
+// tileSize returns the number of cubes on each side of a tile.
+func (m *MarchingCubesTiled) tileSize() int {
+	budget := m.MemoryBudget
+	if budget <= 0 {
+		budget = defaultTileBudget
+	}
+	n := int(math.Sqrt(float64(budget)/tileBytesPerCell)) - 1
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// Tiles returns the tiles of the render volume.
+func (m *MarchingCubesTiled) Tiles(s sdf.SDF3, meshCells int) []Tile {
+	base, inc, steps := uniformLattice(s, meshCells, m.Resolution)
+	n := m.tileSize()
+	var tiles []Tile
+	for x := 0; x < steps[0]; x += n {
+		for y := 0; y < steps[1]; y += n {
+			for z := 0; z < steps[2]; z += n {
+				ofs := sdf.V3i{x, y, z}
+				t := sdf.V3i{n, n, n}
+				for i := range t {
+					if ofs[i]+t[i] > steps[i] {
+						t[i] = steps[i] - ofs[i]
+					}
+				}
+				min := base.Add(ofs.ToV3().Mul(inc))
+				max := base.Add(ofs.Add(t).ToV3().Mul(inc))
+				tiles = append(tiles, Tile{len(tiles), ofs, t, sdf.Box3{min, max}})
+			}
+		}
+	}
+	return tiles
+}
+
+// RenderTile produces the triangles for a single tile of the render volume.
+// Meshes for the tiles can be rendered separately (e.g. in different processes) and merged.
+func (m *MarchingCubesTiled) RenderTile(s sdf.SDF3, meshCells int, t Tile, output chan<- *Triangle3) {
+	m.renderTile(context.Background(), s, meshCells, t, output)
+}
+
+// renderTile produces the triangles for a single tile, aborted when the context is done.
+func (m *MarchingCubesTiled) renderTile(ctx context.Context, s sdf.SDF3, meshCells int, t Tile, output chan<- *Triangle3) error {
+	base, inc, _ := uniformLattice(s, meshCells, m.Resolution)
+	tol := modelTolerances(s, m.Tolerances)
+	return marchingCubesLattice(ctx, s, base, inc, t.Ofs, t.Steps, tol.Vertex, func(ts []*Triangle3) {
+		for _, tri := range ts {
+			output <- tri
+		}
+	})
+}
+
+// tileTriangles returns the triangles of a single tile.
+func (m *MarchingCubesTiled) tileTriangles(ctx context.Context, s sdf.SDF3, meshCells int, t Tile) ([]*Triangle3, error) {
+	base, inc, _ := uniformLattice(s, meshCells, m.Resolution)
+	tol := modelTolerances(s, m.Tolerances)
+	var tris []*Triangle3
+	err := marchingCubesLattice(ctx, s, base, inc, t.Ofs, t.Steps, tol.Vertex, func(ts []*Triangle3) {
+		tris = append(tris, ts...)
+	})
+	return tris, err
+}
+
+// Info returns a string describing the rendered volume.
+func (m *MarchingCubesTiled) Info(s sdf.SDF3, meshCells int) string {
+	_, _, steps := uniformLattice(s, meshCells, m.Resolution)
+	return fmt.Sprintf("%dx%dx%d, %d tiles", steps[0], steps[1], steps[2], len(m.Tiles(s, meshCells)))
+}
+
+// Render produces a 3d triangle mesh over the bounding volume of an sdf3.
+func (m *MarchingCubesTiled) Render(s sdf.SDF3, meshCells int, output chan<- *Triangle3) {
+	m.RenderContext(context.Background(), s, meshCells, output)
+}
+
+// RenderContext produces a 3d triangle mesh over the bounding volume of an sdf3.
+// It returns ctx.Err() if the context is done before the render is complete.
+func (m *MarchingCubesTiled) RenderContext(ctx context.Context, s sdf.SDF3, meshCells int, output chan<- *Triangle3) error {
+	tiles := m.Tiles(s, meshCells)
+	_, _, steps := uniformLattice(s, meshCells, m.Resolution)
+	progress := StartProgress(ctx, int64(steps[0])*int64(steps[1])*int64(steps[2]))
+	workers := m.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	var mu sync.Mutex
+	var tileErr error
+	fail := func(err error) {
+		mu.Lock()
+		if tileErr == nil {
+			tileErr = err
+		}
+		mu.Unlock()
+	}
+	if m.Ordered {
+		err := WriteOrdered(output, len(tiles), workers, func(i int) []*Triangle3 {
+			tris, err := m.tileTriangles(ctx, s, meshCells, tiles[i])
+			if err != nil {
+				// the remaining tiles are empty once the context is done
+				fail(err)
+				return nil
+			}
+			return tris
+		})
+		if err != nil {
+			return err
+		}
+		if tileErr == nil {
+			progress.Done()
+		}
+		return tileErr
+	}
+	p := NewPool(workers)
+	defer p.Close()
+	g := p.Group()
+	for _, t := range tiles {
+		t := t
+		g.Go(func() {
+			if err := m.renderTile(ctx, s, meshCells, t, output); err != nil {
+				fail(err)
+			}
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if tileErr == nil {
+		progress.Done()
+	}
+	return tileErr
+}
+
+//-----------------------------------------------------------------------------
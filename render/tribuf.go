@@ -0,0 +1,209 @@
+//-----------------------------------------------------------------------------
+/*
+
+Triangle Buffers
+
+Very large renders don't fit in memory as []*Triangle3. A triangle buffer
+stores triangles as packed records, either in memory or in a memory-mapped
+temporary file, so the operating system can page the data to disk.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// triangleSize is the size of a packed triangle record (9 x float64).
+const triangleSize = 9 * 8
+
+// putTriangle packs a triangle into a record.
+func putTriangle(r []byte, t *Triangle3) {
+	for i, v := range t.V {
+		binary.LittleEndian.PutUint64(r[24*i:], math.Float64bits(v.X))
+		binary.LittleEndian.PutUint64(r[24*i+8:], math.Float64bits(v.Y))
+		binary.LittleEndian.PutUint64(r[24*i+16:], math.Float64bits(v.Z))
+	}
+}
+
+// getTriangle unpacks a triangle from a record.
+func getTriangle(r []byte) *Triangle3 {
+	f := func(ofs int) float64 {
+		return math.Float64frombits(binary.LittleEndian.Uint64(r[ofs:]))
+	}
+	t := Triangle3{}
+	for j := range t.V {
+		t.V[j] = sdf.V3{f(24 * j), f(24*j + 8), f(24*j + 16)}
+	}
+	return &t
+}
+
+// triStorage is the backing storage of a triangle buffer.
+type triStorage interface {
+	resize(size int) ([]byte, error) // resize the storage, returning the data
+	close() error                    // release the storage
+}
+
+// memStorage is in-memory triangle storage.
+type memStorage struct {
+	b []byte
+}
+
+func (m *memStorage) resize(size int) ([]byte, error) {
+	b := make([]byte, size)
+	copy(b, m.b)
+	m.b = b
+	return b, nil
+}
+
+func (m *memStorage) close() error {
+	m.b = nil
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// TriangleBuffer is a growable buffer of triangles.
+type TriangleBuffer struct {
+	store triStorage
+	data  []byte // triangle records
+	n     int    // number of triangles
+}
+
+// NewTriangleBuffer returns an in-memory triangle buffer.
+func NewTriangleBuffer() *TriangleBuffer {
+	return &TriangleBuffer{store: &memStorage{}}
+}
+
+// NewMappedTriangleBuffer returns a triangle buffer backed by a memory-mapped temporary file
+// in dir (the default temporary directory if dir is empty). The file is removed by Close.
+func NewMappedTriangleBuffer(dir string) (*TriangleBuffer, error) {
+	store, err := newMmapStorage(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &TriangleBuffer{store: store}, nil
+}
+
+// Len returns the number of triangles in the buffer.
+func (b *TriangleBuffer) Len() int {
+	return b.n
+}
+
+// Add adds a triangle to the buffer.
+func (b *TriangleBuffer) Add(t *Triangle3) error {
+	ofs := b.n * triangleSize
+	if ofs+triangleSize > len(b.data) {
+		// grow the buffer
+		size := 2 * len(b.data)
+		if size < 1<<16 {
+			size = 1 << 16
+		}
+		data, err := b.store.resize(size)
+		if err != nil {
+			return err
+		}
+		b.data = data
+	}
+	putTriangle(b.data[ofs:ofs+triangleSize], t)
+	b.n++
+	return nil
+}
+
+// At returns the i-th triangle in the buffer.
+func (b *TriangleBuffer) At(i int) *Triangle3 {
+	return getTriangle(b.data[i*triangleSize : (i+1)*triangleSize])
+}
+
+// Close releases the buffer storage.
+func (b *TriangleBuffer) Close() error {
+	b.data = nil
+	b.n = 0
+	return b.store.close()
+}
+
+// Collect adds the triangles from a channel to the buffer until the channel is closed.
+// The first error is returned after the channel has been drained.
+func (b *TriangleBuffer) Collect(input <-chan *Triangle3) error {
+	var err error
+	for t := range input {
+		if err == nil {
+			err = b.Add(t)
+		}
+	}
+	return err
+}
+
+// SaveSTL writes the triangles in the buffer to an STL file.
+func (b *TriangleBuffer) SaveSTL(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := bufio.NewWriter(file)
+	header := STLHeader{}
+	header.Count = uint32(b.n)
+	if err := binary.Write(buf, binary.LittleEndian, &header); err != nil {
+		return err
+	}
+
+	var d STLTriangle
+	for i := 0; i < b.n; i++ {
+		t := b.At(i)
+		n := t.Normal()
+		d.Normal = [3]float32{float32(n.X), float32(n.Y), float32(n.Z)}
+		d.Vertex1 = [3]float32{float32(t.V[0].X), float32(t.V[0].Y), float32(t.V[0].Z)}
+		d.Vertex2 = [3]float32{float32(t.V[1].X), float32(t.V[1].Y), float32(t.V[1].Z)}
+		d.Vertex3 = [3]float32{float32(t.V[2].X), float32(t.V[2].Y), float32(t.V[2].Z)}
+		if err := binary.Write(buf, binary.LittleEndian, &d); err != nil {
+			return err
+		}
+	}
+
+	return buf.Flush()
+}
+
+//-----------------------------------------------------------------------------
+
+// ToTriangleBuffer renders an SDF3 to a triangle buffer.
+// With mapped = true the buffer is a memory-mapped temporary file.
+func ToTriangleBuffer(
+	s sdf.SDF3, // sdf3 to render
+	meshCells int, // number of cells on the longest axis of bounding box. e.g 200
+	r Render3, // rendering method
+	mapped bool, // use a memory-mapped buffer
+) (*TriangleBuffer, error) {
+	b := NewTriangleBuffer()
+	if mapped {
+		var err error
+		b, err = NewMappedTriangleBuffer("")
+		if err != nil {
+			return nil, err
+		}
+	}
+	output := make(chan *Triangle3)
+	done := make(chan error)
+	go func() {
+		done <- b.Collect(output)
+	}()
+	r.Render(s, meshCells, output)
+	close(output)
+	if err := <-done; err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+//-----------------------------------------------------------------------------
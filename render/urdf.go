@@ -0,0 +1,364 @@
+//-----------------------------------------------------------------------------
+/*
+
+URDF Robot Description Export
+
+Write links (meshes + inertial properties) and joints as a URDF file
+for use with ROS and physics simulators.
+
+Joints are given by their frames, or derived from assembly constraints
+(mates): an axis of the parent link and an axis of the child link that
+coincide in the assembly. The child frame is placed so the axes coincide
+(with the least rotation), and the joint turns about or slides along the
+shared axis.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// URDFLink is a rigid body within a robot description.
+type URDFLink struct {
+	Name    string   // link name, also used for the mesh filename
+	SDF     sdf.SDF3 // link geometry (model units, link frame)
+	Density float64  // density (kg/m^3)
+}
+
+// URDFJoint connects a parent link to a child link.
+type URDFJoint struct {
+	Name     string  // joint name
+	Type     string  // revolute, continuous, prismatic, fixed, floating or planar
+	Parent   string  // parent link name
+	Child    string  // child link name
+	Origin   sdf.V3  // child frame origin in the parent frame (model units)
+	RPY      sdf.V3  // child frame roll, pitch, yaw in the parent frame (radians)
+	Axis     sdf.V3  // joint axis in the child frame
+	Lower    float64 // lower joint limit (radians or model units)
+	Upper    float64 // upper joint limit (radians or model units)
+	Effort   float64 // maximum joint effort
+	Velocity float64 // maximum joint velocity (radians or model units per second)
+}
+
+// URDFAxis is an axis of a link (in the link frame), for assembly constraints.
+type URDFAxis struct {
+	Point     sdf.V3 // a point on the axis
+	Direction sdf.V3 // the axis direction
+}
+
+// URDF is a robot description made from links and joints.
+type URDF struct {
+	Name   string       // robot name
+	Scale  float64      // metres per model unit (0.001 for millimetres)
+	Links  []*URDFLink  // robot links
+	Joints []*URDFJoint // robot joints
+}
+
+// NewURDF returns an empty robot description with millimetre model units.
+func NewURDF(name string) *URDF {
+	return &URDF{
+		Name:  name,
+		Scale: 0.001,
+	}
+}
+
+// AddLink adds a link to the robot description.
+func (u *URDF) AddLink(name string, s sdf.SDF3, density float64) *URDFLink {
+	l := &URDFLink{
+		Name:    name,
+		SDF:     s,
+		Density: density,
+	}
+	u.Links = append(u.Links, l)
+	return l
+}
+
+// AddJoint adds a joint between two links to the robot description.
+func (u *URDF) AddJoint(name, jointType, parent, child string, origin sdf.V3) *URDFJoint {
+	j := &URDFJoint{
+		Name:   name,
+		Type:   jointType,
+		Parent: parent,
+		Child:  child,
+		Origin: origin,
+		Axis:   sdf.V3{0, 0, 1},
+	}
+	u.Joints = append(u.Joints, j)
+	return j
+}
+
+// urdfFrame returns the transform of a frame with its origin on an axis and z along the axis.
+func urdfFrame(a URDFAxis) sdf.M44 {
+	d := a.Direction.Normalize()
+	r := sdf.V3{0, 0, 1}.RotateToVector(d)
+	if d.Z < -1+1e-12 {
+		// a rotation (not a reflection) for the opposite axis
+		r = sdf.RotateX(sdf.Pi)
+	}
+	return sdf.Translate3d(a.Point).Mul(r)
+}
+
+// AddMate adds a joint derived from an assembly constraint: an axis of the parent link and an
+// axis of the child link coincide (with the same direction). The joint frame is the child
+// frame placed so the axes coincide, and the joint axis is the child axis. The joint type is
+// revolute or continuous (the child turns about the axis), prismatic (it slides along the axis)
+// or fixed.
+func (u *URDF) AddMate(name, jointType, parent, child string, parentAxis, childAxis URDFAxis) (*URDFJoint, error) {
+	if parentAxis.Direction.Length() == 0 || childAxis.Direction.Length() == 0 {
+		return nil, sdf.ErrMsg(fmt.Sprintf("mate \"%s\" axis direction is zero", name))
+	}
+	switch jointType {
+	case "revolute", "continuous", "prismatic", "fixed":
+	default:
+		return nil, sdf.ErrMsg(fmt.Sprintf("mate \"%s\" joint type \"%s\" is not revolute, continuous, prismatic or fixed", name, jointType))
+	}
+	// the child frame in the parent frame
+	m := urdfFrame(parentAxis).Mul(urdfFrame(childAxis).Inverse())
+	o := m.MulPosition(sdf.V3{})
+	c0 := m.MulPosition(sdf.V3{1, 0, 0}).Sub(o)
+	c1 := m.MulPosition(sdf.V3{0, 1, 0}).Sub(o)
+	c2 := m.MulPosition(sdf.V3{0, 0, 1}).Sub(o)
+	// R = Rz(yaw) * Ry(pitch) * Rx(roll)
+	rpy := sdf.V3{
+		math.Atan2(c1.Z, c2.Z),
+		math.Asin(sdf.Clamp(-c0.Z, -1, 1)),
+		math.Atan2(c0.Y, c0.X),
+	}
+	j := u.AddJoint(name, jointType, parent, child, urdfSnap(o))
+	j.RPY = urdfSnap(rpy)
+	j.Axis = childAxis.Direction.Normalize()
+	return j, nil
+}
+
+// urdfSnap rounds the components of a vector that are zero to within rounding errors.
+func urdfSnap(v sdf.V3) sdf.V3 {
+	snap := func(x float64) float64 {
+		if math.Abs(x) < 1e-12 {
+			return 0
+		}
+		return x
+	}
+	return sdf.V3{snap(v.X), snap(v.Y), snap(v.Z)}
+}
+
+//-----------------------------------------------------------------------------
+// XML encoding
+
+type urdfPose struct {
+	XYZ string `xml:"xyz,attr"`
+	RPY string `xml:"rpy,attr"`
+}
+
+type urdfMass struct {
+	Value string `xml:"value,attr"`
+}
+
+type urdfInertia struct {
+	Ixx string `xml:"ixx,attr"`
+	Ixy string `xml:"ixy,attr"`
+	Ixz string `xml:"ixz,attr"`
+	Iyy string `xml:"iyy,attr"`
+	Iyz string `xml:"iyz,attr"`
+	Izz string `xml:"izz,attr"`
+}
+
+type urdfInertial struct {
+	Origin  urdfPose    `xml:"origin"`
+	Mass    urdfMass    `xml:"mass"`
+	Inertia urdfInertia `xml:"inertia"`
+}
+
+type urdfMesh struct {
+	Filename string `xml:"filename,attr"`
+	Scale    string `xml:"scale,attr"`
+}
+
+type urdfGeometry struct {
+	Mesh urdfMesh `xml:"mesh"`
+}
+
+type urdfVisual struct {
+	Origin   urdfPose     `xml:"origin"`
+	Geometry urdfGeometry `xml:"geometry"`
+}
+
+type urdfLinkXML struct {
+	Name      string        `xml:"name,attr"`
+	Inertial  *urdfInertial `xml:"inertial,omitempty"`
+	Visual    urdfVisual    `xml:"visual"`
+	Collision urdfVisual    `xml:"collision"`
+}
+
+type urdfName struct {
+	Link string `xml:"link,attr"`
+}
+
+type urdfAxis struct {
+	XYZ string `xml:"xyz,attr"`
+}
+
+type urdfLimit struct {
+	Lower    string `xml:"lower,attr"`
+	Upper    string `xml:"upper,attr"`
+	Effort   string `xml:"effort,attr"`
+	Velocity string `xml:"velocity,attr"`
+}
+
+type urdfJointXML struct {
+	Name   string     `xml:"name,attr"`
+	Type   string     `xml:"type,attr"`
+	Origin urdfPose   `xml:"origin"`
+	Parent urdfName   `xml:"parent"`
+	Child  urdfName   `xml:"child"`
+	Axis   *urdfAxis  `xml:"axis,omitempty"`
+	Limit  *urdfLimit `xml:"limit,omitempty"`
+}
+
+type urdfRobotXML struct {
+	XMLName xml.Name       `xml:"robot"`
+	Name    string         `xml:"name,attr"`
+	Links   []urdfLinkXML  `xml:"link"`
+	Joints  []urdfJointXML `xml:"joint"`
+}
+
+func urdfFloat(x float64) string {
+	return fmt.Sprintf("%g", x)
+}
+
+func urdfV3(v sdf.V3) string {
+	return fmt.Sprintf("%g %g %g", v.X, v.Y, v.Z)
+}
+
+//-----------------------------------------------------------------------------
+
+// validate checks the link and joint names.
+func (u *URDF) validate() error {
+	if u.Scale <= 0 {
+		return sdf.ErrMsg("Scale <= 0")
+	}
+	links := make(map[string]bool)
+	for _, l := range u.Links {
+		if l.Name == "" {
+			return sdf.ErrMsg("link name is empty")
+		}
+		if links[l.Name] {
+			return sdf.ErrMsg(fmt.Sprintf("duplicate link name \"%s\"", l.Name))
+		}
+		if l.SDF == nil {
+			return sdf.ErrMsg(fmt.Sprintf("link \"%s\" has no geometry", l.Name))
+		}
+		links[l.Name] = true
+	}
+	for _, j := range u.Joints {
+		if !links[j.Parent] {
+			return sdf.ErrMsg(fmt.Sprintf("joint \"%s\" parent link \"%s\" not found", j.Name, j.Parent))
+		}
+		if !links[j.Child] {
+			return sdf.ErrMsg(fmt.Sprintf("joint \"%s\" child link \"%s\" not found", j.Name, j.Child))
+		}
+	}
+	return nil
+}
+
+// Save renders each link to an STL file and writes the URDF file into a directory.
+func (u *URDF) Save(dir string, meshCells int, r Render3) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+
+	robot := urdfRobotXML{Name: u.Name}
+	k := u.Scale
+	scale := urdfV3(sdf.V3{k, k, k})
+	zero := urdfPose{XYZ: "0 0 0", RPY: "0 0 0"}
+
+	for _, l := range u.Links {
+		mesh := ToTriangles(l.SDF, meshCells, r)
+		fname := l.Name + ".stl"
+		if err := SaveSTL(filepath.Join(dir, fname), mesh); err != nil {
+			return err
+		}
+		geometry := urdfGeometry{urdfMesh{Filename: fname, Scale: scale}}
+		lx := urdfLinkXML{
+			Name:      l.Name,
+			Visual:    urdfVisual{zero, geometry},
+			Collision: urdfVisual{zero, geometry},
+		}
+		if l.Density > 0 {
+			mp, err := MeshMassProperties(mesh, l.Density)
+			if err != nil {
+				return fmt.Errorf("link \"%s\": %s", l.Name, err)
+			}
+			// convert model units to SI units
+			k3 := k * k * k
+			k5 := k3 * k * k
+			i := mp.Inertia.MulScalar(k5)
+			p := mp.Product.MulScalar(k5)
+			lx.Inertial = &urdfInertial{
+				Origin: urdfPose{XYZ: urdfV3(mp.Center.MulScalar(k)), RPY: "0 0 0"},
+				Mass:   urdfMass{urdfFloat(mp.Mass * k3)},
+				Inertia: urdfInertia{
+					Ixx: urdfFloat(i.X), Iyy: urdfFloat(i.Y), Izz: urdfFloat(i.Z),
+					Ixy: urdfFloat(p.X), Iyz: urdfFloat(p.Y), Ixz: urdfFloat(p.Z),
+				},
+			}
+		}
+		robot.Links = append(robot.Links, lx)
+	}
+
+	for _, j := range u.Joints {
+		jx := urdfJointXML{
+			Name:   j.Name,
+			Type:   j.Type,
+			Origin: urdfPose{XYZ: urdfV3(j.Origin.MulScalar(k)), RPY: urdfV3(j.RPY)},
+			Parent: urdfName{j.Parent},
+			Child:  urdfName{j.Child},
+		}
+		if j.Type != "fixed" && j.Type != "floating" {
+			jx.Axis = &urdfAxis{urdfV3(j.Axis.Normalize())}
+		}
+		if j.Type == "revolute" || j.Type == "prismatic" {
+			lower, upper, velocity := j.Lower, j.Upper, j.Velocity
+			if j.Type == "prismatic" {
+				lower *= k
+				upper *= k
+				velocity *= k
+			}
+			jx.Limit = &urdfLimit{
+				Lower:    urdfFloat(lower),
+				Upper:    urdfFloat(upper),
+				Effort:   urdfFloat(j.Effort),
+				Velocity: urdfFloat(velocity),
+			}
+		}
+		robot.Joints = append(robot.Joints, jx)
+	}
+
+	f, err := os.Create(filepath.Join(dir, u.Name+".urdf"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	if err := enc.Encode(&robot); err != nil {
+		return err
+	}
+	_, err = f.WriteString("\n")
+	return err
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,108 @@
+//-----------------------------------------------------------------------------
+/*
+
+URDF Export Tests
+
+*/
+//-----------------------------------------------------------------------------
+
+package render_test
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deadsy/sdfx/render"
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+const urdfJoints = `  <joint name="hinge" type="revolute">
+    <origin xyz="0 0 0.001" rpy="0 0 0"></origin>
+    <parent link="base"></parent>
+    <child link="arm"></child>
+    <axis xyz="0 0 1"></axis>
+    <limit lower="-1" upper="1" effort="10" velocity="2"></limit>
+  </joint>
+  <joint name="slide" type="prismatic">
+    <origin xyz="0.0005 0 0" rpy="0 1.5707963267948966 0"></origin>
+    <parent link="base"></parent>
+    <child link="slider"></child>
+    <axis xyz="0 0 1"></axis>
+    <limit lower="0" upper="0.01" effort="5" velocity="0.05"></limit>
+  </joint>`
+
+func Test_URDF(t *testing.T) {
+	cube, _ := sdf.Box3D(sdf.V3{1, 1, 1}, 0)
+
+	// mass properties of a unit cube
+	tris := render.ToTriangles(cube, 20, &render.MarchingCubesUniform{})
+	mp, err := render.MeshMassProperties(tris, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the edges are rounded by the mesh
+	if math.Abs(mp.Volume-1) > 5e-3 || math.Abs(mp.Mass-2) > 1e-2 {
+		t.Errorf("expected volume 1, mass 2, actual %g %g", mp.Volume, mp.Mass)
+	}
+	if mp.Center.Length() > 1e-6 {
+		t.Errorf("expected center of mass 0, actual %v", mp.Center)
+	}
+	// I = m (a^2 + b^2) / 12
+	if !mp.Inertia.Equals(sdf.V3{1, 1, 1}.MulScalar(2.0/6), 5e-3) || mp.Product.Length() > 1e-6 {
+		t.Errorf("expected inertia %g, actual %v %v", 2.0/6, mp.Inertia, mp.Product)
+	}
+
+	// joints from assembly constraints, between 10 mm cubes
+	link := sdf.Transform3D(cube, sdf.Scale3d(sdf.V3{10, 10, 10}))
+	u := render.NewURDF("robot")
+	u.AddLink("base", link, 1000)
+	u.AddLink("arm", link, 1000)
+	u.AddLink("slider", link, 1000)
+	hinge, err := u.AddMate("hinge", "revolute", "base", "arm",
+		render.URDFAxis{sdf.V3{0, 0, 0.5}, sdf.V3{0, 0, 1}}, render.URDFAxis{sdf.V3{0, 0, -0.5}, sdf.V3{0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hinge.Lower, hinge.Upper, hinge.Effort, hinge.Velocity = -1, 1, 10, 2
+	slide, err := u.AddMate("slide", "prismatic", "base", "slider",
+		render.URDFAxis{sdf.V3{0.5, 0, 0}, sdf.V3{1, 0, 0}}, render.URDFAxis{sdf.V3{}, sdf.V3{0, 0, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slide.Upper, slide.Effort, slide.Velocity = 10, 5, 50
+	if _, err := u.AddMate("bad", "planar", "base", "arm", render.URDFAxis{}, render.URDFAxis{}); err == nil {
+		t.Error("expected an error for a mate without an axis")
+	}
+
+	dir, err := ioutil.TempDir("", "urdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := u.Save(dir, 20, &render.MarchingCubesUniform{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "robot.urdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := string(b)
+	i, j := strings.Index(x, "  <joint"), strings.LastIndex(x, "</joint>")
+	if i < 0 || j < 0 || x[i:j+len("</joint>")] != urdfJoints {
+		t.Errorf("expected joints\n%s\nactual\n%s", urdfJoints, x)
+	}
+	// the link mass in SI units
+	i = strings.Index(x, `<mass value="`) + len(`<mass value="`)
+	if m, err := strconv.ParseFloat(x[i:i+strings.Index(x[i:], `"`)], 64); err != nil || math.Abs(m-1e-3) > 1e-5 {
+		t.Errorf("expected a link mass of 1e-3 kg, actual %g %v", m, err)
+	}
+}
+
+//-----------------------------------------------------------------------------
@@ -4,11 +4,32 @@
 
 package render
 
+import "github.com/deadsy/sdfx/sdf"
+
 //-----------------------------------------------------------------------------
 
 const tolerance = 1e-9
 const epsilon = 1e-12
 
+// modelTolerances returns t, or the tolerances for the SDF3 if t is nil.
+func modelTolerances(s sdf.SDF3, t *sdf.Tolerances) sdf.Tolerances {
+	if t != nil {
+		return *t
+	}
+	return sdf.ModelTolerances3(s)
+}
+
+// v3Less returns true if a is before b in x, y, z order.
+func v3Less(a, b sdf.V3) bool {
+	if a.X != b.X {
+		return a.X < b.X
+	}
+	if a.Y != b.Y {
+		return a.Y < b.Y
+	}
+	return a.Z < b.Z
+}
+
 //-----------------------------------------------------------------------------
 
 // nextCombination generates the next k-length combination of 0 to n-1. (returns false when done).
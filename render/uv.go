@@ -0,0 +1,353 @@
+//-----------------------------------------------------------------------------
+/*
+
+UV Generation
+
+Texture coordinates for indexed meshes:
+
+Box: each triangle is projected onto the bounding box plane facing its normal.
+Cylinder/Sphere: angle around the z axis and height/angle from the z axis.
+Triangles across the seam have u > 1 for a repeating texture.
+Charts: triangles are grown into charts of similar normals (within an angle),
+each chart is projected along its normal and the charts are packed into the
+unit square.
+
+Vertices are split where the texture coordinates are discontinuous (seams).
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+)
+
+//-----------------------------------------------------------------------------
+
+// UVProjection is the method used to generate texture coordinates.
+type UVProjection int
+
+// UV projections.
+const (
+	UVBox      UVProjection = iota // box projection
+	UVCylinder                     // cylindrical projection about the z axis
+	UVSphere                       // spherical projection about the bounding box center
+	UVCharts                       // charts of similar normals, packed into the unit square
+)
+
+// uvChartAngle is the default maximum normal deviation within a chart (radians).
+const uvChartAngle = 45 * sdf.Pi / 180
+
+// uvChartMargin is the space between packed charts (fraction of the chart size).
+const uvChartMargin = 0.02
+
+// GenerateUVs sets the texture coordinates of a mesh (UVs), splitting the vertices at the seams.
+// The chart angle is the maximum deviation of the normals within a chart (UVCharts only, 0: 45 degrees).
+func (m *Mesh) GenerateUVs(projection UVProjection, chartAngle float64) error {
+	var uv [][3]sdf.V2
+	switch projection {
+	case UVBox:
+		uv = m.boxUVs()
+	case UVCylinder:
+		uv = m.angularUVs(false)
+	case UVSphere:
+		uv = m.angularUVs(true)
+	case UVCharts:
+		if chartAngle == 0 {
+			chartAngle = uvChartAngle
+		}
+		if chartAngle < 0 || chartAngle >= sdf.Pi/2 {
+			return sdf.ErrMsg("chart angle must be between 0 and 90 degrees")
+		}
+		uv = m.chartUVs(chartAngle)
+	default:
+		return sdf.ErrMsg("unknown uv projection")
+	}
+	m.splitUVs(uv)
+	return nil
+}
+
+// faceNormal returns the normal of a mesh face.
+func (m *Mesh) faceNormal(f [3]int) sdf.V3 {
+	v0, v1, v2 := m.Vertices[f[0]], m.Vertices[f[1]], m.Vertices[f[2]]
+	return v1.Sub(v0).Cross(v2.Sub(v0)).Normalize()
+}
+
+// faceNormals returns the normals of the mesh faces.
+func (m *Mesh) faceNormals() []sdf.V3 {
+	normals := make([]sdf.V3, len(m.Faces))
+	for i, f := range m.Faces {
+		normals[i] = m.faceNormal(f)
+	}
+	return normals
+}
+
+// growRegions partitions the mesh faces into connected regions (through shared edges) with
+// normals within a limit (cosine of the angle) of the normal of the region seed.
+// The seeds are the unassigned faces in order (nil: index order).
+func (m *Mesh) growRegions(normals []sdf.V3, order []int, cosLimit float64) [][]int {
+	type edge [2]int
+	edgeOf := func(f [3]int, j int) edge {
+		a, b := f[j], f[(j+1)%3]
+		if a > b {
+			a, b = b, a
+		}
+		return edge{a, b}
+	}
+	edgeFaces := make(map[edge][]int)
+	for i, f := range m.Faces {
+		for j := 0; j < 3; j++ {
+			e := edgeOf(f, j)
+			edgeFaces[e] = append(edgeFaces[e], i)
+		}
+	}
+	if order == nil {
+		order = make([]int, len(m.Faces))
+		for i := range order {
+			order[i] = i
+		}
+	}
+	assigned := make([]bool, len(m.Faces))
+	var regions [][]int
+	for _, seed := range order {
+		if assigned[seed] {
+			continue
+		}
+		n := normals[seed]
+		assigned[seed] = true
+		var region []int
+		queue := []int{seed}
+		for len(queue) != 0 {
+			i := queue[0]
+			queue = queue[1:]
+			region = append(region, i)
+			for j := 0; j < 3; j++ {
+				for _, k := range edgeFaces[edgeOf(m.Faces[i], j)] {
+					if !assigned[k] && normals[k].Dot(n) >= cosLimit {
+						assigned[k] = true
+						queue = append(queue, k)
+					}
+				}
+			}
+		}
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// bounds returns the bounding box of the mesh vertices.
+func (m *Mesh) bounds() sdf.Box3 {
+	if len(m.Vertices) == 0 {
+		return sdf.Box3{}
+	}
+	return sdf.Box3{sdf.V3Set(m.Vertices).Min(), sdf.V3Set(m.Vertices).Max()}
+}
+
+//-----------------------------------------------------------------------------
+
+func (m *Mesh) boxUVs() [][3]sdf.V2 {
+	bb := m.bounds()
+	size := bb.Size().MaxComponent()
+	uv := make([][3]sdf.V2, len(m.Faces))
+	for i, f := range m.Faces {
+		n := m.faceNormal(f).Abs()
+		for j, k := range f {
+			p := m.Vertices[k].Sub(bb.Min).DivScalar(size)
+			switch {
+			case n.X >= n.Y && n.X >= n.Z:
+				uv[i][j] = sdf.V2{p.Y, p.Z}
+			case n.Y >= n.Z:
+				uv[i][j] = sdf.V2{p.X, p.Z}
+			default:
+				uv[i][j] = sdf.V2{p.X, p.Y}
+			}
+		}
+	}
+	return uv
+}
+
+func (m *Mesh) angularUVs(sphere bool) [][3]sdf.V2 {
+	bb := m.bounds()
+	c := bb.Center()
+	uv := make([][3]sdf.V2, len(m.Faces))
+	for i, f := range m.Faces {
+		for j, k := range f {
+			p := m.Vertices[k].Sub(c)
+			u := math.Atan2(p.Y, p.X)/(2*sdf.Pi) + 0.5
+			var v float64
+			if sphere {
+				v = 1 - math.Acos(sdf.Clamp(p.Z/p.Length(), -1, 1))/sdf.Pi
+			} else {
+				v = (m.Vertices[k].Z - bb.Min.Z) / math.Max(bb.Size().Z, 1e-300)
+			}
+			uv[i][j] = sdf.V2{u, v}
+		}
+		// triangles across the seam use u > 1 for the corners near u = 0
+		lo := math.Min(uv[i][0].X, math.Min(uv[i][1].X, uv[i][2].X))
+		hi := math.Max(uv[i][0].X, math.Max(uv[i][1].X, uv[i][2].X))
+		if hi-lo > 0.5 {
+			for j := range uv[i] {
+				if uv[i][j].X < 0.5 {
+					uv[i][j].X++
+				}
+			}
+		}
+	}
+	return uv
+}
+
+//-----------------------------------------------------------------------------
+
+// uvChart is a group of faces projected onto a plane.
+type uvChart struct {
+	faces []int
+	uv    [][3]sdf.V2
+	bb    sdf.Box2
+}
+
+func (m *Mesh) chartUVs(maxAngle float64) [][3]sdf.V2 {
+	normals := m.faceNormals()
+	var charts []*uvChart
+	for _, faces := range m.growRegions(normals, nil, math.Cos(maxAngle)) {
+		c := &uvChart{faces: faces}
+		n := normals[faces[0]]
+		// project the chart onto the plane of the seed normal
+		u := n.Cross(leastAxis(n)).Normalize()
+		v := n.Cross(u)
+		c.uv = make([][3]sdf.V2, len(c.faces))
+		for j, i := range c.faces {
+			for k, vi := range m.Faces[i] {
+				p := m.Vertices[vi]
+				c.uv[j][k] = sdf.V2{p.Dot(u), p.Dot(v)}
+			}
+		}
+		corners := sdf.V2Set(flattenUVs(c.uv))
+		c.bb = sdf.Box2{corners.Min(), corners.Max()}
+		charts = append(charts, c)
+	}
+	size := packCharts(charts)
+	uv := make([][3]sdf.V2, len(m.Faces))
+	for _, c := range charts {
+		for j, i := range c.faces {
+			for k := range uv[i] {
+				uv[i][k] = c.uv[j][k].DivScalar(size)
+			}
+		}
+	}
+	return uv
+}
+
+// leastAxis returns the unit axis least aligned with a vector.
+func leastAxis(n sdf.V3) sdf.V3 {
+	a := n.Abs()
+	switch {
+	case a.X <= a.Y && a.X <= a.Z:
+		return sdf.V3{1, 0, 0}
+	case a.Y <= a.Z:
+		return sdf.V3{0, 1, 0}
+	}
+	return sdf.V3{0, 0, 1}
+}
+
+// flattenUVs returns the texture coordinates of the face corners.
+func flattenUVs(uv [][3]sdf.V2) []sdf.V2 {
+	p := make([]sdf.V2, 0, 3*len(uv))
+	for _, t := range uv {
+		p = append(p, t[:]...)
+	}
+	return p
+}
+
+// packCharts moves the charts to rows (tallest first) in a square, returning its size.
+func packCharts(charts []*uvChart) float64 {
+	var area, margin float64
+	for _, c := range charts {
+		s := c.bb.Size()
+		area += s.X * s.Y
+		margin = math.Max(margin, s.MaxComponent())
+	}
+	margin *= uvChartMargin
+	width := math.Sqrt(area) * 1.2
+	order := make([]*uvChart, len(charts))
+	copy(order, charts)
+	sort.SliceStable(order, func(i, j int) bool { return order[i].bb.Size().Y > order[j].bb.Size().Y })
+	var x, y, rowHeight, size float64
+	for _, c := range order {
+		s := c.bb.Size()
+		if x > 0 && x+s.X > width {
+			x, y = 0, y+rowHeight+margin
+			rowHeight = 0
+		}
+		ofs := sdf.V2{x, y}.Sub(c.bb.Min)
+		for j := range c.uv {
+			for k := range c.uv[j] {
+				c.uv[j][k] = c.uv[j][k].Add(ofs)
+			}
+		}
+		x += s.X + margin
+		rowHeight = math.Max(rowHeight, s.Y)
+		size = math.Max(size, math.Max(x, y+rowHeight))
+	}
+	if size == 0 {
+		return 1
+	}
+	return size
+}
+
+//-----------------------------------------------------------------------------
+
+// splitUVs sets the texture coordinates of the face corners, splitting the vertices
+// with more than one texture coordinate.
+func (m *Mesh) splitUVs(uv [][3]sdf.V2) {
+	type key struct {
+		vertex int
+		uv     sdf.V2
+	}
+	index := make(map[key]int)
+	var vertices []sdf.V3
+	var uvs []sdf.V2
+	var source []int
+	for i, f := range m.Faces {
+		for j, vi := range f {
+			k := key{vi, uv[i][j]}
+			n, ok := index[k]
+			if !ok {
+				n = len(vertices)
+				index[k] = n
+				vertices = append(vertices, m.Vertices[vi])
+				uvs = append(uvs, uv[i][j])
+				source = append(source, vi)
+			}
+			m.Faces[i][j] = n
+		}
+	}
+	for name, values := range m.Attributes {
+		split := make([]float64, len(source))
+		for i, vi := range source {
+			split[i] = values[vi]
+		}
+		m.Attributes[name] = split
+	}
+	if m.Colors != nil {
+		split := make([]color.RGBA, len(source))
+		for i, vi := range source {
+			split[i] = m.Colors[vi]
+		}
+		m.Colors = split
+	}
+	if m.Normals != nil {
+		split := make([]sdf.V3, len(source))
+		for i, vi := range source {
+			split[i] = m.Normals[vi]
+		}
+		m.Normals = split
+	}
+	m.Vertices, m.UVs = vertices, uvs
+}
+
+//-----------------------------------------------------------------------------
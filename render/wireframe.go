@@ -0,0 +1,237 @@
+//-----------------------------------------------------------------------------
+/*
+
+Wireframes
+
+Extract the sharp feature edges and the silhouette curves of an indexed
+mesh as 3d polylines, e.g. for wire bending templates or stylized renders.
+
+An edge is sharp when the dihedral angle between its faces (the angle
+between the face normals) is larger than the feature angle. Edges with a
+single face (open meshes) or more than two faces are sharp. Dual
+contouring keeps the sharp features of a model, so its meshes give clean
+feature edges. A silhouette edge joins a face facing the viewer and a
+face facing away (for a view direction).
+
+The edges are chained into polylines through the vertices joining two
+edges. Closed polylines end with their first vertex.
+
+*/
+//-----------------------------------------------------------------------------
+
+package render
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/deadsy/sdfx/sdf"
+	"github.com/yofu/dxf"
+)
+
+//-----------------------------------------------------------------------------
+
+// WireframeConfig sets the extraction of the edges of a mesh.
+type WireframeConfig struct {
+	Angle float64 // minimum dihedral angle of a sharp edge (radians, 0: 30 degrees)
+	View  sdf.V3  // view direction for the silhouette curves (zero: no silhouettes)
+}
+
+// Wireframe is the sharp edges and silhouette curves of a mesh.
+type Wireframe struct {
+	Sharp      [][]sdf.V3 // sharp edge polylines
+	Silhouette [][]sdf.V3 // silhouette polylines
+}
+
+// wireframeAngle is the default dihedral angle of a sharp edge.
+const wireframeAngle = 30 * sdf.Pi / 180
+
+//-----------------------------------------------------------------------------
+
+// MeshWireframe extracts the sharp edges and silhouette curves of an indexed mesh.
+func MeshWireframe(m *Mesh, cfg *WireframeConfig) (*Wireframe, error) {
+	if cfg == nil {
+		cfg = &WireframeConfig{}
+	}
+	angle := cfg.Angle
+	if angle == 0 {
+		angle = wireframeAngle
+	}
+	if angle < 0 || angle >= sdf.Pi {
+		return nil, sdf.ErrMsg("feature angle must be between 0 and 180 degrees")
+	}
+	cosLimit := math.Cos(angle)
+	view := cfg.View
+	if view != (sdf.V3{}) {
+		view = view.Normalize()
+	}
+
+	// the faces of each edge
+	edgeFaces := make(map[[2]int][]int)
+	for i, f := range m.Faces {
+		for j := 0; j < 3; j++ {
+			a, b := f[j], f[(j+1)%3]
+			if a == b {
+				continue
+			}
+			if a > b {
+				a, b = b, a
+			}
+			edgeFaces[[2]int{a, b}] = append(edgeFaces[[2]int{a, b}], i)
+		}
+	}
+	edges := make([][2]int, 0, len(edgeFaces))
+	for e := range edgeFaces {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i][0] < edges[j][0] || (edges[i][0] == edges[j][0] && edges[i][1] < edges[j][1])
+	})
+
+	normals := m.faceNormals()
+	var sharp, silhouette [][2]int
+	for _, e := range edges {
+		faces := edgeFaces[e]
+		if len(faces) != 2 {
+			sharp = append(sharp, e)
+			continue
+		}
+		n0, n1 := normals[faces[0]], normals[faces[1]]
+		if n0.Dot(n1) < cosLimit {
+			sharp = append(sharp, e)
+		}
+		if view != (sdf.V3{}) && (n0.Dot(view) < 0) != (n1.Dot(view) < 0) {
+			silhouette = append(silhouette, e)
+		}
+	}
+	return &Wireframe{
+		Sharp:      m.chainEdges(sharp),
+		Silhouette: m.chainEdges(silhouette),
+	}, nil
+}
+
+// RenderWireframe renders an SDF3 (see RenderIndexed) and extracts the edges of the mesh.
+func RenderWireframe(s sdf.SDF3, meshCells int, r Render3, cfg *WireframeConfig) (*Wireframe, error) {
+	m, err := RenderIndexed(context.Background(), s, meshCells, r)
+	if err != nil {
+		return nil, err
+	}
+	return MeshWireframe(m, cfg)
+}
+
+// chainEdges joins edges (in order) into polylines through the vertices of two edges.
+// Open polylines start at the other vertices, the remaining edges are closed loops.
+func (m *Mesh) chainEdges(edges [][2]int) [][]sdf.V3 {
+	adjacent := make(map[int][]int)
+	for i, e := range edges {
+		adjacent[e[0]] = append(adjacent[e[0]], i)
+		adjacent[e[1]] = append(adjacent[e[1]], i)
+	}
+	used := make([]bool, len(edges))
+	// chain walks from vertex v along edge i until the chain ends or closes
+	chain := func(v, i int) []sdf.V3 {
+		line := []sdf.V3{m.Vertices[v]}
+		for {
+			used[i] = true
+			e := edges[i]
+			if e[0] == v {
+				v = e[1]
+			} else {
+				v = e[0]
+			}
+			line = append(line, m.Vertices[v])
+			if len(adjacent[v]) != 2 {
+				return line
+			}
+			next := adjacent[v][0]
+			if next == i {
+				next = adjacent[v][1]
+			}
+			if used[next] {
+				return line
+			}
+			i = next
+		}
+	}
+	var lines [][]sdf.V3
+	for pass := 0; pass < 2; pass++ {
+		for i, e := range edges {
+			if used[i] {
+				continue
+			}
+			for _, v := range e {
+				// the first pass starts at the chain ends
+				if !used[i] && (pass == 1 || len(adjacent[v]) != 2) {
+					lines = append(lines, chain(v, i))
+				}
+			}
+		}
+	}
+	return lines
+}
+
+//-----------------------------------------------------------------------------
+
+// wireframeLayer is the polylines of a wireframe layer (DXF layer, OBJ group).
+type wireframeLayer struct {
+	name  string
+	lines [][]sdf.V3
+}
+
+// layers returns the layers of a wireframe.
+func (w *Wireframe) layers() []wireframeLayer {
+	return []wireframeLayer{
+		{"Sharp", w.Sharp},
+		{"Silhouette", w.Silhouette},
+	}
+}
+
+// SaveDXF writes the wireframe to a DXF file as 3d lines (a layer for the sharp edges and the silhouettes).
+func (w *Wireframe) SaveDXF(path string) error {
+	d := dxf.NewDrawing()
+	for _, l := range w.layers() {
+		if _, err := d.AddLayer(l.name, dxf.DefaultColor, dxf.DefaultLineType, true); err != nil {
+			return err
+		}
+		for _, line := range l.lines {
+			for i := 1; i < len(line); i++ {
+				p0, p1 := line[i-1], line[i]
+				d.Line(p0.X, p0.Y, p0.Z, p1.X, p1.Y, p1.Z)
+			}
+		}
+	}
+	return d.SaveAs(path)
+}
+
+// SaveOBJ writes the wireframe to an OBJ file as polylines (a group for the sharp edges and the silhouettes).
+func (w *Wireframe) SaveOBJ(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buf := bufio.NewWriter(file)
+	fmt.Fprintf(buf, "# sdfx wireframe\n")
+	base := 1
+	for _, l := range w.layers() {
+		fmt.Fprintf(buf, "g %s\n", l.name)
+		for _, line := range l.lines {
+			for _, v := range line {
+				fmt.Fprintf(buf, "v %g %g %g\n", v.X, v.Y, v.Z)
+			}
+			fmt.Fprintf(buf, "l")
+			for i := range line {
+				fmt.Fprintf(buf, " %d", base+i)
+			}
+			fmt.Fprintf(buf, "\n")
+			base += len(line)
+		}
+	}
+	return buf.Flush()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,103 @@
+//-----------------------------------------------------------------------------
+/*
+
+Barrel and Pincushion Distortion
+
+Scale the xy sections of an SDF3 (about the z-axis through the center of
+its bounding box) with height: a barrel bulges in the middle, a pincushion
+is pinched in the middle. The section scale is
+
+	s(z) = 1 + k * (1 - t^2), t = -1..1 over the height of the bounding box
+
+with k > 0 for a barrel and -1 < k < 0 for a pincushion.
+
+The deformation stretches the field, so the value is divided by the
+largest stretch (the norm of the Jacobian of the point mapping) within
+the bounding box, which makes it a distance bound again.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// BarrelSDF3 is a barrel or pincushion distorted SDF3.
+type BarrelSDF3 struct {
+	sdf    SDF3
+	k      float64 // scale change at the middle
+	center V2      // xy scaling center
+	z0, z1 float64 // height range
+	invL   float64 // 1 / Lipschitz bound of the mapping
+	bb     Box3
+}
+
+// Barrel3D distorts an SDF3 so its xy sections are scaled by 1 + k at the middle of
+// its height, and unscaled at the top and bottom (k > 0: barrel, -1 < k < 0: pincushion).
+func Barrel3D(sdf SDF3, k float64) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if k <= -1 {
+		return nil, ErrMsg("k <= -1")
+	}
+	bb := sdf.BoundingBox()
+	if bb.Max.Z <= bb.Min.Z {
+		return nil, ErrMsg("no height")
+	}
+	s := BarrelSDF3{}
+	s.sdf = sdf
+	s.k = k
+	c := bb.Center()
+	s.center = V2{c.X, c.Y}
+	s.z0, s.z1 = bb.Min.Z, bb.Max.Z
+	smin, smax := math.Min(1, 1+k), math.Max(1, 1+k)
+	half := bb.Size().MulScalar(0.5 * smax)
+	s.bb = Box3{V3{c.X - half.X, c.Y - half.Y, bb.Min.Z}, V3{c.X + half.X, c.Y + half.Y, bb.Max.Z}}
+	// The mapping q = c + (p - c) / s(z) has the Jacobian [[1/s 0 -x*s'/s^2] [0 1/s -y*s'/s^2] [0 0 1]],
+	// with the largest singular value increasing with 1/s and r*|s'|/s^2 (r is the radius from the axis).
+	a := 1 / smin
+	g := V2{half.X, half.Y}.Length() * (4 * math.Abs(k) / (s.z1 - s.z0)) / (smin * smin)
+	t := a*a + g*g + 1
+	s.invL = 1 / math.Sqrt((t+math.Sqrt(t*t-4*a*a))/2)
+	return &s, nil
+}
+
+// Pincushion3D distorts an SDF3 so its xy sections are scaled by 1 - k at the middle of
+// its height, and unscaled at the top and bottom (0 < k < 1).
+func Pincushion3D(sdf SDF3, k float64) (SDF3, error) {
+	if k >= 1 {
+		return nil, ErrMsg("k >= 1")
+	}
+	return Barrel3D(sdf, -k)
+}
+
+// scale returns the section scale at height z (constant beyond the height range).
+func (s *BarrelSDF3) scale(z float64) float64 {
+	t := 2*(Clamp(z, s.z0, s.z1)-s.z0)/(s.z1-s.z0) - 1
+	return 1 + s.k*(1-t*t)
+}
+
+// Evaluate returns the minimum distance to a barrel distorted SDF3.
+func (s *BarrelSDF3) Evaluate(p V3) float64 {
+	// The Lipschitz bound only holds within the bounding box. Outside it use the point
+	// nearest in the box (that isn't further from the surface), or the distance to the box.
+	b := p.Clamp(s.bb.Min, s.bb.Max)
+	q := V2{b.X, b.Y}.Sub(s.center).DivScalar(s.scale(b.Z)).Add(s.center)
+	d := s.sdf.Evaluate(V3{q.X, q.Y, b.Z}) * s.invL
+	if b != p {
+		d = math.Max(d, p.Sub(b).Length())
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a barrel distorted SDF3.
+func (s *BarrelSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+func (s *BarrelSDF3) children() []interface{} { return []interface{}{&s.sdf} }
+
+//-----------------------------------------------------------------------------
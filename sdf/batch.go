@@ -0,0 +1,36 @@
+//-----------------------------------------------------------------------------
+/*
+
+Batch Evaluation
+
+SDF3s can evaluate many points in one call (e.g. vectorized or GPU backed
+SDFs), so renderers sampling large grids avoid the overhead of a call per
+point. Renderers sample with EvaluateN, which falls back to Evaluate for
+SDF3s without batch evaluation.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// SDF3Batch is implemented by SDF3s that evaluate many points in one call.
+type SDF3Batch interface {
+	// EvaluateN writes the values at the points to out (len(out) >= len(p)).
+	// It may be called concurrently.
+	EvaluateN(p []V3, out []float64)
+}
+
+// EvaluateN evaluates an SDF3 at a slice of points, with a single call if it implements SDF3Batch.
+func EvaluateN(s SDF3, p []V3, out []float64) {
+	if b, ok := s.(SDF3Batch); ok {
+		b.EvaluateN(p, out)
+		return
+	}
+	for i := range p {
+		out[i] = s.Evaluate(p[i])
+	}
+}
+
+//-----------------------------------------------------------------------------
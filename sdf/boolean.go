@@ -0,0 +1,102 @@
+//-----------------------------------------------------------------------------
+/*
+
+Boolean Operators
+
+Less common booleans:
+
+Xor3D: the symmetric difference, the parts of either SDF3 not in both.
+CommonShell3D: where the shells (of a thickness) around both surfaces
+overlap, e.g. the bonding region of two parts.
+MutualDifference3D/Partition3D: both subtractions of a pair (and their
+intersection) as separate SDF3s, e.g. a part and its cavity for a mold.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// XorSDF3 is the symmetric difference of two SDF3s.
+type XorSDF3 struct {
+	s0, s1 SDF3
+	bb     Box3
+}
+
+// Xor3D returns the symmetric difference of two SDF3s (in s0 or s1, but not both).
+func Xor3D(s0, s1 SDF3) SDF3 {
+	if s0 == nil {
+		return s1
+	}
+	if s1 == nil {
+		return s0
+	}
+	return &XorSDF3{s0, s1, s0.BoundingBox().Extend(s1.BoundingBox())}
+}
+
+// Evaluate returns the minimum distance to the symmetric difference.
+func (s *XorSDF3) Evaluate(p V3) float64 {
+	a, b := s.s0.Evaluate(p), s.s1.Evaluate(p)
+	return math.Max(math.Min(a, b), -math.Max(a, b))
+}
+
+// BoundingBox returns the bounding box of the symmetric difference.
+func (s *XorSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// CommonShellSDF3 is the overlap of the shells around the surfaces of two SDF3s.
+type CommonShellSDF3 struct {
+	s0, s1 SDF3
+	delta  float64 // half the shell thickness
+	bb     Box3
+}
+
+// CommonShell3D returns the region where the shells (of a thickness, centered on the
+// surfaces) of two SDF3s overlap, i.e. the points within thickness/2 of both surfaces.
+func CommonShell3D(s0, s1 SDF3, thickness float64) (SDF3, error) {
+	if s0 == nil || s1 == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if thickness <= 0 {
+		return nil, ErrMsg("thickness <= 0")
+	}
+	delta := thickness / 2
+	bb0 := s0.BoundingBox().Enlarge(V3{thickness, thickness, thickness})
+	bb1 := s1.BoundingBox().Enlarge(V3{thickness, thickness, thickness})
+	bb := Box3{bb0.Min.Max(bb1.Min), bb0.Max.Min(bb1.Max)}
+	if bb.Min.X > bb.Max.X || bb.Min.Y > bb.Max.Y || bb.Min.Z > bb.Max.Z {
+		return nil, ErrMsg("the shells don't overlap")
+	}
+	return &CommonShellSDF3{s0, s1, delta, bb}, nil
+}
+
+// Evaluate returns the minimum distance to the common shell.
+func (s *CommonShellSDF3) Evaluate(p V3) float64 {
+	return math.Max(math.Abs(s.s0.Evaluate(p)), math.Abs(s.s1.Evaluate(p))) - s.delta
+}
+
+// BoundingBox returns the bounding box of the common shell.
+func (s *CommonShellSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// MutualDifference3D returns both subtractions of two SDF3s, s0 - s1 and s1 - s0.
+func MutualDifference3D(s0, s1 SDF3) (SDF3, SDF3) {
+	return Difference3D(s0, s1), Difference3D(s1, s0)
+}
+
+// Partition3D splits two SDF3s into three disjoint parts: s0 - s1, the intersection and s1 - s0.
+func Partition3D(s0, s1 SDF3) []SDF3 {
+	a, b := MutualDifference3D(s0, s1)
+	return []SDF3{a, Intersect3D(s0, s1), b}
+}
+
+//-----------------------------------------------------------------------------
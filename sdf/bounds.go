@@ -0,0 +1,111 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bounding Box Estimation and Validation
+
+User SDFs don't always have a reliable bounding box. Far from an object
+the distance along a direction u behaves like a*(t - h(u)), where h(u) is
+the extent of the object along u and a is the slope of the field (1 for an
+exact SDF). Marching outward from a seed point and watching the estimate
+of h converge gives the extent along each axis.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// extent returns the extent of an SDF3 along a direction from a seed point.
+func extent(s SDF3, seed, u V3, t float64) (float64, error) {
+	// far away d(t) = a*t - b, where a is the slope of the field (1 for an exact SDF)
+	d0 := s.Evaluate(seed.Add(u.MulScalar(t)))
+	h0 := math.Inf(1)
+	scale := t
+	for i := 0; i < 64; i++ {
+		d1 := s.Evaluate(seed.Add(u.MulScalar(2 * t)))
+		if !isFinite(d1) {
+			break
+		}
+		a := (d1 - d0) / t
+		t *= 2
+		if a <= 0 {
+			// still within the object
+			d0 = d1
+			continue
+		}
+		h1 := t - d1/a
+		// The error in h halves with every doubling of t.
+		// Be well away from the object so plane-like fields near it don't fool the estimate.
+		dh := math.Abs(h1 - h0)
+		if dh <= 1e-9*t && t > 1e3*(scale+math.Abs(h1)) {
+			return h1 + 2*dh, nil
+		}
+		d0, h0 = d1, h1
+	}
+	return 0, ErrMsg(fmt.Sprintf("extent along %v did not converge", u))
+}
+
+// EstimateBoundingBox3 returns a conservative bounding box for an SDF3,
+// found by marching outwards from a seed point near or within the object.
+func EstimateBoundingBox3(s SDF3, seed V3) (Box3, error) {
+	// initial step
+	t := math.Abs(s.Evaluate(seed))
+	if t == 0 || !isFinite(t) {
+		t = 1
+	}
+	dirs := [6]V3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}, {-1, 0, 0}, {0, -1, 0}, {0, 0, -1}}
+	var h [6]float64
+	for i, u := range dirs {
+		var err error
+		h[i], err = extent(s, seed, u, t)
+		if err != nil {
+			return Box3{}, err
+		}
+	}
+	min := seed.Sub(V3{h[3], h[4], h[5]})
+	max := seed.Add(V3{h[0], h[1], h[2]})
+	if min.X > max.X || min.Y > max.Y || min.Z > max.Z {
+		return Box3{}, ErrMsg("empty bounding box")
+	}
+	return Box3{min, max}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// ValidateBoundingBox3 checks that the bounding box of an SDF3 doesn't clip its surface.
+// An n x n grid of points on each face of the box is tested; a point inside the object
+// means the surface extends beyond the box.
+func ValidateBoundingBox3(s SDF3, n int) error {
+	bb := s.BoundingBox()
+	size := bb.Size()
+	if n < 2 {
+		n = 2
+	}
+	k := 1.0 / float64(n-1)
+	for axis := 0; axis < 3; axis++ {
+		for _, side := range [2]float64{0, 1} {
+			for i := 0; i < n; i++ {
+				for j := 0; j < n; j++ {
+					// face coordinates
+					f := [3]float64{}
+					f[axis] = side
+					f[(axis+1)%3] = float64(i) * k
+					f[(axis+2)%3] = float64(j) * k
+					p := bb.Min.Add(size.Mul(V3{f[0], f[1], f[2]}))
+					if s.Evaluate(p) < 0 {
+						return ErrMsg(fmt.Sprintf("the bounding box %v clips the surface at %v", bb, p))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
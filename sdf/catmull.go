@@ -0,0 +1,88 @@
+//-----------------------------------------------------------------------------
+/*
+
+Catmull-Rom Splines
+
+Smooth curves that pass through a set of points, converted to cubic
+bezier curves. The alpha parameter selects the parameterisation:
+0 = uniform, 0.5 = centripetal (no cusps or self intersections within
+a segment), 1 = chordal.
+
+See: "On the Parameterization of Catmull-Rom Curves", Yuksel et al.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// catmullRomControl returns the bezier control point near p1 for the segment p1-p2
+// of a Catmull-Rom spline through p0, p1, p2.
+func catmullRomControl(p0, p1, p2 V2, alpha float64) V2 {
+	d1 := math.Pow(p1.Sub(p0).Length(), alpha)
+	d2 := math.Pow(p2.Sub(p1).Length(), alpha)
+	if d1 == 0 || d2 == 0 {
+		return p1
+	}
+	a := p2.MulScalar(d1 * d1)
+	b := p0.MulScalar(d2 * d2)
+	c := p1.MulScalar(2*d1*d1 + 3*d1*d2 + d2*d2)
+	return a.Sub(b).Add(c).DivScalar(3 * d1 * (d1 + d2))
+}
+
+// CatmullRomBezier returns a bezier curve through the points.
+// Open curves start and end at the first and last points.
+func CatmullRomBezier(p []V2, alpha float64, closed bool) (*Bezier, error) {
+	n := len(p)
+	if n < 2 || (closed && n < 3) {
+		return nil, ErrMsg("not enough points")
+	}
+	// point i, with wrap around (closed) or reflected end points (open)
+	pt := func(i int) V2 {
+		if closed {
+			return p[(i+n)%n]
+		}
+		if i < 0 {
+			return p[0].MulScalar(2).Sub(p[1])
+		}
+		if i >= n {
+			return p[n-1].MulScalar(2).Sub(p[n-2])
+		}
+		return p[i]
+	}
+	segs := n - 1
+	if closed {
+		segs = n
+	}
+	b := NewBezier()
+	for i := 0; i < segs; i++ {
+		p0, p1, p2, p3 := pt(i-1), pt(i), pt(i+1), pt(i+2)
+		b.AddV2(p1)
+		b.AddV2(catmullRomControl(p0, p1, p2, alpha)).Mid()
+		b.AddV2(catmullRomControl(p3, p2, p1, alpha)).Mid()
+	}
+	if closed {
+		b.Close()
+	} else {
+		b.AddV2(p[n-1])
+	}
+	return b, nil
+}
+
+// CatmullRom2D returns an SDF2 for a closed centripetal Catmull-Rom curve through the points.
+func CatmullRom2D(p []V2) (SDF2, error) {
+	b, err := CatmullRomBezier(p, 0.5, true)
+	if err != nil {
+		return nil, err
+	}
+	poly, err := b.Polygon()
+	if err != nil {
+		return nil, err
+	}
+	return Polygon2D(poly.Vertices())
+}
+
+//-----------------------------------------------------------------------------
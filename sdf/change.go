@@ -0,0 +1,100 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Changes
+
+Find the region of a model changed by an edit, e.g. a parameter tweak, so a
+renderer only has to re-sample that region. Two revisions of an SDF tree are
+compared node by node using node hashes (see ModelHash): unchanged subtrees
+are skipped, a node with the same parameters is descended into, and a node
+with different parameters (or type, or children) is the changed subtree.
+The captured values of closures (e.g. SetMin(RoundMin(k))) can't be
+compared, so a node with a closure is always changed.
+
+The changed region is the union of the old and new bounding boxes of the
+changed subtrees, mapped into the frame of the root by their ancestors.
+Booleans, offsets and transforms map the region of a child; other nodes
+(e.g. arrays, extrusions, blends) take their whole bounding box.
+
+The region bounds where the surface moved, so it is a seed for renderers:
+changes can spread beyond it (e.g. a smooth blend), and renderers should
+check the field values on its boundary.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// changeMapper is implemented by nodes that map the changed region of a child to their own frame.
+type changeMapper interface {
+	changedRegion(b Box3) Box3
+}
+
+func (s *UnionSDF3) changedRegion(b Box3) Box3        { return b }
+func (s *DifferenceSDF3) changedRegion(b Box3) Box3   { return b }
+func (s *IntersectionSDF3) changedRegion(b Box3) Box3 { return b }
+func (s *XorSDF3) changedRegion(b Box3) Box3          { return b }
+func (s *CutSDF3) changedRegion(b Box3) Box3          { return b }
+func (s *ColorSDF3) changedRegion(b Box3) Box3        { return b }
+func (s *TransformSDF3) changedRegion(b Box3) Box3    { return s.matrix.MulBox(b) }
+func (s *ScaleUniformSDF3) changedRegion(b Box3) Box3 {
+	return Box3{b.Min.MulScalar(s.k), b.Max.MulScalar(s.k)}
+}
+
+func (s *OffsetSDF3) changedRegion(b Box3) Box3 {
+	d := math.Abs(s.offset)
+	return b.Enlarge(V3{d, d, d}.MulScalar(2))
+}
+
+//-----------------------------------------------------------------------------
+
+// sameModel returns true if two trees have the same hash and no closures.
+func sameModel(a, b interface{}) bool {
+	h0, ok0 := CacheKey(a)
+	h1, ok1 := CacheKey(b)
+	return ok0 && ok1 && h0 == h1
+}
+
+// ChangedRegion3 returns the region of an SDF3 changed between two revisions of its tree,
+// and false if the trees are the same.
+func ChangedRegion3(old, new SDF3) (Box3, bool) {
+	if sameModel(old, new) {
+		return Box3{}, false
+	}
+	whole := old.BoundingBox().Extend(new.BoundingBox())
+	c0, c1 := Children(old), Children(new)
+	m, ok := old.(changeMapper)
+	h0, ok0 := nodeHash(old)
+	h1, ok1 := nodeHash(new)
+	if !ok || !ok0 || !ok1 || len(c0) == 0 || len(c0) != len(c1) || h0 != h1 {
+		return whole, true
+	}
+	var region Box3
+	changed := false
+	for i := range c0 {
+		if sameModel(c0[i], c1[i]) {
+			continue
+		}
+		s0, ok0 := c0[i].(SDF3)
+		s1, ok1 := c1[i].(SDF3)
+		if !ok0 || !ok1 {
+			return whole, true
+		}
+		r, _ := ChangedRegion3(s0, s1)
+		if changed {
+			region = region.Extend(r)
+		} else {
+			region, changed = r, true
+		}
+	}
+	if !changed {
+		return whole, true
+	}
+	return m.changedRegion(region), true
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,191 @@
+//-----------------------------------------------------------------------------
+/*
+
+Conformal Cooling Channels
+
+A channel routed at a constant distance from a surface (e.g. the cavity of
+a mold insert, or the wall of a heat exchanger) between an inlet and an
+outlet. The route starts as the polyline through the inlet, the waypoints
+and the outlet, and is relaxed: the points are smoothed along the route
+(shortening it) and projected onto the offset surface (the level set of
+the surface SDF3 at the offset) with Newton steps, then resampled to an
+even spacing. The inlet and outlet are fixed, the waypoints are projected
+once and then fixed, so they select the way around the surface.
+
+The channel follows the surface only inside an optional region, elsewhere
+it runs straight (e.g. up to an inlet on the outside of a mold).
+
+The channel is a tube network (see TubeNetwork3D) to subtract from the
+part.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// ConformalChannelParms defines the parameters of a conformal channel.
+type ConformalChannelParms struct {
+	Surface    SDF3    // surface followed by the channel
+	Region     SDF3    // region of the surface followed by the channel (nil: everywhere)
+	Offset     float64 // distance of the channel axis from the surface (< 0: inside)
+	Diameter   float64 // channel diameter
+	Inlet      V3      // start of the channel
+	Outlet     V3      // end of the channel
+	Waypoints  []V3    // the channel passes near these points (projected onto the offset surface)
+	Step       float64 // spacing of the route points (0: the diameter)
+	Iterations int     // relaxation iterations (0: 100)
+}
+
+// channel is the state of a channel route.
+type channel struct {
+	k    ConformalChannelParms
+	eps  float64 // gradient step
+	path []V3
+	fix  []bool // fixed points (inlet, waypoints, outlet)
+}
+
+// weight returns how much a point of the route follows the surface (0..1).
+func (c *channel) weight(p V3) float64 {
+	if c.k.Region == nil {
+		return 1
+	}
+	return Clamp(0.5-c.k.Region.Evaluate(p)/c.k.Diameter, 0, 1)
+}
+
+// project moves a point towards the offset surface (by its region weight).
+func (c *channel) project(p V3) V3 {
+	w := c.weight(p)
+	if w == 0 {
+		return p
+	}
+	q := p
+	for i := 0; i < 4; i++ {
+		d := c.k.Surface.Evaluate(q) - c.k.Offset
+		g := Gradient3(c.k.Surface, q, c.eps)
+		g2 := g.Length2()
+		if g2 == 0 {
+			break
+		}
+		q = q.Sub(g.MulScalar(d / g2))
+	}
+	return p.Add(q.Sub(p).MulScalar(w))
+}
+
+// resample spaces the points between fixed points evenly.
+func (c *channel) resample() {
+	path := []V3{c.path[0]}
+	fix := []bool{true}
+	start := 0
+	for i := 1; i < len(c.path); i++ {
+		if !c.fix[i] {
+			continue
+		}
+		// arc lengths of the section
+		section := c.path[start : i+1]
+		s := make([]float64, len(section))
+		for j := 1; j < len(section); j++ {
+			s[j] = s[j-1] + section[j].Sub(section[j-1]).Length()
+		}
+		l := s[len(s)-1]
+		n := int(math.Ceil(l / c.k.Step))
+		j := 0
+		for m := 1; m < n; m++ {
+			t := l * float64(m) / float64(n)
+			for s[j+1] < t {
+				j++
+			}
+			u := 0.0
+			if s[j+1] > s[j] {
+				u = (t - s[j]) / (s[j+1] - s[j])
+			}
+			path = append(path, section[j].Add(section[j+1].Sub(section[j]).MulScalar(u)))
+			fix = append(fix, false)
+		}
+		path = append(path, c.path[i])
+		fix = append(fix, true)
+		start = i
+	}
+	c.path, c.fix = path, fix
+}
+
+// relax smooths the route and projects it onto the offset surface.
+func (c *channel) relax() {
+	smooth := make([]V3, len(c.path))
+	copy(smooth, c.path)
+	for i := 1; i < len(c.path)-1; i++ {
+		if c.fix[i] {
+			continue
+		}
+		mid := c.path[i-1].Add(c.path[i+1]).MulScalar(0.5)
+		smooth[i] = c.project(c.path[i].Add(mid.Sub(c.path[i]).MulScalar(0.5)))
+	}
+	c.path = smooth
+}
+
+// ConformalChannel3D returns a channel routed at a constant distance from a surface, and the
+// route (the channel axis).
+func ConformalChannel3D(k *ConformalChannelParms) (SDF3, []V3, error) {
+	if k.Surface == nil {
+		return nil, nil, ErrMsg("no surface")
+	}
+	if k.Diameter <= 0 {
+		return nil, nil, ErrMsg("Diameter <= 0")
+	}
+	if k.Step < 0 || k.Iterations < 0 {
+		return nil, nil, ErrMsg("Step or Iterations < 0")
+	}
+	c := &channel{k: *k}
+	if c.k.Step == 0 {
+		c.k.Step = k.Diameter
+	}
+	if c.k.Iterations == 0 {
+		c.k.Iterations = 100
+	}
+	c.eps = 1e-3 * c.k.Step
+
+	// route through the projected waypoints
+	c.path = append(c.path, k.Inlet)
+	for _, p := range k.Waypoints {
+		c.path = append(c.path, c.project(p))
+	}
+	c.path = append(c.path, k.Outlet)
+	c.fix = make([]bool, len(c.path))
+	for i := range c.fix {
+		c.fix[i] = true
+	}
+	for i := 1; i < len(c.path); i++ {
+		if c.path[i].Equals(c.path[i-1], 0) {
+			return nil, nil, ErrMsg("coincident route points")
+		}
+	}
+	c.resample()
+	for i := range c.path {
+		if !c.fix[i] {
+			c.path[i] = c.project(c.path[i])
+		}
+	}
+	for i := 0; i < c.k.Iterations; i++ {
+		c.relax()
+		c.resample()
+	}
+
+	nodes := make([]TubeNode, len(c.path))
+	edges := make([][2]int, len(c.path)-1)
+	for i, p := range c.path {
+		nodes[i] = TubeNode{p, 0.5 * k.Diameter}
+		if i > 0 {
+			edges[i-1] = [2]int{i - 1, i}
+		}
+	}
+	s, err := TubeNetwork3D(nodes, edges, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, c.path, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,84 @@
+//-----------------------------------------------------------------------------
+/*
+
+Color
+
+An SDF3 can be given a color. The color of a point on the surface comes
+from the deepest colored node of the SDF tree making the surface at that
+point (see Feature), so each part of a union keeps its color and the walls
+of a hole take the color of the cutting SDF3.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "image/color"
+
+//-----------------------------------------------------------------------------
+
+// ColorSDF3 is an SDF3 with a color.
+type ColorSDF3 struct {
+	sdf   SDF3
+	color color.RGBA
+}
+
+// Color3D returns an SDF3 with a color.
+func Color3D(sdf SDF3, c color.Color) SDF3 {
+	r, g, b, a := c.RGBA()
+	return &ColorSDF3{sdf, color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}}
+}
+
+// Evaluate returns the minimum distance to a colored SDF3.
+func (s *ColorSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(p)
+}
+
+// BoundingBox returns the bounding box of a colored SDF3.
+func (s *ColorSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+// Color returns the color of the SDF3.
+func (s *ColorSDF3) Color() color.RGBA {
+	return s.color
+}
+
+// IsExact returns true if the colored SDF3 is exact.
+func (s *ColorSDF3) IsExact() bool { return IsExact3(s.sdf) }
+
+// LipschitzBound returns a Lipschitz bound of a colored SDF3 on the segment a-b.
+func (s *ColorSDF3) LipschitzBound(a, b V3) float64 {
+	return LipschitzBound3(s.sdf, a, b)
+}
+
+//-----------------------------------------------------------------------------
+
+// HasColor3 returns true if any node of an SDF3 tree has a color.
+func HasColor3(s SDF3) bool {
+	found := false
+	Walk(s, func(n interface{}, path string) bool {
+		if _, ok := n.(*ColorSDF3); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Color3 returns the color of an SDF3 at a (surface) point.
+// It returns false if no colored node makes the surface at the point.
+func Color3(s SDF3, p V3) (color.RGBA, bool) {
+	tol := ModelTolerances3(s).Surface
+	var c color.RGBA
+	found := false
+	for s != nil {
+		if x, ok := s.(*ColorSDF3); ok {
+			c, found = x.color, true
+		}
+		s, _, p = featureChild(s, p, tol)
+	}
+	return c, found
+}
+
+//-----------------------------------------------------------------------------
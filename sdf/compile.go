@@ -0,0 +1,237 @@
+//-----------------------------------------------------------------------------
+/*
+
+Compiled SDF3s
+
+Compile an SDF3 tree to a flat program for batch evaluation on a compute
+device (e.g. a GPU kernel, see render/gpu) or on the CPU. The common
+primitives (spheres, boxes, cylinders) are compiled to leaf operations with
+the transforms above them folded into an affine map of the evaluation
+point, and unions, differences and intersections (without blending) with
+uniform scaling are compiled to operations on a stack of distances. The
+other subtrees are host leaves: evaluated on the host at the mapped point.
+
+A program is evaluated an operation at a time over a batch of points.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// OpCode is an operation of a compiled SDF3.
+type OpCode int
+
+// Operations of a compiled SDF3. Leaf operations push a distance evaluated at
+// the mapped point, the others pop their operands and push the result.
+const (
+	OpSphere   OpCode = iota // leaf: radius
+	OpBox                    // leaf: half size x, y, z (less round), round
+	OpCylinder               // leaf: half height (less round), radius (less round), round
+	OpHost                   // leaf: a host subtree (Arg is the host leaf index)
+	OpMin                    // min(a, b)
+	OpMax                    // max(a, b)
+	OpMaxNeg                 // max(a, -b)
+	OpScale                  // a * k: k
+)
+
+// Op is an operation of a compiled SDF3.
+// The parameters of leaf operations are Params[Arg:], an affine map of the point
+// (the 3 rows of a 4x4 matrix) followed by the leaf parameters.
+type Op struct {
+	Code OpCode
+	Arg  int
+}
+
+// Host is a subtree of a compiled SDF3 evaluated on the host.
+type Host struct {
+	SDF SDF3
+	Map M44 // map from the evaluation point to the point of the subtree
+}
+
+// Program is a compiled SDF3.
+type Program struct {
+	Ops    []Op
+	Params []float64
+	Hosts  []Host
+	Depth  int // maximum depth of the distance stack
+	bb     Box3
+}
+
+//-----------------------------------------------------------------------------
+
+// Compile3 compiles an SDF3 to a program.
+func Compile3(s SDF3) *Program {
+	p := &Program{bb: s.BoundingBox()}
+	p.compile(s, Identity3d(), 0)
+	return p
+}
+
+// leaf adds a leaf operation.
+func (p *Program) leaf(code OpCode, m M44, depth int, params ...float64) {
+	p.Ops = append(p.Ops, Op{code, len(p.Params)})
+	p.Params = append(p.Params,
+		m.x00, m.x01, m.x02, m.x03,
+		m.x10, m.x11, m.x12, m.x13,
+		m.x20, m.x21, m.x22, m.x23)
+	p.Params = append(p.Params, params...)
+	if depth+1 > p.Depth {
+		p.Depth = depth + 1
+	}
+}
+
+// binary adds the operations of a binary operation on two subtrees.
+func (p *Program) binary(code OpCode, a, b SDF3, m M44, depth int) {
+	p.compile(a, m, depth)
+	p.compile(b, m, depth+1)
+	p.Ops = append(p.Ops, Op{code, 0})
+}
+
+// compile adds the operations of a subtree, evaluated at m.p with depth distances on the stack.
+// Blended booleans are host leaves.
+func (p *Program) compile(s SDF3, m M44, depth int) {
+	switch s := s.(type) {
+	case *SphereSDF3:
+		p.leaf(OpSphere, m, depth, s.radius)
+	case *BoxSDF3:
+		p.leaf(OpBox, m, depth, s.size.X, s.size.Y, s.size.Z, s.round)
+	case *CylinderSDF3:
+		p.leaf(OpCylinder, m, depth, s.height, s.radius, s.round)
+	case *TransformSDF3:
+		p.compile(s.sdf, s.inverse.Mul(m), depth)
+	case *ScaleUniformSDF3:
+		p.compile(s.sdf, Scale3d(V3{s.invK, s.invK, s.invK}).Mul(m), depth)
+		p.Ops = append(p.Ops, Op{OpScale, len(p.Params)})
+		p.Params = append(p.Params, s.k)
+	case *UnionSDF3:
+		if !isMathMin(s.min) {
+			p.host(s, m, depth)
+			return
+		}
+		p.compile(s.sdf[0], m, depth)
+		for _, x := range s.sdf[1:] {
+			p.compile(x, m, depth+1)
+			p.Ops = append(p.Ops, Op{OpMin, 0})
+		}
+	case *DifferenceSDF3:
+		if !isMathMax(s.max) {
+			p.host(s, m, depth)
+			return
+		}
+		p.binary(OpMaxNeg, s.s0, s.s1, m, depth)
+	case *IntersectionSDF3:
+		if !isMathMax(s.max) {
+			p.host(s, m, depth)
+			return
+		}
+		p.binary(OpMax, s.s0, s.s1, m, depth)
+	default:
+		p.host(s, m, depth)
+	}
+}
+
+// host adds a host leaf.
+func (p *Program) host(s SDF3, m M44, depth int) {
+	p.Ops = append(p.Ops, Op{OpHost, len(p.Hosts)})
+	p.Hosts = append(p.Hosts, Host{s, m})
+	if depth+1 > p.Depth {
+		p.Depth = depth + 1
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// EvaluateHosts evaluates the host leaves at a batch of points, out[i] for host leaf i.
+func (p *Program) EvaluateHosts(pts []V3, out [][]float64) {
+	q := make([]V3, len(pts))
+	for i, h := range p.Hosts {
+		for j, x := range pts {
+			q[j] = h.Map.MulPosition(x)
+		}
+		EvaluateN(h.SDF, q, out[i])
+	}
+}
+
+// Run evaluates the program at a batch of points with the values of the host leaves (see EvaluateHosts).
+func (p *Program) Run(pts []V3, hosts [][]float64, out []float64) {
+	stack := make([][]float64, p.Depth)
+	stack[0] = out[:len(pts)]
+	for i := 1; i < len(stack); i++ {
+		stack[i] = make([]float64, len(pts))
+	}
+	n := 0
+	for _, op := range p.Ops {
+		if op.Code <= OpHost {
+			d := stack[n]
+			n++
+			if op.Code == OpHost {
+				copy(d, hosts[op.Arg])
+				continue
+			}
+			a := p.Params[op.Arg:]
+			for i, x := range pts {
+				q := V3{a[0]*x.X + a[1]*x.Y + a[2]*x.Z + a[3],
+					a[4]*x.X + a[5]*x.Y + a[6]*x.Z + a[7],
+					a[8]*x.X + a[9]*x.Y + a[10]*x.Z + a[11]}
+				switch op.Code {
+				case OpSphere:
+					d[i] = q.Length() - a[12]
+				case OpBox:
+					d[i] = sdfBox3d(q, V3{a[12], a[13], a[14]}) - a[15]
+				case OpCylinder:
+					d[i] = sdfBox2d(V2{V2{q.X, q.Y}.Length(), q.Z}, V2{a[13], a[12]}) - a[14]
+				}
+			}
+			continue
+		}
+		if op.Code == OpScale {
+			k := p.Params[op.Arg]
+			d := stack[n-1]
+			for i := range d {
+				d[i] *= k
+			}
+			continue
+		}
+		n--
+		a, b := stack[n-1], stack[n]
+		for i := range a {
+			switch op.Code {
+			case OpMin:
+				a[i] = math.Min(a[i], b[i])
+			case OpMax:
+				a[i] = math.Max(a[i], b[i])
+			case OpMaxNeg:
+				a[i] = math.Max(a[i], -b[i])
+			}
+		}
+	}
+}
+
+// EvaluateN evaluates the program at a batch of points.
+func (p *Program) EvaluateN(pts []V3, out []float64) {
+	hosts := make([][]float64, len(p.Hosts))
+	for i := range hosts {
+		hosts[i] = make([]float64, len(pts))
+	}
+	p.EvaluateHosts(pts, hosts)
+	p.Run(pts, hosts, out)
+}
+
+// Evaluate returns the minimum distance to the compiled SDF3.
+func (p *Program) Evaluate(x V3) float64 {
+	var out [1]float64
+	p.EvaluateN([]V3{x}, out[:])
+	return out[0]
+}
+
+// BoundingBox returns the bounding box of the compiled SDF3.
+func (p *Program) BoundingBox() Box3 {
+	return p.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,124 @@
+//-----------------------------------------------------------------------------
+/*
+
+Conformal Patterns
+
+Map a periodic pattern onto the band of space near a surface. The pattern
+is evaluated in surface coordinates (u, v, w): w is the distance to the
+surface (the SDF3 value) and (u, v) is a tangential parameterization. The
+parameterization is triplanar: the point is projected onto the three axis
+planes and the pattern values are blended with weights from the surface
+normal, so the pattern follows curved surfaces instead of being a world
+axis pattern clipped by the surface.
+
+A 3d pattern periodic in w gives lattice layers conformal to the surface,
+a 2d pattern (in u, v) is extruded along w for scale-like textures.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// ConformalSDF3 is a pattern mapped onto the band near a surface.
+type ConformalSDF3 struct {
+	surface   SDF3
+	pattern   SDF3    // pattern in (u, v, w) coordinates
+	w0, w1    float64 // band of surface distances
+	sharpness float64 // triplanar blend exponent
+	eps       float64 // normal estimation step
+	bb        Box3
+}
+
+// Conformal3D maps a 3d pattern (in u, v, w coordinates) onto the band w0 <= w <= w1 of
+// surface distances (< 0 inside). The sharpness (>= 1) is the exponent of the triplanar
+// blend weights, higher values have narrower transitions between projections.
+func Conformal3D(surface, pattern SDF3, w0, w1, sharpness float64) (SDF3, error) {
+	if surface == nil || pattern == nil {
+		return nil, ErrMsg("surface == nil || pattern == nil")
+	}
+	if w0 >= w1 {
+		return nil, ErrMsg("w0 >= w1")
+	}
+	if sharpness < 1 {
+		return nil, ErrMsg("sharpness < 1")
+	}
+	bb := surface.BoundingBox()
+	if w1 > 0 {
+		bb = bb.Enlarge(V3{2 * w1, 2 * w1, 2 * w1})
+	}
+	return &ConformalSDF3{
+		surface:   surface,
+		pattern:   pattern,
+		w0:        w0,
+		w1:        w1,
+		sharpness: sharpness,
+		eps:       ModelTolerances3(surface).Normal,
+		bb:        bb,
+	}, nil
+}
+
+// ConformalTexture3D maps a 2d pattern (in u, v coordinates) onto the band w0 <= w <= w1
+// of surface distances, extruded along the surface normal.
+func ConformalTexture3D(surface SDF3, pattern SDF2, w0, w1, sharpness float64) (SDF3, error) {
+	if pattern == nil {
+		return nil, ErrMsg("pattern == nil")
+	}
+	return Conformal3D(surface, &uvPatternSDF3{pattern, w0, w1}, w0, w1, sharpness)
+}
+
+// Evaluate returns the minimum distance to a conformal pattern.
+func (s *ConformalSDF3) Evaluate(p V3) float64 {
+	w := s.surface.Evaluate(p)
+	band := math.Max(s.w0-w, w-s.w1)
+	n := Gradient3(s.surface, p, s.eps).Normalize()
+	// triplanar weights
+	a := n.Abs()
+	k := V3{math.Pow(a.X, s.sharpness), math.Pow(a.Y, s.sharpness), math.Pow(a.Z, s.sharpness)}
+	sum := k.X + k.Y + k.Z
+	if sum == 0 {
+		// no normal (e.g. on a medial surface of the field)
+		k, sum = V3{1, 1, 1}, 3
+	}
+	var d float64
+	if k.X != 0 {
+		d += k.X * s.pattern.Evaluate(V3{p.Y, p.Z, w})
+	}
+	if k.Y != 0 {
+		d += k.Y * s.pattern.Evaluate(V3{p.Z, p.X, w})
+	}
+	if k.Z != 0 {
+		d += k.Z * s.pattern.Evaluate(V3{p.X, p.Y, w})
+	}
+	// the (u, v, w) mapping stretches distances by up to sqrt(2), the pattern is clipped to the band
+	return math.Max(d/(sum*math.Sqrt2), band)
+}
+
+// BoundingBox returns the bounding box of a conformal pattern.
+func (s *ConformalSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// uvPatternSDF3 extrudes a 2d pattern along the z (w) axis without limits.
+type uvPatternSDF3 struct {
+	sdf    SDF2
+	w0, w1 float64 // z range of the bounding box
+}
+
+// Evaluate returns the minimum distance to the extruded pattern.
+func (s *uvPatternSDF3) Evaluate(p V3) float64 {
+	return s.sdf.Evaluate(V2{p.X, p.Y})
+}
+
+// BoundingBox returns the bounding box of the extruded pattern over the band.
+func (s *uvPatternSDF3) BoundingBox() Box3 {
+	bb := s.sdf.BoundingBox()
+	return Box3{V3{bb.Min.X, bb.Min.Y, s.w0}, V3{bb.Max.X, bb.Max.Y, s.w1}}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,130 @@
+//-----------------------------------------------------------------------------
+/*
+
+Selective Polygon Corner Fillets and Chamfers
+
+Fillet or chamfer the corners of a polygon chosen by index or by a
+predicate on the corner geometry (e.g. all convex corners > 60 degrees),
+with a size for each corner.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// PolygonCorner describes a corner of a polygon.
+type PolygonCorner struct {
+	Index  int     // vertex index
+	Vertex V2      // vertex position
+	Angle  float64 // interior angle (radians)
+	Convex bool    // is the corner convex?
+}
+
+// CornerFunc returns the fillet radius or chamfer size for a polygon corner (0 = no change).
+type CornerFunc func(c *PolygonCorner) float64
+
+// CornerSizes returns a corner function with sizes for the corners at the given vertex indices.
+func CornerSizes(sizes map[int]float64) CornerFunc {
+	return func(c *PolygonCorner) float64 {
+		return sizes[c.Index]
+	}
+}
+
+// ConvexCorners returns a corner function with a size for convex corners with an
+// interior angle greater than minAngle (radians).
+func ConvexCorners(size, minAngle float64) CornerFunc {
+	return func(c *PolygonCorner) float64 {
+		if c.Convex && c.Angle > minAngle {
+			return size
+		}
+		return 0
+	}
+}
+
+// ConcaveCorners returns a corner function with a size for all concave corners.
+func ConcaveCorners(size float64) CornerFunc {
+	return func(c *PolygonCorner) float64 {
+		if !c.Convex {
+			return size
+		}
+		return 0
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Corners returns the corners of the polygon.
+// The endpoints of an open polygon and arc vertices are not corners.
+func (p *Polygon) Corners() ([]PolygonCorner, error) {
+	err := p.relToAbs()
+	if err != nil {
+		return nil, err
+	}
+	// polygon orientation
+	area := 0.0
+	n := len(p.vlist)
+	for i := range p.vlist {
+		a, b := p.vlist[i].vertex, p.vlist[(i+1)%n].vertex
+		area += a.Cross(b)
+	}
+	var corners []PolygonCorner
+	for i := range p.vlist {
+		v := &p.vlist[i]
+		vp, vn := p.prevVertex(i), p.nextVertex(i)
+		if vp == nil || vn == nil || v.vtype == pvArc || vn.vtype == pvArc {
+			continue
+		}
+		v0 := vp.vertex.Sub(v.vertex).Normalize()
+		v1 := vn.vertex.Sub(v.vertex).Normalize()
+		theta := math.Acos(Clamp(v0.Dot(v1), -1, 1))
+		// a left turn on a ccw polygon is convex
+		convex := (v1.Cross(v0) > 0) == (area > 0)
+		if !convex {
+			theta = Tau - theta
+		}
+		corners = append(corners, PolygonCorner{i, v.vertex, theta, convex})
+	}
+	return corners, nil
+}
+
+// FilletCorners fillets the polygon corners with the radius returned by f.
+func (p *Polygon) FilletCorners(f CornerFunc, facets int) error {
+	corners, err := p.Corners()
+	if err != nil {
+		return err
+	}
+	for i := range corners {
+		if r := f(&corners[i]); r > 0 {
+			p.vlist[corners[i].Index].Smooth(r, facets)
+		}
+	}
+	return nil
+}
+
+// ChamferCorners chamfers the polygon corners with the size returned by f.
+// The size is the length of the chamfer face.
+func (p *Polygon) ChamferCorners(f CornerFunc) error {
+	corners, err := p.Corners()
+	if err != nil {
+		return err
+	}
+	for i := range corners {
+		c := &corners[i]
+		if size := f(c); size > 0 {
+			// angle between the edges
+			theta := c.Angle
+			if !c.Convex {
+				theta = Tau - theta
+			}
+			// 1 facet smoothing with the radius that gives the chamfer size
+			p.vlist[c.Index].Smooth(size/(2*math.Cos(theta/2)), 1)
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
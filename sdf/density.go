@@ -0,0 +1,129 @@
+//-----------------------------------------------------------------------------
+/*
+
+Density Fields
+
+Convert a voxel density field (e.g. the element densities from a SIMP
+topology optimization, run externally or with TopologyProblem) into an
+SDF3. The densities are optionally smoothed, interpolated at the voxel
+centers, thresholded and redistanced, so the result is a true signed
+distance field that can be post-processed (offset, filleted, unioned with
+mounting features) and rendered like any other SDF3.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "fmt"
+
+//-----------------------------------------------------------------------------
+
+// DensityGrid is a regular grid of voxel densities (0: void, 1: solid).
+type DensityGrid struct {
+	Box     Box3      // volume covered by the voxels
+	Cells   V3i       // number of voxels on each axis
+	Density []float64 // voxel densities (x major, z minor)
+}
+
+// NewDensityGrid returns an empty (void) density grid.
+func NewDensityGrid(box Box3, cells V3i) *DensityGrid {
+	return &DensityGrid{box, cells, make([]float64, cells[0]*cells[1]*cells[2])}
+}
+
+// Index returns the density index of a voxel.
+func (d *DensityGrid) Index(i, j, k int) int {
+	return (i*d.Cells[1]+j)*d.Cells[2] + k
+}
+
+// VoxelSize returns the size of a voxel.
+func (d *DensityGrid) VoxelSize() V3 {
+	return d.Box.Size().Div(d.Cells.ToV3())
+}
+
+// check checks the size of a density grid.
+func (d *DensityGrid) check() error {
+	for i := range d.Cells {
+		if d.Cells[i] <= 0 {
+			return ErrMsg("voxel counts must be > 0")
+		}
+	}
+	if len(d.Density) != d.Cells[0]*d.Cells[1]*d.Cells[2] {
+		return ErrMsg(fmt.Sprintf("%d densities for %dx%dx%d voxels", len(d.Density), d.Cells[0], d.Cells[1], d.Cells[2]))
+	}
+	if s := d.Box.Size(); s.X <= 0 || s.Y <= 0 || s.Z <= 0 {
+		return ErrMsg("empty box")
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+
+// smooth applies passes of a separable (1 2 1) / 4 filter to the node values of a grid,
+// keeping the boundary nodes.
+func (g *grid3) smooth(passes int) {
+	tmp := make([]float64, len(g.value))
+	for ; passes > 0; passes-- {
+		for a := 0; a < 3; a++ {
+			copy(tmp, g.value)
+			for i := 1; i < g.n[0]-1; i++ {
+				for j := 1; j < g.n[1]-1; j++ {
+					for k := 1; k < g.n[2]-1; k++ {
+						x := V3i{i, j, k}
+						x[a]--
+						v0 := tmp[g.index(x[0], x[1], x[2])]
+						x[a] += 2
+						v1 := tmp[g.index(x[0], x[1], x[2])]
+						idx := g.index(i, j, k)
+						g.value[idx] = 0.25*v0 + 0.5*tmp[idx] + 0.25*v1
+					}
+				}
+			}
+		}
+	}
+}
+
+// Density3D returns an SDF3 for the solid where a density field is above a threshold
+// (0 < threshold < 1). The densities are smoothed by passes of a (1 2 1) / 4 filter
+// (0: none) before thresholding. The voxels beyond the grid are void, so the solid is closed.
+func Density3D(d *DensityGrid, threshold float64, smoothing int) (SDF3, error) {
+	if d == nil {
+		return nil, ErrMsg("d == nil")
+	}
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	if threshold <= 0 || threshold >= 1 {
+		return nil, ErrMsg("threshold must be > 0 and < 1")
+	}
+	if smoothing < 0 {
+		return nil, ErrMsg("smoothing < 0")
+	}
+	// grid nodes at the voxel centers, with a border of o void voxels (wider than the smoothing)
+	o := smoothing + 2
+	step := d.VoxelSize()
+	pad := step.MulScalar(float64(o) - 0.5)
+	n := d.Cells.AddScalar(2 * o)
+	g := &grid3{
+		bb:    Box3{d.Box.Min.Sub(pad), d.Box.Max.Add(pad)},
+		n:     n,
+		step:  step,
+		value: make([]float64, n[0]*n[1]*n[2]),
+	}
+	for i := 0; i < d.Cells[0]; i++ {
+		for j := 0; j < d.Cells[1]; j++ {
+			for k := 0; k < d.Cells[2]; k++ {
+				g.value[g.index(i+o, j+o, k+o)] = d.Density[d.Index(i, j, k)]
+			}
+		}
+	}
+	g.smooth(smoothing)
+	// < 0 inside
+	for i, v := range g.value {
+		g.value[i] = threshold - v
+	}
+	g.redistance()
+	return &GridSDF3{grid: g}, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,304 @@
+//-----------------------------------------------------------------------------
+/*
+
+Ellipses and Ellipsoids
+
+Exact distances to ellipses and ellipsoids, found by bisection for the root
+of the closest point equation (David Eberly, "Distance from a Point to an
+Ellipse, an Ellipsoid, or a Hyperellipsoid"). A non-uniformly scaled sphere
+is only a distance bound, and a poor one for long thin ellipsoids.
+
+https://www.geometrictools.com/Documentation/DistancePointEllipseEllipsoid.pdf
+
+The elliptical cylinder is exact, the elliptical cone is a distance bound
+(its sides have a varying slope).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// ellipseMaxIterations limits the bisection for the closest point root.
+const ellipseMaxIterations = 160
+
+// ellipseRoot2 returns the root of the closest point equation for an ellipse.
+func ellipseRoot2(r0, z0, z1, g float64) float64 {
+	n0 := r0 * z0
+	s0, s1 := z1-1, 0.0
+	if g >= 0 {
+		s1 = math.Hypot(n0, z1) - 1
+	}
+	s := 0.0
+	for i := 0; i < ellipseMaxIterations; i++ {
+		s = (s0 + s1) / 2
+		if s == s0 || s == s1 {
+			break
+		}
+		a0, a1 := n0/(s+r0), z1/(s+1)
+		g = a0*a0 + a1*a1 - 1
+		if g > 0 {
+			s0 = s
+		} else if g < 0 {
+			s1 = s
+		} else {
+			break
+		}
+	}
+	return s
+}
+
+// ellipseDistance returns the (unsigned) distance from a point (y0, y1 >= 0) to an ellipse
+// with semi-axes e0 >= e1 > 0.
+func ellipseDistance(e0, e1, y0, y1 float64) float64 {
+	if y1 > 0 {
+		if y0 > 0 {
+			z0, z1 := y0/e0, y1/e1
+			g := z0*z0 + z1*z1 - 1
+			if g == 0 {
+				return 0
+			}
+			r0 := (e0 / e1) * (e0 / e1)
+			sbar := ellipseRoot2(r0, z0, z1, g)
+			x0, x1 := r0*y0/(sbar+r0), y1/(sbar+1)
+			return math.Hypot(x0-y0, x1-y1)
+		}
+		return math.Abs(y1 - e1)
+	}
+	numer0, denom0 := e0*y0, e0*e0-e1*e1
+	if numer0 < denom0 {
+		xde0 := numer0 / denom0
+		x0, x1 := e0*xde0, e1*math.Sqrt(1-xde0*xde0)
+		return math.Hypot(x0-y0, x1)
+	}
+	return math.Abs(y0 - e0)
+}
+
+// ellipseRoot3 returns the root of the closest point equation for an ellipsoid.
+func ellipseRoot3(r0, r1, z0, z1, z2, g float64) float64 {
+	n0, n1 := r0*z0, r1*z1
+	s0, s1 := z2-1, 0.0
+	if g >= 0 {
+		s1 = V3{n0, n1, z2}.Length() - 1
+	}
+	s := 0.0
+	for i := 0; i < ellipseMaxIterations; i++ {
+		s = (s0 + s1) / 2
+		if s == s0 || s == s1 {
+			break
+		}
+		a0, a1, a2 := n0/(s+r0), n1/(s+r1), z2/(s+1)
+		g = a0*a0 + a1*a1 + a2*a2 - 1
+		if g > 0 {
+			s0 = s
+		} else if g < 0 {
+			s1 = s
+		} else {
+			break
+		}
+	}
+	return s
+}
+
+// ellipsoidDistance returns the (unsigned) distance from a point (y0, y1, y2 >= 0) to an ellipsoid
+// with semi-axes e0 >= e1 >= e2 > 0.
+func ellipsoidDistance(e0, e1, e2, y0, y1, y2 float64) float64 {
+	if y2 > 0 {
+		if y1 > 0 {
+			if y0 > 0 {
+				z0, z1, z2 := y0/e0, y1/e1, y2/e2
+				g := z0*z0 + z1*z1 + z2*z2 - 1
+				if g == 0 {
+					return 0
+				}
+				r0, r1 := (e0/e2)*(e0/e2), (e1/e2)*(e1/e2)
+				sbar := ellipseRoot3(r0, r1, z0, z1, z2, g)
+				x := V3{r0 * y0 / (sbar + r0), r1 * y1 / (sbar + r1), y2 / (sbar + 1)}
+				return x.Sub(V3{y0, y1, y2}).Length()
+			}
+			return math.Hypot(y0, ellipseDistance(e1, e2, y1, y2))
+		}
+		if y0 > 0 {
+			return math.Hypot(y1, ellipseDistance(e0, e2, y0, y2))
+		}
+		return math.Hypot(math.Hypot(y0, y1), y2-e2)
+	}
+	denom0, denom1 := e0*e0-e2*e2, e1*e1-e2*e2
+	numer0, numer1 := e0*y0, e1*y1
+	if numer0 < denom0 && numer1 < denom1 {
+		xde0, xde1 := numer0/denom0, numer1/denom1
+		if discr := 1 - xde0*xde0 - xde1*xde1; discr > 0 {
+			x := V3{e0 * xde0, e1 * xde1, e2 * math.Sqrt(discr)}
+			return x.Sub(V3{y0, y1, 0}).Length()
+		}
+	}
+	return ellipseDistance(e0, e1, y0, y1)
+}
+
+// ellipseSDF returns the signed distance to an ellipse with semi-axes e.
+func ellipseSDF(p, e V2) float64 {
+	p = p.Abs()
+	var d float64
+	if e.X >= e.Y {
+		d = ellipseDistance(e.X, e.Y, p.X, p.Y)
+	} else {
+		d = ellipseDistance(e.Y, e.X, p.Y, p.X)
+	}
+	if (p.X/e.X)*(p.X/e.X)+(p.Y/e.Y)*(p.Y/e.Y) < 1 {
+		return -d
+	}
+	return d
+}
+
+//-----------------------------------------------------------------------------
+
+// EllipseSDF2 is a 2d ellipse.
+type EllipseSDF2 struct {
+	radius V2 // semi-axes
+	bb     Box2
+}
+
+// Ellipse2D returns an SDF2 for an ellipse with the given semi-axes.
+func Ellipse2D(radius V2) (SDF2, error) {
+	if radius.X <= 0 || radius.Y <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	return &EllipseSDF2{radius, Box2{radius.Neg(), radius}}, nil
+}
+
+// Evaluate returns the minimum distance to a 2d ellipse.
+func (s *EllipseSDF2) Evaluate(p V2) float64 {
+	return ellipseSDF(p, s.radius)
+}
+
+// BoundingBox returns the bounding box of a 2d ellipse.
+func (s *EllipseSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// EllipsoidSDF3 is an ellipsoid.
+type EllipsoidSDF3 struct {
+	radius V3     // semi-axes
+	order  [3]int // axes in decreasing semi-axis order
+	bb     Box3
+}
+
+// Ellipsoid3D returns an SDF3 for an ellipsoid with the given semi-axes.
+func Ellipsoid3D(radius V3) (SDF3, error) {
+	if radius.X <= 0 || radius.Y <= 0 || radius.Z <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	s := EllipsoidSDF3{radius: radius, order: [3]int{0, 1, 2}, bb: Box3{radius.Neg(), radius}}
+	e := [3]float64{radius.X, radius.Y, radius.Z}
+	sort.SliceStable(s.order[:], func(i, j int) bool { return e[s.order[i]] > e[s.order[j]] })
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to an ellipsoid.
+func (s *EllipsoidSDF3) Evaluate(p V3) float64 {
+	p = p.Abs()
+	y := [3]float64{p.X, p.Y, p.Z}
+	e := [3]float64{s.radius.X, s.radius.Y, s.radius.Z}
+	o := s.order
+	d := ellipsoidDistance(e[o[0]], e[o[1]], e[o[2]], y[o[0]], y[o[1]], y[o[2]])
+	if p.Div(s.radius).Length2() < 1 {
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of an ellipsoid.
+func (s *EllipsoidSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// EllipticalCylinderSDF3 is a cylinder with an elliptical section.
+type EllipticalCylinderSDF3 struct {
+	height float64 // half height
+	radius V2      // semi-axes
+	bb     Box3
+}
+
+// EllipticalCylinder3D returns an SDF3 for a cylinder (on the z-axis) with an elliptical section.
+func EllipticalCylinder3D(height float64, radius V2) (SDF3, error) {
+	if height <= 0 {
+		return nil, ErrMsg("height <= 0")
+	}
+	if radius.X <= 0 || radius.Y <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	h := height / 2
+	return &EllipticalCylinderSDF3{h, radius, Box3{V3{-radius.X, -radius.Y, -h}, V3{radius.X, radius.Y, h}}}, nil
+}
+
+// Evaluate returns the minimum distance to an elliptical cylinder.
+func (s *EllipticalCylinderSDF3) Evaluate(p V3) float64 {
+	w := V2{ellipseSDF(V2{p.X, p.Y}, s.radius), math.Abs(p.Z) - s.height}
+	return w.Max(V2{0, 0}).Length() + math.Min(math.Max(w.X, w.Y), 0)
+}
+
+// BoundingBox returns the bounding box of an elliptical cylinder.
+func (s *EllipticalCylinderSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// EllipticalConeSDF3 is a truncated cone with an elliptical section.
+type EllipticalConeSDF3 struct {
+	height float64 // half height
+	radius V2      // base semi-axes
+	top    float64 // top section scale
+	slope  float64 // cosine of the steepest side angle
+	bb     Box3
+}
+
+// EllipticalCone3D returns an SDF3 for a truncated cone (on the z-axis) with an elliptical base
+// of the given semi-axes. The top section is the base scaled by top (0: a pointed cone).
+func EllipticalCone3D(height float64, radius V2, top float64) (SDF3, error) {
+	if height <= 0 {
+		return nil, ErrMsg("height <= 0")
+	}
+	if radius.X <= 0 || radius.Y <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	if top < 0 {
+		return nil, ErrMsg("top < 0")
+	}
+	s := EllipticalConeSDF3{}
+	s.height = height / 2
+	s.radius = radius
+	s.top = top
+	// the sides move (1 - top) * semi-axis over the height
+	s.slope = 1 / math.Hypot(1, (1-top)*radius.MaxComponent()/height)
+	r := radius.MulScalar(math.Max(1, top))
+	s.bb = Box3{V3{-r.X, -r.Y, -s.height}, V3{r.X, r.Y, s.height}}
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to an elliptical cone.
+func (s *EllipticalConeSDF3) Evaluate(p V3) float64 {
+	// section scale at the height (constant beyond the ends)
+	t := (Clamp(p.Z, -s.height, s.height) + s.height) / (2 * s.height)
+	k := math.Max(1+(s.top-1)*t, 1e-12)
+	// the distance within the section, a bound for the sloped sides
+	side := k * ellipseSDF(V2{p.X, p.Y}.DivScalar(k), s.radius) * s.slope
+	return math.Max(side, math.Abs(p.Z)-s.height)
+}
+
+// BoundingBox returns the bounding box of an elliptical cone.
+func (s *EllipticalConeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
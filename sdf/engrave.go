@@ -0,0 +1,132 @@
+//-----------------------------------------------------------------------------
+/*
+
+Surface Markings
+
+Engrave a 2d marking (e.g. text) into a surface, or emboss it onto the
+surface. The marking is projected along the surface normal at a point on
+the surface and the cut (or raised) region is a constant depth band of
+the surface distance, so the marking follows a curved surface instead of
+being a flat prism.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// markSamples is the number of samples (per axis) of the surface under a marking.
+const markSamples = 8
+
+// MarkSDF3 is a 2d marking engraved into or embossed onto the surface of an SDF3.
+type MarkSDF3 struct {
+	sdf               SDF3
+	mark              SDF2
+	origin            V3
+	right, up, normal V3      // marking frame
+	depth             float64 // engraving depth or embossed height
+	length            float64 // half length of the marking column along the normal
+	emboss            bool
+	region            Box3 // where the marking changes the SDF3
+	bb                Box3
+}
+
+// newMark3D returns a marking of an SDF3. The marking is centered at the origin (on the surface) and
+// the up vector (projected onto the tangent plane) is the +y direction of the marking.
+func newMark3D(s SDF3, mark SDF2, origin, normal, up V3, depth float64, emboss bool) (*MarkSDF3, error) {
+	if s == nil || mark == nil {
+		return nil, ErrMsg("s == nil || mark == nil")
+	}
+	if depth <= 0 {
+		return nil, ErrMsg("depth <= 0")
+	}
+	n := normal.Normalize()
+	u := up.Sub(n.MulScalar(up.Dot(n)))
+	if math.IsNaN(n.Length()) || u.Length() < epsilon {
+		return nil, ErrMsg("normal and up must be non-zero and not parallel")
+	}
+	u = u.Normalize()
+	m := &MarkSDF3{
+		sdf:    s,
+		mark:   mark,
+		origin: origin,
+		right:  u.Cross(n),
+		up:     u,
+		normal: n,
+		depth:  depth,
+		emboss: emboss,
+	}
+	// the column covers the surface deviation from the tangent plane over the marking,
+	// but not the opposite surfaces of thin parts
+	mbb := mark.BoundingBox()
+	sag := 0.0
+	for i := 0; i <= markSamples; i++ {
+		for j := 0; j <= markSamples; j++ {
+			x := mbb.Min.X + mbb.Size().X*float64(i)/markSamples
+			y := mbb.Min.Y + mbb.Size().Y*float64(j)/markSamples
+			sag = math.Max(sag, math.Abs(s.Evaluate(origin.Add(m.right.MulScalar(x)).Add(u.MulScalar(y)))))
+		}
+	}
+	m.length = sag + 2*depth
+	var corners []V3
+	for _, x := range []float64{mbb.Min.X, mbb.Max.X} {
+		for _, y := range []float64{mbb.Min.Y, mbb.Max.Y} {
+			for _, w := range []float64{-m.length, m.length} {
+				corners = append(corners, origin.Add(m.right.MulScalar(x)).Add(u.MulScalar(y)).Add(n.MulScalar(w)))
+			}
+		}
+	}
+	m.region = Box3{corners[0], corners[0]}
+	for _, c := range corners[1:] {
+		m.region = m.region.Include(c)
+	}
+	m.bb = s.BoundingBox()
+	if emboss {
+		m.bb = m.bb.Extend(m.region)
+	}
+	return m, nil
+}
+
+// Engrave3D returns an SDF3 with a 2d marking engraved into its surface to a depth.
+// The marking is centered at the origin (a point on the surface) and its +y direction
+// is the up vector projected onto the surface plane.
+func Engrave3D(s SDF3, mark SDF2, origin, normal, up V3, depth float64) (SDF3, error) {
+	return newMark3D(s, mark, origin, normal, up, depth, false)
+}
+
+// Emboss3D returns an SDF3 with a 2d marking raised from its surface by a height.
+// The marking is centered at the origin (a point on the surface) and its +y direction
+// is the up vector projected onto the surface plane.
+func Emboss3D(s SDF3, mark SDF2, origin, normal, up V3, height float64) (SDF3, error) {
+	return newMark3D(s, mark, origin, normal, up, height, true)
+}
+
+// Evaluate returns the minimum distance to a marked SDF3.
+func (s *MarkSDF3) Evaluate(p V3) float64 {
+	d := s.sdf.Evaluate(p)
+	q := p.Sub(s.origin)
+	w := q.Dot(s.normal)
+	// the marking column
+	c := math.Max(s.mark.Evaluate(V2{q.Dot(s.right), q.Dot(s.up)}), math.Abs(w)-s.length)
+	if s.emboss {
+		return math.Min(d, math.Max(c, d-s.depth))
+	}
+	return math.Max(d, -math.Max(c, -d-s.depth))
+}
+
+// BoundingBox returns the bounding box of a marked SDF3.
+func (s *MarkSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// Region returns a bounding box of the volume where the marking changes the SDF3.
+// Outside the region the marked SDF3 has the sign of the unmarked SDF3, and the
+// same value near its surface (closer than the marking column).
+func (s *MarkSDF3) Region() Box3 {
+	return s.region
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,229 @@
+//-----------------------------------------------------------------------------
+/*
+
+Exact vs Bound Distance Fields
+
+An exact SDF returns the true euclidean distance to the surface.
+Many operations (non-uniform scaling, blending, intersections) only
+return a lower bound on the distance. That's fine for rendering, but
+it slows raycasting and makes offsets/shells inaccurate.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"reflect"
+)
+
+//-----------------------------------------------------------------------------
+
+// Exact is implemented by SDFs that can report if their distance is exact.
+// Unions and negative offsets of exact SDFs are not exact: their distance is
+// exact outside the solid, but only a bound inside it (or near concave edges).
+type Exact interface {
+	IsExact() bool
+}
+
+// IsExact3 returns true if the SDF3 is known to return exact distances.
+func IsExact3(s SDF3) bool {
+	if e, ok := s.(Exact); ok {
+		return e.IsExact()
+	}
+	return false
+}
+
+// IsExact2 returns true if the SDF2 is known to return exact distances.
+func IsExact2(s SDF2) bool {
+	if e, ok := s.(Exact); ok {
+		return e.IsExact()
+	}
+	return false
+}
+
+// isMathMin returns true if the minimum function is the non-blending default.
+func isMathMin(f MinFunc) bool {
+	return reflect.ValueOf(f).Pointer() == reflect.ValueOf(math.Min).Pointer()
+}
+
+// isMathMax returns true if the maximum function is the non-blending default.
+func isMathMax(f MaxFunc) bool {
+	return reflect.ValueOf(f).Pointer() == reflect.ValueOf(math.Max).Pointer()
+}
+
+// isRigid returns true if the matrix is a rotation/translation (distance preserving).
+func (a M44) isRigid() bool {
+	c0 := V3{a.x00, a.x10, a.x20}
+	c1 := V3{a.x01, a.x11, a.x21}
+	c2 := V3{a.x02, a.x12, a.x22}
+	const tol = 1e-9
+	return math.Abs(c0.Length2()-1) < tol &&
+		math.Abs(c1.Length2()-1) < tol &&
+		math.Abs(c2.Length2()-1) < tol &&
+		math.Abs(c0.Dot(c1)) < tol &&
+		math.Abs(c1.Dot(c2)) < tol &&
+		math.Abs(c2.Dot(c0)) < tol
+}
+
+// isRigid returns true if the matrix is a rotation/translation (distance preserving).
+func (a M33) isRigid() bool {
+	c0 := V2{a.x00, a.x10}
+	c1 := V2{a.x01, a.x11}
+	const tol = 1e-9
+	return math.Abs(c0.Length2()-1) < tol &&
+		math.Abs(c1.Length2()-1) < tol &&
+		math.Abs(c0.Dot(c1)) < tol
+}
+
+//-----------------------------------------------------------------------------
+// SDF2 exactness
+
+// IsExact returns true, a circle has an exact distance field.
+func (s *CircleSDF2) IsExact() bool { return true }
+
+// IsExact returns true, a box has an exact distance field.
+func (s *BoxSDF2) IsExact() bool { return true }
+
+// IsExact returns true, a line has an exact distance field.
+func (s *LineSDF2) IsExact() bool { return true }
+
+// IsExact returns true, a polygon has an exact distance field.
+func (s *PolySDF2) IsExact() bool { return true }
+
+// IsExact returns true if the offset SDF2 is exact and the offset isn't negative.
+func (s *OffsetSDF2) IsExact() bool { return s.offset >= 0 && IsExact2(s.sdf) }
+
+// IsExact returns true if the transformed SDF2 is exact.
+func (s *TransformSDF2) IsExact() bool { return s.mInv.isRigid() && IsExact2(s.sdf) }
+
+// IsExact returns true if the scaled SDF2 is exact.
+func (s *ScaleUniformSDF2) IsExact() bool { return IsExact2(s.sdf) }
+
+// IsExact returns true if the elongated SDF2 is exact.
+func (s *ElongateSDF2) IsExact() bool { return IsExact2(s.sdf) }
+
+// IsExact returns false, the distance inside a union is a bound.
+func (s *UnionSDF2) IsExact() bool { return false }
+
+//-----------------------------------------------------------------------------
+// SDF3 exactness
+
+// IsExact returns true, a box has an exact distance field.
+func (s *BoxSDF3) IsExact() bool { return true }
+
+// IsExact returns true, a sphere has an exact distance field.
+func (s *SphereSDF3) IsExact() bool { return true }
+
+// IsExact returns true, a cylinder has an exact distance field.
+func (s *CylinderSDF3) IsExact() bool { return true }
+
+// IsExact returns true, a truncated cone has an exact distance field.
+func (s *ConeSDF3) IsExact() bool { return true }
+
+// IsExact returns true, a convex polygon prism has an exact distance field.
+func (s *PrismSDF3) IsExact() bool { return true }
+
+// IsExact returns true, a frustum has an exact distance field.
+func (s *FrustumSDF3) IsExact() bool { return true }
+
+// IsExact returns true for the rounded extrusion of an exact SDF2.
+func (s *ExtrudeRoundedSDF3) IsExact() bool { return IsExact2(s.sdf) }
+
+// IsExact returns true for full revolutions of an exact SDF2.
+func (s *SorSDF3) IsExact() bool { return s.theta == 0 && IsExact2(s.sdf) }
+
+// IsExact returns true if the transformation is rigid and the SDF3 is exact.
+func (s *TransformSDF3) IsExact() bool { return s.inverse.isRigid() && IsExact3(s.sdf) }
+
+// IsExact returns true if the scaled SDF3 is exact.
+func (s *ScaleUniformSDF3) IsExact() bool { return IsExact3(s.sdf) }
+
+// IsExact returns true if the offset SDF3 is exact and the offset isn't negative.
+func (s *OffsetSDF3) IsExact() bool { return s.offset >= 0 && IsExact3(s.sdf) }
+
+// IsExact returns true if the shelled SDF3 is exact.
+func (s *ShellSDF3) IsExact() bool { return IsExact3(s.sdf) }
+
+// IsExact returns true if the elongated SDF3 is exact.
+func (s *ElongateSDF3) IsExact() bool { return IsExact3(s.sdf) }
+
+// IsExact returns false, the distance inside a union is a bound.
+func (s *UnionSDF3) IsExact() bool { return false }
+
+//-----------------------------------------------------------------------------
+// Redistancing: Correct bound-only distance fields near the surface.
+
+// RedistanceSDF3 corrects the distance of a bound-only SDF3 close to its surface.
+type RedistanceSDF3 struct {
+	sdf  SDF3    // the bound-only sdf
+	band float64 // distance from the surface to correct
+	eps  float64 // surface projection tolerance
+	h    float64 // gradient sampling step
+}
+
+// Redistance3D returns an SDF3 whose distance is corrected within band of the surface.
+// Points are projected onto the surface with Newton steps along the field gradient.
+// The distance to the projected point is limited to the distance bound of the field
+// (its value over its Lipschitz bound, see LipschitzBound3), so it is never more than
+// the distance to the surface. Outside of the band the (still valid) distance bound
+// of the original SDF3 is returned.
+func Redistance3D(sdf SDF3, band float64) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if band <= 0 {
+		return nil, ErrMsg("band <= 0")
+	}
+	if IsExact3(sdf) {
+		// nothing to correct
+		return sdf, nil
+	}
+	return &RedistanceSDF3{
+		sdf:  sdf,
+		band: band,
+		eps:  band * 1e-6,
+		h:    band * 1e-3,
+	}, nil
+}
+
+// Evaluate returns the corrected minimum distance to the SDF3.
+func (s *RedistanceSDF3) Evaluate(p V3) float64 {
+	d := s.sdf.Evaluate(p)
+	if math.Abs(d) >= s.band {
+		return d
+	}
+	// project the point onto the surface
+	q := p
+	dq := d
+	for i := 0; i < 16 && math.Abs(dq) > s.eps; i++ {
+		g := V3{
+			s.sdf.Evaluate(q.Add(V3{s.h, 0, 0})) - s.sdf.Evaluate(q.Add(V3{-s.h, 0, 0})),
+			s.sdf.Evaluate(q.Add(V3{0, s.h, 0})) - s.sdf.Evaluate(q.Add(V3{0, -s.h, 0})),
+			s.sdf.Evaluate(q.Add(V3{0, 0, s.h})) - s.sdf.Evaluate(q.Add(V3{0, 0, -s.h})),
+		}.DivScalar(2 * s.h)
+		g2 := g.Length2()
+		if g2 < epsilon {
+			// no usable gradient
+			return d
+		}
+		q = q.Sub(g.MulScalar(dq / g2))
+		dq = s.sdf.Evaluate(q)
+	}
+	dist := p.Sub(q).Length()
+	if l := LipschitzBound3(s.sdf, p, q); l > 0 {
+		dist = math.Min(dist, math.Abs(d)/l)
+	}
+	if d < 0 {
+		return -dist
+	}
+	return dist
+}
+
+// BoundingBox returns the bounding box of the redistanced SDF3.
+func (s *RedistanceSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
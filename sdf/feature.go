@@ -0,0 +1,113 @@
+//-----------------------------------------------------------------------------
+/*
+
+Feature Size Estimation
+
+Estimate the thickness of the thinnest feature of an SDF3 by probing the
+medial axis. From sampled surface points we step inwards along the normal
+until the closest surface changes (the medial axis). If the two closest
+surfaces face each other the feature thickness is the diameter of the
+medial ball. If they meet at an angle (a convex edge) the medial ball is
+small no matter how thick the part is, so the wall thickness along the
+normal is used instead.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// surfacePoint projects a point onto the surface of an SDF3 with Newton steps.
+func surfacePoint(s SDF3, p V3, tol float64) (V3, bool) {
+	for i := 0; i < 16; i++ {
+		d := s.Evaluate(p)
+		if math.Abs(d) < tol {
+			return p, true
+		}
+		g := Gradient3(s, p, tol)
+		g2 := g.Length2()
+		if g2 < epsilon {
+			break
+		}
+		p = p.Sub(g.MulScalar(d / g2))
+	}
+	return p, false
+}
+
+// featureProbe returns the local feature thickness at surface point p.
+func featureProbe(s SDF3, p V3, tol, maxDist float64) (float64, bool) {
+	n := Gradient3(s, p, tol).Normalize()
+	if math.IsNaN(n.X) {
+		return 0, false
+	}
+	// the closest surface has changed if the gradient no longer matches the normal
+	changed := func(t float64) bool {
+		return Gradient3(s, p.Sub(n.MulScalar(t)), tol).Normalize().Dot(n) < 0.9
+	}
+	// step inwards to bracket the medial axis
+	t0, t1 := 0.0, 10*tol
+	if changed(t1) {
+		// the normal is not well defined (e.g. at an edge)
+		return 0, false
+	}
+	for !changed(t1) {
+		if t1 > maxDist {
+			return 0, false
+		}
+		t0, t1 = t1, t1+math.Max(0.5*t1, tol)
+	}
+	// bisect to find the medial axis
+	for t1-t0 > tol {
+		t := 0.5 * (t0 + t1)
+		if changed(t) {
+			t1 = t
+		} else {
+			t0 = t
+		}
+	}
+	r := 0.5 * (t0 + t1)
+	// normal of the other closest surface
+	m := Gradient3(s, p.Sub(n.MulScalar(t1+tol)), tol).Normalize()
+	if m.Dot(n) < -0.5 {
+		// opposing surfaces: the feature is the medial ball diameter
+		return 2 * r, true
+	}
+	// convex edge: measure the wall thickness along the normal
+	t := t1
+	for i := 0; i < 1000 && t < maxDist; i++ {
+		d := s.Evaluate(p.Sub(n.MulScalar(t)))
+		if d >= 0 {
+			return t, true
+		}
+		t += math.Max(-d, tol)
+	}
+	return 0, false
+}
+
+// MinFeatureSize3 estimates the thickness of the thinnest feature of an SDF3.
+// The surface is sampled at (up to) the given number of random points.
+func MinFeatureSize3(s SDF3, samples int) (float64, error) {
+	bb := s.BoundingBox()
+	maxDist := bb.Size().MaxComponent()
+	tol := maxDist * 1e-5
+	search := bb.ScaleAboutCenter(1.1)
+	size := math.Inf(1)
+	for i := 0; i < samples; i++ {
+		p, ok := surfacePoint(s, search.Random(), tol)
+		if !ok || !search.Contains(p) {
+			continue
+		}
+		if t, ok := featureProbe(s, p, tol, maxDist); ok {
+			size = math.Min(size, t)
+		}
+	}
+	if math.IsInf(size, 1) {
+		return 0, ErrMsg("no surface points found")
+	}
+	return size, nil
+}
+
+//-----------------------------------------------------------------------------
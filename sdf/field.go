@@ -0,0 +1,340 @@
+//-----------------------------------------------------------------------------
+/*
+
+Field Arithmetic
+
+General combinations of distance fields: minimum/maximum with custom
+smoothing kernels, weighted sums, products and remapping of the field
+values through a spline.
+
+The result of an arbitrary combination is not necessarily a distance
+bound (a 1-Lipschitz field). Each operator works out a Lipschitz bound
+for its result from the bounds of its inputs (chain rule, with |df/dv|
+estimated by sampling kernels that are not known in closed form), reports
+it to raycasting (segment tracing) and warns when it is above 1.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// FieldSDF3 is an arithmetic combination of SDF3 fields.
+type FieldSDF3 struct {
+	op     string
+	inputs []SDF3
+	eval   func(in []SDF3, p V3) float64
+	k      float64 // Lipschitz bound of the result
+	bb     Box3
+}
+
+// newField3 returns a field combination and warns if the field is not a distance bound.
+func newField3(op string, inputs []SDF3, eval func(in []SDF3, p V3) float64, k float64, bb Box3) *FieldSDF3 {
+	if k > 1+fieldTolerance {
+		Warn(&Warning{
+			Kind: WarnNotDistance,
+			Msg:  fmt.Sprintf("%s lipschitz bound %.3g > 1, the field is not a distance bound", op, k),
+		})
+	}
+	return &FieldSDF3{op, inputs, eval, k, bb}
+}
+
+// fieldTolerance is the Lipschitz bound above 1 accepted as numerical noise.
+const fieldTolerance = 1e-6
+
+// Evaluate returns the value of the field.
+func (s *FieldSDF3) Evaluate(p V3) float64 {
+	return s.eval(s.inputs, p)
+}
+
+// BoundingBox returns the bounding box of the field.
+func (s *FieldSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+// Lipschitz returns the Lipschitz bound of the field. A bound <= 1 means the field is a distance bound.
+func (s *FieldSDF3) Lipschitz() float64 {
+	return s.k
+}
+
+// LipschitzBound returns the Lipschitz bound of the field on the segment a-b.
+func (s *FieldSDF3) LipschitzBound(a, b V3) float64 {
+	return s.k
+}
+
+// fieldBounds returns the Lipschitz bounds of the inputs over their bounding boxes,
+// the union of their bounding boxes and the largest size of the union.
+func fieldBounds(inputs []SDF3) ([]float64, Box3, float64) {
+	k := make([]float64, len(inputs))
+	bb := inputs[0].BoundingBox()
+	for i, s := range inputs {
+		b := s.BoundingBox()
+		k[i] = LipschitzBound3(s, b.Min, b.Max)
+		bb = bb.Extend(b)
+	}
+	return k, bb, bb.Size().MaxComponent()
+}
+
+// fieldInputs checks the inputs of a field operator.
+func fieldInputs(s []SDF3, n int) error {
+	if len(s) < n {
+		return ErrMsg(fmt.Sprintf("need at least %d inputs", n))
+	}
+	for _, x := range s {
+		if x == nil {
+			return ErrMsg("nil input")
+		}
+	}
+	return nil
+}
+
+//-----------------------------------------------------------------------------
+// min/max kernels
+
+// kernelBound returns a bound of |df/da| * ka + |df/db| * kb for a two input kernel, sampled
+// over values within r of the surfaces, concentrated near a == b where kernels blend.
+func kernelBound(f func(a, b float64) float64, ka, kb, r float64) float64 {
+	var worst float64
+	offsets := []float64{0}
+	for d := r; d > r*1e-6; d /= 2 {
+		offsets = append(offsets, d, -d)
+	}
+	const n = 32
+	for i := 0; i <= n; i++ {
+		a := r * (2*float64(i)/n - 1)
+		for _, d := range offsets {
+			b := a + d
+			h := math.Max(math.Abs(d)/16, r*1e-9)
+			fa := (f(a+h, b) - f(a-h, b)) / (2 * h)
+			fb := (f(a, b+h) - f(a, b-h)) / (2 * h)
+			if x := math.Abs(fa)*ka + math.Abs(fb)*kb; x > worst && !math.IsNaN(x) {
+				worst = x
+			}
+		}
+	}
+	return worst
+}
+
+// foldKernel returns the Lipschitz bound of folding inputs (with bounds k) with a kernel:
+// f(f(f(s0, s1), s2), ...).
+func foldKernel(f func(a, b float64) float64, k []float64, r float64) float64 {
+	acc := k[0]
+	for _, x := range k[1:] {
+		acc = kernelBound(f, acc, x, r)
+	}
+	return acc
+}
+
+// FieldMin3D returns the minimum of SDF3 fields with a (smoothing) minimum function.
+func FieldMin3D(min MinFunc, s ...SDF3) (SDF3, error) {
+	if min == nil {
+		return nil, ErrMsg("min == nil")
+	}
+	if err := fieldInputs(s, 1); err != nil {
+		return nil, err
+	}
+	k, bb, r := fieldBounds(s)
+	eval := func(in []SDF3, p V3) float64 {
+		d := in[0].Evaluate(p)
+		for _, x := range in[1:] {
+			d = min(d, x.Evaluate(p))
+		}
+		return d
+	}
+	return newField3("FieldMin3D", s, eval, foldKernel(min, k, r), bb), nil
+}
+
+// FieldMax3D returns the maximum of SDF3 fields with a (smoothing) maximum function.
+func FieldMax3D(max MaxFunc, s ...SDF3) (SDF3, error) {
+	if max == nil {
+		return nil, ErrMsg("max == nil")
+	}
+	if err := fieldInputs(s, 1); err != nil {
+		return nil, err
+	}
+	k, _, r := fieldBounds(s)
+	// the solid is within all the inputs
+	bb := s[0].BoundingBox()
+	for _, x := range s[1:] {
+		b := x.BoundingBox()
+		bb = Box3{bb.Min.Max(b.Min), bb.Max.Min(b.Max)}
+	}
+	eval := func(in []SDF3, p V3) float64 {
+		d := in[0].Evaluate(p)
+		for _, x := range in[1:] {
+			d = max(d, x.Evaluate(p))
+		}
+		return d
+	}
+	return newField3("FieldMax3D", s, eval, foldKernel(max, k, r), bb), nil
+}
+
+//-----------------------------------------------------------------------------
+// sums and products
+
+// FieldSum3D returns the weighted sum of SDF3 fields.
+// The bounding box is the union of the input bounding boxes.
+func FieldSum3D(weights []float64, s ...SDF3) (SDF3, error) {
+	if err := fieldInputs(s, 1); err != nil {
+		return nil, err
+	}
+	if len(weights) != len(s) {
+		return nil, ErrMsg("len(weights) != len(s)")
+	}
+	k, bb, _ := fieldBounds(s)
+	var bound float64
+	for i, w := range weights {
+		bound += math.Abs(w) * k[i]
+	}
+	w := append([]float64(nil), weights...)
+	eval := func(in []SDF3, p V3) float64 {
+		var d float64
+		for i, x := range in {
+			d += w[i] * x.Evaluate(p)
+		}
+		return d
+	}
+	return newField3("FieldSum3D", s, eval, bound, bb), nil
+}
+
+// FieldMul3D returns the product of two SDF3 fields.
+// The Lipschitz bound is for the union of the bounding boxes, where each field is
+// bounded by the size of the box.
+func FieldMul3D(s0, s1 SDF3) (SDF3, error) {
+	s := []SDF3{s0, s1}
+	if err := fieldInputs(s, 2); err != nil {
+		return nil, err
+	}
+	k, bb, _ := fieldBounds(s)
+	// |d(ab)| <= |b||da| + |a||db|, with |a|, |b| <= the box diagonal
+	r := bb.Size().Length()
+	eval := func(in []SDF3, p V3) float64 {
+		return in[0].Evaluate(p) * in[1].Evaluate(p)
+	}
+	return newField3("FieldMul3D", s, eval, r*(k[0]+k[1]), bb), nil
+}
+
+//-----------------------------------------------------------------------------
+// remapping
+
+// fieldSpline is a 1d cubic spline through knots (x increasing), linear beyond the end knots.
+type fieldSpline struct {
+	x, y  []float64
+	slope []float64 // dy/dx at the knots
+	seg   []CubicPolynomial
+}
+
+// newFieldSpline returns a spline through knots with Catmull-Rom (finite difference) slopes.
+func newFieldSpline(knots []V2) (*fieldSpline, error) {
+	if len(knots) < 2 {
+		return nil, ErrMsg("need at least 2 knots")
+	}
+	k := append([]V2(nil), knots...)
+	sort.Slice(k, func(i, j int) bool { return k[i].X < k[j].X })
+	n := len(k)
+	s := &fieldSpline{x: make([]float64, n), y: make([]float64, n), slope: make([]float64, n), seg: make([]CubicPolynomial, n-1)}
+	for i, v := range k {
+		if i > 0 && v.X <= k[i-1].X {
+			return nil, ErrMsg("knots must have distinct x values")
+		}
+		s.x[i], s.y[i] = v.X, v.Y
+	}
+	for i := range k {
+		i0, i1 := imax(i-1, 0), imin(i+1, n-1)
+		s.slope[i] = (s.y[i1] - s.y[i0]) / (s.x[i1] - s.x[i0])
+	}
+	for i := range s.seg {
+		h := s.x[i+1] - s.x[i]
+		s.seg[i].Set(s.y[i], s.y[i+1], s.slope[i]*h, s.slope[i+1]*h)
+	}
+	return s, nil
+}
+
+// f0 returns the value of the spline.
+func (s *fieldSpline) f0(x float64) float64 {
+	n := len(s.x)
+	if x <= s.x[0] {
+		return s.y[0] + (x-s.x[0])*s.slope[0]
+	}
+	if x >= s.x[n-1] {
+		return s.y[n-1] + (x-s.x[n-1])*s.slope[n-1]
+	}
+	i := sort.SearchFloat64s(s.x, x) - 1
+	return s.seg[i].f0((x - s.x[i]) / (s.x[i+1] - s.x[i]))
+}
+
+// maxSlope returns the maximum |dy/dx| of the spline.
+func (s *fieldSpline) maxSlope() float64 {
+	m := math.Max(math.Abs(s.slope[0]), math.Abs(s.slope[len(s.slope)-1]))
+	for i := range s.seg {
+		h := s.x[i+1] - s.x[i]
+		// |f1| is largest at the ends or at the extremum of f1 (f2 == 0)
+		ts := []float64{0, 1}
+		if p := &s.seg[i]; p.d != 0 {
+			ts = append(ts, Clamp(-p.c/(3*p.d), 0, 1))
+		}
+		for _, t := range ts {
+			m = math.Max(m, math.Abs(s.seg[i].f1(t))/h)
+		}
+	}
+	return m
+}
+
+// zeroes returns the x values where the spline is 0.
+func (s *fieldSpline) zeroes() []float64 {
+	var z []float64
+	n := len(s.x)
+	if s.slope[0] != 0 && s.y[0]*s.slope[0] > 0 {
+		z = append(z, s.x[0]-s.y[0]/s.slope[0])
+	}
+	if s.slope[n-1] != 0 && s.y[n-1]*s.slope[n-1] < 0 {
+		z = append(z, s.x[n-1]-s.y[n-1]/s.slope[n-1])
+	}
+	for i := range s.seg {
+		// bracket the sign changes on a few sub-intervals
+		const m = 16
+		for j := 0; j < m; j++ {
+			t0, t1 := float64(j)/m, float64(j+1)/m
+			y0, y1 := s.seg[i].f0(t0), s.seg[i].f0(t1)
+			if y0 == 0 || y0*y1 < 0 {
+				t := t0 - y0*(t1-t0)/(y1-y0)
+				z = append(z, s.x[i]+t*(s.x[i+1]-s.x[i]))
+			}
+		}
+	}
+	return z
+}
+
+// FieldRemap3D returns an SDF3 field with its values remapped through a cubic spline.
+// The knots are (field value, remapped value) pairs, the spline is linear beyond the end knots.
+// The bounding box is enlarged for the largest field value mapped to 0.
+func FieldRemap3D(s SDF3, knots []V2) (SDF3, error) {
+	if err := fieldInputs([]SDF3{s}, 1); err != nil {
+		return nil, err
+	}
+	spline, err := newFieldSpline(knots)
+	if err != nil {
+		return nil, err
+	}
+	k, bb, _ := fieldBounds([]SDF3{s})
+	var grow float64
+	for _, z := range spline.zeroes() {
+		grow = math.Max(grow, z)
+	}
+	if grow > 0 {
+		bb = bb.Enlarge(V3{2 * grow, 2 * grow, 2 * grow})
+	}
+	eval := func(in []SDF3, p V3) float64 {
+		return spline.f0(in[0].Evaluate(p))
+	}
+	return newField3("FieldRemap3D", []SDF3{s}, eval, spline.maxSlope()*k[0], bb), nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,339 @@
+//-----------------------------------------------------------------------------
+/*
+
+Fit Checks
+
+Does a part fit inside a container (a print volume, an enclosure, a case)
+with a clearance, and at what pose?
+
+The part is sampled with points on its surface (lattice points projected
+onto the surface) and inside it (so holes and posts of the container are
+found). A pose fits when the container distance at every posed sample is
+at most -clearance. The largest container distance of the samples (plus
+the clearance) is minimized over the pose with Nelder-Mead, started from
+the axis aligned orientations of the part (the 24 rotations of a cube, or
+the quarter turns about z) centered in the container. The best pose is
+checked again with a finer sampling.
+
+The result is exact at the samples, so features of the part smaller than
+the sample spacing may be missed.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// FitRotation is the rotational freedom of a part in a fit check.
+type FitRotation int
+
+// Rotations of a part in a fit check.
+const (
+	FitRotateAll  FitRotation = iota // any rotation
+	FitRotateZ                       // rotations about the z axis (e.g. a part standing on a print bed)
+	FitRotateNone                    // translations only
+)
+
+// FitParms defines the parameters of a fit check.
+type FitParms struct {
+	Clearance float64     // smallest distance of the part from the container walls
+	Rotation  FitRotation // rotational freedom of the part
+	Cells     int         // sample lattice cells on the longest axis of the part (0: 20)
+	Restarts  int         // orientations searched (the best of the starting poses, 0: 6)
+}
+
+// FitResult is the result of a fit check.
+type FitResult struct {
+	Fits   bool    // the part fits with the clearance
+	Pose   M44     // transform of the part into the container (see Transform3D)
+	Margin float64 // smallest distance of the part from the container walls less the clearance (< 0: doesn't fit)
+}
+
+//-----------------------------------------------------------------------------
+
+// fitSamples returns points on the surface of and inside a part, from a lattice with
+// cells on the longest axis.
+func fitSamples(s SDF3, cells int) []V3 {
+	bb := s.BoundingBox()
+	size := bb.Size()
+	h := size.MaxComponent() / float64(cells)
+	n := V3i{int(math.Ceil(size.X/h)) + 1, int(math.Ceil(size.Y/h)) + 1, int(math.Ceil(size.Z/h)) + 1}
+	// center the lattice on the box
+	min := bb.Center().Sub(V3{float64(n[0] - 1), float64(n[1] - 1), float64(n[2] - 1)}.MulScalar(0.5 * h))
+	eps := 1e-3 * h
+	var p []V3
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			for k := 0; k < n[2]; k++ {
+				c := min.Add(V3{float64(i), float64(j), float64(k)}.MulScalar(h))
+				d := s.Evaluate(c)
+				if d <= -h {
+					p = append(p, c)
+					continue
+				}
+				if d >= h {
+					continue
+				}
+				// project onto the surface
+				for m := 0; m < 3 && d != 0; m++ {
+					g := Gradient3(s, c, eps)
+					g2 := g.Length2()
+					if g2 == 0 {
+						break
+					}
+					c = c.Sub(g.MulScalar(d / g2))
+					d = s.Evaluate(c)
+				}
+				if math.Abs(d) < 1e-2*h {
+					p = append(p, c)
+				}
+			}
+		}
+	}
+	return p
+}
+
+// fitOrientations returns the starting orientations for a rotational freedom.
+func fitOrientations(r FitRotation) []M44 {
+	switch r {
+	case FitRotateNone:
+		return []M44{Identity3d()}
+	case FitRotateZ:
+		return []M44{Identity3d(), RotateZ(0.5 * Pi)}
+	}
+	// the rotations of a cube, identified by the images of the x and y axes
+	var m []M44
+	seen := make(map[[6]int]bool)
+	for a := 0; a < 4; a++ {
+		for b := 0; b < 4; b++ {
+			for c := 0; c < 4; c++ {
+				r := RotateZ(float64(a) * 0.5 * Pi).Mul(RotateY(float64(b) * 0.5 * Pi)).Mul(RotateX(float64(c) * 0.5 * Pi))
+				x, y := r.MulPosition(V3{1, 0, 0}), r.MulPosition(V3{0, 1, 0})
+				key := [6]int{int(math.Round(x.X)), int(math.Round(x.Y)), int(math.Round(x.Z)),
+					int(math.Round(y.X)), int(math.Round(y.Y)), int(math.Round(y.Z))}
+				if !seen[key] {
+					seen[key] = true
+					m = append(m, r)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// fit is the state of a fit check.
+type fit struct {
+	container SDF3
+	clearance float64
+	rotation  FitRotation
+	center    V3 // part center (the rotation center)
+	origin    V3 // container center
+	samples   []V3
+	p         []V3 // posed samples
+	d         []float64
+}
+
+// pose returns the transform of a pose: an orientation, a translation (x[0:3]) from the
+// container center and a rotation (x[3:]) about the part center.
+func (f *fit) pose(r0 M44, x []float64) M44 {
+	r := r0
+	switch f.rotation {
+	case FitRotateAll:
+		if v := (V3{x[3], x[4], x[5]}); v.Length() > 0 {
+			r = Rotate3d(v, v.Length()).Mul(r0)
+		}
+	case FitRotateZ:
+		r = RotateZ(x[3]).Mul(r0)
+	}
+	t := f.origin.Add(V3{x[0], x[1], x[2]})
+	return Translate3d(t).Mul(r).Mul(Translate3d(f.center.Neg()))
+}
+
+// violation returns the largest container distance of the posed samples plus the clearance.
+func (f *fit) violation(m M44, samples []V3) float64 {
+	if len(f.p) < len(samples) {
+		f.p = make([]V3, len(samples))
+		f.d = make([]float64, len(samples))
+	}
+	p, d := f.p[:len(samples)], f.d[:len(samples)]
+	for i, q := range samples {
+		p[i] = m.MulPosition(q)
+	}
+	EvaluateN(f.container, p, d)
+	worst := math.Inf(-1)
+	for _, x := range d {
+		worst = math.Max(worst, x)
+	}
+	return worst + f.clearance
+}
+
+// fitMinimize minimizes a function with Nelder-Mead, from a point with initial steps,
+// returning the best point and value.
+func fitMinimize(fn func(x []float64) float64, x0, step []float64, evaluations int) ([]float64, float64) {
+	n := len(x0)
+	if n == 0 {
+		x := []float64{}
+		return x, fn(x)
+	}
+	type vertex struct {
+		x []float64
+		f float64
+	}
+	point := func(x []float64) vertex { return vertex{x, fn(x)} }
+	v := make([]vertex, n+1)
+	v[0] = point(append([]float64{}, x0...))
+	for i := 0; i < n; i++ {
+		x := append([]float64{}, x0...)
+		x[i] += step[i]
+		v[i+1] = point(x)
+	}
+	count := n + 1
+	// a + t (b - a)
+	along := func(a, b []float64, t float64) []float64 {
+		x := make([]float64, n)
+		for i := range x {
+			x[i] = a[i] + t*(b[i]-a[i])
+		}
+		return x
+	}
+	for count < evaluations {
+		sort.Slice(v, func(i, j int) bool { return v[i].f < v[j].f })
+		if v[n].f-v[0].f <= 1e-12*(1+math.Abs(v[0].f)) {
+			break
+		}
+		// centroid of the best n
+		c := make([]float64, n)
+		for _, p := range v[:n] {
+			for i := range c {
+				c[i] += p.x[i] / float64(n)
+			}
+		}
+		r := point(along(c, v[n].x, -1))
+		count++
+		switch {
+		case r.f < v[0].f:
+			e := point(along(c, v[n].x, -2))
+			count++
+			if e.f < r.f {
+				v[n] = e
+			} else {
+				v[n] = r
+			}
+		case r.f < v[n-1].f:
+			v[n] = r
+		default:
+			k := point(along(c, v[n].x, 0.5))
+			count++
+			if k.f < v[n].f {
+				v[n] = k
+				continue
+			}
+			// shrink towards the best
+			for i := 1; i <= n; i++ {
+				v[i] = point(along(v[0].x, v[i].x, 0.5))
+				count++
+			}
+		}
+	}
+	sort.Slice(v, func(i, j int) bool { return v[i].f < v[j].f })
+	return v[0].x, v[0].f
+}
+
+//-----------------------------------------------------------------------------
+
+// Fit3D checks whether a part fits inside a container with a clearance, and returns the pose
+// with the largest margin found. A nil k is the default parameters (no clearance, any rotation).
+func Fit3D(part, container SDF3, k *FitParms) (*FitResult, error) {
+	if part == nil || container == nil {
+		return nil, ErrMsg("no part or container")
+	}
+	if k == nil {
+		k = &FitParms{}
+	}
+	if k.Clearance < 0 || k.Cells < 0 || k.Restarts < 0 {
+		return nil, ErrMsg("Clearance, Cells or Restarts < 0")
+	}
+	if k.Rotation < FitRotateAll || k.Rotation > FitRotateNone {
+		return nil, ErrMsg("bad Rotation")
+	}
+	cells, restarts := k.Cells, k.Restarts
+	if cells == 0 {
+		cells = 20
+	}
+	if restarts == 0 {
+		restarts = 6
+	}
+	f := &fit{
+		container: container,
+		clearance: k.Clearance,
+		rotation:  k.Rotation,
+		center:    part.BoundingBox().Center(),
+		origin:    container.BoundingBox().Center(),
+		samples:   fitSamples(part, cells),
+	}
+	if len(f.samples) == 0 {
+		return nil, ErrMsg("empty part")
+	}
+
+	// parameters: translation, and the rotation for the rotational freedom
+	size := container.BoundingBox().Size().MaxComponent()
+	step := []float64{0.1 * size, 0.1 * size, 0.1 * size}
+	switch k.Rotation {
+	case FitRotateAll:
+		step = append(step, 0.3, 0.3, 0.3)
+	case FitRotateZ:
+		step = append(step, 0.3)
+	}
+	x0 := make([]float64, len(step))
+
+	// the best starting orientations
+	type start struct {
+		r0 M44
+		f  float64
+	}
+	var starts []start
+	for _, r0 := range fitOrientations(k.Rotation) {
+		starts = append(starts, start{r0, f.violation(f.pose(r0, x0), f.samples)})
+	}
+	sort.SliceStable(starts, func(i, j int) bool { return starts[i].f < starts[j].f })
+	if len(starts) > restarts {
+		starts = starts[:restarts]
+	}
+
+	bestF := math.Inf(1)
+	var bestR M44
+	var bestX []float64
+	for _, s := range starts {
+		r0 := s.r0
+		fn := func(x []float64) float64 { return f.violation(f.pose(r0, x), f.samples) }
+		x, v := fitMinimize(fn, x0, step, 200*len(step))
+		if v < bestF {
+			bestF, bestR, bestX = v, r0, x
+		}
+		if bestF <= 0 {
+			break
+		}
+	}
+	// refine the best pose
+	fine := make([]float64, len(step))
+	for i := range fine {
+		fine[i] = 0.1 * step[i]
+	}
+	fn := func(x []float64) float64 { return f.violation(f.pose(bestR, x), f.samples) }
+	if x, v := fitMinimize(fn, bestX, fine, 200*len(step)); v < bestF {
+		bestX = x
+	}
+
+	// check with a finer sampling
+	pose := f.pose(bestR, bestX)
+	margin := -f.violation(pose, fitSamples(part, 2*cells))
+	return &FitResult{margin >= 0, pose, margin}, nil
+}
+
+//-----------------------------------------------------------------------------
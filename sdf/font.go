@@ -0,0 +1,112 @@
+//-----------------------------------------------------------------------------
+/*
+
+System Fonts
+
+Locate the installed fonts by family name. The standard font directories
+for each platform (fontconfig, DirectWrite and CoreText locations) are
+searched for truetype files and the name table of each font is matched.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+)
+
+//-----------------------------------------------------------------------------
+
+// FontDirs returns the system font directories for the current platform.
+func FontDirs() []string {
+	home, _ := os.UserHomeDir()
+	var dirs []string
+	switch runtime.GOOS {
+	case "windows":
+		dirs = append(dirs, filepath.Join(os.Getenv("WINDIR"), "Fonts"))
+		if local := os.Getenv("LOCALAPPDATA"); local != "" {
+			dirs = append(dirs, filepath.Join(local, "Microsoft", "Windows", "Fonts"))
+		}
+	case "darwin":
+		dirs = append(dirs, "/System/Library/Fonts", "/Library/Fonts")
+		if home != "" {
+			dirs = append(dirs, filepath.Join(home, "Library", "Fonts"))
+		}
+	default:
+		dirs = append(dirs, "/usr/share/fonts", "/usr/local/share/fonts")
+		if data := os.Getenv("XDG_DATA_HOME"); data != "" {
+			dirs = append(dirs, filepath.Join(data, "fonts"))
+		}
+		if home != "" {
+			dirs = append(dirs, filepath.Join(home, ".fonts"), filepath.Join(home, ".local", "share", "fonts"))
+		}
+	}
+	return dirs
+}
+
+// fontMatch returns the match quality of a font for a family name (0 = no match).
+func fontMatch(f *truetype.Font, family string) int {
+	if strings.EqualFold(f.Name(truetype.NameIDFontFullName), family) {
+		return 3
+	}
+	if strings.EqualFold(f.Name(truetype.NameIDFontFamily), family) {
+		if strings.EqualFold(f.Name(truetype.NameIDFontSubfamily), "Regular") {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// FindFont returns the filename of an installed font with the given family (or full) name.
+// The regular style of the family is preferred, e.g. "DejaVu Sans" or "DejaVu Sans Bold".
+func FindFont(family string) (string, error) {
+	best, bestMatch := "", 0
+	for _, dir := range FontDirs() {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || bestMatch == 3 {
+				return nil
+			}
+			if !strings.EqualFold(filepath.Ext(path), ".ttf") {
+				return nil
+			}
+			b, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			f, err := truetype.Parse(b)
+			if err != nil {
+				return nil
+			}
+			if m := fontMatch(f, family); m > bestMatch {
+				best, bestMatch = path, m
+			}
+			return nil
+		})
+		if bestMatch == 3 {
+			break
+		}
+	}
+	if best == "" {
+		return "", ErrMsg("font \"" + family + "\" not found")
+	}
+	return best, nil
+}
+
+// LoadSystemFont loads an installed font by family (or full) name.
+func LoadSystemFont(family string) (*truetype.Font, error) {
+	fname, err := FindFont(family)
+	if err != nil {
+		return nil, err
+	}
+	return LoadFont(fname)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,315 @@
+//-----------------------------------------------------------------------------
+/*
+
+Frustums and Wedges
+
+A frustum is the convex hull of two end sections in parallel (horizontal)
+planes. The ends are convex polygons (or points or line segments) that are
+optionally rounded: rectangles, circles, rounded rectangles, and they can
+have different sizes, rotations and offsets (for skewed frustums). This
+covers hoppers, funnels, transitions between ducts, pyramids and wedges.
+
+The sections of the frustum are the weighted Minkowski sums of the ends,
+(1-t)*base + t*top at the height t. The distance of a point outside the
+frustum is the minimum of its distance to the sections (a convex function
+of t). Inside, it is the distance to the nearest supporting plane, the
+planes being tangent to both ends. Both are exact.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// FrustumEnd is an end section of a frustum: a convex polygon (or a point or a line segment)
+// rounded by a radius.
+type FrustumEnd struct {
+	Vertex []V2    // convex polygon vertices (1: a point, 2: a line segment)
+	Radius float64 // rounding radius
+}
+
+// RectangleEnd returns a frustum end for a rectangle rotated by an angle (radians) about its center.
+func RectangleEnd(size, center V2, angle float64) FrustumEnd {
+	m := Translate2d(center).Mul(Rotate2d(angle))
+	h := size.MulScalar(0.5)
+	v := []V2{{-h.X, -h.Y}, {h.X, -h.Y}, {h.X, h.Y}, {-h.X, h.Y}}
+	for i := range v {
+		v[i] = m.MulPosition(v[i])
+	}
+	return FrustumEnd{v, 0}
+}
+
+// CircleEnd returns a frustum end for a circle.
+func CircleEnd(radius float64, center V2) FrustumEnd {
+	return FrustumEnd{[]V2{center}, radius}
+}
+
+// polygon returns the end vertices, counter-clockwise from the lowest (then leftmost) vertex.
+func (e FrustumEnd) polygon() ([]V2, error) {
+	n := len(e.Vertex)
+	if n >= 3 && e.Vertex[0].Equals(e.Vertex[n-1], tolerance) {
+		// drop the closing vertex
+		n--
+	}
+	if n == 0 {
+		return nil, ErrMsg("no vertices")
+	}
+	if e.Radius < 0 {
+		return nil, ErrMsg("radius < 0")
+	}
+	v := make([]V2, n)
+	copy(v, e.Vertex[:n])
+	if n == 2 && v[0].Equals(v[1], tolerance) {
+		v = v[:1]
+	}
+	if n >= 3 {
+		area := 0.0
+		for i := range v {
+			area += v[i].Cross(v[(i+1)%n])
+		}
+		if area < 0 {
+			for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+				v[i], v[j] = v[j], v[i]
+			}
+		}
+		for i := range v {
+			a, b, c := v[i], v[(i+1)%n], v[(i+2)%n]
+			if b.Sub(a).Cross(c.Sub(b)) <= 0 {
+				return nil, ErrMsg("polygon is not strictly convex")
+			}
+		}
+	}
+	low := 0
+	for i, p := range v {
+		if p.Y < v[low].Y || (p.Y == v[low].Y && p.X < v[low].X) {
+			low = i
+		}
+	}
+	return append(v[low:], v[:low]...), nil
+}
+
+// frustumEdgeAngles returns the direction angles (0..2pi, increasing) of the edges of a polygon.
+func frustumEdgeAngles(v []V2) []float64 {
+	if len(v) < 2 {
+		return nil
+	}
+	a := make([]float64, len(v))
+	for i := range v {
+		e := v[(i+1)%len(v)].Sub(v[i])
+		a[i] = math.Atan2(e.Y, e.X)
+		if a[i] < 0 || (i != 0 && a[i] == 0) {
+			a[i] += Tau
+		}
+	}
+	return a
+}
+
+//-----------------------------------------------------------------------------
+
+// FrustumSDF3 is the convex hull of two end sections.
+type FrustumSDF3 struct {
+	a, b   []V2      // base and top vertices of each section vertex
+	angle  []float64 // direction angles of the section edges (a[k] to a[k+1])
+	r0, r1 float64   // base and top radius
+	height float64   // half height
+	bb     Box3
+}
+
+// Frustum3D returns an SDF3 for the convex hull of a base end (at -height/2) and
+// a top end (at height/2).
+func Frustum3D(base, top FrustumEnd, height float64) (SDF3, error) {
+	if height <= 0 {
+		return nil, ErrMsg("height <= 0")
+	}
+	va, err := base.polygon()
+	if err != nil {
+		return nil, err
+	}
+	vb, err := top.polygon()
+	if err != nil {
+		return nil, err
+	}
+	if len(va) == 1 && len(vb) == 1 && base.Radius == 0 && top.Radius == 0 {
+		return nil, ErrMsg("the ends are points")
+	}
+	s := FrustumSDF3{}
+	s.r0, s.r1 = base.Radius, top.Radius
+	s.height = height / 2
+	// merge the edges of the ends in angle order (the edges of the Minkowski sums)
+	angA, angB := frustumEdgeAngles(va), frustumEdgeAngles(vb)
+	const eps = 1e-12
+	i, j := 0, 0
+	for {
+		s.a = append(s.a, va[i%len(va)])
+		s.b = append(s.b, vb[j%len(vb)])
+		if i >= len(angA) && j >= len(angB) {
+			break
+		}
+		if j >= len(angB) || (i < len(angA) && angA[i] < angB[j]-eps) {
+			s.angle = append(s.angle, angA[i])
+			i++
+		} else if i >= len(angA) || angB[j] < angA[i]-eps {
+			s.angle = append(s.angle, angB[j])
+			j++
+		} else {
+			s.angle = append(s.angle, angA[i])
+			i++
+			j++
+		}
+		if i >= len(angA) && j >= len(angB) {
+			break
+		}
+	}
+	bb := Box2{va[0], va[0]}
+	for _, p := range va {
+		bb = bb.Include(p)
+	}
+	bbTop := Box2{vb[0], vb[0]}
+	for _, p := range vb {
+		bbTop = bbTop.Include(p)
+	}
+	bb = bb.Enlarge(V2{2 * s.r0, 2 * s.r0}).Extend(bbTop.Enlarge(V2{2 * s.r1, 2 * s.r1}))
+	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
+	return &s, nil
+}
+
+// Wedge3D returns an SDF3 for a wedge with a rectangular base (size.X by size.Y) and a ridge
+// (parallel to the x-axis) at the top, at a y position between -size.Y/2 and size.Y/2.
+// A ridge at -size.Y/2 (or size.Y/2) gives a right angled wedge, at 0 a symmetric roof.
+func Wedge3D(size V3, ridge float64) (SDF3, error) {
+	if size.LTEZero() {
+		return nil, ErrMsg("size <= 0")
+	}
+	if math.Abs(ridge) > size.Y/2 {
+		return nil, ErrMsg("ridge is outside the base")
+	}
+	top := FrustumEnd{[]V2{{-size.X / 2, ridge}, {size.X / 2, ridge}}, 0}
+	return Frustum3D(RectangleEnd(V2{size.X, size.Y}, V2{}, 0), top, size.Z)
+}
+
+//-----------------------------------------------------------------------------
+
+// section returns the distance to the section at t (0: base, 1: top) within its plane.
+func (s *FrustumSDF3) section(p V2, t float64) float64 {
+	n := len(s.a)
+	q0 := s.a[0].Add(s.b[0].Sub(s.a[0]).MulScalar(t))
+	dd := math.Inf(1)
+	inside := n > 1
+	for k, qk := 0, q0; k < n; k++ {
+		j := (k + 1) % n
+		qj := s.a[j].Add(s.b[j].Sub(s.a[j]).MulScalar(t))
+		e := qj.Sub(qk)
+		if l2 := e.Length2(); l2 > 0 {
+			pq := p.Sub(qk)
+			if e.Cross(pq) < 0 {
+				inside = false
+			}
+			u := Clamp(pq.Dot(e)/l2, 0, 1)
+			dd = math.Min(dd, pq.Sub(e.MulScalar(u)).Length2())
+		}
+		qk = qj
+	}
+	r := s.r0 + (s.r1-s.r0)*t
+	if math.IsInf(dd, 1) {
+		// the section is a point
+		return p.Sub(q0).Length() - r
+	}
+	if inside {
+		return -math.Sqrt(dd) - r
+	}
+	return math.Sqrt(dd) - r
+}
+
+// plane returns the signed distance to the supporting plane with the (horizontal) normal
+// direction theta, touching the ends at vertex k.
+func (s *FrustumSDF3) plane(p V3, k int, theta float64) float64 {
+	n := V2{math.Cos(theta), math.Sin(theta)}
+	c0 := n.Dot(s.a[k]) + s.r0
+	dc := n.Dot(s.b[k]) + s.r1 - c0
+	t := (p.Z + s.height) / (2 * s.height)
+	return (n.Dot(V2{p.X, p.Y}) - c0 - dc*t) / math.Sqrt(1+dc*dc/(4*s.height*s.height))
+}
+
+// frustumSamples is the number of samples of the supporting plane angles for each vertex.
+const frustumSamples = 8
+
+// inside returns the (negative) distance of an inside point to the frustum surface.
+func (s *FrustumSDF3) inside(p V3) float64 {
+	d := math.Abs(p.Z) - s.height
+	n := len(s.a)
+	for k := 0; k < n; k++ {
+		// the normals of the supporting planes at vertex k are between the normals of its edges
+		lo, hi := 0.0, Tau
+		if len(s.angle) != 0 {
+			lo = s.angle[(k+n-1)%n] - Pi/2
+			hi = s.angle[k] - Pi/2
+			if hi < lo {
+				hi += Tau
+			}
+		}
+		d = math.Max(d, math.Max(s.plane(p, k, lo), s.plane(p, k, hi)))
+		if s.r0 == 0 && s.r1 == 0 {
+			// the planes of the faces (at the ends of the ranges) are the only supporting planes
+			continue
+		}
+		// sample the range then refine the best sample
+		best, bestTheta := math.Inf(-1), lo
+		step := (hi - lo) / frustumSamples
+		for i := 0; i <= frustumSamples; i++ {
+			if x := s.plane(p, k, lo+float64(i)*step); x > best {
+				best, bestTheta = x, lo+float64(i)*step
+			}
+		}
+		a, b := bestTheta-step, bestTheta+step
+		if len(s.angle) != 0 {
+			a, b = math.Max(lo, a), math.Min(hi, b)
+		}
+		theta := goldenMax(func(x float64) float64 { return s.plane(p, k, x) }, a, b)
+		d = math.Max(d, math.Max(best, s.plane(p, k, theta)))
+	}
+	return d
+}
+
+// goldenMax returns the maximum of a unimodal function on a..b (golden section search).
+func goldenMax(f func(float64) float64, a, b float64) float64 {
+	const g = 0.6180339887498949
+	x1, x2 := b-g*(b-a), a+g*(b-a)
+	f1, f2 := f(x1), f(x2)
+	for i := 0; i < 80 && b-a > 1e-12; i++ {
+		if f1 < f2 {
+			a, x1, f1 = x1, x2, f2
+			x2 = a + g*(b-a)
+			f2 = f(x2)
+		} else {
+			b, x2, f2 = x2, x1, f1
+			x1 = b - g*(b-a)
+			f1 = f(x1)
+		}
+	}
+	return (a + b) / 2
+}
+
+// Evaluate returns the minimum distance to a frustum.
+func (s *FrustumSDF3) Evaluate(p V3) float64 {
+	q := V2{p.X, p.Y}
+	h2 := 2 * s.height
+	if t := (p.Z + s.height) / h2; t >= 0 && t <= 1 && s.section(q, t) <= 0 {
+		return s.inside(p)
+	}
+	// the distance to the section at t is a convex function of t
+	dist := func(t float64) float64 {
+		return math.Hypot(math.Max(s.section(q, t), 0), p.Z+s.height-t*h2)
+	}
+	t := goldenMax(func(t float64) float64 { return -dist(t) }, 0, 1)
+	return math.Min(dist(t), math.Min(dist(0), dist(1)))
+}
+
+// BoundingBox returns the bounding box of a frustum.
+func (s *FrustumSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,364 @@
+//-----------------------------------------------------------------------------
+/*
+
+SDF Gradients
+
+Analytic gradients for primitives, propagated through transforms and
+booleans with the chain rule. SDFs without an analytic gradient fall back
+to central differences (6 evaluations for an SDF3).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// SDF3Gradient is implemented by SDF3s with an analytic gradient.
+type SDF3Gradient interface {
+	Gradient(p V3) V3
+}
+
+// SDF2Gradient is implemented by SDF2s with an analytic gradient.
+type SDF2Gradient interface {
+	Gradient(p V2) V2
+}
+
+// sdf3GradientEps is implemented by composite SDF3s, passing the central difference
+// step down to their children.
+type sdf3GradientEps interface {
+	gradient(p V3, eps float64) V3
+}
+
+// sdf2GradientEps is implemented by composite SDF2s, passing the central difference
+// step down to their children.
+type sdf2GradientEps interface {
+	gradient(p V2, eps float64) V2
+}
+
+// gradientEpsilon is the central difference step of the Gradient methods of composite SDFs.
+const gradientEpsilon = 1e-6
+
+// Gradient3 returns the gradient of an SDF3 at a point.
+// The analytic gradient is used if available, otherwise it is
+// computed with central differences using a step of eps.
+func Gradient3(s SDF3, p V3, eps float64) V3 {
+	if g, ok := s.(sdf3GradientEps); ok {
+		return g.gradient(p, eps)
+	}
+	if g, ok := s.(SDF3Gradient); ok {
+		return g.Gradient(p)
+	}
+	return centralDifference3(s.Evaluate, p, eps)
+}
+
+// Gradient2 returns the gradient of an SDF2 at a point.
+// The analytic gradient is used if available, otherwise it is
+// computed with central differences using a step of eps.
+func Gradient2(s SDF2, p V2, eps float64) V2 {
+	if g, ok := s.(sdf2GradientEps); ok {
+		return g.gradient(p, eps)
+	}
+	if g, ok := s.(SDF2Gradient); ok {
+		return g.Gradient(p)
+	}
+	return V2{
+		X: s.Evaluate(p.Add(V2{X: eps})) - s.Evaluate(p.Add(V2{X: -eps})),
+		Y: s.Evaluate(p.Add(V2{Y: eps})) - s.Evaluate(p.Add(V2{Y: -eps})),
+	}.DivScalar(2 * eps)
+}
+
+// centralDifference3 returns the gradient of a function using central differences.
+func centralDifference3(f func(V3) float64, p V3, eps float64) V3 {
+	return V3{
+		X: f(p.Add(V3{X: eps})) - f(p.Add(V3{X: -eps})),
+		Y: f(p.Add(V3{Y: eps})) - f(p.Add(V3{Y: -eps})),
+		Z: f(p.Add(V3{Z: eps})) - f(p.Add(V3{Z: -eps})),
+	}.DivScalar(2 * eps)
+}
+
+//-----------------------------------------------------------------------------
+
+// signV3 returns the component-wise sign of a vector (0 maps to 1).
+func signV3(a V3) V3 {
+	s := V3{1, 1, 1}
+	if a.X < 0 {
+		s.X = -1
+	}
+	if a.Y < 0 {
+		s.Y = -1
+	}
+	if a.Z < 0 {
+		s.Z = -1
+	}
+	return s
+}
+
+// signV2 returns the component-wise sign of a vector (0 maps to 1).
+func signV2(a V2) V2 {
+	s := V2{1, 1}
+	if a.X < 0 {
+		s.X = -1
+	}
+	if a.Y < 0 {
+		s.Y = -1
+	}
+	return s
+}
+
+// mulTransposeDirection multiplies a direction by the transpose of the 3x3 linear part of the matrix.
+func (a M44) mulTransposeDirection(v V3) V3 {
+	return V3{
+		a.x00*v.X + a.x10*v.Y + a.x20*v.Z,
+		a.x01*v.X + a.x11*v.Y + a.x21*v.Z,
+		a.x02*v.X + a.x12*v.Y + a.x22*v.Z,
+	}
+}
+
+// mulTransposeDirection multiplies a direction by the transpose of the 2x2 linear part of the matrix.
+func (a M33) mulTransposeDirection(v V2) V2 {
+	return V2{
+		a.x00*v.X + a.x10*v.Y,
+		a.x01*v.X + a.x11*v.Y,
+	}
+}
+
+// gradBox3d returns the gradient of sdfBox3d.
+func gradBox3d(p, s V3) V3 {
+	d := p.Abs().Sub(s)
+	sgn := signV3(p)
+	if d.X > 0 || d.Y > 0 || d.Z > 0 {
+		// outside: the direction from the closest box point
+		q := d.Max(V3{0, 0, 0})
+		return q.Mul(sgn).DivScalar(q.Length())
+	}
+	// inside: the normal of the closest face
+	if d.X >= d.Y && d.X >= d.Z {
+		return V3{sgn.X, 0, 0}
+	}
+	if d.Y >= d.Z {
+		return V3{0, sgn.Y, 0}
+	}
+	return V3{0, 0, sgn.Z}
+}
+
+// gradBox2d returns the gradient of sdfBox2d.
+func gradBox2d(p, s V2) V2 {
+	sgn := signV2(p)
+	p = p.Abs()
+	d := p.Sub(s)
+	if d.X > 0 && d.Y > 0 {
+		return d.Mul(sgn).DivScalar(d.Length())
+	}
+	if p.Y-p.X > s.Y-s.X {
+		return V2{0, sgn.Y}
+	}
+	return V2{sgn.X, 0}
+}
+
+//-----------------------------------------------------------------------------
+// SDF2 gradients
+
+// Gradient returns the gradient of a 2d circle.
+func (s *CircleSDF2) Gradient(p V2) V2 {
+	l := p.Length()
+	if l == 0 {
+		return V2{1, 0}
+	}
+	return p.DivScalar(l)
+}
+
+// Gradient returns the gradient of a 2d box.
+func (s *BoxSDF2) Gradient(p V2) V2 {
+	return gradBox2d(p, s.size)
+}
+
+// Gradient returns the gradient of an offset SDF2.
+func (s *OffsetSDF2) Gradient(p V2) V2 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of an offset SDF2, with a central difference step of eps.
+func (s *OffsetSDF2) gradient(p V2, eps float64) V2 {
+	return Gradient2(s.sdf, p, eps)
+}
+
+// Gradient returns the gradient of a transformed SDF2.
+func (s *TransformSDF2) Gradient(p V2) V2 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of a transformed SDF2, with a central difference step of eps.
+func (s *TransformSDF2) gradient(p V2, eps float64) V2 {
+	q := s.mInv.MulPosition(p)
+	return s.mInv.mulTransposeDirection(Gradient2(s.sdf, q, eps))
+}
+
+// Gradient returns the gradient of a uniformly scaled SDF2.
+func (s *ScaleUniformSDF2) Gradient(p V2) V2 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of a uniformly scaled SDF2, with a central difference step of eps.
+func (s *ScaleUniformSDF2) gradient(p V2, eps float64) V2 {
+	return Gradient2(s.sdf, p.MulScalar(s.invk), eps)
+}
+
+//-----------------------------------------------------------------------------
+// SDF3 gradients
+
+// Gradient returns the gradient of a sphere.
+func (s *SphereSDF3) Gradient(p V3) V3 {
+	l := p.Length()
+	if l == 0 {
+		return V3{0, 0, 1}
+	}
+	return p.DivScalar(l)
+}
+
+// Gradient returns the gradient of a 3d box.
+func (s *BoxSDF3) Gradient(p V3) V3 {
+	return gradBox3d(p, s.size)
+}
+
+// Gradient returns the gradient of a cylinder.
+func (s *CylinderSDF3) Gradient(p V3) V3 {
+	r := V2{p.X, p.Y}.Length()
+	g := gradBox2d(V2{r, p.Z}, V2{s.radius, s.height})
+	if r == 0 {
+		return V3{0, 0, g.Y}
+	}
+	return V3{g.X * p.X / r, g.X * p.Y / r, g.Y}
+}
+
+// Gradient returns the gradient of an extrusion.
+func (s *ExtrudeSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of an extrusion, with a central difference step of eps.
+func (s *ExtrudeSDF3) gradient(p V3, eps float64) V3 {
+	a := s.sdf.Evaluate(s.project(p))
+	b := math.Abs(p.Z) - s.height
+	if b > a {
+		if p.Z < 0 {
+			return V3{0, 0, -1}
+		}
+		return V3{0, 0, 1}
+	}
+	// the extrude function may warp the xy plane, use central differences
+	f := func(q V3) float64 { return s.sdf.Evaluate(s.project(q)) }
+	return centralDifference3(f, p, eps)
+}
+
+// Gradient returns the gradient of a transformed SDF3.
+func (s *TransformSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of a transformed SDF3, with a central difference step of eps.
+func (s *TransformSDF3) gradient(p V3, eps float64) V3 {
+	q := s.inverse.MulPosition(p)
+	return s.inverse.mulTransposeDirection(Gradient3(s.sdf, q, eps))
+}
+
+// Gradient returns the gradient of a uniformly scaled SDF3.
+func (s *ScaleUniformSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of a uniformly scaled SDF3, with a central difference step of eps.
+func (s *ScaleUniformSDF3) gradient(p V3, eps float64) V3 {
+	return Gradient3(s.sdf, p.MulScalar(s.invK), eps)
+}
+
+// Gradient returns the gradient of an offset SDF3.
+func (s *OffsetSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of an offset SDF3, with a central difference step of eps.
+func (s *OffsetSDF3) gradient(p V3, eps float64) V3 {
+	return Gradient3(s.sdf, p, eps)
+}
+
+// Gradient returns the gradient of a shelled SDF3.
+func (s *ShellSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of a shelled SDF3, with a central difference step of eps.
+func (s *ShellSDF3) gradient(p V3, eps float64) V3 {
+	g := Gradient3(s.sdf, p, eps)
+	if s.sdf.Evaluate(p) < 0 {
+		return g.Neg()
+	}
+	return g
+}
+
+// Gradient returns the gradient of an SDF3 union.
+func (s *UnionSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of an SDF3 union, with a central difference step of eps.
+func (s *UnionSDF3) gradient(p V3, eps float64) V3 {
+	if !isMathMin(s.min) {
+		// blended union: no simple chain rule
+		return centralDifference3(s.Evaluate, p, eps)
+	}
+	var d float64
+	var closest SDF3
+	for i, x := range s.sdf {
+		dx := x.Evaluate(p)
+		if i == 0 || dx < d {
+			d = dx
+			closest = x
+		}
+	}
+	return Gradient3(closest, p, eps)
+}
+
+// Gradient returns the gradient of an SDF3 difference.
+func (s *DifferenceSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of an SDF3 difference, with a central difference step of eps.
+func (s *DifferenceSDF3) gradient(p V3, eps float64) V3 {
+	a := s.s0.Evaluate(p)
+	b := -s.s1.Evaluate(p)
+	d := s.max(a, b)
+	if d == a && d != b {
+		return Gradient3(s.s0, p, eps)
+	}
+	if d == b && d != a {
+		return Gradient3(s.s1, p, eps).Neg()
+	}
+	// blended (or tied) difference: no simple chain rule
+	return centralDifference3(s.Evaluate, p, eps)
+}
+
+// Gradient returns the gradient of an SDF3 intersection.
+func (s *IntersectionSDF3) Gradient(p V3) V3 {
+	return s.gradient(p, gradientEpsilon)
+}
+
+// gradient returns the gradient of an SDF3 intersection, with a central difference step of eps.
+func (s *IntersectionSDF3) gradient(p V3, eps float64) V3 {
+	a := s.s0.Evaluate(p)
+	b := s.s1.Evaluate(p)
+	d := s.max(a, b)
+	if d == a && d != b {
+		return Gradient3(s.s0, p, eps)
+	}
+	if d == b && d != a {
+		return Gradient3(s.s1, p, eps)
+	}
+	// blended (or tied) intersection: no simple chain rule
+	return centralDifference3(s.Evaluate, p, eps)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,110 @@
+//-----------------------------------------------------------------------------
+/*
+
+Sampled Distance Grids
+
+A regular 3d grid of distance values with trilinear interpolation.
+Used by operations that work on a discretized distance field.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// grid3 is a regular grid of values sampled at the nodes of a box.
+type grid3 struct {
+	bb    Box3      // grid bounding box (nodes on the box faces)
+	n     V3i       // number of nodes on each axis
+	step  V3        // node spacing on each axis
+	value []float64 // node values (x major, z minor)
+}
+
+// newGrid3 returns an empty grid with cells of (approximately) the given size.
+func newGrid3(bb Box3, cellSize float64) *grid3 {
+	size := bb.Size()
+	cells := size.DivScalar(cellSize).Ceil().ToV3i()
+	for i := range cells {
+		if cells[i] < 1 {
+			cells[i] = 1
+		}
+	}
+	g := grid3{
+		bb:   bb,
+		n:    cells.AddScalar(1),
+		step: size.Div(cells.ToV3()),
+	}
+	g.value = make([]float64, g.n[0]*g.n[1]*g.n[2])
+	return &g
+}
+
+// index returns the value index for a node.
+func (g *grid3) index(i, j, k int) int {
+	return (i*g.n[1]+j)*g.n[2] + k
+}
+
+// position returns the position of a node.
+func (g *grid3) position(i, j, k int) V3 {
+	return g.bb.Min.Add(g.step.Mul(V3{float64(i), float64(j), float64(k)}))
+}
+
+// sample evaluates an SDF3 at all grid nodes.
+func (g *grid3) sample(s SDF3) {
+	for i := 0; i < g.n[0]; i++ {
+		for j := 0; j < g.n[1]; j++ {
+			for k := 0; k < g.n[2]; k++ {
+				g.value[g.index(i, j, k)] = s.Evaluate(g.position(i, j, k))
+			}
+		}
+	}
+}
+
+// interpolate returns the trilinear interpolated value at a point.
+// Points outside the grid are clamped to the grid box and the distance to the box is added.
+func (g *grid3) interpolate(p V3) float64 {
+	q := p.Clamp(g.bb.Min, g.bb.Max)
+	extra := p.Sub(q).Length()
+	// find the cell and the position within it
+	u := q.Sub(g.bb.Min).Div(g.step)
+	i := int(math.Min(math.Floor(u.X), float64(g.n[0]-2)))
+	j := int(math.Min(math.Floor(u.Y), float64(g.n[1]-2)))
+	k := int(math.Min(math.Floor(u.Z), float64(g.n[2]-2)))
+	d := u.Sub(V3{float64(i), float64(j), float64(k)})
+	c000 := g.value[g.index(i, j, k)]
+	c001 := g.value[g.index(i, j, k+1)]
+	c010 := g.value[g.index(i, j+1, k)]
+	c011 := g.value[g.index(i, j+1, k+1)]
+	c100 := g.value[g.index(i+1, j, k)]
+	c101 := g.value[g.index(i+1, j, k+1)]
+	c110 := g.value[g.index(i+1, j+1, k)]
+	c111 := g.value[g.index(i+1, j+1, k+1)]
+	c00 := Mix(c000, c100, d.X)
+	c01 := Mix(c001, c101, d.X)
+	c10 := Mix(c010, c110, d.X)
+	c11 := Mix(c011, c111, d.X)
+	c0 := Mix(c00, c10, d.Y)
+	c1 := Mix(c01, c11, d.Y)
+	return Mix(c0, c1, d.Z) + extra
+}
+
+//-----------------------------------------------------------------------------
+
+// GridSDF3 is an SDF3 backed by a regular grid of sampled distances.
+type GridSDF3 struct {
+	grid *grid3
+}
+
+// Evaluate returns the interpolated minimum distance to a grid SDF3.
+func (s *GridSDF3) Evaluate(p V3) float64 {
+	return s.grid.interpolate(p)
+}
+
+// BoundingBox returns the bounding box of a grid SDF3.
+func (s *GridSDF3) BoundingBox() Box3 {
+	return s.grid.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,294 @@
+//-----------------------------------------------------------------------------
+/*
+
+OpenType Glyph Substitution
+
+A minimal reader for the OpenType GSUB table, enough to apply features
+like ligatures (liga, dlig) and small caps (smcp, c2sc) to a line of text.
+Single (type 1), ligature (type 4) and extension (type 7) lookups are
+supported. The truetype package doesn't read this table, so it's parsed
+from the font file data.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+)
+
+//-----------------------------------------------------------------------------
+
+// gsubData is a font buffer with bounds checked big endian reads.
+type gsubData []byte
+
+func (b gsubData) u16(ofs int) int {
+	if ofs < 0 || ofs+2 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b[ofs:]))
+}
+
+func (b gsubData) u32(ofs int) int {
+	if ofs < 0 || ofs+4 > len(b) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b[ofs:]))
+}
+
+func (b gsubData) tag(ofs int) string {
+	if ofs < 0 || ofs+4 > len(b) {
+		return ""
+	}
+	return string(b[ofs : ofs+4])
+}
+
+// coverage returns the coverage index of a glyph (-1 if not covered).
+func (b gsubData) coverage(ofs int, g truetype.Index) int {
+	switch b.u16(ofs) {
+	case 1:
+		n := b.u16(ofs + 2)
+		for i := 0; i < n; i++ {
+			if b.u16(ofs+4+2*i) == int(g) {
+				return i
+			}
+		}
+	case 2:
+		n := b.u16(ofs + 2)
+		for i := 0; i < n; i++ {
+			r := ofs + 4 + 6*i
+			start, end := b.u16(r), b.u16(r+2)
+			if int(g) >= start && int(g) <= end {
+				return b.u16(r+4) + int(g) - start
+			}
+		}
+	}
+	return -1
+}
+
+//-----------------------------------------------------------------------------
+
+// gsubTable is the GSUB table of a font.
+type gsubTable struct {
+	b gsubData
+}
+
+// newGSUB returns the GSUB table from the font file data (nil if there isn't one).
+func newGSUB(font []byte) *gsubTable {
+	b := gsubData(font)
+	n := b.u16(4)
+	for i := 0; i < n; i++ {
+		r := 12 + 16*i
+		if b.tag(r) == "GSUB" {
+			ofs, length := b.u32(r+8), b.u32(r+12)
+			if ofs+length > len(b) {
+				return nil
+			}
+			return &gsubTable{b[ofs : ofs+length]}
+		}
+	}
+	return nil
+}
+
+// featureIndices returns the feature indices of the default language system.
+// DFLT is preferred, then latn, then all features in the table.
+func (t *gsubTable) featureIndices() []int {
+	b := t.b
+	scripts := b.u16(4)
+	n := b.u16(scripts)
+	for _, want := range []string{"DFLT", "latn"} {
+		for i := 0; i < n; i++ {
+			r := scripts + 2 + 6*i
+			if b.tag(r) != want {
+				continue
+			}
+			script := scripts + b.u16(r+4)
+			if b.u16(script) == 0 {
+				// no default language system
+				continue
+			}
+			lang := script + b.u16(script)
+			count := b.u16(lang + 4)
+			idx := make([]int, count)
+			for j := range idx {
+				idx[j] = b.u16(lang + 6 + 2*j)
+			}
+			return idx
+		}
+	}
+	idx := make([]int, b.u16(b.u16(6)))
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+// lookups returns the sorted lookup indices for a set of feature tags.
+func (t *gsubTable) lookups(tags []string) []int {
+	b := t.b
+	features := b.u16(6)
+	want := make(map[string]bool)
+	for _, tag := range tags {
+		want[tag] = true
+	}
+	set := make(map[int]bool)
+	for _, i := range t.featureIndices() {
+		r := features + 2 + 6*i
+		if !want[b.tag(r)] {
+			continue
+		}
+		f := features + b.u16(r+4)
+		n := b.u16(f + 2)
+		for j := 0; j < n; j++ {
+			set[b.u16(f+4+2*j)] = true
+		}
+	}
+	var lookups []int
+	for i := range set {
+		lookups = append(lookups, i)
+	}
+	sort.Ints(lookups)
+	return lookups
+}
+
+// subtables returns the lookup type and subtable offsets for a lookup.
+// Extension subtables are resolved to the subtables they contain.
+func (t *gsubTable) subtables(lookup int) (int, []int) {
+	b := t.b
+	list := b.u16(8)
+	if lookup >= b.u16(list) {
+		return 0, nil
+	}
+	l := list + b.u16(list+2+2*lookup)
+	kind := b.u16(l)
+	extension := kind == 7
+	n := b.u16(l + 4)
+	subs := make([]int, n)
+	for i := range subs {
+		subs[i] = l + b.u16(l+6+2*i)
+		if extension {
+			// extension: the real lookup type and a 32 bit offset
+			kind = b.u16(subs[i] + 2)
+			subs[i] += b.u32(subs[i] + 4)
+		}
+	}
+	return kind, subs
+}
+
+// single applies a single substitution subtable to a glyph.
+func (t *gsubTable) single(sub int, g truetype.Index) (truetype.Index, bool) {
+	b := t.b
+	i := b.coverage(sub+b.u16(sub+2), g)
+	if i < 0 {
+		return g, false
+	}
+	switch b.u16(sub) {
+	case 1:
+		delta := int16(b.u16(sub + 4))
+		return truetype.Index(int(g) + int(delta)), true
+	case 2:
+		if i < b.u16(sub+4) {
+			return truetype.Index(b.u16(sub + 6 + 2*i)), true
+		}
+	}
+	return g, false
+}
+
+// ligature applies a ligature substitution subtable at the start of a glyph sequence.
+// It returns the ligature glyph and the number of glyphs it replaces.
+func (t *gsubTable) ligature(sub int, gs []truetype.Index) (truetype.Index, int) {
+	b := t.b
+	i := b.coverage(sub+b.u16(sub+2), gs[0])
+	if i < 0 || b.u16(sub) != 1 || i >= b.u16(sub+4) {
+		return 0, 0
+	}
+	set := sub + b.u16(sub+6+2*i)
+	n := b.u16(set)
+	for j := 0; j < n; j++ {
+		lig := set + b.u16(set+2+2*j)
+		count := b.u16(lig + 2)
+		if count == 0 || count > len(gs) {
+			continue
+		}
+		match := true
+		for k := 1; k < count; k++ {
+			if b.u16(lig+4+2*(k-1)) != int(gs[k]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return truetype.Index(b.u16(lig)), count
+		}
+	}
+	return 0, 0
+}
+
+// apply applies the lookups for a set of feature tags to a glyph sequence.
+func (t *gsubTable) apply(tags []string, gs []truetype.Index) []truetype.Index {
+	for _, lookup := range t.lookups(tags) {
+		kind, subs := t.subtables(lookup)
+		switch kind {
+		case 1:
+			for i := range gs {
+				for _, sub := range subs {
+					if g, ok := t.single(sub, gs[i]); ok {
+						gs[i] = g
+						break
+					}
+				}
+			}
+		case 4:
+			var out []truetype.Index
+			for i := 0; i < len(gs); {
+				n := 0
+				for _, sub := range subs {
+					var g truetype.Index
+					if g, n = t.ligature(sub, gs[i:]); n > 0 {
+						out = append(out, g)
+						break
+					}
+				}
+				if n == 0 {
+					out = append(out, gs[i])
+					n = 1
+				}
+				i += n
+			}
+			gs = out
+		}
+	}
+	return gs
+}
+
+//-----------------------------------------------------------------------------
+
+// FontFeatures are the OpenType substitution features of a font (see Text.SetFeatures).
+type FontFeatures struct {
+	gsub *gsubTable
+}
+
+// ParseFontFeatures returns the substitution features of font data.
+func ParseFontFeatures(b []byte) (*FontFeatures, error) {
+	t := newGSUB(b)
+	if t == nil {
+		return nil, ErrMsg("no GSUB table")
+	}
+	return &FontFeatures{t}, nil
+}
+
+// LoadFontFeatures loads the substitution features of a font file.
+func LoadFontFeatures(fname string) (*FontFeatures, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFontFeatures(b)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,126 @@
+//-----------------------------------------------------------------------------
+/*
+
+NaN/Inf Guards
+
+A NaN or Inf distance (e.g. 0/0 in a user SDF) silently corrupts meshes.
+Guard every node of an SDF tree so the first bad value seen by each node
+is reported as a warning with the input point and the path of the node.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+//-----------------------------------------------------------------------------
+
+// isFinite returns true if x is not NaN or Inf.
+func isFinite(x float64) bool {
+	return !math.IsNaN(x) && !math.IsInf(x, 0)
+}
+
+// guard wraps an SDF node with a guard.
+func guard(s interface{}, path string) interface{} {
+	switch s := s.(type) {
+	case SDF3:
+		bb := s.BoundingBox()
+		if !isFinite(bb.Min.Add(bb.Max).Length()) {
+			Warn(&Warning{Kind: WarnNonFinite, Path: path, Msg: fmt.Sprintf("bounding box is %v", bb)})
+		}
+		return &GuardSDF3{sdf: s, path: path}
+	case SDF2:
+		bb := s.BoundingBox()
+		if !isFinite(bb.Min.Add(bb.Max).Length()) {
+			Warn(&Warning{Kind: WarnNonFinite, Path: path, Msg: fmt.Sprintf("bounding box is %v", bb)})
+		}
+		return &GuardSDF2{sdf: s, path: path}
+	}
+	return s
+}
+
+// childReported returns true if a guarded child of the node has reported a bad value.
+func childReported(s interface{}) bool {
+	for _, c := range Children(s) {
+		switch c := c.(type) {
+		case *GuardSDF3:
+			if atomic.LoadInt32(&c.reported) != 0 {
+				return true
+			}
+		case *GuardSDF2:
+			if atomic.LoadInt32(&c.reported) != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//-----------------------------------------------------------------------------
+
+// GuardSDF3 reports NaN/Inf distances returned by an SDF3.
+type GuardSDF3 struct {
+	sdf      SDF3
+	path     string // path of the guarded node
+	reported int32  // set once a bad value has been seen
+}
+
+// Guard3D returns a copy of an SDF3 tree with every node guarded against NaN/Inf distances.
+// A bad value is only reported by the node that produced it, not by the nodes above it.
+func Guard3D(s SDF3) SDF3 {
+	return copyTree(s, NodeName(s), guard).(SDF3)
+}
+
+// Evaluate returns the minimum distance to a guarded SDF3.
+func (s *GuardSDF3) Evaluate(p V3) float64 {
+	d := s.sdf.Evaluate(p)
+	if !isFinite(d) && atomic.CompareAndSwapInt32(&s.reported, 0, 1) && !childReported(s.sdf) {
+		Warn(&Warning{Kind: WarnNonFinite, Path: s.path, Point: p, Msg: fmt.Sprintf("distance is %v", d)})
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a guarded SDF3.
+func (s *GuardSDF3) BoundingBox() Box3 {
+	return s.sdf.BoundingBox()
+}
+
+func (s *GuardSDF3) children() []interface{} { return []interface{}{&s.sdf} }
+
+//-----------------------------------------------------------------------------
+
+// GuardSDF2 reports NaN/Inf distances returned by an SDF2.
+type GuardSDF2 struct {
+	sdf      SDF2
+	path     string // path of the guarded node
+	reported int32  // set once a bad value has been seen
+}
+
+// Guard2D returns a copy of an SDF2 tree with every node guarded against NaN/Inf distances.
+// A bad value is only reported by the node that produced it, not by the nodes above it.
+func Guard2D(s SDF2) SDF2 {
+	return copyTree(s, NodeName(s), guard).(SDF2)
+}
+
+// Evaluate returns the minimum distance to a guarded SDF2.
+func (s *GuardSDF2) Evaluate(p V2) float64 {
+	d := s.sdf.Evaluate(p)
+	if !isFinite(d) && atomic.CompareAndSwapInt32(&s.reported, 0, 1) && !childReported(s.sdf) {
+		Warn(&Warning{Kind: WarnNonFinite, Path: s.path, Point: V3{p.X, p.Y, 0}, Msg: fmt.Sprintf("distance is %v", d)})
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a guarded SDF2.
+func (s *GuardSDF2) BoundingBox() Box2 {
+	return s.sdf.BoundingBox()
+}
+
+func (s *GuardSDF2) children() []interface{} { return []interface{}{&s.sdf} }
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,179 @@
+//-----------------------------------------------------------------------------
+/*
+
+Model Hashing
+
+A hash of an SDF tree and all of its parameters, used to identify an
+unchanged model (e.g. as a cache key). The hash is computed by walking the
+node values with reflection. Functions are identified by name. The values
+captured by a closure (e.g. the blend functions made by RoundMin(k), or
+a custom extrude function) can't be hashed, so a tree with a closure is
+uncacheable: see CacheKey.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"math"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+var (
+	sdf2Type = reflect.TypeOf((*SDF2)(nil)).Elem()
+	sdf3Type = reflect.TypeOf((*SDF3)(nil)).Elem()
+)
+
+// closureName matches the runtime names of closures and method values.
+var closureName = regexp.MustCompile(`\.func\d+(\.\d+)*$|-fm$`)
+
+// isClosure returns true if a (non-nil) function may capture values.
+func isClosure(v reflect.Value) bool {
+	f := runtime.FuncForPC(v.Pointer())
+	return f == nil || closureName.MatchString(f.Name())
+}
+
+type modelHasher struct {
+	h       hash.Hash
+	visited map[uintptr]int // pointer to visit order (handles shared and cyclic values)
+	node    bool            // hash a single node: skip its children and derived bounding boxes
+	opaque  bool            // a closure was found, the hash doesn't identify its captured values
+}
+
+func (m *modelHasher) u64(x uint64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], x)
+	m.h.Write(b[:])
+}
+
+func (m *modelHasher) str(s string) {
+	m.u64(uint64(len(s)))
+	m.h.Write([]byte(s))
+}
+
+func (m *modelHasher) value(v reflect.Value) {
+	if !v.IsValid() {
+		m.str("nil")
+		return
+	}
+	m.str(v.Type().String())
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			m.u64(1)
+		} else {
+			m.u64(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		m.u64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		m.u64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		m.u64(math.Float64bits(v.Float()))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		m.u64(math.Float64bits(real(c)))
+		m.u64(math.Float64bits(imag(c)))
+	case reflect.String:
+		m.str(v.String())
+	case reflect.Array, reflect.Slice:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			m.str("nil")
+			return
+		}
+		m.u64(uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			m.value(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if m.node && v.Type().Field(i).Name == "bb" {
+				continue
+			}
+			m.value(v.Field(i))
+		}
+	case reflect.Ptr:
+		if v.IsNil() {
+			m.str("nil")
+			return
+		}
+		if n, ok := m.visited[v.Pointer()]; ok {
+			m.u64(uint64(n))
+			return
+		}
+		m.visited[v.Pointer()] = len(m.visited)
+		m.value(v.Elem())
+	case reflect.Interface:
+		if m.node && !v.IsNil() {
+			if t := v.Elem().Type(); t.Implements(sdf2Type) || t.Implements(sdf3Type) {
+				m.str("child")
+				return
+			}
+		}
+		m.value(v.Elem())
+	case reflect.Map:
+		// hash each entry separately, and combine them in sorted order
+		entries := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			e := modelHasher{sha256.New(), m.visited, m.node, false}
+			e.value(k)
+			e.value(v.MapIndex(k))
+			entries = append(entries, string(e.h.Sum(nil)))
+			m.opaque = m.opaque || e.opaque
+		}
+		sort.Strings(entries)
+		for _, e := range entries {
+			m.str(e)
+		}
+	case reflect.Func:
+		if v.IsNil() {
+			m.str("nil")
+			return
+		}
+		if isClosure(v) {
+			m.opaque = true
+		}
+		if f := runtime.FuncForPC(v.Pointer()); f != nil {
+			m.str(f.Name())
+		}
+	}
+}
+
+// modelHash returns the hash of a value, and true if it has no closures.
+func modelHash(s interface{}, node bool) (string, bool) {
+	m := modelHasher{sha256.New(), map[uintptr]int{}, node, false}
+	m.value(reflect.ValueOf(s))
+	return hex.EncodeToString(m.h.Sum(nil)), !m.opaque
+}
+
+// ModelHash returns a hash (hex string) of an SDF2/SDF3 tree and its parameters.
+// Trees with closures that capture different values hash the same (see CacheKey).
+func ModelHash(s interface{}) string {
+	h, _ := modelHash(s, false)
+	return h
+}
+
+// CacheKey returns the hash of an SDF2/SDF3 tree (see ModelHash) as a cache key. It returns
+// false if the tree is uncacheable: it has a closure (e.g. SetMin(RoundMin(k))), so the hash
+// doesn't identify the model.
+func CacheKey(s interface{}) (string, bool) {
+	return modelHash(s, false)
+}
+
+// nodeHash returns a hash of the parameters of an SDF node, excluding its children and
+// its bounding box (derived from the children), and true if the node has no closures.
+func nodeHash(s interface{}) (string, bool) {
+	return modelHash(s, true)
+}
+
+//-----------------------------------------------------------------------------
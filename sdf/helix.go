@@ -0,0 +1,144 @@
+//-----------------------------------------------------------------------------
+/*
+
+Helical Extrusion
+
+Sweep a 2D profile along a helix about the z-axis (augers, worm gears,
+decorative spirals). As with Revolve3D the profile x-axis is the radius
+and the profile y-axis is the height. Each turn the profile rises by the
+pitch, and optionally moves outwards (taper) and grows or shrinks (scale).
+
+Like Screw3D the distance is evaluated in the plane through the z-axis,
+so it is a bound rather than an exact distance.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// HelixSDF3 is an SDF2 profile swept along a helix.
+type HelixSDF3 struct {
+	sdf    SDF2
+	pitch  float64 // height change per turn
+	phi    float64 // total sweep angle (radians)
+	taper  float64 // radius change per turn
+	scale  float64 // profile scale per turn
+	left   bool    // left handed helix
+	center V2      // profile scaling center
+	ymin   float64 // profile height range (before scaling)
+	ymax   float64
+	smax   float64 // maximum profile scale
+	bb     Box3
+}
+
+// HelixExtrude3D sweeps an SDF2 profile along a helix with a given pitch (height per turn)
+// and number of turns (< 0 for a left handed helix). The taper is the radius change per turn
+// and scale is the profile scale per turn (1 for no scaling).
+func HelixExtrude3D(sdf SDF2, pitch, turns, taper, scale float64) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if pitch <= 0 {
+		return nil, ErrMsg("pitch <= 0")
+	}
+	if turns == 0 {
+		return nil, ErrMsg("turns == 0")
+	}
+	if scale <= 0 {
+		return nil, ErrMsg("scale <= 0")
+	}
+	s := HelixSDF3{}
+	s.sdf = sdf
+	s.pitch = pitch
+	s.left = turns < 0
+	turns = math.Abs(turns)
+	s.phi = turns * Tau
+	s.taper = taper
+	s.scale = scale
+	bb := sdf.BoundingBox()
+	s.center = bb.Center()
+	s.ymin = bb.Min.Y
+	s.ymax = bb.Max.Y
+	s.smax = math.Max(1, math.Pow(scale, turns))
+	// work out the bounding box from the profile at the start and end
+	r, zmin, zmax := 0.0, math.Inf(1), math.Inf(-1)
+	for _, t := range []float64{0, turns} {
+		k := math.Pow(scale, t)
+		b := Box2{s.center.Add(bb.Min.Sub(s.center).MulScalar(k)), s.center.Add(bb.Max.Sub(s.center).MulScalar(k))}
+		b = b.Translate(V2{taper * t, pitch * t})
+		r = math.Max(r, math.Max(math.Abs(b.Min.X), math.Abs(b.Max.X)))
+		zmin = math.Min(zmin, b.Min.Y)
+		zmax = math.Max(zmax, b.Max.Y)
+	}
+	s.bb = Box3{V3{-r, -r, zmin}, V3{r, r, zmax}}
+	return &s, nil
+}
+
+// section returns the profile distance for the section at sweep angle phi.
+func (s *HelixSDF3) section(r, z, phi float64) float64 {
+	t := phi / Tau
+	p := V2{r - s.taper*t, z - s.pitch*t}
+	if s.scale == 1 {
+		return s.sdf.Evaluate(p)
+	}
+	k := math.Pow(s.scale, t)
+	return s.sdf.Evaluate(s.center.Add(p.Sub(s.center).DivScalar(k))) * k
+}
+
+// Evaluate returns the minimum distance to a helical extrusion.
+func (s *HelixSDF3) Evaluate(p V3) float64 {
+	y := p.Y
+	if s.left {
+		y = -y
+	}
+	r := math.Sqrt(p.X*p.X + y*y)
+	theta := math.Atan2(y, p.X)
+	if theta < 0 {
+		theta += Tau
+	}
+	// the turns (phi = theta + k*Tau) with a profile that could be near the point
+	t := theta / Tau
+	kLo := int(math.Floor((p.Z-(s.center.Y+(s.ymax-s.center.Y)*s.smax))/s.pitch-t)) - 1
+	kHi := int(math.Ceil((p.Z-(s.center.Y+(s.ymin-s.center.Y)*s.smax))/s.pitch-t)) + 1
+	// within one turn of the ends of the sweep
+	kMin := int(math.Ceil(-t)) - 1
+	kMax := int(math.Floor(s.phi/Tau-t)) + 1
+	if kHi < kMin {
+		kHi = kMin
+	}
+	if kLo > kMax {
+		kLo = kMax
+	}
+	if kLo < kMin {
+		kLo = kMin
+	}
+	if kHi > kMax {
+		kHi = kMax
+	}
+	d := math.Inf(1)
+	for k := kLo; k <= kHi; k++ {
+		phi := theta + Tau*float64(k)
+		// beyond the ends the section is capped by the end plane
+		phic := Clamp(phi, 0, s.phi)
+		dk := s.section(r, p.Z, phic)
+		if phi != phic {
+			// distance to the end plane
+			dk = math.Max(dk, r*math.Sin(math.Min(math.Abs(phi-phic), 0.5*Pi)))
+		}
+		d = math.Min(d, dk)
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a helical extrusion.
+func (s *HelixSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+func (s *HelixSDF3) children() []interface{} { return []interface{}{&s.sdf} }
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,159 @@
+//-----------------------------------------------------------------------------
+/*
+
+Interval Evaluation
+
+Bound the values of an SDF3 over a box. The renderers use the bounds to
+skip the blocks of cells that can't contain the surface (the interval
+excludes zero), so the empty space inside and outside of a model isn't
+sampled.
+
+The common primitives have exact bounds, and transforms and booleans
+(without blending) combine the bounds of their children. Other SDF3s are
+bounded by the value at the center of the box and their Lipschitz bound
+(see LipschitzBound3).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// Interval is a range of SDF values.
+type Interval struct {
+	Min, Max float64
+}
+
+// Contains returns true if the interval contains x.
+func (a Interval) Contains(x float64) bool {
+	return a.Min <= x && x <= a.Max
+}
+
+// SDF3Interval is implemented by SDF3s that can bound their values over a box.
+type SDF3Interval interface {
+	// EvaluateInterval returns a bound of the values of the SDF3 over a box.
+	EvaluateInterval(b Box3) Interval
+}
+
+// EvaluateInterval returns a bound of the values of an SDF3 over a box.
+func EvaluateInterval(s SDF3, b Box3) Interval {
+	if si, ok := s.(SDF3Interval); ok {
+		return si.EvaluateInterval(b)
+	}
+	return lipschitzInterval(s, b)
+}
+
+// lipschitzInterval bounds the values of an SDF3 over a box with its Lipschitz bound.
+func lipschitzInterval(s SDF3, b Box3) Interval {
+	d := s.Evaluate(b.Center())
+	r := LipschitzBound3(s, b.Min, b.Max) * b.Size().Length() / 2
+	return Interval{d - r, d + r}
+}
+
+// absRange returns the range of |x| for x in [a, b].
+func absRange(a, b float64) (float64, float64) {
+	lo, hi := math.Abs(a), math.Abs(b)
+	if lo > hi {
+		lo, hi = hi, lo
+	}
+	if a <= 0 && b >= 0 {
+		lo = 0
+	}
+	return lo, hi
+}
+
+// absBox returns the range of the component-wise absolute value of points in a box.
+func absBox(b Box3) (V3, V3) {
+	var lo, hi V3
+	lo.X, hi.X = absRange(b.Min.X, b.Max.X)
+	lo.Y, hi.Y = absRange(b.Min.Y, b.Max.Y)
+	lo.Z, hi.Z = absRange(b.Min.Z, b.Max.Z)
+	return lo, hi
+}
+
+//-----------------------------------------------------------------------------
+// Primitives
+
+// EvaluateInterval returns a bound of the values of a sphere over a box.
+func (s *SphereSDF3) EvaluateInterval(b Box3) Interval {
+	lo, hi := absBox(b)
+	return Interval{lo.Length() - s.radius, hi.Length() - s.radius}
+}
+
+// EvaluateInterval returns a bound of the values of a box over a box.
+// The distance increases with the distance from the center on each axis.
+func (s *BoxSDF3) EvaluateInterval(b Box3) Interval {
+	lo, hi := absBox(b)
+	return Interval{sdfBox3d(lo, s.size) - s.round, sdfBox3d(hi, s.size) - s.round}
+}
+
+// EvaluateInterval returns a bound of the values of a cylinder over a box.
+func (s *CylinderSDF3) EvaluateInterval(b Box3) Interval {
+	lo, hi := absBox(b)
+	r0, r1 := V2{lo.X, lo.Y}.Length(), V2{hi.X, hi.Y}.Length()
+	size := V2{s.radius, s.height}
+	return Interval{sdfBox2d(V2{r0, lo.Z}, size) - s.round, sdfBox2d(V2{r1, hi.Z}, size) - s.round}
+}
+
+//-----------------------------------------------------------------------------
+// Transforms
+
+// EvaluateInterval returns a bound of the values of a transformed SDF3 over a box.
+func (s *TransformSDF3) EvaluateInterval(b Box3) Interval {
+	return EvaluateInterval(s.sdf, s.inverse.MulBox(b))
+}
+
+// EvaluateInterval returns a bound of the values of a uniformly scaled SDF3 over a box.
+func (s *ScaleUniformSDF3) EvaluateInterval(b Box3) Interval {
+	p0, p1 := b.Min.MulScalar(s.invK), b.Max.MulScalar(s.invK)
+	a := EvaluateInterval(s.sdf, Box3{p0.Min(p1), p0.Max(p1)})
+	if s.k < 0 {
+		return Interval{a.Max * s.k, a.Min * s.k}
+	}
+	return Interval{a.Min * s.k, a.Max * s.k}
+}
+
+//-----------------------------------------------------------------------------
+// Booleans
+
+// EvaluateInterval returns a bound of the values of a union over a box.
+func (s *UnionSDF3) EvaluateInterval(b Box3) Interval {
+	if !isMathMin(s.min) {
+		return lipschitzInterval(s, b)
+	}
+	var a Interval
+	for i, x := range s.sdf {
+		ai := EvaluateInterval(x, b)
+		if i == 0 {
+			a = ai
+		} else {
+			a = Interval{math.Min(a.Min, ai.Min), math.Min(a.Max, ai.Max)}
+		}
+	}
+	return a
+}
+
+// EvaluateInterval returns a bound of the values of a difference over a box.
+func (s *DifferenceSDF3) EvaluateInterval(b Box3) Interval {
+	if !isMathMax(s.max) {
+		return lipschitzInterval(s, b)
+	}
+	a0, a1 := EvaluateInterval(s.s0, b), EvaluateInterval(s.s1, b)
+	return Interval{math.Max(a0.Min, -a1.Max), math.Max(a0.Max, -a1.Min)}
+}
+
+// EvaluateInterval returns a bound of the values of an intersection over a box.
+func (s *IntersectionSDF3) EvaluateInterval(b Box3) Interval {
+	if !isMathMax(s.max) {
+		return lipschitzInterval(s, b)
+	}
+	a0, a1 := EvaluateInterval(s.s0, b), EvaluateInterval(s.s1, b)
+	return Interval{math.Max(a0.Min, a1.Min), math.Max(a0.Max, a1.Max)}
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,156 @@
+//-----------------------------------------------------------------------------
+/*
+
+Graded Lattices
+
+Triply periodic lattice sheets (gyroid, Schwarz P, diamond) used as infill,
+with the cell size and wall thickness graded by scalar fields, e.g. denser
+near mounting bosses and sparser in the core.
+
+The wall thickness is a level set offset of a distance estimate (first order
+near the surface) to the lattice surface, so it can vary freely. The cell size can't be varied by
+scaling the coordinates (that distorts the cells), so the lattice is a blend
+of lattices with cell sizes in steps of 2, weighted by the graded cell size.
+The blend weights are smooth, so the sheet is continuous across the grade.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// Lattice is a triply periodic surface F(p) = 0 with a period of 1 on each axis.
+// It returns the value and the gradient of F.
+type Lattice func(p V3) (float64, V3)
+
+// GyroidLattice is the gyroid surface.
+func GyroidLattice(p V3) (float64, V3) {
+	s, c := p.MulScalar(Tau).Sin(), p.MulScalar(Tau).Cos()
+	f := s.X*c.Y + s.Y*c.Z + s.Z*c.X
+	g := V3{c.X*c.Y - s.Z*s.X, c.Y*c.Z - s.X*s.Y, c.Z*c.X - s.Y*s.Z}
+	return f, g.MulScalar(Tau)
+}
+
+// SchwarzPLattice is the Schwarz P (primitive) surface.
+func SchwarzPLattice(p V3) (float64, V3) {
+	s, c := p.MulScalar(Tau).Sin(), p.MulScalar(Tau).Cos()
+	return c.X + c.Y + c.Z, s.MulScalar(-Tau)
+}
+
+// DiamondLattice is the Schwarz D (diamond) surface.
+func DiamondLattice(p V3) (float64, V3) {
+	s, c := p.MulScalar(Tau).Sin(), p.MulScalar(Tau).Cos()
+	f := s.X*s.Y*s.Z + s.X*c.Y*c.Z + c.X*s.Y*c.Z + c.X*c.Y*s.Z
+	g := V3{
+		c.X*s.Y*s.Z + c.X*c.Y*c.Z - s.X*s.Y*c.Z - s.X*c.Y*s.Z,
+		s.X*c.Y*s.Z - s.X*s.Y*c.Z + c.X*c.Y*c.Z - c.X*s.Y*s.Z,
+		s.X*s.Y*c.Z - s.X*c.Y*s.Z - c.X*s.Y*s.Z + c.X*c.Y*c.Z,
+	}
+	return f, g.MulScalar(Tau)
+}
+
+//-----------------------------------------------------------------------------
+
+// Grade maps a scalar field to a lattice parameter. The parameter is P0 where the field
+// is V0, P1 where the field is V1, and varies smoothly in between (constant beyond).
+// A nil field is the constant P0.
+type Grade struct {
+	Field  SDF3    // scalar field (e.g. the distance to a surface or to mounting bosses)
+	V0, V1 float64 // field values at the ends of the grade
+	P0, P1 float64 // parameter values at V0 and V1
+}
+
+// value returns the graded parameter at a point.
+func (g *Grade) value(p V3) float64 {
+	if g.Field == nil {
+		return g.P0
+	}
+	t := Clamp((g.Field.Evaluate(p)-g.V0)/(g.V1-g.V0), 0, 1)
+	return Mix(g.P0, g.P1, t*t*(3-2*t))
+}
+
+// check checks a grade has positive (or non-negative) parameter values.
+func (g *Grade) check(name string, positive bool) error {
+	if g.Field != nil && g.V0 == g.V1 {
+		return ErrMsg(name + " V0 == V1")
+	}
+	min := g.P0
+	if g.Field != nil {
+		min = math.Min(g.P0, g.P1)
+	}
+	if min < 0 || (positive && min == 0) {
+		return ErrMsg(name + " values must be > 0")
+	}
+	return nil
+}
+
+// min returns the smallest value of a grade.
+func (g *Grade) min() float64 {
+	if g.Field == nil {
+		return g.P0
+	}
+	return math.Min(g.P0, g.P1)
+}
+
+//-----------------------------------------------------------------------------
+
+// GradedLatticeSDF3 is a lattice sheet infill with a graded cell size and wall thickness.
+type GradedLatticeSDF3 struct {
+	body      SDF3 // volume filled by the lattice
+	lattice   Lattice
+	cell      Grade   // cell size
+	thickness Grade   // wall thickness
+	c0        float64 // smallest cell size (the size of blend level 0)
+}
+
+// GradedLattice3D returns a lattice sheet filling a body, with the cell size and the wall
+// thickness graded by scalar fields. E.g. a cell grade with the body as the field gives a
+// lattice that is finer near the surface and coarser in the core.
+func GradedLattice3D(body SDF3, lattice Lattice, cell, thickness Grade) (SDF3, error) {
+	if body == nil || lattice == nil {
+		return nil, ErrMsg("body == nil || lattice == nil")
+	}
+	if err := cell.check("cell size", true); err != nil {
+		return nil, err
+	}
+	if err := thickness.check("thickness", false); err != nil {
+		return nil, err
+	}
+	return &GradedLatticeSDF3{body, lattice, cell, thickness, cell.min()}, nil
+}
+
+// level returns the distance estimate to the lattice surface with a cell size.
+// It is the first order distance f / |grad f| near the surface, limited to cell size / Tau
+// where the gradient vanishes.
+func (s *GradedLatticeSDF3) level(p V3, size float64) float64 {
+	f, g := s.lattice(p.DivScalar(size))
+	return size * f / math.Sqrt(g.Length2()+Tau*Tau*f*f)
+}
+
+// Evaluate returns the minimum distance to a graded lattice.
+func (s *GradedLatticeSDF3) Evaluate(p V3) float64 {
+	// blend the lattices with cell sizes c0 * 2^k and c0 * 2^(k+1)
+	u := math.Max(math.Log2(s.cell.value(p)/s.c0), 0)
+	k := math.Floor(u)
+	size := s.c0 * math.Exp2(k)
+	d := s.level(p, size)
+	if w := u - k; w > 0 {
+		w = w * w * (3 - 2*w)
+		d = Mix(d, s.level(p, 2*size), w)
+		size = Mix(size, 2*size, w)
+	}
+	// the distance estimate of the half thickness (from the first order distance)
+	h := 0.5 * s.thickness.value(p)
+	h /= math.Sqrt(1 + Tau*Tau*h*h/(size*size))
+	return math.Max(math.Abs(d)-h, s.body.Evaluate(p))
+}
+
+// BoundingBox returns the bounding box of a graded lattice.
+func (s *GradedLatticeSDF3) BoundingBox() Box3 {
+	return s.body.BoundingBox()
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,209 @@
+//-----------------------------------------------------------------------------
+/*
+
+Lipschitz Checking
+
+A valid SDF is 1-Lipschitz: |f(a) - f(b)| <= |a - b| for all points a, b.
+Fields that change faster than this (e.g. naive user deformations) cause
+raycasting to overstep and the octree renderer to skip cells, which shows
+up as holes in the mesh. This is a debug tool: sample point pairs under
+each node of an SDF tree and report the nodes that break the rule.
+
+Nodes that know how fast their field changes (e.g. non-rigid transforms)
+report a Lipschitz bound along a segment, which lets raycasting take
+steps of the right length (segment tracing).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// LipschitzViolation is an SDF node whose field changes faster than the distance between points.
+type LipschitzViolation struct {
+	Path   string      // path of the node within the SDF tree
+	Node   interface{} // the node (SDF2 or SDF3)
+	Ratio  float64     // worst sampled |f(a)-f(b)|/|a-b|
+	Source bool        // true if no child of the node has a violation (the node is the cause)
+}
+
+func (v *LipschitzViolation) String() string {
+	s := fmt.Sprintf("%s: lipschitz ratio %.3g", v.Path, v.Ratio)
+	if v.Source {
+		s += " (source)"
+	}
+	return s
+}
+
+// CheckLipschitz3 samples pairs of points under each node of an SDF3 tree and returns
+// the nodes where the ratio |f(a)-f(b)|/|a-b| exceeds 1 + tolerance.
+// Nodes marked as the source of a violation have no violating children, so they
+// point at the offending subtree.
+func CheckLipschitz3(s SDF3, samples int, tolerance float64) []*LipschitzViolation {
+	var violations []*LipschitzViolation
+	// check returns true if the node or any node below it has a violation
+	var check func(node interface{}, path string) bool
+	check = func(node interface{}, path string) bool {
+		childViolation := false
+		for i, c := range Children(node) {
+			if check(c, childPath(path, i, c)) {
+				childViolation = true
+			}
+		}
+		var ratio float64
+		switch n := node.(type) {
+		case SDF3:
+			ratio = lipschitzRatio3(n, samples)
+		case SDF2:
+			ratio = lipschitzRatio2(n, samples)
+		}
+		if ratio > 1+tolerance {
+			violations = append(violations, &LipschitzViolation{path, node, ratio, !childViolation})
+			return true
+		}
+		return childViolation
+	}
+	check(s, NodeName(s))
+	return violations
+}
+
+// lipschitzRatio3 returns the worst sampled Lipschitz ratio of an SDF3.
+// Half the pairs are close together (local gradient), half span the bounding box.
+func lipschitzRatio3(s SDF3, samples int) float64 {
+	bb := s.BoundingBox()
+	bb = bb.ScaleAboutCenter(1.2)
+	step := bb.Size().Length() * 1e-3
+	var worst float64
+	for i := 0; i < samples; i++ {
+		a := bb.Random()
+		var b V3
+		if i&1 == 0 {
+			d := V3{randomRange(-1, 1), randomRange(-1, 1), randomRange(-1, 1)}
+			b = a.Add(d.Normalize().MulScalar(step))
+		} else {
+			b = bb.Random()
+		}
+		l := a.Sub(b).Length()
+		if l == 0 {
+			continue
+		}
+		r := math.Abs(s.Evaluate(a)-s.Evaluate(b)) / l
+		if math.IsNaN(r) {
+			continue
+		}
+		worst = math.Max(worst, r)
+	}
+	return worst
+}
+
+// lipschitzRatio2 returns the worst sampled Lipschitz ratio of an SDF2.
+func lipschitzRatio2(s SDF2, samples int) float64 {
+	bb := s.BoundingBox()
+	bb = bb.ScaleAboutCenter(1.2)
+	step := bb.Size().Length() * 1e-3
+	var worst float64
+	for i := 0; i < samples; i++ {
+		a := bb.Random()
+		var b V2
+		if i&1 == 0 {
+			d := V2{randomRange(-1, 1), randomRange(-1, 1)}
+			b = a.Add(d.Normalize().MulScalar(step))
+		} else {
+			b = bb.Random()
+		}
+		l := a.Sub(b).Length()
+		if l == 0 {
+			continue
+		}
+		r := math.Abs(s.Evaluate(a)-s.Evaluate(b)) / l
+		if math.IsNaN(r) {
+			continue
+		}
+		worst = math.Max(worst, r)
+	}
+	return worst
+}
+
+//-----------------------------------------------------------------------------
+// Lipschitz bounds
+
+// SegmentLipschitz3 is implemented by SDF3s that can bound how fast their field changes.
+type SegmentLipschitz3 interface {
+	// LipschitzBound returns a Lipschitz bound of the field on the segment a-b.
+	LipschitzBound(a, b V3) float64
+}
+
+// LipschitzBound3 returns a Lipschitz bound of an SDF3 on the segment a-b.
+// SDF3s without Lipschitz metadata are assumed to be 1-Lipschitz.
+func LipschitzBound3(s SDF3, a, b V3) float64 {
+	if l, ok := s.(SegmentLipschitz3); ok {
+		return l.LipschitzBound(a, b)
+	}
+	return 1
+}
+
+// linearNorm returns the spectral norm (largest singular value) of the linear part of the matrix.
+func (a M44) linearNorm() float64 {
+	// symmetric matrix m = transpose(a) * a
+	c0 := V3{a.x00, a.x10, a.x20}
+	c1 := V3{a.x01, a.x11, a.x21}
+	c2 := V3{a.x02, a.x12, a.x22}
+	m00, m11, m22 := c0.Dot(c0), c1.Dot(c1), c2.Dot(c2)
+	m01, m02, m12 := c0.Dot(c1), c0.Dot(c2), c1.Dot(c2)
+	// largest eigenvalue of m (closed form for symmetric 3x3 matrices)
+	p1 := m01*m01 + m02*m02 + m12*m12
+	q := (m00 + m11 + m22) / 3
+	if p1 == 0 {
+		// diagonal
+		return math.Sqrt(math.Max(m00, math.Max(m11, m22)))
+	}
+	p2 := (m00-q)*(m00-q) + (m11-q)*(m11-q) + (m22-q)*(m22-q) + 2*p1
+	p := math.Sqrt(p2 / 6)
+	b00, b11, b22 := (m00-q)/p, (m11-q)/p, (m22-q)/p
+	b01, b02, b12 := m01/p, m02/p, m12/p
+	r := (b00*(b11*b22-b12*b12) - b01*(b01*b22-b12*b02) + b02*(b01*b12-b11*b02)) / 2
+	phi := math.Acos(Clamp(r, -1, 1)) / 3
+	return math.Sqrt(q + 2*p*math.Cos(phi))
+}
+
+// LipschitzBound returns a Lipschitz bound of a transformed SDF3 on the segment a-b.
+// Non-rigid transforms scale the field gradient by the norm of the inverse matrix.
+func (s *TransformSDF3) LipschitzBound(a, b V3) float64 {
+	return s.inverse.linearNorm() * LipschitzBound3(s.sdf, s.inverse.MulPosition(a), s.inverse.MulPosition(b))
+}
+
+// LipschitzBound returns a Lipschitz bound of a uniformly scaled SDF3 on the segment a-b.
+func (s *ScaleUniformSDF3) LipschitzBound(a, b V3) float64 {
+	return LipschitzBound3(s.sdf, a.MulScalar(s.invK), b.MulScalar(s.invK))
+}
+
+// LipschitzBound returns a Lipschitz bound of an offset SDF3 on the segment a-b.
+func (s *OffsetSDF3) LipschitzBound(a, b V3) float64 {
+	return LipschitzBound3(s.sdf, a, b)
+}
+
+// LipschitzBound returns a Lipschitz bound of a shelled SDF3 on the segment a-b.
+func (s *ShellSDF3) LipschitzBound(a, b V3) float64 {
+	return LipschitzBound3(s.sdf, a, b)
+}
+
+// LipschitzBound returns a Lipschitz bound of a union on the segment a-b.
+// The bound is the worst bound of the SDF3s (blended unions are assumed to be 1-Lipschitz).
+func (s *UnionSDF3) LipschitzBound(a, b V3) float64 {
+	if !isMathMin(s.min) {
+		return 1
+	}
+	k := 0.0
+	for _, x := range s.sdf {
+		k = math.Max(k, LipschitzBound3(x, a, b))
+	}
+	return k
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,173 @@
+//-----------------------------------------------------------------------------
+/*
+
+Grid Morphology
+
+Morphological operators on a discretized distance field, for cleaning up
+noisy models (e.g. imported scans) before re-meshing. The SDF3 is sampled
+on a grid and redistanced, so dilation and erosion are offsets of a true
+distance field, and the field is redistanced between the steps of
+opening (erode, dilate) and closing (dilate, erode).
+
+Opening removes specks and thin spikes smaller than the radius, closing
+fills cracks and holes narrower than the radius. FillVoids3D removes
+internal cavities (empty regions not connected to the outside) below a
+volume.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+//-----------------------------------------------------------------------------
+
+// morphologyGrid returns the redistanced sampling of an SDF3 on a grid with meshCells
+// on the longest axis of the bounding box, enlarged by a margin.
+func morphologyGrid(s SDF3, meshCells int, margin float64) (*grid3, error) {
+	if s == nil {
+		return nil, ErrMsg("s == nil")
+	}
+	if meshCells <= 0 {
+		return nil, ErrMsg("meshCells <= 0")
+	}
+	bb := s.BoundingBox()
+	cellSize := bb.Size().MaxComponent() / float64(meshCells)
+	m := margin + 2*cellSize
+	g := newGrid3(bb.Enlarge(V3{2 * m, 2 * m, 2 * m}), cellSize)
+	g.sample(s)
+	g.redistance()
+	return g, nil
+}
+
+// offset offsets the grid values (> 0 grows the surface) and redistances the grid.
+func (g *grid3) offset(r float64) {
+	for i := range g.value {
+		g.value[i] -= r
+	}
+	g.redistance()
+}
+
+// Dilate3D returns an SDF3 grown by a radius, sampled on a grid (meshCells on the longest axis).
+func Dilate3D(s SDF3, r float64, meshCells int) (SDF3, error) {
+	if r < 0 {
+		return nil, ErrMsg("r < 0")
+	}
+	g, err := morphologyGrid(s, meshCells, r)
+	if err != nil {
+		return nil, err
+	}
+	g.offset(r)
+	return &GridSDF3{grid: g}, nil
+}
+
+// Erode3D returns an SDF3 shrunk by a radius, sampled on a grid (meshCells on the longest axis).
+func Erode3D(s SDF3, r float64, meshCells int) (SDF3, error) {
+	if r < 0 {
+		return nil, ErrMsg("r < 0")
+	}
+	g, err := morphologyGrid(s, meshCells, 0)
+	if err != nil {
+		return nil, err
+	}
+	g.offset(-r)
+	return &GridSDF3{grid: g}, nil
+}
+
+// Open3D returns an SDF3 eroded and then dilated by a radius. Features thinner than 2r are removed.
+func Open3D(s SDF3, r float64, meshCells int) (SDF3, error) {
+	if r < 0 {
+		return nil, ErrMsg("r < 0")
+	}
+	g, err := morphologyGrid(s, meshCells, 0)
+	if err != nil {
+		return nil, err
+	}
+	g.offset(-r)
+	g.offset(r)
+	return &GridSDF3{grid: g}, nil
+}
+
+// Close3D returns an SDF3 dilated and then eroded by a radius. Gaps narrower than 2r are filled.
+func Close3D(s SDF3, r float64, meshCells int) (SDF3, error) {
+	if r < 0 {
+		return nil, ErrMsg("r < 0")
+	}
+	g, err := morphologyGrid(s, meshCells, r)
+	if err != nil {
+		return nil, err
+	}
+	g.offset(r)
+	g.offset(-r)
+	return &GridSDF3{grid: g}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// FillVoids3D returns an SDF3 with the internal voids (empty regions not connected to
+// the outside of the grid) smaller than a volume filled, sampled on a grid (meshCells on
+// the longest axis). maxVolume <= 0 fills all voids.
+func FillVoids3D(s SDF3, maxVolume float64, meshCells int) (SDF3, error) {
+	g, err := morphologyGrid(s, meshCells, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := g.n
+	cellVolume := g.step.X * g.step.Y * g.step.Z
+	// label the empty components (6-connected), 0: unlabeled
+	label := make([]int32, len(g.value))
+	var stack []V3i
+	var next int32
+	offset := [6]V3i{{1, 0, 0}, {-1, 0, 0}, {0, 1, 0}, {0, -1, 0}, {0, 0, 1}, {0, 0, -1}}
+	filled := false
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			for k := 0; k < n[2]; k++ {
+				idx := g.index(i, j, k)
+				if g.value[idx] <= 0 || label[idx] != 0 {
+					continue
+				}
+				next++
+				label[idx] = next
+				stack = append(stack[:0], V3i{i, j, k})
+				component := []int{idx}
+				outside := false
+				for len(stack) != 0 {
+					x := stack[len(stack)-1]
+					stack = stack[:len(stack)-1]
+					for a := 0; a < 3; a++ {
+						if x[a] == 0 || x[a] == n[a]-1 {
+							outside = true
+						}
+					}
+					for _, o := range offset {
+						y := x.Add(o)
+						if y[0] < 0 || y[1] < 0 || y[2] < 0 || y[0] >= n[0] || y[1] >= n[1] || y[2] >= n[2] {
+							continue
+						}
+						yi := g.index(y[0], y[1], y[2])
+						if g.value[yi] > 0 && label[yi] == 0 {
+							label[yi] = next
+							stack = append(stack, y)
+							component = append(component, yi)
+						}
+					}
+				}
+				if outside {
+					continue
+				}
+				if maxVolume <= 0 || float64(len(component))*cellVolume < maxVolume {
+					for _, ci := range component {
+						g.value[ci] = -g.value[ci]
+					}
+					filled = true
+				}
+			}
+		}
+	}
+	if filled {
+		g.redistance()
+	}
+	return &GridSDF3{grid: g}, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,179 @@
+//-----------------------------------------------------------------------------
+/*
+
+Redistancing via Fast Sweeping
+
+Resample a distorted distance field (non-uniform scaling, tapering, etc.)
+onto a regular grid and solve the eikonal equation |grad(d)| = 1 to
+recover a true signed distance field.
+
+See: Hongkai Zhao, "A fast sweeping method for eikonal equations"
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// eikonalSolve returns the upwind solution of the eikonal equation given
+// the minimum neighbour values (a) and grid spacings (h) on each axis.
+func eikonalSolve(a, h [3]float64) float64 {
+	idx := []int{0, 1, 2}
+	sort.Slice(idx, func(i, j int) bool { return a[idx[i]] < a[idx[j]] })
+	u := a[idx[0]] + h[idx[0]]
+	for m := 2; m <= 3; m++ {
+		if u <= a[idx[m-1]] {
+			break
+		}
+		// solve sum((u - a_i)^2 / h_i^2) = 1 for the m smallest neighbours
+		var qa, qb, qc float64
+		for _, i := range idx[:m] {
+			k := 1 / (h[i] * h[i])
+			qa += k
+			qb -= 2 * a[i] * k
+			qc += a[i] * a[i] * k
+		}
+		qc--
+		disc := qb*qb - 4*qa*qc
+		if disc < 0 {
+			break
+		}
+		u = (-qb + math.Sqrt(disc)) / (2 * qa)
+	}
+	return u
+}
+
+//-----------------------------------------------------------------------------
+
+// Normalize3D returns an SDF3 with a true signed distance field.
+// The SDF3 is sampled on a grid (meshCells on the longest axis of the bounding box)
+// and redistanced by fast sweeping.
+func Normalize3D(s SDF3, meshCells int) (SDF3, error) {
+	if s == nil {
+		return nil, ErrMsg("s == nil")
+	}
+	if meshCells <= 0 {
+		return nil, ErrMsg("meshCells <= 0")
+	}
+	bb := s.BoundingBox()
+	cellSize := bb.Size().MaxComponent() / float64(meshCells)
+	m := 2 * cellSize
+	g := newGrid3(bb.Enlarge(V3{m, m, m}), cellSize)
+	g.sample(s)
+	g.redistance()
+	return &GridSDF3{grid: g}, nil
+}
+
+//-----------------------------------------------------------------------------
+
+// redistance replaces the sampled values of a grid with true signed distances.
+// Distances at the nodes adjacent to the surface are taken from the zero crossings,
+// and the remaining distances are recovered by fast sweeping.
+func (g *grid3) redistance() {
+	n := g.n
+	h := [3]float64{g.step.X, g.step.Y, g.step.Z}
+	dist := make([]float64, len(g.value))
+	fixed := make([]bool, len(g.value))
+	offset := [3]V3i{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+
+	// initialise the nodes adjacent to the surface
+	for i := 0; i < n[0]; i++ {
+		for j := 0; j < n[1]; j++ {
+			for k := 0; k < n[2]; k++ {
+				idx := g.index(i, j, k)
+				v := g.value[idx]
+				dist[idx] = math.Inf(1)
+				if v == 0 {
+					dist[idx] = 0
+					fixed[idx] = true
+					continue
+				}
+				// 1/d^2 = sum(1/da^2) over the axes with a zero crossing
+				sum := 0.0
+				for a, o := range offset {
+					da := math.Inf(1)
+					for _, sgn := range []int{-1, 1} {
+						x := V3i{i + sgn*o[0], j + sgn*o[1], k + sgn*o[2]}
+						if x[a] < 0 || x[a] >= n[a] {
+							continue
+						}
+						w := g.value[g.index(x[0], x[1], x[2])]
+						if (v < 0) != (w < 0) {
+							da = math.Min(da, h[a]*v/(v-w))
+						}
+					}
+					if !math.IsInf(da, 1) {
+						sum += 1 / math.Max(da*da, epsilon)
+					}
+				}
+				if sum > 0 {
+					dist[idx] = 1 / math.Sqrt(sum)
+					fixed[idx] = true
+				}
+			}
+		}
+	}
+
+	// fast sweeping in the 8 axis orderings
+	min := func(i, j, k, a int) float64 {
+		x := V3i{i, j, k}
+		d := math.Inf(1)
+		for _, sgn := range []int{-1, 1} {
+			y := x
+			y[a] += sgn
+			if y[a] >= 0 && y[a] < n[a] {
+				d = math.Min(d, dist[g.index(y[0], y[1], y[2])])
+			}
+		}
+		return d
+	}
+	for iteration := 0; iteration < 2; iteration++ {
+		for sweep := 0; sweep < 8; sweep++ {
+			var i0, j0, k0, di, dj, dk int = 0, 0, 0, 1, 1, 1
+			if sweep&1 != 0 {
+				i0, di = n[0]-1, -1
+			}
+			if sweep&2 != 0 {
+				j0, dj = n[1]-1, -1
+			}
+			if sweep&4 != 0 {
+				k0, dk = n[2]-1, -1
+			}
+			for i := i0; i >= 0 && i < n[0]; i += di {
+				for j := j0; j >= 0 && j < n[1]; j += dj {
+					for k := k0; k >= 0 && k < n[2]; k += dk {
+						idx := g.index(i, j, k)
+						if fixed[idx] {
+							continue
+						}
+						a := [3]float64{min(i, j, k, 0), min(i, j, k, 1), min(i, j, k, 2)}
+						if math.IsInf(a[0], 1) && math.IsInf(a[1], 1) && math.IsInf(a[2], 1) {
+							continue
+						}
+						dist[idx] = math.Min(dist[idx], eikonalSolve(a, h))
+					}
+				}
+			}
+		}
+	}
+
+	// apply the sign of the sampled field
+	for i, d := range dist {
+		if math.IsInf(d, 1) {
+			// no surface within the grid
+			d = math.Abs(g.value[i])
+		}
+		if g.value[i] < 0 {
+			d = -d
+		}
+		g.value[i] = d
+	}
+}
+
+//-----------------------------------------------------------------------------
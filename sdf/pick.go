@@ -0,0 +1,141 @@
+//-----------------------------------------------------------------------------
+/*
+
+Picking
+
+Cast a ray at a model and find where it hits the surface, the surface
+normal and the node of the SDF tree that makes the surface at that point.
+This is the basis for interactive picking, point-to-point measurements and
+"which feature is this?" tools.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// Hit is a ray/surface intersection.
+type Hit struct {
+	Point    V3      // point on the surface
+	Normal   V3      // surface normal at the point
+	Distance float64 // distance along the ray from its origin
+	Node     SDF3    // deepest node of the SDF tree making the surface at the point
+	Path     string  // tree path of the node (see Walk)
+}
+
+// Pick casts a ray (with an origin point from and a direction dir) at an SDF3.
+// It returns nil if the surface is not hit within maxDist.
+func Pick(s SDF3, from, dir V3, maxDist float64) *Hit {
+	tol := ModelTolerances3(s)
+	r := NewRaycastParams3(s, 0)
+	r.Epsilon = tol.Surface
+	p, t, _ := r.Raycast3(s, from, dir, maxDist)
+	if t < 0 {
+		return nil
+	}
+	node, path := Feature(s, p)
+	return &Hit{p, tol.Normal3(s, p), t, node, path}
+}
+
+// DistanceTo returns the distance between two hits (point-to-point measurement).
+func (h *Hit) DistanceTo(o *Hit) float64 {
+	return h.Point.Sub(o.Point).Length()
+}
+
+//-----------------------------------------------------------------------------
+
+// Feature returns the deepest node of an SDF3 tree (and its tree path) that sets the
+// value of the field at a point. Combining nodes (union, difference, intersection, cut)
+// pass the query to the child with the value of the node. The node itself is returned
+// when no child has its value (e.g. a blend or the plane of a cut), or when the point
+// can't be mapped into the space of its children (e.g. arrays, extrusions).
+func Feature(s SDF3, p V3) (SDF3, string) {
+	tol := ModelTolerances3(s).Surface
+	path := NodeName(s)
+	for {
+		c, i, q := featureChild(s, p, tol)
+		if c == nil {
+			return s, path
+		}
+		path = childPath(path, i, c)
+		s, p = c, q
+	}
+}
+
+// featureChild returns the child of a node (its index and the point in child space)
+// that sets the value of the field at a point, or nil if there is no such child.
+func featureChild(s SDF3, p V3, tol float64) (SDF3, int, V3) {
+	// the child with the value of the node
+	match := func(v float64, c ...SDF3) (SDF3, int, V3) {
+		best, k := math.Inf(1), -1
+		for i, x := range c {
+			if d := math.Abs(math.Abs(x.Evaluate(p)) - math.Abs(v)); d < best {
+				best, k = d, i
+			}
+		}
+		if k < 0 || best > tol {
+			return nil, 0, p
+		}
+		return c[k], k, p
+	}
+	switch n := s.(type) {
+	case *TransformSDF3:
+		return n.sdf, 0, n.inverse.MulPosition(p)
+	case *ScaleUniformSDF3:
+		return n.sdf, 0, p.MulScalar(n.invK)
+	case *ElongateSDF3:
+		return n.sdf, 0, p.Sub(p.Clamp(n.hn, n.hp))
+	case *OffsetSDF3:
+		return n.sdf, 0, p
+	case *ShellSDF3:
+		return n.sdf, 0, p
+	case *RedistanceSDF3:
+		return n.sdf, 0, p
+	case *ColorSDF3:
+		return n.sdf, 0, p
+	case *UnionSDF3:
+		return match(n.Evaluate(p), n.sdf...)
+	case *DifferenceSDF3:
+		return match(n.Evaluate(p), n.s0, n.s1)
+	case *IntersectionSDF3:
+		return match(n.Evaluate(p), n.s0, n.s1)
+	case *CutSDF3:
+		return match(n.Evaluate(p), n.sdf)
+	}
+	return nil, 0, p
+}
+
+//-----------------------------------------------------------------------------
+
+// Camera is a pinhole camera for casting rays at a model.
+type Camera struct {
+	Eye    V3      // camera position
+	Target V3      // point the camera looks at
+	Up     V3      // up direction
+	Fov    float64 // vertical field of view (radians)
+	Aspect float64 // width/height of the image
+}
+
+// Ray returns the ray through a point of the image, with x and y from -1 (left, bottom) to 1 (right, top).
+func (c *Camera) Ray(x, y float64) (from, dir V3) {
+	forward := c.Target.Sub(c.Eye).Normalize()
+	right := forward.Cross(c.Up).Normalize()
+	up := right.Cross(forward)
+	h := math.Tan(c.Fov / 2)
+	dir = forward.Add(right.MulScalar(x * h * c.Aspect)).Add(up.MulScalar(y * h))
+	return c.Eye, dir.Normalize()
+}
+
+// Pick casts the ray through a point of the image (see Ray) at an SDF3.
+// It returns nil if the surface is not hit.
+func (c *Camera) Pick(s SDF3, x, y float64) *Hit {
+	from, dir := c.Ray(x, y)
+	bb := s.BoundingBox()
+	maxDist := from.Sub(bb.Center()).Length() + bb.Size().Length()
+	return Pick(s, from, dir, maxDist)
+}
+
+//-----------------------------------------------------------------------------
@@ -57,8 +57,8 @@ func Polygon2D(vertex []V2) (SDF2, error) {
 	return &s, nil
 }
 
-// Evaluate returns the minimum distance for a 2d polygon.
-func (s *PolySDF2) Evaluate(p V2) float64 {
+// winding returns the squared distance to the polygon and the winding number of the point.
+func (s *PolySDF2) winding(p V2) (float64, int) {
 	dd := math.MaxFloat64 // d^2 to polygon (>0)
 	wn := 0               // winding number (inside/outside)
 
@@ -102,6 +102,12 @@ func (s *PolySDF2) Evaluate(p V2) float64 {
 		}
 	}
 
+	return dd, wn
+}
+
+// Evaluate returns the minimum distance for a 2d polygon.
+func (s *PolySDF2) Evaluate(p V2) float64 {
+	dd, wn := s.winding(p)
 	// normalise d*d to d
 	d := math.Sqrt(dd)
 	if wn != 0 {
@@ -117,3 +123,71 @@ func (s *PolySDF2) BoundingBox() Box2 {
 }
 
 //-----------------------------------------------------------------------------
+
+// FillRule determines which regions of overlapping contours are inside.
+type FillRule int
+
+const (
+	// FillEvenOdd: inside an odd number of contours (contours within contours are holes).
+	FillEvenOdd FillRule = iota
+	// FillNonZero: a non-zero winding number (clockwise contours within counter-clockwise contours are holes).
+	FillNonZero
+)
+
+// MultiPolySDF2 is an SDF2 made from multiple closed contours.
+type MultiPolySDF2 struct {
+	poly []*PolySDF2
+	rule FillRule
+	bb   Box2
+}
+
+// MultiPolygon2D returns an SDF2 made from multiple closed contours.
+// The even-odd rule is used, so contours within contours are holes.
+func MultiPolygon2D(contours [][]V2) (SDF2, error) {
+	return MultiPolygonFill2D(contours, FillEvenOdd)
+}
+
+// MultiPolygonFill2D returns an SDF2 made from multiple closed contours using a fill rule.
+func MultiPolygonFill2D(contours [][]V2, rule FillRule) (SDF2, error) {
+	if len(contours) == 0 {
+		return nil, ErrMsg("no contours")
+	}
+	s := MultiPolySDF2{rule: rule}
+	for i, c := range contours {
+		p, err := Polygon2D(c)
+		if err != nil {
+			return nil, err
+		}
+		s.poly = append(s.poly, p.(*PolySDF2))
+		if i == 0 {
+			s.bb = p.BoundingBox()
+		} else {
+			s.bb = s.bb.Extend(p.BoundingBox())
+		}
+	}
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance for multiple 2d contours.
+func (s *MultiPolySDF2) Evaluate(p V2) float64 {
+	dd := math.MaxFloat64
+	wn := 0
+	for _, poly := range s.poly {
+		pdd, pwn := poly.winding(p)
+		dd = math.Min(dd, pdd)
+		wn += pwn
+	}
+	d := math.Sqrt(dd)
+	if (s.rule == FillEvenOdd && wn%2 != 0) || (s.rule == FillNonZero && wn != 0) {
+		// p is inside
+		return -d
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of multiple 2d contours.
+func (s *MultiPolySDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,161 @@
+//-----------------------------------------------------------------------------
+/*
+
+Convex Polygon Prisms
+
+A prism of a convex polygon section on the z-axis, with an exact distance
+field (an extruded polygon is only a bound beyond the end caps). The
+vertical edges and the end cap edges can be rounded.
+
+The rounded prism is the polygon inset by the rounding, rounded by the
+vertical edge rounding (less the cap rounding) and extruded, then offset
+by the cap rounding. Offsets of convex solids keep an exact distance, so
+the vertical edges are rounded by at least the cap rounding.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// PrismSDF3 is a prism with a convex polygon section.
+type PrismSDF3 struct {
+	vertex []V2      // inset polygon vertices (counter-clockwise)
+	dir    []V2      // unit edge vectors
+	normal []V2      // unit outward edge normals
+	length []float64 // edge lengths
+	offset float64   // section offset (vertical edge rounding less the cap rounding)
+	round  float64   // cap rounding
+	height float64   // half height less the cap rounding
+	bb     Box3
+}
+
+// Prism3D returns an SDF3 for a prism (on the z-axis) with a convex polygon section. The
+// vertical edges are rounded by round, the edges of the end caps by capRound.
+func Prism3D(vertex []V2, height, round, capRound float64) (SDF3, error) {
+	n := len(vertex)
+	if n >= 2 && vertex[0].Equals(vertex[n-1], tolerance) {
+		// drop the closing vertex
+		n--
+	}
+	if n < 3 {
+		return nil, ErrMsg("number of vertices < 3")
+	}
+	if height <= 0 {
+		return nil, ErrMsg("height <= 0")
+	}
+	if round < 0 || capRound < 0 {
+		return nil, ErrMsg("round < 0")
+	}
+	if 2*capRound > height {
+		return nil, ErrMsg("capRound > height / 2")
+	}
+	v := make([]V2, n)
+	copy(v, vertex[:n])
+	// the winding of the polygon, and its convexity
+	area := 0.0
+	for i := range v {
+		area += v[i].Cross(v[(i+1)%n])
+	}
+	if area < 0 {
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			v[i], v[j] = v[j], v[i]
+		}
+	}
+	for i := range v {
+		a, b, c := v[i], v[(i+1)%n], v[(i+2)%n]
+		if b.Sub(a).Cross(c.Sub(b)) <= 0 {
+			return nil, ErrMsg("polygon is not strictly convex")
+		}
+	}
+
+	s := PrismSDF3{}
+	inset := math.Max(round, capRound)
+	s.offset = math.Max(0, round-capRound)
+	s.round = capRound
+	s.height = height/2 - capRound
+	// the inset polygon vertices are at the crossings of the inset edge lines
+	normal := make([]V2, n)
+	for i := range v {
+		d := v[(i+1)%n].Sub(v[i]).Normalize()
+		normal[i] = V2{d.Y, -d.X}
+	}
+	s.vertex = make([]V2, n)
+	for i := range v {
+		j := (i + n - 1) % n
+		// solve normal[j].x = normal[j].v[i] - inset, normal[i].x = normal[i].v[i] - inset
+		a, b := normal[j], normal[i]
+		cj, ci := a.Dot(v[i])-inset, b.Dot(v[i])-inset
+		det := a.Cross(b)
+		s.vertex[i] = V2{(cj*b.Y - ci*a.Y) / det, (a.X*ci - b.X*cj) / det}
+	}
+	s.dir = make([]V2, n)
+	s.normal = normal
+	s.length = make([]float64, n)
+	for i := range s.vertex {
+		e := s.vertex[(i+1)%n].Sub(s.vertex[i])
+		if e.Dot(v[(i+1)%n].Sub(v[i])) <= 0 {
+			return nil, ErrMsg("rounding is too large for the polygon")
+		}
+		s.length[i] = e.Length()
+		s.dir[i] = e.DivScalar(s.length[i])
+	}
+	bb := Box2{v[0], v[0]}
+	for _, p := range v {
+		bb = bb.Include(p)
+	}
+	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -height / 2}, V3{bb.Max.X, bb.Max.Y, height / 2}}
+	return &s, nil
+}
+
+// RegularPrism3D returns an SDF3 for a prism (on the z-axis) with a regular polygon section
+// of n sides and a circumradius. The vertical edges are rounded by round, the edges of the
+// end caps by capRound.
+func RegularPrism3D(n int, radius, height, round, capRound float64) (SDF3, error) {
+	if n < 3 {
+		return nil, ErrMsg("n < 3")
+	}
+	if radius <= 0 {
+		return nil, ErrMsg("radius <= 0")
+	}
+	return Prism3D(Nagon(n, radius), height, round, capRound)
+}
+
+// section returns the distance to the inset polygon.
+func (s *PrismSDF3) section(p V2) float64 {
+	// inside: the largest distance to the edge lines
+	d := math.Inf(-1)
+	for i, v := range s.vertex {
+		d = math.Max(d, p.Sub(v).Dot(s.normal[i]))
+	}
+	if d <= 0 {
+		return d
+	}
+	// outside: the nearest edge facing the point
+	dd := math.MaxFloat64
+	for i, v := range s.vertex {
+		pv := p.Sub(v)
+		if pv.Dot(s.normal[i]) <= 0 {
+			continue
+		}
+		t := Clamp(pv.Dot(s.dir[i]), 0, s.length[i])
+		dd = math.Min(dd, pv.Sub(s.dir[i].MulScalar(t)).Length2())
+	}
+	return math.Sqrt(dd)
+}
+
+// Evaluate returns the minimum distance to a prism.
+func (s *PrismSDF3) Evaluate(p V3) float64 {
+	w := V2{s.section(V2{p.X, p.Y}) - s.offset, math.Abs(p.Z) - s.height}
+	return w.Max(V2{0, 0}).Length() + math.Min(math.Max(w.X, w.Y), 0) - s.round
+}
+
+// BoundingBox returns the bounding box of a prism.
+func (s *PrismSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
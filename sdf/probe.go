@@ -0,0 +1,69 @@
+//-----------------------------------------------------------------------------
+/*
+
+Thickness Probing
+
+Measure the local wall thickness and air gap width at a point on the
+surface by casting rays along the surface normal: into the part to the
+opposite surface (the wall) and out of it to the facing surface (the gap).
+Unlike the skeleton thickness map (the largest inscribed ball), a probe is
+a single measurement across the wall at a chosen point, e.g. one picked
+interactively (see Pick) or the vertices of a mesh (see render.Bake).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// probeSteps is the maximum number of steps moving a probe point onto the surface.
+const probeSteps = 8
+
+// Probe is a wall thickness and air gap measurement at a point on the surface.
+type Probe struct {
+	Point  V3      // point on the surface
+	Normal V3      // outward surface normal at the point
+	Wall   float64 // distance through the part to the opposite surface (Inf: not found)
+	Gap    float64 // distance through the air to the facing surface (Inf: not found)
+	Inner  V3      // opposite surface point
+	Outer  V3      // facing surface point
+}
+
+// ProbeThickness measures the wall thickness and the air gap width at the surface point closest
+// to a point, casting rays along the surface normal up to maxDist.
+func ProbeThickness(s SDF3, p V3, maxDist float64) *Probe {
+	tol := ModelTolerances3(s)
+	// move the point onto the surface
+	for i := 0; i < probeSteps; i++ {
+		d := s.Evaluate(p)
+		if math.Abs(d) < tol.Surface {
+			break
+		}
+		p = p.Sub(tol.Normal3(s, p).MulScalar(d))
+	}
+	n := tol.Normal3(s, p)
+	r := NewRaycastParams3(s, 0)
+	r.Epsilon = tol.Surface
+	cast := func(dir V3) (float64, V3) {
+		// start off the surface, so the ray doesn't stop where it starts
+		ofs := 4 * tol.Surface
+		q, t, _ := r.Raycast3(s, p.Add(dir.MulScalar(ofs)), dir, maxDist-ofs)
+		if t < 0 {
+			return math.Inf(1), V3{}
+		}
+		return t + ofs, q
+	}
+	wall, inner := cast(n.Neg())
+	gap, outer := cast(n)
+	return &Probe{p, n, wall, gap, inner, outer}
+}
+
+// Probe measures the wall thickness and the air gap width at a hit (see ProbeThickness).
+func (h *Hit) Probe(s SDF3, maxDist float64) *Probe {
+	return ProbeThickness(s, h.Point, maxDist)
+}
+
+//-----------------------------------------------------------------------------
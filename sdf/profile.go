@@ -0,0 +1,122 @@
+//-----------------------------------------------------------------------------
+/*
+
+Profile Extrusion
+
+Extrude an SDF2 with a twist, scale and offset that are arbitrary
+functions of z (vases, propellers, lofted transitions).
+
+The mapping from 3D to the profile plane stretches the field along z, so
+the distance is divided by a bound on the gradient (found by sampling the
+derivatives of the functions) to keep the field within the bounding box
+1-Lipschitz.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// ExtrudeProfile defines how an extruded SDF2 changes with z.
+// Nil functions leave the profile unchanged.
+type ExtrudeProfile struct {
+	Twist  func(z float64) float64 // rotation of the profile (radians)
+	Scale  func(z float64) float64 // scale of the profile (> 0)
+	Offset func(z float64) float64 // offset of the profile (> 0 grows the profile)
+}
+
+// profileSamples is the number of z samples used for the bounding box and the Lipschitz bound.
+const profileSamples = 256
+
+// ProfileExtrudeSDF3 is an SDF2 extruded with a z dependent twist, scale and offset.
+type ProfileExtrudeSDF3 struct {
+	sdf    SDF2
+	height float64 // half height
+	twist  func(z float64) float64
+	scale  func(z float64) float64
+	offset func(z float64) float64
+	k      float64 // Lipschitz compensation
+	bb     Box3
+}
+
+// ProfileExtrude3D extrudes an SDF2 (centered on z = 0) with a twist, scale and offset
+// that are functions of z. The bounding box and the Lipschitz compensation are found by
+// sampling the functions.
+func ProfileExtrude3D(sdf SDF2, height float64, k *ExtrudeProfile) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if height <= 0 {
+		return nil, ErrMsg("height <= 0")
+	}
+	zero := func(z float64) float64 { return 0 }
+	one := func(z float64) float64 { return 1 }
+	s := ProfileExtrudeSDF3{sdf, height / 2, k.Twist, k.Scale, k.Offset, 1, Box3{}}
+	if s.twist == nil {
+		s.twist = zero
+	}
+	if s.scale == nil {
+		s.scale = one
+	}
+	if s.offset == nil {
+		s.offset = zero
+	}
+	// bounding box from the largest scale and offset
+	var smax, omax float64
+	for i := 0; i <= profileSamples; i++ {
+		z := s.height * (2*float64(i)/profileSamples - 1)
+		sz := s.scale(z)
+		if sz <= 0 {
+			return nil, ErrMsg("scale <= 0")
+		}
+		smax = math.Max(smax, sz)
+		omax = math.Max(omax, s.offset(z))
+	}
+	bb := sdf.BoundingBox()
+	bb = Box2{bb.Min.MulScalar(smax), bb.Max.MulScalar(smax)}.Enlarge(V2{2 * omax, 2 * omax})
+	if k.Twist != nil {
+		l := math.Max(bb.Min.Length(), bb.Max.Length())
+		bb = Box2{V2{-l, -l}, V2{l, l}}
+	}
+	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
+	// The z component of the gradient is bounded by |s'|*|g| + |s'|*r/s + |t'|*r + |o'|
+	// for a profile distance g at radius r. With |g| <= r/s + (profile radius) this is
+	// evaluated at the bounding box radius.
+	r := math.Max(bb.Min.Length(), bb.Max.Length())
+	pb := sdf.BoundingBox()
+	rp := math.Max(pb.Min.Length(), pb.Max.Length())
+	dz := height * 1e-5
+	derivative := func(f func(z float64) float64, z float64) float64 {
+		return math.Abs(f(z+dz)-f(z-dz)) / (2 * dz)
+	}
+	for i := 0; i <= profileSamples; i++ {
+		z := Clamp(s.height*(2*float64(i)/profileSamples-1), dz-s.height, s.height-dz)
+		sz := s.scale(z)
+		ds := derivative(s.scale, z)
+		c := ds*(2*r/sz+rp) + derivative(s.twist, z)*r + derivative(s.offset, z)
+		s.k = math.Max(s.k, math.Sqrt(1+c*c))
+	}
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a profile extrusion.
+func (s *ProfileExtrudeSDF3) Evaluate(p V3) float64 {
+	z := Clamp(p.Z, -s.height, s.height)
+	k := s.scale(z)
+	xy := V2{p.X, p.Y}
+	q := Rotate(-s.twist(z)).MulPosition(xy).DivScalar(k)
+	g := s.sdf.Evaluate(q)
+	a := (g*k - s.offset(z)) / s.k
+	b := math.Abs(p.Z) - s.height
+	return math.Max(a, b)
+}
+
+// BoundingBox returns the bounding box of a profile extrusion.
+func (s *ProfileExtrudeSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,161 @@
+//-----------------------------------------------------------------------------
+/*
+
+Helical Ramps and Spiral Staircases
+
+A helical ramp is a rectangular section (from the inner to the outer
+radius, with a vertical thickness) swept along a helix about the z-axis.
+A spiral staircase is a stack of treads (annular sectors with a vertical
+thickness), each one a rise (pitch / steps per turn) above the one before.
+Both start at z = 0 and turn counter-clockwise (viewed from +z) for
+positive turns, clockwise for negative turns.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// HelicalRamp3D returns a helical ramp between an inner and outer radius rising
+// by the pitch each turn, with a vertical thickness.
+func HelicalRamp3D(inner, outer, pitch, thickness, turns float64) (SDF3, error) {
+	if inner < 0 {
+		return nil, ErrMsg("inner < 0")
+	}
+	if outer <= inner {
+		return nil, ErrMsg("outer <= inner")
+	}
+	if thickness <= 0 {
+		return nil, ErrMsg("thickness <= 0")
+	}
+	section := Box2D(V2{outer - inner, thickness}, 0)
+	section = Transform2D(section, Translate2d(V2{(inner + outer) / 2, thickness / 2}))
+	return HelixExtrude3D(section, pitch, turns, 0, 1)
+}
+
+//-----------------------------------------------------------------------------
+
+// StaircaseSDF3 is a spiral staircase.
+type StaircaseSDF3 struct {
+	inner, outer float64 // tread radii
+	rise         float64 // height between treads
+	thickness    float64 // tread thickness
+	angle        float64 // tread angle
+	steps        int     // treads per turn
+	n            int     // number of treads
+	left         bool    // clockwise
+	bb           Box3
+}
+
+// SpiralStaircase3D returns a spiral staircase between an inner and outer radius rising by
+// the pitch each turn, with steps treads per turn of a given (vertical) thickness. For a
+// solid staircase use a thickness of at least the rise (pitch / steps).
+func SpiralStaircase3D(inner, outer, pitch float64, steps int, thickness, turns float64) (SDF3, error) {
+	if inner < 0 {
+		return nil, ErrMsg("inner < 0")
+	}
+	if outer <= inner {
+		return nil, ErrMsg("outer <= inner")
+	}
+	if pitch <= 0 {
+		return nil, ErrMsg("pitch <= 0")
+	}
+	if steps < 3 {
+		return nil, ErrMsg("steps < 3")
+	}
+	if thickness <= 0 {
+		return nil, ErrMsg("thickness <= 0")
+	}
+	if turns == 0 {
+		return nil, ErrMsg("turns == 0")
+	}
+	s := StaircaseSDF3{}
+	s.inner = inner
+	s.outer = outer
+	s.rise = pitch / float64(steps)
+	s.thickness = thickness
+	s.angle = Tau / float64(steps)
+	s.steps = steps
+	s.left = turns < 0
+	s.n = int(math.Ceil(math.Abs(turns)*float64(steps) - 1e-9))
+	zmax := float64(s.n) * s.rise
+	s.bb = Box3{V3{-outer, -outer, math.Min(0, s.rise-thickness)}, V3{outer, outer, zmax}}
+	return &s, nil
+}
+
+// sector returns the distance to an annular sector on the x-axis (-h..h, inner..outer radius)
+// from a point in its upper half (y >= 0).
+func (s *StaircaseSDF3) sector(q V2, h float64) float64 {
+	c, sn := math.Cos(h), math.Sin(h)
+	// the side of the sector
+	a, b := V2{s.inner * c, s.inner * sn}, V2{s.outer * c, s.outer * sn}
+	ab := b.Sub(a)
+	t := Clamp(q.Sub(a).Dot(ab)/ab.Dot(ab), 0, 1)
+	side := q.Sub(a.Add(ab.MulScalar(t))).Length()
+	r := q.Length()
+	if q.Y*c > q.X*sn {
+		// beyond the side (angle > h)
+		return side
+	}
+	if r < s.inner {
+		return s.inner - r
+	}
+	if r > s.outer {
+		return r - s.outer
+	}
+	return -math.Min(side, math.Min(r-s.inner, s.outer-r))
+}
+
+// Evaluate returns the minimum distance to a spiral staircase.
+func (s *StaircaseSDF3) Evaluate(p V3) float64 {
+	y := p.Y
+	if s.left {
+		y = -y
+	}
+	theta := math.Atan2(y, p.X)
+	if theta < 0 {
+		theta += Tau
+	}
+	r := math.Sqrt(p.X*p.X + y*y)
+	h := s.angle / 2
+	// the distance to tread k
+	tread := func(k int) float64 {
+		// the angle from the center of the tread, in -Pi..Pi
+		phi := math.Mod(theta-(float64(k)+0.5)*s.angle, Tau)
+		if phi > Pi {
+			phi -= Tau
+		} else if phi < -Pi {
+			phi += Tau
+		}
+		d2 := s.sector(V2{r * math.Cos(phi), r * math.Abs(math.Sin(phi))}, h)
+		top := float64(k+1) * s.rise
+		dz := math.Abs(p.Z-(top-s.thickness/2)) - s.thickness/2
+		w := V2{d2, dz}
+		return w.Max(V2{0, 0}).Length() + math.Min(math.Max(w.X, w.Y), 0)
+	}
+	clamp := func(k int) int { return imax(0, imin(k, s.n-1)) }
+	// the tread at the angle of the point in the nearest turn
+	k := int(math.Floor(theta / s.angle))
+	k += s.steps * int(math.Round((p.Z-float64(k+1)*s.rise)/(s.rise*float64(s.steps))))
+	k = clamp(k)
+	d := tread(k)
+	// treads that can be nearer (their height range is within d of the point)
+	kLo := clamp(int(math.Floor((p.Z-d)/s.rise)) - 1)
+	kHi := clamp(int(math.Ceil((p.Z + d + s.thickness) / s.rise)))
+	for j := kLo; j <= kHi; j++ {
+		if j != k {
+			d = math.Min(d, tread(j))
+		}
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a spiral staircase.
+func (s *StaircaseSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
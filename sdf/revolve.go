@@ -0,0 +1,77 @@
+//-----------------------------------------------------------------------------
+/*
+
+Revolve Sweeps
+
+Revolve a 2D profile with more control than Revolve3D/RevolveTheta3D:
+
+Partial sweeps: the profile sweeps through an angle, starting at a given
+angle, and the ends are capped by flat faces.
+
+Axis offset: the axis of revolution is moved away from the profile y-axis,
+e.g. a circle centered on the profile origin with an offset axis revolves
+to a torus, and to a torus with a gap when the sweep is partial.
+
+Multi-turn helical sweeps: the profile rises by the pitch on each turn
+(see HelixExtrude3D) and can sweep through any number of turns.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// RevolveParms defines the parameters of a revolve sweep.
+type RevolveParms struct {
+	Theta  float64 // sweep angle (radians), 0 for a full revolution, > 2 pi for helical sweeps
+	Start  float64 // angle of the start of the sweep (radians, from the x-axis)
+	Offset float64 // distance from the profile y-axis to the axis of revolution
+	Pitch  float64 // height change per turn (< 0 for a left handed helix), 0 for a flat sweep
+}
+
+// RevolveSweep3D revolves an SDF2 profile about the z-axis. The profile x-axis is the
+// distance from the axis (plus the offset) and the profile y-axis is the height.
+func RevolveSweep3D(sdf SDF2, k *RevolveParms) (SDF3, error) {
+	if sdf == nil {
+		return nil, ErrMsg("sdf == nil")
+	}
+	if k.Theta < 0 {
+		return nil, ErrMsg("theta < 0")
+	}
+	if k.Pitch == 0 && k.Theta > Tau {
+		return nil, ErrMsg("theta > 2 pi needs a pitch")
+	}
+	if k.Offset != 0 {
+		sdf = Transform2D(sdf, Translate2d(V2{k.Offset, 0}))
+	}
+	var s SDF3
+	var err error
+	if k.Pitch == 0 {
+		theta := k.Theta
+		if theta == Tau {
+			theta = 0
+		}
+		s, err = RevolveTheta3D(sdf, theta)
+	} else {
+		turns := k.Theta / Tau
+		if turns == 0 {
+			return nil, ErrMsg("helical sweeps need theta > 0")
+		}
+		if k.Pitch < 0 {
+			turns = -turns
+		}
+		s, err = HelixExtrude3D(sdf, math.Abs(k.Pitch), turns, 0, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.Start != 0 {
+		s = Transform3D(s, RotateZ(k.Start))
+	}
+	return s, nil
+}
+
+//-----------------------------------------------------------------------------
@@ -141,7 +141,10 @@ func (s *SorSDF3) BoundingBox() Box3 {
 type ExtrudeSDF3 struct {
 	sdf     SDF2
 	height  float64
-	extrude ExtrudeFunc
+	twist   float64     // twist per unit z (radians)
+	scaled  bool        // scale the SDF2 with z
+	m, b    V2          // slope and intercept of the scale
+	extrude ExtrudeFunc // custom extrusion function (nil: the twist and scale)
 	bb      Box3
 }
 
@@ -150,7 +153,6 @@ func Extrude3D(sdf SDF2, height float64) SDF3 {
 	s := ExtrudeSDF3{}
 	s.sdf = sdf
 	s.height = height / 2
-	s.extrude = NormalExtrude
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	s.bb = Box3{V3{bb.Min.X, bb.Min.Y, -s.height}, V3{bb.Max.X, bb.Max.Y, s.height}}
@@ -162,7 +164,7 @@ func TwistExtrude3D(sdf SDF2, height, twist float64) SDF3 {
 	s := ExtrudeSDF3{}
 	s.sdf = sdf
 	s.height = height / 2
-	s.extrude = TwistExtrude(height, twist)
+	s.twist = twist / height
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	l := bb.Max.Length()
@@ -170,12 +172,20 @@ func TwistExtrude3D(sdf SDF2, height, twist float64) SDF3 {
 	return &s
 }
 
+// setScale sets the scale of the SDF2 at the top of the extrusion (see ScaleExtrude).
+func (s *ExtrudeSDF3) setScale(height float64, scale V2) {
+	inv := V2{1 / scale.X, 1 / scale.Y}
+	s.scaled = true
+	s.m = inv.Sub(V2{1, 1}).DivScalar(height) // slope
+	s.b = inv.DivScalar(2).AddScalar(0.5)     // intercept
+}
+
 // ScaleExtrude3D extrudes an SDF2 and scales it over the height of the extrusion.
 func ScaleExtrude3D(sdf SDF2, height float64, scale V2) SDF3 {
 	s := ExtrudeSDF3{}
 	s.sdf = sdf
 	s.height = height / 2
-	s.extrude = ScaleExtrude(height, scale)
+	s.setScale(height, scale)
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	bb = bb.Extend(Box2{bb.Min.Mul(scale), bb.Max.Mul(scale)})
@@ -188,7 +198,8 @@ func ScaleTwistExtrude3D(sdf SDF2, height, twist float64, scale V2) SDF3 {
 	s := ExtrudeSDF3{}
 	s.sdf = sdf
 	s.height = height / 2
-	s.extrude = ScaleTwistExtrude(height, twist, scale)
+	s.twist = twist / height
+	s.setScale(height, scale)
 	// work out the bounding box
 	bb := sdf.BoundingBox()
 	bb = bb.Extend(Box2{bb.Min.Mul(scale), bb.Max.Mul(scale)})
@@ -197,17 +208,43 @@ func ScaleTwistExtrude3D(sdf SDF2, height, twist float64, scale V2) SDF3 {
 	return &s
 }
 
+// ExtrudeContours3D does a linear extrude of multiple closed contours (outer boundaries and holes).
+// The fill rule determines which regions of the contours are inside.
+func ExtrudeContours3D(contours [][]V2, rule FillRule, height float64) (SDF3, error) {
+	s, err := MultiPolygonFill2D(contours, rule)
+	if err != nil {
+		return nil, err
+	}
+	return Extrude3D(s, height), nil
+}
+
 // Evaluate returns the minimum distance to an extrusion.
 func (s *ExtrudeSDF3) Evaluate(p V3) float64 {
 	// sdf for the projected 2d surface
-	a := s.sdf.Evaluate(s.extrude(p))
+	a := s.sdf.Evaluate(s.project(p))
 	// sdf for the extrusion region: z = [-height, height]
 	b := math.Abs(p.Z) - s.height
 	// return the intersection
 	return math.Max(a, b)
 }
 
+// project returns the point used to evaluate the SDF2: scaled and then twisted.
+func (s *ExtrudeSDF3) project(p V3) V2 {
+	if s.extrude != nil {
+		return s.extrude(p)
+	}
+	q := V2{p.X, p.Y}
+	if s.scaled {
+		q = q.Mul(s.m.MulScalar(p.Z).Add(s.b))
+	}
+	if s.twist != 0 {
+		q = Rotate(p.Z * s.twist).MulPosition(q)
+	}
+	return q
+}
+
 // SetExtrude sets the extrusion control function.
+// A closure makes the model uncacheable (see CacheKey).
 func (s *ExtrudeSDF3) SetExtrude(extrude ExtrudeFunc) {
 	s.extrude = extrude
 }
@@ -6,9 +6,14 @@ package sdf
 
 import (
 	"fmt"
+	"image"
+	"image/color"
 	"math"
 	"reflect"
 	"testing"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
 )
 
 //-----------------------------------------------------------------------------
@@ -829,3 +834,1561 @@ func Test_Normal(t *testing.T) {
 }
 
 //-----------------------------------------------------------------------------
+
+func Test_Exact(t *testing.T) {
+	sphere, _ := Sphere3D(1)
+	box, _ := Box3D(V3{1, 2, 3}, 0)
+	if !IsExact3(sphere) || !IsExact3(box) {
+		t.Fatal("primitives should be exact")
+	}
+	if !IsExact3(Transform3D(box, RotateZ(1).Mul(Translate3d(V3{1, 2, 3})))) {
+		t.Error("rigidly transformed exact SDF should be exact")
+	}
+	if IsExact3(Union3D(sphere, Transform3D(box, Translate3d(V3{1, 2, 3})))) {
+		t.Error("union should not be exact")
+	}
+	if !IsExact3(Offset3D(box, 0.5)) || IsExact3(Offset3D(box, -0.5)) {
+		t.Error("only positive offsets of exact SDFs should be exact")
+	}
+	if IsExact3(Transform3D(sphere, Scale3d(V3{1, 2, 1}))) {
+		t.Error("non-uniform scaling should not be exact")
+	}
+	u := Union3D(sphere, box).(*UnionSDF3)
+	u.SetMin(RoundMin(0.1))
+	if IsExact3(u) {
+		t.Error("blended union should not be exact")
+	}
+
+	// a sphere scaled by 2 with a non-exact transform
+	s, err := Redistance3D(Transform3D(sphere, Scale3d(V3{2, 2, 2})), 0.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []V3{{2.2, 0, 0}, {0, -1.7, 0}, {1, 1, 1.2}} {
+		d := s.Evaluate(p)
+		if math.Abs(d-(p.Length()-2)) > 1e-4 {
+			t.Errorf("at %v expected %f, actual %f", p, p.Length()-2, d)
+		}
+	}
+	// the corrected distance of a union is never more than the distance to the surface
+	u1 := Union3D(Transform3D(sphere, Scale3d(V3{1, 2, 1})), Transform3D(box, Translate3d(V3{0.5, 0, 0})))
+	s, _ = Redistance3D(u1, 0.5)
+	for _, p := range []V3{{0.3, 0.2, 0}, {1.2, 0, 0}, {0, 1.9, 0}} {
+		if d, d0 := s.Evaluate(p), u1.Evaluate(p); math.Abs(d) > math.Abs(d0)/LipschitzBound3(u1, p, p)+1e-9 {
+			t.Errorf("at %v distance %f is more than the bound %f", p, d, d0)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Normalize(t *testing.T) {
+	sphere, _ := Sphere3D(1)
+	// non-uniform scaling distorts the distance field
+	s0 := Transform3D(sphere, Scale3d(V3{3, 1, 1}))
+	s1, err := Normalize3D(s0, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{3.5, 0, 0}, 0.5},
+		{V3{4, 0, 0}, 1},
+		{V3{0, 1.5, 0}, 0.5},
+		{V3{0, 0, 0}, -1},
+	}
+	for _, v := range tests {
+		d := s1.Evaluate(v.p)
+		if math.Abs(d-v.d) > 0.05 {
+			t.Errorf("at %v expected %f, actual %f (distorted %f)", v.p, v.d, d, s0.Evaluate(v.p))
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Gradient(t *testing.T) {
+	sphere, _ := Sphere3D(1)
+	box, _ := Box3D(V3{1, 2, 3}, 0.1)
+	cylinder, _ := Cylinder3D(3, 0.5, 0.1)
+	s := Difference3D(Union3D(sphere, Transform3D(box, RotateX(0.3).Mul(Translate3d(V3{1, 0, 0})))), cylinder)
+	s = Union3D(s, Transform3D(Extrude3D(Box2D(V2{1, 1}, 0.1), 1), Translate3d(V3{0, 0, 2})))
+	s = Transform3D(s, Scale3d(V3{1, 2, 0.5}))
+	b := s.BoundingBox().ScaleAboutCenter(1.5)
+	const eps = 1e-7
+	for i := 0; i < 1000; i++ {
+		p := b.Random()
+		g0 := s.(SDF3Gradient).Gradient(p)
+		g1 := centralDifference3(s.Evaluate, p, eps)
+		if !g0.Equals(g1, 1e-4) {
+			// central differences are not accurate at discontinuities, recheck with a smaller step
+			g2 := centralDifference3(s.Evaluate, p, eps*1e-2)
+			if !g0.Equals(g2, 1e-3) {
+				t.Errorf("at %v analytic %v, numeric %v", p, g0, g1)
+			}
+		}
+	}
+}
+
+// cubicSDF3 is x^3 (without an analytic gradient).
+type cubicSDF3 struct{}
+
+func (s *cubicSDF3) Evaluate(p V3) float64 { return p.X * p.X * p.X }
+func (s *cubicSDF3) BoundingBox() Box3     { return Box3{V3{-1, -1, -1}, V3{1, 1, 1}} }
+
+func Test_Gradient_Epsilon(t *testing.T) {
+	// the central difference of x^3 at 0 is eps^2
+	sphere, _ := Sphere3D(1)
+	s := Union3D(Transform3D(&cubicSDF3{}, Translate3d(V3{1, 0, 0})), Transform3D(sphere, Translate3d(V3{10, 0, 0})))
+	p := V3{1, 0, 0}
+	for _, eps := range []float64{1e-3, 0.1, 0.5} {
+		if g := Gradient3(s, p, eps); math.Abs(g.X-eps*eps) > 1e-9 {
+			t.Errorf("eps %g: expected %g, actual %g", eps, eps*eps, g.X)
+		}
+	}
+	// the Gradient method uses the default step
+	if g := s.(SDF3Gradient).Gradient(p); math.Abs(g.X) > 1e-9 {
+		t.Errorf("expected 0, actual %g", g.X)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Lipschitz(t *testing.T) {
+	sphere, _ := Sphere3D(1)
+	box, _ := Box3D(V3{1, 2, 3}, 0.1)
+	s := Union3D(sphere, Transform3D(box, Translate3d(V3{2, 0, 0})))
+	if v := CheckLipschitz3(s, 1000, 0.01); len(v) != 0 {
+		t.Errorf("expected no violations, got %v", v)
+	}
+	// squashing a box in x makes its gradient larger than 1
+	s = Union3D(sphere, Transform3D(box, Scale3d(V3{0.25, 1, 1})))
+	v := CheckLipschitz3(s, 1000, 0.01)
+	if len(v) != 2 {
+		t.Fatalf("expected 2 violations, got %v", v)
+	}
+	if v[0].Path != "UnionSDF3[1]/TransformSDF3" || !v[0].Source {
+		t.Errorf("bad source violation %v", v[0])
+	}
+	if v[1].Path != "UnionSDF3" || v[1].Source {
+		t.Errorf("bad parent violation %v", v[1])
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_MinFeatureSize(t *testing.T) {
+	plate, _ := Box3D(V3{10, 10, 1}, 0)
+	fin, _ := Box3D(V3{0.2, 5, 3}, 0)
+	sphere, _ := Sphere3D(2)
+	tests := []struct {
+		s    SDF3
+		size float64
+	}{
+		{plate, 1},
+		{sphere, 4},
+		{Union3D(plate, Transform3D(fin, Translate3d(V3{0, 0, 1.5}))), 0.2},
+		{Transform3D(plate, RotateX(0.3)), 1},
+	}
+	for i, v := range tests {
+		size, err := MinFeatureSize3(v.s, 2000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(size-v.size) > 0.01*v.size {
+			t.Errorf("test %d: expected %f, actual %f", i, v.size, size)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// nanSDF3 returns NaN for x > 0.
+type nanSDF3 struct{ SDF3 }
+
+func (s *nanSDF3) Evaluate(p V3) float64 {
+	if p.X > 0 {
+		return math.NaN()
+	}
+	return s.SDF3.Evaluate(p)
+}
+
+func Test_Guard(t *testing.T) {
+	var warnings []*Warning
+	SetWarningHandler(func(w *Warning) { warnings = append(warnings, w) })
+	defer SetWarningHandler(nil)
+	sphere, _ := Sphere3D(1)
+	s := Guard3D(Union3D(sphere, Transform3D(&nanSDF3{sphere}, Translate3d(V3{1, 0, 0}))))
+	s.Evaluate(V3{-3, 0, 0})
+	if len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+	s.Evaluate(V3{2, 0, 0})
+	s.Evaluate(V3{3, 0, 0})
+	if len(warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %v", warnings)
+	}
+	w := warnings[0]
+	if w.Kind != WarnNonFinite || w.Path != "UnionSDF3[1]/TransformSDF3[0]/nanSDF3" || !w.Point.Equals(V3{1, 0, 0}, tolerance) {
+		t.Errorf("bad warning %v", w)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// boxedSDF3 is an SDF3 with a user defined bounding box.
+type boxedSDF3 struct {
+	SDF3
+	bb Box3
+}
+
+func (s *boxedSDF3) BoundingBox() Box3 { return s.bb }
+
+func Test_BoundingBox(t *testing.T) {
+	sphere, _ := Sphere3D(2)
+	box, _ := Box3D(V3{1, 2, 3}, 0)
+	s := Union3D(Transform3D(sphere, Translate3d(V3{1, 2, 3})), Transform3D(box, RotateZ(0.5)))
+	s = Transform3D(s, Scale3d(V3{1, 0.5, 2}))
+	bb, err := EstimateBoundingBox3(s, V3{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the estimate may be a little larger, but must contain the real box
+	if !bb.Equals(s.BoundingBox(), 1e-3) || !bb.Contains(s.BoundingBox().Min) || !bb.Contains(s.BoundingBox().Max) {
+		t.Errorf("expected %v, actual %v", s.BoundingBox(), bb)
+	}
+	if err := ValidateBoundingBox3(s, 16); err != nil {
+		t.Error(err)
+	}
+	clipped := &boxedSDF3{sphere, Box3{V3{-2, -2, -2}, V3{2, 2, 1}}}
+	if err := ValidateBoundingBox3(clipped, 16); err == nil {
+		t.Error("expected clipped bounding box error")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// plainSDF3 hides any optional interfaces (e.g gradients) of an SDF3.
+type plainSDF3 struct{ SDF3 }
+
+func Test_Tolerances(t *testing.T) {
+	for _, r := range []float64{1e-4, 1, 1e4} {
+		sphere, _ := Sphere3D(r)
+		s := &plainSDF3{sphere}
+		tol := ModelTolerances3(s)
+		n := V3{0.6, 0.8, 0}
+		if x := tol.Normal3(s, n.MulScalar(r)); !x.Equals(n, 1e-6) {
+			t.Errorf("radius %g: expected normal %v, actual %v", r, n, x)
+		}
+		p, dist, _ := tol.Raycast3(s, V3{-3 * r, 0, 0}, V3{1, 0, 0}, 10*r, 100)
+		if math.Abs(dist-2*r) > 1e-5*r || math.Abs(p.X+r) > 1e-5*r {
+			t.Errorf("radius %g: expected collision at %v, actual %v", r, -r, p)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// planeSDF3 is the xy plane, clipped to a square.
+type planeSDF3 struct{}
+
+func (s *planeSDF3) Evaluate(p V3) float64 { return p.Z }
+func (s *planeSDF3) BoundingBox() Box3     { return Box3{V3{-2, -2, 0}, V3{2, 2, 0}} }
+
+func Test_Sheet(t *testing.T) {
+	s, _ := Sheet3D(&planeSDF3{}, 0.2)
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{0, 0, 0}, -0.1},
+		{V3{1, 1, 0.05}, -0.05},
+		{V3{1, 1, 0.5}, 0.4},
+		{V3{1, 1, -0.5}, 0.4},
+		{V3{3.1, 0, 0}, 1},
+	}
+	for _, v := range tests {
+		if d := s.Evaluate(v.p); math.Abs(d-v.d) > tolerance {
+			t.Errorf("at %v expected %f, actual %f", v.p, v.d, d)
+		}
+	}
+}
+
+// gsubFont returns font data with a GSUB table containing
+// smcp: glyphs 1,2 -> 20,21 and liga: glyphs 3,4 -> 30.
+func gsubFont() []byte {
+	tag := func(s string) []uint16 {
+		return []uint16{uint16(s[0])<<8 | uint16(s[1]), uint16(s[2])<<8 | uint16(s[3])}
+	}
+	var w []uint16
+	add := func(x ...uint16) { w = append(w, x...) }
+	// font header and table directory
+	add(1, 0, 1, 0, 0, 0)
+	add(tag("GSUB")...)
+	add(0, 0, 0, 28, 0, 122)
+	// GSUB header
+	add(1, 0, 10, 32, 58)
+	// script list, DFLT script and default language system
+	add(1)
+	add(tag("DFLT")...)
+	add(8, 4, 0, 0, 0xffff, 2, 0, 1)
+	// feature list
+	add(2)
+	add(tag("liga")...)
+	add(14)
+	add(tag("smcp")...)
+	add(20, 0, 1, 1, 0, 1, 0)
+	// lookup list, single substitution (format 2)
+	add(2, 6, 32, 1, 0, 1, 8, 2, 10, 2, 20, 21, 1, 2, 1, 2)
+	// ligature substitution
+	add(4, 0, 1, 8, 1, 18, 1, 8, 1, 4, 30, 2, 4, 1, 1, 3)
+	b := make([]byte, 2*len(w))
+	for i, x := range w {
+		b[2*i], b[2*i+1] = byte(x>>8), byte(x)
+	}
+	return b
+}
+
+func Test_GSUB(t *testing.T) {
+	ff, err := ParseFontFeatures(gsubFont())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFontFeatures(nil); err == nil {
+		t.Error("expected an error for data without a GSUB table")
+	}
+	g := ff.gsub
+	tests := []struct {
+		features []string
+		result   []truetype.Index
+	}{
+		{nil, []truetype.Index{1, 3, 4, 2, 5}},
+		{[]string{"liga"}, []truetype.Index{1, 30, 2, 5}},
+		{[]string{"smcp"}, []truetype.Index{20, 3, 4, 21, 5}},
+		{[]string{"liga", "smcp"}, []truetype.Index{20, 30, 21, 5}},
+	}
+	for _, v := range tests {
+		gs := g.apply(v.features, []truetype.Index{1, 3, 4, 2, 5})
+		if !reflect.DeepEqual(gs, v.result) {
+			t.Errorf("%v: expected %v, actual %v", v.features, v.result, gs)
+		}
+	}
+}
+
+func Test_TextPath(t *testing.T) {
+	pl := newPolyline(ArcPath(2, math.Pi, 0, 1000))
+	if math.Abs(pl.length()-2*math.Pi) > 1e-4 {
+		t.Errorf("expected length %f, actual %f", 2*math.Pi, pl.length())
+	}
+	if p := pl.point(pl.length() / 2); !p.Equals(V2{0, 2}, 1e-6) {
+		t.Errorf("expected midpoint %v, actual %v", V2{0, 2}, p)
+	}
+	// an "I" centered on a clockwise arc (top to bottom) stands on the arc at (20, 0),
+	// rotated to point away from the center
+	f, err := ParseFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const h = 4
+	s, err := TextPathSDF2(f, NewText("I"), h, ArcPath(20, 0.5*math.Pi, -0.5*math.Pi, 1000), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// along the stem
+	for _, x := range []float64{0.1, 0.2, 0.3, 0.4} {
+		if p := (V2{20 + x*h, 0}); s.Evaluate(p) >= 0 {
+			t.Errorf("expected %v inside the glyph, actual %g", p, s.Evaluate(p))
+		}
+	}
+	// away from the glyph, and where an unrotated glyph would be
+	for _, p := range []V2{{0, 0}, {20 + 2*h, 0}, {20 - h, 0}, {20, 0.3 * h}, {20, -0.3 * h}, {0, 20.5}} {
+		if s.Evaluate(p) <= 0 {
+			t.Errorf("expected %v outside the glyph, actual %g", p, s.Evaluate(p))
+		}
+	}
+	if _, err := TextPathSDF2(f, NewText("a long line of text"), h, ArcPath(1, 0.5*math.Pi, -0.5*math.Pi, 100), 0); err == nil {
+		t.Error("expected an error for text longer than the path")
+	}
+}
+
+func Test_Trace(t *testing.T) {
+	// a black ring on a white background
+	img := image.NewGray(image.Rect(0, 0, 50, 50))
+	for y := 0; y < 50; y++ {
+		for x := 0; x < 50; x++ {
+			r := math.Hypot(float64(x)+0.5-25, float64(y)+0.5-25)
+			if r > 10 && r < 20 {
+				img.SetGray(x, y, color.Gray{0})
+			} else {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	cs, err := TraceContours(img, &TraceParms{Simplify: 0.25})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 contours, actual %d", len(cs))
+	}
+	s, _ := TraceImage2D(img, &TraceParms{Simplify: 0.25})
+	tests := []struct {
+		p V2
+		d float64
+	}{
+		{V2{25, 25}, 10},
+		{V2{40, 25}, -5},
+		{V2{25, 50}, 5},
+	}
+	for _, v := range tests {
+		if d := s.Evaluate(v.p); math.Abs(d-v.d) > 0.5 {
+			t.Errorf("at %v expected %f, actual %f", v.p, v.d, d)
+		}
+	}
+}
+
+func Test_Blend2D(t *testing.T) {
+	// half planes x >= 0, y >= 0 and y <= 0
+	a := Transform2D(Box2D(V2{100, 200}, 0), Translate2d(V2{50, 0}))
+	b := Transform2D(Box2D(V2{200, 100}, 0), Translate2d(V2{0, 50}))
+	c := Transform2D(Box2D(V2{200, 100}, 0), Translate2d(V2{0, -50}))
+	tests := []struct {
+		s SDF2
+		p V2
+		d float64
+	}{
+		{RoundUnion2D(1, a, b), V2{-0.5, -0.5}, 1 - 0.5*math.Sqrt2},
+		{RoundIntersect2D(1, a, b), V2{0, 0}, math.Sqrt2 - 1},
+		{RoundDifference2D(1, a, c), V2{0, 0}, math.Sqrt2 - 1},
+		{ChamferUnion2D(1, a, b), V2{-0.25, -0.25}, -0.5 * math.Sqrt2 / 2},
+		{StairsUnion2D(1, 2, a, b), V2{0, -5}, 0},
+		{StairsIntersect2D(1, 2, a, b), V2{5, 0}, 0},
+	}
+	for i, v := range tests {
+		if d := v.s.Evaluate(v.p); math.Abs(d-v.d) > tolerance {
+			t.Errorf("test %d: at %v expected %f, actual %f", i, v.p, v.d, d)
+		}
+	}
+	// less than one step is one step
+	for _, n := range []int{0, -2} {
+		for _, p := range []V2{{-0.5, -0.5}, {0.2, -0.7}, {3, 3}} {
+			if d0, d1 := StairsUnion2D(1, n, a, b).Evaluate(p), StairsUnion2D(1, 1, a, b).Evaluate(p); d0 != d1 {
+				t.Errorf("%d steps: at %v expected %f, actual %f", n, p, d1, d0)
+			}
+			if d0, d1 := StairsIntersect2D(1, n, a, b).Evaluate(p), StairsIntersect2D(1, 1, a, b).Evaluate(p); d0 != d1 {
+				t.Errorf("%d steps: at %v expected %f, actual %f", n, p, d1, d0)
+			}
+		}
+	}
+}
+
+func Test_PolygonCorners(t *testing.T) {
+	// an L shape with a concave corner at (5,5)
+	newL := func() *Polygon {
+		p := NewPolygon()
+		p.AddV2Set([]V2{{0, 0}, {10, 0}, {10, 5}, {5, 5}, {5, 10}, {0, 10}})
+		p.Close()
+		return p
+	}
+	p := newL()
+	corners, _ := p.Corners()
+	for _, c := range corners {
+		if c.Convex != (c.Index != 3) {
+			t.Errorf("corner %d: bad convexity", c.Index)
+		}
+	}
+	// chamfer one corner by index
+	p.ChamferCorners(CornerSizes(map[int]float64{1: 2 * math.Sqrt2}))
+	v := p.Vertices()
+	if len(v) != 7 || !v[1].Equals(V2{8, 0}, tolerance) || !v[2].Equals(V2{10, 2}, tolerance) {
+		t.Errorf("bad chamfer %v", v)
+	}
+	// fillet the concave corner only
+	p = newL()
+	p.FilletCorners(ConcaveCorners(1), 4)
+	if v := p.Vertices(); len(v) != 10 || !v[3].Equals(V2{6, 5}, tolerance) {
+		t.Errorf("bad fillet %v", v)
+	}
+}
+
+func Test_Sketch(t *testing.T) {
+	// a 10 x 5 slot with a rounded right hand end, drawn roughly
+	s := NewSketch()
+	p0 := s.Point(0, 0)
+	p1 := s.Point(9, 1)
+	p2 := s.Point(11, 4)
+	p3 := s.Point(1, 6)
+	c := s.Point(12, 2)
+	l0 := s.Line(p0, p1)
+	a := s.Arc(c, p1, p2)
+	l1 := s.Line(p2, p3)
+	l2 := s.Line(p3, p0)
+	s.Fix(p0)
+	s.Horizontal(l0)
+	s.Length(l0, 10)
+	s.Horizontal(l1)
+	s.Vertical(l2)
+	s.Tangent(l0, a)
+	s.Tangent(l1, a)
+	s.Distance(p0, p3, 5)
+	if err := s.Solve(); err != nil {
+		t.Fatal(err)
+	}
+	if !c.Position().Equals(V2{10, 2.5}, 1e-6) || math.Abs(a.Radius()-2.5) > 1e-6 {
+		t.Errorf("bad arc center %v radius %f", c.Position(), a.Radius())
+	}
+	sdf, err := s.SDF2(64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := sdf.Evaluate(V2{12.5, 2.5}); math.Abs(d) > 5e-3 {
+		t.Errorf("expected 0, actual %f", d)
+	}
+	if d := sdf.Evaluate(V2{5, 2.5}); math.Abs(d+2.5) > 1e-3 {
+		t.Errorf("expected -2.5, actual %f", d)
+	}
+}
+
+func Test_CatmullRom(t *testing.T) {
+	p := Nagon(8, 10)
+	s, err := CatmullRom2D(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// through the points and close to the circle between them
+	for i := range p {
+		if d := s.Evaluate(p[i]); math.Abs(d) > 1e-6 {
+			t.Errorf("at %v expected 0, actual %f", p[i], d)
+		}
+		mid := p[i].Add(p[(i+1)%len(p)]).Normalize().MulScalar(10)
+		if d := s.Evaluate(mid); math.Abs(d) > 0.1 {
+			t.Errorf("at %v expected ~0, actual %f", mid, d)
+		}
+	}
+}
+
+func Test_ExtrudeContours(t *testing.T) {
+	square := func(r float64, ccw bool) []V2 {
+		v := []V2{{-r, -r}, {r, -r}, {r, r}, {-r, r}}
+		if !ccw {
+			v[1], v[3] = v[3], v[1]
+		}
+		return v
+	}
+	tests := []struct {
+		contours [][]V2
+		rule     FillRule
+		inside   bool // is the center inside?
+	}{
+		{[][]V2{square(4, true), square(2, true)}, FillEvenOdd, false},
+		{[][]V2{square(4, true), square(2, true)}, FillNonZero, true},
+		{[][]V2{square(4, true), square(2, false)}, FillNonZero, false},
+		{[][]V2{square(4, true), square(2, true), square(1, true)}, FillEvenOdd, true},
+	}
+	for i, v := range tests {
+		s, err := ExtrudeContours3D(v.contours, v.rule, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := s.Evaluate(V3{0, 0, 0}); (d < 0) != v.inside {
+			t.Errorf("test %d: bad center distance %f", i, d)
+		}
+		if d := s.Evaluate(V3{3, 0, 0}); math.Abs(d+1) > tolerance {
+			t.Errorf("test %d: expected -1, actual %f", i, d)
+		}
+	}
+}
+
+func Test_HelixExtrude(t *testing.T) {
+	c, _ := Circle2D(2)
+	s, err := HelixExtrude3D(Transform2D(c, Translate2d(V2{10, 0})), 6, 3, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{10, 0, 0}, -2},
+		{V3{10, 0, 3}, 1},
+		{V3{-10, 0, 3}, -2},
+		{V3{10, 0, 18}, -2},
+		{V3{10, 0, 24}, 4},
+	}
+	for _, v := range tests {
+		if d := s.Evaluate(v.p); math.Abs(d-v.d) > tolerance {
+			t.Errorf("at %v expected %f, actual %f", v.p, v.d, d)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ModelHash(t *testing.T) {
+	model := func(r float64) SDF3 {
+		s0, _ := Sphere3D(r)
+		s1, _ := Box3D(V3{1, 2, 3}, 0.1)
+		return Union3D(s0, Transform3D(s1, Translate3d(V3{1, 0, 0})))
+	}
+	h0 := ModelHash(model(1))
+	if h1 := ModelHash(model(1)); h1 != h0 {
+		t.Errorf("same model, different hashes %s %s", h0, h1)
+	}
+	if h1 := ModelHash(model(1.001)); h1 == h0 {
+		t.Error("different models, same hash")
+	}
+	s := model(1).(*UnionSDF3)
+	s.SetMin(RoundMin(0.1))
+	if h1 := ModelHash(s); h1 == h0 {
+		t.Error("different min function, same hash")
+	}
+	if _, ok := CacheKey(model(1)); !ok {
+		t.Error("model without closures is uncacheable")
+	}
+	if _, ok := CacheKey(s); ok {
+		t.Error("model with a closure is cacheable")
+	}
+	// extrusion parameters are hashed
+	c := Box2D(V2{2, 1}, 0)
+	k0, ok0 := CacheKey(TwistExtrude3D(c, 10, 1))
+	k1, ok1 := CacheKey(TwistExtrude3D(c, 10, 3))
+	if !ok0 || !ok1 || k0 == k1 {
+		t.Error("different twists, same hash")
+	}
+	k0, _ = CacheKey(ScaleTwistExtrude3D(c, 10, 1, V2{0.5, 0.5}))
+	k1, _ = CacheKey(ScaleTwistExtrude3D(c, 10, 1, V2{0.5, 0.6}))
+	if k0 == k1 {
+		t.Error("different scales, same hash")
+	}
+	// and evaluate as the extrusion functions
+	e := TwistExtrude3D(c, 10, 1)
+	f := ScaleTwistExtrude3D(c, 10, 2, V2{0.5, 0.7})
+	ec := Extrude3D(c, 10).(*ExtrudeSDF3)
+	ec.SetExtrude(TwistExtrude(10, 1))
+	fc := Extrude3D(c, 10).(*ExtrudeSDF3)
+	fc.SetExtrude(ScaleTwistExtrude(10, 2, V2{0.5, 0.7}))
+	bb := e.BoundingBox()
+	for i := 0; i < 100; i++ {
+		p := bb.Random()
+		if math.Abs(e.Evaluate(p)-ec.Evaluate(p)) > tolerance || math.Abs(f.Evaluate(p)-fc.Evaluate(p)) > tolerance {
+			t.Errorf("extrusion differs at %v", p)
+		}
+	}
+	if _, ok := CacheKey(ec); ok {
+		t.Error("custom extrusion is cacheable")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Raycast_Relaxed(t *testing.T) {
+	r := 10.0
+	s, _ := Sphere3D(r)
+	shell, _ := Shell3D(s, 0.01)
+	for _, relaxed := range []bool{false, true} {
+		k := RaycastParams{StepScale: 1, Epsilon: 1e-9, MaxSteps: 200, Relaxed: relaxed}
+		// rays towards the sphere at increasingly grazing angles
+		for _, y := range []float64{0, 0.5 * r, 0.9 * r, 0.99 * r} {
+			p, dist, steps := k.Raycast3(s, V3{-3 * r, y, 0}, V3{1, 0, 0}, 10*r)
+			x := -math.Sqrt(r*r - y*y)
+			if dist < 0 || math.Abs(p.X-x) > 1e-6 {
+				t.Errorf("relaxed %v y %g: expected collision at x %g, actual %v (%d steps)", relaxed, y, x, p, steps)
+			}
+		}
+		// thin shells must not be stepped over
+		k.MaxSteps = 1000
+		p, dist, _ := k.Raycast3(shell, V3{-3 * r, 0.5 * r, 0}, V3{1, 0, 0}, 10*r)
+		if x := -math.Sqrt((r+0.005)*(r+0.005) - r*r/4); dist < 0 || math.Abs(p.X-x) > 1e-6 {
+			t.Errorf("relaxed %v shell: expected collision at x %g, actual %v", relaxed, x, p)
+		}
+	}
+}
+
+func Test_LipschitzBound(t *testing.T) {
+	s, _ := Sphere3D(1)
+	m := RotateZ(0.3).Mul(RotateX(1.1)).Mul(Scale3d(V3{0.25, 2, 4}))
+	if k := LipschitzBound3(Transform3D(s, m), V3{}, V3{1, 1, 1}); math.Abs(k-4) > 1e-9 {
+		t.Errorf("expected lipschitz bound 4, actual %g", k)
+	}
+	if k := LipschitzBound3(Transform3D(s, RotateY(0.7)), V3{}, V3{1, 1, 1}); math.Abs(k-1) > 1e-9 {
+		t.Errorf("expected lipschitz bound 1, actual %g", k)
+	}
+	// a squashed sphere (field changes 4 times faster than the distance) is hit exactly
+	squashed := Transform3D(s, Scale3d(V3{0.25, 1, 1}))
+	p, dist, _ := Raycast3(squashed, V3{-1, 0.5, 0}, V3{1, 0, 0}, 0, 1, 1e-9, 10, 1000)
+	if x := -0.25 * math.Sqrt(0.75); dist < 0 || math.Abs(p.X-x) > 1e-6 {
+		t.Errorf("squashed: expected collision at x %g, actual %v", x, p)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Pick(t *testing.T) {
+	sphere, _ := Sphere3D(1)
+	box, _ := Box3D(V3{1, 1, 1}, 0)
+	hole, _ := Cylinder3D(4, 0.25, 0)
+	s := Union3D(Difference3D(sphere, hole), Transform3D(box, Translate3d(V3{3, 0, 0})))
+	tests := []struct {
+		from, dir V3
+		p, n      V3
+		path      string
+	}{
+		{V3{-5, 0.5, 0}, V3{1, 0, 0}, V3{-math.Sqrt(0.75), 0.5, 0}, V3{-math.Sqrt(0.75), 0.5, 0}, "UnionSDF3[0]/DifferenceSDF3[0]/SphereSDF3"},
+		{V3{0, 0, 0}, V3{1, 0, 0}, V3{0.25, 0, 0}, V3{-1, 0, 0}, "UnionSDF3[0]/DifferenceSDF3[1]/CylinderSDF3"},
+		{V3{3, 0, 5}, V3{0, 0, -1}, V3{3, 0, 0.5}, V3{0, 0, 1}, "UnionSDF3[1]/TransformSDF3[0]/BoxSDF3"},
+	}
+	for _, v := range tests {
+		h := Pick(s, v.from, v.dir, 20)
+		if h == nil {
+			t.Errorf("ray from %v: no hit", v.from)
+			continue
+		}
+		if !h.Point.Equals(v.p, 1e-4) || !h.Normal.Equals(v.n, 1e-4) || h.Path != v.path {
+			t.Errorf("ray from %v: expected %v %v %s, actual %v %v %s", v.from, v.p, v.n, v.path, h.Point, h.Normal, h.Path)
+		}
+	}
+	if h := Pick(s, V3{0, 5, 5}, V3{0, 1, 0}, 20); h != nil {
+		t.Errorf("expected no hit, actual %v", h.Point)
+	}
+	c := &Camera{V3{3, -5, 0}, V3{3, 0, 0}, V3{0, 0, 1}, Pi / 4, 1}
+	h0, h1 := c.Pick(s, 0, 0), c.Pick(s, 0, 0.1)
+	if h0 == nil || !h0.Point.Equals(V3{3, -0.5, 0}, 1e-4) {
+		t.Errorf("camera: expected hit at %v, actual %v", V3{3, -0.5, 0}, h0)
+	} else if h1 == nil || math.Abs(h0.DistanceTo(h1)-4.5*math.Tan(Pi/8)*0.1) > 1e-4 {
+		t.Errorf("camera: bad measurement %v", h1)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Color(t *testing.T) {
+	red, blue, green := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}, color.RGBA{0, 255, 0, 255}
+	sphere, _ := Sphere3D(1)
+	box, _ := Box3D(V3{1, 1, 1}, 0)
+	hole, _ := Cylinder3D(4, 0.25, 0)
+	s := Union3D(Color3D(sphere, red), Transform3D(Color3D(box, blue), Translate3d(V3{3, 0, 0})))
+	s = Difference3D(s, Color3D(hole, green))
+	if !HasColor3(s) || HasColor3(sphere) {
+		t.Error("bad HasColor3")
+	}
+	tests := []struct {
+		p  V3
+		c  color.RGBA
+		ok bool
+	}{
+		{V3{-1, 0, 0}, red, true},
+		{V3{3, 0, 0.5}, blue, true},
+		{V3{0.25, 0, 0}, green, true},
+	}
+	for _, v := range tests {
+		if c, ok := Color3(s, v.p); c != v.c || ok != v.ok {
+			t.Errorf("at %v expected %v, actual %v", v.p, v.c, c)
+		}
+	}
+	if _, ok := Color3(sphere, V3{1, 0, 0}); ok {
+		t.Error("uncolored sdf has a color")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_RevolveSweep(t *testing.T) {
+	c, _ := Circle2D(1)
+	// half torus with an offset axis, starting at 90 degrees
+	s, err := RevolveSweep3D(c, &RevolveParms{Theta: Pi, Start: Pi / 2, Offset: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		p V3
+		d float64
+	}{
+		{V3{-5 * math.Sqrt2 / 2, 5 * math.Sqrt2 / 2, 0}, -1},
+		{V3{-5, 0, 0}, -1},
+		{V3{0, 5, 2}, 1},
+		{V3{-7, 0, 0}, 1},
+	}
+	for _, v := range tests {
+		if d := s.Evaluate(v.p); math.Abs(d-v.d) > 1e-6 {
+			t.Errorf("at %v expected %g, actual %g", v.p, v.d, d)
+		}
+	}
+	if d := s.Evaluate(V3{5, 0, 0}); d <= 0 {
+		t.Errorf("expected a gap at %v, actual %g", V3{5, 0, 0}, d)
+	}
+	// helical sweep of 2.5 turns
+	s, err = RevolveSweep3D(c, &RevolveParms{Theta: 2.5 * Tau, Offset: 5, Pitch: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, inside := range []bool{true, true, true, false} {
+		p := V3{5, 0, 3 * float64(i)}
+		if d := s.Evaluate(p); (d < 0) != inside {
+			t.Errorf("at %v expected inside %v, actual %g", p, inside, d)
+		}
+	}
+	if _, err := RevolveSweep3D(c, &RevolveParms{Theta: 3 * Tau}); err == nil {
+		t.Error("expected an error for multiple flat turns")
+	}
+}
+
+func Test_ProfileExtrude(t *testing.T) {
+	c, _ := Circle2D(1)
+	// no profile functions: a plain extrusion
+	s0, _ := ProfileExtrude3D(c, 4, &ExtrudeProfile{})
+	s1 := Extrude3D(c, 4)
+	for _, p := range []V3{{0, 0, 0}, {2, 0, 1}, {0.5, 0.5, 3}, {0, -3, -1}} {
+		if d0, d1 := s0.Evaluate(p), s1.Evaluate(p); math.Abs(d0-d1) > 1e-9 {
+			t.Errorf("at %v expected %g, actual %g", p, d1, d0)
+		}
+	}
+	// vase: the radius goes from 1 to 3 and is grown by 0.5
+	s, err := ProfileExtrude3D(c, 10, &ExtrudeProfile{
+		Scale:  func(z float64) float64 { return 2 + z/5 },
+		Offset: func(z float64) float64 { return 0.5 },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []V3{{1.5, 0, -5}, {0, 2.5, 0}, {-3.5, 0, 5}} {
+		if d := s.Evaluate(p); math.Abs(d) > 1e-6 {
+			t.Errorf("at %v expected 0, actual %g", p, d)
+		}
+	}
+	bb := s.BoundingBox()
+	if bb.Max.X < 3.5 || bb.Max.Z != 5 {
+		t.Errorf("bad bounding box %v", bb)
+	}
+	// propeller: a strongly twisted blade must stay 1-Lipschitz
+	blade := Box2D(V2{8, 1}, 0)
+	s, _ = ProfileExtrude3D(blade, 4, &ExtrudeProfile{
+		Twist: func(z float64) float64 { return z * z },
+	})
+	bb = s.BoundingBox()
+	for i := 0; i < 10000; i++ {
+		a := bb.Random()
+		b := a.Add(V3{randomRange(-1, 1), randomRange(-1, 1), randomRange(-1, 1)}.MulScalar(0.05))
+		if k := math.Abs(s.Evaluate(a)-s.Evaluate(b)) / a.Sub(b).Length(); k > 1.01 {
+			t.Fatalf("lipschitz constant %g at %v", k, a)
+		}
+	}
+	if _, err := ProfileExtrude3D(c, 1, &ExtrudeProfile{Scale: func(z float64) float64 { return z }}); err == nil {
+		t.Error("expected an error for scale <= 0")
+	}
+}
+
+func Test_Morphology(t *testing.T) {
+	box, _ := Box3D(V3{4, 4, 4}, 0)
+	s, err := Dilate3D(box, 0.5, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Evaluate(V3{2.5, 0, 0}); math.Abs(d) > 0.05 {
+		t.Errorf("dilate: expected 0, actual %g", d)
+	}
+	s, _ = Erode3D(box, 0.5, 30)
+	if d := s.Evaluate(V3{1.5, 0, 0}); math.Abs(d) > 0.05 {
+		t.Errorf("erode: expected 0, actual %g", d)
+	}
+	// closing fills a narrow gap between two boxes
+	b0 := Transform3D(box, Translate3d(V3{-2.2, 0, 0}))
+	b1 := Transform3D(box, Translate3d(V3{2.2, 0, 0}))
+	s, _ = Close3D(Union3D(b0, b1), 0.5, 30)
+	if d := s.Evaluate(V3{0, 0, 0}); d >= 0 {
+		t.Errorf("close: expected the gap to be filled, actual %g", d)
+	}
+	// opening removes a thin spike
+	c, _ := Cylinder3D(6, 0.1, 0)
+	s, _ = Open3D(Union3D(box, Transform3D(c, Translate3d(V3{0, 0, 2}))), 0.5, 30)
+	if d := s.Evaluate(V3{0, 0, 4}); d <= 0 {
+		t.Errorf("open: expected the spike to be removed, actual %g", d)
+	}
+	if d := s.Evaluate(V3{0, 0, 0}); d >= 0 {
+		t.Errorf("open: expected the box to remain, actual %g", d)
+	}
+	// fill an internal cavity
+	cavity, _ := Sphere3D(1)
+	s, _ = FillVoids3D(Difference3D(box, cavity), 0, 30)
+	if d := s.Evaluate(V3{0, 0, 0}); d >= 0 {
+		t.Errorf("fill: expected the cavity to be filled, actual %g", d)
+	}
+	s, _ = FillVoids3D(Difference3D(box, cavity), 1, 30)
+	if d := s.Evaluate(V3{0, 0, 0}); d <= 0 {
+		t.Errorf("fill: expected the large cavity to remain, actual %g", d)
+	}
+}
+
+func Test_Skeleton(t *testing.T) {
+	// a rod along the z axis
+	c, _ := Cylinder3D(20, 2, 0)
+	k, err := Skeleton3D(c, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(k.Points) == 0 || len(k.Curves) == 0 {
+		t.Fatal("no skeleton")
+	}
+	var longest []MedialPoint
+	for _, curve := range k.Curves {
+		if len(curve) > len(longest) {
+			longest = curve
+		}
+	}
+	for _, p := range longest {
+		if math.Abs(p.Position.Z) < 5 && (math.Abs(p.Radius-2) > 0.2 || V2{p.Position.X, p.Position.Y}.Length() > 0.5) {
+			t.Errorf("medial point %v is off the axis", p)
+		}
+	}
+	if d := k.Thickness(V3{1, 0, 0}); math.Abs(d-4) > 0.4 {
+		t.Errorf("expected a thickness of 4, actual %g", d)
+	}
+	if d := k.Thickness(V3{10, 10, 0}); d != 0 {
+		t.Errorf("expected a thickness of 0, actual %g", d)
+	}
+}
+
+func Test_Booleans(t *testing.T) {
+	s0, _ := Box3D(V3{4, 4, 4}, 0)
+	s1 := Transform3D(s0, Translate3d(V3{2, 0, 0}))
+	x := Xor3D(s0, s1)
+	tests := []struct {
+		p      V3
+		inside bool
+	}{
+		{V3{-1.5, 0, 0}, true},
+		{V3{1, 0, 0}, false},
+		{V3{3.5, 0, 0}, true},
+		{V3{5, 0, 0}, false},
+	}
+	for _, v := range tests {
+		if d := x.Evaluate(v.p); (d < 0) != v.inside {
+			t.Errorf("xor at %v expected inside %v, actual %g", v.p, v.inside, d)
+		}
+	}
+	// the shells overlap along the faces inside the other box
+	c, err := CommonShell3D(s0, s1, 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := c.Evaluate(V3{0, 2, 0}); d >= 0 {
+		t.Errorf("expected a common shell at %v, actual %g", V3{0, 2, 0}, d)
+	}
+	if d := c.Evaluate(V3{-1.5, 2, 0}); d <= 0 {
+		t.Errorf("expected no common shell at %v, actual %g", V3{-1.5, 2, 0}, d)
+	}
+	parts := Partition3D(s0, s1)
+	for i, p := range []V3{{-1.5, 0, 0}, {1, 0, 0}, {3.5, 0, 0}} {
+		for j, s := range parts {
+			if d := s.Evaluate(p); (d < 0) != (i == j) {
+				t.Errorf("part %d at %v: %g", j, p, d)
+			}
+		}
+	}
+}
+
+func Test_Conformal(t *testing.T) {
+	sphere, _ := Sphere3D(10)
+	// a layer of balls at w = -0.5
+	ball, _ := Sphere3D(0.4)
+	balls := Transform3D(Array3D(ball, V3i{21, 21, 1}, V3{1, 1, 1}), Translate3d(V3{-10, -10, -0.5}))
+	lattice, err := Conformal3D(sphere, balls, -1, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the lattice is clipped to the band
+	for _, p := range []V3{{0, 0, 0}, {0, 0, 8.5}, {0, 0, 10.5}, {20, 0, 0}} {
+		if d := lattice.Evaluate(p); d <= 0 {
+			t.Errorf("expected no lattice at %v, actual %g", p, d)
+		}
+	}
+	// the balls follow the surface
+	for _, p := range []V3{{0, 0, 9.5}, {0, 9.5, 0}, {-9.5, 0, 0}} {
+		if d := lattice.Evaluate(p); d >= 0 {
+			t.Errorf("expected a ball at %v, actual %g", p, d)
+		}
+	}
+	if v := CheckLipschitz3(lattice, 2000, 0.1); len(v) != 0 {
+		t.Errorf("lipschitz violations %v", v)
+	}
+	// the texture follows the surface: the same (u, v) on different offsets from the surface
+	dots, _ := Circle2D(0.5)
+	dots = Array2D(dots, V2i{1, 1}, V2{1, 1})
+	texture, err := ConformalTexture3D(sphere, dots, 0, 0.5, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := texture.Evaluate(V3{0, 0, 10.25}); d >= 0 {
+		t.Errorf("expected texture at the pole, actual %g", d)
+	}
+	if d := texture.Evaluate(V3{0, 0, 11}); d <= 0 {
+		t.Errorf("expected no texture above the band, actual %g", d)
+	}
+}
+
+func Test_Field(t *testing.T) {
+	var warnings []*Warning
+	SetWarningHandler(func(w *Warning) { warnings = append(warnings, w) })
+	defer SetWarningHandler(nil)
+	s0, _ := Sphere3D(1)
+	s1 := Transform3D(s0, Translate3d(V3{1.5, 0, 0}))
+	tests := []struct {
+		name  string
+		make  func() (SDF3, error)
+		bound bool
+		p     V3
+		d     float64
+	}{
+		{"min", func() (SDF3, error) { return FieldMin3D(math.Min, s0, s1) }, true, V3{0, 0, 0}, -1},
+		{"polymin", func() (SDF3, error) { return FieldMin3D(PolyMin(0.2), s0, s1) }, true, V3{-2, 0, 0}, 1},
+		{"chamfer", func() (SDF3, error) { return FieldMin3D(ChamferMin(0.2), s0, s1) }, false, V3{-2, 0, 0}, 1},
+		{"max", func() (SDF3, error) { return FieldMax3D(math.Max, s0, s1) }, true, V3{0.75, 0, 0}, -0.25},
+		{"average", func() (SDF3, error) { return FieldSum3D([]float64{0.5, 0.5}, s0, s1) }, true, V3{0, 0, 0}, -0.25},
+		{"sum", func() (SDF3, error) { return FieldSum3D([]float64{1, 1}, s0, s1) }, false, V3{0, 0, 0}, -0.5},
+		{"mul", func() (SDF3, error) { return FieldMul3D(s0, s1) }, false, V3{3, 0, 0}, 2 * 0.5},
+		{"offset", func() (SDF3, error) { return FieldRemap3D(s0, []V2{{-1, -1.5}, {1, 0.5}}) }, true, V3{1.5, 0, 0}, 0},
+		{"steep", func() (SDF3, error) { return FieldRemap3D(s0, []V2{{0, 0}, {1, 3}}) }, false, V3{1.5, 0, 0}, 1.5},
+	}
+	for _, v := range tests {
+		warnings = nil
+		s, err := v.make()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := s.(*FieldSDF3)
+		if (f.Lipschitz() <= 1+fieldTolerance) != v.bound || (len(warnings) == 0) != v.bound {
+			t.Errorf("%s: lipschitz bound %g, %d warnings", v.name, f.Lipschitz(), len(warnings))
+		}
+		if v.bound && len(CheckLipschitz3(s, 2000, 0.05)) != 0 {
+			t.Errorf("%s: lipschitz violation", v.name)
+		}
+		if d := s.Evaluate(v.p); math.Abs(d-v.d) > tolerance {
+			t.Errorf("%s at %v: expected %g, actual %g", v.name, v.p, v.d, d)
+		}
+	}
+	// the remapped surface is within the bounding box
+	s, _ := FieldRemap3D(s0, []V2{{-1, -1.5}, {1, 0.5}})
+	if bb := s.BoundingBox(); bb.Max.X < 1.5 {
+		t.Errorf("remap bounding box %v", bb)
+	}
+}
+
+func Test_Density(t *testing.T) {
+	// a sphere of voxels
+	d := NewDensityGrid(Box3{V3{-10, -10, -10}, V3{10, 10, 10}}, V3i{20, 20, 20})
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			for k := 0; k < 20; k++ {
+				if (V3{float64(i) - 9.5, float64(j) - 9.5, float64(k) - 9.5}).Length() < 6 {
+					d.Density[d.Index(i, j, k)] = 1
+				}
+			}
+		}
+	}
+	for _, smoothing := range []int{0, 2} {
+		s, err := Density3D(d, 0.5, smoothing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range []V3{{0, 0, 4}, {0, 0, 9}, {12, 0, 0}, {0, -20, 0}} {
+			if e := s.Evaluate(p) - (p.Length() - 6); math.Abs(e) > 1 {
+				t.Errorf("smoothing %d at %v: expected %g, actual %g", smoothing, p, p.Length()-6, s.Evaluate(p))
+			}
+		}
+	}
+	if _, err := Density3D(&DensityGrid{d.Box, d.Cells, d.Density[1:]}, 0.5, 0); err == nil {
+		t.Error("expected an error for a bad density count")
+	}
+
+	// a cantilever fixed at x = 0, loaded at the far end
+	p := &TopologyProblem{
+		Domain:         Box3{V3{0, 0, 0}, V3{12, 4, 2}},
+		Cells:          V3i{12, 4, 2},
+		VolumeFraction: 0.4,
+		Fixed:          func(p V3) bool { return p.X == 0 },
+		Load: func(p V3) V3 {
+			if p.X == 12 && p.Y == 0 {
+				return V3{0, -1, 0}
+			}
+			return V3{}
+		},
+		Iterations: 20,
+	}
+	g, err := p.Optimize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sum float64
+	for _, v := range g.Density {
+		if v < 0 || v > 1 {
+			t.Fatalf("density %g", v)
+		}
+		sum += v
+	}
+	if vf := sum / float64(len(g.Density)); math.Abs(vf-0.4) > 0.01 {
+		t.Errorf("expected volume fraction 0.4, actual %g", vf)
+	}
+	// the fixed end is solid at the top and bottom, where the bending stress is highest
+	if g.Density[g.Index(0, 0, 0)] < 0.5 || g.Density[g.Index(0, 3, 0)] < 0.5 {
+		t.Errorf("expected solid flanges at the fixed end")
+	}
+	s, err := Density3D(g, 0.5, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Evaluate(V3{0.5, 0.5, 1}) >= 0 {
+		t.Error("expected the fixed end to be inside")
+	}
+}
+
+func Test_Engrave(t *testing.T) {
+	base, _ := Box3D(V3{40, 20, 10}, 0)
+	mark := Box2D(V2{6, 2}, 0)
+	for _, emboss := range []bool{false, true} {
+		var s SDF3
+		var err error
+		if emboss {
+			s, err = Emboss3D(base, mark, V3{0, 0, 5}, V3{0, 0, 1}, V3{0, 1, 0}, 1)
+		} else {
+			s, err = Engrave3D(base, mark, V3{0, 0, 5}, V3{0, 0, 1}, V3{0, 1, 0}, 1)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the marking is 6 wide on the right axis (+x) and 2 high on the up axis (+y)
+		if emboss {
+			if s.Evaluate(V3{2.5, 0, 5.5}) >= 0 || s.Evaluate(V3{0, 2, 5.5}) <= 0 {
+				t.Error("bad embossing")
+			}
+		} else {
+			if s.Evaluate(V3{2.5, 0, 4.5}) <= 0 || s.Evaluate(V3{0, 2, 4.5}) >= 0 {
+				t.Error("bad engraving")
+			}
+		}
+		// the opposite surface is not marked
+		if s.Evaluate(V3{0, 0, -4.5}) != base.Evaluate(V3{0, 0, -4.5}) {
+			t.Errorf("emboss %v: marked opposite surface", emboss)
+		}
+		r := s.(*MarkSDF3).Region()
+		for _, p := range []V3{{15, 0, 5}, {0, 8, 4.9}, {0, 0, -5}} {
+			if r.Contains(p) || s.Evaluate(p) != base.Evaluate(p) {
+				t.Errorf("emboss %v: changed outside the region at %v", emboss, p)
+			}
+		}
+	}
+	if _, err := Engrave3D(base, mark, V3{0, 0, 5}, V3{0, 0, 1}, V3{0, 0, 2}, 1); err == nil {
+		t.Error("expected an error for a parallel up vector")
+	}
+}
+
+func Test_GradedLattice(t *testing.T) {
+	body, _ := Box3D(V3{80, 80, 80}, 0)
+	// the Schwarz P surface crosses the diagonal at (c/4, c/4, c/4) with the normal along the diagonal
+	s, err := GradedLattice3D(body, SchwarzPLattice, Grade{P0: 10}, Grade{P0: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := V3{1, 1, 1}.Normalize()
+	c := V3{2.5, 2.5, 2.5}
+	var width float64
+	for x := -2.0; x < 2; x += 0.001 {
+		if s.Evaluate(c.Add(dir.MulScalar(x))) < 0 {
+			width += 0.001
+		}
+	}
+	if math.Abs(width-1) > 0.02 {
+		t.Errorf("expected wall thickness 1, actual %g", width)
+	}
+	// cell size 4 at the surface to 8 at depth 20
+	cell := Grade{body, 0, -20, 4, 8}
+	thickness := Grade{body, 0, -20, 1, 0.5}
+	s, err = GradedLattice3D(body, GyroidLattice, cell, thickness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s4, _ := GradedLattice3D(body, GyroidLattice, Grade{P0: 4}, Grade{P0: 1})
+	s8, _ := GradedLattice3D(body, GyroidLattice, Grade{P0: 8}, Grade{P0: 0.5})
+	for _, p := range []V3{{39.9, 1, 2}, {-39.7, 3, 5}} {
+		if math.Abs(s.Evaluate(p)-s4.Evaluate(p)) > 0.01 {
+			t.Errorf("expected the cell size 4 lattice at %v", p)
+		}
+	}
+	for _, p := range []V3{{0, 1, 2}, {15, -3, 5}} {
+		if s.Evaluate(p) != s8.Evaluate(p) {
+			t.Errorf("expected the cell size 8 lattice at %v", p)
+		}
+	}
+	// continuous across the grade
+	step := 0.001
+	prev := s.Evaluate(V3{-40, 0.3, 0.2})
+	for x := -40.0; x < 40; x += step {
+		v := s.Evaluate(V3{x, 0.3, 0.2})
+		if math.Abs(v-prev) > 1.2*step {
+			t.Fatalf("discontinuity at x = %g", x)
+		}
+		prev = v
+	}
+	if _, err := GradedLattice3D(body, GyroidLattice, Grade{body, 0, -20, 0, 8}, thickness); err == nil {
+		t.Error("expected an error for a zero cell size")
+	}
+}
+
+func Test_Probe(t *testing.T) {
+	// two plates, 0.5 thick with a gap of 1
+	plate, _ := Box3D(V3{4, 4, 0.5}, 0)
+	s := Union3D(plate, Transform3D(plate, Translate3d(V3{0, 0, 1.5})))
+	tests := []struct {
+		p         V3
+		point     V3
+		wall, gap float64
+	}{
+		{V3{0, 0, 0.25}, V3{0, 0, 0.25}, 0.5, 1},
+		{V3{0.3, 0.2, 0.4}, V3{0.3, 0.2, 0.25}, 0.5, 1},
+		{V3{0, 0, 1.25}, V3{0, 0, 1.25}, 0.5, 1},
+		{V3{0, 0, -0.25}, V3{0, 0, -0.25}, 0.5, math.Inf(1)},
+	}
+	for _, v := range tests {
+		pr := ProbeThickness(s, v.p, 10)
+		if !pr.Point.Equals(v.point, 1e-4) || math.Abs(pr.Wall-v.wall) > 1e-3 || (math.Abs(pr.Gap-v.gap) > 1e-3 && pr.Gap != v.gap) {
+			t.Errorf("probe at %v: expected %v %g %g, actual %v %g %g", v.p, v.point, v.wall, v.gap, pr.Point, pr.Wall, pr.Gap)
+		}
+	}
+	h := Pick(s, V3{1, 1, 5}, V3{0, 0, -1}, 20)
+	if pr := h.Probe(s, 10); math.Abs(pr.Wall-0.5) > 1e-3 || !math.IsInf(pr.Gap, 1) || !pr.Inner.Equals(V3{1, 1, 1.25}, 1e-3) {
+		t.Errorf("hit probe: expected wall 0.5 and no gap, actual %g %g %v", pr.Wall, pr.Gap, pr.Inner)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_ChangedRegion3(t *testing.T) {
+	model := func(r, x float64) SDF3 {
+		s0, _ := Sphere3D(r)
+		s1, _ := Box3D(V3{1, 1, 1}, 0)
+		s2, _ := Box3D(V3{2, 2, 2}, 0)
+		return Union3D(Transform3D(s0, Translate3d(V3{x, 0, 0})), Transform3D(s1, Translate3d(V3{10, 0, 0})), s2)
+	}
+	if _, changed := ChangedRegion3(model(1, 0), model(1, 0)); changed {
+		t.Error("same model, changed")
+	}
+	// the sphere grows and moves: the old and new spheres
+	b, changed := ChangedRegion3(model(1, 0), model(2, 3))
+	if expected := (Box3{V3{-1, -2, -2}, V3{5, 2, 2}}); !changed || !b.Equals(expected, tolerance) {
+		t.Errorf("expected %v, actual %v %v", expected, b, changed)
+	}
+	// an offset parent grows the region
+	o0, o1 := Offset3D(model(1, 0), 0.5), Offset3D(model(2, 0), 0.5)
+	b, changed = ChangedRegion3(o0, o1)
+	if expected := (Box3{V3{-2.5, -2.5, -2.5}, V3{2.5, 2.5, 2.5}}); !changed || !b.Equals(expected, tolerance) {
+		t.Errorf("offset: expected %v, actual %v %v", expected, b, changed)
+	}
+	// a changed node with children (different number of children)
+	s, _ := Sphere3D(1)
+	b, changed = ChangedRegion3(model(1, 0), Union3D(model(1, 0), s))
+	if expected := (Box3{V3{-1, -1, -1}, V3{10.5, 1, 1}}); !changed || !b.Equals(expected, tolerance) {
+		t.Errorf("union: expected %v, actual %v %v", expected, b, changed)
+	}
+	// a node with a closure is changed over its bounding box
+	blend := func(k float64) SDF3 {
+		u := model(1, 0)
+		u.(*UnionSDF3).SetMin(RoundMin(k))
+		return Transform3D(u, Translate3d(V3{1, 0, 0}))
+	}
+	b, changed = ChangedRegion3(blend(0.1), blend(0.5))
+	if expected := (Box3{V3{0, -1, -1}, V3{11.5, 1, 1}}); !changed || !b.Equals(expected, tolerance) {
+		t.Errorf("blend: expected %v, actual %v %v", expected, b, changed)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Compile3(t *testing.T) {
+	b, _ := Box3D(V3{4, 3, 2}, 0.2)
+	s0, _ := Sphere3D(1.5)
+	c0, _ := Cylinder3D(6, 0.5, 0.1)
+	blend := Union3D(s0, Transform3D(b, Translate3d(V3{2, 0, 0})))
+	blend.(*UnionSDF3).SetMin(PolyMin(0.5))
+	u := Union3D(b, Transform3D(s0, Translate3d(V3{1, 1, 1})), Transform3D(c0, RotateX(0.7)))
+	s := Transform3D(Intersect3D(ScaleUniform3D(Difference3D(u, c0), 1.5), blend), Translate3d(V3{0.5, 0, -1}))
+	p := Compile3(s)
+	if n := len(p.Hosts); n != 1 {
+		t.Errorf("expected 1 host leaf, actual %d", n)
+	}
+	bb := s.BoundingBox()
+	pts := make([]V3, 1000)
+	for i := range pts {
+		pts[i] = bb.Random()
+	}
+	out := make([]float64, len(pts))
+	p.EvaluateN(pts, out)
+	for i, x := range pts {
+		if d := s.Evaluate(x); math.Abs(d-out[i]) > tolerance {
+			t.Fatalf("at %v: expected %g, actual %g", x, d, out[i])
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Interval(t *testing.T) {
+	b, _ := Box3D(V3{4, 3, 2}, 0.2)
+	s0, _ := Sphere3D(1.5)
+	c0, _ := Cylinder3D(6, 0.5, 0.1)
+	blend := Union3D(s0, Transform3D(b, Translate3d(V3{2, 0, 0})))
+	blend.(*UnionSDF3).SetMin(PolyMin(0.5))
+	u := Union3D(b, Transform3D(s0, Translate3d(V3{1, 1, 1})), Transform3D(c0, RotateX(0.7)))
+	s := Transform3D(Intersect3D(ScaleUniform3D(Difference3D(u, c0), 1.5), blend), Translate3d(V3{0.5, 0, -1}))
+	bb := s.BoundingBox().ScaleAboutCenter(1.2)
+	for i := 0; i < 1000; i++ {
+		p0, p1 := bb.Random(), bb.Random()
+		box := Box3{p0.Min(p1), p0.Max(p1)}
+		a := EvaluateInterval(s, box)
+		for j := 0; j < 20; j++ {
+			p := box.Random()
+			if d := s.Evaluate(p); !(Interval{a.Min - tolerance, a.Max + tolerance}).Contains(d) {
+				t.Fatalf("at %v: %g not in %v", p, d, a)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Ellipsoid(t *testing.T) {
+	e := V3{3, 1, 2}
+	s, _ := Ellipsoid3D(e)
+	for i := 0; i < 200; i++ {
+		// points along the normal of a surface point are the offset from it
+		th, ph := randomRange(0, Pi), randomRange(0, Tau)
+		q := V3{e.X * math.Sin(th) * math.Cos(ph), e.Y * math.Sin(th) * math.Sin(ph), e.Z * math.Cos(th)}
+		n := q.Div(e.Mul(e)).Normalize()
+		for _, d := range []float64{0.5, 0, -0.2} {
+			if x := s.Evaluate(q.Add(n.MulScalar(d))); math.Abs(x-d) > tolerance {
+				t.Fatalf("at %v: expected %g, actual %g", q.Add(n.MulScalar(d)), d, x)
+			}
+		}
+	}
+	for _, k := range []float64{0.5, -0.5} {
+		c, _ := Cylinder3D(4, 1, 0)
+		b, _ := Barrel3D(c, k)
+		if l := lipschitzRatio3(b, 10000); l > 1+tolerance {
+			t.Errorf("k %g: Lipschitz ratio %g", k, l)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Prism(t *testing.T) {
+	poly := []V2{{0, 0}, {3, -1}, {4, 2}, {1, 3}}
+	s, _ := Prism3D(poly, 2, 0, 0)
+	p2, _ := Polygon2D(poly)
+	bb := s.BoundingBox().ScaleAboutCenter(1.6)
+	for i := 0; i < 1000; i++ {
+		p := bb.Random()
+		w := V2{p2.Evaluate(V2{p.X, p.Y}), math.Abs(p.Z) - 1}
+		d := w.Max(V2{0, 0}).Length() + math.Min(math.Max(w.X, w.Y), 0)
+		if x := s.Evaluate(p); math.Abs(x-d) > tolerance {
+			t.Fatalf("at %v: expected %g, actual %g", p, d, x)
+		}
+	}
+	// the distance to a rounded vertex of a hexagon
+	s, _ = RegularPrism3D(6, 1, 2, 0.1, 0.2)
+	if d, expected := s.Evaluate(V3{2, 0, 0}), 0.8+0.2/math.Cos(Pi/6); math.Abs(d-expected) > tolerance {
+		t.Errorf("expected %g, actual %g", expected, d)
+	}
+	if _, err := RegularPrism3D(6, 1, 2, 0.9, 0); err == nil {
+		t.Error("expected an error for a rounding larger than the inradius")
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_Frustum(t *testing.T) {
+	type test struct {
+		frustum, expected SDF3
+	}
+	f0, _ := Frustum3D(CircleEnd(2, V2{}), CircleEnd(1, V2{}), 3)
+	c0, _ := Cone3D(3, 2, 1, 0)
+	f1, _ := Frustum3D(RectangleEnd(V2{2, 3}, V2{}, 0), RectangleEnd(V2{2, 3}, V2{}, 0), 4)
+	b1, _ := Box3D(V3{2, 3, 4}, 0)
+	for _, x := range []test{{f0, c0}, {f1, b1}} {
+		bb := x.expected.BoundingBox().ScaleAboutCenter(1.5)
+		for i := 0; i < 1000; i++ {
+			p := bb.Random()
+			if d0, d1 := x.frustum.Evaluate(p), x.expected.Evaluate(p); math.Abs(d0-d1) > tolerance {
+				t.Fatalf("at %v: expected %g, actual %g", p, d1, d0)
+			}
+		}
+	}
+	// a skewed frustum and a wedge
+	f2, _ := Frustum3D(RectangleEnd(V2{4, 3}, V2{}, 0), CircleEnd(0.7, V2{0.5, 0}), 3)
+	w, _ := Wedge3D(V3{3, 2, 1}, -1)
+	for _, s := range []SDF3{f2, w} {
+		if l := lipschitzRatio3(s, 10000); l > 1+tolerance {
+			t.Errorf("Lipschitz ratio %g", l)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+func Test_TubeNetwork(t *testing.T) {
+	// a tube with equal radii is a capsule
+	nodes := []TubeNode{{V3{0, 0, -1.5}, 0.5}, {V3{0, 0, 1.5}, 0.5}}
+	s, _ := TubeNetwork3D(nodes, [][2]int{{0, 1}}, 0)
+	c, _ := Capsule3D(4, 0.5)
+	bb := c.BoundingBox().ScaleAboutCenter(1.5)
+	for i := 0; i < 1000; i++ {
+		p := bb.Random()
+		if d0, d1 := s.Evaluate(p), c.Evaluate(p); math.Abs(d0-d1) > tolerance {
+			t.Fatalf("at %v: expected %g, actual %g", p, d1, d0)
+		}
+	}
+	if _, err := TubeNetwork3D(nodes, [][2]int{{0, 2}}, 0); err == nil {
+		t.Error("expected an error for a bad node index")
+	}
+}
+
+func Test_Terrain(t *testing.T) {
+	cfg := TerrainConfig{Size: V2{100, 60}, Height: 20, Base: 3, Cells: 64, Seed: 3}
+	h, _ := TerrainHeightfield(&cfg)
+	h1, _ := TerrainHeightfield(&cfg)
+	if !reflect.DeepEqual(h.Z, h1.Z) {
+		t.Error("the heightfield of a seed isn't repeatable")
+	}
+	// thermal erosion conserves the material
+	var before, after float64
+	for _, z := range h.Z {
+		before += z
+	}
+	h.thermalErosion(20, 0.5)
+	for _, z := range h.Z {
+		after += z
+	}
+	if math.Abs(before-after) > 1e-6*before {
+		t.Errorf("thermal erosion: expected %g, actual %g", before, after)
+	}
+	cfg.Thermal, cfg.Hydraulic = 10, 20
+	s, err := Terrain3D(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := lipschitzRatio3(s, 10000); l > 1+tolerance {
+		t.Errorf("Lipschitz ratio %g > 1", l)
+	}
+	if d := s.Evaluate(V3{0, 0, 1}); d >= 0 {
+		t.Errorf("expected a point in the base to be inside, distance %g", d)
+	}
+}
+
+func Test_ConformalChannel(t *testing.T) {
+	// a channel 5 below the surface of a sphere, over the top
+	s, _ := Sphere3D(20)
+	k := ConformalChannelParms{Surface: s, Offset: -5, Diameter: 3,
+		Inlet: V3{-30, 0, 0}, Outlet: V3{30, 0, 0}, Waypoints: []V3{{0, 0, 20}}}
+	channel, path, err := ConformalChannel3D(&k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path[0] != k.Inlet || path[len(path)-1] != k.Outlet {
+		t.Error("the route doesn't join the inlet and outlet")
+	}
+	for _, p := range path {
+		if r := p.Length(); p.Z > 3 && math.Abs(r-15) > 1e-3 {
+			t.Fatalf("at %v: expected radius 15, actual %g", p, r)
+		}
+	}
+	if d := channel.Evaluate(V3{0, 0, 15}); math.Abs(d+1.5) > tolerance {
+		t.Errorf("expected the waypoint on the axis, distance %g", d)
+	}
+}
+
+func Test_Fit(t *testing.T) {
+	container, _ := Box3D(V3{100, 60, 40}, 0)
+	part, _ := Box3D(V3{50, 30, 80}, 2)
+	// the part fits on its side, with 5 on each side of its 30 mm width
+	r, err := Fit3D(part, container, &FitParms{Clearance: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Fits || math.Abs(r.Margin-4) > 1e-3 {
+		t.Errorf("expected a fit with a margin of 4, actual %v %g", r.Fits, r.Margin)
+	}
+	bb := Transform3D(part, r.Pose).BoundingBox()
+	if !container.BoundingBox().Contains(bb.Min) || !container.BoundingBox().Contains(bb.Max) {
+		t.Errorf("the posed part %v isn't in the container", bb)
+	}
+	r, _ = Fit3D(part, container, &FitParms{Clearance: 1, Rotation: FitRotateNone})
+	if r.Fits {
+		t.Error("expected no fit without rotations")
+	}
+	// the default parameters: no clearance, any rotation
+	r, err = Fit3D(part, container, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.Fits || math.Abs(r.Margin-5) > 1e-3 {
+		t.Errorf("expected a fit with a margin of 5, actual %v %g", r.Fits, r.Margin)
+	}
+}
+
+func Test_LogSpiral(t *testing.T) {
+	for _, k := range []struct {
+		a, b, start, end, d float64
+	}{
+		{1, 0.1, 0, 4 * Pi, 0.2},
+		{2, -0.15, -Pi, 3 * Pi, 0.1},
+		{0.5, 0.3, 3 * Pi, Pi, 0},
+	} {
+		s, err := LogSpiral2D(k.a, k.b, k.start, k.end, k.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// spiral points
+		start, end := math.Min(k.start, k.end), math.Max(k.start, k.end)
+		const n = 100000
+		points := make([]V2, n+1)
+		rMax := 0.0
+		for i := range points {
+			theta := start + (end-start)*float64(i)/n
+			r := k.a * math.Exp(k.b*theta)
+			points[i] = V2{r * math.Cos(theta), r * math.Sin(theta)}
+			rMax = math.Max(rMax, r)
+		}
+		// the bounding box is the square around the largest radius
+		bb := s.BoundingBox()
+		if !bb.Equals(Box2{V2{-rMax - k.d, -rMax - k.d}, V2{rMax + k.d, rMax + k.d}}, 1e-9) {
+			t.Errorf("%v: bad bounding box %v", k, bb)
+		}
+		// the distance is the distance to the closest spiral point
+		test := bb.ScaleAboutCenter(1.2)
+		for i := 0; i < 200; i++ {
+			p := test.Random()
+			if i%4 == 0 {
+				// near the spiral
+				p = points[(i*7919)%n].Add(V2{0.05, -0.03})
+			}
+			d := math.Inf(1)
+			for _, q := range points {
+				d = math.Min(d, p.Sub(q).Length())
+			}
+			d -= k.d
+			if x := s.Evaluate(p); math.Abs(x-d) > 1e-3 {
+				t.Errorf("%v: at %v expected %g, actual %g", k, p, d, x)
+			}
+		}
+		// on the spiral
+		if x := s.Evaluate(points[n/3]); math.Abs(x+k.d) > 1e-9 {
+			t.Errorf("%v: expected %g on the spiral, actual %g", k, -k.d, x)
+		}
+	}
+	for _, k := range [][5]float64{{0, 0.1, 0, 1, 0}, {1, 0, 0, 1, 0}, {1, 0.1, 1, 1, 0}} {
+		if _, err := LogSpiral2D(k[0], k[1], k[2], k[3], k[4]); err == nil {
+			t.Errorf("%v: expected an error", k)
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
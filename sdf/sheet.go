@@ -0,0 +1,63 @@
+//-----------------------------------------------------------------------------
+/*
+
+Open Sheets
+
+An open surface (e.g. a corrugated sheet or a membrane) has no inside, so it
+is modelled with an unsigned distance field: the distance to the surface
+without a sign. The bounding box of the field gives the extent of the sheet.
+A sheet is made solid by giving it a (small) thickness, which the renderers
+turn into a thin two-sided mesh.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// SheetSDF3 is an open surface thickened into a thin solid.
+type SheetSDF3 struct {
+	sdf   SDF3    // unsigned distance to the surface (or a signed field with the surface as its zero set)
+	delta float64 // half sheet thickness
+	clip  Box3    // extent of the sheet
+	bb    Box3    // bounding box
+}
+
+// Sheet3D returns a solid sheet of the given thickness for an open surface.
+// The sign of the distance field is ignored, and the sheet is clipped
+// to the bounding box of the field (enlarged by the sheet thickness).
+func Sheet3D(surface SDF3, thickness float64) (SDF3, error) {
+	if surface == nil {
+		return nil, ErrMsg("surface == nil")
+	}
+	if thickness <= 0 {
+		return nil, ErrMsg("thickness <= 0")
+	}
+	t := V3{thickness, thickness, thickness}
+	clip := surface.BoundingBox().Enlarge(t)
+	return &SheetSDF3{
+		sdf:   surface,
+		delta: 0.5 * thickness,
+		clip:  clip,
+		bb:    clip.Enlarge(t),
+	}, nil
+}
+
+// Evaluate returns the minimum distance to a sheet.
+func (s *SheetSDF3) Evaluate(p V3) float64 {
+	d := math.Abs(s.sdf.Evaluate(p)) - s.delta
+	// clip the sheet to its extent
+	return math.Max(d, sdfBox3d(p.Sub(s.clip.Center()), s.clip.Size().MulScalar(0.5)))
+}
+
+// BoundingBox returns the bounding box of a sheet.
+func (s *SheetSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+func (s *SheetSDF3) children() []interface{} { return []interface{}{&s.sdf} }
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,336 @@
+//-----------------------------------------------------------------------------
+/*
+
+Skeletons (Medial Axis)
+
+The SDF3 is sampled on a grid and redistanced. The interior nodes where
+the gradient of the distance field collapses (two or more closest surface
+points) approximate the medial axis: curves for rod-like parts and sheets
+for plate-like parts. The distance at a medial point is the radius of the
+largest ball inside the part at that point (taken from the SDF3 if it is
+exact, otherwise from the redistanced grid).
+
+The curve skeleton is found by topological thinning of the medial nodes
+(removing the shallowest simple points first, keeping the curve ends) and
+traced into polylines between the ends and junctions.
+
+The thickness map is the local thickness: the diameter of the largest
+medial ball containing a point.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// skeletonGradient is the gradient magnitude below which a node is on the medial axis.
+const skeletonGradient = 0.6
+
+// MedialPoint is a point on the medial axis.
+type MedialPoint struct {
+	Position V3      // position
+	Radius   float64 // distance to the surface (radius of the medial ball)
+}
+
+// Skeleton is the approximate medial axis of an SDF3.
+type Skeleton struct {
+	Points    []MedialPoint   // medial axis samples (curves and sheets)
+	Curves    [][]MedialPoint // curve skeleton polylines
+	thickness *grid3
+}
+
+// Thickness returns the local thickness at a point (0: outside the part).
+func (k *Skeleton) Thickness(p V3) float64 {
+	if !k.thickness.bb.Contains(p) {
+		return 0
+	}
+	return k.thickness.interpolate(p)
+}
+
+// Skeleton3D returns the approximate medial axis of an SDF3, sampled on a grid
+// with meshCells on the longest axis of the bounding box.
+func Skeleton3D(s SDF3, meshCells int) (*Skeleton, error) {
+	g, err := morphologyGrid(s, meshCells, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := g.n
+	// medial nodes: interior nodes with a collapsed gradient
+	medial := make([]bool, len(g.value))
+	var nodes []int
+	for i := 1; i < n[0]-1; i++ {
+		for j := 1; j < n[1]-1; j++ {
+			for k := 1; k < n[2]-1; k++ {
+				idx := g.index(i, j, k)
+				if g.value[idx] >= 0 {
+					continue
+				}
+				grad := V3{
+					(g.value[g.index(i+1, j, k)] - g.value[g.index(i-1, j, k)]) / (2 * g.step.X),
+					(g.value[g.index(i, j+1, k)] - g.value[g.index(i, j-1, k)]) / (2 * g.step.Y),
+					(g.value[g.index(i, j, k+1)] - g.value[g.index(i, j, k-1)]) / (2 * g.step.Z),
+				}
+				if grad.Length() < skeletonGradient {
+					medial[idx] = true
+					nodes = append(nodes, idx)
+				}
+			}
+		}
+	}
+	// medial radius
+	exact := IsExact3(s)
+	radius := make(map[int]float64, len(nodes))
+	sk := &Skeleton{}
+	for _, idx := range nodes {
+		p := g.nodePosition(idx)
+		r := -g.value[idx]
+		if exact {
+			r = -s.Evaluate(p)
+		}
+		radius[idx] = r
+		sk.Points = append(sk.Points, MedialPoint{p, r})
+	}
+	sk.thickness = skeletonThickness(g, nodes, radius)
+	skeletonThin(g, medial, nodes, radius)
+	sk.Curves = skeletonTrace(g, medial, radius)
+	return sk, nil
+}
+
+// nodePosition returns the position of a node from its index.
+func (g *grid3) nodePosition(idx int) V3 {
+	k := idx % g.n[2]
+	j := (idx / g.n[2]) % g.n[1]
+	i := idx / (g.n[1] * g.n[2])
+	return g.position(i, j, k)
+}
+
+// neighbours26 calls fn for the nodes in the 3x3x3 neighbourhood of a node (excluding the node).
+// The offset of the neighbour is passed as (di, dj, dk) in -1..1.
+func (g *grid3) neighbours26(idx int, fn func(nidx, di, dj, dk int)) {
+	k := idx % g.n[2]
+	j := (idx / g.n[2]) % g.n[1]
+	i := idx / (g.n[1] * g.n[2])
+	for di := -1; di <= 1; di++ {
+		for dj := -1; dj <= 1; dj++ {
+			for dk := -1; dk <= 1; dk++ {
+				if di == 0 && dj == 0 && dk == 0 {
+					continue
+				}
+				x, y, z := i+di, j+dj, k+dk
+				if x < 0 || y < 0 || z < 0 || x >= g.n[0] || y >= g.n[1] || z >= g.n[2] {
+					continue
+				}
+				fn(g.index(x, y, z), di, dj, dk)
+			}
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// skeletonThickness returns a grid with the diameter of the largest medial ball containing each node.
+func skeletonThickness(g *grid3, nodes []int, radius map[int]float64) *grid3 {
+	t := &grid3{g.bb, g.n, g.step, make([]float64, len(g.value))}
+	for _, idx := range nodes {
+		r := radius[idx]
+		c := g.nodePosition(idx)
+		lo := c.SubScalar(r).Sub(g.bb.Min).Div(g.step).Ceil().ToV3i()
+		hi := c.AddScalar(r).Sub(g.bb.Min).Div(g.step).ToV3i()
+		for i := imax(lo[0], 0); i <= imin(hi[0], g.n[0]-1); i++ {
+			for j := imax(lo[1], 0); j <= imin(hi[1], g.n[1]-1); j++ {
+				for k := imax(lo[2], 0); k <= imin(hi[2], g.n[2]-1); k++ {
+					if g.position(i, j, k).Sub(c).Length() <= r {
+						x := &t.value[t.index(i, j, k)]
+						*x = math.Max(*x, 2*r)
+					}
+				}
+			}
+		}
+	}
+	return t
+}
+
+//-----------------------------------------------------------------------------
+
+// skeletonSimple returns true if a node can be removed from a set of nodes
+// without changing its topology (26-connected set, 6-connected background).
+func skeletonSimple(g *grid3, set []bool, idx int) bool {
+	// the 3x3x3 neighbourhood, center at 13
+	var object [27]bool
+	g.neighbours26(idx, func(nidx, di, dj, dk int) {
+		object[(di+1)*9+(dj+1)*3+(dk+1)] = set[nidx]
+	})
+	cell := func(c int) (int, int, int) { return c/9 - 1, (c/3)%3 - 1, c%3 - 1 }
+	// one 26-connected object component in the neighbourhood
+	var seen [27]bool
+	components := 0
+	for c := 0; c < 27; c++ {
+		if c == 13 || !object[c] || seen[c] {
+			continue
+		}
+		components++
+		stack := []int{c}
+		seen[c] = true
+		for len(stack) != 0 {
+			x := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			xi, xj, xk := cell(x)
+			for y := 0; y < 27; y++ {
+				yi, yj, yk := cell(y)
+				if y != 13 && object[y] && !seen[y] && iabs(xi-yi) <= 1 && iabs(xj-yj) <= 1 && iabs(xk-yk) <= 1 {
+					seen[y] = true
+					stack = append(stack, y)
+				}
+			}
+		}
+	}
+	if components != 1 {
+		return false
+	}
+	// one 6-connected background component (within the 18-neighbourhood) touching the center faces
+	in18 := func(c int) bool {
+		i, j, k := cell(c)
+		return c != 13 && iabs(i)+iabs(j)+iabs(k) <= 2
+	}
+	seen = [27]bool{}
+	components = 0
+	for _, c := range []int{4, 10, 12, 14, 16, 22} {
+		if object[c] || seen[c] {
+			continue
+		}
+		components++
+		stack := []int{c}
+		seen[c] = true
+		for len(stack) != 0 {
+			x := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			xi, xj, xk := cell(x)
+			for y := 0; y < 27; y++ {
+				yi, yj, yk := cell(y)
+				if in18(y) && !object[y] && !seen[y] && iabs(xi-yi)+iabs(xj-yj)+iabs(xk-yk) == 1 {
+					seen[y] = true
+					stack = append(stack, y)
+				}
+			}
+		}
+	}
+	return components == 1
+}
+
+// skeletonThin removes simple nodes from the medial set (shallowest first) until only
+// the curve skeleton remains. Curve ends (nodes with one neighbour) are kept.
+func skeletonThin(g *grid3, set []bool, nodes []int, radius map[int]float64) {
+	order := append([]int(nil), nodes...)
+	sort.SliceStable(order, func(a, b int) bool { return radius[order[a]] < radius[order[b]] })
+	for changed := true; changed; {
+		changed = false
+		for _, idx := range order {
+			if !set[idx] {
+				continue
+			}
+			count := 0
+			g.neighbours26(idx, func(nidx, di, dj, dk int) {
+				if set[nidx] {
+					count++
+				}
+			})
+			if count <= 1 {
+				continue
+			}
+			if skeletonSimple(g, set, idx) {
+				set[idx] = false
+				changed = true
+			}
+		}
+	}
+}
+
+// skeletonTrace returns the polylines of a thinned node set between its ends and junctions.
+func skeletonTrace(g *grid3, set []bool, radius map[int]float64) [][]MedialPoint {
+	neighbours := func(idx int) []int {
+		var nb []int
+		g.neighbours26(idx, func(nidx, di, dj, dk int) {
+			if set[nidx] {
+				nb = append(nb, nidx)
+			}
+		})
+		return nb
+	}
+	point := func(idx int) MedialPoint { return MedialPoint{g.nodePosition(idx), radius[idx]} }
+	type edge [2]int
+	visited := make(map[edge]bool)
+	mark := func(a, b int) bool {
+		if a > b {
+			a, b = b, a
+		}
+		if visited[edge{a, b}] {
+			return false
+		}
+		visited[edge{a, b}] = true
+		return true
+	}
+	var curves [][]MedialPoint
+	walk := func(start, next int) {
+		curve := []MedialPoint{point(start)}
+		prev, cur := start, next
+		for {
+			curve = append(curve, point(cur))
+			nb := neighbours(cur)
+			if len(nb) != 2 {
+				break
+			}
+			nxt := nb[0]
+			if nxt == prev {
+				nxt = nb[1]
+			}
+			if !mark(cur, nxt) {
+				break
+			}
+			prev, cur = cur, nxt
+		}
+		// skip the links within a junction
+		if len(curve) == 2 && len(neighbours(start)) > 2 && len(neighbours(cur)) > 2 {
+			return
+		}
+		curves = append(curves, curve)
+	}
+	// curves from the ends and junctions
+	for idx, in := range set {
+		if !in {
+			continue
+		}
+		nb := neighbours(idx)
+		if len(nb) == 2 {
+			continue
+		}
+		if len(nb) == 0 {
+			curves = append(curves, []MedialPoint{point(idx)})
+			continue
+		}
+		for _, x := range nb {
+			if mark(idx, x) {
+				walk(idx, x)
+			}
+		}
+	}
+	// closed loops
+	for idx, in := range set {
+		if !in {
+			continue
+		}
+		for _, x := range neighbours(idx) {
+			if mark(idx, x) {
+				walk(idx, x)
+			}
+		}
+	}
+	return curves
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,433 @@
+//-----------------------------------------------------------------------------
+/*
+
+2D Constraint Sketches
+
+A minimal parametric sketch: points, lines and arcs with coincidence,
+distance, angle and tangency constraints. The sketch is solved with a
+damped least squares (Levenberg) iteration starting from the initial
+point positions, so an under constrained sketch stays close to the shape
+it was drawn as. The closed loops of the solved sketch become an SDF2.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// Sketch is a set of 2D points, lines and arcs and the constraints between them.
+type Sketch struct {
+	x           []float64        // point coordinates
+	fixed       []bool           // fixed coordinates
+	lines       []*SketchLine    // lines
+	arcs        []*SketchArc     // arcs
+	constraints []func() float64 // constraint residuals (0 when satisfied)
+}
+
+// SketchPoint is a point in a sketch.
+type SketchPoint struct {
+	s *Sketch
+	i int // index of the x coordinate
+}
+
+// SketchLine is a line segment between two sketch points.
+type SketchLine struct {
+	P0, P1 *SketchPoint
+}
+
+// SketchArc is a counter-clockwise circular arc about a center point.
+type SketchArc struct {
+	Center, Start, End *SketchPoint
+}
+
+// NewSketch returns an empty sketch.
+func NewSketch() *Sketch {
+	return &Sketch{}
+}
+
+//-----------------------------------------------------------------------------
+// Sketch geometry
+
+// Point adds a point to the sketch. The position is the initial guess for the solver.
+func (s *Sketch) Point(x, y float64) *SketchPoint {
+	p := &SketchPoint{s, len(s.x)}
+	s.x = append(s.x, x, y)
+	s.fixed = append(s.fixed, false, false)
+	return p
+}
+
+// Position returns the position of a sketch point.
+func (p *SketchPoint) Position() V2 {
+	return V2{p.s.x[p.i], p.s.x[p.i+1]}
+}
+
+// Line adds a line between two points to the sketch.
+func (s *Sketch) Line(p0, p1 *SketchPoint) *SketchLine {
+	l := &SketchLine{p0, p1}
+	s.lines = append(s.lines, l)
+	return l
+}
+
+// Arc adds a counter-clockwise arc from start to end about a center point.
+// The start and end points are constrained to be the same distance from the center.
+func (s *Sketch) Arc(center, start, end *SketchPoint) *SketchArc {
+	a := &SketchArc{center, start, end}
+	s.arcs = append(s.arcs, a)
+	s.add(func() float64 {
+		return a.radius(end) - a.radius(start)
+	})
+	return a
+}
+
+// radius returns the distance from the center of the arc to a point.
+func (a *SketchArc) radius(p *SketchPoint) float64 {
+	return p.Position().Sub(a.Center.Position()).Length()
+}
+
+// Radius returns the radius of the arc.
+func (a *SketchArc) Radius() float64 {
+	return a.radius(a.Start)
+}
+
+// direction returns the unit vector of a line.
+func (l *SketchLine) direction() V2 {
+	return l.P1.Position().Sub(l.P0.Position()).Normalize()
+}
+
+//-----------------------------------------------------------------------------
+// Constraints
+
+func (s *Sketch) add(f func() float64) {
+	s.constraints = append(s.constraints, f)
+}
+
+// Fix fixes a point at its current position.
+func (s *Sketch) Fix(p *SketchPoint) {
+	s.fixed[p.i] = true
+	s.fixed[p.i+1] = true
+}
+
+// Coincident constrains two points to be at the same position.
+func (s *Sketch) Coincident(p0, p1 *SketchPoint) {
+	s.add(func() float64 { return p1.Position().X - p0.Position().X })
+	s.add(func() float64 { return p1.Position().Y - p0.Position().Y })
+}
+
+// Distance constrains the distance between two points.
+func (s *Sketch) Distance(p0, p1 *SketchPoint, d float64) {
+	s.add(func() float64 {
+		return p1.Position().Sub(p0.Position()).Length() - d
+	})
+}
+
+// Length constrains the length of a line.
+func (s *Sketch) Length(l *SketchLine, d float64) {
+	s.Distance(l.P0, l.P1, d)
+}
+
+// Horizontal constrains a line to be horizontal.
+func (s *Sketch) Horizontal(l *SketchLine) {
+	s.add(func() float64 { return l.P1.Position().Y - l.P0.Position().Y })
+}
+
+// Vertical constrains a line to be vertical.
+func (s *Sketch) Vertical(l *SketchLine) {
+	s.add(func() float64 { return l.P1.Position().X - l.P0.Position().X })
+}
+
+// Angle constrains the counter-clockwise angle (radians) from line l0 to line l1.
+func (s *Sketch) Angle(l0, l1 *SketchLine, theta float64) {
+	sin, cos := math.Sincos(theta)
+	s.add(func() float64 {
+		u, v := l0.direction(), l1.direction()
+		// sin(angle(u, v) - theta)
+		return u.Cross(v)*cos - u.Dot(v)*sin
+	})
+}
+
+// Parallel constrains two lines to be parallel.
+func (s *Sketch) Parallel(l0, l1 *SketchLine) {
+	s.add(func() float64 { return l0.direction().Cross(l1.direction()) })
+}
+
+// Perpendicular constrains two lines to be perpendicular.
+func (s *Sketch) Perpendicular(l0, l1 *SketchLine) {
+	s.add(func() float64 { return l0.direction().Dot(l1.direction()) })
+}
+
+// Radius constrains the radius of an arc.
+func (s *Sketch) Radius(a *SketchArc, r float64) {
+	s.add(func() float64 { return a.Radius() - r })
+}
+
+// Tangent constrains a line to be tangent to an arc.
+func (s *Sketch) Tangent(l *SketchLine, a *SketchArc) {
+	// a shared endpoint is the tangent point: the radius is perpendicular to the line
+	for _, p := range []*SketchPoint{l.P0, l.P1} {
+		if p == a.Start || p == a.End {
+			s.add(func() float64 {
+				return l.direction().Dot(p.Position().Sub(a.Center.Position()).Normalize())
+			})
+			return
+		}
+	}
+	s.add(func() float64 {
+		cp := a.Center.Position().Sub(l.P0.Position())
+		return math.Abs(l.direction().Cross(cp)) - a.Radius()
+	})
+}
+
+// TangentArcs constrains two arcs to be (externally or internally) tangent.
+func (s *Sketch) TangentArcs(a0, a1 *SketchArc) {
+	s.add(func() float64 {
+		d := a1.Center.Position().Sub(a0.Center.Position()).Length()
+		r0, r1 := a0.Radius(), a1.Radius()
+		return math.Min(math.Abs(d-(r0+r1)), math.Abs(d-math.Abs(r0-r1)))
+	})
+}
+
+//-----------------------------------------------------------------------------
+// Solver
+
+// residuals returns the constraint residuals.
+func (s *Sketch) residuals(r []float64) float64 {
+	sum := 0.0
+	for i, f := range s.constraints {
+		r[i] = f()
+		sum += r[i] * r[i]
+	}
+	return sum
+}
+
+// size returns the size of the sketch.
+func (s *Sketch) size() float64 {
+	bb := Box2{}
+	for i := 0; i < len(s.x); i += 2 {
+		p := V2{s.x[i], s.x[i+1]}
+		if i == 0 {
+			bb = Box2{p, p}
+		} else {
+			bb = bb.Include(p)
+		}
+	}
+	return math.Max(bb.Size().MaxComponent(), 1)
+}
+
+// solveLinear solves a.x = b with gaussian elimination (a and b are modified).
+func solveLinear(a [][]float64, b []float64) []float64 {
+	n := len(b)
+	for i := 0; i < n; i++ {
+		// partial pivot
+		k := i
+		for j := i + 1; j < n; j++ {
+			if math.Abs(a[j][i]) > math.Abs(a[k][i]) {
+				k = j
+			}
+		}
+		a[i], a[k] = a[k], a[i]
+		b[i], b[k] = b[k], b[i]
+		if a[i][i] == 0 {
+			continue
+		}
+		for j := i + 1; j < n; j++ {
+			f := a[j][i] / a[i][i]
+			for l := i; l < n; l++ {
+				a[j][l] -= f * a[i][l]
+			}
+			b[j] -= f * b[i]
+		}
+	}
+	x := make([]float64, n)
+	for i := n - 1; i >= 0; i-- {
+		if a[i][i] == 0 {
+			continue
+		}
+		sum := b[i]
+		for j := i + 1; j < n; j++ {
+			sum -= a[i][j] * x[j]
+		}
+		x[i] = sum / a[i][i]
+	}
+	return x
+}
+
+// Solve moves the points of the sketch to satisfy the constraints.
+func (s *Sketch) Solve() error {
+	// free variables
+	var free []int
+	for i := range s.x {
+		if !s.fixed[i] {
+			free = append(free, i)
+		}
+	}
+	m, n := len(s.constraints), len(free)
+	if m == 0 || n == 0 {
+		return nil
+	}
+	size := s.size()
+	eps := 1e-9 * size
+	h := 1e-7 * size
+
+	r := make([]float64, m)
+	r1 := make([]float64, m)
+	cost := s.residuals(r)
+	jac := make([][]float64, m)
+	for i := range jac {
+		jac[i] = make([]float64, n)
+	}
+	lambda := 1e-3
+	for iter := 0; iter < 500; iter++ {
+		if math.Sqrt(cost/float64(m)) < eps {
+			return nil
+		}
+		// numerical jacobian
+		for j, k := range free {
+			x := s.x[k]
+			s.x[k] = x + h
+			s.residuals(r1)
+			s.x[k] = x
+			for i := range r1 {
+				jac[i][j] = (r1[i] - r[i]) / h
+			}
+		}
+		// damped normal equations: (JtJ + lambda.I).dx = -Jt.r
+		a := make([][]float64, n)
+		g := make([]float64, n)
+		for i := range a {
+			a[i] = make([]float64, n)
+			for j := range a[i] {
+				for k := 0; k < m; k++ {
+					a[i][j] += jac[k][i] * jac[k][j]
+				}
+			}
+			a[i][i] += lambda
+			for k := 0; k < m; k++ {
+				g[i] -= jac[k][i] * r[k]
+			}
+		}
+		dx := solveLinear(a, g)
+		// try the step
+		x0 := append([]float64{}, s.x...)
+		for j, k := range free {
+			s.x[k] += dx[j]
+		}
+		if c := s.residuals(r1); c < cost {
+			cost = c
+			copy(r, r1)
+			lambda = math.Max(lambda/3, 1e-12)
+		} else {
+			copy(s.x, x0)
+			lambda *= 4
+		}
+	}
+	return ErrMsg(fmt.Sprintf("sketch did not converge (rms residual %g)", math.Sqrt(cost/float64(m))))
+}
+
+//-----------------------------------------------------------------------------
+// Conversion to SDF2
+
+// sketchEdge is a line or arc of a sketch as a polyline.
+type sketchEdge struct {
+	v []V2
+}
+
+// edges returns the lines and arcs of the sketch as polylines.
+func (s *Sketch) edges(facets int) []*sketchEdge {
+	var edges []*sketchEdge
+	for _, l := range s.lines {
+		edges = append(edges, &sketchEdge{[]V2{l.P0.Position(), l.P1.Position()}})
+	}
+	for _, a := range s.arcs {
+		c := a.Center.Position()
+		r := a.Radius()
+		v0 := a.Start.Position().Sub(c)
+		v1 := a.End.Position().Sub(c)
+		t0 := math.Atan2(v0.Y, v0.X)
+		dt := math.Atan2(v1.Y, v1.X) - t0
+		if dt <= 0 {
+			dt += Tau
+		}
+		n := int(math.Ceil(float64(facets) * dt / Tau))
+		if n < 1 {
+			n = 1
+		}
+		v := []V2{a.Start.Position()}
+		for i := 1; i < n; i++ {
+			v = append(v, c.Add(PolarToXY(r, t0+dt*float64(i)/float64(n))))
+		}
+		edges = append(edges, &sketchEdge{append(v, a.End.Position())})
+	}
+	return edges
+}
+
+// Loops returns the closed loops formed by the lines and arcs of the sketch.
+// Arcs are approximated with the number of facets for a full circle.
+func (s *Sketch) Loops(facets int) ([]V2Set, error) {
+	edges := s.edges(facets)
+	tol := 1e-6 * s.size()
+	used := make([]bool, len(edges))
+	var loops []V2Set
+	for i := range edges {
+		if used[i] {
+			continue
+		}
+		used[i] = true
+		start := edges[i].v[0]
+		loop := append(V2Set{}, edges[i].v[:len(edges[i].v)-1]...)
+		end := edges[i].v[len(edges[i].v)-1]
+		for !end.Equals(start, tol) {
+			// find the next edge
+			found := false
+			for j := range edges {
+				if used[j] {
+					continue
+				}
+				v := edges[j].v
+				if v[len(v)-1].Equals(end, tol) {
+					// reverse the edge
+					v = append([]V2{}, v...)
+					for k := 0; k < len(v)/2; k++ {
+						v[k], v[len(v)-1-k] = v[len(v)-1-k], v[k]
+					}
+				} else if !v[0].Equals(end, tol) {
+					continue
+				}
+				used[j] = true
+				loop = append(loop, v[:len(v)-1]...)
+				end = v[len(v)-1]
+				found = true
+				break
+			}
+			if !found {
+				return nil, ErrMsg(fmt.Sprintf("sketch has an open loop at %v", end))
+			}
+		}
+		loops = append(loops, loop)
+	}
+	if len(loops) == 0 {
+		return nil, ErrMsg("sketch has no lines or arcs")
+	}
+	return loops, nil
+}
+
+// SDF2 returns an SDF2 for the closed loops of a solved sketch.
+// Loops within loops are holes.
+func (s *Sketch) SDF2(facets int) (SDF2, error) {
+	loops, err := s.Loops(facets)
+	if err != nil {
+		return nil, err
+	}
+	c := make([][]V2, len(loops))
+	for i := range loops {
+		c[i] = loops[i]
+	}
+	return MultiPolygon2D(c)
+}
+
+//-----------------------------------------------------------------------------
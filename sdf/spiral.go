@@ -1,7 +1,7 @@
 //-----------------------------------------------------------------------------
 /*
 
-2D Spirals
+2D Spirals (Archimedean and logarithmic)
 
 https://math.stackexchange.com/questions/175106/distance-between-point-and-a-spiral
 
@@ -151,3 +151,99 @@ func (s *ArcSpiralSDF2) BoundingBox() Box2 {
 }
 
 //-----------------------------------------------------------------------------
+
+// LogSpiralSDF2 is a 2d logarithmic spiral.
+type LogSpiralSDF2 struct {
+	a, b       float64 // r = a * exp(b * theta)
+	d          float64 // offset distance
+	start, end float64 // start/end angle
+	bb         Box2
+}
+
+// LogSpiral2D returns a 2d logarithmic spiral (r = a*exp(b*theta)).
+func LogSpiral2D(
+	a, b float64, // r = a*exp(b*theta)
+	start, end float64, // start/end angle (radians)
+	d float64, // offset distance
+) (SDF2, error) {
+	if a <= 0 {
+		return nil, ErrMsg("a <= 0")
+	}
+	if b == 0 {
+		return nil, ErrMsg("b == 0")
+	}
+	if start == end {
+		return nil, ErrMsg("start == end")
+	}
+	if start > end {
+		start, end = end, start
+	}
+	s := LogSpiralSDF2{a: a, b: b, d: d, start: start, end: end}
+	rMax := math.Max(s.radius(start), s.radius(end)) + d
+	s.bb = Box2{V2{-rMax, -rMax}, V2{rMax, rMax}}
+	return &s, nil
+}
+
+// radius returns the radius for a given theta.
+func (s *LogSpiralSDF2) radius(theta float64) float64 {
+	return s.a * math.Exp(s.b*theta)
+}
+
+// point returns the spiral point and its first and second derivatives at theta.
+func (s *LogSpiralSDF2) point(theta float64) (V2, V2, V2) {
+	r := s.radius(theta)
+	c, sn := math.Cos(theta), math.Sin(theta)
+	b := s.b
+	return V2{r * c, r * sn},
+		V2{r * (b*c - sn), r * (b*sn + c)},
+		V2{r * ((b*b-1)*c - 2*b*sn), r * ((b*b-1)*sn + 2*b*c)}
+}
+
+// closest refines theta (Newton's method on the distance squared) toward the closest spiral point to p.
+func (s *LogSpiralSDF2) closest(p V2, theta float64) float64 {
+	for i := 0; i < 8; i++ {
+		c, c1, c2 := s.point(theta)
+		v := c.Sub(p)
+		g1 := c1.Dot(c1) + v.Dot(c2)
+		if g1 <= 0 {
+			break
+		}
+		step := v.Dot(c1) / g1
+		theta = Clamp(theta-step, s.start, s.end)
+		if math.Abs(step) < 1e-12 {
+			break
+		}
+	}
+	return theta
+}
+
+// Evaluate returns the minimum distance to a 2d logarithmic spiral.
+func (s *LogSpiralSDF2) Evaluate(p V2) float64 {
+	pp := p.CartesianToPolar()
+	dist := func(theta float64) float64 {
+		c, _, _ := s.point(theta)
+		return c.Sub(p).Length()
+	}
+	// end points (and the nearest points on the spiral from them)
+	d := math.Min(dist(s.start), dist(s.end))
+	d = math.Min(d, math.Min(dist(s.closest(p, s.start)), dist(s.closest(p, s.end))))
+	// the turns of the spiral crossing the ray through p, either side of p
+	kMin := math.Ceil((s.start - pp.Theta) / Tau)
+	kMax := math.Floor((s.end - pp.Theta) / Tau)
+	k := math.Floor((math.Log(pp.R/s.a)/s.b - pp.Theta) / Tau)
+	for _, k := range []float64{k, k + 1} {
+		theta := pp.Theta + Tau*Clamp(k, kMin, kMax)
+		if theta < s.start || theta > s.end {
+			continue
+		}
+		d = math.Min(d, math.Min(dist(theta), dist(s.closest(p, theta))))
+	}
+	return d - s.d
+}
+
+// BoundingBox returns the bounding box of a 2d logarithmic spiral.
+func (s *LogSpiralSDF2) BoundingBox() Box2 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
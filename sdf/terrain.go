@@ -0,0 +1,405 @@
+//-----------------------------------------------------------------------------
+/*
+
+Terrain
+
+A heightfield (a grid of heights over a rectangular footprint) as a solid,
+from a flat bottom up to the bilinearly interpolated surface: base plates,
+dioramas and game terrain.
+
+The terrain heightfield is layered (fractal) gradient noise, optionally
+eroded by thermal erosion (material slides down the slopes steeper than
+the talus angle) and hydraulic erosion (rain dissolves material as it
+flows down and deposits it where the flow slows down), both after Musgrave
+et al, "The Synthesis and Rendering of Eroded Fractal Terrains", 1989.
+
+The distance is the vertical distance to the surface scaled by the maximum
+slope of the heightfield (so it is a bound, not exact), intersected with
+the box of the footprint.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// Heightfield is a grid of heights over a rectangular footprint (centered on the origin).
+type Heightfield struct {
+	Size   V2        // footprint (x, y)
+	Nx, Ny int       // grid points on x and y (>= 2)
+	Z      []float64 // heights, Nx points per row, Ny rows of increasing y
+}
+
+// NewHeightfield returns a heightfield of zero heights with cells on the longest axis of the footprint.
+func NewHeightfield(size V2, cells int) (*Heightfield, error) {
+	if size.X <= 0 || size.Y <= 0 {
+		return nil, ErrMsg("size <= 0")
+	}
+	if cells < 1 {
+		return nil, ErrMsg("cells < 1")
+	}
+	d := math.Max(size.X, size.Y) / float64(cells)
+	nx := int(math.Ceil(size.X/d-tolerance)) + 1
+	ny := int(math.Ceil(size.Y/d-tolerance)) + 1
+	return &Heightfield{size, nx, ny, make([]float64, nx*ny)}, nil
+}
+
+// step returns the grid spacing on x and y.
+func (h *Heightfield) step() V2 {
+	return V2{h.Size.X / float64(h.Nx-1), h.Size.Y / float64(h.Ny-1)}
+}
+
+// At returns the height of grid point (i, j).
+func (h *Heightfield) At(i, j int) float64 {
+	return h.Z[j*h.Nx+i]
+}
+
+// Position returns the position of grid point (i, j).
+func (h *Heightfield) Position(i, j int) V2 {
+	d := h.step()
+	return V2{float64(i)*d.X - h.Size.X/2, float64(j)*d.Y - h.Size.Y/2}
+}
+
+// Height returns the (bilinearly interpolated) height at a point, clamped to the footprint.
+func (h *Heightfield) Height(p V2) float64 {
+	d := h.step()
+	x := Clamp((p.X+h.Size.X/2)/d.X, 0, float64(h.Nx-1))
+	y := Clamp((p.Y+h.Size.Y/2)/d.Y, 0, float64(h.Ny-1))
+	i := int(math.Min(math.Floor(x), float64(h.Nx-2)))
+	j := int(math.Min(math.Floor(y), float64(h.Ny-2)))
+	u, v := x-float64(i), y-float64(j)
+	z0 := h.At(i, j) + (h.At(i+1, j)-h.At(i, j))*u
+	z1 := h.At(i, j+1) + (h.At(i+1, j+1)-h.At(i, j+1))*u
+	return z0 + (z1-z0)*v
+}
+
+// slope returns the maximum gradient length of the interpolated surface.
+func (h *Heightfield) slope() float64 {
+	d := h.step()
+	var m2 float64
+	for j := 0; j < h.Ny-1; j++ {
+		for i := 0; i < h.Nx-1; i++ {
+			// the gradient is largest at a cell corner
+			sx0 := (h.At(i+1, j) - h.At(i, j)) / d.X
+			sx1 := (h.At(i+1, j+1) - h.At(i, j+1)) / d.X
+			sy0 := (h.At(i, j+1) - h.At(i, j)) / d.Y
+			sy1 := (h.At(i+1, j+1) - h.At(i+1, j)) / d.Y
+			for _, s := range [4][2]float64{{sx0, sy0}, {sx0, sy1}, {sx1, sy0}, {sx1, sy1}} {
+				m2 = math.Max(m2, s[0]*s[0]+s[1]*s[1])
+			}
+		}
+	}
+	return math.Sqrt(m2)
+}
+
+// HeightfieldSDF3 is a solid from a flat bottom up to a heightfield.
+type HeightfieldSDF3 struct {
+	h    *Heightfield
+	base float64 // height of the heightfield zero
+	k    float64 // distance scale (the slope bound)
+	box  V3      // half size of the footprint box
+	zc   float64 // center height of the footprint box
+	bb   Box3
+}
+
+// Heightfield3D returns an SDF3 for a solid from z = 0 up to the surface z = base + height.
+// The heights must be > -base.
+func Heightfield3D(h *Heightfield, base float64) (SDF3, error) {
+	if h == nil || h.Nx < 2 || h.Ny < 2 || len(h.Z) != h.Nx*h.Ny {
+		return nil, ErrMsg("bad heightfield")
+	}
+	if h.Size.X <= 0 || h.Size.Y <= 0 {
+		return nil, ErrMsg("size <= 0")
+	}
+	zmax := math.Inf(-1)
+	for _, z := range h.Z {
+		if base+z <= 0 {
+			return nil, ErrMsg("height <= -base")
+		}
+		zmax = math.Max(zmax, base+z)
+	}
+	s := HeightfieldSDF3{h: h, base: base}
+	l := h.slope()
+	s.k = math.Sqrt(1 + l*l)
+	s.box = V3{h.Size.X / 2, h.Size.Y / 2, zmax / 2}
+	s.zc = zmax / 2
+	s.bb = Box3{V3{-s.box.X, -s.box.Y, 0}, V3{s.box.X, s.box.Y, zmax}}
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a heightfield solid.
+func (s *HeightfieldSDF3) Evaluate(p V3) float64 {
+	d := (p.Z - s.base - s.h.Height(V2{p.X, p.Y})) / s.k
+	return math.Max(d, sdfBox3d(V3{p.X, p.Y, p.Z - s.zc}, s.box))
+}
+
+// BoundingBox returns the bounding box of a heightfield solid.
+func (s *HeightfieldSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
+
+// TerrainConfig sets the parameters of a terrain.
+type TerrainConfig struct {
+	Size        V2      // footprint (x, y), centered on the origin
+	Height      float64 // height of the relief (before erosion)
+	Base        float64 // thickness below the lowest point
+	Cells       int     // heightfield cells on the longest axis (0: 128)
+	Seed        int64   // noise seed
+	Scale       float64 // size of the largest noise features (0: the longest side of the footprint)
+	Octaves     int     // noise octaves (0: 6)
+	Persistence float64 // amplitude ratio of successive octaves (0: 0.5)
+	Thermal     int     // thermal erosion iterations
+	Talus       float64 // talus angle of the thermal erosion, radians (0: 30 degrees)
+	Hydraulic   int     // hydraulic erosion iterations
+	Rain        float64 // rain of each hydraulic erosion iteration, as a fraction of the height (0: 0.01)
+}
+
+// hydraulic erosion constants (Musgrave)
+const (
+	terrainCapacity    = 0.5  // sediment capacity per unit of water flow
+	terrainSolubility  = 0.3  // fraction of the capacity shortfall dissolved
+	terrainDeposition  = 0.3  // fraction of the excess sediment deposited
+	terrainEvaporation = 0.05 // fraction of the water evaporated per iteration
+)
+
+// TerrainHeightfield returns the heightfield of a terrain, with heights from 0 (the lowest point).
+func TerrainHeightfield(cfg *TerrainConfig) (*Heightfield, error) {
+	if cfg == nil {
+		return nil, ErrMsg("nil config")
+	}
+	if cfg.Height <= 0 {
+		return nil, ErrMsg("height <= 0")
+	}
+	if cfg.Scale < 0 || cfg.Octaves < 0 || cfg.Persistence < 0 || cfg.Talus < 0 || cfg.Rain < 0 {
+		return nil, ErrMsg("negative parameter")
+	}
+	if cfg.Talus >= Pi/2 {
+		return nil, ErrMsg("talus >= 90 degrees")
+	}
+	cells := cfg.Cells
+	if cells == 0 {
+		cells = 128
+	}
+	h, err := NewHeightfield(cfg.Size, cells)
+	if err != nil {
+		return nil, err
+	}
+	scale := cfg.Scale
+	if scale == 0 {
+		scale = math.Max(cfg.Size.X, cfg.Size.Y)
+	}
+	octaves := cfg.Octaves
+	if octaves == 0 {
+		octaves = 6
+	}
+	persistence := cfg.Persistence
+	if persistence == 0 {
+		persistence = 0.5
+	}
+	// layered noise, normalized to 0..height
+	for j := 0; j < h.Ny; j++ {
+		for i := 0; i < h.Nx; i++ {
+			p := h.Position(i, j).DivScalar(scale)
+			var z float64
+			a := 1.0
+			for o := 0; o < octaves; o++ {
+				z += a * gradientNoise2(p, cfg.Seed+int64(o))
+				p = p.MulScalar(2)
+				a *= persistence
+			}
+			h.Z[j*h.Nx+i] = z
+		}
+	}
+	h.normalize(cfg.Height)
+	if cfg.Thermal > 0 {
+		talus := cfg.Talus
+		if talus == 0 {
+			talus = 30 * Pi / 180
+		}
+		h.thermalErosion(cfg.Thermal, math.Tan(talus))
+	}
+	if cfg.Hydraulic > 0 {
+		rain := cfg.Rain
+		if rain == 0 {
+			rain = 0.01
+		}
+		h.hydraulicErosion(cfg.Hydraulic, rain*cfg.Height)
+	}
+	h.normalize(0)
+	return h, nil
+}
+
+// Terrain3D returns an SDF3 for a terrain, from z = 0 up to its surface.
+func Terrain3D(cfg *TerrainConfig) (SDF3, error) {
+	if cfg != nil && cfg.Base <= 0 {
+		return nil, ErrMsg("base <= 0")
+	}
+	h, err := TerrainHeightfield(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return Heightfield3D(h, cfg.Base)
+}
+
+// normalize shifts the heights to start at 0, and scales them to a height range (0: no scaling).
+func (h *Heightfield) normalize(height float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, z := range h.Z {
+		lo, hi = math.Min(lo, z), math.Max(hi, z)
+	}
+	k := 1.0
+	if height != 0 && hi > lo {
+		k = height / (hi - lo)
+	}
+	for i := range h.Z {
+		h.Z[i] = (h.Z[i] - lo) * k
+	}
+}
+
+// terrainNeighbors are the 8 neighbor offsets of a grid point.
+var terrainNeighbors = [8][2]int{{-1, -1}, {0, -1}, {1, -1}, {-1, 0}, {1, 0}, {-1, 1}, {0, 1}, {1, 1}}
+
+// thermalErosion moves material from each point to its lower neighbors where the slope is
+// above the talus slope (tangent of the talus angle). The material is conserved.
+func (h *Heightfield) thermalErosion(iterations int, talus float64) {
+	d := h.step()
+	var dist [8]float64
+	for k, n := range terrainNeighbors {
+		dist[k] = math.Hypot(float64(n[0])*d.X, float64(n[1])*d.Y)
+	}
+	delta := make([]float64, len(h.Z))
+	for it := 0; it < iterations; it++ {
+		for i := range delta {
+			delta[i] = 0
+		}
+		for j := 0; j < h.Ny; j++ {
+			for i := 0; i < h.Nx; i++ {
+				z := h.At(i, j)
+				// the height above the talus slope of each neighbor
+				var excess [8]float64
+				var total, most float64
+				for k, n := range terrainNeighbors {
+					x, y := i+n[0], j+n[1]
+					if x < 0 || x >= h.Nx || y < 0 || y >= h.Ny {
+						continue
+					}
+					if e := z - h.At(x, y) - talus*dist[k]; e > 0 {
+						excess[k] = e
+						total += e
+						most = math.Max(most, e)
+					}
+				}
+				if total == 0 {
+					continue
+				}
+				// move half the largest excess, shared in proportion to the excess
+				m := 0.5 * most
+				delta[j*h.Nx+i] -= m
+				for k, n := range terrainNeighbors {
+					if excess[k] > 0 {
+						delta[(j+n[1])*h.Nx+i+n[0]] += m * excess[k] / total
+					}
+				}
+			}
+		}
+		for i := range h.Z {
+			h.Z[i] += delta[i]
+		}
+	}
+}
+
+// hydraulicErosion rains on the heightfield, moving the water to the lowest neighbor of each
+// point. The flowing water dissolves material up to its capacity, and deposits it when it
+// carries more than its capacity. The sediment left at the end is deposited.
+func (h *Heightfield) hydraulicErosion(iterations int, rain float64) {
+	water := make([]float64, len(h.Z))
+	sediment := make([]float64, len(h.Z))
+	for it := 0; it < iterations; it++ {
+		for i := range water {
+			water[i] += rain
+		}
+		for j := 0; j < h.Ny; j++ {
+			for i := 0; i < h.Nx; i++ {
+				v := j*h.Nx + i
+				// the lowest neighbor (height and water)
+				u, lowest := -1, h.Z[v]+water[v]
+				for _, n := range terrainNeighbors {
+					x, y := i+n[0], j+n[1]
+					if x < 0 || x >= h.Nx || y < 0 || y >= h.Ny {
+						continue
+					}
+					if a := h.Z[y*h.Nx+x] + water[y*h.Nx+x]; a < lowest {
+						u, lowest = y*h.Nx+x, a
+					}
+				}
+				if u < 0 {
+					// still water deposits sediment
+					h.Z[v] += terrainDeposition * sediment[v]
+					sediment[v] *= 1 - terrainDeposition
+					continue
+				}
+				// move water to level the points (or all of it)
+				dw := math.Min(water[v], (h.Z[v]+water[v]-lowest)/2)
+				water[v] -= dw
+				water[u] += dw
+				c := terrainCapacity * dw
+				if sediment[v] >= c {
+					sediment[u] += c
+					h.Z[v] += terrainDeposition * (sediment[v] - c)
+					sediment[v] = (1 - terrainDeposition) * (sediment[v] - c)
+				} else {
+					e := terrainSolubility * (c - sediment[v])
+					sediment[u] += sediment[v] + e
+					h.Z[v] -= e
+					sediment[v] = 0
+				}
+			}
+		}
+		for i := range water {
+			water[i] *= 1 - terrainEvaporation
+		}
+	}
+	for i := range h.Z {
+		h.Z[i] += sediment[i]
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// terrainHash returns a pseudo-random 64 bit hash of a grid point and a seed (splitmix64).
+func terrainHash(i, j, seed int64) uint64 {
+	x := uint64(i)*0x9e3779b97f4a7c15 ^ uint64(j)*0xc2b2ae3d27d4eb4f ^ uint64(seed)*0x165667b19e3779f9
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+// gradientNoise2 returns 2d gradient (Perlin) noise, about -1..1, with unit grid spacing.
+func gradientNoise2(p V2, seed int64) float64 {
+	x0, y0 := math.Floor(p.X), math.Floor(p.Y)
+	fx, fy := p.X-x0, p.Y-y0
+	i, j := int64(x0), int64(y0)
+	grad := func(di, dj int64, dx, dy float64) float64 {
+		a := float64(terrainHash(i+di, j+dj, seed)>>11) * (Tau / (1 << 53))
+		return math.Cos(a)*dx + math.Sin(a)*dy
+	}
+	// quintic fade
+	fade := func(t float64) float64 { return t * t * t * (t*(t*6-15) + 10) }
+	u, v := fade(fx), fade(fy)
+	n00 := grad(0, 0, fx, fy)
+	n10 := grad(1, 0, fx-1, fy)
+	n01 := grad(0, 1, fx, fy-1)
+	n11 := grad(1, 1, fx-1, fy-1)
+	n0 := n00 + (n10-n00)*u
+	n1 := n01 + (n11-n01)*u
+	return math.Sqrt2 * (n0 + (n1-n0)*v)
+}
+
+//-----------------------------------------------------------------------------
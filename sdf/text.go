@@ -31,8 +31,10 @@ const (
 
 // Text stores a UTF8 string and it's rendering parameters.
 type Text struct {
-	s      string
-	halign align
+	s        string
+	halign   align
+	subst    *FontFeatures // substitution features of the font
+	features []string      // OpenType features
 }
 
 //-----------------------------------------------------------------------------
@@ -111,16 +113,34 @@ func glyphConvert(g *truetype.GlyphBuf) (SDF2, error) {
 
 //-----------------------------------------------------------------------------
 
-// lineSDF2 returns an SDF2 slice for a line of text
-func lineSDF2(f *truetype.Font, l string) ([]SDF2, float64, error) {
+// lineGlyphs returns the glyph indices for a line of text, with the features of the text object
+func lineGlyphs(f *truetype.Font, l string, t *Text) []truetype.Index {
+	var gs []truetype.Index
+	for _, r := range l {
+		gs = append(gs, f.Index(r))
+	}
+	if t.subst != nil && len(t.features) != 0 {
+		gs = t.subst.gsub.apply(t.features, gs)
+	}
+	return gs
+}
+
+// glyphSDF2 is a positioned glyph within a line of text.
+type glyphSDF2 struct {
+	s       SDF2    // glyph outline at the origin (nil for blank glyphs)
+	x       float64 // x offset of the glyph
+	advance float64 // advance width of the glyph
+}
+
+// lineGlyphSDF2 returns the glyph SDF2s for a line of text
+func lineGlyphSDF2(f *truetype.Font, l string, t *Text) ([]glyphSDF2, float64, error) {
 	iPrev := truetype.Index(0)
 	scale := fixed.Int26_6(f.FUnitsPerEm())
 	xOfs := 0.0
 
-	var ss []SDF2
+	var gs []glyphSDF2
 
-	for _, r := range l {
-		i := f.Index(r)
+	for _, i := range lineGlyphs(f, l, t) {
 
 		// get the glyph metrics
 		hm := f.HMetric(scale, i)
@@ -141,14 +161,26 @@ func lineSDF2(f *truetype.Font, l string) ([]SDF2, float64, error) {
 		if err != nil {
 			return nil, 0, err
 		}
-		if s != nil {
-			s = Transform2D(s, Translate2d(V2{xOfs, 0}))
-			ss = append(ss, s)
-		}
+		gs = append(gs, glyphSDF2{s, xOfs, float64(hm.AdvanceWidth)})
 
 		xOfs += float64(hm.AdvanceWidth)
 	}
 
+	return gs, xOfs, nil
+}
+
+// lineSDF2 returns an SDF2 slice for a line of text
+func lineSDF2(f *truetype.Font, l string, t *Text) ([]SDF2, float64, error) {
+	gs, xOfs, err := lineGlyphSDF2(f, l, t)
+	if err != nil {
+		return nil, 0, err
+	}
+	var ss []SDF2
+	for _, g := range gs {
+		if g.s != nil {
+			ss = append(ss, Transform2D(g.s, Translate2d(V2{g.x, 0})))
+		}
+	}
 	return ss, xOfs, nil
 }
 
@@ -163,6 +195,13 @@ func NewText(s string) *Text {
 	}
 }
 
+// SetFeatures sets the OpenType features (e.g. "liga", "smcp") used to render the text,
+// from the substitution features of its font (see LoadFontFeatures).
+func (t *Text) SetFeatures(subst *FontFeatures, features ...string) {
+	t.subst = subst
+	t.features = features
+}
+
 // LoadFont loads a truetype (*.ttf) font file.
 func LoadFont(fname string) (*truetype.Font, error) {
 	// read the font file
@@ -170,6 +209,11 @@ func LoadFont(fname string) (*truetype.Font, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ParseFont(b)
+}
+
+// ParseFont parses truetype font data (e.g. an embedded font).
+func ParseFont(b []byte) (*truetype.Font, error) {
 	return truetype.Parse(b)
 }
 
@@ -184,7 +228,7 @@ func TextSDF2(f *truetype.Font, t *Text, h float64) (SDF2, error) {
 	var ss []SDF2
 
 	for i := range lines {
-		ssLine, hlen, err := lineSDF2(f, lines[i])
+		ssLine, hlen, err := lineSDF2(f, lines[i], t)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,135 @@
+//-----------------------------------------------------------------------------
+/*
+
+Text on a Path
+
+Place the glyphs of a line of text along a 2D path (e.g. the rim of a lid or
+a badge). The glyph baselines follow the path and each glyph is rotated to
+the direction of the path. The top of the glyphs is on the left hand side
+of the path direction.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"strings"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/math/fixed"
+)
+
+//-----------------------------------------------------------------------------
+
+// polyline is a path with arc length parameterisation.
+type polyline struct {
+	p []V2
+	l []float64 // cumulative length at each point
+}
+
+func newPolyline(p []V2) *polyline {
+	l := make([]float64, len(p))
+	for i := 1; i < len(p); i++ {
+		l[i] = l[i-1] + p[i].Sub(p[i-1]).Length()
+	}
+	return &polyline{p, l}
+}
+
+// length returns the length of the path.
+func (pl *polyline) length() float64 {
+	return pl.l[len(pl.l)-1]
+}
+
+// point returns the point at arc length s along the path.
+// Points beyond the ends of the path are extrapolated.
+func (pl *polyline) point(s float64) V2 {
+	n := len(pl.p)
+	i := 1
+	for i < n-1 && pl.l[i] < s {
+		i++
+	}
+	d := pl.l[i] - pl.l[i-1]
+	if d == 0 {
+		return pl.p[i]
+	}
+	t := (s - pl.l[i-1]) / d
+	return pl.p[i-1].Add(pl.p[i].Sub(pl.p[i-1]).MulScalar(t))
+}
+
+//-----------------------------------------------------------------------------
+
+// ArcPath returns a path along a circular arc centered on the origin.
+// The arc goes from angle a0 to angle a1 (radians), clockwise if a1 < a0.
+// Text on a clockwise arc reads around the outside of the circle.
+func ArcPath(radius, a0, a1 float64, n int) V2Set {
+	if n < 1 {
+		n = 1
+	}
+	p := make(V2Set, n+1)
+	for i := range p {
+		a := a0 + (a1-a0)*float64(i)/float64(n)
+		p[i] = V2{radius * math.Cos(a), radius * math.Sin(a)}
+	}
+	return p
+}
+
+// TextPathSDF2 returns an SDF2 for a line of text placed along a path.
+// The text height is h and spacing is the extra space added between glyphs.
+// The text alignment sets where the text starts on the path: the start,
+// the middle (centered text) or the end.
+func TextPathSDF2(f *truetype.Font, t *Text, h float64, path V2Set, spacing float64) (SDF2, error) {
+	if len(path) < 2 {
+		return nil, ErrMsg("path needs at least 2 points")
+	}
+	if strings.Contains(t.s, "\n") {
+		return nil, ErrMsg("text on a path must be a single line")
+	}
+	pl := newPolyline(path)
+
+	scale := fixed.Int26_6(f.FUnitsPerEm())
+	vm := f.VMetric(scale, f.Index('\n'))
+	k := h / float64(vm.AdvanceHeight)
+
+	gs, xLen, err := lineGlyphSDF2(f, t.s, t)
+	if err != nil {
+		return nil, err
+	}
+
+	// length of the text along the path
+	tLen := k * xLen
+	if len(gs) > 1 {
+		tLen += spacing * float64(len(gs)-1)
+	}
+	if tLen > pl.length() {
+		return nil, ErrMsg("text is longer than the path")
+	}
+	start := 0.0
+	if t.halign == rAlign {
+		start = pl.length() - tLen
+	} else if t.halign == cAlign {
+		start = (pl.length() - tLen) / 2.0
+	}
+
+	var ss []SDF2
+	for i, g := range gs {
+		if g.s == nil {
+			continue
+		}
+		w := k * g.advance
+		s := start + k*g.x + spacing*float64(i) + w/2
+		// rotate the glyph to the chord of the path over its width
+		p0, p1 := pl.point(s-w/2), pl.point(s+w/2)
+		theta := math.Atan2(p1.Y-p0.Y, p1.X-p0.X)
+		m := Translate2d(pl.point(s)).Mul(Rotate2d(theta)).Mul(Translate2d(V2{-w / 2, 0}))
+		ss = append(ss, Transform2D(ScaleUniform2D(g.s, k), m))
+	}
+	if len(ss) == 0 {
+		return nil, ErrMsg("no glyphs to place on the path")
+	}
+
+	return Union2D(ss...), nil
+}
+
+//-----------------------------------------------------------------------------
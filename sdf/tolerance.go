@@ -0,0 +1,114 @@
+//-----------------------------------------------------------------------------
+/*
+
+Tolerances
+
+Fixed epsilons break at very small or very large model scales, e.g. a normal
+step of 0.001 is useless for a model 0.01 units across. Tolerances are
+derived from the model size so the same relative accuracy is used at any scale.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// tolerances relative to the model size
+const (
+	normalTolerance  = 1e-5  // 1e-3 for a 100 unit model
+	surfaceTolerance = 1e-6  // 1e-4 for a 100 unit model
+	vertexTolerance  = 1e-11 // 1e-9 for a 100 unit model
+	boxTolerance     = 1e-10 // bounding box enlargement
+)
+
+// Tolerances are the scale dependent tolerances used when working with an SDF.
+type Tolerances struct {
+	Normal  float64 // central difference step used for normals and gradients
+	Surface float64 // distance below which a point is considered to be on the surface
+	Vertex  float64 // distance below which two vertices are considered to be equal
+	Box     float64 // bounding box enlargement to avoid surfaces on the box boundary
+}
+
+// NewTolerances returns the tolerances for a model of the given size.
+func NewTolerances(size float64) Tolerances {
+	if size <= 0 || math.IsInf(size, 0) || math.IsNaN(size) {
+		size = 1
+	}
+	return Tolerances{
+		Normal:  size * normalTolerance,
+		Surface: size * surfaceTolerance,
+		Vertex:  size * vertexTolerance,
+		Box:     size * boxTolerance,
+	}
+}
+
+// ModelTolerances3 returns the tolerances for an SDF3, derived from the size of its bounding box.
+func ModelTolerances3(s SDF3) Tolerances {
+	return NewTolerances(s.BoundingBox().Size().MaxComponent())
+}
+
+// ModelTolerances2 returns the tolerances for an SDF2, derived from the size of its bounding box.
+func ModelTolerances2(s SDF2) Tolerances {
+	return NewTolerances(s.BoundingBox().Size().MaxComponent())
+}
+
+//-----------------------------------------------------------------------------
+
+// Normal3 returns the normal of an SDF3 at a point using the normal tolerance.
+func (t Tolerances) Normal3(s SDF3, p V3) V3 {
+	return Normal3(s, p, t.Normal)
+}
+
+// Normal2 returns the normal of an SDF2 at a point using the normal tolerance.
+func (t Tolerances) Normal2(s SDF2, p V2) V2 {
+	return Normal2(s, p, t.Normal)
+}
+
+// Raycast3 collides a ray with an SDF3 (see Raycast3), stopping within the surface tolerance.
+func (t Tolerances) Raycast3(s SDF3, from, dir V3, maxDist float64, maxSteps int) (V3, float64, int) {
+	return Raycast3(s, from, dir, 0, 1, t.Surface, maxDist, maxSteps)
+}
+
+// Raycast2 collides a ray with an SDF2 (see Raycast2), stopping within the surface tolerance.
+func (t Tolerances) Raycast2(s SDF2, from, dir V2, maxDist float64, maxSteps int) (V2, float64, int) {
+	return Raycast2(s, from, dir, 0, 1, t.Surface, maxDist, maxSteps)
+}
+
+//-----------------------------------------------------------------------------
+// Raycasting parameters
+
+// RaycastParams are the tuning parameters of Raycast3/Raycast2.
+type RaycastParams struct {
+	ScaleAndSigmoid float64 // see Raycast3
+	StepScale       float64 // see Raycast3
+	Epsilon         float64 // see Raycast3
+	MaxSteps        int     // see Raycast3
+	Relaxed         bool    // over-relaxed steps, refined with regula falsi where the surface is crossed
+}
+
+// NewRaycastParams3 returns raycasting parameters for an SDF3 sampled with the given cell size.
+// The surface epsilon is relative to the cell size and the tolerance of the model.
+// SDF3s with bound (non-exact) distances use shorter steps.
+func NewRaycastParams3(s SDF3, cellSize float64) RaycastParams {
+	tol := ModelTolerances3(s)
+	p := RaycastParams{
+		StepScale: 1,
+		Epsilon:   math.Max(cellSize*1e-4, tol.Vertex),
+		MaxSteps:  500,
+	}
+	if !IsExact3(s) {
+		p.StepScale = 0.5
+		p.MaxSteps = 1000
+	}
+	return p
+}
+
+// Raycast3 collides a ray with an SDF3 using the parameters (see Raycast3).
+func (r RaycastParams) Raycast3(s SDF3, from, dir V3, maxDist float64) (V3, float64, int) {
+	return raycast3(s, from, dir, r.ScaleAndSigmoid, r.StepScale, r.Epsilon, maxDist, r.MaxSteps, r.Relaxed)
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,439 @@
+//-----------------------------------------------------------------------------
+/*
+
+Topology Optimization
+
+A simple SIMP (solid isotropic material with penalization) minimum
+compliance optimizer on a voxel grid. Each voxel is an 8 node hexahedral
+linear elastic element with a stiffness scaled by its density raised to
+the penalty power. The displacements are solved by conjugate gradients
+(matrix free, Jacobi preconditioned), the densities are filtered and
+updated by the optimality criteria method with a volume constraint.
+
+The result is a DensityGrid, convert it to an SDF3 with Density3D.
+
+See: Andreassen et al., "Efficient topology optimization in MATLAB using 88 lines of code"
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import "math"
+
+//-----------------------------------------------------------------------------
+
+// TopologyProblem is a minimum compliance (maximum stiffness) topology optimization problem.
+type TopologyProblem struct {
+	Domain         Box3            // design domain
+	Cells          V3i             // number of voxels on each axis
+	VolumeFraction float64         // solid fraction of the design space (0..1)
+	Fixed          func(p V3) bool // nodes (voxel corners) fixed in place
+	Load           func(p V3) V3   // force at a node (zero: no load)
+	Space          SDF3            // design space, voxels with centers outside (> 0) are void (nil: the domain)
+	Penalty        float64         // SIMP penalty exponent (0: 3)
+	FilterRadius   float64         // density filter radius in voxels (0: 1.5)
+	Iterations     int             // maximum number of design iterations (0: 50)
+}
+
+const (
+	topoPoisson       = 0.3  // poisson ratio of the material
+	topoMinStiffness  = 1e-9 // relative stiffness of void voxels
+	topoMove          = 0.2  // largest density change per iteration
+	topoConverged     = 0.01 // density change at convergence
+	topoSolveAccuracy = 1e-4 // relative residual of the displacement solution
+)
+
+//-----------------------------------------------------------------------------
+
+// topoElementStiffness returns the stiffness matrix of a hexahedral element with unit Young's modulus.
+// The element nodes are ordered x*4 + y*2 + z, with 3 degrees of freedom each.
+func topoElementStiffness(h V3, nu float64) *[24][24]float64 {
+	c := 1 / ((1 + nu) * (1 - 2*nu))
+	g := c * (1 - 2*nu) / 2
+	d := [6][6]float64{
+		{c * (1 - nu), c * nu, c * nu},
+		{c * nu, c * (1 - nu), c * nu},
+		{c * nu, c * nu, c * (1 - nu)},
+		{3: g},
+		{4: g},
+		{5: g},
+	}
+	var ke [24][24]float64
+	// 2x2x2 gauss quadrature
+	q := 1 / math.Sqrt(3)
+	w := h.X * h.Y * h.Z / 8
+	for gp := 0; gp < 8; gp++ {
+		xi := [3]float64{q * float64(2*(gp>>2&1)-1), q * float64(2*(gp>>1&1)-1), q * float64(2*(gp&1)-1)}
+		var b [6][24]float64
+		for a := 0; a < 8; a++ {
+			s := [3]float64{float64(2*(a>>2&1) - 1), float64(2*(a>>1&1) - 1), float64(2*(a&1) - 1)}
+			// shape function derivatives
+			bx := s[0] * (1 + s[1]*xi[1]) * (1 + s[2]*xi[2]) / (4 * h.X)
+			by := s[1] * (1 + s[0]*xi[0]) * (1 + s[2]*xi[2]) / (4 * h.Y)
+			bz := s[2] * (1 + s[0]*xi[0]) * (1 + s[1]*xi[1]) / (4 * h.Z)
+			b[0][3*a] = bx
+			b[1][3*a+1] = by
+			b[2][3*a+2] = bz
+			b[3][3*a], b[3][3*a+1] = by, bx
+			b[4][3*a+1], b[4][3*a+2] = bz, by
+			b[5][3*a], b[5][3*a+2] = bz, bx
+		}
+		// ke += b^T d b
+		var db [6][24]float64
+		for i := 0; i < 6; i++ {
+			for j := 0; j < 24; j++ {
+				for k := 0; k < 6; k++ {
+					db[i][j] += d[i][k] * b[k][j]
+				}
+			}
+		}
+		for i := 0; i < 24; i++ {
+			for j := 0; j < 24; j++ {
+				var sum float64
+				for k := 0; k < 6; k++ {
+					sum += b[k][i] * db[k][j]
+				}
+				ke[i][j] += sum * w
+			}
+		}
+	}
+	return &ke
+}
+
+//-----------------------------------------------------------------------------
+
+// topoSolver solves for the displacements of the voxel grid.
+type topoSolver struct {
+	cells V3i
+	ke    *[24][24]float64
+	fixed []bool    // fixed degrees of freedom
+	f     []float64 // forces
+	u     []float64 // displacements
+	scale []float64 // voxel stiffness scales
+}
+
+// dofs returns the degrees of freedom of a voxel.
+func (s *topoSolver) dofs(i, j, k int, dofs *[24]int) {
+	ny, nz := s.cells[1]+1, s.cells[2]+1
+	for a := 0; a < 8; a++ {
+		n := ((i+(a>>2&1))*ny+j+(a>>1&1))*nz + k + (a & 1)
+		dofs[3*a], dofs[3*a+1], dofs[3*a+2] = 3*n, 3*n+1, 3*n+2
+	}
+}
+
+// each calls fn for each voxel with its index and degrees of freedom.
+func (s *topoSolver) each(fn func(e int, dofs *[24]int)) {
+	var dofs [24]int
+	e := 0
+	for i := 0; i < s.cells[0]; i++ {
+		for j := 0; j < s.cells[1]; j++ {
+			for k := 0; k < s.cells[2]; k++ {
+				s.dofs(i, j, k, &dofs)
+				fn(e, &dofs)
+				e++
+			}
+		}
+	}
+}
+
+// mul sets y = K x for the free degrees of freedom.
+func (s *topoSolver) mul(x, y []float64) {
+	for i := range y {
+		y[i] = 0
+	}
+	s.each(func(e int, dofs *[24]int) {
+		var xe [24]float64
+		for a, d := range dofs {
+			xe[a] = x[d]
+		}
+		for a, d := range dofs {
+			var sum float64
+			for b := range xe {
+				sum += s.ke[a][b] * xe[b]
+			}
+			y[d] += s.scale[e] * sum
+		}
+	})
+	for i, fixed := range s.fixed {
+		if fixed {
+			y[i] = 0
+		}
+	}
+}
+
+// solve solves K u = f by Jacobi preconditioned conjugate gradients, starting from the current u.
+func (s *topoSolver) solve() {
+	n := len(s.u)
+	diag := make([]float64, n)
+	s.each(func(e int, dofs *[24]int) {
+		for a, d := range dofs {
+			diag[d] += s.scale[e] * s.ke[a][a]
+		}
+	})
+	dot := func(a, b []float64) float64 {
+		var sum float64
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+	r := make([]float64, n)
+	z := make([]float64, n)
+	p := make([]float64, n)
+	q := make([]float64, n)
+	s.mul(s.u, q)
+	for i := range r {
+		if !s.fixed[i] {
+			r[i] = s.f[i] - q[i]
+		}
+	}
+	limit := topoSolveAccuracy * math.Sqrt(dot(s.f, s.f))
+	var rz float64
+	for iteration := 0; iteration < n; iteration++ {
+		if math.Sqrt(dot(r, r)) <= limit {
+			break
+		}
+		for i := range z {
+			if diag[i] != 0 {
+				z[i] = r[i] / diag[i]
+			}
+		}
+		rz0 := rz
+		rz = dot(r, z)
+		if iteration == 0 {
+			copy(p, z)
+		} else {
+			beta := rz / rz0
+			for i := range p {
+				p[i] = z[i] + beta*p[i]
+			}
+		}
+		s.mul(p, q)
+		alpha := rz / dot(p, q)
+		for i := range s.u {
+			s.u[i] += alpha * p[i]
+			r[i] -= alpha * q[i]
+		}
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// topoFilter is a linear density filter (weights decreasing with distance).
+type topoFilter struct {
+	neighbours [][]int
+	weights    [][]float64
+	sum        []float64 // sum of the weights of a voxel
+}
+
+// newTopoFilter returns a density filter with a radius in voxels.
+func newTopoFilter(cells V3i, r float64) *topoFilter {
+	n := cells[0] * cells[1] * cells[2]
+	f := &topoFilter{make([][]int, n), make([][]float64, n), make([]float64, n)}
+	ri := int(math.Ceil(r)) - 1
+	index := func(i, j, k int) int { return (i*cells[1]+j)*cells[2] + k }
+	for i := 0; i < cells[0]; i++ {
+		for j := 0; j < cells[1]; j++ {
+			for k := 0; k < cells[2]; k++ {
+				e := index(i, j, k)
+				for i1 := imax(i-ri, 0); i1 <= imin(i+ri, cells[0]-1); i1++ {
+					for j1 := imax(j-ri, 0); j1 <= imin(j+ri, cells[1]-1); j1++ {
+						for k1 := imax(k-ri, 0); k1 <= imin(k+ri, cells[2]-1); k1++ {
+							w := r - V3{float64(i - i1), float64(j - j1), float64(k - k1)}.Length()
+							if w > 0 {
+								f.neighbours[e] = append(f.neighbours[e], index(i1, j1, k1))
+								f.weights[e] = append(f.weights[e], w)
+								f.sum[e] += w
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return f
+}
+
+// apply sets y to the filtered values of x.
+func (f *topoFilter) apply(x, y []float64) {
+	for e := range y {
+		var sum float64
+		for i, n := range f.neighbours[e] {
+			sum += f.weights[e][i] * x[n]
+		}
+		y[e] = sum / f.sum[e]
+	}
+}
+
+// applyTranspose sets y to the sensitivities with respect to the unfiltered values,
+// given the sensitivities x with respect to the filtered values.
+func (f *topoFilter) applyTranspose(x, y []float64) {
+	for e := range y {
+		var sum float64
+		for i, n := range f.neighbours[e] {
+			// the filter weights are symmetric
+			sum += f.weights[e][i] * x[n] / f.sum[n]
+		}
+		y[e] = sum
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// Optimize returns the voxel densities of the stiffest solid using the volume fraction
+// of the design space, for the loads and fixed nodes of the problem.
+func (t *TopologyProblem) Optimize() (*DensityGrid, error) {
+	if t.Fixed == nil || t.Load == nil {
+		return nil, ErrMsg("Fixed == nil || Load == nil")
+	}
+	if t.VolumeFraction <= 0 || t.VolumeFraction >= 1 {
+		return nil, ErrMsg("VolumeFraction must be > 0 and < 1")
+	}
+	grid := NewDensityGrid(t.Domain, t.Cells)
+	if err := grid.check(); err != nil {
+		return nil, err
+	}
+	penalty, radius, iterations := t.Penalty, t.FilterRadius, t.Iterations
+	if penalty <= 0 {
+		penalty = 3
+	}
+	if radius <= 0 {
+		radius = 1.5
+	}
+	if iterations <= 0 {
+		iterations = 50
+	}
+
+	// boundary conditions
+	cells := t.Cells
+	step := grid.VoxelSize()
+	ndof := 3 * (cells[0] + 1) * (cells[1] + 1) * (cells[2] + 1)
+	s := &topoSolver{
+		cells: cells,
+		ke:    topoElementStiffness(step, topoPoisson),
+		fixed: make([]bool, ndof),
+		f:     make([]float64, ndof),
+		u:     make([]float64, ndof),
+		scale: make([]float64, len(grid.Density)),
+	}
+	nFixed, loaded := 0, false
+	n := 0
+	for i := 0; i <= cells[0]; i++ {
+		for j := 0; j <= cells[1]; j++ {
+			for k := 0; k <= cells[2]; k++ {
+				p := t.Domain.Min.Add(step.Mul(V3{float64(i), float64(j), float64(k)}))
+				if t.Fixed(p) {
+					s.fixed[3*n], s.fixed[3*n+1], s.fixed[3*n+2] = true, true, true
+					nFixed++
+				} else if f := t.Load(p); f != (V3{}) {
+					s.f[3*n], s.f[3*n+1], s.f[3*n+2] = f.X, f.Y, f.Z
+					loaded = true
+				}
+				n++
+			}
+		}
+	}
+	if nFixed == 0 {
+		return nil, ErrMsg("no fixed nodes")
+	}
+	if !loaded {
+		return nil, ErrMsg("no loads on free nodes")
+	}
+
+	// design space
+	active := make([]bool, len(grid.Density))
+	nActive := 0
+	for i := 0; i < cells[0]; i++ {
+		for j := 0; j < cells[1]; j++ {
+			for k := 0; k < cells[2]; k++ {
+				p := t.Domain.Min.Add(step.Mul(V3{float64(i) + 0.5, float64(j) + 0.5, float64(k) + 0.5}))
+				if t.Space == nil || t.Space.Evaluate(p) <= 0 {
+					active[grid.Index(i, j, k)] = true
+					nActive++
+				}
+			}
+		}
+	}
+	if nActive == 0 {
+		return nil, ErrMsg("empty design space")
+	}
+	volume := t.VolumeFraction * float64(nActive)
+
+	filter := newTopoFilter(cells, radius)
+	x := make([]float64, len(active))
+	xNew := make([]float64, len(active))
+	xPhys := grid.Density
+	physical := func(x []float64) float64 {
+		filter.apply(x, xPhys)
+		var sum float64
+		for e := range xPhys {
+			if !active[e] {
+				xPhys[e] = 0
+			}
+			sum += xPhys[e]
+		}
+		return sum
+	}
+	for e := range x {
+		if active[e] {
+			x[e] = t.VolumeFraction
+		}
+	}
+	physical(x)
+
+	dc := make([]float64, len(x))
+	dv := make([]float64, len(x))
+	ones := make([]float64, len(x))
+	for e := range ones {
+		ones[e] = 1
+	}
+	filter.applyTranspose(ones, dv)
+	for iteration := 0; iteration < iterations; iteration++ {
+		// displacements and compliance sensitivities
+		for e, v := range xPhys {
+			s.scale[e] = topoMinStiffness + math.Pow(v, penalty)*(1-topoMinStiffness)
+		}
+		s.solve()
+		ce := make([]float64, len(x))
+		s.each(func(e int, dofs *[24]int) {
+			var sum float64
+			for a, da := range dofs {
+				for b, db := range dofs {
+					sum += s.u[da] * s.ke[a][b] * s.u[db]
+				}
+			}
+			ce[e] = -penalty * math.Pow(xPhys[e], penalty-1) * (1 - topoMinStiffness) * sum
+		})
+		filter.applyTranspose(ce, dc)
+
+		// optimality criteria update, bisecting for the volume constraint
+		for l0, l1 := 0.0, 1e9; (l1-l0)/(l0+l1) > 1e-3; {
+			lm := 0.5 * (l0 + l1)
+			for e := range x {
+				if !active[e] {
+					continue
+				}
+				v := x[e] * math.Sqrt(math.Max(-dc[e], 0)/(dv[e]*lm))
+				xNew[e] = Clamp(v, math.Max(0, x[e]-topoMove), math.Min(1, x[e]+topoMove))
+			}
+			if physical(xNew) > volume {
+				l0 = lm
+			} else {
+				l1 = lm
+			}
+		}
+		change := 0.0
+		for e := range x {
+			change = math.Max(change, math.Abs(xNew[e]-x[e]))
+		}
+		x, xNew = xNew, x
+		if change < topoConverged {
+			break
+		}
+	}
+	physical(x)
+	return grid, nil
+}
+
+//-----------------------------------------------------------------------------
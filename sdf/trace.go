@@ -0,0 +1,256 @@
+//-----------------------------------------------------------------------------
+/*
+
+Bitmap Tracing
+
+Convert a black and white (or grayscale) raster image into vector contours
+and an SDF2. Marching squares on the pixel luminance gives the contours
+with sub-pixel accuracy, the contours are simplified (Douglas-Peucker)
+and optionally smoothed with quadratic bezier curves.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"image"
+	"math"
+)
+
+//-----------------------------------------------------------------------------
+
+// TraceParms defines the parameters for tracing an image.
+type TraceParms struct {
+	Threshold float64 // luminance threshold (0..1), pixels darker than this are inside (default 0.5)
+	Invert    bool    // pixels lighter than the threshold are inside
+	PixelSize float64 // size of a pixel in model units (default 1)
+	Simplify  float64 // maximum contour deviation (pixels) when simplifying, 0 = no simplification
+	Smooth    bool    // smooth the contours with bezier curves
+}
+
+//-----------------------------------------------------------------------------
+
+// traceEdge identifies a pixel grid edge crossed by a contour.
+type traceEdge struct {
+	x, y     int
+	vertical bool
+}
+
+// traceField returns the thresholded luminance of an image, < 0 is inside.
+// The image is padded with a row/column of outside pixels on each side.
+func traceField(img image.Image, k *TraceParms) ([][]float64, int, int) {
+	b := img.Bounds()
+	w, h := b.Dx()+2, b.Dy()+2
+	f := make([][]float64, w)
+	for x := range f {
+		f[x] = make([]float64, h)
+		for y := range f[x] {
+			f[x][y] = 1
+		}
+	}
+	for row := 0; row < b.Dy(); row++ {
+		for col := 0; col < b.Dx(); col++ {
+			r, g, b0, _ := img.At(b.Min.X+col, b.Min.Y+row).RGBA()
+			lum := (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b0)) / 0xffff
+			v := lum - k.Threshold
+			if k.Invert {
+				v = -v
+			}
+			if v == 0 {
+				// keep the field away from 0 so edge crossings are well defined
+				v = 1e-9
+			}
+			// the image y axis points down
+			f[col+1][h-2-row] = v
+		}
+	}
+	return f, w, h
+}
+
+// traceSegments returns the contour segments of a field (keyed by start edge).
+// Segments are oriented with the inside on the left.
+func traceSegments(f [][]float64, w, h int) map[traceEdge]traceEdge {
+	next := make(map[traceEdge]traceEdge)
+	for x := 0; x < w-1; x++ {
+		for y := 0; y < h-1; y++ {
+			// cell corners and edges in ccw order
+			c := [4]float64{f[x][y], f[x+1][y], f[x+1][y+1], f[x][y+1]}
+			e := [4]traceEdge{{x, y, false}, {x + 1, y, true}, {x, y + 1, false}, {x, y, true}}
+			// edge crossings in ccw order
+			var cross []int
+			for i := 0; i < 4; i++ {
+				if (c[i] < 0) != (c[(i+1)%4] < 0) {
+					cross = append(cross, i)
+				}
+			}
+			if len(cross) == 0 {
+				continue
+			}
+			// rotate the crossings so the first leaves the inside
+			if c[cross[0]] >= 0 {
+				cross = append(cross[1:], cross[0])
+			}
+			if len(cross) == 4 && (c[0]+c[1]+c[2]+c[3])/4 >= 0 {
+				// saddle with an outside center: the inside corners are separate
+				cross = []int{cross[0], cross[3], cross[2], cross[1]}
+			}
+			for i := 0; i < len(cross); i += 2 {
+				next[e[cross[i]]] = e[cross[i+1]]
+			}
+		}
+	}
+	return next
+}
+
+// point returns the position on an edge where the field crosses 0.
+func (e traceEdge) point(f [][]float64) V2 {
+	x1, y1 := e.x+1, e.y
+	if e.vertical {
+		x1, y1 = e.x, e.y+1
+	}
+	f0, f1 := f[e.x][e.y], f[x1][y1]
+	t := f0 / (f0 - f1)
+	return V2{float64(e.x) + t*float64(x1-e.x), float64(e.y) + t*float64(y1-e.y)}
+}
+
+//-----------------------------------------------------------------------------
+
+// simplify returns a simplified open polyline (Douglas-Peucker).
+func simplify(p []V2, tolerance float64) []V2 {
+	if len(p) < 3 {
+		return p
+	}
+	l := newLinePP(p[0], p[len(p)-1])
+	dMax, iMax := 0.0, 0
+	for i := 1; i < len(p)-1; i++ {
+		var d float64
+		if l.length == 0 {
+			d = p[i].Sub(p[0]).Length()
+		} else {
+			d = math.Abs(l.Distance(p[i]))
+		}
+		if d > dMax {
+			dMax, iMax = d, i
+		}
+	}
+	if dMax <= tolerance {
+		return []V2{p[0], p[len(p)-1]}
+	}
+	a := simplify(p[:iMax+1], tolerance)
+	b := simplify(p[iMax:], tolerance)
+	return append(a[:len(a)-1], b...)
+}
+
+// simplifyContour returns a simplified closed contour.
+func simplifyContour(p []V2, tolerance float64) []V2 {
+	// split the contour at the point furthest from the first point
+	iMax, dMax := 0, 0.0
+	for i := range p {
+		if d := p[i].Sub(p[0]).Length2(); d > dMax {
+			iMax, dMax = i, d
+		}
+	}
+	closed := append(append([]V2{}, p...), p[0])
+	a := simplify(closed[:iMax+1], tolerance)
+	b := simplify(closed[iMax:], tolerance)
+	return append(a[:len(a)-1], b[:len(b)-1]...)
+}
+
+// smoothContour returns a closed contour smoothed with quadratic bezier curves.
+// The contour vertices are the control points and the curves join at the edge midpoints.
+func smoothContour(p []V2) ([]V2, error) {
+	b := NewBezier()
+	n := len(p)
+	for i := range p {
+		b.AddV2(p[i].Add(p[(i+1)%n]).MulScalar(0.5))
+		b.AddV2(p[(i+1)%n]).Mid()
+	}
+	b.Close()
+	poly, err := b.Polygon()
+	if err != nil {
+		return nil, err
+	}
+	return poly.Vertices(), nil
+}
+
+//-----------------------------------------------------------------------------
+
+// TraceContours returns the contours of an image in model units.
+// The origin is the bottom left corner of the image.
+// Outer contours are counter-clockwise and holes are clockwise.
+func TraceContours(img image.Image, k *TraceParms) ([]V2Set, error) {
+	p := *k
+	if p.Threshold == 0 {
+		p.Threshold = 0.5
+	}
+	if p.PixelSize == 0 {
+		p.PixelSize = 1
+	}
+	if p.PixelSize < 0 || p.Simplify < 0 {
+		return nil, ErrMsg("bad trace parameters")
+	}
+
+	f, w, h := traceField(img, &p)
+	next := traceSegments(f, w, h)
+
+	var contours []V2Set
+	for len(next) != 0 {
+		// pick any remaining segment and follow it around the contour
+		var start traceEdge
+		for start = range next {
+			break
+		}
+		var c []V2
+		for e := start; ; {
+			c = append(c, e.point(f))
+			n, ok := next[e]
+			if !ok {
+				return nil, ErrMsg("open contour")
+			}
+			delete(next, e)
+			e = n
+			if e == start {
+				break
+			}
+		}
+		if p.Simplify > 0 {
+			c = simplifyContour(c, p.Simplify)
+		}
+		if len(c) < 3 {
+			// degenerate contour
+			continue
+		}
+		if p.Smooth {
+			var err error
+			c, err = smoothContour(c)
+			if err != nil {
+				return nil, err
+			}
+		}
+		// pixel centers (with padding) to model units
+		for i := range c {
+			c[i] = c[i].SubScalar(0.5).MulScalar(p.PixelSize)
+		}
+		contours = append(contours, c)
+	}
+	if len(contours) == 0 {
+		return nil, ErrMsg("no contours found in the image")
+	}
+	return contours, nil
+}
+
+// TraceImage2D returns an SDF2 for the inside pixels of an image.
+func TraceImage2D(img image.Image, k *TraceParms) (SDF2, error) {
+	contours, err := TraceContours(img, k)
+	if err != nil {
+		return nil, err
+	}
+	c := make([][]V2, len(contours))
+	for i := range contours {
+		c[i] = contours[i]
+	}
+	return MultiPolygon2D(c)
+}
+
+//-----------------------------------------------------------------------------
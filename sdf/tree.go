@@ -0,0 +1,185 @@
+//-----------------------------------------------------------------------------
+/*
+
+SDF Trees
+
+An SDF model is a tree of SDF2/SDF3 nodes. Walk the tree to find the
+subtree responsible for a problem (bad distances, NaNs, etc).
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"reflect"
+)
+
+//-----------------------------------------------------------------------------
+
+// parent is implemented by the SDFs built from other SDFs.
+// children returns pointers (*SDF2 or *SDF3) to the child fields.
+type parent interface {
+	children() []interface{}
+}
+
+// Children returns the child SDF2s/SDF3s of an SDF node (nil for leaf nodes).
+func Children(s interface{}) []interface{} {
+	p, ok := s.(parent)
+	if !ok {
+		return nil
+	}
+	c := p.children()
+	for i, x := range c {
+		switch x := x.(type) {
+		case *SDF3:
+			c[i] = *x
+		case *SDF2:
+			c[i] = *x
+		}
+	}
+	return c
+}
+
+// NodeName returns the type name of an SDF node.
+func NodeName(s interface{}) string {
+	t := reflect.TypeOf(s)
+	if t == nil {
+		return "nil"
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
+
+// WalkFunc is called for each node of an SDF tree.
+// The path names each node from the root, e.g. "UnionSDF3[1]/TransformSDF3[0]/BoxSDF3".
+// Return false to skip the children of the node.
+type WalkFunc func(s interface{}, path string) bool
+
+// Walk visits each node of an SDF tree (depth first, parents before children).
+func Walk(s interface{}, fn WalkFunc) {
+	walk(s, NodeName(s), fn)
+}
+
+func walk(s interface{}, path string, fn WalkFunc) {
+	if !fn(s, path) {
+		return
+	}
+	for i, c := range Children(s) {
+		walk(c, childPath(path, i, c), fn)
+	}
+}
+
+// childPath returns the tree path of the i-th child of a node.
+func childPath(path string, i int, c interface{}) string {
+	return fmt.Sprintf("%s[%d]/%s", path, i, NodeName(c))
+}
+
+// copyTree returns a copy of an SDF tree with each node replaced by fn(node, path).
+// Children are replaced before their parents. Leaf nodes are not copied.
+func copyTree(s interface{}, path string, fn func(s interface{}, path string) interface{}) interface{} {
+	if _, ok := s.(parent); ok {
+		// shallow copy of the node
+		v := reflect.New(reflect.TypeOf(s).Elem())
+		v.Elem().Set(reflect.ValueOf(s).Elem())
+		s = v.Interface()
+		// don't share child slices with the original
+		switch u := s.(type) {
+		case *UnionSDF2:
+			u.sdf = append([]SDF2(nil), u.sdf...)
+		case *UnionSDF3:
+			u.sdf = append([]SDF3(nil), u.sdf...)
+		}
+		for i, c := range s.(parent).children() {
+			switch c := c.(type) {
+			case *SDF3:
+				*c = copyTree(*c, childPath(path, i, *c), fn).(SDF3)
+			case *SDF2:
+				*c = copyTree(*c, childPath(path, i, *c), fn).(SDF2)
+			}
+		}
+	}
+	return fn(s, path)
+}
+
+//-----------------------------------------------------------------------------
+// SDF2 children
+
+func (s *OffsetSDF2) children() []interface{}       { return []interface{}{&s.sdf} }
+func (s *IntersectionSDF2) children() []interface{} { return []interface{}{&s.s0, &s.s1} }
+func (s *CutSDF2) children() []interface{}          { return []interface{}{&s.sdf} }
+func (s *TransformSDF2) children() []interface{}    { return []interface{}{&s.sdf} }
+func (s *ScaleUniformSDF2) children() []interface{} { return []interface{}{&s.sdf} }
+func (s *ArraySDF2) children() []interface{}        { return []interface{}{&s.sdf} }
+func (s *RotateUnionSDF2) children() []interface{}  { return []interface{}{&s.sdf} }
+func (s *RotateCopySDF2) children() []interface{}   { return []interface{}{&s.sdf} }
+func (s *SliceSDF2) children() []interface{}        { return []interface{}{&s.sdf} }
+func (s *DifferenceSDF2) children() []interface{}   { return []interface{}{&s.s0, &s.s1} }
+func (s *ElongateSDF2) children() []interface{}     { return []interface{}{&s.sdf} }
+
+func (s *UnionSDF2) children() []interface{} {
+	c := make([]interface{}, len(s.sdf))
+	for i := range s.sdf {
+		c[i] = &s.sdf[i]
+	}
+	return c
+}
+
+//-----------------------------------------------------------------------------
+// SDF3 children
+
+func (s *SorSDF3) children() []interface{}            { return []interface{}{&s.sdf} }
+func (s *ExtrudeSDF3) children() []interface{}        { return []interface{}{&s.sdf} }
+func (s *ExtrudeRoundedSDF3) children() []interface{} { return []interface{}{&s.sdf} }
+func (s *LoftSDF3) children() []interface{}           { return []interface{}{&s.sdf0, &s.sdf1} }
+func (s *ScrewSDF3) children() []interface{}          { return []interface{}{&s.thread} }
+func (s *TransformSDF3) children() []interface{}      { return []interface{}{&s.sdf} }
+func (s *ScaleUniformSDF3) children() []interface{}   { return []interface{}{&s.sdf} }
+func (s *DifferenceSDF3) children() []interface{}     { return []interface{}{&s.s0, &s.s1} }
+func (s *ElongateSDF3) children() []interface{}       { return []interface{}{&s.sdf} }
+func (s *IntersectionSDF3) children() []interface{}   { return []interface{}{&s.s0, &s.s1} }
+func (s *CutSDF3) children() []interface{}            { return []interface{}{&s.sdf} }
+func (s *ArraySDF3) children() []interface{}          { return []interface{}{&s.sdf} }
+func (s *RotateUnionSDF3) children() []interface{}    { return []interface{}{&s.sdf} }
+func (s *RotateCopySDF3) children() []interface{}     { return []interface{}{&s.sdf} }
+func (s *OffsetSDF3) children() []interface{}         { return []interface{}{&s.sdf} }
+func (s *ShellSDF3) children() []interface{}          { return []interface{}{&s.sdf} }
+func (s *RedistanceSDF3) children() []interface{}     { return []interface{}{&s.sdf} }
+func (s *ColorSDF3) children() []interface{}          { return []interface{}{&s.sdf} }
+func (s *ProfileExtrudeSDF3) children() []interface{} { return []interface{}{&s.sdf} }
+func (s *XorSDF3) children() []interface{}            { return []interface{}{&s.s0, &s.s1} }
+func (s *CommonShellSDF3) children() []interface{}    { return []interface{}{&s.s0, &s.s1} }
+func (s *ConformalSDF3) children() []interface{}      { return []interface{}{&s.surface, &s.pattern} }
+func (s *uvPatternSDF3) children() []interface{}      { return []interface{}{&s.sdf} }
+func (s *MarkSDF3) children() []interface{}           { return []interface{}{&s.sdf, &s.mark} }
+
+func (s *UnionSDF3) children() []interface{} {
+	c := make([]interface{}, len(s.sdf))
+	for i := range s.sdf {
+		c[i] = &s.sdf[i]
+	}
+	return c
+}
+
+func (s *FieldSDF3) children() []interface{} {
+	c := make([]interface{}, len(s.inputs))
+	for i := range s.inputs {
+		c[i] = &s.inputs[i]
+	}
+	return c
+}
+
+func (s *GradedLatticeSDF3) children() []interface{} {
+	c := []interface{}{&s.body}
+	for _, g := range []*Grade{&s.cell, &s.thickness} {
+		if g.Field != nil {
+			c = append(c, &g.Field)
+		}
+	}
+	return c
+}
+
+//-----------------------------------------------------------------------------
@@ -0,0 +1,166 @@
+//-----------------------------------------------------------------------------
+/*
+
+Tube Networks
+
+A graph of nodes (points with radii) joined by edges, each edge a tapered
+tube (the convex hull of the spheres at its nodes, an exact distance).
+The tubes are blended with a smooth minimum, so the joints get fillets
+(metaball-like for large blends). Used for fluid manifolds, frames, wire
+structures and organic shapes.
+
+Only the tubes within the blend distance of the nearest tube change the
+distance, the others are culled by their bounding boxes.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"math"
+	"sort"
+)
+
+//-----------------------------------------------------------------------------
+
+// TubeNode is a node of a tube network.
+type TubeNode struct {
+	Position V3      // center
+	Radius   float64 // tube radius at the node
+}
+
+// tubeSegment is a tapered tube between two spheres.
+type tubeSegment struct {
+	a, ba  V3      // start, start to end
+	r0, r1 float64 // start and end radius
+	l2     float64 // squared length
+	rr     float64 // radius change
+	a2     float64 // squared length less the squared radius change (<= 0: one sphere holds the other)
+	bb     Box3    // bounding box
+}
+
+func newTubeSegment(a, b TubeNode) tubeSegment {
+	t := tubeSegment{a: a.Position, ba: b.Position.Sub(a.Position), r0: a.Radius, r1: b.Radius}
+	t.l2 = t.ba.Length2()
+	t.rr = t.r0 - t.r1
+	t.a2 = t.l2 - t.rr*t.rr
+	r0 := V3{t.r0, t.r0, t.r0}
+	r1 := V3{t.r1, t.r1, t.r1}
+	t.bb = Box3{a.Position.Sub(r0), a.Position.Add(r0)}.Extend(Box3{b.Position.Sub(r1), b.Position.Add(r1)})
+	return t
+}
+
+// evaluate returns the distance to a tube segment (a round cone).
+// See: https://iquilezles.org/articles/distfunctions/
+func (t *tubeSegment) evaluate(p V3) float64 {
+	pa := p.Sub(t.a)
+	if t.a2 <= 0 {
+		// the larger sphere holds the smaller one
+		if t.r0 >= t.r1 {
+			return pa.Length() - t.r0
+		}
+		return pa.Sub(t.ba).Length() - t.r1
+	}
+	y := pa.Dot(t.ba)
+	z := y - t.l2
+	x2 := pa.MulScalar(t.l2).Sub(t.ba.MulScalar(y)).Length2()
+	y2 := y * y * t.l2
+	z2 := z * z * t.l2
+	k := math.Copysign(t.rr*t.rr*x2, t.rr)
+	if math.Copysign(t.a2*z2, z) > k {
+		return math.Sqrt(x2+z2)/t.l2 - t.r1
+	}
+	if math.Copysign(t.a2*y2, y) < k {
+		return math.Sqrt(x2+y2)/t.l2 - t.r0
+	}
+	return (math.Sqrt(x2*t.a2/t.l2)+y*t.rr)/t.l2 - t.r0
+}
+
+//-----------------------------------------------------------------------------
+
+// TubeNetworkSDF3 is a network of tapered tubes blended at the joints.
+type TubeNetworkSDF3 struct {
+	tubes []tubeSegment
+	blend float64
+	bb    Box3
+}
+
+// TubeNetwork3D returns an SDF3 for a network of tubes between the nodes joined by the edges
+// (node index pairs), blended by a smooth minimum of size blend (0: no blending). The nodes
+// without edges are spheres.
+func TubeNetwork3D(nodes []TubeNode, edges [][2]int, blend float64) (SDF3, error) {
+	if len(nodes) == 0 {
+		return nil, ErrMsg("no nodes")
+	}
+	if blend < 0 {
+		return nil, ErrMsg("blend < 0")
+	}
+	for _, n := range nodes {
+		if n.Radius <= 0 {
+			return nil, ErrMsg("radius <= 0")
+		}
+	}
+	s := TubeNetworkSDF3{blend: blend}
+	joined := make([]bool, len(nodes))
+	for _, e := range edges {
+		if e[0] < 0 || e[0] >= len(nodes) || e[1] < 0 || e[1] >= len(nodes) {
+			return nil, ErrMsg("bad node index")
+		}
+		if e[0] == e[1] {
+			return nil, ErrMsg("edge joins a node to itself")
+		}
+		s.tubes = append(s.tubes, newTubeSegment(nodes[e[0]], nodes[e[1]]))
+		joined[e[0]], joined[e[1]] = true, true
+	}
+	for i, n := range nodes {
+		if !joined[i] {
+			s.tubes = append(s.tubes, newTubeSegment(n, n))
+		}
+	}
+	s.bb = s.tubes[0].bb
+	for _, t := range s.tubes {
+		s.bb = s.bb.Extend(t.bb)
+	}
+	// the smooth minimum moves the surface out by up to blend / 4
+	s.bb = s.bb.Enlarge(V3{blend, blend, blend}.MulScalar(0.5))
+	return &s, nil
+}
+
+// Evaluate returns the minimum distance to a tube network.
+func (s *TubeNetworkSDF3) Evaluate(p V3) float64 {
+	best := math.Inf(1)
+	var near []float64
+	for i := range s.tubes {
+		t := &s.tubes[i]
+		// the distance to the box is a lower bound of the distance to the tube
+		if p.Sub(p.Clamp(t.bb.Min, t.bb.Max)).Length() > best+s.blend {
+			continue
+		}
+		d := t.evaluate(p)
+		best = math.Min(best, d)
+		if s.blend != 0 {
+			near = append(near, d)
+		}
+	}
+	if s.blend == 0 || len(near) == 1 {
+		return best
+	}
+	// blend the tubes within the blend distance, nearest first
+	sort.Float64s(near)
+	d := near[0]
+	for _, x := range near[1:] {
+		if x >= best+s.blend {
+			break
+		}
+		d = poly(d, x, s.blend)
+	}
+	return d
+}
+
+// BoundingBox returns the bounding box of a tube network.
+func (s *TubeNetworkSDF3) BoundingBox() Box3 {
+	return s.bb
+}
+
+//-----------------------------------------------------------------------------
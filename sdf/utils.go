@@ -75,6 +75,30 @@ func Sign(x float64) float64 {
 	return 0
 }
 
+// imin returns the minimum of two ints.
+func imin(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// imax returns the maximum of two ints.
+func imax(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// iabs returns the absolute value of an int.
+func iabs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
 //-----------------------------------------------------------------------------
 
 // SawTooth generates a sawtooth function. Returns [-period/2, period/2)
@@ -97,7 +121,7 @@ func RoundMin(k float64) MinFunc {
 	}
 }
 
-// ChamferMin returns a minimum function that makes a 45-degree chamfered edge (the diagonal of a square of size <r>).
+// ChamferMin returns a minimum function that makes a 45-degree chamfered edge (the diagonal of a square of size k).
 // TODO: why the holes in the rendering?
 func ChamferMin(k float64) MinFunc {
 	return func(a, b float64) float64 {
@@ -146,6 +170,54 @@ func PolyMax(k float64) MaxFunc {
 	}
 }
 
+// RoundMax returns a maximum function that uses a quarter-circle to join the two objects smoothly.
+func RoundMax(k float64) MaxFunc {
+	return func(a, b float64) float64 {
+		u := V2{k + a, k + b}.Max(V2{0, 0})
+		return math.Min(-k, math.Max(a, b)) + u.Length()
+	}
+}
+
+// ChamferMax returns a maximum function that makes a 45-degree chamfered edge (the diagonal of a square of size k).
+func ChamferMax(k float64) MaxFunc {
+	return func(a, b float64) float64 {
+		return math.Max(math.Max(a, b), (a+k+b)*sqrtHalf)
+	}
+}
+
+//-----------------------------------------------------------------------------
+
+// stairs returns the stepped minimum of a and b with n steps over a size k.
+func stairs(a, b, k float64, n int) float64 {
+	s := k / float64(n)
+	u := b - k
+	x := u - a + s
+	m := x - 2*s*math.Floor(x/(2*s))
+	return math.Min(math.Min(a, b), 0.5*(u+a+math.Abs(m-s)))
+}
+
+// StairsMin returns a minimum function that joins the two objects with n steps of total size k
+// (n < 1 is 1 step).
+func StairsMin(k float64, n int) MinFunc {
+	if n < 1 {
+		n = 1
+	}
+	return func(a, b float64) float64 {
+		return stairs(a, b, k, n)
+	}
+}
+
+// StairsMax returns a maximum function that joins the two objects with n steps of total size k
+// (n < 1 is 1 step).
+func StairsMax(k float64, n int) MaxFunc {
+	if n < 1 {
+		n = 1
+	}
+	return func(a, b float64) float64 {
+		return -stairs(-a, -b, k, n)
+	}
+}
+
 //-----------------------------------------------------------------------------
 
 // ExtrudeFunc maps V3 to V2 - the point used to evaluate the SDF2.
@@ -200,6 +272,12 @@ func sigmoidScaled(x float64) float64 {
 	return 2/(1+math.Exp(-x)) - 1
 }
 
+// raycastRelaxation is the over-relaxation factor of the sphere tracing steps.
+const raycastRelaxation = 1.6
+
+// raycastSegmentGrowth is how much the segment used for Lipschitz bounds grows on each step.
+const raycastSegmentGrowth = 2
+
 // Raycast3 collides a ray (with an origin point from and a direction dir) with an SDF3.
 // sigmoid is useful for fixing bad distance functions (those that do not accurately represent the distance to the
 // closest surface, but will probably imply more evaluations)
@@ -207,28 +285,82 @@ func sigmoidScaled(x float64) float64 {
 // distance to the closest surface.
 // It returns the collision point, how many normalized distances to reach it (t), and the number of steps performed
 // If no surface is found (in maxDist and maxSteps), t is < 0
+//
+// SDF3s with Lipschitz metadata (see SegmentLipschitz3) scale the steps by the Lipschitz bound of the
+// segment ahead (Galin et al., "Segment Tracing Using Local Lipschitz Bounds"). See RaycastParams for
+// over-relaxed steps.
 func Raycast3(s SDF3, from, dir V3, scaleAndSigmoid, stepScale, epsilon, maxDist float64, maxSteps int) (collision V3, t float64, steps int) {
+	return raycast3(s, from, dir, scaleAndSigmoid, stepScale, epsilon, maxDist, maxSteps, false)
+}
+
+// raycast3 is Raycast3, with optionally relaxed steps.
+//
+// Relaxed steps are over-relaxed (Keinert et al., "Enhanced Sphere Tracing"): they are longer than the
+// distance while the unbounding spheres of consecutive steps overlap, stepping back and relaxing less
+// when they don't. A step that crosses the surface is refined with regula falsi.
+func raycast3(s SDF3, from, dir V3, scaleAndSigmoid, stepScale, epsilon, maxDist float64, maxSteps int, relaxed bool) (collision V3, t float64, steps int) {
 	t = 0
 	dirN := dir.Normalize()
 	pos := from
+	relax := raycastRelaxation
+	if !relaxed || scaleAndSigmoid > 0 {
+		// plain steps (the sigmoid doesn't bound the distance)
+		relax = 1
+	}
+	omega := relax
+	lip, _ := s.(SegmentLipschitz3)
+	segment := maxDist
+	sign := 1.0
+	var prevVal, prevRadius, prevStep float64
 	for {
-		val := math.Abs(s.Evaluate(pos))
+		val := s.Evaluate(pos)
+		if steps == 0 && val < 0 {
+			sign = -1
+		}
 		//log.Print("Raycast step #", steps, " at ", pos, " with value ", val, "\n")
-		if val < epsilon {
+		if math.Abs(val) < epsilon {
 			collision = pos // Success
 			break
 		}
+		crossed := relaxed && steps != 0 && sign*val < 0
+		if crossed && prevStep <= prevRadius {
+			// the surface was crossed: find it between the last two points
+			return raycastBracket(s, from, dirN, t-prevStep, t, prevVal, val, epsilon, steps, maxSteps)
+		}
+		radius := math.Abs(val)
+		if scaleAndSigmoid > 0 {
+			radius = sigmoidScaled(radius * 10)
+		}
+		radius *= stepScale
+		if lip != nil {
+			if k := lip.LipschitzBound(pos, pos.Add(dirN.MulScalar(segment))); k > 0 {
+				radius = math.Min(radius/k, segment)
+			}
+		}
+		if crossed || (omega > 1 && radius+prevRadius < prevStep) {
+			// the spheres don't overlap (or an over-relaxed step crossed the surface, maybe
+			// more than once): step back to the end of the previous sphere, take a plain
+			// step from there and relax less from then on
+			omega = 1
+			relax = 1 + (relax-1)/2
+			t -= prevStep - prevRadius
+			pos = from.Add(dirN.MulScalar(t))
+			prevStep = prevRadius
+			segment = prevRadius
+			steps++
+			continue
+		}
 		steps++
-		if steps == maxSteps {
+		if steps >= maxSteps {
 			t = -1 // Failure
 			break
 		}
-		if scaleAndSigmoid > 0 {
-			val = sigmoidScaled(val * 10)
-		}
-		delta := val * stepScale
+		delta := radius * omega
+		omega = relax
+		prevVal, prevRadius, prevStep = val, radius, delta
+		segment = delta * raycastSegmentGrowth
 		t += delta
-		pos = pos.Add(dirN.MulScalar(delta))
+		pos = from.Add(dirN.MulScalar(t))
 		if t < 0 || t > maxDist {
 			t = -1 // Failure
 			break
@@ -238,6 +370,37 @@ func Raycast3(s SDF3, from, dir V3, scaleAndSigmoid, stepScale, epsilon, maxDist
 	return
 }
 
+// raycastBracket finds the surface crossed by a ray between t0 and t1 (with field values v0 and v1)
+// using the Illinois variant of regula falsi.
+func raycastBracket(s SDF3, from, dirN V3, t0, t1, v0, v1, epsilon float64, steps, maxSteps int) (V3, float64, int) {
+	side := 0
+	for {
+		steps++
+		if steps >= maxSteps {
+			return V3{}, -1, steps // Failure
+		}
+		t := (t0*v1 - t1*v0) / (v1 - v0)
+		pos := from.Add(dirN.MulScalar(t))
+		val := s.Evaluate(pos)
+		if math.Abs(val) < epsilon || t1-t0 < epsilon {
+			return pos, t, steps // Success
+		}
+		if (val < 0) == (v1 < 0) {
+			t1, v1 = t, val
+			if side == 1 {
+				v0 /= 2
+			}
+			side = 1
+		} else {
+			t0, v0 = t, val
+			if side == -1 {
+				v1 /= 2
+			}
+			side = -1
+		}
+	}
+}
+
 // Raycast2 see Raycast3. NOTE: implementation using Raycast3 (inefficient?)
 func Raycast2(s SDF2, from, dir V2, scaleAndSigmoid, stepScale, epsilon, maxDist float64, maxSteps int) (V2, float64, int) {
 	collision, t, steps := Raycast3(Extrude3D(s, 1), from.ToV3(0), dir.ToV3(0), scaleAndSigmoid, stepScale, epsilon, maxDist, maxSteps)
@@ -249,22 +412,17 @@ func Raycast2(s SDF2, from, dir V2, scaleAndSigmoid, stepScale, epsilon, maxDist
 //-----------------------------------------------------------------------------
 
 // Normal3 returns the normal of an SDF3 at a point (doesn't need to be on the surface).
-// Computed by sampling it several times inside a box of side 2*eps centered on p.
+// The analytic gradient is used if available (see SDF3Gradient), otherwise it is
+// computed by sampling it several times inside a box of side 2*eps centered on p.
 func Normal3(s SDF3, p V3, eps float64) V3 {
-	return V3{
-		X: s.Evaluate(p.Add(V3{X: eps})) - s.Evaluate(p.Add(V3{X: -eps})),
-		Y: s.Evaluate(p.Add(V3{Y: eps})) - s.Evaluate(p.Add(V3{Y: -eps})),
-		Z: s.Evaluate(p.Add(V3{Z: eps})) - s.Evaluate(p.Add(V3{Z: -eps})),
-	}.Normalize()
+	return Gradient3(s, p, eps).Normalize()
 }
 
-// Normal2 returns the normal of an SDF3 at a point (doesn't need to be on the surface).
-// Computed by sampling it several times inside a box of side 2*eps centered on p.
+// Normal2 returns the normal of an SDF2 at a point (doesn't need to be on the surface).
+// The analytic gradient is used if available (see SDF2Gradient), otherwise it is
+// computed by sampling it several times inside a box of side 2*eps centered on p.
 func Normal2(s SDF2, p V2, eps float64) V2 {
-	return V2{
-		X: s.Evaluate(p.Add(V2{X: eps})) - s.Evaluate(p.Add(V2{X: -eps})),
-		Y: s.Evaluate(p.Add(V2{Y: eps})) - s.Evaluate(p.Add(V2{Y: -eps})),
-	}.Normalize()
+	return Gradient2(s, p, eps).Normalize()
 }
 
 //-----------------------------------------------------------------------------
@@ -0,0 +1,73 @@
+//-----------------------------------------------------------------------------
+/*
+
+Warnings
+
+Non-fatal problems found while building, evaluating or rendering an SDF
+are reported as structured warnings. By default they are logged, but an
+application can install a handler to collect and react to them.
+
+*/
+//-----------------------------------------------------------------------------
+
+package sdf
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+//-----------------------------------------------------------------------------
+
+// Warning kinds.
+const (
+	WarnNonFinite   = "non-finite"   // NaN or Inf distance or bounding box
+	WarnNotDistance = "not-distance" // field is not a distance bound (Lipschitz bound > 1)
+	WarnResolution  = "resolution"   // features are smaller than the rendering resolution
+)
+
+// Warning is a non-fatal problem with an SDF.
+type Warning struct {
+	Kind  string // kind of warning (see the Warn* constants)
+	Path  string // SDF tree path of the node causing the problem (if known)
+	Point V3     // location of the problem (if known)
+	Msg   string // description of the problem
+}
+
+func (w *Warning) String() string {
+	s := fmt.Sprintf("%s: %s", w.Kind, w.Msg)
+	if w.Path != "" {
+		s += fmt.Sprintf(" (%s at %v)", w.Path, w.Point)
+	}
+	return s
+}
+
+// WarningHandler is called for each warning.
+// It may be called concurrently from multiple goroutines.
+type WarningHandler func(w *Warning)
+
+var warningLock sync.RWMutex
+var warningHandler WarningHandler
+
+// SetWarningHandler sets the function called for each warning.
+// A nil handler restores the default (log the warning).
+func SetWarningHandler(h WarningHandler) {
+	warningLock.Lock()
+	warningHandler = h
+	warningLock.Unlock()
+}
+
+// Warn reports a warning.
+func Warn(w *Warning) {
+	warningLock.RLock()
+	h := warningHandler
+	warningLock.RUnlock()
+	if h == nil {
+		log.Printf("warning: %s\n", w)
+		return
+	}
+	h(w)
+}
+
+//-----------------------------------------------------------------------------